@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
+	"github.com/nofx/config"
+	"github.com/nofx/crypto"
+	"github.com/nofx/logger"
+)
+
+// apiKeyHeader carries the static API key of machine clients
+const apiKeyHeader = "X-API-Key"
+
+// bearerProtocol is the websocket subprotocol browsers, which can't set
+// headers on websockets, offer before their token: new WebSocket(url,
+// ["bearer", token])
+const bearerProtocol = "bearer"
+
+// streamPaths also accept the bearer token as the ?token= query parameter,
+// as browser websockets and EventSources can't set headers, or as the
+// websocket subprotocol following bearerProtocol
+var streamPaths = map[string]bool{
+	"/api/events/stream":     true,
+	"/api/admin/logs/stream": true,
+}
+
+// publicPaths are reachable without credentials
+var publicPaths = map[string]bool{
+	"/api/health":       true,
+	"/api/ready":        true,
+	"/api/auth/login":   true,
+	"/api/openapi.json": true,
+	"/api/docs":         true,
+	// TradingView alerts authenticate with the webhook secret
+	"/api/webhook/tradingview": true,
+}
+
+// principalKey is the request context key of the authenticated principal
+type principalKey struct{}
+
+// authenticator verifies API keys and issues and verifies JWT bearer tokens
+type authenticator struct {
+	apiKeys [][]byte
+	users   map[string]string
+	secret  []byte
+	ttl     time.Duration
+}
+
+// newAuthenticator creates an authenticator from the security configuration;
+// without a configured JWT secret a random one is generated, so tokens don't
+// survive restarts
+func newAuthenticator(cfg config.SecurityConfig) (*authenticator, error) {
+	a := &authenticator{
+		users: cfg.Users,
+		ttl:   time.Duration(cfg.TokenTTL) * time.Minute,
+	}
+	for _, key := range cfg.APIKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			a.apiKeys = append(a.apiKeys, []byte(key))
+		}
+	}
+
+	a.secret = []byte(cfg.JWTSecret)
+	if len(a.secret) == 0 {
+		secret, err := crypto.GenerateRandomBytes(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate JWT secret: %w", err)
+		}
+		a.secret = secret
+		logger.Warning("No JWT secret configured; issued tokens will not survive a restart")
+	}
+	if len(a.apiKeys) == 0 && len(a.users) == 0 {
+		logger.Warning("API authentication enabled without API keys or users; every request will be rejected")
+	}
+	return a, nil
+}
+
+// middleware rejects requests to non-public paths without a valid API key or bearer token
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := a.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nofx"`)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// authenticate returns the principal of a request
+func (a *authenticator) authenticate(r *http.Request) (string, error) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		for _, k := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(key), k) == 1 {
+				return "api-key", nil
+			}
+		}
+		return "", errors.New("invalid API key")
+	}
+
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return a.verify(strings.TrimPrefix(header, "Bearer "))
+	}
+	if streamPaths[r.URL.Path] {
+		if token := streamToken(r); token != "" {
+			return a.verify(token)
+		}
+	}
+	return "", errors.New("missing credentials")
+}
+
+// streamToken returns the bearer token of a stream request, from the
+// websocket subprotocols or the query
+func streamToken(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	for i, p := range protocols {
+		if p == bearerProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return r.URL.Query().Get("token")
+}
+
+// issue creates a signed token for a user
+func (a *authenticator) issue(user string) (string, time.Time, error) {
+	expires := time.Now().Add(a.ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   user,
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(expires),
+	})
+	signed, err := token.SignedString(a.secret)
+	return signed, expires, err
+}
+
+// verify validates a token and returns its user
+func (a *authenticator) verify(tokenString string) (string, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return a.secret, nil
+	})
+	if err != nil {
+		return "", errors.New("invalid token")
+	}
+	if _, ok := a.users[claims.Subject]; !ok {
+		return "", errors.New("unknown user")
+	}
+	return claims.Subject, nil
+}
+
+// loginRequest is the body of a login
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// login exchanges a username and password for a bearer token
+func (a *authenticator) login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	hash, ok := a.users[req.Username]
+	if !ok || !crypto.CheckPasswordHash(req.Password, hash) {
+		writeError(w, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	token, expires, err := a.issue(req.Username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expires,
+	})
+}
+
+// Principal returns the authenticated user of a request, or "" when
+// authentication is disabled
+func Principal(r *http.Request) string {
+	principal, _ := r.Context().Value(principalKey{}).(string)
+	return principal
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"encoding"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/nofx/market"
+	"github.com/nofx/trader"
+)
+
+const (
+	// floatDecimals serializes decimals as JSON numbers
+	floatDecimals = "float"
+	// stringDecimals serializes decimals as JSON strings
+	stringDecimals = "string"
+)
+
+// priceFields are rounded to the tick size of their object's contract
+var priceFields = map[string]bool{
+	"price":             true,
+	"entry_price":       true,
+	"mark_price":        true,
+	"trigger_price":     true,
+	"liquidation_price": true,
+	"stop_price":        true,
+	"extreme_price":     true,
+}
+
+// quantityFields are rounded to the quantity step of their object's contract
+var quantityFields = map[string]bool{
+	"size":          true,
+	"amount":        true,
+	"filled_amount": true,
+	"quantity":      true,
+}
+
+// decimalEncoder rewrites response values before JSON encoding so floats are
+// free of binary noise: prices and quantities of objects naming a cached
+// contract are rounded to its tick size and quantity step, and any other
+// float to a fixed number of decimal places. In string mode decimals are
+// emitted as JSON strings.
+type decimalEncoder struct {
+	mode      string
+	places    int
+	contracts *market.ContractCache
+}
+
+// decimals is the encoder of every API response, configured by NewServer
+var decimals = &decimalEncoder{mode: floatDecimals, places: 8}
+
+// member represents a field of an encoded object
+type member struct {
+	name  string
+	value interface{}
+}
+
+// object represents an encoded object keeping the field order of its struct
+type object []member
+
+// MarshalJSON implements the json.Marshaler interface
+func (o object) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(m.name)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// marshalerType and textMarshalerType are encoded by their own methods
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// encode returns v rewritten for JSON encoding
+func (e *decimalEncoder) encode(v interface{}) interface{} {
+	return e.value(reflect.ValueOf(v), "", nil)
+}
+
+// value rewrites a value; field is its name in the enclosing object and
+// contract the contract of the nearest object naming a currency pair
+func (e *decimalEncoder) value(v reflect.Value, field string, contract *market.ContractInfo) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type().Implements(marshalerType) || v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil
+		}
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return e.value(v.Elem(), field, contract)
+	case reflect.Float32, reflect.Float64:
+		return e.float(v.Float(), field, contract)
+	case reflect.Struct:
+		return e.object(v, contract)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Key().Kind() == reflect.String {
+			if pv := v.MapIndex(reflect.ValueOf("currency_pair").Convert(v.Type().Key())); pv.IsValid() {
+				if pair, ok := pv.Interface().(string); ok {
+					contract = e.contract(pair, contract)
+				}
+			}
+		}
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key()
+			name := key.String()
+			if key.Kind() != reflect.String {
+				name = toString(key)
+			}
+			m[name] = e.value(iter.Value(), name, contract)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = e.value(v.Index(i), field, contract)
+		}
+		return list
+	default:
+		return v.Interface()
+	}
+}
+
+// object rewrites a struct following the encoding/json field rules: json
+// tags, omitempty, "-" and the fields of untagged embedded structs
+func (e *decimalEncoder) object(v reflect.Value, contract *market.ContractInfo) interface{} {
+	fields := make(object, 0, v.NumField())
+	seen := make(map[string]bool)
+	embedded := make(map[int]reflect.Value)
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				// Expanded in place once the outer names are known
+				embedded[len(fields)] = fv
+				fields = append(fields, member{})
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fv := v.Field(i)
+		if strings.Contains(options, "omitempty") && isEmpty(fv) {
+			continue
+		}
+		if name == "currency_pair" && fv.Kind() == reflect.String {
+			contract = e.contract(fv.String(), contract)
+		}
+		seen[name] = true
+		fields = append(fields, member{name: name, value: fv})
+	}
+
+	// Outer fields shadow the promoted fields of embedded structs
+	result := make(object, 0, len(fields))
+	for i, m := range fields {
+		ev, ok := embedded[i]
+		if !ok {
+			if fv, ok := m.value.(reflect.Value); ok {
+				m.value = e.value(fv, m.name, contract)
+			}
+			result = append(result, m)
+			continue
+		}
+		inner, _ := e.object(ev, contract).(object)
+		for _, im := range inner {
+			if !seen[im.name] {
+				seen[im.name] = true
+				result = append(result, im)
+			}
+		}
+	}
+	return result
+}
+
+// contract returns the cached contract of a pair, else the enclosing one
+func (e *decimalEncoder) contract(pair string, enclosing *market.ContractInfo) *market.ContractInfo {
+	if e.contracts == nil || pair == "" {
+		return enclosing
+	}
+	if contract, ok := e.contracts.Cached(pair); ok {
+		return contract
+	}
+	return enclosing
+}
+
+// float rounds a decimal for its field and renders it in the configured mode
+func (e *decimalEncoder) float(f float64, field string, contract *market.ContractInfo) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	switch {
+	case contract != nil && priceFields[field] && contract.TickSize > 0:
+		f = trader.RoundToStep(f, contract.TickSize)
+	case contract != nil && quantityFields[field] && contract.QuantityStep > 0:
+		f = trader.RoundToStep(f, contract.QuantityStep)
+	default:
+		pow := math.Pow(10, float64(e.places))
+		if rounded := math.Round(f*pow) / pow; !math.IsInf(f*pow, 0) {
+			f = rounded
+		}
+	}
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if e.mode == stringDecimals {
+		return s
+	}
+	return json.Number(s)
+}
+
+// isEmpty reports whether a value is omitted by omitempty
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Ptr:
+		return v.IsZero()
+	}
+	return false
+}
+
+// toString renders a non-string map key like encoding/json does
+func toString(key reflect.Value) string {
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(key.Uint(), 10)
+	}
+	if m, ok := key.Interface().(encoding.TextMarshaler); ok {
+		text, _ := m.MarshalText()
+		return string(text)
+	}
+	return key.String()
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nofx/config"
+	"github.com/nofx/logger"
+)
+
+// unlimitedPaths are never rate limited, so probes keep working under load
+var unlimitedPaths = map[string]bool{
+	"/api/health": true,
+	"/api/ready":  true,
+}
+
+// rateBucketIdle is how long an unused client bucket is kept
+const rateBucketIdle = 10 * time.Minute
+
+// maxRateBuckets bounds the buckets kept, so clients from many addresses
+// can't grow them without limit
+const maxRateBuckets = 10000
+
+// statusRecorder captures the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// WriteHeader records the status
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size, and an implicit 200 status
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush flushes the underlying writer, for streamed responses
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, so http.ResponseController reaches
+// it to set the deadlines of streamed responses
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack hands the connection over, for websocket upgrades
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response doesn't support hijacking")
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// logRequests logs the method, path, status and duration of every request;
+// server errors log as warnings
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		log := logger.With("method", r.Method, "path", r.URL.Path, "status", rec.status,
+			"duration_ms", duration.Milliseconds(), "bytes", rec.bytes, "remote", clientIP(r))
+		if rec.status >= 500 {
+			log.Warning("%s %s %d %s", r.Method, r.URL.Path, rec.status, duration.Round(time.Millisecond))
+			return
+		}
+		log.Info("%s %s %d %s", r.Method, r.URL.Path, rec.status, duration.Round(time.Millisecond))
+	})
+}
+
+// rateBucket is the token bucket of a client on a route; full is when it
+// will have refilled, after which dropping it changes nothing
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// rateLimiter limits the requests of each client per route with token
+// buckets. One runs before authentication, identifying clients by their IP
+// address: keying on a credential nobody checked yet would let a client get
+// a fresh bucket with every made-up key. Another runs after it, identifying
+// them by their principal, so a key spread over many addresses is limited
+// too.
+type rateLimiter struct {
+	fallback config.RateLimitConfig
+	routes   map[string]config.RateLimitConfig
+	client   func(r *http.Request) string
+
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	swept   time.Time
+}
+
+// newRateLimiter creates a limiter of rate requests per second in bursts of
+// burst, defaulting to rate, per client, as identified by client, and route;
+// routes override the limit of routes by path template
+func newRateLimiter(rate, burst float64, routes map[string]config.RateLimitConfig, client func(r *http.Request) string) *rateLimiter {
+	return &rateLimiter{
+		fallback: config.RateLimitConfig{Rate: rate, Burst: burst},
+		routes:   routes,
+		client:   client,
+		buckets:  make(map[string]*rateBucket),
+		swept:    time.Now(),
+	}
+}
+
+// limit returns the limit of a route, with the burst defaulting to one
+// second of rate
+func (l *rateLimiter) limit(route string) config.RateLimitConfig {
+	limit, ok := l.routes[route]
+	if !ok {
+		limit = l.fallback
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = math.Max(1, limit.Rate)
+	}
+	return limit
+}
+
+// allow takes a token from a client's bucket on a route and returns how
+// long to wait for one when none is left
+func (l *rateLimiter) allow(client, route string, now time.Time) (bool, time.Duration) {
+	limit := l.limit(route)
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	key := client + " " + route
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateBuckets {
+			l.evict(now)
+		}
+		b = &rateBucket{tokens: limit.Burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(limit.Burst, b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((limit.Burst - b.tokens) / limit.Rate * float64(time.Second)))
+	if !allowed {
+		return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	return true, 0
+}
+
+// evict makes room for a bucket once maxRateBuckets are kept: it drops the
+// refilled buckets, or the least recently used one when none has refilled;
+// the caller must hold mu
+func (l *rateLimiter) evict(now time.Time) {
+	var oldest string
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		} else if oldest == "" || b.updated.Before(l.buckets[oldest].updated) {
+			oldest = key
+		}
+	}
+	if len(l.buckets) >= maxRateBuckets {
+		delete(l.buckets, oldest)
+	}
+}
+
+// sweep drops the buckets idle for long enough to have refilled, at most
+// once per idle period; the caller must hold mu
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateBucketIdle {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= rateBucketIdle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// middleware rejects requests beyond the limit of their client and route
+// with 429 and a Retry-After header
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unlimitedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ok, wait := l.allow(l.client(r), route, time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded for "+route)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateClient identifies the client of a request for rate limiting
+func rateClient(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// principalClient identifies the authenticated client of a request for
+// rate limiting, falling back to its IP address on unauthenticated routes
+func principalClient(r *http.Request) string {
+	if principal := Principal(r); principal != "" {
+		return "principal:" + principal
+	}
+	return rateClient(r)
+}
+
+// clientIP returns the IP address of the peer of a request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,494 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nofx/backtest"
+	"github.com/nofx/bootstrap"
+	"github.com/nofx/execution"
+	"github.com/nofx/journal"
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/monitor"
+	"github.com/nofx/notify"
+	"github.com/nofx/pnl"
+	"github.com/nofx/report"
+	"github.com/nofx/risk"
+	"github.com/nofx/scheduler"
+	"github.com/nofx/storage"
+	"github.com/nofx/strategy"
+	"github.com/nofx/trader"
+)
+
+// swaggerUI is the page rendering the OpenAPI document with Swagger UI
+//
+//go:embed swagger.html
+var swaggerUI []byte
+
+// fields describes a JSON object assembled by a handler, by property name;
+// values are the reflect.Type of a property or nested fields
+type fields map[string]interface{}
+
+// operation documents a route: its query parameters and the schemas of its
+// request body and success response, each a reflect.Type or fields
+type operation struct {
+	summary  string
+	query    []string
+	request  interface{}
+	response interface{}
+	status   int
+}
+
+// typeOf returns the type of a value
+func typeOf(v interface{}) reflect.Type {
+	return reflect.TypeOf(v)
+}
+
+// returns returns the type of the first result of a function or method
+// expression, so documented responses follow the code serving them
+func returns(fn interface{}) reflect.Type {
+	return reflect.TypeOf(fn).Out(0)
+}
+
+// Query parameters shared by groups of routes
+var (
+	exchangeQuery = []string{"exchange"}
+	historyQuery  = []string{"exchange", "pair", "strategy", "tag", "from", "to", "limit"}
+	rangeQuery    = []string{"days", "from", "to"}
+)
+
+// snapshotFields are the properties of the account snapshot responses
+var snapshotFields = fields{
+	"snapshot_time": typeOf(time.Time{}),
+	"snapshot_age":  typeOf(0.0),
+	"stale":         typeOf(false),
+}
+
+// with returns a copy of fields with more properties
+func (f fields) with(more fields) fields {
+	merged := make(fields, len(f)+len(more))
+	for k, v := range f {
+		merged[k] = v
+	}
+	for k, v := range more {
+		merged[k] = v
+	}
+	return merged
+}
+
+// operations documents the API routes by method and path below /api
+var operations = map[string]operation{
+	"POST /auth/login": {summary: "Issue a bearer token", request: typeOf(loginRequest{}),
+		response: fields{"token": typeOf(""), "token_type": typeOf(""), "expires_at": typeOf(time.Time{})}},
+	"GET /health":            {summary: "Liveness check", response: fields{"status": typeOf("")}},
+	"GET /ready":             {summary: "Readiness check, 503 while caches warm", response: fields{"status": typeOf("")}},
+	"GET /openapi.json":      {summary: "This OpenAPI document", response: fields{}},
+	"GET /docs":              {summary: "Swagger UI"},
+	"GET /exchanges":         {summary: "Configured exchanges", response: fields{"exchanges": typeOf([]string{}), "default": typeOf(""), "watch_only": typeOf(false)}},
+	"PUT /exchanges/default": {summary: "Select the default exchange of requests, jobs and alerts; monitors keep theirs until restart", request: typeOf(defaultExchangeRequest{}), response: fields{"default": typeOf("")}},
+
+	"GET /trading/pairs":     {summary: "Configured trading pairs", response: fields{"pairs": typeOf([]string{})}},
+	"GET /trading/balance":   {summary: "Account balances", query: exchangeQuery, response: snapshotFields.with(fields{"balances": typeOf([]trader.Balance{})})},
+	"GET /trading/positions": {summary: "Open positions", query: []string{"exchange", "pair"}, response: snapshotFields.with(fields{"positions": typeOf([]trader.Position{})})},
+	"GET /trading/portfolio": {summary: "Account snapshot", query: exchangeQuery, response: typeOf(trader.Snapshot{})},
+	"GET /trading/orders":    {summary: "Orders", query: []string{"exchange", "pair", "status"}, response: fields{"orders": typeOf([]trader.Order{})}},
+	"GET /trading/history": {summary: "Recorded fills with fees, PnL and client order IDs, paginated",
+		query: []string{"exchange", "symbol", "pair", "side", "strategy", "from", "to", "limit", "cursor"},
+		response: fields{"trades": typeOf([]struct {
+			storage.TradeRecord
+			pnl.FillResult
+		}{}), "next_cursor": typeOf("")}},
+	"POST /trading/order": {summary: "Place an order", query: exchangeQuery, request: typeOf(createOrderRequest{}),
+		response: typeOf(trader.Order{}), status: http.StatusCreated},
+	"GET /trading/orders/client/{id}": {summary: "Look an order up by client order ID", query: []string{"exchange", "pair"},
+		response: fields{"order": typeOf(trader.Order{}), "client_order": typeOf(trader.ClientOrder{})}},
+	"DELETE /trading/order/{id}": {summary: "Cancel an order", query: exchangeQuery, response: fields{"id": typeOf(""), "status": typeOf("")}},
+	"POST /trading/close-batch": {summary: "Close positions matching a filter", query: exchangeQuery, request: typeOf(trader.CloseFilter{}),
+		response: fields{"results": returns(trader.CloseBatch)}},
+	"POST /trading/position/{pair}/reduce": {summary: "Reduce a position", query: exchangeQuery, request: typeOf(reduceRequest{}),
+		response: fields{"currency_pair": typeOf(""), "side": typeOf(trader.Side("")), "size": typeOf(0.0),
+			"amount": typeOf(0.0), "remaining": typeOf(0.0), "order": typeOf(trader.Order{})}},
+	"POST /trading/position/{pair}/scale-out": {summary: "Scale out of a position in tranches", query: exchangeQuery, request: typeOf(scaleOutRequest{}),
+		response: fields{"currency_pair": typeOf(""), "side": typeOf(trader.Side("")), "size": typeOf(0.0), "orders": returns(trader.ScaleOut)}},
+	"GET /trading/dust":          {summary: "Pending dust positions", response: fields{"action": typeOf(""), "pending": returns((*monitor.DustCleaner).Pending)}},
+	"POST /trading/dust/cleanup": {summary: "Clean up dust positions", response: fields{"dust": returns((*monitor.DustCleaner).Check)}},
+	"POST /trading/stop-loss":    {summary: "Place a stop-loss", query: exchangeQuery, request: typeOf(triggerOrderRequest{}), response: typeOf(trader.Order{})},
+	"POST /trading/take-profit":  {summary: "Place a take-profit", query: exchangeQuery, request: typeOf(triggerOrderRequest{}), response: typeOf(trader.Order{})},
+	"GET /trading/brackets":      {summary: "Bracket legs", response: fields{"legs": returns((*monitor.BracketMonitor).Legs)}},
+	"POST /trading/trailing-stop": {summary: "Place a trailing stop, native or emulated", query: exchangeQuery, request: typeOf(trailingStopRequest{}),
+		response: fields{"mode": typeOf(""), "order": typeOf(trader.Order{}), "trailing_stop": typeOf(monitor.TrailingStop{})}},
+	"GET /trading/trailing-stops": {summary: "Emulated trailing stops", response: fields{"trailing_stops": returns((*monitor.TrailingMonitor).Stops)}},
+	"GET /trading/intents":        {summary: "Trade intents", response: fields{"intents": returns((*monitor.IntentMonitor).Intents)}},
+	"POST /trading/intents": {summary: "Queue a trade intent", request: typeOf(intentRequest{}),
+		response: typeOf(monitor.Intent{}), status: http.StatusCreated},
+	"GET /trading/intents/{id}":    {summary: "A trade intent", response: typeOf(monitor.Intent{})},
+	"DELETE /trading/intents/{id}": {summary: "Cancel a trade intent", response: typeOf(monitor.Intent{})},
+	"POST /trading/preview":        {summary: "Preview an order's cost and liquidation price", request: typeOf(execution.PreviewRequest{}), response: returns(execution.BuildPreview)},
+	"POST /trading/size":           {summary: "Size a signal", query: exchangeQuery, request: typeOf(sizeRequest{}), response: typeOf(execution.Size{})},
+	"POST /trading/plan":           {summary: "Plan an order's execution from the book depth", request: typeOf(planRequest{}), response: typeOf(execution.Plan{})},
+	"GET /trading/replication": {summary: "Signal sources and recently skipped signals",
+		response: fields{"sources": returns((*execution.Replicator).Rules), "skipped": returns((*execution.Replicator).Skipped)}},
+	"POST /trading/replication/{source}": {summary: "Copy a trade of a signal source", request: typeOf(execution.LeaderSignal{}),
+		response: typeOf(execution.Replication{}), status: http.StatusCreated},
+	"GET /trading/groups": {summary: "Order groups", response: fields{"groups": returns((*journal.Journal).Groups)}},
+	"POST /trading/groups": {summary: "Place an order group", request: typeOf(orderGroupRequest{}),
+		response: typeOf(journal.OrderGroup{}), status: http.StatusCreated},
+	"GET /trading/groups/{id}": {summary: "An order group", response: typeOf(journal.OrderGroup{})},
+	"GET /trading/alerts":      {summary: "Recently handled TradingView alerts", response: fields{"alerts": returns((*execution.AlertRouter).Recent)}},
+	"POST /webhook/tradingview": {summary: "Trade a TradingView alert", request: typeOf(execution.TradingViewAlert{}),
+		response: typeOf(execution.AlertResult{}), status: http.StatusCreated},
+
+	"GET /account/headroom":      {summary: "Margin headroom", query: exchangeQuery, response: returns(execution.ComputeHeadroom)},
+	"GET /account/position-mode": {summary: "Position mode", query: exchangeQuery, response: fields{"exchange": typeOf(""), "mode": returns(trader.GetPositionMode)}},
+
+	"GET /market/price/{pair}":           {summary: "Last price", response: returns((*market.APIClient).GetPrice)},
+	"GET /market/funding/{pair}":         {summary: "Current funding rate", response: returns((*market.APIClient).GetFundingRate)},
+	"GET /market/funding/{pair}/history": {summary: "Funding rate history", query: []string{"limit", "from", "to"}, response: returns((*market.APIClient).GetFundingHistory)},
+	"GET /market/funding/{pair}/stats":   {summary: "Funding rate statistics", query: []string{"from", "to"}, response: returns((*market.FundingHistory).Stats)},
+	"GET /market/candles/{pair}": {summary: "Candles", query: []string{"interval", "limit", "from", "to"},
+		response: fields{"currency_pair": typeOf(""), "interval": typeOf(""), "candles": typeOf([]market.CandleData{})}},
+	"GET /market/patterns/{pair}": {summary: "Candlestick patterns", query: []string{"interval", "limit"}, response: returns((*market.PatternDetector).Patterns)},
+	"GET /market/levels/{pair}":   {summary: "Support and resistance levels", response: returns((*market.LevelService).Levels)},
+	"GET /market/regime/{pair}":   {summary: "Market regime", query: []string{"interval"}, response: returns((*market.RegimeService).Regime)},
+	"GET /market/correlations": {summary: "Correlation matrix and buckets", query: []string{"pairs", "interval", "window"},
+		response: fields{"matrix": returns((*market.CorrelationService).Matrix), "buckets": returns((*market.CorrelationMatrix).Buckets)}},
+	"GET /market/announcements": {summary: "Exchange announcements", response: fields{"announcements": returns((*market.AnnouncementMonitor).Recent)}},
+	"GET /market/watchlist":     {summary: "Watched pairs", response: fields{"pairs": returns((*market.Screener).Watchlist)}},
+	"GET /market/instruments": {summary: "Search contracts across exchanges", query: []string{"query", "limit"},
+		response: fields{"instruments": typeOf([]market.Instrument{}), "errors": typeOf(map[string]string{})}},
+	"GET /events/stream": {summary: "Server-sent market events"},
+
+	"GET /risk/var": {summary: "Value at risk of the open positions", query: exchangeQuery,
+		response: fields{"snapshot_time": typeOf(time.Time{})}.with(propertiesOf(typeOf(risk.VaRReport{})))},
+	"GET /risk/limits": {summary: "Risk limits and their usage", query: exchangeQuery,
+		response: fields{"exposure": typeOf(0.0), "equity": typeOf(0.0), "snapshot_time": typeOf(time.Time{}),
+			"kill_switch": returns((*risk.Limiter).KillSwitch), "profit_lock": returns((*risk.Limiter).ProfitLock),
+			"open_positions": returns((*risk.Limiter).OpenPositions), "settle_currency": typeOf(""), "daily_pnl": typeOf(0.0), "risk_profile": typeOf(""),
+			"max_position_notional": typeOf(0.0), "max_total_exposure": typeOf(0.0), "max_leverage": typeOf(0),
+			"max_daily_loss": typeOf(0.0), "daily_profit_target": typeOf(0.0), "daily_profit_action": typeOf("")}},
+	"GET /risk/state":      {summary: "Kill switch, profit lock-in, open positions and risk profile in force", response: returns((*risk.Limiter).State)},
+	"GET /risk/pnl-alerts": {summary: "PnL alert thresholds", response: returns((*monitor.MarketMonitor).Thresholds)},
+	"PUT /risk/pnl-alerts": {summary: "Replace the PnL alert thresholds", request: typeOf(monitor.PnLThresholds{}), response: returns((*monitor.MarketMonitor).Thresholds)},
+
+	"GET /history/orders":    {summary: "Recorded orders", query: historyQuery, response: fields{"orders": returns((*storage.Store).Orders)}},
+	"GET /history/fills":     {summary: "Recorded fills", query: historyQuery, response: fields{"fills": returns((*storage.Store).Fills)}},
+	"GET /history/positions": {summary: "Recorded position changes", query: historyQuery, response: fields{"positions": returns((*storage.Store).Positions)}},
+	"GET /history/balances":  {summary: "Recorded balances", query: historyQuery, response: fields{"balances": returns((*storage.Store).Balances)}},
+	"GET /history/transfers": {summary: "Recorded deposits and withdrawals", query: historyQuery, response: fields{"transfers": returns((*storage.Store).Transfers)}},
+
+	"GET /pnl": {summary: "PnL per day, week or month and unrealized PnL", query: append([]string{"period"}, historyQuery...),
+		response: returns((*pnl.Engine).Summarize)},
+	"GET /pnl/trades": {summary: "Closed trades of the PnL ledger", query: historyQuery, response: fields{"trades": returns((*pnl.Engine).Trades)}},
+	"GET /stats":      {summary: "Turnover and trade frequency", query: []string{"days", "from", "to", "tag"}, response: returns((*report.Activity).Compute)},
+	"GET /stats/tca":  {summary: "Trade cost analysis", query: rangeQuery, response: returns((*report.TCA).Compute)},
+	"GET /timeseries": {summary: "A recorded metric over time", query: []string{"metric", "range", "from", "to", "step", "exchange", "pair", "strategy"},
+		response: fields{"metric": typeOf(""), "from": typeOf(time.Time{}), "to": typeOf(time.Time{}), "points": typeOf([]storage.Point{})}},
+
+	"GET /fleet/config": {summary: "The signed fleet configuration", response: returns((*bootstrap.Context).FleetDocument)},
+
+	"GET /scheduler":             {summary: "Scheduled jobs and their last runs", response: fields{"jobs": returns((*scheduler.Scheduler).Jobs)}},
+	"GET /scheduler/{name}":      {summary: "A scheduled job and its last run", response: typeOf(scheduler.JobStatus{})},
+	"POST /scheduler/{name}/run": {summary: "Run a scheduled job now", response: typeOf(scheduler.JobStatus{}), status: http.StatusAccepted},
+
+	"GET /journal/annotations": {summary: "Annotations", query: []string{"target", "reference", "tag"}, response: fields{"annotations": returns((*journal.Journal).Annotations)}},
+	"POST /journal/annotations": {summary: "Annotate an order or position", request: typeOf(journal.Annotation{}),
+		response: typeOf(journal.Annotation{}), status: http.StatusCreated},
+	"DELETE /journal/annotations/{id}": {summary: "Delete an annotation"},
+
+	"GET /admin/logs":                    {summary: "Recent log entries", query: []string{"level", "module", "tail"}, response: fields{"entries": returns(logger.Recent)}},
+	"GET /admin/logs/stream":             {summary: "Server-sent log entries", query: []string{"level", "module"}},
+	"POST /admin/kill-switch":            {summary: "Engage or release the kill switch", request: typeOf(killSwitchRequest{}), response: returns((*risk.Limiter).KillSwitch)},
+	"GET /admin/notify":                  {summary: "Notification channels", response: fields{"channels": returns((*notify.Dispatcher).Channels)}},
+	"POST /admin/notify/test":            {summary: "Send a test notification", request: typeOf(notifyTestRequest{}), response: fields{"deliveries": returns((*notify.Dispatcher).Dispatch)}},
+	"GET /admin/risk/open-positions":     {summary: "Open position limits and usage", response: returns((*risk.Limiter).OpenPositions)},
+	"PUT /admin/risk/open-positions":     {summary: "Adjust the open position limits", request: typeOf(openPositionLimitsRequest{}), response: returns((*risk.Limiter).OpenPositions)},
+	"PUT /admin/risk/profile":            {summary: "Switch the risk profile", request: typeOf(riskProfileRequest{}), response: returns((*risk.Limiter).State)},
+	"GET /admin/reconciliation":          {summary: "Startup reconciliation result", response: returns((*bootstrap.Context).Reconciliation)},
+	"GET /admin/fleet":                   {summary: "Fleet synchronization status", response: returns((*bootstrap.Context).FleetStatus)},
+	"GET /admin/strategies":              {summary: "Live strategies", response: fields{"strategies": typeOf([]map[string]interface{}{})}},
+	"POST /admin/reoptimize":             {summary: "Run the parameter re-optimization", response: fields{"proposals": returns((*backtest.Reoptimizer).Run)}},
+	"GET /admin/proposals":               {summary: "Parameter proposals", response: fields{"proposals": returns((*backtest.Reoptimizer).Proposals)}},
+	"POST /admin/proposals/{id}/approve": {summary: "Approve a parameter proposal", response: fields{"proposals": returns((*backtest.Reoptimizer).Proposals)}},
+	"POST /admin/proposals/{id}/reject":  {summary: "Reject a parameter proposal", response: fields{"proposals": returns((*backtest.Reoptimizer).Proposals)}},
+	"GET /admin/promotions": {summary: "Promotion candidates",
+		response: fields{"candidates": returns((*backtest.Promoter).Candidates), "strategies": returns(strategy.Defined)}},
+	"POST /admin/promotions": {summary: "Submit a paper trading candidate", request: typeOf(candidateRequest{}),
+		response: typeOf(backtest.Candidate{}), status: http.StatusCreated},
+	"GET /admin/promotions/{id}":          {summary: "A promotion candidate", response: typeOf(backtest.Candidate{})},
+	"POST /admin/promotions/{id}/promote": {summary: "Promote a candidate to live", request: typeOf(promotionRequest{}), response: typeOf(backtest.Candidate{})},
+	"POST /admin/promotions/{id}/retire":  {summary: "Retire a candidate", request: typeOf(promotionRequest{}), response: typeOf(backtest.Candidate{})},
+	"GET /admin/shadow":                   {summary: "Shadow accounts ranked by return", response: fields{"accounts": returns((*backtest.ShadowBook).Accounts)}},
+	"GET /admin/shadow/{name}":            {summary: "A shadow account with its equity curve", response: typeOf(backtest.ShadowAccount{})},
+}
+
+// pathParam matches the variables of a route template
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// schemaBuilder converts Go types into OpenAPI schemas, collecting named
+// structs as components
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+// schemaName returns the component name of a named type, e.g. trader.Order
+func schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	return pkg + "." + t.Name()
+}
+
+// schema returns the schema of a reflect.Type or fields
+func (b *schemaBuilder) schema(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case fields:
+		properties := make(map[string]interface{}, len(v))
+		for name, field := range v {
+			properties[name] = b.schema(field)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case reflect.Type:
+		return b.typeSchema(v)
+	}
+	return map[string]interface{}{}
+}
+
+// typeSchema returns the schema of a type; named structs are referenced
+func (b *schemaBuilder) typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.schema(propertiesOf(t))
+		}
+		name := schemaName(t)
+		if _, ok := b.components[name]; !ok {
+			// Registered before its fields so recursive types terminate
+			b.components[name] = map[string]interface{}{}
+			b.components[name] = b.schema(propertiesOf(t))
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// propertiesOf returns the JSON properties of a struct type following the
+// encoding/json field rules: json tags name fields, "-" skips them and
+// untagged embedded structs contribute their own properties
+func propertiesOf(t reflect.Type) fields {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	properties := fields{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for k, v := range propertiesOf(ft) {
+				if _, ok := properties[k]; !ok {
+					properties[k] = v
+				}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(opts, "string") {
+			properties[name] = reflect.TypeOf("")
+			continue
+		}
+		properties[name] = f.Type
+	}
+	return properties
+}
+
+// openAPIDocument builds the OpenAPI 3 document of the routes below /api
+func (s *Server) openAPIDocument() (map[string]interface{}, error) {
+	b := &schemaBuilder{components: map[string]interface{}{}}
+	errorSchema := b.typeSchema(reflect.TypeOf(errorResponse{}))
+	paths := map[string]map[string]interface{}{}
+
+	err := s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(template, "/api/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := strings.TrimPrefix(template, "/api")
+		for _, method := range methods {
+			op := operations[method+" "+path]
+			doc := map[string]interface{}{
+				"operationId": strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_").Replace(path),
+				"tags":        []string{strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]},
+			}
+			if op.summary != "" {
+				doc["summary"] = op.summary
+			}
+
+			var params []interface{}
+			for _, m := range pathParam.FindAllStringSubmatch(template, -1) {
+				params = append(params, map[string]interface{}{
+					"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+				})
+			}
+			for _, name := range op.query {
+				params = append(params, map[string]interface{}{
+					"name": name, "in": "query", "schema": map[string]interface{}{"type": "string"},
+				})
+			}
+			if params != nil {
+				doc["parameters"] = params
+			}
+			if op.request != nil {
+				doc["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": b.schema(op.request)}},
+				}
+			}
+
+			status := op.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			success := map[string]interface{}{"description": http.StatusText(status)}
+			if op.response != nil {
+				success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": b.schema(op.response)}}
+			}
+			doc["responses"] = map[string]interface{}{
+				strconv.Itoa(status): success,
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorSchema}},
+				},
+			}
+
+			if paths[template] == nil {
+				paths[template] = map[string]interface{}{}
+			}
+			paths[template][strings.ToLower(method)] = doc
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]bool{}
+	for _, item := range paths {
+		for _, op := range item {
+			tags[op.(map[string]interface{})["tags"].([]string)[0]] = true
+		}
+	}
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	tagList := make([]interface{}, len(names))
+	for i, tag := range names {
+		tagList[i] = map[string]interface{}{"name": tag}
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "NOFX API",
+			"version": "1.0",
+		},
+		"tags":       tagList,
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": b.components},
+	}
+	if s.ctx.Config.Security.AuthEnabled {
+		doc["components"].(map[string]interface{})["securitySchemes"] = map[string]interface{}{
+			"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": apiKeyHeader},
+		}
+		doc["security"] = []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"apiKey": []string{}},
+		}
+	}
+	return doc, nil
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+	openAPIErr  error
+)
+
+// getOpenAPI serves the OpenAPI document, built once from the routes
+func (s *Server) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		doc, err := s.openAPIDocument()
+		if err != nil {
+			openAPIErr = err
+			return
+		}
+		openAPIDoc, openAPIErr = json.Marshal(doc)
+	})
+	if openAPIErr != nil {
+		writeError(w, http.StatusInternalServerError, openAPIErr.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDoc)
+}
+
+// getDocs serves Swagger UI over the OpenAPI document
+func (s *Server) getDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(swaggerUI)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nofx/market"
+	"github.com/nofx/trader"
+)
+
+// errorResponse represents the JSON body returned for failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(decimals.encode(v))
+}
+
+// writeError writes a JSON error response with the given status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+// exchangeStatus returns the status code of a failed exchange call: the
+// status of its trading error, or 502 for anything else the exchange reported
+func exchangeStatus(err error) int {
+	switch {
+	case errors.Is(err, trader.ErrRateLimited), errors.Is(err, market.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, trader.ErrNoPosition), errors.Is(err, trader.ErrOrderNotFound), errors.Is(err, market.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, trader.ErrMinNotional), errors.Is(err, trader.ErrOrderTypeNotSupported):
+		return http.StatusBadRequest
+	case errors.Is(err, trader.ErrInsufficientBalance):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, trader.ErrLeverageAlreadySet):
+		return http.StatusConflict
+	case errors.Is(err, trader.ErrWatchOnly):
+		return http.StatusForbidden
+	}
+	return http.StatusBadGateway
+}
@@ -1,11 +1,34 @@
 package api
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/nofx/backtest"
 	"github.com/nofx/bootstrap"
+	"github.com/nofx/crypto"
+	"github.com/nofx/execution"
+	"github.com/nofx/journal"
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/monitor"
+	"github.com/nofx/notify"
+	"github.com/nofx/pnl"
+	"github.com/nofx/risk"
+	"github.com/nofx/scheduler"
+	"github.com/nofx/storage"
+	"github.com/nofx/strategy"
+	"github.com/nofx/trader"
 )
 
 // Server represents the API server
@@ -16,7 +39,7 @@ type Server struct {
 }
 
 // NewServer creates a new API server
-func NewServer(ctx *bootstrap.Context, address string) *Server {
+func NewServer(ctx *bootstrap.Context, address string) (*Server, error) {
 	router := mux.NewRouter()
 
 	server := &Server{
@@ -25,37 +48,190 @@ func NewServer(ctx *bootstrap.Context, address string) *Server {
 		ctx:     ctx,
 	}
 
-	server.setupRoutes()
+	decimals = &decimalEncoder{
+		mode:      ctx.Config.Server.DecimalMode,
+		places:    ctx.Config.Server.DecimalPlaces,
+		contracts: ctx.Contracts,
+	}
+	if err := server.setupRoutes(); err != nil {
+		return nil, err
+	}
 
-	return server
+	return server, nil
 }
 
 // setupRoutes configures all API routes
-func (s *Server) setupRoutes() {
+func (s *Server) setupRoutes() error {
+	// Public status page, outside the API so it never requires credentials
+	if s.ctx.Config.Server.StatusPage {
+		s.router.HandleFunc("/status", s.getStatus).Methods("GET")
+	}
+	if s.ctx.Config.Server.Metrics {
+		s.router.Handle("/metrics", s.ctx.Metrics).Methods("GET")
+	}
+
 	// API routes
 	api := s.router.PathPrefix("/api").Subrouter()
+	limits := s.ctx.Config.Server
+	limited := limits.RateLimit > 0 || len(limits.RouteRateLimits) > 0
+	if limited {
+		api.Use(newRateLimiter(limits.RateLimit, limits.RateBurst, limits.RouteRateLimits, rateClient).middleware)
+	}
+	if security := s.ctx.Config.Security; security.AuthEnabled {
+		auth, err := newAuthenticator(security)
+		if err != nil {
+			return err
+		}
+		api.HandleFunc("/auth/login", auth.login).Methods("POST")
+		api.Use(auth.middleware)
+		// The same limits apply per principal, whatever address it comes from
+		if limited {
+			api.Use(newRateLimiter(limits.RateLimit, limits.RateBurst, limits.RouteRateLimits, principalClient).middleware)
+		}
+	} else if !s.ctx.WatchOnly() {
+		logger.Warning("*** API AUTHENTICATION IS DISABLED: anyone reaching %s can place and cancel orders; set security.auth_enabled ***", s.address)
+	}
+	if s.ctx.WatchOnly() {
+		api.Use(watchOnly)
+	}
 
 	// Health check
 	api.HandleFunc("/health", s.healthCheck).Methods("GET")
+	api.HandleFunc("/ready", s.readinessCheck).Methods("GET")
+
+	// API documentation
+	api.HandleFunc("/openapi.json", s.getOpenAPI).Methods("GET")
+	api.HandleFunc("/docs", s.getDocs).Methods("GET")
+
+	// Exchange routes
+	api.HandleFunc("/exchanges", s.getExchanges).Methods("GET")
+	api.HandleFunc("/exchanges/default", s.setDefaultExchange).Methods("PUT")
 
 	// Trading routes
 	api.HandleFunc("/trading/pairs", s.getTradingPairs).Methods("GET")
 	api.HandleFunc("/trading/balance", s.getBalance).Methods("GET")
 	api.HandleFunc("/trading/positions", s.getPositions).Methods("GET")
+	api.HandleFunc("/trading/portfolio", s.getPortfolio).Methods("GET")
 	api.HandleFunc("/trading/orders", s.getOrders).Methods("GET")
+	api.HandleFunc("/trading/history", s.getTradeHistory).Methods("GET")
 	api.HandleFunc("/trading/order", s.createOrder).Methods("POST")
+	api.HandleFunc("/trading/orders/client/{id}", s.getOrderByClientID).Methods("GET")
 	api.HandleFunc("/trading/order/{id}", s.cancelOrder).Methods("DELETE")
+	api.HandleFunc("/trading/close-batch", s.closeBatch).Methods("POST")
+	api.HandleFunc("/trading/position/{pair}/reduce", s.reducePosition).Methods("POST")
+	api.HandleFunc("/trading/position/{pair}/scale-out", s.scaleOutPosition).Methods("POST")
+	api.HandleFunc("/trading/dust", s.getDust).Methods("GET")
+	api.HandleFunc("/trading/dust/cleanup", s.cleanupDust).Methods("POST")
+	api.HandleFunc("/trading/stop-loss", s.setStopLoss).Methods("POST")
+	api.HandleFunc("/trading/take-profit", s.setTakeProfit).Methods("POST")
+	api.HandleFunc("/trading/brackets", s.getBrackets).Methods("GET")
+	api.HandleFunc("/trading/trailing-stop", s.setTrailingStop).Methods("POST")
+	api.HandleFunc("/trading/trailing-stops", s.getTrailingStops).Methods("GET")
+	api.HandleFunc("/trading/intents", s.getIntents).Methods("GET")
+	api.HandleFunc("/trading/intents", s.createIntent).Methods("POST")
+	api.HandleFunc("/trading/intents/{id}", s.getIntent).Methods("GET")
+	api.HandleFunc("/trading/intents/{id}", s.cancelIntent).Methods("DELETE")
+	api.HandleFunc("/trading/preview", s.previewTrade).Methods("POST")
+	api.HandleFunc("/trading/size", s.sizeTrade).Methods("POST")
+	api.HandleFunc("/trading/plan", s.planTrade).Methods("POST")
+	api.HandleFunc("/trading/replication", s.getReplication).Methods("GET")
+	api.HandleFunc("/trading/replication/{source}", s.replicateSignal).Methods("POST")
+	api.HandleFunc("/trading/groups", s.getOrderGroups).Methods("GET")
+	api.HandleFunc("/trading/groups", s.placeOrderGroup).Methods("POST")
+	api.HandleFunc("/trading/groups/{id}", s.getOrderGroup).Methods("GET")
+	api.HandleFunc("/trading/alerts", s.getTradingViewAlerts).Methods("GET")
+
+	// Webhook routes
+	api.HandleFunc("/webhook/tradingview", s.tradingViewWebhook).Methods("POST")
+
+	// Account routes
+	api.HandleFunc("/account/headroom", s.getHeadroom).Methods("GET")
+	api.HandleFunc("/account/position-mode", s.getPositionMode).Methods("GET")
 
 	// Market data routes
 	api.HandleFunc("/market/price/{pair}", s.getPrice).Methods("GET")
+	api.HandleFunc("/market/funding/{pair}", s.getFundingRate).Methods("GET")
+	api.HandleFunc("/market/funding/{pair}/history", s.getFundingHistory).Methods("GET")
+	api.HandleFunc("/market/funding/{pair}/stats", s.getFundingStats).Methods("GET")
 	api.HandleFunc("/market/candles/{pair}", s.getCandles).Methods("GET")
+	api.HandleFunc("/market/patterns/{pair}", s.getPatterns).Methods("GET")
+	api.HandleFunc("/market/levels/{pair}", s.getLevels).Methods("GET")
+	api.HandleFunc("/market/regime/{pair}", s.getRegime).Methods("GET")
+	api.HandleFunc("/market/correlations", s.getCorrelations).Methods("GET")
+	api.HandleFunc("/market/announcements", s.getAnnouncements).Methods("GET")
+	api.HandleFunc("/market/watchlist", s.getWatchlist).Methods("GET")
+	api.HandleFunc("/market/instruments", s.searchInstruments).Methods("GET")
+	api.HandleFunc("/events/stream", s.streamEvents).Methods("GET")
+
+	// Risk routes
+	api.HandleFunc("/risk/var", s.getVaR).Methods("GET")
+	api.HandleFunc("/risk/limits", s.getRiskLimits).Methods("GET")
+	api.HandleFunc("/risk/state", s.getRiskState).Methods("GET")
+	api.HandleFunc("/risk/pnl-alerts", s.getPnLAlerts).Methods("GET")
+	api.HandleFunc("/risk/pnl-alerts", s.setPnLAlerts).Methods("PUT")
+
+	// History routes
+	api.HandleFunc("/history/orders", s.getOrderHistory).Methods("GET")
+	api.HandleFunc("/history/fills", s.getFillHistory).Methods("GET")
+	api.HandleFunc("/history/positions", s.getPositionHistory).Methods("GET")
+	api.HandleFunc("/history/balances", s.getBalanceHistory).Methods("GET")
+	api.HandleFunc("/history/transfers", s.getTransferHistory).Methods("GET")
+
+	// Statistics routes
+	api.HandleFunc("/pnl", s.getPnL).Methods("GET")
+	api.HandleFunc("/pnl/trades", s.getPnLTrades).Methods("GET")
+	api.HandleFunc("/stats", s.getStats).Methods("GET")
+	api.HandleFunc("/stats/tca", s.getTCA).Methods("GET")
+	api.HandleFunc("/timeseries", s.getTimeseries).Methods("GET")
+
+	// Fleet routes
+	api.HandleFunc("/fleet/config", s.getFleetConfig).Methods("GET")
+
+	// Scheduler routes
+	api.HandleFunc("/scheduler", s.getScheduledJobs).Methods("GET")
+	api.HandleFunc("/scheduler/{name}", s.getScheduledJob).Methods("GET")
+	api.HandleFunc("/scheduler/{name}/run", s.runScheduledJob).Methods("POST")
+
+	// Journal routes
+	api.HandleFunc("/journal/annotations", s.getAnnotations).Methods("GET")
+	api.HandleFunc("/journal/annotations", s.createAnnotation).Methods("POST")
+	api.HandleFunc("/journal/annotations/{id}", s.deleteAnnotation).Methods("DELETE")
+
+	// Admin routes
+	api.HandleFunc("/admin/logs", s.getLogs).Methods("GET")
+	api.HandleFunc("/admin/logs/stream", s.streamLogs).Methods("GET")
+	api.HandleFunc("/admin/kill-switch", s.setKillSwitch).Methods("POST")
+	api.HandleFunc("/admin/notify", s.getNotifyChannels).Methods("GET")
+	api.HandleFunc("/admin/notify/test", s.testNotify).Methods("POST")
+	api.HandleFunc("/admin/risk/open-positions", s.getOpenPositionLimits).Methods("GET")
+	api.HandleFunc("/admin/risk/open-positions", s.setOpenPositionLimits).Methods("PUT")
+	api.HandleFunc("/admin/risk/profile", s.setRiskProfile).Methods("PUT")
+	api.HandleFunc("/admin/reconciliation", s.getReconciliation).Methods("GET")
+	api.HandleFunc("/admin/fleet", s.getFleetStatus).Methods("GET")
+	api.HandleFunc("/admin/strategies", s.getStrategies).Methods("GET")
+	api.HandleFunc("/admin/reoptimize", s.runReoptimize).Methods("POST")
+	api.HandleFunc("/admin/proposals", s.getProposals).Methods("GET")
+	api.HandleFunc("/admin/proposals/{id}/approve", s.approveProposal).Methods("POST")
+	api.HandleFunc("/admin/proposals/{id}/reject", s.rejectProposal).Methods("POST")
+	api.HandleFunc("/admin/promotions", s.getCandidates).Methods("GET")
+	api.HandleFunc("/admin/promotions", s.submitCandidate).Methods("POST")
+	api.HandleFunc("/admin/promotions/{id}", s.getCandidate).Methods("GET")
+	api.HandleFunc("/admin/promotions/{id}/promote", s.promoteCandidate).Methods("POST")
+	api.HandleFunc("/admin/promotions/{id}/retire", s.retireCandidate).Methods("POST")
+	api.HandleFunc("/admin/shadow", s.getShadowAccounts).Methods("GET")
+	api.HandleFunc("/admin/shadow/{name}", s.getShadowAccount).Methods("GET")
+	return nil
 }
 
 // Start starts the API server
 func (s *Server) Start() error {
+	var handler http.Handler = s.router
+	if s.ctx.Config.Server.AccessLog {
+		handler = logRequests(handler)
+	}
 	server := &http.Server{
 		Addr:         s.address,
-		Handler:      s.router,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 	}
@@ -69,34 +245,2210 @@ func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"status":"ok"}`))
 }
 
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctx.Status())
+}
+
+func (s *Server) readinessCheck(w http.ResponseWriter, r *http.Request) {
+	if !s.ctx.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"warming"}`))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ready"}`))
+}
+
+// trader returns the trader selected by the "exchange" query parameter, or the
+// default one, writing an error response when none is available
+func (s *Server) trader(w http.ResponseWriter, r *http.Request) (trader.Trader, bool) {
+	if name := r.URL.Query().Get("exchange"); name != "" {
+		t, err := s.ctx.TraderManager.Get(name)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		return t, true
+	}
+
+	t := s.ctx.DefaultTrader()
+	if t == nil {
+		writeError(w, http.StatusServiceUnavailable, "no trader configured")
+		return nil, false
+	}
+	return t, true
+}
+
+// exchangeName returns the exchange selected by the request, defaulting to the default exchange
+func (s *Server) exchangeName(r *http.Request) string {
+	if name := r.URL.Query().Get("exchange"); name != "" {
+		return name
+	}
+	return s.ctx.TraderManager.DefaultName()
+}
+
+// snapshot returns a consistent account snapshot of the exchange selected by
+// the request, writing an error response when it can't be taken
+func (s *Server) snapshot(w http.ResponseWriter, r *http.Request) (*trader.Snapshot, bool) {
+	name := s.exchangeName(r)
+	cache, ok := s.ctx.Caches[name]
+	if !ok {
+		if name == "" {
+			writeError(w, http.StatusServiceUnavailable, "no trader configured")
+		} else {
+			writeError(w, http.StatusNotFound, "exchange \""+name+"\" is not configured")
+		}
+		return nil, false
+	}
+
+	snapshot, err := cache.Snapshot(r.Context())
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return nil, false
+	}
+	return snapshot, true
+}
+
+// readOnlyTradingPaths are the trading requests that compute without trading
+var readOnlyTradingPaths = map[string]bool{
+	"/api/trading/preview": true,
+	"/api/trading/size":    true,
+}
+
+// watchOnly rejects the trading requests that would place, cancel or change
+// orders; the traders refuse them too, this fails them before any side effect
+func watchOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/trading/") && !readOnlyTradingPaths[r.URL.Path] {
+			writeError(w, http.StatusForbidden, trader.ErrWatchOnly.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// invalidate drops the cached account state of the exchange selected by the request
+func (s *Server) invalidate(r *http.Request) {
+	if cache, ok := s.ctx.Caches[s.exchangeName(r)]; ok {
+		cache.Invalidate()
+	}
+}
+
+func (s *Server) getExchanges(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"exchanges":  s.ctx.TraderManager.Names(),
+		"default":    s.ctx.TraderManager.DefaultName(),
+		"watch_only": s.ctx.WatchOnly(),
+	})
+}
+
+// defaultExchangeRequest is the body of PUT /exchanges/default
+type defaultExchangeRequest struct {
+	Name string `json:"name"`
+}
+
+// setDefaultExchange selects the exchange of requests, scheduler jobs and
+// alerts naming none; the drift and bracket monitors and the daily report
+// keep the exchange they started with
+func (s *Server) setDefaultExchange(w http.ResponseWriter, r *http.Request) {
+	var req defaultExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.ctx.TraderManager.SetDefault(req.Name); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"default": req.Name})
+}
+
 func (s *Server) getTradingPairs(w http.ResponseWriter, r *http.Request) {
-	// Implementation will be added
+	pairs := s.ctx.Config.Trading.Pairs
+	if pairs == nil {
+		pairs = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pairs": pairs})
 }
 
 func (s *Server) getBalance(w http.ResponseWriter, r *http.Request) {
-	// Implementation will be added
+	snapshot, ok := s.snapshot(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"balances":      snapshot.Balances,
+		"snapshot_time": snapshot.Time,
+		"snapshot_age":  snapshot.Age,
+		"stale":         snapshot.Stale,
+	})
 }
 
 func (s *Server) getPositions(w http.ResponseWriter, r *http.Request) {
-	// Implementation will be added
+	snapshot, ok := s.snapshot(w, r)
+	if !ok {
+		return
+	}
+
+	positions := snapshot.Positions
+	if pair := r.URL.Query().Get("pair"); pair != "" {
+		positions = []trader.Position{}
+		for _, p := range snapshot.Positions {
+			if p.Pair == pair {
+				positions = append(positions, p)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"positions":     positions,
+		"snapshot_time": snapshot.Time,
+		"snapshot_age":  snapshot.Age,
+		"stale":         snapshot.Stale,
+	})
+}
+
+func (s *Server) getPortfolio(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := s.snapshot(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
 }
 
 func (s *Server) getOrders(w http.ResponseWriter, r *http.Request) {
-	// Implementation will be added
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	orders, err := t.GetOrders(r.Context(), query.Get("pair"), trader.Status(query.Get("status")))
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"orders": orders})
+}
+
+func (s *Server) getOrderByClientID(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	tracked, known := s.ctx.Orders.Lookup(id)
+	pair := r.URL.Query().Get("pair")
+	if pair == "" {
+		pair = tracked.Pair
+	}
+	if pair == "" {
+		writeError(w, http.StatusBadRequest, "pair is required for orders this instance didn't place")
+		return
+	}
+
+	order, err := trader.GetOrderByClientID(r.Context(), t, pair, id)
+	switch {
+	case errors.Is(err, trader.ErrOrderNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+
+	response := map[string]interface{}{"order": order}
+	if known {
+		response["client_order"] = tracked
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// createOrderRequest represents the body of an order placement request
+type createOrderRequest struct {
+	trader.OrderRequest
+	// Strategy selects the client order ID prefix the order is tagged with
+	Strategy string `json:"strategy"`
+}
+
+// validate checks the request fields and applies defaults
+func (req *createOrderRequest) validate(defaultLeverage int64) error {
+	if req.Pair == "" {
+		return errors.New("currency_pair is required")
+	}
+	if req.Side != trader.BuySide && req.Side != trader.SellSide {
+		return errors.New("side must be buy or sell")
+	}
+	if req.Type == "" {
+		req.Type = trader.LimitOrder
+	}
+	switch req.Type {
+	case trader.MarketOrder:
+	case trader.LimitOrder:
+		if req.Price <= 0 {
+			return errors.New("price must be positive for limit orders")
+		}
+	case trader.StopOrder, trader.StopLimitOrder:
+		// No venue places conditional orders without a trigger price
+		return errors.New(string(req.Type) + " orders aren't supported; use /api/trading/stop-loss or /api/trading/take-profit")
+	default:
+		return errors.New("unsupported order type " + string(req.Type))
+	}
+	if req.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if req.Leverage == 0 {
+		req.Leverage = defaultLeverage
+	}
+	return req.OrderRequest.Validate()
 }
 
 func (s *Server) createOrder(w http.ResponseWriter, r *http.Request) {
-	// Implementation will be added
+	var req createOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if err := req.validate(s.ctx.Config.Trading.DefaultLeverage); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+
+	// Entries of a strategy that would pay the upcoming funding are refused
+	// until after it, as its funding policy requires
+	if req.Strategy != "" && !req.ReduceOnly {
+		delay, err := s.ctx.Funding.EntryDelay(req.Strategy, req.Pair, req.Side, time.Now())
+		if err != nil {
+			writeError(w, exchangeStatus(err), err.Error())
+			return
+		}
+		if delay > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((delay+time.Second-1)/time.Second)))
+			writeError(w, http.StatusConflict, "strategy "+req.Strategy+" holds entries on "+req.Pair+
+				" until after funding, in "+delay.Round(time.Second).String())
+			return
+		}
+	}
+
+	ctx := trader.WithClientOrder(r.Context(), s.ctx.OrderTag, s.ctx.Orders, trader.ClientOrder{
+		Exchange: s.exchangeName(r),
+		Strategy: req.Strategy,
+		Intent:   "api",
+	})
+	order, err := t.CreateOrder(ctx, req.OrderRequest)
+	if err != nil {
+		status := exchangeStatus(err)
+		if risk.IsRejection(err) {
+			status = http.StatusUnprocessableEntity
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	s.invalidate(r)
+	if order == nil {
+		writeError(w, http.StatusBadGateway, "exchange returned no order")
+		return
+	}
+	writeJSON(w, http.StatusCreated, order)
 }
 
 func (s *Server) cancelOrder(w http.ResponseWriter, r *http.Request) {
-	// Implementation will be added
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if err := t.CancelOrder(r.Context(), id); err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	s.invalidate(r)
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "status": string(trader.OrderStatusCanceled)})
 }
 
-func (s *Server) getPrice(w http.ResponseWriter, r *http.Request) {
-	// Implementation will be added
+func (s *Server) closeBatch(w http.ResponseWriter, r *http.Request) {
+	var filter trader.CloseFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+
+	positions, err := t.GetPositions(r.Context())
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+
+	results := trader.CloseBatch(r.Context(), t, positions, filter, s.ctx.CloseGuard)
+	s.invalidate(r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
 }
 
-func (s *Server) getCandles(w http.ResponseWriter, r *http.Request) {
-	// Implementation will be added
-}
\ No newline at end of file
+// reduceRequest is the body of a position reduction
+type reduceRequest struct {
+	Side     trader.Side `json:"side"`
+	Quantity float64     `json:"quantity"`
+	Percent  float64     `json:"percent"`
+	// FullClose closes the whole position when the reduction would leave dust
+	FullClose bool `json:"full_close"`
+}
+
+func (s *Server) reducePosition(w http.ResponseWriter, r *http.Request) {
+	var req reduceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+	pair := mux.Vars(r)["pair"]
+	// Hold the pair so the position can't change between the read and the orders
+	ctx, unlock, err := trader.LockSymbol(r.Context(), t, pair)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer unlock()
+	positions, err := t.GetPositions(ctx)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	var position *trader.Position
+	for i, p := range positions {
+		if p.Pair == pair && p.Size != 0 && (req.Side == "" || p.Side == req.Side) {
+			position = &positions[i]
+			break
+		}
+	}
+	if position == nil {
+		writeError(w, http.StatusNotFound, "no open position for "+pair)
+		return
+	}
+
+	contract, err := s.ctx.Contracts.Get(pair)
+	if err != nil {
+		logger.Warning("No contract metadata for %s, reducing without rounding: %v", pair, err)
+		contract = nil
+	}
+	amount, err := trader.ReductionAmount(*position, contract, req.Quantity, req.Percent)
+	switch {
+	case errors.Is(err, trader.ErrDustRemainder) && req.FullClose:
+		amount = position.Size
+	case errors.Is(err, trader.ErrDustRemainder):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":      err.Error(),
+			"full_close": map[string]interface{}{"amount": position.Size, "hint": "retry with full_close set to close the whole position"},
+		})
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	order, err := s.ctx.CloseGuard.Close(ctx, t, *position, amount)
+	s.invalidate(r)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"currency_pair": pair,
+		"side":          position.Side,
+		"size":          position.Size,
+		"amount":        amount,
+		"remaining":     position.Size - amount,
+		"order":         order,
+	})
+}
+
+// scaleOutRequest is the body of a position scale-out
+type scaleOutRequest struct {
+	Side trader.Side `json:"side"`
+	// Fractions of the position size, each taken at the matching price
+	Fractions []float64 `json:"fractions"`
+	Prices    []float64 `json:"prices"`
+}
+
+func (s *Server) scaleOutPosition(w http.ResponseWriter, r *http.Request) {
+	var req scaleOutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+	pair := mux.Vars(r)["pair"]
+	// Hold the pair so the position can't change between the read and the orders
+	ctx, unlock, err := trader.LockSymbol(r.Context(), t, pair)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer unlock()
+	positions, err := t.GetPositions(ctx)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	var position *trader.Position
+	for i, p := range positions {
+		if p.Pair == pair && p.Size != 0 && (req.Side == "" || p.Side == req.Side) {
+			position = &positions[i]
+			break
+		}
+	}
+	if position == nil {
+		writeError(w, http.StatusNotFound, "no open position for "+pair)
+		return
+	}
+
+	contract, err := s.ctx.Contracts.Get(pair)
+	if err != nil {
+		logger.Warning("No contract metadata for %s, scaling out without rounding: %v", pair, err)
+		contract = nil
+	}
+	if _, err := trader.ScaleOutTranches(*position, contract, req.Fractions, req.Prices); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orders, err := trader.ScaleOut(ctx, t, *position, contract, req.Fractions, req.Prices)
+	s.invalidate(r)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"currency_pair": pair,
+		"side":          position.Side,
+		"size":          position.Size,
+		"orders":        orders,
+	})
+}
+
+func (s *Server) getDust(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"action":  s.ctx.Config.Monitor.DustAction,
+		"pending": s.ctx.Dust.Pending(),
+	})
+}
+
+func (s *Server) cleanupDust(w http.ResponseWriter, r *http.Request) {
+	dust := s.ctx.Dust.Check(r.Context())
+	for _, cache := range s.ctx.Caches {
+		cache.Invalidate()
+	}
+	if dust == nil {
+		dust = []monitor.DustPosition{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"dust": dust})
+}
+
+// triggerOrderRequest represents the body of stop-loss and take-profit requests
+type triggerOrderRequest struct {
+	Pair         string                  `json:"currency_pair"`
+	Side         trader.Side             `json:"side"`
+	Amount       float64                 `json:"amount"`
+	TriggerPrice float64                 `json:"trigger_price"`
+	PriceType    trader.TriggerPriceType `json:"price_type"`
+}
+
+// validate checks the request fields and applies the default trigger price
+// type
+func (req *triggerOrderRequest) validate(defaultPriceType trader.TriggerPriceType) error {
+	if req.Pair == "" {
+		return errors.New("currency_pair is required")
+	}
+	if req.Side != trader.BuySide && req.Side != trader.SellSide {
+		return errors.New("side must be buy or sell")
+	}
+	if req.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if req.TriggerPrice <= 0 {
+		return errors.New("trigger_price must be positive")
+	}
+	if req.PriceType == "" {
+		req.PriceType = defaultPriceType
+	}
+	if !req.PriceType.Valid() {
+		return errors.New("invalid price_type, expected last, mark or index")
+	}
+	return nil
+}
+
+func (s *Server) setStopLoss(w http.ResponseWriter, r *http.Request) {
+	s.placeTriggerOrder(w, r, monitor.StopLossLeg, trader.Trader.SetStopLoss)
+}
+
+func (s *Server) setTakeProfit(w http.ResponseWriter, r *http.Request) {
+	s.placeTriggerOrder(w, r, monitor.TakeProfitLeg, trader.Trader.SetTakeProfit)
+}
+
+// placeTriggerOrder decodes a trigger order request and places it with the
+// configured default trigger price type when none is given, then tracks it
+// in the bracket integrity monitor
+func (s *Server) placeTriggerOrder(w http.ResponseWriter, r *http.Request, kind monitor.LegKind,
+	place func(trader.Trader, context.Context, string, trader.Side, float64, float64, trader.TriggerPriceType) (*trader.Order, error)) {
+	var req triggerOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	if err := req.validate(trader.TriggerPriceType(s.ctx.Config.Trading.TriggerPriceType)); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := place(t, r.Context(), req.Pair, req.Side, req.Amount, req.TriggerPrice, req.PriceType)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	if order == nil {
+		writeError(w, http.StatusBadGateway, "exchange returned no order")
+		return
+	}
+
+	if s.ctx.Brackets != nil {
+		s.ctx.Brackets.Track(monitor.BracketLeg{
+			Kind:          kind,
+			Pair:          req.Pair,
+			Side:          req.Side,
+			Amount:        req.Amount,
+			TriggerPrice:  req.TriggerPrice,
+			PriceType:     req.PriceType,
+			OrderID:       order.ID,
+			ClientOrderID: order.ClientOrderID,
+		})
+	}
+	writeJSON(w, http.StatusOK, order)
+}
+
+func (s *Server) getBrackets(w http.ResponseWriter, r *http.Request) {
+	legs := []monitor.BracketLeg{}
+	if s.ctx.Brackets != nil {
+		legs = s.ctx.Brackets.Legs()
+	}
+	sort.Slice(legs, func(i, j int) bool {
+		if legs[i].Pair != legs[j].Pair {
+			return legs[i].Pair < legs[j].Pair
+		}
+		return legs[i].Kind < legs[j].Kind
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"legs": legs})
+}
+
+// trailingStopRequest is the body of a trailing stop
+type trailingStopRequest struct {
+	Pair         string      `json:"currency_pair"`
+	Side         trader.Side `json:"side"`
+	CallbackRate float64     `json:"callback_rate"`
+}
+
+func (s *Server) setTrailingStop(w http.ResponseWriter, r *http.Request) {
+	var req trailingStopRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.Pair == "" || (req.Side != trader.BuySide && req.Side != trader.SellSide) {
+		writeError(w, http.StatusBadRequest, "currency_pair and a buy or sell side are required")
+		return
+	}
+	if req.CallbackRate <= 0 || req.CallbackRate >= 1 {
+		writeError(w, http.StatusBadRequest, "callback_rate must be between 0 and 1")
+		return
+	}
+
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+	defer s.invalidate(r)
+
+	// Prefer the exchange's own trailing stop, emulating it otherwise
+	order, err := trader.SetTrailingStop(r.Context(), t, req.Pair, req.Side, req.CallbackRate)
+	if err == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"mode": "native", "order": order})
+		return
+	}
+	if !errors.Is(err, trader.ErrTrailingNotSupported) {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+
+	stop, err := s.ctx.Trailing.Add(r.Context(), s.exchangeName(r), req.Pair, req.Side, req.CallbackRate)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"mode": "emulated", "trailing_stop": stop})
+}
+
+func (s *Server) getTrailingStops(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"trailing_stops": s.ctx.Trailing.Stops()})
+}
+
+func (s *Server) getIntents(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"intents": s.ctx.Intents.Intents()})
+}
+
+// intentRequest is the body of a new trade intent
+type intentRequest struct {
+	monitor.Intent
+	// TTL is the lifetime in seconds, defaulting to monitor.intent_default_ttl
+	TTL int `json:"ttl"`
+}
+
+func (s *Server) createIntent(w http.ResponseWriter, r *http.Request) {
+	var req intentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.Exchange == "" {
+		req.Exchange = s.exchangeName(r)
+	}
+	if req.Leverage <= 0 {
+		req.Leverage = s.ctx.Config.Trading.DefaultLeverage
+	}
+	ttl := time.Duration(req.TTL) * time.Second
+	if req.TTL == 0 {
+		ttl = time.Duration(s.ctx.Config.Monitor.IntentDefaultTTL) * time.Minute
+	}
+
+	intent, err := s.ctx.Intents.Add(req.Intent, ttl)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, intent)
+}
+
+func (s *Server) getIntent(w http.ResponseWriter, r *http.Request) {
+	intent, err := s.ctx.Intents.Intent(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, intent)
+}
+
+func (s *Server) cancelIntent(w http.ResponseWriter, r *http.Request) {
+	intent, err := s.ctx.Intents.Cancel(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, monitor.ErrIntentNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, intent)
+	}
+}
+
+func (s *Server) previewTrade(w http.ResponseWriter, r *http.Request) {
+	var req execution.PreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	contract, err := s.ctx.Instruments.Contract(s.exchangeName(r), req.Pair)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+
+	// Without a price or a mark price the trade is costed at the last price
+	if req.Price <= 0 && contract.MarkPrice <= 0 {
+		price, err := s.ctx.MarketClient.GetPrice(r.Context(), req.Pair)
+		if err != nil {
+			writeError(w, exchangeStatus(err), err.Error())
+			return
+		}
+		req.Price = price.Price
+	}
+
+	preview := execution.BuildPreview(contract, req, time.Now())
+	if delay, err := s.ctx.Funding.EntryDelay(req.Strategy, req.Pair, req.Side, time.Now()); err == nil {
+		preview.EntryDelay = delay.Seconds()
+	}
+	writeJSON(w, http.StatusOK, preview)
+}
+
+// planRequest is the body of an execution plan request
+type planRequest struct {
+	Pair         string      `json:"currency_pair"`
+	Side         trader.Side `json:"side"`
+	Amount       float64     `json:"amount"`
+	MaxImpactBps float64     `json:"max_impact_bps"`
+}
+
+func (s *Server) planTrade(w http.ResponseWriter, r *http.Request) {
+	var req planRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	switch {
+	case req.Pair == "":
+		writeError(w, http.StatusBadRequest, "currency_pair is required")
+		return
+	case req.Side != trader.BuySide && req.Side != trader.SellSide:
+		writeError(w, http.StatusBadRequest, "side must be buy or sell")
+		return
+	case req.Amount <= 0:
+		writeError(w, http.StatusBadRequest, "amount must be positive")
+		return
+	case req.MaxImpactBps <= 0:
+		writeError(w, http.StatusBadRequest, "max_impact_bps must be positive")
+		return
+	}
+
+	plan, err := execution.PlanOrder(r.Context(), s.ctx.Depth, req.Pair, req.Side == trader.BuySide, req.Amount, req.MaxImpactBps)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// sizeRequest is the body of a sizing request; Method overrides the configured sizing method
+type sizeRequest struct {
+	execution.SizeRequest
+	Method execution.SizingMethod `json:"method"`
+}
+
+func (s *Server) sizeTrade(w http.ResponseWriter, r *http.Request) {
+	var req sizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	// Without a balance the signal is sized against the account equity
+	if req.Balance <= 0 {
+		snapshot, ok := s.snapshot(w, r)
+		if !ok {
+			return
+		}
+		req.Balance = execution.ComputeHeadroom(snapshot, s.ctx.Instruments.Venue(s.exchangeName(r)), execution.HeadroomPolicy{
+			Currency: s.ctx.Config.Risk.SettleCurrency,
+		}).Equity
+	}
+	if req.Price <= 0 {
+		price, err := s.ctx.MarketClient.GetPrice(r.Context(), req.Pair)
+		if err != nil {
+			writeError(w, exchangeStatus(err), err.Error())
+			return
+		}
+		req.Price = price.Price
+	}
+
+	policy := s.ctx.Sizer.Policy()
+	if req.Method != "" {
+		policy.Method = req.Method
+	}
+	var candles []market.CandleData
+	if policy.Method == execution.VolatilitySizing {
+		var err error
+		candles, err = s.ctx.Candles.Get(req.Pair, s.ctx.Config.Trading.Sizing.ATRInterval, policy.ATRPeriod+1)
+		if err != nil {
+			writeError(w, exchangeStatus(err), err.Error())
+			return
+		}
+	}
+
+	size, err := s.ctx.Sizer.SizeWith(policy, req.SizeRequest, candles)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, size)
+}
+
+// getReplication returns the replication rule of every signal source and
+// the signals skipped most recently
+func (s *Server) getReplication(w http.ResponseWriter, r *http.Request) {
+	if s.ctx.Replicator == nil {
+		writeError(w, http.StatusServiceUnavailable, "no signal sources are configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sources": s.ctx.Replicator.Rules(),
+		"skipped": s.ctx.Replicator.Skipped(),
+	})
+}
+
+// replicateSignal copies a trade of a signal source; a signal skipped by the
+// throttle is reported with its reason
+func (s *Server) replicateSignal(w http.ResponseWriter, r *http.Request) {
+	if s.ctx.Replicator == nil {
+		writeError(w, http.StatusServiceUnavailable, "no signal sources are configured")
+		return
+	}
+	var signal execution.LeaderSignal
+	if err := json.NewDecoder(r.Body).Decode(&signal); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	replication, err := s.ctx.Replicator.Replicate(r.Context(), mux.Vars(r)["source"], signal)
+	switch {
+	case errors.Is(err, execution.ErrUnknownSource):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, execution.ErrInvalidSignal):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		writeError(w, exchangeStatus(err), err.Error())
+	case replication.Skipped:
+		writeJSON(w, http.StatusOK, replication)
+	default:
+		for _, cache := range s.ctx.Caches {
+			cache.Invalidate()
+		}
+		writeJSON(w, http.StatusCreated, replication)
+	}
+}
+
+// maxAlertBody caps the size of TradingView alert bodies
+const maxAlertBody = 64 << 10
+
+// tradingViewWebhook trades a TradingView alert. The alert is authenticated
+// by the hex HMAC-SHA256 of its body in the X-Signature header or, as
+// TradingView can't sign requests, by the secret field of its body.
+func (s *Server) tradingViewWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.ctx.Alerts == nil {
+		writeError(w, http.StatusServiceUnavailable, "the TradingView webhook is not configured")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAlertBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	var alert execution.TradingViewAlert
+	if err := json.Unmarshal(body, &alert); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	secret := []byte(s.ctx.Config.Trading.TradingView.Secret)
+	if signature := r.Header.Get("X-Signature"); signature != "" {
+		if !crypto.Verify(secret, body, signature) {
+			writeError(w, http.StatusUnauthorized, "invalid signature")
+			return
+		}
+	} else if subtle.ConstantTimeCompare([]byte(alert.Secret), secret) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid secret")
+		return
+	}
+
+	result, err := s.ctx.Alerts.Handle(r.Context(), alert)
+	switch {
+	case errors.Is(err, execution.ErrInvalidAlert):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, execution.ErrReplayedAlert):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, exchangeStatus(err), err.Error())
+	case result.Skipped:
+		writeJSON(w, http.StatusOK, result)
+	default:
+		for _, cache := range s.ctx.Caches {
+			cache.Invalidate()
+		}
+		s.trackAlertBrackets(result)
+		writeJSON(w, http.StatusCreated, result)
+	}
+}
+
+// trackAlertBrackets tracks the protective orders of an alert on the default
+// exchange in the bracket integrity monitor
+func (s *Server) trackAlertBrackets(result *execution.AlertResult) {
+	if s.ctx.Brackets == nil || result.Group == nil || result.Exchange != s.ctx.TraderManager.DefaultName() {
+		return
+	}
+	prices := map[string]float64{
+		string(execution.StopLossLeg):   float64(result.Alert.StopLoss),
+		string(execution.TakeProfitLeg): float64(result.Alert.TakeProfit),
+	}
+	for _, leg := range result.Group.Legs {
+		if leg.Kind == string(execution.OrderLeg) || leg.OrderID == "" {
+			continue
+		}
+		s.ctx.Brackets.Track(monitor.BracketLeg{
+			Kind:         monitor.LegKind(leg.Kind),
+			Pair:         leg.Pair,
+			Side:         trader.Side(leg.Side),
+			Amount:       leg.Amount,
+			TriggerPrice: prices[leg.Kind],
+			PriceType:    trader.TriggerPriceType(s.ctx.Config.Trading.TriggerPriceType),
+			OrderID:      leg.OrderID,
+		})
+	}
+}
+
+func (s *Server) getTradingViewAlerts(w http.ResponseWriter, r *http.Request) {
+	if s.ctx.Alerts == nil {
+		writeError(w, http.StatusServiceUnavailable, "the TradingView webhook is not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"alerts": s.ctx.Alerts.Recent()})
+}
+
+// orderGroupRequest is the body of an order group
+type orderGroupRequest struct {
+	Legs []execution.Leg `json:"legs"`
+}
+
+func (s *Server) placeOrderGroup(w http.ResponseWriter, r *http.Request) {
+	var req orderGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	resolve := func(exchange string) (trader.Trader, error) {
+		if exchange == "" {
+			if t := s.ctx.DefaultTrader(); t != nil {
+				return t, nil
+			}
+			return nil, errors.New("no trader configured")
+		}
+		return s.ctx.TraderManager.Get(exchange)
+	}
+
+	group, err := execution.PlaceGroup(r.Context(), resolve, req.Legs, s.ctx.Journal)
+	for _, cache := range s.ctx.Caches {
+		cache.Invalidate()
+	}
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusCreated, group)
+	case errors.Is(err, execution.ErrGroupFailed):
+		writeJSON(w, http.StatusBadGateway, group)
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+func (s *Server) getOrderGroups(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"groups": s.ctx.Journal.Groups()})
+}
+
+func (s *Server) getOrderGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := s.ctx.Journal.Group(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, group)
+}
+
+func (s *Server) getHeadroom(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := s.snapshot(w, r)
+	if !ok {
+		return
+	}
+
+	// New positions are sized at the risk leverage cap, or the default leverage without one
+	limits := s.ctx.Limits.Profile().Limits
+	leverage := limits.MaxLeverage
+	if leverage <= 0 {
+		leverage = s.ctx.Config.Trading.DefaultLeverage
+	}
+	writeJSON(w, http.StatusOK, execution.ComputeHeadroom(snapshot, s.ctx.Instruments.Venue(s.exchangeName(r)), execution.HeadroomPolicy{
+		Currency:    s.ctx.Config.Risk.SettleCurrency,
+		Leverage:    leverage,
+		ExposureCap: limits.MaxTotalExposure,
+	}))
+}
+
+func (s *Server) getPositionMode(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+	mode, err := trader.GetPositionMode(r.Context(), t)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"exchange": s.exchangeName(r),
+		"mode":     mode,
+	})
+}
+
+func (s *Server) getPrice(w http.ResponseWriter, r *http.Request) {
+	price, err := s.ctx.MarketClient.GetPrice(r.Context(), mux.Vars(r)["pair"])
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, price)
+}
+
+func (s *Server) getAnnouncements(w http.ResponseWriter, r *http.Request) {
+	announcements := []market.Announcement{}
+	if s.ctx.Announcements != nil {
+		announcements = s.ctx.Announcements.Recent()
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"announcements": announcements})
+}
+
+func (s *Server) getWatchlist(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pairs": s.ctx.Screener.Watchlist()})
+}
+
+// searchInstruments finds the contracts matching a query on every configured
+// venue, for picking the contract of a manual trade
+func (s *Server) searchInstruments(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("query"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	// Venues failing to list their contracts are reported beside the matches
+	instruments, failed := s.ctx.Instruments.Search(r.Context(), query, limit)
+	errs := make(map[string]string, len(failed))
+	for exchange, err := range failed {
+		errs[exchange] = err.Error()
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"instruments": instruments, "errors": errs})
+}
+
+func (s *Server) getFundingRate(w http.ResponseWriter, r *http.Request) {
+	rate, err := s.ctx.MarketClient.GetFundingRate(r.Context(), mux.Vars(r)["pair"])
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rate)
+}
+
+func (s *Server) getFundingHistory(w http.ResponseWriter, r *http.Request) {
+	pair := mux.Vars(r)["pair"]
+	if r.URL.Query().Get("from") != "" {
+		from, to, ok := fundingRange(w, r)
+		if !ok {
+			return
+		}
+		rates, err := s.ctx.FundingHistory.Rates(pair, from, to)
+		if err != nil {
+			writeError(w, exchangeStatus(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, rates)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	rates, err := s.ctx.MarketClient.GetFundingHistory(r.Context(), pair, limit)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rates)
+}
+
+func (s *Server) getFundingStats(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := fundingRange(w, r)
+	if !ok {
+		return
+	}
+	stats, err := s.ctx.FundingHistory.Stats(mux.Vars(r)["pair"], from, to)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// fundingRange parses the from/to range of a funding history request,
+// defaulting to the last 30 days
+func fundingRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid "+name+": "+err.Error())
+			return from, to, false
+		}
+		*dst = t
+	}
+	if !from.Before(to) {
+		writeError(w, http.StatusBadRequest, "from must be before to")
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// maxCandleLimit caps the limit of candle and pattern requests; longer
+// candle histories go through from and to
+const maxCandleLimit = 1000
+
+func (s *Server) getCandles(w http.ResponseWriter, r *http.Request) {
+	pair := mux.Vars(r)["pair"]
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	if limit > maxCandleLimit {
+		limit = maxCandleLimit
+	}
+
+	var candles []market.CandleData
+	if from := r.URL.Query().Get("from"); from != "" {
+		// A date range goes through the downloader, however long
+		if s.ctx.Downloader == nil {
+			writeError(w, http.StatusServiceUnavailable, "candle cache is not configured")
+			return
+		}
+		start, err := parseTime(from)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+			return
+		}
+		end := time.Now()
+		if to := r.URL.Query().Get("to"); to != "" {
+			if end, err = parseTime(to); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+				return
+			}
+		}
+		candles, err = s.ctx.Downloader.Download(r.Context(), pair, interval, start, end)
+	} else {
+		candles, err = s.ctx.Candles.Get(pair, interval, limit)
+	}
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"currency_pair": pair,
+		"interval":      interval,
+		"candles":       candles,
+	})
+}
+
+func (s *Server) getPatterns(w http.ResponseWriter, r *http.Request) {
+	pair := mux.Vars(r)["pair"]
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	if limit > maxCandleLimit {
+		limit = maxCandleLimit
+	}
+
+	patterns, err := s.ctx.Patterns.Patterns(pair, interval, limit)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, patterns)
+}
+
+func (s *Server) getLevels(w http.ResponseWriter, r *http.Request) {
+	levels, err := s.ctx.Levels.Levels(mux.Vars(r)["pair"])
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, levels)
+}
+
+func (s *Server) getRegime(w http.ResponseWriter, r *http.Request) {
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+
+	regime, err := s.ctx.Regimes.Regime(mux.Vars(r)["pair"], interval)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, regime)
+}
+
+func (s *Server) getCorrelations(w http.ResponseWriter, r *http.Request) {
+	cfg := s.ctx.Config.Risk
+	query := r.URL.Query()
+
+	pairs := s.ctx.Config.Trading.Pairs
+	if p := query.Get("pairs"); p != "" {
+		pairs = strings.Split(p, ",")
+	}
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = cfg.CorrelationInterval
+	}
+	window, err := strconv.Atoi(query.Get("window"))
+	if err != nil || window <= 1 {
+		window = cfg.CorrelationWindow
+	}
+
+	matrix, err := s.ctx.Correlations.Matrix(pairs, interval, window)
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"matrix":  matrix,
+		"buckets": matrix.Buckets(cfg.CorrelationThreshold),
+	})
+}
+
+func (s *Server) getVaR(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := s.snapshot(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := s.ctx.VaR.Compute(snapshot.Positions, s.ctx.Instruments.Venue(s.exchangeName(r)))
+	if err != nil {
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		*risk.VaRReport
+		SnapshotTime time.Time `json:"snapshot_time"`
+	}{report, snapshot.Time})
+}
+
+func (s *Server) getRiskLimits(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.trader(w, r)
+	if !ok {
+		return
+	}
+	snapshot, ok := s.snapshot(w, r)
+	if !ok {
+		return
+	}
+
+	contracts := s.ctx.Instruments.Venue(s.exchangeName(r))
+	var exposure float64
+	for _, p := range snapshot.Positions {
+		exposure += trader.Notional(contracts, p.Pair, p.Size, p.MarkPrice)
+	}
+
+	cfg := s.ctx.Config.Risk
+	profile := s.ctx.Limits.Profile()
+	resp := map[string]interface{}{
+		"exposure":              exposure,
+		"equity":                snapshot.Equity,
+		"snapshot_time":         snapshot.Time,
+		"kill_switch":           s.ctx.Limits.KillSwitch(),
+		"risk_profile":          profile.Name,
+		"max_position_notional": profile.Limits.MaxPositionNotional,
+		"max_total_exposure":    profile.Limits.MaxTotalExposure,
+		"max_leverage":          profile.Limits.MaxLeverage,
+		"max_daily_loss":        cfg.MaxDailyLoss,
+		"daily_profit_target":   cfg.DailyProfitTarget,
+		"daily_profit_action":   cfg.DailyProfitAction,
+		"profit_lock":           s.ctx.Limits.ProfitLock(),
+		"open_positions":        s.ctx.Limits.OpenPositions(),
+		"settle_currency":       cfg.SettleCurrency,
+	}
+	// The guard sits under the symbol locks and any order randomization
+	for {
+		if _, ok := t.(*risk.Guard); ok {
+			break
+		}
+		inner, ok := t.(interface{ Unwrap() trader.Trader })
+		if !ok {
+			break
+		}
+		t = inner.Unwrap()
+	}
+	if guard, ok := t.(*risk.Guard); ok {
+		pnl, err := guard.DailyPnL(r.Context())
+		if err != nil {
+			writeError(w, exchangeStatus(err), err.Error())
+			return
+		}
+		resp["daily_pnl"] = pnl
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getPnLAlerts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctx.MarketMonitor.Thresholds())
+}
+
+func (s *Server) setPnLAlerts(w http.ResponseWriter, r *http.Request) {
+	var req monitor.PnLThresholds
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	valid := func(t monitor.PnLThreshold) bool { return t.LossAmount >= 0 && t.LossPercent >= 0 }
+	if !valid(req.Global) {
+		writeError(w, http.StatusBadRequest, "thresholds must not be negative")
+		return
+	}
+	for pair, t := range req.Positions {
+		if !valid(t) {
+			writeError(w, http.StatusBadRequest, "thresholds for "+pair+" must not be negative")
+			return
+		}
+	}
+	if req.LiquidationDistance < 0 {
+		writeError(w, http.StatusBadRequest, "liquidation_distance must not be negative")
+		return
+	}
+
+	s.ctx.MarketMonitor.SetThresholds(req)
+	writeJSON(w, http.StatusOK, s.ctx.MarketMonitor.Thresholds())
+}
+
+// killSwitchRequest is the body of a kill switch change
+type killSwitchRequest struct {
+	Engaged bool   `json:"engaged"`
+	Reason  string `json:"reason"`
+}
+
+func (s *Server) setKillSwitch(w http.ResponseWriter, r *http.Request) {
+	var req killSwitchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	if req.Engaged {
+		if req.Reason == "" {
+			req.Reason = "engaged manually"
+		}
+		s.ctx.Limits.Engage(req.Reason)
+	} else {
+		s.ctx.Limits.Release()
+	}
+	writeJSON(w, http.StatusOK, s.ctx.Limits.KillSwitch())
+}
+
+func (s *Server) getNotifyChannels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"channels": s.ctx.Notifier.Channels()})
+}
+
+// notifyTestRequest is the body of a test notification
+type notifyTestRequest struct {
+	// Type is the event type sent, "test" by default; channels receiving
+	// only some event types, such as email, need one of theirs
+	Type     string          `json:"type"`
+	Severity notify.Severity `json:"severity"`
+	Message  string          `json:"message"`
+}
+
+// testNotify sends a test event to the channels receiving its severity
+func (s *Server) testNotify(w http.ResponseWriter, r *http.Request) {
+	var req notifyTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.Severity == "" {
+		req.Severity = notify.Info
+	}
+	if !req.Severity.Valid() {
+		writeError(w, http.StatusBadRequest, "invalid severity, expected info, warning or critical")
+		return
+	}
+	if req.Type == "" {
+		req.Type = "test"
+	}
+	if req.Message == "" {
+		req.Message = "Test notification from nofx"
+	}
+
+	deliveries := s.ctx.Notifier.Dispatch(r.Context(), notify.Event{
+		Type:     req.Type,
+		Severity: req.Severity,
+		Title:    "Test notification",
+		Message:  req.Message,
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": deliveries})
+}
+
+func (s *Server) getOpenPositionLimits(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctx.Limits.OpenPositions())
+}
+
+// openPositionLimitsRequest is the body of an open position limits change
+type openPositionLimitsRequest struct {
+	MaxOpenPositions     int            `json:"max_open_positions"`
+	MaxStrategyPositions map[string]int `json:"max_strategy_positions"`
+}
+
+// setOpenPositionLimits replaces the open position limits until the next
+// configuration reload changing the risk limits
+func (s *Server) setOpenPositionLimits(w http.ResponseWriter, r *http.Request) {
+	var req openPositionLimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.MaxOpenPositions < 0 {
+		writeError(w, http.StatusBadRequest, "max_open_positions must not be negative")
+		return
+	}
+	for name, max := range req.MaxStrategyPositions {
+		if max < 0 {
+			writeError(w, http.StatusBadRequest, "max_strategy_positions."+name+" must not be negative")
+			return
+		}
+	}
+
+	s.ctx.Limits.SetOpenPositionLimits(req.MaxOpenPositions, req.MaxStrategyPositions)
+	logger.Info("Open position limits set to %d, per strategy %v", req.MaxOpenPositions, req.MaxStrategyPositions)
+	writeJSON(w, http.StatusOK, s.ctx.Limits.OpenPositions())
+}
+
+func (s *Server) getRiskState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctx.Limits.State())
+}
+
+// riskProfileRequest is the body of a risk profile switch; an empty profile
+// switches back to the base limits
+type riskProfileRequest struct {
+	Profile string `json:"profile"`
+}
+
+// setRiskProfile switches the risk profile until the next scheduled switch
+func (s *Server) setRiskProfile(w http.ResponseWriter, r *http.Request) {
+	var req riskProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if err := s.ctx.Limits.SetProfile(req.Profile, risk.ProfileSourceAdmin); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.ctx.Limits.State())
+}
+
+func (s *Server) getReconciliation(w http.ResponseWriter, r *http.Request) {
+	result := s.ctx.Reconciliation()
+	if result == nil {
+		writeError(w, http.StatusNotFound, "startup reconciliation did not run")
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getFleetConfig serves the signed configuration of a fleet leader to its followers
+func (s *Server) getFleetConfig(w http.ResponseWriter, r *http.Request) {
+	if s.ctx.Config.Fleet.Role != "leader" {
+		writeError(w, http.StatusNotFound, "not a fleet leader")
+		return
+	}
+	doc, err := s.ctx.FleetDocument()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+func (s *Server) getScheduledJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": s.ctx.Scheduler.Jobs()})
+}
+
+func (s *Server) getScheduledJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.ctx.Scheduler.Job(mux.Vars(r)["name"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// runScheduledJob starts a job outside its schedule; its outcome shows in
+// its status once it completes
+func (s *Server) runScheduledJob(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := s.ctx.Scheduler.Run(name); err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, scheduler.ErrJobRunning) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	job, _ := s.ctx.Scheduler.Job(name)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) getFleetStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctx.FleetStatus())
+}
+
+func (s *Server) getStrategies(w http.ResponseWriter, r *http.Request) {
+	instances := s.ctx.Strategies.All()
+	strategies := make([]map[string]interface{}, len(instances))
+	for i, instance := range instances {
+		strategies[i] = map[string]interface{}{
+			"name":     instance.Name(),
+			"pair":     instance.Pair,
+			"interval": instance.Interval,
+			"params":   instance.Params(),
+			"lookback": instance.Lookback(),
+			"warm":     instance.Warm(),
+			"budget":   instance.Budget(),
+			"metrics":  instance.Metrics(),
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"strategies": strategies})
+}
+
+func (s *Server) runReoptimize(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"proposals": s.ctx.Reoptimizer.Run()})
+}
+
+func (s *Server) getProposals(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"proposals": s.ctx.Reoptimizer.Proposals()})
+}
+
+func (s *Server) approveProposal(w http.ResponseWriter, r *http.Request) {
+	s.decideProposal(w, r, s.ctx.Reoptimizer.Approve)
+}
+
+func (s *Server) rejectProposal(w http.ResponseWriter, r *http.Request) {
+	s.decideProposal(w, r, s.ctx.Reoptimizer.Reject)
+}
+
+// decideProposal applies an approve or reject decision to the proposal in the path
+func (s *Server) decideProposal(w http.ResponseWriter, r *http.Request, decide func(id string) error) {
+	if err := decide(mux.Vars(r)["id"]); err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, backtest.ErrProposalNotPending) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"proposals": s.ctx.Reoptimizer.Proposals()})
+}
+
+func (s *Server) getCandidates(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"candidates": s.ctx.Promoter.Candidates(),
+		"strategies": strategy.Defined(),
+	})
+}
+
+// candidateRequest is the body of a promotion candidate
+type candidateRequest struct {
+	Strategy string          `json:"strategy"`
+	Pair     string          `json:"pair"`
+	Interval string          `json:"interval"`
+	Params   strategy.Params `json:"params"`
+	Budget   strategy.Budget `json:"budget"`
+}
+
+func (s *Server) submitCandidate(w http.ResponseWriter, r *http.Request) {
+	var req candidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	candidate, err := s.ctx.Promoter.Submit(req.Strategy, req.Pair, req.Interval, req.Params, req.Budget)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, candidate)
+}
+
+func (s *Server) getCandidate(w http.ResponseWriter, r *http.Request) {
+	candidate, err := s.ctx.Promoter.Candidate(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, candidate)
+}
+
+func (s *Server) promoteCandidate(w http.ResponseWriter, r *http.Request) {
+	s.moveCandidate(w, r, s.ctx.Promoter.Promote)
+}
+
+func (s *Server) retireCandidate(w http.ResponseWriter, r *http.Request) {
+	s.moveCandidate(w, r, s.ctx.Promoter.Retire)
+}
+
+// getShadowAccounts compares the shadow accounts, ranked from best to worst return
+func (s *Server) getShadowAccounts(w http.ResponseWriter, r *http.Request) {
+	if s.ctx.Shadow == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"accounts": []backtest.ShadowAccount{}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"accounts": s.ctx.Shadow.Accounts()})
+}
+
+// getShadowAccount returns a shadow account with its equity curve
+func (s *Server) getShadowAccount(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if s.ctx.Shadow == nil {
+		writeError(w, http.StatusNotFound, backtest.ErrUnknownAccount.Error()+": "+name)
+		return
+	}
+	account, err := s.ctx.Shadow.Account(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, account)
+}
+
+// promotionRequest is the body of a candidate promotion or retirement;
+// ApprovedBy is kept in the note, the approver being the authenticated user
+type promotionRequest struct {
+	ApprovedBy string `json:"approved_by"`
+	Note       string `json:"note"`
+}
+
+// moveCandidate applies a promote or retire decision to the candidate in
+// the path, approved by the authenticated user of the request
+func (s *Server) moveCandidate(w http.ResponseWriter, r *http.Request, move func(id, by, note string) (backtest.Candidate, error)) {
+	var req promotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	approver := Principal(r)
+	if approver == "" {
+		writeError(w, http.StatusForbidden, "promotion decisions need an authenticated user; enable security.auth_enabled")
+		return
+	}
+	note := strings.TrimSpace(req.Note)
+	if req.ApprovedBy != "" && req.ApprovedBy != approver {
+		note = strings.TrimSpace("approved_by " + req.ApprovedBy + "; " + note)
+	}
+
+	id := mux.Vars(r)["id"]
+	if _, err := s.ctx.Promoter.Candidate(id); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	candidate, err := move(id, approver, note)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, backtest.ErrInvalidStage) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, candidate)
+}
+
+// historyQuery parses the common history filters: exchange, pair, strategy,
+// from/to (RFC 3339 or unix seconds), limit and tag; target is the kind of
+// annotation a tag filter matches
+func (s *Server) historyQuery(w http.ResponseWriter, r *http.Request, target journal.AnnotationTarget) (storage.Query, bool) {
+	if s.ctx.Store == nil {
+		writeError(w, http.StatusServiceUnavailable, "history store is not configured")
+		return storage.Query{}, false
+	}
+
+	query := r.URL.Query()
+	q := storage.Query{
+		Exchange: query.Get("exchange"),
+		Pair:     query.Get("pair"),
+		Strategy: query.Get("strategy"),
+		Limit:    100,
+	}
+	if tag := query.Get("tag"); tag != "" {
+		q.Refs = []string{}
+		for ref := range s.ctx.Journal.Tagged(target, tag) {
+			q.Refs = append(q.Refs, ref)
+		}
+	}
+	for name, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid "+name+": "+err.Error())
+			return q, false
+		}
+		*dst = t
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return q, false
+		}
+		q.Limit = limit
+	}
+	return q, true
+}
+
+// parseTime parses an RFC 3339 timestamp or unix seconds
+func parseTime(v string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func (s *Server) getOrderHistory(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.historyQuery(w, r, journal.OrderTarget)
+	if !ok {
+		return
+	}
+	orders, err := s.ctx.Store.Orders(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"orders": orders})
+}
+
+func (s *Server) getFillHistory(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.historyQuery(w, r, journal.OrderTarget)
+	if !ok {
+		return
+	}
+	fills, err := s.ctx.Store.Fills(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"fills": fills})
+}
+
+func (s *Server) getPositionHistory(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.historyQuery(w, r, journal.PositionTarget)
+	if !ok {
+		return
+	}
+	positions, err := s.ctx.Store.Positions(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"positions": positions})
+}
+
+func (s *Server) getBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.historyQuery(w, r, "")
+	if !ok {
+		return
+	}
+	balances, err := s.ctx.Store.Balances(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"balances": balances})
+}
+
+// getTradeHistory returns a page of recorded fills, newest first, with
+// their estimated fee, realized PnL and client order ID; symbol (or pair),
+// side, strategy, exchange and from/to filter them and cursor continues from
+// the previous page's next_cursor
+func (s *Server) getTradeHistory(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.historyQuery(w, r, journal.OrderTarget)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	if symbol := query.Get("symbol"); symbol != "" {
+		q.Pair = symbol
+	}
+	side := trader.Side(query.Get("side"))
+	if side != "" && side != trader.BuySide && side != trader.SellSide {
+		writeError(w, http.StatusBadRequest, "side must be buy or sell")
+		return
+	}
+
+	records, next, err := s.ctx.Store.Trades(q, side, query.Get("cursor"))
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ids := make([]int64, len(records))
+	for i, t := range records {
+		ids[i] = t.ID
+	}
+	results, err := s.ctx.PnL.Fills(ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type trade struct {
+		storage.TradeRecord
+		pnl.FillResult
+	}
+	trades := make([]trade, len(records))
+	for i, t := range records {
+		trades[i] = trade{t, results[t.ID]}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"trades": trades, "next_cursor": next})
+}
+
+// getTransferHistory returns the recorded deposits and withdrawals; pair
+// filters by currency
+func (s *Server) getTransferHistory(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.historyQuery(w, r, "")
+	if !ok {
+		return
+	}
+	transfers, err := s.ctx.Store.Transfers(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"transfers": transfers})
+}
+
+// getPnL returns the realized PnL, fees and funding of the recorded history
+// per day, week or month, and the unrealized PnL of the open lots
+func (s *Server) getPnL(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.historyQuery(w, r, "")
+	if !ok {
+		return
+	}
+	if s.ctx.PnL == nil {
+		writeError(w, http.StatusServiceUnavailable, "history store is not configured")
+		return
+	}
+	period := r.URL.Query().Get("period")
+	switch period {
+	case "", pnl.Day, pnl.Week, pnl.Month:
+	default:
+		writeError(w, http.StatusBadRequest, "period must be day, week or month")
+		return
+	}
+
+	summary, err := s.ctx.PnL.Summarize(q, period)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// getPnLTrades returns the closed trades of the PnL ledger, newest first
+func (s *Server) getPnLTrades(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.historyQuery(w, r, "")
+	if !ok {
+		return
+	}
+	if s.ctx.PnL == nil {
+		writeError(w, http.StatusServiceUnavailable, "history store is not configured")
+		return
+	}
+	trades, err := s.ctx.PnL.Trades(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"trades": trades})
+}
+
+// getStats returns turnover and trade frequency over the last days (default
+// the configured activity window) or a from/to range
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	if s.ctx.Activity == nil {
+		writeError(w, http.StatusServiceUnavailable, "history store is not configured")
+		return
+	}
+	from, to, ok := statsRange(w, r, s.ctx.Config.Monitor.ActivityWindow)
+	if !ok {
+		return
+	}
+
+	// ?tag= limits the trades to the orders carrying the journal tag exactly
+	var orders map[string]bool
+	tag := r.URL.Query().Get("tag")
+	if tag != "" {
+		orders = s.ctx.Journal.Tagged(journal.OrderTarget, tag)
+	}
+	stats, err := s.ctx.Activity.Compute(from, to, orders)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	stats.Tag = tag
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// getTCA returns the trade cost analysis of the orders created over the
+// last days (default the configured TCA window) or a from/to range
+func (s *Server) getTCA(w http.ResponseWriter, r *http.Request) {
+	if s.ctx.TCA == nil {
+		writeError(w, http.StatusServiceUnavailable, "history store or candle cache is not configured")
+		return
+	}
+	from, to, ok := statsRange(w, r, s.ctx.Config.Monitor.TCAWindow)
+	if !ok {
+		return
+	}
+
+	tca, err := s.ctx.TCA.Compute(from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, tca)
+}
+
+// statsRange parses the period of a statistics request: the last days
+// (default days) or a from/to range, writing an error response when invalid
+func statsRange(w http.ResponseWriter, r *http.Request, days int) (time.Time, time.Time, bool) {
+	query := r.URL.Query()
+	if v := query.Get("days"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid days")
+			return time.Time{}, time.Time{}, false
+		}
+		days = d
+	}
+	to := time.Now()
+	from := to.AddDate(0, 0, -days)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid "+name+": "+err.Error())
+			return time.Time{}, time.Time{}, false
+		}
+		*dst = t
+	}
+	if !from.Before(to) {
+		writeError(w, http.StatusBadRequest, "from must be before to")
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+func (s *Server) getAnnotations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	annotations := s.ctx.Journal.Annotations(journal.AnnotationFilter{
+		Target:    journal.AnnotationTarget(query.Get("target")),
+		Reference: query.Get("reference"),
+		Pair:      query.Get("pair"),
+		Tag:       query.Get("tag"),
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"annotations": annotations})
+}
+
+func (s *Server) createAnnotation(w http.ResponseWriter, r *http.Request) {
+	var req journal.Annotation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	annotation, err := s.ctx.Journal.Annotate(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, annotation)
+}
+
+func (s *Server) deleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	if err := s.ctx.Journal.DeleteAnnotation(mux.Vars(r)["id"]); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, journal.ErrAnnotationNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logFilter parses the level, module and tail query parameters of log requests
+func logFilter(r *http.Request) (logger.Filter, int) {
+	query := r.URL.Query()
+	filter := logger.Filter{Module: query.Get("module")}
+	if level := query.Get("level"); level != "" {
+		filter.Level = logger.ParseLevel(level)
+	}
+	tail, err := strconv.Atoi(query.Get("tail"))
+	if err != nil || tail < 0 {
+		tail = 100
+	}
+	return filter, tail
+}
+
+func (s *Server) getLogs(w http.ResponseWriter, r *http.Request) {
+	filter, tail := logFilter(r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": logger.Recent(filter, tail)})
+}
+
+// streamLogs tails recent log entries and then streams new ones as
+// server-sent events until the client disconnects
+func (s *Server) streamLogs(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	filter, tail := logFilter(r)
+	entries, cancel := logger.Subscribe(filter)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(e logger.Entry) {
+		data, _ := json.Marshal(e)
+		w.Write([]byte("data: "))
+		w.Write(data)
+		w.Write([]byte("\n\n"))
+	}
+	for _, e := range logger.Recent(filter, tail) {
+		send(e)
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case e := <-entries:
+			send(e)
+			flusher.Flush()
+		case <-keepalive.C:
+			w.Write([]byte(": keepalive\n\n"))
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// eventWriteTimeout bounds a single write to an event stream client
+const eventWriteTimeout = 10 * time.Second
+
+// eventUpgrader upgrades event stream requests to websockets
+// and accepts the bearer subprotocol browsers authenticate with
+var eventUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024, Subprotocols: []string{bearerProtocol}}
+
+// streamEvents streams market events, optionally only the comma-separated
+// types of ?type=, over a websocket until the client disconnects
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	types := make(map[string]bool)
+	for _, t := range strings.Split(r.URL.Query().Get("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = true
+		}
+	}
+
+	conn, err := eventUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	events := s.ctx.Events.Subscribe()
+	defer s.ctx.Events.Unsubscribe(events)
+
+	// Read until the client goes away so control frames are processed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case e := <-events:
+			if len(types) > 0 && !types[e.Type] {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if err := conn.WriteJSON(decimals.encode(e)); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
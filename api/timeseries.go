@@ -0,0 +1,235 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nofx/storage"
+)
+
+// seriesAggregate selects how the points of a downsampling bucket combine
+type seriesAggregate int
+
+const (
+	// aggregateLast keeps the last point of a bucket, for levels such as equity
+	aggregateLast seriesAggregate = iota
+	// aggregateMean averages the points of a bucket, for samples such as slippage
+	aggregateMean
+	// aggregateSum adds the points of a bucket up, for flows such as transfers
+	aggregateSum
+)
+
+// timeseriesSource produces the points of a metric between q.From and q.To
+type timeseriesSource struct {
+	aggregate seriesAggregate
+	needsPair bool
+	series    func(s *Server, q storage.Query) ([]storage.Point, error)
+}
+
+// timeseriesSources maps the metrics of /api/timeseries to their sources;
+// a new metric only needs an entry here
+var timeseriesSources = map[string]timeseriesSource{
+	// equity is the total balance across exchanges
+	"equity": {aggregateLast, false, func(s *Server, q storage.Query) ([]storage.Point, error) {
+		if s.ctx.Store == nil {
+			return nil, errSeriesUnavailable
+		}
+		return s.ctx.Store.EquitySeries(q)
+	}},
+	// transfers is the net amount of each completed deposit and withdrawal
+	"transfers": {aggregateSum, false, func(s *Server, q storage.Query) ([]storage.Point, error) {
+		if s.ctx.Store == nil {
+			return nil, errSeriesUnavailable
+		}
+		transfers, err := s.ctx.Store.Transfers(storage.Query{Exchange: q.Exchange, Pair: q.Pair, From: q.From, To: q.To})
+		if err != nil {
+			return nil, err
+		}
+		points := []storage.Point{}
+		for i := len(transfers) - 1; i >= 0; i-- {
+			if t := transfers[i]; t.Completed {
+				points = append(points, storage.Point{Time: t.Time, Value: t.Net()})
+			}
+		}
+		return points, nil
+	}},
+	// exposure is the gross notional of the open positions
+	"exposure": {aggregateLast, false, func(s *Server, q storage.Query) ([]storage.Point, error) {
+		if s.ctx.Store == nil {
+			return nil, errSeriesUnavailable
+		}
+		return s.ctx.Store.ExposureSeries(q)
+	}},
+	// funding is the settled funding rate of a pair
+	"funding": {aggregateMean, true, func(s *Server, q storage.Query) ([]storage.Point, error) {
+		rates, err := s.ctx.FundingHistory.Rates(q.Pair, q.From, q.To)
+		if err != nil {
+			return nil, err
+		}
+		points := make([]storage.Point, len(rates))
+		for i, r := range rates {
+			points[i] = storage.Point{Time: time.Unix(r.Time, 0), Value: r.Rate}
+		}
+		return points, nil
+	}},
+	// slippage is the cost in basis points of each filled order against its
+	// arrival price
+	"slippage": {aggregateMean, false, func(s *Server, q storage.Query) ([]storage.Point, error) {
+		if s.ctx.TCA == nil {
+			return nil, errSeriesUnavailable
+		}
+		costs, _, err := s.ctx.TCA.Executions(q.From, q.To)
+		if err != nil {
+			return nil, err
+		}
+		points := []storage.Point{}
+		for _, c := range costs {
+			if (q.Exchange == "" || c.Exchange == q.Exchange) && (q.Pair == "" || c.Pair == q.Pair) &&
+				(q.Strategy == "" || c.Strategy == q.Strategy) {
+				points = append(points, storage.Point{Time: c.Filled, Value: c.ArrivalBps})
+			}
+		}
+		return points, nil
+	}},
+}
+
+// errSeriesUnavailable is returned for metrics whose backing store is not configured
+var errSeriesUnavailable = errors.New("metric is not available: history store or candle cache is not configured")
+
+// getTimeseries returns the points of a metric over a range, e.g.
+// ?metric=equity&range=7d&step=1h, or from/to; exchange, pair and strategy
+// filter the metrics that support them and step downsamples the series
+func (s *Server) getTimeseries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	source, ok := timeseriesSources[metric]
+	if !ok {
+		metrics := make([]string, 0, len(timeseriesSources))
+		for name := range timeseriesSources {
+			metrics = append(metrics, name)
+		}
+		sort.Strings(metrics)
+		writeError(w, http.StatusBadRequest, "metric must be one of "+strings.Join(metrics, ", "))
+		return
+	}
+
+	q := storage.Query{
+		Exchange: query.Get("exchange"),
+		Pair:     query.Get("pair"),
+		Strategy: query.Get("strategy"),
+		To:       time.Now(),
+	}
+	span := 24 * time.Hour
+	if v := query.Get("range"); v != "" {
+		d, err := parseSpan(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid range: "+err.Error())
+			return
+		}
+		span = d
+	}
+	q.From = q.To.Add(-span)
+	for name, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid "+name+": "+err.Error())
+			return
+		}
+		*dst = t
+	}
+	if source.needsPair && q.Pair == "" {
+		writeError(w, http.StatusBadRequest, metric+" needs a pair")
+		return
+	}
+	if !q.From.Before(q.To) {
+		writeError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+	var step time.Duration
+	if v := query.Get("step"); v != "" {
+		d, err := parseSpan(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid step: "+err.Error())
+			return
+		}
+		step = d
+	}
+
+	points, err := source.series(s, q)
+	switch {
+	case errors.Is(err, errSeriesUnavailable):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
+		writeError(w, exchangeStatus(err), err.Error())
+		return
+	}
+	if step > 0 {
+		points = downsample(points, step, source.aggregate)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"metric": metric,
+		"from":   q.From,
+		"to":     q.To,
+		"points": points,
+	})
+}
+
+// parseSpan parses a duration, also accepting whole days such as "7d"
+func parseSpan(v string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return 0, err
+		}
+	}
+	if d <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return d, nil
+}
+
+// downsample combines time ordered points into one per step, stamped with
+// the start of its bucket; the transfers labelling the points of a bucket
+// add up
+func downsample(points []storage.Point, step time.Duration, aggregate seriesAggregate) []storage.Point {
+	out := []storage.Point{}
+	var sum, transfers float64
+	n := 0
+	for i, p := range points {
+		bucket := p.Time.Truncate(step)
+		if aggregate != aggregateLast {
+			sum += p.Value
+			n++
+		}
+		transfers += p.Transfers
+		if i+1 < len(points) && points[i+1].Time.Truncate(step).Equal(bucket) {
+			continue
+		}
+		value := p.Value
+		switch aggregate {
+		case aggregateMean:
+			value = sum / float64(n)
+		case aggregateSum:
+			value = sum
+		}
+		out = append(out, storage.Point{Time: bucket, Value: value, Transfers: transfers})
+		sum, transfers, n = 0, 0, 0
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package backtest
+
+import (
+	"math"
+	"sort"
+
+	"github.com/nofx/indicators"
+	"github.com/nofx/market"
+	"github.com/nofx/strategy"
+)
+
+// Result represents the performance of a strategy over a candle series
+type Result struct {
+	Params      strategy.Params `json:"params"`
+	Return      float64         `json:"return"`
+	MaxDrawdown float64         `json:"max_drawdown"`
+	Sharpe      float64         `json:"sharpe"`
+	Trades      int             `json:"trades"`
+	Funding     float64         `json:"funding"`
+}
+
+// Run simulates a strategy bar by bar: the signal computed at each close is
+// held until the next close, every position change pays feeBps and a held
+// position pays the funding rates, sorted by time, settled during its bars
+func Run(s strategy.Strategy, params strategy.Params, candles []market.CandleData, feeBps float64, funding []market.FundingRate) Result {
+	result := Result{Params: params.Clone()}
+	if len(candles) < 2 {
+		return result
+	}
+
+	equity, peak := 1.0, 1.0
+	position := strategy.Flat
+	returns := make([]float64, 0, len(candles)-1)
+	next := 0
+	for i := 0; i < len(candles)-1; i++ {
+		signal := s.Signal(candles[:i+1], params)
+
+		var r float64
+		if signal != position {
+			r -= math.Abs(float64(signal-position)) * feeBps / 10000
+			if signal != strategy.Flat {
+				result.Trades++
+			}
+			position = signal
+		}
+		if candles[i].Close != 0 {
+			r += float64(position) * (candles[i+1].Close/candles[i].Close - 1)
+		}
+
+		// Settlements during the bar: longs pay positive rates, shorts negative
+		for next < len(funding) && funding[next].Time <= candles[i].Timestamp {
+			next++
+		}
+		for ; next < len(funding) && funding[next].Time <= candles[i+1].Timestamp; next++ {
+			paid := float64(position) * funding[next].Rate
+			r -= paid
+			result.Funding -= paid
+		}
+
+		returns = append(returns, r)
+		equity *= 1 + r
+		if equity > peak {
+			peak = equity
+		}
+		if dd := 1 - equity/peak; dd > result.MaxDrawdown {
+			result.MaxDrawdown = dd
+		}
+	}
+
+	result.Return = equity - 1
+	if sd := indicators.StdDev(returns); sd > 0 {
+		result.Sharpe = indicators.Mean(returns) / sd * math.Sqrt(float64(len(returns)))
+	}
+	return result
+}
+
+// Sweep runs a strategy over every combination of its parameter grid and
+// returns the results sorted from best to worst Sharpe ratio
+func Sweep(s strategy.Strategy, candles []market.CandleData, feeBps float64, funding []market.FundingRate) []Result {
+	combinations := expandGrid(s.ParamGrid())
+	results := make([]Result, len(combinations))
+	for i, params := range combinations {
+		results[i] = Run(s, params, candles, feeBps, funding)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Sharpe > results[j].Sharpe })
+	return results
+}
+
+// expandGrid returns the cartesian product of a parameter grid
+func expandGrid(grid map[string][]float64) []strategy.Params {
+	names := make([]string, 0, len(grid))
+	for name := range grid {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	combinations := []strategy.Params{{}}
+	for _, name := range names {
+		var next []strategy.Params
+		for _, params := range combinations {
+			for _, v := range grid[name] {
+				p := params.Clone()
+				p[name] = v
+				next = append(next, p)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
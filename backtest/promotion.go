@@ -0,0 +1,316 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/strategy"
+)
+
+// ErrInvalidStage is returned when a candidate can't move from its current stage
+var ErrInvalidStage = errors.New("invalid stage transition")
+
+// Stage represents how far a strategy configuration has been promoted
+type Stage string
+
+const (
+	// StageBacktest has only been backtested
+	StageBacktest Stage = "backtest"
+	// StagePaper runs against live data without placing orders
+	StagePaper Stage = "paper"
+	// StageLive trades for real
+	StageLive Stage = "live"
+	// StageRetired no longer runs
+	StageRetired Stage = "retired"
+)
+
+// Approval represents a recorded stage transition
+type Approval struct {
+	From Stage     `json:"from"`
+	To   Stage     `json:"to"`
+	By   string    `json:"by"`
+	Note string    `json:"note,omitempty"`
+	At   time.Time `json:"at"`
+}
+
+// Candidate represents a strategy configuration moving from backtest to live
+type Candidate struct {
+	ID        string          `json:"id"`
+	Strategy  string          `json:"strategy"`
+	Pair      string          `json:"pair"`
+	Interval  string          `json:"interval"`
+	Params    strategy.Params `json:"params"`
+	Budget    strategy.Budget `json:"budget"`
+	Stage     Stage           `json:"stage"`
+	Backtest  Result          `json:"backtest"`
+	Approvals []Approval      `json:"approvals"`
+	Created   time.Time       `json:"created"`
+}
+
+// name returns the name of the candidate's strategy instance
+func (c *Candidate) name() string {
+	return c.Strategy + ":" + c.Pair
+}
+
+// clone returns a copy safe to hand out
+func (c *Candidate) clone() Candidate {
+	copied := *c
+	copied.Params = c.Params.Clone()
+	copied.Approvals = append([]Approval(nil), c.Approvals...)
+	return copied
+}
+
+// CandidateStore persists candidates and their approvals, typically the
+// history store
+type CandidateStore interface {
+	SaveCandidate(c Candidate) error
+	SaveApproval(id string, a Approval) error
+	Candidates() ([]Candidate, error)
+}
+
+// Promoter runs the promotion workflow: a configuration is backtested when
+// submitted, then promoted to the paper registry and on to the live registry,
+// each step recorded with its approver. Parameters and risk budget travel
+// with the configuration, so no stage needs hand-edited config.
+type Promoter struct {
+	paper   *strategy.Registry
+	live    *strategy.Registry
+	candles CandleSource
+	funding FundingSource
+	window  int
+	feeBps  float64
+
+	mu         sync.Mutex
+	candidates []*Candidate
+	seq        int
+	store      CandidateStore
+}
+
+// NewPromoter creates a new promotion workflow backtesting over the last
+// window candles; funding may be nil to backtest without funding costs
+func NewPromoter(paper, live *strategy.Registry, candles CandleSource, funding FundingSource, window int, feeBps float64) *Promoter {
+	return &Promoter{
+		paper:   paper,
+		live:    live,
+		candles: candles,
+		funding: funding,
+		window:  window,
+		feeBps:  feeBps,
+	}
+}
+
+// Submit backtests a strategy configuration and records it as a candidate
+func (p *Promoter) Submit(name, pair, interval string, params strategy.Params, budget strategy.Budget) (Candidate, error) {
+	s, err := strategy.Lookup(name)
+	if err != nil {
+		return Candidate{}, err
+	}
+	if pair == "" || interval == "" {
+		return Candidate{}, errors.New("pair and interval are required")
+	}
+	candles, err := p.candles.Get(pair, interval, p.window)
+	if err != nil {
+		return Candidate{}, err
+	}
+
+	c := &Candidate{
+		Strategy: name,
+		Pair:     pair,
+		Interval: interval,
+		Params:   params.Clone(),
+		Budget:   budget,
+		Stage:    StageBacktest,
+		Backtest: Run(s, params, candles, p.feeBps, fundingFor(p.funding, pair, candles)),
+		Created:  time.Now(),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.ID = strconv.Itoa(p.seq + 1)
+	if p.store != nil {
+		if err := p.store.SaveCandidate(*c); err != nil {
+			return Candidate{}, err
+		}
+	}
+	p.seq++
+	p.candidates = append(p.candidates, c)
+
+	logger.Info("Candidate %s submitted: %s on %s %s (return %.2f%%, Sharpe %.2f)",
+		c.ID, name, pair, interval, c.Backtest.Return*100, c.Backtest.Sharpe)
+	return c.clone(), nil
+}
+
+// Promote moves a candidate to its next stage, recording who approved it:
+// backtest to paper, paper to live. A live candidate replaces the live
+// configuration of the same strategy and pair, which is retired.
+func (p *Promoter) Promote(id, by, note string) (Candidate, error) {
+	if by == "" {
+		return Candidate{}, errors.New("approver is required")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, err := p.find(id)
+	if err != nil {
+		return Candidate{}, err
+	}
+
+	switch c.Stage {
+	case StageBacktest:
+		if err := p.deploy(p.paper, c); err != nil {
+			return Candidate{}, err
+		}
+		if err := p.record(c, StagePaper, by, note); err != nil {
+			return Candidate{}, err
+		}
+	case StagePaper:
+		if instance, err := p.live.Get(c.name()); err == nil {
+			instance.SetParams(c.Params)
+			instance.SetBudget(c.Budget)
+		} else if err := p.deploy(p.live, c); err != nil {
+			return Candidate{}, err
+		}
+		p.paper.Remove(c.name())
+		for _, other := range p.candidates {
+			if other != c && other.Stage == StageLive && other.name() == c.name() {
+				if err := p.record(other, StageRetired, by, "superseded by candidate "+c.ID); err != nil {
+					return Candidate{}, err
+				}
+			}
+		}
+		if err := p.record(c, StageLive, by, note); err != nil {
+			return Candidate{}, err
+		}
+	default:
+		return Candidate{}, fmt.Errorf("candidate %s is %s: %w", id, c.Stage, ErrInvalidStage)
+	}
+	return c.clone(), nil
+}
+
+// Retire stops a candidate at any stage, recording who decided it
+func (p *Promoter) Retire(id, by, note string) (Candidate, error) {
+	if by == "" {
+		return Candidate{}, errors.New("approver is required")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, err := p.find(id)
+	if err != nil {
+		return Candidate{}, err
+	}
+
+	switch c.Stage {
+	case StageRetired:
+		return Candidate{}, fmt.Errorf("candidate %s is %s: %w", id, c.Stage, ErrInvalidStage)
+	case StagePaper:
+		p.paper.Remove(c.name())
+	case StageLive:
+		p.live.Remove(c.name())
+	}
+	if err := p.record(c, StageRetired, by, note); err != nil {
+		return Candidate{}, err
+	}
+	return c.clone(), nil
+}
+
+// SetCandidateStore loads the persisted candidates, deploying those at the
+// paper and live stages to their registry again, and writes every later
+// change through to the store
+func (p *Promoter) SetCandidateStore(store CandidateStore) error {
+	candidates, err := store.Candidates()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.store = store
+	for i := range candidates {
+		c := &candidates[i]
+		if id, err := strconv.Atoi(c.ID); err == nil && id > p.seq {
+			p.seq = id
+		}
+		var registry *strategy.Registry
+		switch c.Stage {
+		case StagePaper:
+			registry = p.paper
+		case StageLive:
+			registry = p.live
+		}
+		if registry != nil {
+			if err := p.deploy(registry, c); err != nil {
+				logger.Warning("Failed to deploy %s candidate %s (%s): %v", c.Stage, c.ID, c.name(), err)
+			}
+		}
+		p.candidates = append(p.candidates, c)
+	}
+	return nil
+}
+
+// Candidates returns all candidates, oldest first
+func (p *Promoter) Candidates() []Candidate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	candidates := make([]Candidate, len(p.candidates))
+	for i, c := range p.candidates {
+		candidates[i] = c.clone()
+	}
+	return candidates
+}
+
+// Candidate returns a candidate by ID
+func (p *Promoter) Candidate(id string) (Candidate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, err := p.find(id)
+	if err != nil {
+		return Candidate{}, err
+	}
+	return c.clone(), nil
+}
+
+// deploy registers a candidate's configuration in a registry; callers hold mu
+func (p *Promoter) deploy(registry *strategy.Registry, c *Candidate) error {
+	s, err := strategy.Lookup(c.Strategy)
+	if err != nil {
+		return err
+	}
+	instance := strategy.NewInstance(s, c.Pair, c.Interval, c.Params)
+	instance.SetBudget(c.Budget)
+	return registry.Register(instance)
+}
+
+// record moves a candidate to a stage and appends the approval, persisting
+// both; callers hold mu
+func (p *Promoter) record(c *Candidate, to Stage, by, note string) error {
+	approval := Approval{From: c.Stage, To: to, By: by, Note: note, At: time.Now()}
+	if p.store != nil {
+		moved := *c
+		moved.Stage = to
+		if err := p.store.SaveApproval(c.ID, approval); err != nil {
+			return err
+		}
+		if err := p.store.SaveCandidate(moved); err != nil {
+			return err
+		}
+	}
+	c.Approvals = append(c.Approvals, approval)
+	logger.Info("Candidate %s (%s) moved from %s to %s by %s", c.ID, c.name(), c.Stage, to, by)
+	c.Stage = to
+	return nil
+}
+
+// find returns a candidate by ID; callers hold mu
+func (p *Promoter) find(id string) (*Candidate, error) {
+	for _, c := range p.candidates {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("candidate %s not found", id)
+}
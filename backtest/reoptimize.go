@@ -0,0 +1,257 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/strategy"
+)
+
+// ErrProposalNotPending is returned when deciding on a proposal that was already decided
+var ErrProposalNotPending = errors.New("proposal is not pending")
+
+// ProposalStatus represents the state of a parameter proposal
+type ProposalStatus string
+
+const (
+	// ProposalPending awaits approval
+	ProposalPending ProposalStatus = "pending"
+	// ProposalApplied was applied to the live strategy
+	ProposalApplied ProposalStatus = "applied"
+	// ProposalRejected was rejected
+	ProposalRejected ProposalStatus = "rejected"
+	// ProposalSuperseded was replaced by a newer proposal for the same strategy
+	ProposalSuperseded ProposalStatus = "superseded"
+)
+
+// Proposal represents a suggested parameter update for a live strategy
+type Proposal struct {
+	ID       string         `json:"id"`
+	Strategy string         `json:"strategy"`
+	Current  Result         `json:"current"`
+	Proposed Result         `json:"proposed"`
+	Status   ProposalStatus `json:"status"`
+	Created  time.Time      `json:"created"`
+	Decided  time.Time      `json:"decided"`
+}
+
+// CandleSource provides historical candles, typically the candle store
+type CandleSource interface {
+	Get(pair, interval string, limit int) ([]market.CandleData, error)
+}
+
+// FundingSource provides historical funding rates, typically the funding history
+type FundingSource interface {
+	Rates(pair string, from, to time.Time) ([]market.FundingRate, error)
+}
+
+// fundingFor returns the funding rates settled over a candle series; without
+// a source, or when it fails, the backtest runs without funding costs
+func fundingFor(source FundingSource, pair string, candles []market.CandleData) []market.FundingRate {
+	if source == nil || len(candles) < 2 {
+		return nil
+	}
+	from := time.Unix(candles[0].Timestamp, 0)
+	to := time.Unix(candles[len(candles)-1].Timestamp+1, 0)
+	rates, err := source.Rates(pair, from, to)
+	if err != nil {
+		logger.Warning("Failed to get funding rates of %s, backtesting without funding: %v", pair, err)
+		return nil
+	}
+	return rates
+}
+
+// ReoptimizerConfig represents the settings of the re-optimization job
+type ReoptimizerConfig struct {
+	Interval       time.Duration
+	Window         int
+	FeeBps         float64
+	MinImprovement float64
+	AutoApply      bool
+}
+
+// Reoptimizer periodically re-runs the parameter sweep of every live strategy
+// on recent data and proposes parameters that beat the current ones
+type Reoptimizer struct {
+	registry *strategy.Registry
+	candles  CandleSource
+	funding  FundingSource
+	cfg      ReoptimizerConfig
+
+	mu        sync.Mutex
+	proposals []*Proposal
+	seq       int
+	stop      chan struct{}
+}
+
+// NewReoptimizer creates a new re-optimization job; funding may be nil to
+// backtest without funding costs
+func NewReoptimizer(registry *strategy.Registry, candles CandleSource, funding FundingSource, cfg ReoptimizerConfig) *Reoptimizer {
+	return &Reoptimizer{
+		registry: registry,
+		candles:  candles,
+		funding:  funding,
+		cfg:      cfg,
+	}
+}
+
+// Start runs the job periodically in the background
+func (o *Reoptimizer) Start() {
+	o.mu.Lock()
+	if o.stop != nil {
+		o.mu.Unlock()
+		return
+	}
+	o.stop = make(chan struct{})
+	stop := o.stop
+	o.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(o.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				o.Run()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the job
+func (o *Reoptimizer) Stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.stop != nil {
+		close(o.stop)
+		o.stop = nil
+	}
+}
+
+// Run re-optimizes every registered strategy once and returns the new proposals
+func (o *Reoptimizer) Run() []*Proposal {
+	var created []*Proposal
+	for _, instance := range o.registry.All() {
+		p, err := o.reoptimize(instance)
+		if err != nil {
+			logger.Warning("Failed to re-optimize %s: %v", instance.Name(), err)
+			continue
+		}
+		if p != nil {
+			created = append(created, p)
+		}
+	}
+	return created
+}
+
+// reoptimize sweeps one strategy and records a proposal when the best
+// parameters improve the Sharpe ratio by at least MinImprovement
+func (o *Reoptimizer) reoptimize(instance *strategy.Instance) (*Proposal, error) {
+	candles, err := o.candles.Get(instance.Pair, instance.Interval, o.cfg.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	funding := fundingFor(o.funding, instance.Pair, candles)
+	current := Run(instance.Strategy, instance.Params(), candles, o.cfg.FeeBps, funding)
+	results := Sweep(instance.Strategy, candles, o.cfg.FeeBps, funding)
+	if len(results) == 0 {
+		return nil, nil
+	}
+	best := results[0]
+	if best.Sharpe-current.Sharpe < o.cfg.MinImprovement {
+		return nil, nil
+	}
+
+	o.mu.Lock()
+	o.seq++
+	p := &Proposal{
+		ID:       strconv.Itoa(o.seq),
+		Strategy: instance.Name(),
+		Current:  current,
+		Proposed: best,
+		Status:   ProposalPending,
+		Created:  time.Now(),
+	}
+	for _, old := range o.proposals {
+		if old.Strategy == p.Strategy && old.Status == ProposalPending {
+			old.Status, old.Decided = ProposalSuperseded, p.Created
+		}
+	}
+	o.proposals = append(o.proposals, p)
+	o.mu.Unlock()
+
+	logger.Info("Proposed parameters for %s: %v (Sharpe %.2f -> %.2f)",
+		p.Strategy, best.Params, current.Sharpe, best.Sharpe)
+
+	if o.cfg.AutoApply {
+		if err := o.Approve(p.ID); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// Proposals returns all proposals, oldest first
+func (o *Reoptimizer) Proposals() []Proposal {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	proposals := make([]Proposal, len(o.proposals))
+	for i, p := range o.proposals {
+		proposals[i] = *p
+	}
+	return proposals
+}
+
+// Approve applies a pending proposal to its live strategy
+func (o *Reoptimizer) Approve(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	p, err := o.pending(id)
+	if err != nil {
+		return err
+	}
+	instance, err := o.registry.Get(p.Strategy)
+	if err != nil {
+		return err
+	}
+
+	instance.SetParams(p.Proposed.Params)
+	p.Status, p.Decided = ProposalApplied, time.Now()
+	logger.Info("Applied parameters %v to %s", p.Proposed.Params, p.Strategy)
+	return nil
+}
+
+// Reject discards a pending proposal
+func (o *Reoptimizer) Reject(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	p, err := o.pending(id)
+	if err != nil {
+		return err
+	}
+	p.Status, p.Decided = ProposalRejected, time.Now()
+	return nil
+}
+
+// pending returns a pending proposal by ID; callers hold mu
+func (o *Reoptimizer) pending(id string) (*Proposal, error) {
+	for _, p := range o.proposals {
+		if p.ID == id {
+			if p.Status != ProposalPending {
+				return nil, fmt.Errorf("proposal %s: %w", id, ErrProposalNotPending)
+			}
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("proposal %s not found", id)
+}
@@ -0,0 +1,370 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nofx/indicators"
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/strategy"
+)
+
+// ErrUnknownAccount is returned when no shadow account has the requested name
+var ErrUnknownAccount = errors.New("unknown shadow account")
+
+const (
+	// shadowFetch is how many recent candles each evaluation reads per strategy
+	shadowFetch = 100
+	// shadowCurve is how many equity points an account keeps
+	shadowCurve = 1000
+)
+
+// ShadowStrategy represents a strategy of a virtual account's mix; Weight is
+// the fraction of the account's capital it trades
+type ShadowStrategy struct {
+	Strategy string          `json:"strategy"`
+	Pair     string          `json:"pair"`
+	Interval string          `json:"interval"`
+	Params   strategy.Params `json:"params"`
+	Weight   float64         `json:"weight"`
+}
+
+// ShadowAccountConfig represents a virtual account and its strategy mix
+type ShadowAccountConfig struct {
+	Name       string
+	Capital    float64
+	Strategies []ShadowStrategy
+}
+
+// ShadowLeg represents the paper performance of one strategy of an account
+type ShadowLeg struct {
+	ShadowStrategy
+	Warm     bool            `json:"warm"`
+	Position strategy.Signal `json:"position"`
+	Return   float64         `json:"return"`
+	Trades   int             `json:"trades"`
+	Funding  float64         `json:"funding"`
+	Updated  time.Time       `json:"updated,omitempty"`
+}
+
+// ShadowPoint represents the equity of an account at an evaluation
+type ShadowPoint struct {
+	Time   time.Time `json:"time"`
+	Equity float64   `json:"equity"`
+}
+
+// ShadowAccount represents the paper performance of a virtual account; the
+// equity curve is only filled in when a single account is requested
+type ShadowAccount struct {
+	Name        string        `json:"name"`
+	Rank        int           `json:"rank"`
+	Capital     float64       `json:"capital"`
+	Equity      float64       `json:"equity"`
+	Return      float64       `json:"return"`
+	MaxDrawdown float64       `json:"max_drawdown"`
+	Sharpe      float64       `json:"sharpe"`
+	Trades      int           `json:"trades"`
+	Started     time.Time     `json:"started"`
+	Legs        []ShadowLeg   `json:"legs"`
+	Curve       []ShadowPoint `json:"curve,omitempty"`
+}
+
+// shadowLeg is the simulation state of a strategy: its own instance, fed the
+// closed candles, and its equity as a multiple of its allocation
+type shadowLeg struct {
+	cfg       ShadowStrategy
+	instance  *strategy.Instance
+	position  strategy.Signal
+	equity    float64
+	trades    int
+	funding   float64
+	last      int64
+	lastClose float64
+	updated   time.Time
+}
+
+// shadowAccount is the simulation state of a virtual account
+type shadowAccount struct {
+	name    string
+	capital float64
+	legs    []*shadowLeg
+	peak    float64
+	maxDD   float64
+	curve   []ShadowPoint
+	started time.Time
+}
+
+// equity returns the account equity: the unallocated capital plus every
+// strategy's allocation grown by its return
+func (a *shadowAccount) equity() float64 {
+	total := a.capital
+	for _, leg := range a.legs {
+		total += a.capital * leg.cfg.Weight * (leg.equity - 1)
+	}
+	return total
+}
+
+// ShadowBook runs virtual accounts side by side: each trades its strategy
+// mix on paper against the live candles with the backtest's fill model,
+// the signal at each close held until the next close, so configurations
+// can be compared on the same data before any gets real capital
+type ShadowBook struct {
+	candles CandleSource
+	funding FundingSource
+	feeBps  float64
+
+	mu       sync.Mutex
+	accounts []*shadowAccount
+	stop     chan struct{}
+}
+
+// NewShadowBook creates the virtual accounts and warms their strategies up;
+// funding may be nil to trade without funding costs
+func NewShadowBook(accounts []ShadowAccountConfig, candles CandleSource, funding FundingSource, feeBps float64) (*ShadowBook, error) {
+	b := &ShadowBook{candles: candles, funding: funding, feeBps: feeBps}
+	now := time.Now()
+	for _, cfg := range accounts {
+		account := &shadowAccount{name: cfg.Name, capital: cfg.Capital, peak: cfg.Capital, started: now}
+		for _, sc := range cfg.Strategies {
+			s, err := strategy.Lookup(sc.Strategy)
+			if err != nil {
+				return nil, fmt.Errorf("shadow account %s: %w", cfg.Name, err)
+			}
+			leg := &shadowLeg{
+				cfg:      sc,
+				instance: strategy.NewInstance(s, sc.Pair, sc.Interval, sc.Params.Clone()),
+				equity:   1,
+			}
+			if err := leg.instance.WarmUp(candles); err != nil {
+				logger.Warning("Shadow account %s: failed to warm up %s, waiting for live data: %v",
+					cfg.Name, leg.instance.Name(), err)
+			}
+			// Trading starts with the next candle to close
+			if closed, err := closedCandles(candles, sc.Pair, sc.Interval); err == nil && len(closed) > 0 {
+				c := closed[len(closed)-1]
+				leg.last, leg.lastClose = c.Timestamp, c.Close
+			}
+			account.legs = append(account.legs, leg)
+		}
+		account.curve = []ShadowPoint{{Time: now, Equity: cfg.Capital}}
+		b.accounts = append(b.accounts, account)
+	}
+	return b, nil
+}
+
+// closedCandles returns the recent closed candles of a pair; the newest
+// candle is still forming and is evaluated once the next one opens
+func closedCandles(source CandleSource, pair, interval string) ([]market.CandleData, error) {
+	candles, err := source.Get(pair, interval, shadowFetch)
+	if err != nil {
+		return nil, err
+	}
+	if len(candles) == 0 {
+		return nil, nil
+	}
+	return candles[:len(candles)-1], nil
+}
+
+// Start evaluates the accounts periodically in the background
+func (b *ShadowBook) Start(interval time.Duration) {
+	b.mu.Lock()
+	if b.stop != nil {
+		b.mu.Unlock()
+		return
+	}
+	b.stop = make(chan struct{})
+	stop := b.stop
+	b.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.Run()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the evaluation
+func (b *ShadowBook) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+}
+
+// Run trades every account over the candles closed since the last run
+func (b *ShadowBook) Run() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for _, account := range b.accounts {
+		for _, leg := range account.legs {
+			if err := b.advance(leg); err != nil {
+				logger.Warning("Shadow account %s: failed to update %s: %v", account.name, leg.instance.Name(), err)
+			}
+		}
+		equity := account.equity()
+		if equity > account.peak {
+			account.peak = equity
+		}
+		if dd := 1 - equity/account.peak; dd > account.maxDD {
+			account.maxDD = dd
+		}
+		account.curve = append(account.curve, ShadowPoint{Time: now, Equity: equity})
+		if n := len(account.curve); n > shadowCurve {
+			account.curve = account.curve[n-shadowCurve:]
+		}
+	}
+}
+
+// advance settles a strategy over its newly closed candles: the held
+// position earns the bar's return and pays its funding, then the signal at
+// the close sets the next position, paying feeBps on every change
+func (b *ShadowBook) advance(leg *shadowLeg) error {
+	closed, err := closedCandles(b.candles, leg.cfg.Pair, leg.cfg.Interval)
+	if err != nil {
+		return err
+	}
+	fresh := closed[:0:0]
+	for _, c := range closed {
+		if c.Timestamp > leg.last {
+			fresh = append(fresh, c)
+		}
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	var funding []market.FundingRate
+	if b.funding != nil && leg.lastClose != 0 {
+		funding, err = b.funding.Rates(leg.cfg.Pair, time.Unix(leg.last+1, 0), time.Unix(fresh[len(fresh)-1].Timestamp+1, 0))
+		if err != nil {
+			logger.Warning("Failed to get funding rates of %s, trading without funding: %v", leg.cfg.Pair, err)
+			funding = nil
+		}
+	}
+
+	next := 0
+	for _, c := range fresh {
+		if leg.lastClose != 0 {
+			r := float64(leg.position) * (c.Close/leg.lastClose - 1)
+			for ; next < len(funding) && funding[next].Time <= c.Timestamp; next++ {
+				paid := float64(leg.position) * funding[next].Rate
+				r -= paid
+				leg.funding -= paid
+			}
+			leg.equity *= 1 + r
+		}
+
+		signal, ok := leg.instance.Update(c)
+		if !ok {
+			signal = strategy.Flat
+		}
+		if signal != leg.position {
+			leg.equity *= 1 - math.Abs(float64(signal-leg.position))*b.feeBps/10000
+			if signal != strategy.Flat {
+				leg.trades++
+			}
+			leg.position = signal
+		}
+		leg.last, leg.lastClose = c.Timestamp, c.Close
+	}
+	leg.updated = time.Now()
+	return nil
+}
+
+// Accounts returns the accounts ranked from best to worst return, without
+// their equity curves
+func (b *ShadowBook) Accounts() []ShadowAccount {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	accounts := make([]ShadowAccount, 0, len(b.accounts))
+	for _, a := range b.accounts {
+		accounts = append(accounts, a.summary())
+	}
+	sort.SliceStable(accounts, func(i, j int) bool { return accounts[i].Return > accounts[j].Return })
+	for i := range accounts {
+		accounts[i].Rank = i + 1
+	}
+	return accounts
+}
+
+// Account returns an account with its equity curve
+func (b *ShadowBook) Account(name string) (ShadowAccount, error) {
+	for _, a := range b.Accounts() {
+		if a.Name == name {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			a.Curve = append([]ShadowPoint(nil), b.find(name).curve...)
+			return a, nil
+		}
+	}
+	return ShadowAccount{}, fmt.Errorf("%w: %s", ErrUnknownAccount, name)
+}
+
+// find returns the account named name, nil when there is none. The caller
+// must hold the lock.
+func (b *ShadowBook) find(name string) *shadowAccount {
+	for _, a := range b.accounts {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// summary returns the performance of the account; the Sharpe ratio is
+// computed over the returns between evaluations. The caller must hold the lock.
+func (a *shadowAccount) summary() ShadowAccount {
+	equity := a.equity()
+	s := ShadowAccount{
+		Name:        a.name,
+		Capital:     a.capital,
+		Equity:      equity,
+		Return:      equity/a.capital - 1,
+		MaxDrawdown: a.maxDD,
+		Started:     a.started,
+		Legs:        make([]ShadowLeg, 0, len(a.legs)),
+	}
+
+	returns := make([]float64, 0, len(a.curve))
+	for i := 1; i < len(a.curve); i++ {
+		if prev := a.curve[i-1].Equity; prev != 0 {
+			returns = append(returns, a.curve[i].Equity/prev-1)
+		}
+	}
+	if sd := indicators.StdDev(returns); sd > 0 {
+		s.Sharpe = indicators.Mean(returns) / sd * math.Sqrt(float64(len(returns)))
+	}
+
+	for _, leg := range a.legs {
+		cfg := leg.cfg
+		cfg.Params = cfg.Params.Clone()
+		s.Legs = append(s.Legs, ShadowLeg{
+			ShadowStrategy: cfg,
+			Warm:           leg.instance.Warm(),
+			Position:       leg.position,
+			Return:         leg.equity - 1,
+			Trades:         leg.trades,
+			Funding:        leg.funding,
+			Updated:        leg.updated,
+		})
+		s.Trades += leg.trades
+	}
+	return s
+}
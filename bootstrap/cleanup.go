@@ -0,0 +1,68 @@
+package bootstrap
+
+import (
+	"context"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// cleanupAttempts is how many times a failed orphan cancellation is retried
+const cleanupAttempts = 3
+
+// cleanupOrphanOrders cancels open orders that carry one of our client order
+// ID prefixes but are unknown to the persisted registry, i.e. orphans left behind
+// by a crashed run. Canceling is idempotent, so the cleanup is safe to retry.
+func (ctx *Context) cleanupOrphanOrders() {
+	t := ctx.DefaultTrader()
+	if t == nil || ctx.Orders == nil {
+		return
+	}
+
+	background := context.Background()
+	canceled := 0
+	for _, pair := range ctx.Config.Trading.Pairs {
+		orders, err := t.GetOrders(background, pair, trader.OrderStatusNew)
+		if err != nil {
+			logger.Error("Startup cleanup failed to list open orders for %s: %v", pair, err)
+			continue
+		}
+
+		for _, order := range orders {
+			if !ctx.OrderTag.Owns(order.ClientOrderID) {
+				continue
+			}
+			if tracked, ok := ctx.Orders.Lookup(order.ClientOrderID); ok {
+				if tracked.Intent != "" {
+					logger.Info("Startup cleanup kept order %s (%s) on %s placed for %s",
+						order.ID, order.ClientOrderID, pair, tracked.Intent)
+				}
+				continue
+			}
+
+			if err := cancelWithRetry(background, t, order.ID); err != nil {
+				logger.Error("Startup cleanup failed to cancel orphan order %s (%s) on %s: %v",
+					order.ID, order.ClientOrderID, pair, err)
+				continue
+			}
+			logger.Info("Startup cleanup canceled orphan order %s (%s) on %s: %s %s %.8f @ %.8f",
+				order.ID, order.ClientOrderID, pair, order.Side, order.Type, order.Amount, order.Price)
+			canceled++
+		}
+	}
+
+	logger.Info("Startup cleanup completed, %d orphan orders canceled", canceled)
+}
+
+// cancelWithRetry cancels an order, retrying transient failures
+func cancelWithRetry(ctx context.Context, t trader.Trader, orderID string) error {
+	var err error
+	for attempt := 0; attempt < cleanupAttempts; attempt++ {
+		if err = t.CancelOrder(ctx, orderID); err == nil {
+			return nil
+		}
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+	}
+	return err
+}
@@ -1,20 +1,127 @@
 package bootstrap
 
 import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nofx/backtest"
 	"github.com/nofx/config"
+	"github.com/nofx/crypto"
+	"github.com/nofx/execution"
+	"github.com/nofx/journal"
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/metrics"
+	"github.com/nofx/monitor"
+	"github.com/nofx/notify"
+	"github.com/nofx/pnl"
+	"github.com/nofx/ratelimit"
+	"github.com/nofx/report"
+	"github.com/nofx/risk"
+	"github.com/nofx/scheduler"
+	"github.com/nofx/storage"
+	"github.com/nofx/strategy"
+	"github.com/nofx/trader"
 )
 
+// tickerShards is the number of ticker fan-out shards
+const tickerShards = 16
+
+// instrumentListingTTL is how long the contract listings searched for
+// instruments are cached
+const instrumentListingTTL = 10 * time.Minute
+
 // Context holds application-wide dependencies
 type Context struct {
 	Config     *config.Config
-	TraderManager interface{}
-	MarketMonitor interface{}
+	TraderManager *trader.Manager
+	MarketMonitor *monitor.MarketMonitor
+	MarketClient *market.APIClient
+	Contracts  *market.ContractCache
+	Instruments *market.InstrumentIndex
+	Depth      *market.DepthCalculator
+	Screener   *market.Screener
+	Announcements *market.AnnouncementMonitor
+	Candles    *market.CandleStore
+	Downloader *market.CandleDownloader
+	FundingHistory *market.FundingHistory
+	Compactor  *market.CandleCompactor
+	Events     *market.EventBus
+	Patterns   *market.PatternDetector
+	Levels     *market.LevelService
+	Regimes    *market.RegimeService
+	Correlations *market.CorrelationService
+	OrderBooks *market.OrderBookManager
+	BookStream *market.OrderBookStream
+	Tickers    *market.TickerFanout
+	TickerStream *market.TickerStream
+	Bars       *market.BarBuilder
+	TradeStream *market.TradeStream
+	Risk       *risk.Engine
+	Limits     *risk.Limiter
+	VaR        *risk.VaRCalculator
+	Volatility *risk.VolatilityLeverage
+	ProfileSchedule *risk.ProfileScheduler
+	Cache      *trader.Cache
+	Caches     map[string]*trader.Cache
+	CloseGuard *trader.SlippageGuard
+	Orders     *trader.OrderRegistry
+	OrderTag   *trader.OrderTag
+	Journal    *journal.Journal
+	Store      *storage.Store
+	DriftMonitor *monitor.DriftMonitor
+	Brackets   *monitor.BracketMonitor
+	Trailing   *monitor.TrailingMonitor
+	Intents    *monitor.IntentMonitor
+	Flattener  *monitor.Flattener
+	Aging      *monitor.AgingMonitor
+	Dust       *monitor.DustCleaner
+	DailyReport *report.DailyReporter
+	Activity   *report.Activity
+	PnL        *pnl.Engine
+	TCA        *report.TCA
+	Strategies *strategy.Registry
+	PaperStrategies *strategy.Registry
+	Promoter   *backtest.Promoter
+	Reoptimizer *backtest.Reoptimizer
+	Shadow      *backtest.ShadowBook
+	RateLimits *ratelimit.Limiter
+	Funding    *execution.FundingTimer
+	Sizer      *execution.Sizer
+	Replicator *execution.Replicator
+	Alerts     *execution.AlertRouter
+	Metrics    *metrics.Registry
+	Scheduler  *scheduler.Scheduler
+	Notifier   *notify.Dispatcher
+
+	warmed         chan struct{}
+	started        time.Time
+	heartbeat      heartbeat
+	reconciliation reconciliation
+	fleet          fleet
+
+	// screenerTicks feeds the screener at the configured ticker rate
+	screenerTicks *market.TickerSubscription
 }
 
 // NewContext creates a new bootstrap context
 func NewContext(cfg *config.Config) (*Context, error) {
 	ctx := &Context{
 		Config: cfg,
+		Journal: journal.New(),
+		Metrics: metrics.NewRegistry(),
+		warmed: make(chan struct{}),
+		started: time.Now(),
+	}
+
+	// Overlay the fleet leader's configuration before anything reads it
+	if err := ctx.initializeFleet(); err != nil {
+		return nil, err
+	}
+
+	if ctx.WatchOnly() {
+		logger.Info("Watch-only mode: order placement is disabled")
 	}
 
 	// Initialize components
@@ -22,32 +129,905 @@ func NewContext(cfg *config.Config) (*Context, error) {
 		return nil, err
 	}
 
+	// Cancel orphan orders from a previous run before anything trades
+	if cfg.Trading.StartupOrderCleanup && !ctx.WatchOnly() {
+		ctx.cleanupOrphanOrders()
+	}
+
+	// Match exchange orders and positions against the store before trading resumes
+	if mode := cfg.Trading.StartupReconcile; mode != "" {
+		ctx.reconcile(mode)
+	}
+
+	if interval := cfg.Monitor.HeartbeatInterval; interval > 0 {
+		ctx.startHeartbeat(time.Duration(interval) * time.Second)
+	}
+
+	if cfg.Server.HotReload {
+		if err := ctx.watchConfig(); err != nil {
+			logger.Warning("Configuration hot reload disabled: %v", err)
+		}
+	}
+
+	if cfg.Fleet.Role == "follower" {
+		ctx.startFleetSync(time.Duration(cfg.Fleet.Interval) * time.Second)
+	}
+
 	return ctx, nil
 }
 
+// WatchOnly reports whether the instance only monitors the accounts, as
+// configured or forced by a watchonly build; order placement is disabled
+// and the jobs placing orders aren't started
+func (ctx *Context) WatchOnly() bool {
+	return ctx.Config.Trading.WatchOnly || trader.WatchOnlyBuild
+}
+
 // initializeComponents initializes all application components
 func (ctx *Context) initializeComponents() error {
+	// Initialize market data client
+	if err := ctx.initializeMarketClient(); err != nil {
+		return err
+	}
+
+	// Initialize history store
+	if err := ctx.initializeStorage(); err != nil {
+		return err
+	}
+
+	// Initialize risk engine, which the trader guards check entries with
+	if err := ctx.initializeRisk(); err != nil {
+		return err
+	}
+
 	// Initialize trader manager
 	if err := ctx.initializeTraderManager(); err != nil {
 		return err
 	}
 
+	// Warm the trader caches before the monitors, strategies and jobs start
+	ctx.Warm()
+
+	// Initialize notification channels
+	if err := ctx.initializeNotifications(); err != nil {
+		return err
+	}
+
 	// Initialize market monitor
 	if err := ctx.initializeMarketMonitor(); err != nil {
 		return err
 	}
 
+	// Initialize balance drift monitor
+	if err := ctx.initializeDriftMonitor(); err != nil {
+		return err
+	}
+
+	// Initialize bracket integrity monitor
+	if err := ctx.initializeBracketMonitor(); err != nil {
+		return err
+	}
+
+	// Initialize trailing stop emulation
+	if err := ctx.initializeTrailingStops(); err != nil {
+		return err
+	}
+
+	// Initialize funding timing of strategy orders
+	ctx.initializeFunding()
+
+	// Initialize conditional trade intents
+	if err := ctx.initializeIntents(); err != nil {
+		return err
+	}
+
+	// Initialize copy trading of signal sources
+	ctx.initializeReplication()
+
+	// Initialize the TradingView alert webhook
+	ctx.initializeAlerts()
+
+	// Initialize exchange announcement feeds
+	if err := ctx.initializeAnnouncements(); err != nil {
+		return err
+	}
+
+	// Initialize end-of-day flatten
+	if err := ctx.initializeFlattener(); err != nil {
+		return err
+	}
+
+	// Initialize time-based exits
+	if err := ctx.initializeTimeStops(); err != nil {
+		return err
+	}
+
+	// Initialize daily report
+	if err := ctx.initializeDailyReport(); err != nil {
+		return err
+	}
+
+	// Initialize strategies
+	if err := ctx.initializeStrategies(); err != nil {
+		return err
+	}
+
+	// Initialize scheduled jobs
+	if err := ctx.initializeScheduler(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// initializeTraderManager initializes the trader manager
+// initializeMarketClient initializes the market data client and contract metadata cache
+func (ctx *Context) initializeMarketClient() error {
+	ctx.RateLimits = ratelimit.New(ctx.Config.API, ctx.Metrics)
+	ctx.MarketClient = market.NewAPIClient(ctx.Config.API.BaseURL, "", "")
+	ctx.MarketClient.Limiter = ctx.RateLimits
+	ctx.MarketClient.Retry = ctx.retryPolicy()
+	ctx.Contracts = market.NewContractCache(ctx.MarketClient)
+	ctx.Depth = market.NewDepthCalculator(ctx.MarketClient)
+	ctx.Screener = market.NewScreener(ctx.MarketClient, time.Minute)
+	ctx.Candles = market.NewCandleStore(ctx.MarketClient)
+	if dir := ctx.Config.Candles.CacheDir; dir != "" {
+		ctx.Downloader = market.NewCandleDownloader(ctx.MarketClient, dir)
+		ctx.Candles.SetDownloader(ctx.Downloader)
+	}
+	ctx.FundingHistory = market.NewFundingHistory(ctx.MarketClient, ctx.Config.Candles.CacheDir)
+	if cfg := ctx.Config.Candles; cfg.CompactInterval > 0 {
+		ctx.Compactor = market.NewCandleCompactor(ctx.Candles, []market.CompactionTier{
+			{From: "1m", To: "5m", Retain: time.Duration(cfg.Retention1m) * time.Hour},
+			{From: "5m", To: "1h", Retain: time.Duration(cfg.Retention5m) * 24 * time.Hour},
+			{From: "1h", To: "1d", Retain: time.Duration(cfg.Retention1h) * 24 * time.Hour},
+		}, time.Duration(cfg.CompactInterval)*time.Minute)
+		ctx.Compactor.Start()
+	}
+	ctx.Events = market.NewEventBus()
+	ctx.Patterns = market.NewPatternDetector(ctx.Candles, ctx.Events)
+	if interval := ctx.Config.Candles.PatternInterval; interval != "" && len(ctx.Config.Trading.Pairs) > 0 {
+		if err := ctx.Patterns.Start(ctx.Config.Trading.Pairs, interval); err != nil {
+			return fmt.Errorf("candles.pattern_interval: %w", err)
+		}
+	}
+	ctx.Levels = market.NewLevelService(ctx.Candles)
+	ctx.Regimes = market.NewRegimeService(ctx.Candles)
+	ctx.Correlations = market.NewCorrelationService(ctx.Candles)
+	ctx.OrderBooks = market.NewOrderBookManager(ctx.MarketClient)
+	if ctx.Config.API.StreamURL != "" && len(ctx.Config.Trading.Pairs) > 0 {
+		ctx.BookStream = market.NewOrderBookStream(ctx.Config.API.StreamURL, ctx.websocketOptions(),
+			ctx.Config.Trading.Pairs, ctx.OrderBooks)
+		ctx.BookStream.Start()
+	}
+
+	ctx.Tickers = market.NewTickerFanout(tickerShards)
+	pairs := ctx.Config.API.TickerPairs
+	if len(pairs) == 0 {
+		pairs = ctx.Config.Trading.Pairs
+	}
+	ctx.Screener.Watch(pairs...)
+	if ctx.Config.API.StreamURL != "" && len(pairs) > 0 {
+		ctx.TickerStream = market.NewTickerStream(ctx.Config.API.StreamURL, ctx.websocketOptions(),
+			pairs, ctx.Tickers)
+		ctx.TickerStream.Start()
+		ctx.screenerTicks = ctx.Tickers.Subscribe(pairs, ctx.Config.API.TickerMaxRate)
+		go ctx.screenerTicks.Run(ctx.Screener.Update)
+	}
+
+	// Live bars are built from trades rather than polled from the candle endpoint
+	if intervals := ctx.Config.API.BarIntervals; ctx.Config.API.StreamURL != "" && len(intervals) > 0 {
+		ctx.Bars = market.NewBarBuilder(intervals, ctx.Candles, ctx.Events)
+		ctx.TradeStream = market.NewTradeStream(ctx.Config.API.StreamURL, ctx.websocketOptions(),
+			pairs, ctx.Bars.AddTrade)
+		ctx.Bars.OnPair = func(pair string) {
+			if err := ctx.TradeStream.Subscribe(pair); err != nil {
+				logger.Warning("Failed to subscribe to the trades of %s: %v", pair, err)
+			}
+		}
+		ctx.Bars.Start()
+		ctx.TradeStream.Start()
+	}
+	return nil
+}
+
+// websocketOptions returns the configured websocket dial settings
+func (ctx *Context) websocketOptions() market.WSOptions {
+	cfg := ctx.Config.API.Websocket
+	return market.WSOptions{
+		Proxy:            cfg.Proxy,
+		Headers:          cfg.Headers,
+		PingInterval:     time.Duration(cfg.PingInterval) * time.Second,
+		HandshakeTimeout: time.Duration(cfg.HandshakeTimeout) * time.Second,
+		Compression:      cfg.Compression,
+		StaleAfter:       time.Duration(cfg.StaleAfter) * time.Second,
+		Metrics:          ctx.Metrics,
+	}
+}
+
+// initializeStorage opens the history store when a database is configured
+func (ctx *Context) initializeStorage() error {
+	cfg := ctx.Config.Database
+	if cfg.Driver == "" {
+		return nil
+	}
+
+	store, err := storage.Open(cfg)
+	if err != nil {
+		return err
+	}
+	ctx.Store = store
+	logger.Info("History store opened (%s)", cfg.Driver)
+
+	// Compacted candles persist in the history store
+	ctx.Candles.SetArchive(store)
+
+	if path := ctx.Config.Security.AuditKeyPath; path != "" {
+		key, err := crypto.LoadKey(path)
+		if err != nil {
+			return err
+		}
+		if err := store.EnableAudit(key, storage.AuditHeadPath(path)); err != nil {
+			return err
+		}
+		logger.Info("Order audit trail enabled")
+	}
+
+	// Trade annotations live in the journal and persist in the history store
+	return ctx.Journal.SetAnnotationStore(store)
+}
+
+// initializeTraderManager registers a trader for every configured exchange
+// and selects the default one
 func (ctx *Context) initializeTraderManager() error {
-	// Implementation will be added
+	ctx.TraderManager = trader.NewManager()
+	ctx.Caches = make(map[string]*trader.Cache)
+
+	// Register in name order so the fallback default is deterministic
+	names := make([]string, 0, len(ctx.Config.Exchanges))
+	for name := range ctx.Config.Exchanges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	trading := ctx.Config.Trading
+	ctx.OrderTag = trader.NewOrderTag(trading.ClientOrderPrefix, trading.StrategyOrderPrefixes)
+	ctx.Limits = risk.NewLimiter(ctx.Config.Risk, ctx.Screener)
+	ctx.ProfileSchedule = risk.NewProfileScheduler(ctx.Limits, ctx.Config.Risk.ProfileSchedule)
+	ctx.ProfileSchedule.Start()
+	// The PnL ledger replays the recorded fills and funding payments
+	ctx.Instruments = market.NewInstrumentIndex(instrumentListingTTL)
+	if ctx.Store != nil {
+		ctx.PnL = pnl.NewEngine(ctx.Store, ctx.Instruments, ctx.Screener, ctx.Config.Strategy.BacktestFeeBps/10000)
+		ctx.Limits.SetPnLSource(ctx.PnL)
+		ctx.Limits.SetBaselineStore(ctx.Store)
+	}
+	dust := ctx.Config.Monitor
+	ctx.Dust = monitor.NewDustCleaner(ctx.TraderManager, ctx.Contracts, monitor.DustAction(dust.DustAction),
+		time.Duration(dust.DustCheckInterval)*time.Second)
+
+	// Strategies opting in send entry orders of varied size and timing
+	var randomizer *execution.Randomizer
+	if policies := ctx.Config.Strategy.Randomize; len(policies) > 0 {
+		var audit execution.Auditor
+		if ctx.Store != nil {
+			audit = ctx.Store
+		}
+		randomized := make(map[string]execution.RandomizePolicy, len(policies))
+		for name, r := range policies {
+			randomized[name] = execution.RandomizePolicy{
+				Size:  r.SizeJitter,
+				Delay: time.Duration(r.TimingJitter) * time.Second,
+			}
+		}
+		randomizer = execution.NewRandomizer(ctx.Contracts, randomized, audit)
+	}
+
+	// Entries on pairs whose volatility spiked trade at reduced leverage
+	if r := ctx.Config.Risk; r.VolatilityThreshold > 0 && !ctx.WatchOnly() {
+		ctx.Volatility = risk.NewVolatilityLeverage(ctx.Candles, risk.VolatilityPolicy{
+			Interval:  r.VolatilityInterval,
+			Window:    r.VolatilityWindow,
+			Threshold: r.VolatilityThreshold,
+			Restore:   r.VolatilityRestore,
+			Factor:    r.VolatilityLeverageFactor,
+		}, trading.DefaultLeverage, trading.Pairs)
+		ctx.Volatility.Start(time.Duration(r.VolatilityCheckInterval) * time.Second)
+	}
+
+	for _, name := range names {
+		t, err := newTrader(name, ctx.Config.Exchanges[name])
+		if err != nil {
+			return err
+		}
+		// Venues without a listing of their own trade the market data
+		// contracts, as they list them when they tell how they settle
+		switch venue := t.(type) {
+		case market.ContractLister:
+			ctx.Instruments.Add(name, venue)
+		case interface {
+			Contracts(market.ContractLister) market.ContractLister
+		}:
+			ctx.Instruments.Add(name, venue.Contracts(ctx.Contracts))
+		default:
+			ctx.Instruments.Add(name, ctx.Contracts)
+		}
+		ctx.configureTrader(name, t)
+		if ctx.Store != nil {
+			recorder := storage.NewRecorder(name, t, ctx.Store, ctx.OrderTag,
+				time.Duration(ctx.Config.Database.SnapshotInterval)*time.Minute)
+			// The drift monitor compares balance changes with the journal
+			recorder.SetJournal(ctx.Journal, ctx.PnL)
+			recorder.Start()
+			t = recorder
+		}
+		// Pending dust folds into new entries, which the limits see unchanged
+		if monitor.DustAction(dust.DustAction) == monitor.DustMerge {
+			t = ctx.Dust.Wrap(name, t)
+		}
+		// Limits wrap the recorder so rejected orders never reach the history
+		guard := risk.NewGuard(name, t, ctx.Limits, ctx.Risk, ctx.Instruments.Venue(name))
+		guard.Start(time.Minute)
+		// Operations on one contract run one at a time, risk checks included
+		t = trader.NewSymbolLocks(guard)
+		// The leverage is adjusted under the symbol lock of the entry
+		if ctx.Volatility != nil {
+			t = ctx.Volatility.Wrap(name, t)
+		}
+		// Randomized orders wait out their delay before taking the lock
+		if randomizer != nil {
+			t = randomizer.Wrap(name, t)
+		}
+		// Watch-only traders never reach the exchange with a trading call
+		if ctx.WatchOnly() {
+			t = trader.NewWatchOnly(t)
+		}
+		ctx.TraderManager.Register(name, t)
+		cache := trader.NewCache(t, trader.DefaultCacheTTL, ctx.Config.Risk.SettleCurrency)
+		cache.Start()
+		ctx.Caches[name] = cache
+		logger.Info("Registered %s trader", name)
+	}
+
+	if name := ctx.Config.Trading.DefaultExchange; name != "" {
+		if err := ctx.TraderManager.SetDefault(name); err != nil {
+			return err
+		}
+	}
+
+	ctx.Cache = ctx.Caches[ctx.TraderManager.DefaultName()]
+
+	orders, err := trader.LoadOrderRegistry(trading.OrderStatePath)
+	if err != nil {
+		return err
+	}
+	ctx.Orders = orders
+
+	ctx.CloseGuard = trader.NewSlippageGuard(trading.CloseMaxSlippageBps,
+		time.Duration(trading.CloseLimitTimeout)*time.Second)
+	if dust.DustCheckInterval > 0 && !ctx.WatchOnly() {
+		ctx.Dust.Start()
+	}
 	return nil
 }
 
-// initializeMarketMonitor initializes the market monitor
+// initializeMarketMonitor initializes the market monitor evaluating unrealized PnL alerts
 func (ctx *Context) initializeMarketMonitor() error {
-	// Implementation will be added
+	cfg := ctx.Config.Monitor
+	thresholds := monitor.PnLThresholds{
+		Global:    monitor.PnLThreshold{LossAmount: cfg.PnLLossAmount, LossPercent: cfg.PnLLossPercent},
+		Positions: make(map[string]monitor.PnLThreshold, len(cfg.PnLThresholds)),
+
+		LiquidationDistance: cfg.LiquidationDistance,
+	}
+	for pair, t := range cfg.PnLThresholds {
+		thresholds.Positions[pair] = monitor.PnLThreshold{LossAmount: t.LossAmount, LossPercent: t.LossPercent}
+	}
+
+	ctx.MarketMonitor = monitor.NewMarketMonitor(ctx.TraderManager, time.Duration(cfg.PnLCheckInterval)*time.Second, thresholds)
+	ctx.MarketMonitor.OnAlert = ctx.notifyAlerts(ctx.MarketMonitor.OnAlert)
+	if cfg.PnLCheckInterval > 0 {
+		ctx.MarketMonitor.Start()
+	}
+	return nil
+}
+
+// initializeRisk initializes the risk engine
+func (ctx *Context) initializeRisk() error {
+	engine, err := risk.NewEngine(ctx.Config.Risk, ctx.Screener)
+	if err != nil {
+		return err
+	}
+	ctx.Risk = engine
+
+	cfg := ctx.Config.Risk
+	ctx.VaR = risk.NewVaRCalculator(ctx.Candles, cfg.VaRConfidence, cfg.VaRInterval, cfg.VaRWindow)
+
+	if cfg.MaxBucketNotional > 0 && len(ctx.Config.Trading.Pairs) > 1 {
+		go ctx.refreshCorrelationBuckets()
+	}
+	return nil
+}
+
+// refreshCorrelationBuckets periodically rebuilds the risk engine's
+// correlation buckets from the watched pairs
+func (ctx *Context) refreshCorrelationBuckets() {
+	cfg := ctx.Config.Risk
+	refresh := func() {
+		matrix, err := ctx.Correlations.Matrix(ctx.Config.Trading.Pairs, cfg.CorrelationInterval, cfg.CorrelationWindow)
+		if err != nil {
+			logger.Warning("Failed to refresh correlation buckets: %v", err)
+			return
+		}
+		buckets := matrix.Buckets(cfg.CorrelationThreshold)
+		ctx.Risk.SetCorrelationBuckets(buckets)
+		logger.Debug("Correlation buckets refreshed: %v", buckets)
+	}
+
+	refresh()
+	ticker := time.NewTicker(time.Duration(cfg.CorrelationRefresh) * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		refresh()
+	}
+}
+
+// initializeDriftMonitor starts the balance drift monitor when enabled
+func (ctx *Context) initializeDriftMonitor() error {
+	cfg := ctx.Config.Monitor
+	if !cfg.BalanceDriftEnabled {
+		return nil
+	}
+
+	t := ctx.DefaultTrader()
+	if t == nil {
+		logger.Warning("Balance drift monitor enabled but no trader is configured")
+		return nil
+	}
+
+	interval := time.Duration(cfg.BalanceDriftInterval) * time.Second
+	ctx.DriftMonitor = monitor.NewDriftMonitor(t, ctx.Journal, interval, cfg.BalanceDriftTolerance)
+	ctx.DriftMonitor.OnAlert = ctx.notifyAlerts(ctx.DriftMonitor.OnAlert)
+	ctx.DriftMonitor.Start()
+	return nil
+}
+
+// initializeBracketMonitor starts the bracket integrity monitor when enabled
+func (ctx *Context) initializeBracketMonitor() error {
+	interval := ctx.Config.Monitor.BracketCheckInterval
+	t := ctx.DefaultTrader()
+	if interval <= 0 || t == nil || ctx.WatchOnly() {
+		return nil
+	}
+
+	ctx.Brackets = monitor.NewBracketMonitor(t, ctx.OrderTag, time.Duration(interval)*time.Second)
+	ctx.Brackets.OnAlert = ctx.notifyAlerts(ctx.Brackets.OnAlert)
+	ctx.Brackets.Start()
+	return nil
+}
+
+// initializeTrailingStops initializes the client-side trailing stops used on
+// exchanges without native support
+func (ctx *Context) initializeTrailingStops() error {
+	interval := ctx.Config.Monitor.TrailingCheckInterval
+	if interval <= 0 {
+		interval = 5
+	}
+
+	priceType := trader.TriggerPriceType(ctx.Config.Trading.TriggerPriceType)
+	ctx.Trailing = monitor.NewTrailingMonitor(ctx.TraderManager, ctx.Screener, priceType, time.Duration(interval)*time.Second)
+	ctx.Trailing.Start()
+	return nil
+}
+
+// initializeFunding sets up the per-strategy timing of entries and exits
+// around funding
+func (ctx *Context) initializeFunding() {
+	cfg := ctx.Config.Strategy
+	policies := make(map[string]execution.FundingPolicy, len(cfg.Funding))
+	for name, timing := range cfg.Funding {
+		policies[name] = execution.FundingPolicy{
+			EntryWindow: time.Duration(timing.EntryWindow) * time.Minute,
+			ExitWindow:  time.Duration(timing.ExitWindow) * time.Minute,
+		}
+	}
+	ctx.Funding = execution.NewFundingTimer(ctx.Contracts, execution.FundingPolicy{
+		EntryWindow: time.Duration(cfg.FundingEntryWindow) * time.Minute,
+		ExitWindow:  time.Duration(cfg.FundingExitWindow) * time.Minute,
+	}, policies)
+}
+
+// initializeIntents initializes the queue of trade intents entered once
+// their market condition is met
+func (ctx *Context) initializeIntents() error {
+	interval := ctx.Config.Monitor.IntentCheckInterval
+	if interval <= 0 {
+		interval = 10
+	}
+
+	ctx.Intents = monitor.NewIntentMonitor(ctx.TraderManager, ctx.Screener, ctx.MarketClient, ctx.Contracts,
+		ctx.Funding, ctx.OrderTag, ctx.Orders, time.Duration(interval)*time.Second)
+	ctx.Intents.Start()
+	return nil
+}
+
+// initializeReplication sets up copying the trades of the configured
+// signal sources
+func (ctx *Context) initializeReplication() {
+	sources := ctx.Config.Trading.Replication
+	if len(sources) == 0 || ctx.WatchOnly() {
+		return
+	}
+	rules := make(map[string]execution.ReplicationRule, len(sources))
+	for name, r := range sources {
+		rules[name] = execution.ReplicationRule{
+			Exchange:      r.Exchange,
+			Strategy:      r.Strategy,
+			Mode:          execution.ScalingMode(r.Mode),
+			Amount:        r.Amount,
+			Multiplier:    r.Multiplier,
+			MaxNotional:   r.MaxNotional,
+			Leverage:      r.Leverage,
+			MinFreeMargin: r.MinFreeMargin,
+		}
+	}
+	ctx.Replicator = execution.NewReplicator(rules, ctx.TraderManager, ctx.Contracts, ctx.Screener,
+		ctx.OrderTag, ctx.Orders, ctx.Config.Risk.SettleCurrency)
+	logger.Info("Replicating the trades of %d signal sources", len(rules))
+}
+
+// initializeAlerts sets up trading the TradingView alerts of the webhook
+// when it has a secret
+func (ctx *Context) initializeAlerts() {
+	cfg := ctx.Config.Trading.TradingView
+	if cfg.Secret == "" || ctx.WatchOnly() {
+		return
+	}
+	ctx.Alerts = execution.NewAlertRouter(execution.AlertPolicy{
+		Exchange:     cfg.Exchange,
+		Strategy:     cfg.Strategy,
+		Symbols:      cfg.Symbols,
+		MaxNotional:  cfg.MaxNotional,
+		PriceType:    trader.TriggerPriceType(ctx.Config.Trading.TriggerPriceType),
+		ReplayWindow: time.Duration(cfg.ReplayWindow) * time.Second,
+	}, ctx.TraderManager, ctx.Risk, ctx.Funding, ctx.Contracts, ctx.Screener, ctx.OrderTag, ctx.Orders, ctx.Journal, ctx.CloseGuard)
+	logger.Info("Accepting TradingView alerts at /api/webhook/tradingview")
+}
+
+// initializeAnnouncements polls the announcement feeds of the configured
+// exchanges that publish one
+func (ctx *Context) initializeAnnouncements() error {
+	cfg := ctx.Config.Monitor
+	if cfg.AnnouncementInterval <= 0 {
+		return nil
+	}
+
+	var feeds []market.AnnouncementFeed
+	added := make(map[string]bool)
+	for name, exchange := range ctx.Config.Exchanges {
+		exchangeType := exchange.Type
+		if exchangeType == "" {
+			exchangeType = name
+		}
+		if added[exchangeType] {
+			continue
+		}
+		switch exchangeType {
+		case "okx":
+			feeds = append(feeds, market.NewOKXAnnouncements(exchange.BaseURL))
+		case "bybit":
+			feeds = append(feeds, market.NewBybitAnnouncements(exchange.BaseURL))
+		default:
+			continue
+		}
+		added[exchangeType] = true
+	}
+	if len(feeds) == 0 {
+		return nil
+	}
+
+	ctx.Announcements = market.NewAnnouncementMonitor(feeds, ctx.Events, time.Duration(cfg.AnnouncementInterval)*time.Second)
+	ctx.Announcements.OnAnnouncement = func(a market.Announcement) {
+		logger.Info("%s announcement [%s]: %s", a.Exchange, a.Category, a.Title)
+		if cfg.AutoWatchListings && a.Category == market.ListingAnnouncement && a.Perpetual {
+			for _, pair := range ctx.Screener.Watch(a.Pairs...) {
+				logger.Info("Added newly listed %s to the watchlist", pair)
+			}
+		}
+	}
+	ctx.Announcements.Start()
+	return nil
+}
+
+// initializeFlattener schedules the end-of-day flatten when configured
+func (ctx *Context) initializeFlattener() error {
+	cfg := ctx.Config.Trading
+	if cfg.FlattenAt == "" || ctx.WatchOnly() {
+		return nil
+	}
+
+	at, err := time.Parse("15:04", cfg.FlattenAt)
+	if err != nil {
+		return fmt.Errorf("trading.flatten_at: %v", err)
+	}
+	warnings := make([]time.Duration, len(cfg.FlattenWarnings))
+	for i, minutes := range cfg.FlattenWarnings {
+		warnings[i] = time.Duration(minutes) * time.Minute
+	}
+
+	offset := time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	ctx.Flattener = monitor.NewFlattener(ctx.TraderManager, ctx.CloseGuard, offset, warnings, cfg.FlattenStrategies)
+	ctx.Flattener.OnAlert = ctx.notifyAlerts(ctx.Flattener.OnAlert)
+	ctx.Flattener.Start()
+	logger.Info("End-of-day flatten scheduled at %s UTC", cfg.FlattenAt)
 	return nil
-}
\ No newline at end of file
+}
+
+// initializeTimeStops starts enforcing maximum holding times when configured
+func (ctx *Context) initializeTimeStops() error {
+	cfg := ctx.Config.Trading
+	if cfg.MaxHoldingMinutes <= 0 && len(cfg.HoldingLimits) == 0 || ctx.WatchOnly() {
+		return nil
+	}
+
+	action := func(field, a string) (monitor.TimeStopAction, error) {
+		switch monitor.TimeStopAction(a) {
+		case monitor.TimeStopClose, "":
+			return monitor.TimeStopClose, nil
+		case monitor.TimeStopFlag:
+			return monitor.TimeStopFlag, nil
+		}
+		return "", fmt.Errorf("%s: unknown time stop action %q", field, a)
+	}
+	fallback, err := action("trading.time_stop_action", cfg.TimeStopAction)
+	if err != nil {
+		return err
+	}
+	rules := make(map[string]monitor.HoldingRule, len(cfg.HoldingLimits))
+	for name, limit := range cfg.HoldingLimits {
+		a, err := action("trading.holding_limits."+name+".action", limit.Action)
+		if err != nil {
+			return err
+		}
+		rules[name] = monitor.HoldingRule{MaxAge: time.Duration(limit.MaxMinutes) * time.Minute, Action: a}
+	}
+
+	ctx.Aging = monitor.NewAgingMonitor(ctx.TraderManager, ctx.CloseGuard, ctx.Journal, ctx.Funding, monitor.HoldingRule{
+		MaxAge: time.Duration(cfg.MaxHoldingMinutes) * time.Minute,
+		Action: fallback,
+	}, rules, time.Duration(cfg.TimeStopInterval)*time.Second)
+	ctx.Aging.OnAlert = ctx.notifyAlerts(ctx.Aging.OnAlert)
+	ctx.Aging.Start()
+	logger.Info("Time stops enabled for %d holding limits (default %d minutes)", len(rules), cfg.MaxHoldingMinutes)
+	return nil
+}
+
+// initializeDailyReport sets up trade activity statistics over the recorded
+// history and schedules the daily report when enabled
+func (ctx *Context) initializeDailyReport() error {
+	cfg := ctx.Config.Monitor
+	if ctx.Store != nil {
+		ctx.Activity = report.NewActivity(ctx.Store, ctx.Contracts, ctx.Config.Strategy.BacktestFeeBps/10000)
+		// Benchmarks come from the cached candle downloader
+		if ctx.Downloader != nil {
+			ctx.TCA = report.NewTCA(ctx.Store, ctx.Downloader)
+		}
+	}
+
+	t := ctx.DefaultTrader()
+	if !cfg.DailyReportEnabled || t == nil {
+		return nil
+	}
+
+	window := time.Duration(cfg.ActivityWindow) * 24 * time.Hour
+	tcaWindow := time.Duration(cfg.TCAWindow) * 24 * time.Hour
+	ctx.DailyReport = report.NewDailyReporter(t, ctx.Instruments.Venue(ctx.TraderManager.DefaultName()), ctx.VaR, ctx.Activity,
+		window, ctx.TCA, tcaWindow, ctx.Limits, cfg.DailyReportHour)
+	ctx.DailyReport.Start()
+	return nil
+}
+
+// initializeStrategies creates the strategy registry and the parameter
+// re-optimization job
+func (ctx *Context) initializeStrategies() error {
+	cfg := ctx.Config.Strategy
+	ctx.Strategies = strategy.NewRegistry(ctx.Candles)
+	ctx.PaperStrategies = strategy.NewRegistry(ctx.Candles)
+	ctx.Strategies.OnMetrics = ctx.publishStrategyMetrics("live")
+	ctx.PaperStrategies.OnMetrics = ctx.publishStrategyMetrics("paper")
+	if ctx.Bars != nil {
+		ctx.Strategies.FollowBars(ctx.Bars, ctx.publishStrategySignals("live"))
+		ctx.PaperStrategies.FollowBars(ctx.Bars, ctx.publishStrategySignals("paper"))
+	}
+	ctx.Promoter = backtest.NewPromoter(ctx.PaperStrategies, ctx.Strategies, ctx.Candles, ctx.FundingHistory,
+		cfg.BacktestWindow, cfg.BacktestFeeBps)
+	// Candidates and their approvals persist in the history store
+	if ctx.Store != nil {
+		if err := ctx.Promoter.SetCandidateStore(ctx.Store); err != nil {
+			return fmt.Errorf("failed to load promotion candidates: %w", err)
+		}
+	}
+	ctx.Reoptimizer = backtest.NewReoptimizer(ctx.Strategies, ctx.Candles, ctx.FundingHistory, backtest.ReoptimizerConfig{
+		Interval:       time.Duration(cfg.ReoptimizeInterval) * time.Hour,
+		Window:         cfg.ReoptimizeWindow,
+		FeeBps:         cfg.BacktestFeeBps,
+		MinImprovement: cfg.ReoptimizeMinImprovement,
+		AutoApply:      cfg.ReoptimizeAutoApply,
+	})
+	if cfg.ReoptimizeEnabled && cfg.ReoptimizeInterval > 0 {
+		ctx.Reoptimizer.Start()
+	}
+	if err := ctx.initializeShadow(); err != nil {
+		return err
+	}
+
+	// The sizing follows the limits of the risk profile in force
+	ctx.Sizer = execution.NewSizer(ctx.Contracts, ctx.sizingPolicy(ctx.Limits.Profile()))
+	ctx.Limits.OnProfile(func(profile risk.ActiveProfile) {
+		ctx.Sizer.SetPolicy(ctx.sizingPolicy(profile))
+	})
+	return nil
+}
+
+// initializeScheduler schedules the configured periodic jobs. The jobs
+// placing or canceling orders aren't scheduled in watch-only mode.
+func (ctx *Context) initializeScheduler() error {
+	ctx.Scheduler = scheduler.NewScheduler(ctx.Contracts)
+	for _, cfg := range ctx.Config.Scheduler.Jobs {
+		if cfg.Disabled {
+			continue
+		}
+		job := scheduler.Job{
+			Name: cfg.Name,
+			Type: cfg.Type,
+			Schedule: scheduler.Schedule{
+				At:            cfg.At,
+				Every:         time.Duration(cfg.Every) * time.Minute,
+				BeforeFunding: time.Duration(cfg.BeforeFunding) * time.Minute,
+				Pairs:         cfg.Pairs,
+			},
+		}
+		switch cfg.Type {
+		case "rebalance":
+			if ctx.WatchOnly() {
+				logger.Info("Watch-only mode: job %s isn't scheduled", cfg.Name)
+				continue
+			}
+			job.Run = scheduler.NewRebalancer(ctx.TraderManager, ctx.Contracts, ctx.Screener, ctx.OrderTag, ctx.Orders,
+				cfg.Exchange, cfg.Targets, cfg.Tolerance).Run
+		case "pnl_snapshot":
+			if ctx.PnL == nil {
+				return fmt.Errorf("scheduler job %s: pnl_snapshot needs a database", cfg.Name)
+			}
+			job.Run = scheduler.NewPnLSnapshotter(ctx.PnL, cfg.Exchange).Run
+		case "funding_check":
+			job.Run = scheduler.NewFundingCheck(ctx.TraderManager, ctx.Contracts, ctx.Screener, cfg.Exchange, cfg.MaxFundingRate).Run
+		case "stale_orders":
+			if ctx.WatchOnly() {
+				logger.Info("Watch-only mode: job %s isn't scheduled", cfg.Name)
+				continue
+			}
+			pairs := cfg.Pairs
+			if len(pairs) == 0 {
+				pairs = ctx.Config.Trading.Pairs
+			}
+			job.Run = scheduler.NewStaleOrderCleaner(ctx.TraderManager, ctx.OrderTag, ctx.Orders, cfg.Exchange,
+				pairs, time.Duration(cfg.MaxAge)*time.Minute).Run
+		default:
+			return fmt.Errorf("scheduler job %s: unknown type %q", cfg.Name, cfg.Type)
+		}
+		if err := ctx.Scheduler.Add(job); err != nil {
+			return err
+		}
+		logger.Info("Scheduled job %s (%s): %s", cfg.Name, cfg.Type, job.Schedule)
+	}
+	ctx.Scheduler.Start()
+	return nil
+}
+
+// sizingPolicy returns the sizing policy under a risk profile: signals are
+// sized at its leverage cap, or the default leverage without one
+func (ctx *Context) sizingPolicy(profile risk.ActiveProfile) execution.SizingPolicy {
+	sizing := ctx.Config.Trading.Sizing
+	leverage := profile.Limits.MaxLeverage
+	if leverage <= 0 {
+		leverage = ctx.Config.Trading.DefaultLeverage
+	}
+	fraction := sizing.Fraction
+	if profile.Limits.SizingFraction > 0 {
+		fraction = profile.Limits.SizingFraction
+	}
+	return execution.SizingPolicy{
+		Method:      execution.SizingMethod(sizing.Method),
+		Fraction:    fraction,
+		Leverage:    leverage,
+		ATRPeriod:   sizing.ATRPeriod,
+		ATRMultiple: sizing.ATRMultiple,
+		WinRate:     sizing.WinRate,
+		Payoff:      sizing.Payoff,
+		KellyCap:    sizing.KellyCap,
+		MaxNotional: profile.Limits.MaxPositionNotional,
+	}
+}
+
+// initializeShadow starts the shadow accounts, if any are configured
+func (ctx *Context) initializeShadow() error {
+	cfg := ctx.Config.Strategy
+	if len(cfg.ShadowAccounts) == 0 {
+		return nil
+	}
+	accounts := make([]backtest.ShadowAccountConfig, len(cfg.ShadowAccounts))
+	for i, a := range cfg.ShadowAccounts {
+		accounts[i] = backtest.ShadowAccountConfig{Name: a.Name, Capital: a.Capital}
+		for _, st := range a.Strategies {
+			accounts[i].Strategies = append(accounts[i].Strategies, backtest.ShadowStrategy{
+				Strategy: st.Strategy,
+				Pair:     st.Pair,
+				Interval: st.Interval,
+				Params:   strategy.Params(st.Params),
+				Weight:   st.Weight,
+			})
+		}
+	}
+	shadow, err := backtest.NewShadowBook(accounts, ctx.Candles, ctx.FundingHistory, cfg.BacktestFeeBps)
+	if err != nil {
+		return err
+	}
+	ctx.Shadow = shadow
+	ctx.Shadow.Start(time.Duration(cfg.ShadowInterval) * time.Second)
+	logger.Info("Shadow accounts started: %d", len(accounts))
+	return nil
+}
+
+// publishStrategyMetrics returns a sink exporting the custom metrics of the
+// strategies of a stage as strategy_<name> gauges and market events
+func (ctx *Context) publishStrategyMetrics(stage string) strategy.MetricSink {
+	return func(instance *strategy.Instance, values map[string]float64) {
+		labels := metrics.Labels{
+			"strategy": instance.Strategy.Name(),
+			"pair":     instance.Pair,
+			"stage":    stage,
+		}
+		for name, v := range values {
+			ctx.Metrics.Set("strategy_"+name, labels, v)
+		}
+		ctx.Events.Publish(market.MarketEvent{
+			Type: strategy.MetricsEventType,
+			Pair: instance.Pair,
+			Data: strategy.MetricsEvent{
+				Instance: instance.Name(),
+				Strategy: instance.Strategy.Name(),
+				Interval: instance.Interval,
+				Stage:    stage,
+				Values:   values,
+			},
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// publishStrategySignals returns a sink publishing the signals of the
+// strategies of a stage at every live bar close as market events
+func (ctx *Context) publishStrategySignals(stage string) strategy.SignalSink {
+	return func(instance *strategy.Instance, signal strategy.Signal, bar market.Bar) {
+		now := time.Now()
+		ctx.Events.Publish(market.MarketEvent{
+			Type: strategy.SignalEventType,
+			Pair: instance.Pair,
+			Data: strategy.SignalEvent{
+				Instance: instance.Name(),
+				Strategy: instance.Strategy.Name(),
+				Interval: instance.Interval,
+				Stage:    stage,
+				Signal:   signal,
+				BarTime:  bar.Candle.Timestamp,
+				Latency:  now.Sub(bar.CloseTime()).Seconds(),
+			},
+			Timestamp: now,
+		})
+	}
+}
+
+// DefaultTrader returns the trader of the default exchange, if any
+func (ctx *Context) DefaultTrader() trader.Trader {
+	return ctx.TraderManager.Default()
+}
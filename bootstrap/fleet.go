@@ -0,0 +1,230 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/config"
+	"github.com/nofx/crypto"
+	"github.com/nofx/logger"
+)
+
+// fleetClient fetches the leader's configuration
+var fleetClient = &http.Client{Timeout: 10 * time.Second}
+
+// FleetStatus represents the fleet configuration sync state of an instance
+type FleetStatus struct {
+	Role string `json:"role"`
+	// Version is the leader document version applied, for followers
+	Version int64     `json:"version,omitempty"`
+	Applied time.Time `json:"applied,omitempty"`
+	Fields  []string  `json:"fields,omitempty"`
+	// Ignored lists the local overrides the leader does not permit
+	Ignored   []string  `json:"ignored,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	LastPoll  time.Time `json:"last_poll,omitempty"`
+}
+
+// fleet holds the fleet key and, for followers, the applied leader document
+type fleet struct {
+	mu     sync.RWMutex
+	key    []byte
+	doc    *config.FleetDocument
+	status FleetStatus
+}
+
+// FleetStatus returns the fleet configuration sync state
+func (ctx *Context) FleetStatus() FleetStatus {
+	ctx.fleet.mu.RLock()
+	defer ctx.fleet.mu.RUnlock()
+	status := ctx.fleet.status
+	status.Role = ctx.Config.Fleet.Role
+	return status
+}
+
+// FleetDocument returns the signed fleet document of the current
+// configuration; only leaders publish one
+func (ctx *Context) FleetDocument() (*config.FleetDocument, error) {
+	if ctx.Config.Fleet.Role != "leader" {
+		return nil, fmt.Errorf("not a fleet leader")
+	}
+	doc, err := ctx.Config.FleetDocument(time.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	ctx.fleet.mu.RLock()
+	defer ctx.fleet.mu.RUnlock()
+	if err := doc.Sign(ctx.fleet.key); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// initializeFleet loads the fleet key and, on followers, overlays the
+// leader's configuration before any component reads it. A leader that can't
+// be reached leaves the local configuration in place until the next poll.
+func (ctx *Context) initializeFleet() error {
+	cfg := ctx.Config.Fleet
+	if cfg.Role == "" {
+		return nil
+	}
+	key, err := crypto.LoadKey(cfg.KeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load fleet key: %w", err)
+	}
+	ctx.fleet.key = key
+	if cfg.Role != "follower" {
+		logger.Info("Fleet leader publishing %s", strings.Join(cfg.Publish, ", "))
+		return nil
+	}
+
+	// Overlay a copy, so a document failing validation leaves nothing behind
+	next := *ctx.Config
+	doc, err := ctx.fetchFleetDocument(context.Background())
+	if err == nil {
+		err = ctx.overlayFleet(&next, doc)
+	}
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		ctx.recordFleetPoll(nil, err)
+		logger.Error("Fleet configuration unavailable, starting with the local configuration: %v", err)
+		return nil
+	}
+	*ctx.Config = next
+	ctx.recordFleetPoll(doc, nil)
+	logger.Info("Fleet configuration version %d applied from %s", doc.Version, cfg.LeaderURL)
+	return nil
+}
+
+// startFleetSync polls the leader periodically in the background
+func (ctx *Context) startFleetSync(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := ctx.syncFleet(context.Background()); err != nil {
+				ctx.recordFleetPoll(nil, err)
+				logger.Error("Fleet configuration sync failed, keeping the current configuration: %v", err)
+			}
+		}
+	}()
+}
+
+// syncFleet fetches the leader's document and applies it through the hot
+// reload path when it changed
+func (ctx *Context) syncFleet(background context.Context) error {
+	doc, err := ctx.fetchFleetDocument(background)
+	if err != nil {
+		return err
+	}
+
+	ctx.fleet.mu.Lock()
+	previous := ctx.fleet.doc
+	if previous != nil && reflect.DeepEqual(previous.Fields, doc.Fields) &&
+		reflect.DeepEqual(previous.PermitOverrides, doc.PermitOverrides) {
+		ctx.fleet.doc = doc
+		ctx.fleet.status.LastPoll, ctx.fleet.status.LastError = time.Now(), ""
+		ctx.fleet.mu.Unlock()
+		return nil
+	}
+	ctx.fleet.doc = doc
+	ctx.fleet.mu.Unlock()
+
+	if err := ctx.ReloadConfig(); err != nil {
+		ctx.fleet.mu.Lock()
+		ctx.fleet.doc = previous
+		ctx.fleet.mu.Unlock()
+		return fmt.Errorf("version %d: %w", doc.Version, err)
+	}
+	ctx.recordFleetPoll(doc, nil)
+	logger.Info("Fleet configuration version %d applied", doc.Version)
+	return nil
+}
+
+// fetchFleetDocument fetches and verifies the leader's document, rejecting
+// one older than the document already applied
+func (ctx *Context) fetchFleetDocument(background context.Context) (*config.FleetDocument, error) {
+	cfg := ctx.Config.Fleet
+	req, err := http.NewRequestWithContext(background, http.MethodGet, strings.TrimSuffix(cfg.LeaderURL, "/")+"/api/fleet/config", nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", cfg.APIKey)
+	}
+	resp, err := fleetClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("leader returned %s", resp.Status)
+	}
+
+	var doc config.FleetDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid fleet document: %w", err)
+	}
+	ctx.fleet.mu.RLock()
+	defer ctx.fleet.mu.RUnlock()
+	if err := doc.Verify(ctx.fleet.key); err != nil {
+		return nil, err
+	}
+	if ctx.fleet.doc != nil && doc.Version < ctx.fleet.doc.Version {
+		return nil, fmt.Errorf("fleet document version %d is older than the applied version %d", doc.Version, ctx.fleet.doc.Version)
+	}
+	return &doc, nil
+}
+
+// overlayFleet sets the fields of a leader document on cfg, warning about
+// local overrides the leader does not permit
+func (ctx *Context) overlayFleet(cfg *config.Config, doc *config.FleetDocument) error {
+	ignored, err := cfg.Overlay(doc)
+	if err != nil {
+		return err
+	}
+	for _, field := range ignored {
+		logger.Warning("Fleet leader does not permit overriding %s; the local value was replaced", field)
+	}
+	ctx.fleet.mu.Lock()
+	ctx.fleet.status.Ignored = ignored
+	ctx.fleet.mu.Unlock()
+	return nil
+}
+
+// appliedFleetDocument returns the leader document in effect, if any
+func (ctx *Context) appliedFleetDocument() *config.FleetDocument {
+	ctx.fleet.mu.RLock()
+	defer ctx.fleet.mu.RUnlock()
+	return ctx.fleet.doc
+}
+
+// recordFleetPoll records the result of a poll of the leader
+func (ctx *Context) recordFleetPoll(doc *config.FleetDocument, err error) {
+	ctx.fleet.mu.Lock()
+	defer ctx.fleet.mu.Unlock()
+	ctx.fleet.status.LastPoll = time.Now()
+	if err != nil {
+		ctx.fleet.status.LastError = err.Error()
+		return
+	}
+	ctx.fleet.doc = doc
+	ctx.fleet.status.LastError = ""
+	ctx.fleet.status.Version = doc.Version
+	ctx.fleet.status.Applied = time.Now()
+	ctx.fleet.status.Fields = make([]string, 0, len(doc.Fields))
+	for field := range doc.Fields {
+		ctx.fleet.status.Fields = append(ctx.fleet.status.Fields, field)
+	}
+	sort.Strings(ctx.fleet.status.Fields)
+}
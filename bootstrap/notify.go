@@ -0,0 +1,182 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nofx/journal"
+	"github.com/nofx/logger"
+	"github.com/nofx/monitor"
+	"github.com/nofx/notify"
+	"github.com/nofx/risk"
+)
+
+// Risk event types notified besides the monitor alerts
+const (
+	KillSwitchEvent         = "kill_switch"
+	KillSwitchReleasedEvent = "kill_switch_released"
+)
+
+// alertSeverities are the severities monitor alerts are raised with unless
+// notify.severities overrides them
+var alertSeverities = map[monitor.AlertType]notify.Severity{
+	monitor.PermissionAlert:     notify.Critical,
+	monitor.DriftAlert:          notify.Critical,
+	monitor.BracketAlert:        notify.Warning,
+	monitor.LossAlert:           notify.Warning,
+	monitor.TimeStopAlert:       notify.Info,
+	monitor.FlattenWarningAlert: notify.Info,
+	monitor.FlattenAlert:        notify.Critical,
+	monitor.LiquidationAlert:    notify.Critical,
+	monitor.AuthAlert:           notify.Critical,
+}
+
+// initializeNotifications sets up the notification channels, the email
+// notifier and the Telegram bot and sends the kill switch changes to them
+func (ctx *Context) initializeNotifications() error {
+	cfg := ctx.Config.Notify
+	overrides := make(map[string]notify.Severity, len(cfg.Severities))
+	for event, severity := range cfg.Severities {
+		overrides[event] = notify.Severity(severity)
+	}
+	ctx.Notifier = notify.NewDispatcher(overrides)
+
+	names := make([]string, 0, len(cfg.Channels))
+	for name := range cfg.Channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		channel := cfg.Channels[name]
+		severities := make([]notify.Severity, len(channel.Severities))
+		for i, s := range channel.Severities {
+			severities[i] = notify.Severity(s)
+		}
+		switch channel.Type {
+		case "discord":
+			ctx.Notifier.Add(notify.NewDiscordNotifier(name, channel.WebhookURL, channel.Username), severities...)
+		case "slack":
+			ctx.Notifier.Add(notify.NewSlackNotifier(name, channel.WebhookURL, channel.Channel), severities...)
+		default:
+			return fmt.Errorf("notify.channels.%s: unknown channel type %q", name, channel.Type)
+		}
+	}
+	if cfg.Email.Host != "" {
+		email, err := notify.NewEmailNotifier(cfg.Email)
+		if err != nil {
+			return fmt.Errorf("notify.email: %w", err)
+		}
+		ctx.Notifier.Add(email, notify.Critical)
+		logger.Info("Mailing critical %v events to %v", cfg.Email.Events, cfg.Email.To)
+	}
+	if telegram := cfg.Telegram; telegram.BotToken != "" {
+		bot := notify.NewTelegramBot(telegram.BotToken, telegram.ChatID)
+		severities := make([]notify.Severity, len(telegram.Severities))
+		for i, s := range telegram.Severities {
+			severities[i] = notify.Severity(s)
+		}
+		ctx.Notifier.Add(bot, severities...)
+		bot.Handle("tag", "/tag order|position <order ID|pair> <tag>...", ctx.annotateCommand(false))
+		bot.Handle("note", "/note order|position <order ID|pair> <note>", ctx.annotateCommand(true))
+		bot.Start()
+		logger.Info("Telegram bot started for chat %d", telegram.ChatID)
+	}
+	if len(cfg.Channels) == 0 && cfg.Email.Host == "" && cfg.Telegram.BotToken == "" {
+		return nil
+	}
+	logger.Info("Sending notifications to %d channels", len(ctx.Notifier.Channels()))
+
+	ctx.Limits.OnKillSwitch(func(ks risk.KillSwitch) {
+		if !ks.Engaged {
+			ctx.Notifier.Send(notify.Event{
+				Type:     KillSwitchReleasedEvent,
+				Severity: notify.Warning,
+				Title:    "Kill switch released",
+				Message:  "New entries are allowed again",
+			})
+			return
+		}
+		ctx.Notifier.Send(notify.Event{
+			Type:     KillSwitchEvent,
+			Severity: notify.Critical,
+			Title:    "Kill switch engaged",
+			Message:  "New entries are blocked: " + ks.Reason,
+			Time:     ks.Since,
+		})
+	})
+	return nil
+}
+
+// annotateCommand returns the bot command tagging, or with note annotating,
+// a trade or position in the journal
+func (ctx *Context) annotateCommand(note bool) notify.Command {
+	return func(args []string) (string, error) {
+		if len(args) < 3 {
+			return "", errors.New("expected a target (order or position), a reference and the text")
+		}
+		a := journal.Annotation{
+			Target:    journal.AnnotationTarget(args[0]),
+			Reference: args[1],
+		}
+		if a.Target == journal.PositionTarget {
+			a.Reference = strings.ToUpper(a.Reference)
+			a.Pair = a.Reference
+		}
+		if note {
+			a.Note = strings.Join(args[2:], " ")
+		} else {
+			a.Tags = args[2:]
+		}
+		a, err := ctx.Journal.Annotate(a)
+		if err != nil {
+			return "", err
+		}
+		if note {
+			return fmt.Sprintf("Noted %s %s", a.Target, a.Reference), nil
+		}
+		return fmt.Sprintf("Tagged %s %s with %s", a.Target, a.Reference, strings.Join(a.Tags, ", ")), nil
+	}
+}
+
+// notifyAlerts returns an alert handler calling handle and sending the
+// alert to the notification channels
+func (ctx *Context) notifyAlerts(handle func(monitor.Alert)) func(monitor.Alert) {
+	return func(a monitor.Alert) {
+		handle(a)
+		if ctx.Notifier == nil {
+			return
+		}
+		severity, ok := alertSeverities[a.Type]
+		if !ok {
+			severity = notify.Warning
+		}
+		e := notify.Event{
+			Type:     string(a.Type),
+			Severity: severity,
+			Title:    "Alarm: " + string(a.Type),
+			Message:  a.Message,
+			Fields:   make(map[string]string),
+			Time:     a.Timestamp,
+		}
+		if a.Exchange != "" {
+			e.Fields["exchange"] = a.Exchange
+		}
+		if a.Pair != "" {
+			e.Fields["pair"] = a.Pair
+		}
+		if a.Currency != "" {
+			e.Fields["currency"] = a.Currency
+		}
+		if a.Expected != 0 || a.Actual != 0 {
+			e.Fields["expected"] = strconv.FormatFloat(a.Expected, 'f', -1, 64)
+			e.Fields["actual"] = strconv.FormatFloat(a.Actual, 'f', -1, 64)
+		}
+		if a.Unexplained != 0 {
+			e.Fields["unexplained"] = strconv.FormatFloat(a.Unexplained, 'f', -1, 64)
+		}
+		ctx.Notifier.Send(e)
+	}
+}
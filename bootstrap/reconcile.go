@@ -0,0 +1,272 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/storage"
+	"github.com/nofx/trader"
+)
+
+// Startup reconciliation modes
+const (
+	// ReconcileFlag reports discrepancies and engages the kill switch until
+	// an operator reviews them
+	ReconcileFlag = "flag"
+	// ReconcileAdopt records orphan orders and positions as our own and
+	// lets trading resume
+	ReconcileAdopt = "adopt"
+)
+
+// Discrepancy represents an order or position whose exchange state does
+// not match the history store
+type Discrepancy struct {
+	Exchange string `json:"exchange"`
+	// Kind is "order" or "position"
+	Kind string `json:"kind"`
+	// Reference is the order ID or the pair of the position
+	Reference string `json:"reference"`
+	// Issue is "untracked" for exchange state missing from the store,
+	// "mismatch" for a position whose side or size differs and "missing"
+	// for stored state the exchange no longer has
+	Issue  string `json:"issue"`
+	Detail string `json:"detail"`
+	// Adopted reports whether the store, and for orders the client order
+	// registry, now reflects the exchange
+	Adopted bool `json:"adopted"`
+}
+
+// Reconciliation represents the result of the startup reconciliation
+type Reconciliation struct {
+	Mode          string        `json:"mode"`
+	Time          time.Time     `json:"time"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	// Errors lists the exchanges or pairs that could not be reconciled
+	Errors []string `json:"errors,omitempty"`
+}
+
+// reconciliation holds the latest startup reconciliation result
+type reconciliation struct {
+	mu     sync.RWMutex
+	result *Reconciliation
+}
+
+// Reconciliation returns the startup reconciliation result, or nil when it
+// did not run
+func (ctx *Context) Reconciliation() *Reconciliation {
+	ctx.reconciliation.mu.RLock()
+	defer ctx.reconciliation.mu.RUnlock()
+	return ctx.reconciliation.result
+}
+
+// reconcile compares the open orders and positions of every exchange with
+// the history store after a restart. Store state is read before the exchange
+// is queried, since the recorder persists whatever the queries observe.
+func (ctx *Context) reconcile(mode string) {
+	if ctx.Store == nil {
+		return
+	}
+
+	result := &Reconciliation{Mode: mode, Time: time.Now(), Discrepancies: []Discrepancy{}}
+	background := context.Background()
+	for _, name := range ctx.TraderManager.Names() {
+		t, err := ctx.TraderManager.Get(name)
+		if err != nil {
+			continue
+		}
+		ctx.reconcileOrders(background, name, t, mode, result)
+		ctx.reconcilePositions(background, name, t, mode, result)
+	}
+
+	ctx.reconciliation.mu.Lock()
+	ctx.reconciliation.result = result
+	ctx.reconciliation.mu.Unlock()
+
+	for _, d := range result.Discrepancies {
+		logger.Warning("Startup reconciliation: %s %s %s on %s: %s (adopted: %t)",
+			d.Issue, d.Kind, d.Reference, d.Exchange, d.Detail, d.Adopted)
+	}
+	for _, e := range result.Errors {
+		logger.Error("Startup reconciliation: %s", e)
+	}
+	logger.Info("Startup reconciliation completed, %d discrepancies", len(result.Discrepancies))
+
+	if mode == ReconcileFlag && (len(result.Discrepancies) > 0 || len(result.Errors) > 0) {
+		ctx.Limits.Engage(fmt.Sprintf("startup reconciliation found %d discrepancies and %d errors; review /api/admin/reconciliation",
+			len(result.Discrepancies), len(result.Errors)))
+	}
+}
+
+// reconcileOrders matches the open orders of an exchange against the store
+func (ctx *Context) reconcileOrders(background context.Context, exchange string, t trader.Trader, mode string, result *Reconciliation) {
+	stored, err := ctx.Store.OpenOrders(exchange)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: failed to load stored orders: %v", exchange, err))
+		return
+	}
+	known := make(map[string]storage.OrderRecord, len(stored))
+	pairs := append([]string(nil), ctx.Config.Trading.Pairs...)
+	seenPair := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		seenPair[pair] = true
+	}
+	for _, o := range stored {
+		known[o.ID] = o
+		if !seenPair[o.Pair] {
+			seenPair[o.Pair] = true
+			pairs = append(pairs, o.Pair)
+		}
+	}
+
+	open := make(map[string]bool)
+	for _, pair := range pairs {
+		orders, err := t.GetOrders(background, pair, trader.OrderStatusNew)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: failed to list open orders for %s: %v", exchange, pair, err))
+			// Unlisted pairs can't tell missing orders apart
+			for id, o := range known {
+				if o.Pair == pair {
+					open[id] = true
+				}
+			}
+			continue
+		}
+
+		for _, order := range orders {
+			open[order.ID] = true
+			if _, ok := known[order.ID]; ok {
+				continue
+			}
+			if ctx.OrderTag.Owns(order.ClientOrderID) && ctx.Orders.Has(order.ClientOrderID) {
+				continue
+			}
+
+			d := Discrepancy{
+				Exchange:  exchange,
+				Kind:      "order",
+				Reference: order.ID,
+				Issue:     "untracked",
+				Detail: fmt.Sprintf("%s %s %s %.8f @ %.8f (client ID %q)",
+					order.Pair, order.Side, order.Type, order.Amount, order.Price, order.ClientOrderID),
+			}
+			if mode == ReconcileAdopt {
+				d.Adopted = ctx.adoptOrder(exchange, order)
+			}
+			result.Discrepancies = append(result.Discrepancies, d)
+		}
+	}
+
+	// Stored open orders that closed while we were down
+	for id, o := range known {
+		if open[id] {
+			continue
+		}
+		d := Discrepancy{
+			Exchange:  exchange,
+			Kind:      "order",
+			Reference: id,
+			Issue:     "missing",
+			Detail:    fmt.Sprintf("%s %s %s no longer open", o.Pair, o.Side, o.Type),
+		}
+		// Querying through the recorder stores the final state
+		if final, err := t.GetOrder(background, id); err == nil && final != nil {
+			d.Detail = fmt.Sprintf("%s %s %s is now %s, %.8f of %.8f filled",
+				o.Pair, o.Side, o.Type, final.Status, final.FilledAmount, final.Amount)
+			d.Adopted = true
+		}
+		result.Discrepancies = append(result.Discrepancies, d)
+	}
+}
+
+// adoptOrder records an orphan order in the store and the client order
+// registry, so later cleanups keep it and lookups by client ID resolve it
+func (ctx *Context) adoptOrder(exchange string, order trader.Order) bool {
+	record := storage.OrderRecord{Order: order, Exchange: exchange, Strategy: ctx.OrderTag.Strategy(order.ClientOrderID)}
+	if err := ctx.Store.SaveOrder(record); err != nil {
+		logger.Error("Startup reconciliation failed to adopt order %s: %v", order.ID, err)
+		return false
+	}
+	if order.ClientOrderID == "" {
+		return true
+	}
+	if err := ctx.Orders.Track(trader.ClientOrder{
+		ID:        order.ClientOrderID,
+		Exchange:  exchange,
+		Pair:      order.Pair,
+		Strategy:  record.Strategy,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		logger.Error("Startup reconciliation failed to track order %s: %v", order.ClientOrderID, err)
+		return false
+	}
+	return true
+}
+
+// reconcilePositions matches the positions of an exchange against the store
+func (ctx *Context) reconcilePositions(background context.Context, exchange string, t trader.Trader, mode string, result *Reconciliation) {
+	stored, err := ctx.Store.OpenPositions(exchange)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: failed to load stored positions: %v", exchange, err))
+		return
+	}
+	// Listing through the recorder stores every open position
+	positions, err := t.GetPositions(background)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: failed to list positions: %v", exchange, err))
+		return
+	}
+
+	known := make(map[string]storage.PositionRecord, len(stored))
+	for _, p := range stored {
+		known[p.Pair] = p
+	}
+
+	for _, p := range positions {
+		if p.Size == 0 {
+			continue
+		}
+		last, ok := known[p.Pair]
+		delete(known, p.Pair)
+		if ok && last.Side == p.Side && last.Size == p.Size {
+			continue
+		}
+
+		d := Discrepancy{
+			Exchange:  exchange,
+			Kind:      "position",
+			Reference: p.Pair,
+			Issue:     "untracked",
+			Detail:    fmt.Sprintf("%s %.8f @ %.8f", p.Side, p.Size, p.EntryPrice),
+			// The recorder already stored it while listing
+			Adopted: mode == ReconcileAdopt,
+		}
+		if ok {
+			d.Issue = "mismatch"
+			d.Detail = fmt.Sprintf("stored %s %.8f, exchange %s", last.Side, last.Size, d.Detail)
+		}
+		result.Discrepancies = append(result.Discrepancies, d)
+	}
+
+	// Stored positions closed while we were down
+	for pair, last := range known {
+		d := Discrepancy{
+			Exchange:  exchange,
+			Kind:      "position",
+			Reference: pair,
+			Issue:     "missing",
+			Detail:    fmt.Sprintf("stored %s %.8f no longer open", last.Side, last.Size),
+		}
+		if mode == ReconcileAdopt {
+			last.Size, last.UnrealizedPnl, last.Timestamp = 0, 0, time.Now()
+			if err := ctx.Store.SavePosition(last); err != nil {
+				logger.Error("Startup reconciliation failed to record closed position %s: %v", pair, err)
+			} else {
+				d.Adopted = true
+			}
+		}
+		result.Discrepancies = append(result.Discrepancies, d)
+	}
+}
@@ -0,0 +1,117 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nofx/config"
+	"github.com/nofx/logger"
+)
+
+// reloadDelay coalesces the burst of file events of a single save
+const reloadDelay = 500 * time.Millisecond
+
+// watchConfig reloads the configuration whenever its file changes. The
+// directory is watched rather than the file, so editors replacing the file
+// on save keep triggering reloads.
+func (ctx *Context) watchConfig() error {
+	path, err := config.File(os.Args[1:])
+	if err != nil || path == "" {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		var pending *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(path) ||
+					!event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+					continue
+				}
+				if pending != nil {
+					pending.Stop()
+				}
+				pending = time.AfterFunc(reloadDelay, func() {
+					if err := ctx.ReloadConfig(); err != nil {
+						logger.Log(logger.ErrorLevel, logger.MsgConfigReloadFailed, "path", path, "error", err.Error())
+					}
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warning("Config file watch error: %v", err)
+			}
+		}
+	}()
+
+	logger.Info("Watching %s for configuration changes", path)
+	return nil
+}
+
+// ReloadConfig reloads the configuration and applies the changes that are
+// safe at runtime: log levels, risk limits and the API and ticker rate
+// limits. Other changes, like the listen address or exchange credentials,
+// need a restart and are logged and ignored. On fleet followers the leader's
+// configuration is overlaid on the file. An invalid configuration changes
+// nothing.
+func (ctx *Context) ReloadConfig() error {
+	next, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if doc := ctx.appliedFleetDocument(); doc != nil {
+		if err := ctx.overlayFleet(next, doc); err != nil {
+			return err
+		}
+		if err := next.Validate(); err != nil {
+			return err
+		}
+	}
+
+	var applied []string
+	for _, field := range config.Changes(ctx.Config, next) {
+		if !config.Reloadable(field) {
+			logger.Log(logger.WarningLevel, logger.MsgConfigNeedsRestart, "field", field)
+			continue
+		}
+		if err := ctx.Config.Apply(next, field); err != nil {
+			return err
+		}
+		applied = append(applied, field)
+	}
+	if len(applied) == 0 {
+		return nil
+	}
+
+	logger.SetLevels(ctx.Config.Logging)
+	if ctx.Limits != nil {
+		ctx.Limits.SetLimits(ctx.Config.Risk)
+	}
+	if ctx.ProfileSchedule != nil {
+		ctx.ProfileSchedule.SetSchedule(ctx.Config.Risk.ProfileSchedule)
+	}
+	if ctx.RateLimits != nil {
+		ctx.RateLimits.Configure(ctx.Config.API)
+	}
+	if ctx.screenerTicks != nil {
+		ctx.screenerTicks.SetMaxRate(ctx.Config.API.TickerMaxRate)
+	}
+	logger.Log(logger.InfoLevel, logger.MsgConfigReloaded, "fields", strings.Join(applied, ", "))
+	return nil
+}
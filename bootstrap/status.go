@@ -0,0 +1,93 @@
+package bootstrap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// Status represents the coarse health summary served on the public status
+// page; it must never carry balances, positions or order data
+type Status struct {
+	Status          string    `json:"status"`
+	UptimeSeconds   int64     `json:"uptime_seconds"`
+	Venues          int       `json:"venues"`
+	VenuesConnected int       `json:"venues_connected"`
+	Strategies      int       `json:"strategies"`
+	LastHeartbeat   time.Time `json:"last_heartbeat"`
+}
+
+// heartbeat tracks venue connectivity from periodic exchange pings
+type heartbeat struct {
+	mu        sync.RWMutex
+	connected map[string]bool
+	last      time.Time
+}
+
+// startHeartbeat pings every venue periodically in the background
+func (ctx *Context) startHeartbeat(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		ctx.beat()
+		for range ticker.C {
+			ctx.beat()
+		}
+	}()
+}
+
+// heartbeatTimeout bounds each venue ping so a hung venue reads as disconnected
+const heartbeatTimeout = 10 * time.Second
+
+// beat pings every venue with a balance query and records which ones answered
+func (ctx *Context) beat() {
+	connected := make(map[string]bool)
+	for _, name := range ctx.TraderManager.Names() {
+		t, err := ctx.TraderManager.Get(name)
+		if err != nil {
+			continue
+		}
+		ping, cancel := context.WithTimeout(context.Background(), heartbeatTimeout)
+		_, err = t.GetBalance(ping)
+		cancel()
+		if err != nil {
+			logger.Warning("Heartbeat to %s failed: %v", name, err)
+			continue
+		}
+		connected[name] = true
+	}
+
+	ctx.heartbeat.mu.Lock()
+	defer ctx.heartbeat.mu.Unlock()
+	ctx.heartbeat.connected = connected
+	ctx.heartbeat.last = time.Now()
+}
+
+// Status returns the public health summary
+func (ctx *Context) Status() Status {
+	ctx.heartbeat.mu.RLock()
+	connected, last := len(ctx.heartbeat.connected), ctx.heartbeat.last
+	ctx.heartbeat.mu.RUnlock()
+
+	status := Status{
+		Status:          "ok",
+		UptimeSeconds:   int64(time.Since(ctx.started).Seconds()),
+		Venues:          len(ctx.TraderManager.Names()),
+		VenuesConnected: connected,
+		LastHeartbeat:   last,
+	}
+	if ctx.Strategies != nil {
+		status.Strategies = len(ctx.Strategies.All())
+	}
+
+	switch {
+	case !ctx.Ready():
+		status.Status = "warming"
+	case status.VenuesConnected < status.Venues:
+		status.Status = "degraded"
+	}
+	return status
+}
@@ -0,0 +1,67 @@
+package bootstrap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nofx/config"
+	"github.com/nofx/ratelimit"
+	"github.com/nofx/retry"
+	"github.com/nofx/trader"
+)
+
+// newTrader creates the Trader implementation for a configured exchange
+func newTrader(name string, cfg config.ExchangeConfig) (trader.Trader, error) {
+	exchangeType := cfg.Type
+	if exchangeType == "" {
+		exchangeType = name
+	}
+
+	switch exchangeType {
+	case "gate", "gateio":
+		t := trader.NewGateTrader(cfg.APIKey, cfg.SecretKey, cfg.BaseURL, cfg.Encrypted)
+		t.SetSettleCurrencies(cfg.Settle)
+		return t, nil
+	case "okx":
+		t := trader.NewOKXTrader(cfg.APIKey, cfg.SecretKey, cfg.Passphrase, cfg.BaseURL)
+		if cfg.MarginMode != "" {
+			if err := t.SetMarginMode(cfg.MarginMode); err != nil {
+				return nil, err
+			}
+		}
+		return t, nil
+	case "bybit":
+		return trader.NewBybitTrader(cfg.APIKey, cfg.SecretKey, cfg.BaseURL), nil
+	case "kraken":
+		return trader.NewKrakenFuturesTrader(cfg.APIKey, cfg.SecretKey, cfg.BaseURL), nil
+	default:
+		return nil, fmt.Errorf("unsupported exchange type %q for exchange %q", exchangeType, name)
+	}
+}
+
+// configureTrader applies deployment-wide settings supported by the trader
+// of an exchange; prices and quantities are rounded with the exchange's own
+// contract listing
+func (ctx *Context) configureTrader(name string, t trader.Trader) {
+	if c, ok := t.(interface{ SetContracts(trader.ContractSource) }); ok {
+		c.SetContracts(ctx.Instruments.Venue(name))
+	}
+	if p, ok := t.(interface{ SetClientOrderPrefix(string) }); ok {
+		p.SetClientOrderPrefix(ctx.Config.Trading.ClientOrderPrefix)
+	}
+	if l, ok := t.(interface{ SetRateLimiter(*ratelimit.Limiter) }); ok {
+		l.SetRateLimiter(ctx.RateLimits)
+	}
+	if r, ok := t.(interface{ SetRetryPolicy(retry.Policy) }); ok {
+		r.SetRetryPolicy(ctx.retryPolicy())
+	}
+}
+
+// retryPolicy returns the configured retry policy of exchange API calls
+func (ctx *Context) retryPolicy() retry.Policy {
+	return retry.Policy{
+		Attempts:  ctx.Config.API.RetryAttempts,
+		BaseDelay: time.Duration(ctx.Config.API.RetryBaseDelay) * time.Millisecond,
+		MaxDelay:  time.Duration(ctx.Config.API.RetryMaxDelay) * time.Millisecond,
+	}
+}
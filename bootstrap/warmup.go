@@ -0,0 +1,74 @@
+package bootstrap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// warmTimeout bounds the warm-up, which holds back the start of the jobs
+const warmTimeout = time.Minute
+
+// Warm pre-fetches contract metadata, and the balances, positions and open
+// orders of every exchange's cache, for all configured pairs concurrently.
+// It runs before the monitors, strategies and jobs start, so the first
+// trading decisions aren't made on cold caches; readiness reports "warming"
+// until it completes.
+func (ctx *Context) Warm() {
+	defer close(ctx.warmed)
+	background, cancel := context.WithTimeout(context.Background(), warmTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	run := func(name string, fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				logger.Warning("Cache warm-up failed for %s: %v", name, err)
+			}
+		}()
+	}
+
+	pairs := ctx.Config.Trading.Pairs
+	if ctx.Contracts != nil {
+		for _, pair := range pairs {
+			pair := pair
+			run("contract "+pair, func() error {
+				_, err := ctx.Contracts.Refresh(pair)
+				return err
+			})
+		}
+	}
+
+	for name, cache := range ctx.Caches {
+		name, cache := name, cache
+		run(name+" account snapshot", func() error {
+			_, err := cache.RefreshSnapshot(background)
+			return err
+		})
+		for _, pair := range pairs {
+			pair := pair
+			run(name+" open orders "+pair, func() error {
+				_, err := cache.RefreshOpenOrders(background, pair)
+				return err
+			})
+		}
+	}
+
+	wg.Wait()
+	logger.Info("Cache warm-up completed for %d pairs in %s", len(pairs), time.Since(start))
+}
+
+// Ready reports whether the warm-up has completed
+func (ctx *Context) Ready() bool {
+	select {
+	case <-ctx.warmed:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,9 +1,8 @@
 package config
 
 import (
-	"encoding/json"
 	"os"
-	"strconv"
+	"strings"
 )
 
 // Config represents the application configuration
@@ -14,88 +13,886 @@ type Config struct {
 	Logging LoggingConfig `json:"logging"`
 	Trading TradingConfig `json:"trading"`
 	Security SecurityConfig `json:"security"`
+	Monitor MonitorConfig `json:"monitor"`
+	Risk    RiskConfig    `json:"risk"`
+	Strategy StrategyConfig `json:"strategy"`
+	Candles  CandleConfig   `json:"candles"`
+	Fleet    FleetConfig    `json:"fleet"`
+	Scheduler SchedulerConfig `json:"scheduler"`
+	Notify    NotifyConfig    `json:"notify"`
+	Exchanges map[string]ExchangeConfig `json:"exchanges"`
 }
 
 // ServerConfig represents server configuration
 type ServerConfig struct {
-	Host string `json:"host"`
-	Port string `json:"port"`
+	Host string `json:"host" env:"SERVER_HOST"`
+	Port string `json:"port" env:"PORT"`
+
+	// StatusPage serves the unauthenticated /status summary
+	StatusPage bool `json:"status_page" env:"STATUS_PAGE"`
+
+	// Metrics serves the unauthenticated Prometheus /metrics endpoint
+	Metrics bool `json:"metrics" env:"METRICS_ENABLED"`
+
+	// HotReload watches the config file and applies changes to the log
+	// levels, risk limits and rate limits without a restart; other
+	// changes are logged and ignored until the next restart
+	HotReload bool `json:"hot_reload" env:"HOT_RELOAD"`
+
+	// DecimalMode renders decimals in API responses as JSON numbers ("float")
+	// or strings ("string"). Prices and quantities are rounded to their
+	// contract's tick size and quantity step, other decimals to DecimalPlaces
+	DecimalMode   string `json:"decimal_mode" env:"DECIMAL_MODE"`
+	DecimalPlaces int    `json:"decimal_places"`
+
+	// AccessLog logs the method, path, status and duration of every request
+	AccessLog bool `json:"access_log" env:"ACCESS_LOG"`
+
+	// API requests are limited per client, identified by its IP address
+	// before authentication and by its principal after it, and per route to
+	// RateLimit requests per second in bursts of RateBurst (defaults to
+	// RateLimit); RouteRateLimits override the limit of routes by path
+	// template, e.g. "/api/trading/order". Zero disables the limits
+	RateLimit       float64                    `json:"rate_limit" env:"SERVER_RATE_LIMIT"`
+	RateBurst       float64                    `json:"rate_burst"`
+	RouteRateLimits map[string]RateLimitConfig `json:"route_rate_limits"`
+}
+
+// DatabaseConfig represents the history store configuration; Driver is
+// "sqlite3" or "postgres", and an empty driver disables persistence
+type DatabaseConfig struct {
+	Driver           string `json:"driver" env:"DATABASE_DRIVER"`
+	ConnectionString string `json:"connection_string" env:"DATABASE_URL"`
+
+	// SnapshotInterval is the balance and position snapshot period in minutes
+	SnapshotInterval int `json:"snapshot_interval"`
+}
+
+// ExchangeConfig represents the credentials and settings of an exchange account
+type ExchangeConfig struct {
+	// Type selects the implementation (gate, okx, bybit, kraken); defaults to the exchange name
+	Type       string `json:"type"`
+	APIKey     string `json:"api_key"`
+	SecretKey  string `json:"secret_key"`
+	Passphrase string `json:"passphrase"`
+	BaseURL    string `json:"base_url"`
+	MarginMode string `json:"margin_mode"`
+	Encrypted  bool   `json:"encrypted"`
+	// Settle selects the settle currency of pairs on Gate.io, e.g.
+	// {"BTC_USD": "btc"} for the BTC-settled inverse contract; other pairs
+	// settle in their contract's currency, or usdt
+	Settle map[string]string `json:"settle"`
 }
 
 // APIConfig represents API configuration
 type APIConfig struct {
-	Timeout   int `json:"timeout"`
-	RateLimit int `json:"rate_limit"`
+	BaseURL   string `json:"base_url" env:"API_BASE_URL"`
+	StreamURL string `json:"stream_url" env:"API_STREAM_URL"`
+	Timeout   int    `json:"timeout"`
+
+	// Exchange API calls are throttled per exchange type and endpoint
+	// category ("public", "account", "trading") with built-in limits;
+	// RateLimits overrides them, and RateLimit is the requests per second of
+	// exchanges without limits, 0 leaving them unthrottled
+	RateLimit  int                                   `json:"rate_limit"`
+	RateLimits map[string]map[string]RateLimitConfig `json:"rate_limits"`
+
+	// Calls failing with a timeout, 429, 5xx or an exchange "busy" code are
+	// retried for up to RetryAttempts attempts in total, backing off with
+	// jitter from RetryBaseDelay doubling up to RetryMaxDelay milliseconds
+	RetryAttempts  int `json:"retry_attempts"`
+	RetryBaseDelay int `json:"retry_base_delay"`
+	RetryMaxDelay  int `json:"retry_max_delay"`
+
+	Websocket WebsocketConfig `json:"websocket"`
+
+	// TickerPairs are streamed to ticker consumers (the trading pairs when
+	// empty); each consumer receives at most TickerMaxRate batches per second
+	TickerPairs   []string `json:"ticker_pairs"`
+	TickerMaxRate float64  `json:"ticker_max_rate"`
+
+	// BarIntervals are built live from the trade stream of the ticker pairs,
+	// along with the pair and interval of every strategy instance, which
+	// are evaluated at each bar close; empty disables the trade stream
+	BarIntervals []string `json:"bar_intervals"`
+}
+
+// RateLimitConfig represents the token bucket of an endpoint category: Rate
+// weight units per second in bursts of up to Burst, which defaults to Rate
+type RateLimitConfig struct {
+	Rate  float64 `json:"rate"`
+	Burst float64 `json:"burst"`
+}
+
+// WebsocketConfig represents websocket dial settings for the streamers
+type WebsocketConfig struct {
+	// Proxy is an http, https or socks5 proxy URL; empty uses HTTPS_PROXY
+	Proxy            string            `json:"proxy" env:"WS_PROXY"`
+	Headers          map[string]string `json:"headers"`
+	PingInterval     int               `json:"ping_interval"`
+	HandshakeTimeout int               `json:"handshake_timeout"`
+	Compression      bool              `json:"compression"`
+
+	// StaleAfter is how many seconds a subscribed symbol may go without a
+	// message before it is resubscribed, and its connection replaced if it
+	// stays silent; 0 disables the check
+	StaleAfter int `json:"stale_after"`
 }
 
 // LoggingConfig represents logging configuration
 type LoggingConfig struct {
-	Level string `json:"level"`
-	File  string `json:"file"`
+	Level string `json:"level" env:"LOG_LEVEL"`
+	File  string `json:"file" env:"LOG_FILE"`
+
+	// Format is "text" or "json"; Modules overrides the level per package name
+	Format  string            `json:"format" env:"LOG_FORMAT"`
+	Modules map[string]string `json:"modules"`
+
+	// Language selects the text of catalogued messages, "en" or "zh"; their
+	// ID and fields are logged as structured fields either way
+	Language string `json:"language" env:"LOG_LANGUAGE"`
+
+	// Sinks ship every logged entry to remote storage as well, so logs
+	// outlive the container: "loki" pushes to Loki and "s3" uploads gzipped
+	// JSON lines to an S3 bucket
+	Sinks []string      `json:"sinks" env:"LOG_SINKS"`
+	Loki  LokiLogConfig `json:"loki"`
+	S3    S3LogConfig   `json:"s3"`
+}
+
+// LokiLogConfig represents the Loki log sink: entries are pushed to URL in
+// batches of up to BatchSize every FlushInterval seconds, labelled with Labels
+// and their level
+type LokiLogConfig struct {
+	URL           string            `json:"url" env:"LOKI_URL"`
+	TenantID      string            `json:"tenant_id"`
+	Username      string            `json:"username"`
+	Password      string            `json:"password" env:"LOKI_PASSWORD"`
+	Labels        map[string]string `json:"labels"`
+	BatchSize     int               `json:"batch_size"`
+	FlushInterval int               `json:"flush_interval"`
+}
+
+// S3LogConfig represents the S3 log sink: every FlushInterval seconds, or
+// BatchSize entries, the entries are uploaded as a gzipped JSON lines object
+// under Prefix. Endpoint selects an S3-compatible service such as MinIO,
+// which usually needs PathStyle addressing.
+type S3LogConfig struct {
+	Bucket        string `json:"bucket" env:"LOG_S3_BUCKET"`
+	Region        string `json:"region" env:"AWS_REGION"`
+	Endpoint      string `json:"endpoint"`
+	PathStyle     bool   `json:"path_style"`
+	Prefix        string `json:"prefix"`
+	AccessKey     string `json:"access_key" env:"AWS_ACCESS_KEY_ID"`
+	SecretKey     string `json:"secret_key" env:"AWS_SECRET_ACCESS_KEY"`
+	BatchSize     int    `json:"batch_size"`
+	FlushInterval int    `json:"flush_interval"`
 }
 
 // TradingConfig represents trading configuration
 type TradingConfig struct {
-	DefaultLeverage int64   `json:"default_leverage"`
-	MaxPositionSize float64 `json:"max_position_size"`
+	DefaultLeverage int64    `json:"default_leverage"`
+	MaxPositionSize float64  `json:"max_position_size"`
+	Pairs           []string `json:"pairs"`
+	DefaultExchange string   `json:"default_exchange"`
+
+	// WatchOnly connects with read-only keys for monitoring: positions, PnL
+	// and reports are served while every order placement is disabled
+	WatchOnly bool `json:"watch_only" env:"WATCH_ONLY"`
+
+	// CloseMaxSlippageBps enables limit-with-protection closes when positive
+	CloseMaxSlippageBps float64 `json:"close_max_slippage_bps"`
+	CloseLimitTimeout   int     `json:"close_limit_timeout"`
+
+	// ClientOrderPrefix tags every order placed by this instance; instances
+	// sharing an account and strategies must use prefixes none of which
+	// starts another
+	ClientOrderPrefix     string            `json:"client_order_prefix" env:"CLIENT_ORDER_PREFIX"`
+	StrategyOrderPrefixes map[string]string `json:"strategy_order_prefixes"`
+	OrderStatePath        string            `json:"order_state_path"`
+	StartupOrderCleanup   bool              `json:"startup_order_cleanup" env:"STARTUP_ORDER_CLEANUP"`
+
+	// StartupReconcile matches open orders and positions on every exchange
+	// against the history store on startup: "flag" reports discrepancies and
+	// engages the kill switch, "adopt" records orphans as our own; empty
+	// disables it
+	StartupReconcile string `json:"startup_reconcile" env:"STARTUP_RECONCILE"`
+
+	// TriggerPriceType is the default price SL/TP orders trigger on (last, mark or index)
+	TriggerPriceType string `json:"trigger_price_type"`
+
+	// FlattenAt closes every position (or only those tagged with one of
+	// FlattenStrategies) daily at this UTC time ("HH:MM"); empty disables it.
+	// Warnings are raised FlattenWarnings minutes ahead
+	FlattenAt         string   `json:"flatten_at" env:"FLATTEN_AT"`
+	FlattenStrategies []string `json:"flatten_strategies"`
+	FlattenWarnings   []int    `json:"flatten_warnings"`
+
+	// Sizing converts strategy signals into order quantities
+	Sizing SizingConfig `json:"sizing"`
+
+	// Positions held longer than MaxHoldingMinutes are closed with a
+	// "time-stop" exit reason, or only flagged for review when TimeStopAction
+	// is "flag"; 0 disables it. HoldingLimits overrides both per strategy name
+	// or currency pair, a pair taking precedence. Positions are checked every
+	// TimeStopInterval seconds
+	MaxHoldingMinutes int                     `json:"max_holding_minutes"`
+	TimeStopAction    string                  `json:"time_stop_action"`
+	HoldingLimits     map[string]HoldingLimit `json:"holding_limits"`
+	TimeStopInterval  int                     `json:"time_stop_interval"`
+
+	// Replication copies the trades of signal sources (leaders), by source name
+	Replication map[string]ReplicationSource `json:"replication"`
+
+	// TradingView turns TradingView alerts posted to /api/webhook/tradingview
+	// into orders
+	TradingView TradingViewConfig `json:"tradingview"`
+}
+
+// TradingViewConfig represents the TradingView alert webhook, enabled by a
+// Secret shared with the alerts: either their "secret" field or the hex
+// HMAC-SHA256 of the body in the X-Signature header. Orders go to Exchange
+// under Strategy unless the alert names others; Symbols maps alert symbols
+// (e.g. "BTCUSDT.P") to pairs where the quote can't be told apart, and
+// MaxNotional rejects larger entries (0 means uncapped).
+type TradingViewConfig struct {
+	Secret      string            `json:"secret" env:"TRADINGVIEW_SECRET"`
+	Exchange    string            `json:"exchange"`
+	Strategy    string            `json:"strategy"`
+	Symbols     map[string]string `json:"symbols"`
+	MaxNotional float64           `json:"max_notional"`
+
+	// ReplayWindow is how many seconds after firing an alert is accepted,
+	// once; alerts carry the time in "timestamp" and optionally an "id".
+	// 0 disables replay protection.
+	ReplayWindow int `json:"replay_window"`
+}
+
+// ReplicationSource represents how the trades of a signal source are
+// copied to Exchange under Strategy: Mode "fixed" trades Amount contracts,
+// "proportional" the leader's amount scaled by our equity over the leader's
+// and Multiplier (1 when zero). MaxNotional caps a copied entry (0 means uncapped).
+// Entries are skipped when they'd leave less than MinFreeMargin of the
+// equity free (a fraction) or the risk limits refuse them.
+type ReplicationSource struct {
+	Exchange      string  `json:"exchange"`
+	Strategy      string  `json:"strategy"`
+	Mode          string  `json:"mode"`
+	Amount        float64 `json:"amount"`
+	Multiplier    float64 `json:"multiplier"`
+	MaxNotional   float64 `json:"max_notional"`
+	Leverage      int64   `json:"leverage"`
+	MinFreeMargin float64 `json:"min_free_margin"`
+}
+
+// HoldingLimit represents the maximum holding time of a strategy or pair
+type HoldingLimit struct {
+	MaxMinutes int    `json:"max_minutes"`
+	Action     string `json:"action"`
+}
+
+// SizingConfig represents position sizing configuration. Method is
+// fixed_fraction (Fraction of the balance as margin), volatility (Fraction of
+// the balance risked on a stop ATRMultiple ATRs of ATRInterval candles away)
+// or kelly (the Kelly fraction of WinRate and Payoff, capped at KellyCap)
+type SizingConfig struct {
+	Method      string  `json:"method"`
+	Fraction    float64 `json:"fraction"`
+	ATRPeriod   int     `json:"atr_period"`
+	ATRInterval string  `json:"atr_interval"`
+	ATRMultiple float64 `json:"atr_multiple"`
+	WinRate     float64 `json:"win_rate"`
+	Payoff      float64 `json:"payoff"`
+	KellyCap    float64 `json:"kelly_cap"`
 }
 
 // SecurityConfig represents security configuration
 type SecurityConfig struct {
-	EncryptionEnabled bool   `json:"encryption_enabled"`
-	EncryptionKeyPath string `json:"encryption_key_path"`
+	// With encryption enabled, exchange credentials are read from the
+	// AES-GCM encrypted SecretsPath file (and decrypted from exchanges marked
+	// as encrypted) with the key at EncryptionKeyPath, instead of from the
+	// environment
+	EncryptionEnabled bool   `json:"encryption_enabled" env:"ENCRYPTION_ENABLED"`
+	EncryptionKeyPath string `json:"encryption_key_path" env:"ENCRYPTION_KEY_PATH"`
+	SecretsPath       string `json:"secrets_path" env:"SECRETS_PATH"`
+
+	// AuditKeyPath enables the order audit trail in the history store, each
+	// record HMAC signed and chained with the key in this file (see nofx
+	// generate-key and nofx verify-audit)
+	AuditKeyPath string `json:"audit_key_path" env:"AUDIT_KEY_PATH"`
+
+	// AuthEnabled protects the API with static API keys (X-API-Key header)
+	// for machine clients and JWT bearer tokens issued by /api/auth/login;
+	// Users maps usernames to bcrypt password hashes
+	AuthEnabled bool              `json:"auth_enabled" env:"AUTH_ENABLED"`
+	APIKeys     []string          `json:"api_keys" env:"API_KEYS"`
+	JWTSecret   string            `json:"jwt_secret" env:"JWT_SECRET"`
+	TokenTTL    int               `json:"token_ttl"`
+	Users       map[string]string `json:"users"`
+}
+
+// MonitorConfig represents account monitoring configuration
+type MonitorConfig struct {
+	BalanceDriftEnabled   bool    `json:"balance_drift_enabled" env:"BALANCE_DRIFT_ENABLED"`
+	BalanceDriftInterval  int     `json:"balance_drift_interval"`
+	BalanceDriftTolerance float64 `json:"balance_drift_tolerance"`
+
+	// BracketCheckInterval is the protective order check period in seconds; 0 disables it
+	BracketCheckInterval int `json:"bracket_check_interval"`
+
+	// TrailingCheckInterval is the price check period of emulated trailing stops in seconds
+	TrailingCheckInterval int `json:"trailing_check_interval"`
+
+	// IntentCheckInterval is the condition check period of queued trade
+	// intents in seconds; intents queued without a TTL expire after
+	// IntentDefaultTTL minutes
+	IntentCheckInterval int `json:"intent_check_interval"`
+	IntentDefaultTTL    int `json:"intent_default_ttl"`
+
+	// DailyReportHour is the UTC hour at which the daily report is generated
+	DailyReportEnabled bool `json:"daily_report_enabled" env:"DAILY_REPORT_ENABLED"`
+	DailyReportHour    int  `json:"daily_report_hour"`
+
+	// ActivityWindow is the trailing period in days of the turnover and trade
+	// frequency statistics in /api/stats and the daily report
+	ActivityWindow int `json:"activity_window"`
+
+	// TCAWindow is the trailing period in days of the trade cost analysis in
+	// /api/stats/tca and the daily report; it needs candles.cache_dir
+	TCAWindow int `json:"tca_window"`
+
+	// HeartbeatInterval is the venue connectivity ping period in seconds; 0 disables it
+	HeartbeatInterval int `json:"heartbeat_interval"`
+
+	// AnnouncementInterval is the exchange announcement poll period in seconds;
+	// 0 disables it. AutoWatchListings adds perpetuals announced as new
+	// listings to the screener watchlist.
+	AnnouncementInterval int  `json:"announcement_interval"`
+	AutoWatchListings    bool `json:"auto_watch_listings"`
+
+	// PnLCheckInterval is the unrealized PnL check period in seconds; 0 disables it.
+	// A position alerts when its unrealized loss exceeds PnLLossAmount (settle
+	// currency) or PnLLossPercent (of its margin); PnLThresholds overrides both
+	// per currency pair.
+	PnLCheckInterval int                     `json:"pnl_check_interval"`
+	PnLLossAmount    float64                 `json:"pnl_loss_amount"`
+	PnLLossPercent   float64                 `json:"pnl_loss_percent"`
+	PnLThresholds    map[string]PnLThreshold `json:"pnl_thresholds"`
+
+	// LiquidationDistance alerts when a position's mark price comes within
+	// this percentage of the mark price from its liquidation price; 0
+	// disables it. Checked with the unrealized PnL.
+	LiquidationDistance float64 `json:"liquidation_distance"`
+
+	// DustCheckInterval is the period in seconds of the search for positions
+	// below their contract's minimums; 0 disables it. DustAction "close"
+	// closes them fully and "merge" folds them into the next entry on the pair
+	DustCheckInterval int    `json:"dust_check_interval"`
+	DustAction        string `json:"dust_action"`
+}
+
+// PnLThreshold represents a position's unrealized loss alert threshold; 0 disables either
+type PnLThreshold struct {
+	LossAmount  float64 `json:"loss_amount"`
+	LossPercent float64 `json:"loss_percent"`
+}
+
+// StrategyConfig represents strategy runtime configuration
+type StrategyConfig struct {
+	// The re-optimization job sweeps each live strategy's parameters over the
+	// last ReoptimizeWindow candles every ReoptimizeInterval hours and proposes
+	// parameters improving the Sharpe ratio by at least ReoptimizeMinImprovement
+	ReoptimizeEnabled        bool    `json:"reoptimize_enabled" env:"REOPTIMIZE_ENABLED"`
+	ReoptimizeInterval       int     `json:"reoptimize_interval"`
+	ReoptimizeWindow         int     `json:"reoptimize_window"`
+	ReoptimizeMinImprovement float64 `json:"reoptimize_min_improvement"`
+	ReoptimizeAutoApply      bool    `json:"reoptimize_auto_apply"`
+	BacktestFeeBps           float64 `json:"backtest_fee_bps"`
+
+	// BacktestWindow is the number of candles candidates submitted for
+	// promotion are backtested over
+	BacktestWindow int `json:"backtest_window"`
+
+	// Entries that would pay funding within FundingEntryWindow minutes of a
+	// funding timestamp are delayed until just after it, and exits planned
+	// within FundingExitWindow minutes after one are brought forward; 0
+	// disables either. Funding overrides both per strategy name.
+	FundingEntryWindow int                      `json:"funding_entry_window"`
+	FundingExitWindow  int                      `json:"funding_exit_window"`
+	Funding            map[string]FundingTiming `json:"funding"`
+
+	// Randomize varies the entry orders of the listed strategies so they
+	// leave no regular footprint, each recorded in the audit trail
+	Randomize map[string]OrderRandomization `json:"randomize"`
+
+	// ShadowAccounts trade their strategy mixes on paper against the live
+	// candles, evaluated every ShadowInterval seconds, for comparing
+	// configurations before they get real capital
+	ShadowInterval int                   `json:"shadow_interval"`
+	ShadowAccounts []ShadowAccountConfig `json:"shadow_accounts"`
+}
+
+// ShadowAccountConfig represents a virtual account and its strategy mix
+type ShadowAccountConfig struct {
+	Name       string                 `json:"name"`
+	Capital    float64                `json:"capital"`
+	Strategies []ShadowStrategyConfig `json:"strategies"`
+}
+
+// ShadowStrategyConfig represents a strategy of a virtual account; Weight is
+// the fraction of the account's capital it trades
+type ShadowStrategyConfig struct {
+	Strategy string             `json:"strategy"`
+	Pair     string             `json:"pair"`
+	Interval string             `json:"interval"`
+	Params   map[string]float64 `json:"params"`
+	Weight   float64            `json:"weight"`
+}
+
+// OrderRandomization represents how much a strategy's entry orders vary:
+// the amount by up to ±SizeJitter (0.1 = 10%) and the sending by a delay of
+// up to TimingJitter seconds
+type OrderRandomization struct {
+	SizeJitter   float64 `json:"size_jitter"`
+	TimingJitter int     `json:"timing_jitter"`
 }
 
-// Load loads configuration from file or environment variables
+// FundingTiming represents a strategy's funding windows in minutes
+type FundingTiming struct {
+	EntryWindow int `json:"entry_window"`
+	ExitWindow  int `json:"exit_window"`
+}
+
+// CandleConfig represents candle store retention: 1m candles older than
+// Retention1m hours are compacted into 5m candles, 5m older than Retention5m
+// days into 1h and 1h older than Retention1h days into 1d, which are kept.
+// With a database the compacted candles persist in the history store.
+type CandleConfig struct {
+	Retention1m int `json:"retention_1m"`
+	Retention5m int `json:"retention_5m"`
+	Retention1h int `json:"retention_1h"`
+
+	// CompactInterval is the compaction period in minutes; 0 disables it
+	CompactInterval int `json:"compact_interval"`
+
+	// CacheDir caches downloaded candle and funding rate history as CSV files;
+	// empty disables bulk candle downloads beyond a single request and keeps
+	// funding history in memory
+	CacheDir string `json:"cache_dir"`
+
+	// PatternInterval is the candle interval the trading pairs are scanned
+	// on for candlestick patterns as each candle closes, published as
+	// "pattern" market events; empty disables the scan
+	PatternInterval string `json:"pattern_interval"`
+}
+
+// FleetConfig represents leader-follower configuration sync. A leader
+// serves the fields listed in Publish, HMAC signed with the key at KeyPath,
+// at /api/fleet/config; followers poll LeaderURL every Interval seconds with
+// the same key, verify the signature and apply the fields on the hot reload
+// path. Followers keep their local value of the Overrides fields the leader
+// lists in PermitOverrides.
+type FleetConfig struct {
+	// Role is "leader", "follower" or empty for a standalone instance
+	Role    string   `json:"role" env:"FLEET_ROLE"`
+	KeyPath string   `json:"key_path" env:"FLEET_KEY_PATH"`
+	Publish []string `json:"publish"`
+	// PermitOverrides lists the published fields followers may override
+	PermitOverrides []string `json:"permit_overrides"`
+
+	LeaderURL string   `json:"leader_url" env:"FLEET_LEADER_URL"`
+	APIKey    string   `json:"api_key" env:"FLEET_API_KEY"`
+	Interval  int      `json:"interval"`
+	Overrides []string `json:"overrides"`
+}
+
+// SchedulerConfig represents the periodic jobs run by the scheduler
+type SchedulerConfig struct {
+	Jobs []JobConfig `json:"jobs"`
+}
+
+// JobConfig represents a periodic job. Type selects what it does:
+// "rebalance" trades the positions of Exchange to the signed notionals of
+// Targets once they drift more than Tolerance from them, "pnl_snapshot"
+// records the PnL of the previous UTC day, "funding_check" warns about open
+// positions paying a funding rate above MaxFundingRate and "stale_orders"
+// cancels our open orders older than MaxAge minutes on Pairs, defaulting to
+// the trading pairs.
+//
+// A job runs at the UTC times of day listed in At ("HH:MM"), every Every
+// minutes, and BeforeFunding minutes before each funding timestamp of Pairs;
+// any combination may be set.
+type JobConfig struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	At            []string `json:"at"`
+	Every         int      `json:"every"`
+	BeforeFunding int      `json:"before_funding"`
+	Disabled      bool     `json:"disabled"`
+
+	// Exchange defaults to the default exchange for rebalances, and to
+	// every exchange for the other jobs
+	Exchange string   `json:"exchange"`
+	Pairs    []string `json:"pairs"`
+
+	Targets        map[string]float64 `json:"targets"`
+	Tolerance      float64            `json:"tolerance"`
+	MaxFundingRate float64            `json:"max_funding_rate"`
+	MaxAge         int                `json:"max_age"`
+}
+
+// NotifyConfig represents where monitor alarms and risk events are sent.
+// Every event has a severity ("info", "warning" or "critical"), which
+// Severities overrides by event type, e.g. {"time_stop": "warning"}.
+type NotifyConfig struct {
+	Channels   map[string]NotifyChannel `json:"channels"`
+	Severities map[string]string        `json:"severities"`
+	Email      EmailConfig              `json:"email"`
+	Telegram   TelegramConfig           `json:"telegram"`
+}
+
+// TelegramConfig represents the Telegram bot, enabled by BotToken: it posts
+// the events of Severities, or every event when empty, to the chat ChatID
+// and takes commands such as /tag from that chat only
+type TelegramConfig struct {
+	BotToken   string   `json:"bot_token" env:"TELEGRAM_BOT_TOKEN"`
+	ChatID     int64    `json:"chat_id" env:"TELEGRAM_CHAT_ID"`
+	Severities []string `json:"severities"`
+}
+
+// NotifyChannel represents a notification channel: a Discord ("discord") or
+// Slack ("slack") incoming webhook at WebhookURL receiving the events of
+// Severities, or every event when empty. Username overrides the name Discord
+// messages are posted as and Channel the channel of Slack messages.
+type NotifyChannel struct {
+	Type       string   `json:"type"`
+	WebhookURL string   `json:"webhook_url"`
+	Severities []string `json:"severities"`
+	Username   string   `json:"username"`
+	Channel    string   `json:"channel"`
+}
+
+// EmailConfig represents the SMTP notifier, enabled by Host: the critical
+// events of Events (the kill switch engaging, liquidation risk and exchange
+// credential failures by default) are mailed as HTML to To. TLS is
+// "starttls" (port 587) or "implicit" (port 465); plaintext isn't offered.
+// The same event, such as the liquidation risk of one position, is mailed at
+// most once every Throttle minutes. Template is the path of an html/template
+// replacing the built-in body.
+type EmailConfig struct {
+	Host     string   `json:"host" env:"SMTP_HOST"`
+	Port     int      `json:"port"`
+	Username string   `json:"username" env:"SMTP_USERNAME"`
+	Password string   `json:"password" env:"SMTP_PASSWORD"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	TLS      string   `json:"tls"`
+	Events   []string `json:"events"`
+	Throttle int      `json:"throttle"`
+	Template string   `json:"template"`
+}
+
+// RiskConfig represents risk engine configuration
+type RiskConfig struct {
+	Symbols map[string]SymbolProfile `json:"symbols"`
+
+	// Correlation buckets are rebuilt from rolling return correlations; the
+	// combined notional of each bucket is capped at MaxBucketNotional
+	MaxBucketNotional    float64 `json:"max_bucket_notional"`
+	CorrelationThreshold float64 `json:"correlation_threshold"`
+	CorrelationInterval  string  `json:"correlation_interval"`
+	CorrelationWindow    int     `json:"correlation_window"`
+	CorrelationRefresh   int     `json:"correlation_refresh"`
+
+	// VaR is computed over VaRWindow candles of VaRInterval
+	VaRConfidence float64 `json:"var_confidence"`
+	VaRInterval   string  `json:"var_interval"`
+	VaRWindow     int     `json:"var_window"`
+
+	// Pre-trade limits apply to orders opening or increasing a position; zero
+	// disables a limit. A realized loss of MaxDailyLoss in SettleCurrency since
+	// the start of the UTC day engages the kill switch, which blocks new
+	// entries until released
+	MaxPositionNotional float64 `json:"max_position_notional"`
+	MaxTotalExposure    float64 `json:"max_total_exposure"`
+	MaxLeverage         int64   `json:"max_leverage"`
+	MaxDailyLoss        float64 `json:"max_daily_loss"`
+	SettleCurrency      string  `json:"settle_currency"`
+
+	// DailyLossSource selects how the day's realized PnL is measured: the
+	// change of the settlement wallet balance net of transfers ("balance")
+	// or the PnL ledger of the recorded fills, fees and funding payments
+	// ("ledger", needs a database)
+	DailyLossSource string `json:"daily_loss_source"`
+
+	// Once the realized PnL since the start of the UTC day, summed across
+	// exchanges, reaches DailyProfitTarget, the rest of the day either allows
+	// no new entries ("stop") or halves the position and exposure limits
+	// ("halve"); zero disables the lock-in
+	DailyProfitTarget float64 `json:"daily_profit_target"`
+	DailyProfitAction string  `json:"daily_profit_action"`
+
+	// At most MaxOpenPositions positions are open across exchanges and at
+	// most MaxStrategyPositions[name] opened by a strategy; zero disables a
+	// limit. An entry opening a position beyond a limit is rejected
+	// ("reject") or waits up to OpenPositionQueueTimeout seconds for a
+	// position to close ("queue")
+	MaxOpenPositions         int            `json:"max_open_positions"`
+	MaxStrategyPositions     map[string]int `json:"max_strategy_positions"`
+	OpenPositionAction       string         `json:"open_position_action"`
+	OpenPositionQueueTimeout int            `json:"open_position_queue_timeout"`
+
+	// Entries on a pair whose realized volatility, the standard deviation of
+	// the returns over VolatilityWindow candles of VolatilityInterval, rises
+	// above VolatilityThreshold trade at VolatilityLeverageFactor times their
+	// leverage until it falls back below VolatilityRestore (defaults to the
+	// threshold); assessed every VolatilityCheckInterval seconds, a zero
+	// threshold disables the adjustment
+	VolatilityThreshold      float64 `json:"volatility_threshold"`
+	VolatilityRestore        float64 `json:"volatility_restore"`
+	VolatilityLeverageFactor float64 `json:"volatility_leverage_factor"`
+	VolatilityInterval       string  `json:"volatility_interval"`
+	VolatilityWindow         int     `json:"volatility_window"`
+	VolatilityCheckInterval  int     `json:"volatility_check_interval"`
+
+	// Profiles bundle limits switched together at runtime, by name: the
+	// profile named by Profile applies at startup, each ProfileSwitch of
+	// ProfileSchedule switches at a UTC time of day, and the admin API
+	// switches at any time. Zero fields of a profile keep the limits above.
+	Profiles        map[string]RiskProfileConfig `json:"profiles"`
+	Profile         string                       `json:"profile"`
+	ProfileSchedule []ProfileSwitch              `json:"profile_schedule"`
+
+	KillSwitch          bool    `json:"kill_switch" env:"KILL_SWITCH"`
+}
+
+// SymbolProfile represents per-symbol trading hours and liquidity requirements
+type SymbolProfile struct {
+	// EntryHours lists UTC windows ("HH:MM-HH:MM") in which new entries are allowed
+	EntryHours   []string `json:"entry_hours"`
+	MinVolume24h float64  `json:"min_volume_24h"`
+}
+
+// RiskProfileConfig represents a named bundle of risk limits
+type RiskProfileConfig struct {
+	MaxLeverage         int64   `json:"max_leverage"`
+	MaxPositionNotional float64 `json:"max_position_notional"`
+	MaxTotalExposure    float64 `json:"max_total_exposure"`
+	// SizingFraction replaces the fraction of trading.sizing
+	SizingFraction float64 `json:"sizing_fraction"`
+	// Blackouts lists UTC windows ("HH:MM-HH:MM") in which no new entries are allowed
+	Blackouts []string `json:"blackouts"`
+}
+
+// ProfileSwitch represents a scheduled switch to a risk profile at a UTC
+// time of day ("HH:MM")
+type ProfileSwitch struct {
+	At      string `json:"at"`
+	Profile string `json:"profile"`
+}
+
+// Load loads the configuration with the command line arguments of the process;
+// see LoadArgs
 func Load() (*Config, error) {
+	return LoadArgs(os.Args[1:])
+}
+
+// LoadArgs loads the configuration from, in increasing precedence: built-in
+// defaults, the config file, environment variables named by the env struct
+// tags, and command line flags. The config file is the -config flag, or else
+// the first of config.json, config.yaml, config.yml and config.toml found;
+// -set section.field=value overrides any field and may be repeated.
+func LoadArgs(args []string) (*Config, error) {
+	flags, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
 	cfg := &Config{
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
-			Port: getEnv("PORT", "8080"),
+			Host: "0.0.0.0",
+			Port: "8080",
+			StatusPage: true,
+			Metrics: false,
+			HotReload: true,
+			DecimalMode: "float",
+			DecimalPlaces: 8,
+			AccessLog: true,
+		},
+		Database: DatabaseConfig{
+			Driver:           "sqlite3",
+			ConnectionString: "data/nofx.db",
+			SnapshotInterval: 5,
+		},
+		API: APIConfig{
+			BaseURL: "https://api.gateio.ws/api/v4",
+			StreamURL: "wss://fx-ws.gateio.ws/v4/ws/usdt",
+			RetryAttempts:  3,
+			RetryBaseDelay: 250,
+			RetryMaxDelay:  5000,
+			Websocket: WebsocketConfig{
+				Proxy:            "",
+				PingInterval:     20,
+				HandshakeTimeout: 45,
+				StaleAfter:       30,
+			},
+			TickerMaxRate: 4,
+		},
+		Trading: TradingConfig{
+			CloseLimitTimeout:   10,
+			ClientOrderPrefix:   "t-nofx",
+			OrderStatePath:      "data/orders.json",
+			StartupOrderCleanup: false,
+			TriggerPriceType:    "last",
+			FlattenAt:           "",
+			FlattenWarnings:     []int{15, 5},
+			Sizing: SizingConfig{
+				Method:      "fixed_fraction",
+				Fraction:    0.02,
+				ATRPeriod:   14,
+				ATRInterval: "1h",
+				ATRMultiple: 2,
+				KellyCap:    0.25,
+			},
+			TimeStopAction:   "close",
+			TimeStopInterval: 60,
+			TradingView: TradingViewConfig{
+				Strategy:     "tradingview",
+				ReplayWindow: 300,
+			},
+		},
+		Risk: RiskConfig{
+			CorrelationThreshold:     0.7,
+			CorrelationInterval:      "1h",
+			CorrelationWindow:        168,
+			CorrelationRefresh:       60,
+			VaRConfidence:            0.95,
+			VaRInterval:              "1d",
+			VaRWindow:                90,
+			SettleCurrency:           "USDT",
+			DailyLossSource:          "balance",
+			KillSwitch:               false,
+			DailyProfitAction:        "stop",
+			OpenPositionAction:       "reject",
+			OpenPositionQueueTimeout: 60,
+			VolatilityLeverageFactor: 0.5,
+			VolatilityInterval:       "1h",
+			VolatilityWindow:         24,
+			VolatilityCheckInterval:  300,
 		},
 		Logging: LoggingConfig{
-			Level: getEnv("LOG_LEVEL", "info"),
-			File:  getEnv("LOG_FILE", ""),
+			Level:    "info",
+			File:     "",
+			Format:   "text",
+			Language: "en",
+			Loki: LokiLogConfig{
+				Labels:        map[string]string{"app": "nofx"},
+				BatchSize:     500,
+				FlushInterval: 5,
+			},
+			S3: S3LogConfig{
+				Region:        "us-east-1",
+				Prefix:        "logs/",
+				BatchSize:     10000,
+				FlushInterval: 300,
+			},
 		},
 		Security: SecurityConfig{
-			EncryptionEnabled: getEnvBool("ENCRYPTION_ENABLED", false),
-			EncryptionKeyPath: getEnv("ENCRYPTION_KEY_PATH", ""),
+			EncryptionEnabled: false,
+			EncryptionKeyPath: "",
+			SecretsPath:       "data/secrets.enc",
+			AuthEnabled:       false,
+			JWTSecret:         "",
+			TokenTTL:          720,
+		},
+		Monitor: MonitorConfig{
+			BalanceDriftEnabled:   false,
+			BalanceDriftInterval:  60,
+			BalanceDriftTolerance: 0.01,
+			BracketCheckInterval:  30,
+			TrailingCheckInterval: 5,
+			IntentCheckInterval:   10,
+			IntentDefaultTTL:      1440,
+			DailyReportEnabled:    false,
+			ActivityWindow:        30,
+			TCAWindow:             1,
+			HeartbeatInterval:     60,
+			AnnouncementInterval:  300,
+			PnLCheckInterval:      30,
+			DustAction:            "close",
+		},
+		Strategy: StrategyConfig{
+			ReoptimizeEnabled:        false,
+			ReoptimizeInterval:       24,
+			ReoptimizeWindow:         500,
+			ReoptimizeMinImprovement: 0.2,
+			BacktestFeeBps:           5,
+			BacktestWindow:           500,
+			ShadowInterval:           60,
+		},
+		Candles: CandleConfig{
+			Retention1m:     24,
+			Retention5m:     7,
+			Retention1h:     180,
+			CompactInterval: 15,
+			CacheDir:        "data/candles",
+		},
+		Fleet: FleetConfig{
+			Interval: 60,
+		},
+		Notify: NotifyConfig{
+			Email: EmailConfig{
+				Port:     587,
+				TLS:      "starttls",
+				Events:   []string{"kill_switch", "liquidation_risk", "exchange_auth"},
+				Throttle: 30,
+			},
 		},
 	}
 
-	// Try to load from config.json
-	if _, err := os.Stat("config.json"); err == nil {
-		file, err := os.Open("config.json")
-		if err == nil {
-			defer file.Close()
-			if err := json.NewDecoder(file).Decode(cfg); err != nil {
-				return nil, err
-			}
+	if path := flags.file(); path != "" {
+		if err := readConfigFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+	for _, override := range flags.overrides {
+		if err := override.apply(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Credentials come from the encrypted secrets, or else from the
+	// environment overriding the config file
+	if cfg.Security.EncryptionEnabled {
+		if err := loadSecrets(cfg); err != nil {
+			return nil, err
+		}
+	} else {
+		for name, exchange := range cfg.Exchanges {
+			prefix := strings.ToUpper(name) + "_"
+			exchange.APIKey = getEnv(prefix+"API_KEY", exchange.APIKey)
+			exchange.SecretKey = getEnv(prefix+"SECRET_KEY", exchange.SecretKey)
+			exchange.Passphrase = getEnv(prefix+"PASSPHRASE", exchange.Passphrase)
+			cfg.Exchanges[name] = exchange
 		}
 	}
 
+	// Refuse to boot on nonsense rather than failing later or silently
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
-// Helper functions for environment variables
+// getEnv returns an environment variable, or defaultValue when it is unset
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
 		return defaultValue
 	}
 	return value
-}
-
-func getEnvBool(key string, defaultValue bool) bool {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-
-	boolValue, err := strconv.ParseBool(value)
-	if err != nil {
-		return defaultValue
-	}
-
-	return boolValue
 }
\ No newline at end of file
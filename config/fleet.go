@@ -0,0 +1,124 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/nofx/crypto"
+)
+
+// unpublishable lists the sections a fleet leader never publishes: the
+// fleet settings themselves, credentials and the history store
+var unpublishable = []string{"fleet", "security", "exchanges", "database"}
+
+// Publishable reports whether a field, named by its json path, can be
+// published to a fleet
+func Publishable(field string) bool {
+	section, _, _ := strings.Cut(field, ".")
+	return !contains(unpublishable, section)
+}
+
+// FleetDocument represents the configuration a fleet leader publishes:
+// published fields by json path, the fields followers may override and an
+// HMAC signature over the rest of the document. Version is the publication
+// time in unix milliseconds; followers never apply an older document.
+type FleetDocument struct {
+	Version         int64                      `json:"version"`
+	Fields          map[string]json.RawMessage `json:"fields"`
+	PermitOverrides []string                   `json:"permit_overrides"`
+	Signature       string                     `json:"signature,omitempty"`
+}
+
+// FleetDocument returns the unsigned fleet document of the fields c publishes
+func (c *Config) FleetDocument(version int64) (*FleetDocument, error) {
+	doc := &FleetDocument{
+		Version:         version,
+		Fields:          make(map[string]json.RawMessage, len(c.Fleet.Publish)),
+		PermitOverrides: append([]string{}, c.Fleet.PermitOverrides...),
+	}
+	for _, field := range c.Fleet.Publish {
+		v, err := lookup(reflect.ValueOf(c).Elem(), field)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		doc.Fields[field] = data
+	}
+	return doc, nil
+}
+
+// payload returns the signed bytes of the document
+func (d *FleetDocument) payload() ([]byte, error) {
+	unsigned := *d
+	unsigned.Signature = ""
+	return json.Marshal(unsigned)
+}
+
+// Sign signs the document with key
+func (d *FleetDocument) Sign(key []byte) error {
+	payload, err := d.payload()
+	if err != nil {
+		return err
+	}
+	d.Signature = crypto.Sign(key, payload)
+	return nil
+}
+
+// Verify checks the signature of the document against key
+func (d *FleetDocument) Verify(key []byte) error {
+	payload, err := d.payload()
+	if err != nil {
+		return err
+	}
+	if d.Signature == "" || !crypto.Verify(key, payload, d.Signature) {
+		return errors.New("invalid fleet document signature")
+	}
+	return nil
+}
+
+// Overlay sets the fields of a fleet document on c, except the fields of
+// c.Fleet.Overrides the document permits overriding. It returns the local
+// overrides the document does not permit, which are overwritten; on an error
+// c may be partially overlaid.
+func (c *Config) Overlay(d *FleetDocument) (ignored []string, err error) {
+	for _, field := range c.Fleet.Overrides {
+		if _, ok := d.Fields[field]; ok && !contains(d.PermitOverrides, field) {
+			ignored = append(ignored, field)
+		}
+	}
+	for field, data := range d.Fields {
+		if !Publishable(field) {
+			return nil, fmt.Errorf("%s can't be published", field)
+		}
+		if contains(c.Fleet.Overrides, field) && contains(d.PermitOverrides, field) {
+			continue
+		}
+		v, err := lookup(reflect.ValueOf(c).Elem(), field)
+		if err != nil {
+			return nil, err
+		}
+		// Decode into a fresh value so maps and slices are replaced, not merged
+		value := reflect.New(v.Type())
+		if err := json.Unmarshal(data, value.Interface()); err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		v.Set(value.Elem())
+	}
+	return ignored, nil
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
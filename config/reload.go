@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// reloadable lists the fields, by json path, that take effect without a
+// restart when the configuration is reloaded
+var reloadable = map[string]bool{
+	"logging.level":                    true,
+	"logging.modules":                  true,
+	"logging.language":                 true,
+	"risk.max_position_notional":       true,
+	"risk.max_total_exposure":          true,
+	"risk.max_leverage":                true,
+	"risk.max_daily_loss":              true,
+	"risk.daily_loss_source":           true,
+	"risk.daily_profit_target":         true,
+	"risk.daily_profit_action":         true,
+	"risk.max_open_positions":          true,
+	"risk.max_strategy_positions":      true,
+	"risk.open_position_action":        true,
+	"risk.open_position_queue_timeout": true,
+	"risk.profile_schedule":            true,
+	"api.ticker_max_rate":              true,
+	"api.rate_limit":                   true,
+	"api.rate_limits":                  true,
+}
+
+// Reloadable reports whether a field, named by its json path, can change
+// without a restart
+func Reloadable(field string) bool {
+	return reloadable[field]
+}
+
+// Changes returns the json paths of the fields that differ between two
+// configurations, sorted. Sections and maps of sections are compared field
+// by field, e.g. "exchanges.gate.api_key"; other values as a whole.
+func Changes(old, next *Config) []string {
+	changed := diff(reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem(), "", nil)
+	sort.Strings(changed)
+	return changed
+}
+
+// diff appends the paths of the fields differing between a and b
+func diff(a, b reflect.Value, path string, changed []string) []string {
+	switch {
+	case a.Kind() == reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			name := jsonName(a.Type().Field(i))
+			if path != "" {
+				name = path + "." + name
+			}
+			changed = diff(a.Field(i), b.Field(i), name, changed)
+		}
+	case a.Kind() == reflect.Map && a.Type().Key().Kind() == reflect.String && a.Type().Elem().Kind() == reflect.Struct:
+		keys := make(map[string]bool)
+		for _, k := range a.MapKeys() {
+			keys[k.String()] = true
+		}
+		for _, k := range b.MapKeys() {
+			keys[k.String()] = true
+		}
+		for k := range keys {
+			key := reflect.ValueOf(k).Convert(a.Type().Key())
+			av, bv := a.MapIndex(key), b.MapIndex(key)
+			if !av.IsValid() || !bv.IsValid() {
+				changed = append(changed, path+"."+k)
+				continue
+			}
+			changed = diff(av, bv, path+"."+k, changed)
+		}
+	case !reflect.DeepEqual(a.Interface(), b.Interface()):
+		changed = append(changed, path)
+	}
+	return changed
+}
+
+// Apply copies a reloadable field, named by its json path, from next
+func (c *Config) Apply(next *Config, field string) error {
+	if !Reloadable(field) {
+		return fmt.Errorf("%s can't change without a restart", field)
+	}
+	dst, err := lookup(reflect.ValueOf(c).Elem(), field)
+	if err != nil {
+		return err
+	}
+	src, err := lookup(reflect.ValueOf(next).Elem(), field)
+	if err != nil {
+		return err
+	}
+	dst.Set(src)
+	return nil
+}
+
+// lookup returns the struct field at a path of json names
+func lookup(v reflect.Value, path string) (reflect.Value, error) {
+	for _, part := range strings.Split(path, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("%s: %q is not a section", path, part)
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if jsonName(v.Type().Field(i)) == part {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("%s: unknown field %q", path, part)
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/nofx/crypto"
+)
+
+// ExchangeSecret represents the credentials of an exchange account in the
+// encrypted secrets file, which holds a JSON object keyed by exchange name
+type ExchangeSecret struct {
+	APIKey     string `json:"api_key"`
+	SecretKey  string `json:"secret_key"`
+	Passphrase string `json:"passphrase"`
+}
+
+// loadSecrets decrypts exchange credentials with the configured key: fields
+// of exchanges marked as encrypted are decrypted in place, and credentials
+// from the secrets file, when present, replace the configured ones
+func loadSecrets(cfg *Config) error {
+	security := cfg.Security
+	if security.EncryptionKeyPath == "" {
+		return fmt.Errorf("security.encryption_key_path is required when encryption is enabled")
+	}
+	key, err := crypto.LoadKey(security.EncryptionKeyPath)
+	if err != nil {
+		return err
+	}
+
+	for name, exchange := range cfg.Exchanges {
+		if !exchange.Encrypted {
+			continue
+		}
+		for _, field := range []*string{&exchange.APIKey, &exchange.SecretKey, &exchange.Passphrase} {
+			if *field == "" {
+				continue
+			}
+			plaintext, err := crypto.Decrypt(*field, key)
+			if err != nil {
+				return fmt.Errorf("exchanges.%s: failed to decrypt credentials: %v", name, err)
+			}
+			*field = string(plaintext)
+		}
+		cfg.Exchanges[name] = exchange
+	}
+
+	if security.SecretsPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(security.SecretsPath); os.IsNotExist(err) {
+		return nil
+	}
+	plaintext, err := crypto.DecryptFile(security.SecretsPath, key)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %v", security.SecretsPath, err)
+	}
+	var secrets map[string]ExchangeSecret
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", security.SecretsPath, err)
+	}
+
+	if cfg.Exchanges == nil {
+		cfg.Exchanges = make(map[string]ExchangeConfig, len(secrets))
+	}
+	for name, secret := range secrets {
+		exchange := cfg.Exchanges[name]
+		exchange.APIKey = secret.APIKey
+		exchange.SecretKey = secret.SecretKey
+		exchange.Passphrase = secret.Passphrase
+		cfg.Exchanges[name] = exchange
+	}
+	return nil
+}
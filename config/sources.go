@@ -0,0 +1,221 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configFiles are the config files looked for in the working directory, in order
+var configFiles = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// findConfigFile returns the first config file present, "" when there is none
+func findConfigFile() string {
+	for _, name := range configFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// readConfigFile decodes a config file over cfg by its extension. YAML and
+// TOML documents are converted to JSON first, so every format shares the json
+// field names and the defaults of fields they leave out.
+func readConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("%s: unsupported config format %q", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if doc != nil {
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// applyEnv sets every field tagged with env from its environment variable
+// when set; lists are comma separated
+func applyEnv(cfg *Config) error {
+	return walkEnv(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// walkEnv applies the environment to the fields of a struct
+func walkEnv(v reflect.Value, path string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := path + jsonName(field)
+		if field.Type.Kind() == reflect.Struct {
+			if err := walkEnv(v.Field(i), name+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		key := field.Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		if value := os.Getenv(key); value != "" {
+			if err := setValue(v.Field(i), value); err != nil {
+				return fmt.Errorf("%s (from %s): %v", name, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonName returns the config file name of a struct field
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// setValue parses a string into a string, bool, number or string list field
+func setValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+		parts := strings.Split(value, ",")
+		list := reflect.MakeSlice(v.Type(), 0, len(parts))
+		for _, p := range parts {
+			if p = strings.TrimSpace(p); p != "" {
+				list = reflect.Append(list, reflect.ValueOf(p))
+			}
+		}
+		v.Set(list)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// override represents a -set section.field=value flag
+type override struct {
+	path  string
+	value string
+}
+
+// apply sets the field at the override's path, matched by json names
+func (o override) apply(cfg *Config) error {
+	v, err := lookup(reflect.ValueOf(cfg).Elem(), o.path)
+	if err != nil {
+		return fmt.Errorf("-set %v", err)
+	}
+	if err := setValue(v, o.value); err != nil {
+		return fmt.Errorf("-set %s: %v", o.path, err)
+	}
+	return nil
+}
+
+// overrides collects repeated -set flags
+type overrides []override
+
+// String implements the flag.Value interface
+func (o *overrides) String() string {
+	parts := make([]string, len(*o))
+	for i, v := range *o {
+		parts[i] = v.path + "=" + v.value
+	}
+	return strings.Join(parts, " ")
+}
+
+// Set implements the flag.Value interface
+func (o *overrides) Set(s string) error {
+	path, value, ok := strings.Cut(s, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("expected section.field=value, got %q", s)
+	}
+	*o = append(*o, override{path: path, value: value})
+	return nil
+}
+
+// commandLine represents the configuration flags
+type commandLine struct {
+	path      string
+	overrides overrides
+}
+
+// file returns the config file to read, "" when there is none
+func (cl *commandLine) file() string {
+	if cl.path != "" {
+		return cl.path
+	}
+	return findConfigFile()
+}
+
+// File returns the config file LoadArgs reads for the command line
+// arguments, "" when there is none
+func File(args []string) (string, error) {
+	flags, err := parseFlags(args)
+	if err != nil {
+		return "", err
+	}
+	return flags.file(), nil
+}
+
+// parseFlags parses the configuration flags
+func parseFlags(args []string) (*commandLine, error) {
+	cl := &commandLine{}
+	fs := flag.NewFlagSet("nofx", flag.ContinueOnError)
+	fs.StringVar(&cl.path, "config", "", "config file (.json, .yaml, .yml or .toml)")
+	fs.Var(&cl.overrides, "set", "override a config field, e.g. -set trading.default_leverage=5 (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
@@ -0,0 +1,727 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError represents an invalid configuration value; Field is its path in
+// config.json, e.g. "trading.default_leverage"
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Error implements the error interface
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists every invalid value of a configuration
+type ValidationError []FieldError
+
+// Error implements the error interface, one field per line
+func (e ValidationError) Error() string {
+	lines := make([]string, len(e))
+	for i, f := range e {
+		lines[i] = "  " + f.Error()
+	}
+	return fmt.Sprintf("invalid configuration (%d errors):\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+// placeholderSecret prefixes the example secrets of config.json.example
+const placeholderSecret = "change-me"
+
+// validator collects field errors
+type validator struct {
+	errs ValidationError
+}
+
+// fail records an invalid field
+func (v *validator) fail(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// required fails an empty field
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.fail(field, "is required")
+	}
+}
+
+// secret fails an empty secret or one left at the placeholder of
+// config.json.example
+func (v *validator) secret(field, value string) {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "":
+		v.fail(field, "must not be empty")
+	case strings.HasPrefix(value, placeholderSecret):
+		v.fail(field, "is still the example placeholder; set a random value")
+	}
+}
+
+// nonNegative fails a negative field
+func (v *validator) nonNegative(field string, value float64) {
+	if value < 0 {
+		v.fail(field, "must not be negative, got %v", value)
+	}
+}
+
+// positive fails a field that isn't positive
+func (v *validator) positive(field string, value float64) {
+	if value <= 0 {
+		v.fail(field, "must be positive, got %v", value)
+	}
+}
+
+// between fails a field outside [min, max]
+func (v *validator) between(field string, value, min, max float64) {
+	if value < min || value > max {
+		v.fail(field, "must be between %v and %v, got %v", min, max, value)
+	}
+}
+
+// oneOf fails a field that isn't one of the allowed values
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.fail(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// url fails a field that isn't an absolute URL with one of the given schemes
+func (v *validator) url(field, value string, schemes ...string) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		v.fail(field, "must be an absolute URL, got %q", value)
+		return
+	}
+	v.oneOf(field+" scheme", u.Scheme, schemes...)
+}
+
+// clock fails a field that isn't a time of day ("HH:MM")
+func (v *validator) clock(field, value string) {
+	if _, err := time.Parse("15:04", strings.TrimSpace(value)); err != nil {
+		v.fail(field, "must be a time of day (HH:MM), got %q", value)
+	}
+}
+
+// interval fails a field that isn't a candle interval such as "5m" or "1h"
+func (v *validator) interval(field, value string) {
+	if len(value) < 2 || !strings.ContainsRune("smhdw", rune(value[len(value)-1])) {
+		v.fail(field, "must be a candle interval such as 5m or 1h, got %q", value)
+		return
+	}
+	if n, err := strconv.Atoi(value[:len(value)-1]); err != nil || n <= 0 {
+		v.fail(field, "must be a candle interval such as 5m or 1h, got %q", value)
+	}
+}
+
+// logLevels are the accepted log level names
+var logLevels = []string{"debug", "info", "warn", "warning", "error", "fatal"}
+
+// Validate checks ranges, formats and the fields required by enabled
+// features, returning a ValidationError listing every invalid field
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	// Server
+	v.required("server.host", c.Server.Host)
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port <= 0 || port > 65535 {
+		v.fail("server.port", "must be a port number between 1 and 65535, got %q", c.Server.Port)
+	}
+
+	v.oneOf("server.decimal_mode", c.Server.DecimalMode, "float", "string")
+	v.between("server.decimal_places", float64(c.Server.DecimalPlaces), 0, 15)
+	v.nonNegative("server.rate_limit", c.Server.RateLimit)
+	v.nonNegative("server.rate_burst", c.Server.RateBurst)
+	for route, limit := range c.Server.RouteRateLimits {
+		field := "server.route_rate_limits." + route
+		if !strings.HasPrefix(route, "/") {
+			v.fail(field, "must be a route path template such as /api/trading/order")
+		}
+		v.nonNegative(field+".rate", limit.Rate)
+		v.nonNegative(field+".burst", limit.Burst)
+	}
+
+	// Database
+	v.oneOf("database.driver", c.Database.Driver, "", "sqlite3", "postgres")
+	if c.Database.Driver != "" {
+		v.required("database.connection_string", c.Database.ConnectionString)
+	}
+	v.nonNegative("database.snapshot_interval", float64(c.Database.SnapshotInterval))
+
+	// API
+	v.url("api.base_url", c.API.BaseURL, "http", "https")
+	if c.API.StreamURL != "" {
+		v.url("api.stream_url", c.API.StreamURL, "ws", "wss")
+	}
+	v.nonNegative("api.timeout", float64(c.API.Timeout))
+	v.nonNegative("api.rate_limit", float64(c.API.RateLimit))
+	for exchange, categories := range c.API.RateLimits {
+		for category, limit := range categories {
+			field := "api.rate_limits." + exchange + "." + category
+			v.oneOf(field, category, "public", "account", "trading")
+			v.positive(field+".rate", limit.Rate)
+			v.nonNegative(field+".burst", limit.Burst)
+		}
+	}
+	v.positive("api.retry_attempts", float64(c.API.RetryAttempts))
+	v.nonNegative("api.retry_base_delay", float64(c.API.RetryBaseDelay))
+	v.nonNegative("api.retry_max_delay", float64(c.API.RetryMaxDelay))
+	v.nonNegative("api.ticker_max_rate", c.API.TickerMaxRate)
+	for i, interval := range c.API.BarIntervals {
+		v.interval(fmt.Sprintf("api.bar_intervals[%d]", i), interval)
+	}
+	if len(c.API.BarIntervals) > 0 && c.API.StreamURL == "" {
+		v.fail("api.bar_intervals", "needs api.stream_url")
+	}
+	if c.API.Websocket.Proxy != "" {
+		v.url("api.websocket.proxy", c.API.Websocket.Proxy, "http", "https", "socks5")
+	}
+	v.nonNegative("api.websocket.ping_interval", float64(c.API.Websocket.PingInterval))
+	v.nonNegative("api.websocket.handshake_timeout", float64(c.API.Websocket.HandshakeTimeout))
+	v.nonNegative("api.websocket.stale_after", float64(c.API.Websocket.StaleAfter))
+
+	// Logging
+	v.oneOf("logging.level", strings.ToLower(c.Logging.Level), logLevels...)
+	v.oneOf("logging.format", c.Logging.Format, "text", "json")
+	v.oneOf("logging.language", c.Logging.Language, "en", "zh")
+	for module, level := range c.Logging.Modules {
+		v.oneOf("logging.modules."+module, strings.ToLower(level), logLevels...)
+	}
+	for _, sink := range c.Logging.Sinks {
+		v.oneOf("logging.sinks", sink, "loki", "s3")
+		switch sink {
+		case "loki":
+			v.url("logging.loki.url", c.Logging.Loki.URL, "http", "https")
+			v.positive("logging.loki.batch_size", float64(c.Logging.Loki.BatchSize))
+			v.positive("logging.loki.flush_interval", float64(c.Logging.Loki.FlushInterval))
+		case "s3":
+			v.required("logging.s3.bucket", c.Logging.S3.Bucket)
+			v.required("logging.s3.region", c.Logging.S3.Region)
+			if c.Logging.S3.Endpoint != "" {
+				v.url("logging.s3.endpoint", c.Logging.S3.Endpoint, "http", "https")
+			}
+			v.required("logging.s3.access_key", c.Logging.S3.AccessKey)
+			v.required("logging.s3.secret_key", c.Logging.S3.SecretKey)
+			v.positive("logging.s3.batch_size", float64(c.Logging.S3.BatchSize))
+			v.positive("logging.s3.flush_interval", float64(c.Logging.S3.FlushInterval))
+		}
+	}
+
+	c.validateTrading(v)
+	c.validateSecurity(v)
+	c.validateMonitor(v)
+	c.validateRisk(v)
+	c.validateStrategy(v)
+	c.validateFleet(v)
+	c.validateScheduler(v)
+	c.validateNotify(v)
+
+	// Candles
+	v.nonNegative("candles.retention_1m", float64(c.Candles.Retention1m))
+	v.nonNegative("candles.retention_5m", float64(c.Candles.Retention5m))
+	v.nonNegative("candles.retention_1h", float64(c.Candles.Retention1h))
+	v.nonNegative("candles.compact_interval", float64(c.Candles.CompactInterval))
+	if c.Candles.PatternInterval != "" {
+		v.interval("candles.pattern_interval", c.Candles.PatternInterval)
+	}
+
+	// Exchanges
+	for name, exchange := range c.Exchanges {
+		field := "exchanges." + name
+		exchangeType := exchange.Type
+		if exchangeType == "" {
+			exchangeType = name
+		}
+		v.oneOf(field+".type", exchangeType, "gate", "gateio", "okx", "bybit", "kraken")
+		if exchange.MarginMode != "" {
+			v.oneOf(field+".margin_mode", exchange.MarginMode, "cross", "isolated")
+		}
+		if exchange.BaseURL != "" {
+			v.url(field+".base_url", exchange.BaseURL, "http", "https")
+		}
+		for pair, settle := range exchange.Settle {
+			if settle == "" {
+				v.fail(field+".settle."+pair, "must name a settle currency, e.g. usdt or btc")
+			}
+		}
+	}
+	if d := c.Trading.DefaultExchange; d != "" && len(c.Exchanges) > 0 {
+		if _, ok := c.Exchanges[d]; !ok {
+			v.fail("trading.default_exchange", "%q is not a configured exchange", d)
+		}
+	}
+
+	if len(v.errs) > 0 {
+		sort.SliceStable(v.errs, func(i, j int) bool { return v.errs[i].Field < v.errs[j].Field })
+		return v.errs
+	}
+	return nil
+}
+
+// orderPrefixKey returns the part of a client order prefix that tells the
+// orders of a deployment or strategy apart: exchanges strip separators and
+// case, Gate.io adds "t-" and the shortest ID limits keep 14 characters of it
+func orderPrefixKey(prefix string) string {
+	prefix = strings.TrimPrefix(strings.ToLower(prefix), "t-")
+	var b strings.Builder
+	for _, r := range prefix {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	key := b.String()
+	if len(key) > 14 {
+		key = key[:14]
+	}
+	return key
+}
+
+// validateOrderPrefixes fails client order prefixes that are prefixes of
+// each other as the exchanges see them, whose orders couldn't be told apart
+func validateOrderPrefixes(v *validator, prefix string, strategies map[string]string) {
+	fields := map[string]string{"trading.client_order_prefix": prefix}
+	for name, p := range strategies {
+		fields["trading.strategy_order_prefixes."+name] = p
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, a := range names {
+		keyA := orderPrefixKey(fields[a])
+		if keyA == "" {
+			if a != "trading.client_order_prefix" {
+				v.fail(a, "must contain letters or digits")
+			}
+			continue
+		}
+		for _, b := range names[i+1:] {
+			keyB := orderPrefixKey(fields[b])
+			if keyB != "" && (strings.HasPrefix(keyA, keyB) || strings.HasPrefix(keyB, keyA)) {
+				v.fail(a, "overlaps %s: %q and %q can't be told apart on the exchanges", b, fields[a], fields[b])
+			}
+		}
+	}
+}
+
+// validateTrading checks the trading section
+func (c *Config) validateTrading(v *validator) {
+	t := c.Trading
+	v.nonNegative("trading.default_leverage", float64(t.DefaultLeverage))
+	v.nonNegative("trading.max_position_size", t.MaxPositionSize)
+	for i, pair := range t.Pairs {
+		if !strings.Contains(pair, "_") {
+			v.fail(fmt.Sprintf("trading.pairs[%d]", i), "must be a currency pair such as BTC_USDT, got %q", pair)
+		}
+	}
+	v.nonNegative("trading.close_max_slippage_bps", t.CloseMaxSlippageBps)
+	if t.CloseMaxSlippageBps > 0 {
+		v.positive("trading.close_limit_timeout", float64(t.CloseLimitTimeout))
+	}
+	v.required("trading.client_order_prefix", t.ClientOrderPrefix)
+	validateOrderPrefixes(v, t.ClientOrderPrefix, t.StrategyOrderPrefixes)
+	if t.StartupReconcile != "" {
+		v.oneOf("trading.startup_reconcile", t.StartupReconcile, "flag", "adopt")
+		if c.Database.Driver == "" {
+			v.fail("trading.startup_reconcile", "requires a database")
+		}
+	}
+	v.oneOf("trading.trigger_price_type", t.TriggerPriceType, "last", "mark", "index")
+	if t.FlattenAt != "" {
+		v.clock("trading.flatten_at", t.FlattenAt)
+	}
+	for i, minutes := range t.FlattenWarnings {
+		v.positive(fmt.Sprintf("trading.flatten_warnings[%d]", i), float64(minutes))
+	}
+
+	s := t.Sizing
+	v.oneOf("trading.sizing.method", s.Method, "fixed_fraction", "volatility", "kelly")
+	v.between("trading.sizing.fraction", s.Fraction, 0, 1)
+	switch s.Method {
+	case "volatility":
+		v.positive("trading.sizing.atr_period", float64(s.ATRPeriod))
+		v.positive("trading.sizing.atr_multiple", s.ATRMultiple)
+		v.interval("trading.sizing.atr_interval", s.ATRInterval)
+	case "kelly":
+		v.between("trading.sizing.win_rate", s.WinRate, 0, 1)
+		v.positive("trading.sizing.payoff", s.Payoff)
+	}
+	v.between("trading.sizing.kelly_cap", s.KellyCap, 0, 1)
+
+	v.nonNegative("trading.max_holding_minutes", float64(t.MaxHoldingMinutes))
+	v.oneOf("trading.time_stop_action", t.TimeStopAction, "", "close", "flag")
+	for name, limit := range t.HoldingLimits {
+		v.nonNegative("trading.holding_limits."+name+".max_minutes", float64(limit.MaxMinutes))
+		v.oneOf("trading.holding_limits."+name+".action", limit.Action, "", "close", "flag")
+	}
+	if t.MaxHoldingMinutes > 0 || len(t.HoldingLimits) > 0 {
+		v.positive("trading.time_stop_interval", float64(t.TimeStopInterval))
+	}
+
+	for name, r := range t.Replication {
+		field := "trading.replication." + name
+		if r.Exchange != "" {
+			if _, ok := c.Exchanges[r.Exchange]; !ok {
+				v.fail(field+".exchange", "exchange %q is not configured", r.Exchange)
+			}
+		}
+		v.oneOf(field+".mode", r.Mode, "fixed", "proportional")
+		if r.Mode == "fixed" {
+			v.positive(field+".amount", r.Amount)
+		} else {
+			v.nonNegative(field+".multiplier", r.Multiplier)
+		}
+		v.nonNegative(field+".max_notional", r.MaxNotional)
+		v.nonNegative(field+".leverage", float64(r.Leverage))
+		v.between(field+".min_free_margin", r.MinFreeMargin, 0, 1)
+	}
+
+	tv := t.TradingView
+	if tv.Exchange != "" {
+		if _, ok := c.Exchanges[tv.Exchange]; !ok {
+			v.fail("trading.tradingview.exchange", "exchange %q is not configured", tv.Exchange)
+		}
+	}
+	for symbol, pair := range tv.Symbols {
+		if !strings.Contains(pair, "_") {
+			v.fail("trading.tradingview.symbols."+symbol, "must be a currency pair such as BTC_USDT, got %q", pair)
+		}
+	}
+	v.nonNegative("trading.tradingview.max_notional", tv.MaxNotional)
+	v.nonNegative("trading.tradingview.replay_window", float64(tv.ReplayWindow))
+}
+
+// validateSecurity checks the security section
+func (c *Config) validateSecurity(v *validator) {
+	s := c.Security
+	if s.EncryptionEnabled {
+		v.required("security.encryption_key_path", s.EncryptionKeyPath)
+		v.required("security.secrets_path", s.SecretsPath)
+	}
+	if s.AuditKeyPath != "" && c.Database.Driver == "" {
+		v.fail("security.audit_key_path", "requires a database")
+	}
+	if s.AuthEnabled {
+		v.positive("security.token_ttl", float64(s.TokenTTL))
+		if len(s.APIKeys) == 0 && len(s.Users) == 0 {
+			v.fail("security", "auth_enabled requires api_keys or users")
+		}
+		for i, key := range s.APIKeys {
+			v.secret(fmt.Sprintf("security.api_keys[%d]", i), key)
+		}
+		if s.JWTSecret != "" {
+			v.secret("security.jwt_secret", s.JWTSecret)
+		}
+	}
+	for user, hash := range s.Users {
+		if !strings.HasPrefix(hash, "$2") {
+			v.fail("security.users."+user, "must be a bcrypt hash (see nofx hash-password)")
+		}
+	}
+}
+
+// validateMonitor checks the monitor section
+func (c *Config) validateMonitor(v *validator) {
+	m := c.Monitor
+	if m.BalanceDriftEnabled {
+		v.positive("monitor.balance_drift_interval", float64(m.BalanceDriftInterval))
+	}
+	v.nonNegative("monitor.balance_drift_tolerance", m.BalanceDriftTolerance)
+	v.nonNegative("monitor.bracket_check_interval", float64(m.BracketCheckInterval))
+	v.nonNegative("monitor.trailing_check_interval", float64(m.TrailingCheckInterval))
+	v.nonNegative("monitor.intent_check_interval", float64(m.IntentCheckInterval))
+	v.positive("monitor.intent_default_ttl", float64(m.IntentDefaultTTL))
+	v.between("monitor.daily_report_hour", float64(m.DailyReportHour), 0, 23)
+	v.positive("monitor.activity_window", float64(m.ActivityWindow))
+	v.positive("monitor.tca_window", float64(m.TCAWindow))
+	v.nonNegative("monitor.heartbeat_interval", float64(m.HeartbeatInterval))
+	v.nonNegative("monitor.announcement_interval", float64(m.AnnouncementInterval))
+	v.nonNegative("monitor.pnl_check_interval", float64(m.PnLCheckInterval))
+	v.nonNegative("monitor.pnl_loss_amount", m.PnLLossAmount)
+	v.nonNegative("monitor.pnl_loss_percent", m.PnLLossPercent)
+	v.between("monitor.liquidation_distance", m.LiquidationDistance, 0, 100)
+	v.nonNegative("monitor.dust_check_interval", float64(m.DustCheckInterval))
+	v.oneOf("monitor.dust_action", m.DustAction, "close", "merge")
+	for pair, threshold := range m.PnLThresholds {
+		v.nonNegative("monitor.pnl_thresholds."+pair+".loss_amount", threshold.LossAmount)
+		v.nonNegative("monitor.pnl_thresholds."+pair+".loss_percent", threshold.LossPercent)
+	}
+}
+
+// validateRisk checks the risk section
+func (c *Config) validateRisk(v *validator) {
+	r := c.Risk
+	for pair, profile := range r.Symbols {
+		for i, window := range profile.EntryHours {
+			field := fmt.Sprintf("risk.symbols.%s.entry_hours[%d]", pair, i)
+			parts := strings.Split(window, "-")
+			if len(parts) != 2 {
+				v.fail(field, "must be a UTC window (HH:MM-HH:MM), got %q", window)
+				continue
+			}
+			v.clock(field, parts[0])
+			v.clock(field, parts[1])
+		}
+		v.nonNegative("risk.symbols."+pair+".min_volume_24h", profile.MinVolume24h)
+	}
+
+	v.nonNegative("risk.max_bucket_notional", r.MaxBucketNotional)
+	v.between("risk.correlation_threshold", r.CorrelationThreshold, 0, 1)
+	v.interval("risk.correlation_interval", r.CorrelationInterval)
+	v.positive("risk.correlation_window", float64(r.CorrelationWindow))
+	v.positive("risk.correlation_refresh", float64(r.CorrelationRefresh))
+	if r.VaRConfidence <= 0 || r.VaRConfidence >= 1 {
+		v.fail("risk.var_confidence", "must be between 0 and 1 exclusive, got %v", r.VaRConfidence)
+	}
+	v.interval("risk.var_interval", r.VaRInterval)
+	v.positive("risk.var_window", float64(r.VaRWindow))
+	v.nonNegative("risk.max_position_notional", r.MaxPositionNotional)
+	v.nonNegative("risk.max_total_exposure", r.MaxTotalExposure)
+	v.nonNegative("risk.max_leverage", float64(r.MaxLeverage))
+	v.nonNegative("risk.max_daily_loss", r.MaxDailyLoss)
+	v.oneOf("risk.daily_loss_source", r.DailyLossSource, "balance", "ledger")
+	if r.DailyLossSource == "ledger" && c.Database.Driver == "" {
+		v.fail("risk.daily_loss_source", "ledger requires a database")
+	}
+	v.nonNegative("risk.daily_profit_target", r.DailyProfitTarget)
+	v.oneOf("risk.daily_profit_action", r.DailyProfitAction, "stop", "halve")
+	if r.DailyProfitTarget > 0 && r.DailyProfitAction == "halve" && r.MaxPositionNotional <= 0 && r.MaxTotalExposure <= 0 {
+		v.fail("risk.daily_profit_action", "halve needs max_position_notional or max_total_exposure")
+	}
+	v.nonNegative("risk.max_open_positions", float64(r.MaxOpenPositions))
+	for name, max := range r.MaxStrategyPositions {
+		v.nonNegative("risk.max_strategy_positions."+name, float64(max))
+	}
+	v.oneOf("risk.open_position_action", r.OpenPositionAction, "reject", "queue")
+	if r.OpenPositionAction == "queue" {
+		v.positive("risk.open_position_queue_timeout", float64(r.OpenPositionQueueTimeout))
+	}
+	v.nonNegative("risk.volatility_threshold", r.VolatilityThreshold)
+	if r.VolatilityThreshold > 0 {
+		if r.VolatilityRestore > r.VolatilityThreshold {
+			v.fail("risk.volatility_restore", "must not exceed volatility_threshold, got %v", r.VolatilityRestore)
+		}
+		v.nonNegative("risk.volatility_restore", r.VolatilityRestore)
+		if r.VolatilityLeverageFactor <= 0 || r.VolatilityLeverageFactor >= 1 {
+			v.fail("risk.volatility_leverage_factor", "must be between 0 and 1 exclusive, got %v", r.VolatilityLeverageFactor)
+		}
+		v.interval("risk.volatility_interval", r.VolatilityInterval)
+		v.positive("risk.volatility_window", float64(r.VolatilityWindow))
+		v.positive("risk.volatility_check_interval", float64(r.VolatilityCheckInterval))
+	}
+	for name, profile := range r.Profiles {
+		field := "risk.profiles." + name
+		v.nonNegative(field+".max_leverage", float64(profile.MaxLeverage))
+		v.nonNegative(field+".max_position_notional", profile.MaxPositionNotional)
+		v.nonNegative(field+".max_total_exposure", profile.MaxTotalExposure)
+		v.between(field+".sizing_fraction", profile.SizingFraction, 0, 1)
+		for i, window := range profile.Blackouts {
+			field := fmt.Sprintf("%s.blackouts[%d]", field, i)
+			parts := strings.Split(window, "-")
+			if len(parts) != 2 {
+				v.fail(field, "must be a UTC window (HH:MM-HH:MM), got %q", window)
+				continue
+			}
+			v.clock(field, parts[0])
+			v.clock(field, parts[1])
+		}
+	}
+	if _, ok := r.Profiles[r.Profile]; r.Profile != "" && !ok {
+		v.fail("risk.profile", "unknown risk profile %q", r.Profile)
+	}
+	for i, s := range r.ProfileSchedule {
+		field := fmt.Sprintf("risk.profile_schedule[%d]", i)
+		v.clock(field+".at", s.At)
+		if _, ok := r.Profiles[s.Profile]; s.Profile != "" && !ok {
+			v.fail(field+".profile", "unknown risk profile %q", s.Profile)
+		}
+	}
+	v.required("risk.settle_currency", r.SettleCurrency)
+}
+
+// validateStrategy checks the strategy section
+func (c *Config) validateStrategy(v *validator) {
+	s := c.Strategy
+	if s.ReoptimizeEnabled {
+		v.positive("strategy.reoptimize_interval", float64(s.ReoptimizeInterval))
+		v.positive("strategy.reoptimize_window", float64(s.ReoptimizeWindow))
+	}
+	v.nonNegative("strategy.reoptimize_min_improvement", s.ReoptimizeMinImprovement)
+	v.nonNegative("strategy.backtest_fee_bps", s.BacktestFeeBps)
+	v.positive("strategy.backtest_window", float64(s.BacktestWindow))
+	v.nonNegative("strategy.funding_entry_window", float64(s.FundingEntryWindow))
+	v.nonNegative("strategy.funding_exit_window", float64(s.FundingExitWindow))
+	for name, timing := range s.Funding {
+		v.nonNegative("strategy.funding."+name+".entry_window", float64(timing.EntryWindow))
+		v.nonNegative("strategy.funding."+name+".exit_window", float64(timing.ExitWindow))
+	}
+	for name, r := range s.Randomize {
+		v.between("strategy.randomize."+name+".size_jitter", r.SizeJitter, 0, 0.5)
+		v.nonNegative("strategy.randomize."+name+".timing_jitter", float64(r.TimingJitter))
+	}
+	if len(s.ShadowAccounts) > 0 {
+		v.positive("strategy.shadow_interval", float64(s.ShadowInterval))
+	}
+	names := make(map[string]bool, len(s.ShadowAccounts))
+	for i, a := range s.ShadowAccounts {
+		field := fmt.Sprintf("strategy.shadow_accounts[%d]", i)
+		v.required(field+".name", a.Name)
+		if names[a.Name] {
+			v.fail(field+".name", "duplicate account %q", a.Name)
+		}
+		names[a.Name] = true
+		v.positive(field+".capital", a.Capital)
+		if len(a.Strategies) == 0 {
+			v.fail(field+".strategies", "must not be empty")
+		}
+		var weights float64
+		for j, st := range a.Strategies {
+			leg := fmt.Sprintf("%s.strategies[%d]", field, j)
+			v.required(leg+".strategy", st.Strategy)
+			v.required(leg+".pair", st.Pair)
+			v.required(leg+".interval", st.Interval)
+			v.positive(leg+".weight", st.Weight)
+			weights += st.Weight
+		}
+		if weights > 1+1e-9 {
+			v.fail(field+".strategies", "weights must add up to at most 1, got %v", weights)
+		}
+	}
+}
+
+// validateFleet checks the fleet section
+func (c *Config) validateFleet(v *validator) {
+	f := c.Fleet
+	v.oneOf("fleet.role", f.Role, "", "leader", "follower")
+	if f.Role == "" {
+		return
+	}
+	v.required("fleet.key_path", f.KeyPath)
+	switch f.Role {
+	case "leader":
+		if len(f.Publish) == 0 {
+			v.fail("fleet.publish", "a leader must publish at least one field")
+		}
+		for _, field := range f.Publish {
+			if !Publishable(field) {
+				v.fail("fleet.publish", "%s can't be published", field)
+			} else if _, err := lookup(reflect.ValueOf(c).Elem(), field); err != nil {
+				v.fail("fleet.publish", "%v", err)
+			}
+		}
+		for _, field := range f.PermitOverrides {
+			if !contains(f.Publish, field) {
+				v.fail("fleet.permit_overrides", "%s is not published", field)
+			}
+		}
+	case "follower":
+		v.url("fleet.leader_url", f.LeaderURL, "http", "https")
+		v.positive("fleet.interval", float64(f.Interval))
+		for _, field := range f.Overrides {
+			if _, err := lookup(reflect.ValueOf(c).Elem(), field); err != nil {
+				v.fail("fleet.overrides", "%v", err)
+			}
+		}
+	}
+}
+
+// validateNotify checks the notification channels
+func (c *Config) validateNotify(v *validator) {
+	severities := []string{"info", "warning", "critical"}
+	for name, channel := range c.Notify.Channels {
+		field := "notify.channels." + name
+		v.oneOf(field+".type", channel.Type, "discord", "slack")
+		v.url(field+".webhook_url", channel.WebhookURL, "https")
+		for _, severity := range channel.Severities {
+			v.oneOf(field+".severities", severity, severities...)
+		}
+	}
+	for event, severity := range c.Notify.Severities {
+		v.oneOf("notify.severities."+event, severity, severities...)
+	}
+	if telegram := c.Notify.Telegram; telegram.BotToken != "" {
+		if telegram.ChatID == 0 {
+			v.fail("notify.telegram.chat_id", "is required")
+		}
+		for _, severity := range telegram.Severities {
+			v.oneOf("notify.telegram.severities", severity, severities...)
+		}
+	}
+
+	if email := c.Notify.Email; email.Host != "" {
+		v.between("notify.email.port", float64(email.Port), 1, 65535)
+		v.oneOf("notify.email.tls", email.TLS, "starttls", "implicit")
+		if _, err := mail.ParseAddress(email.From); err != nil {
+			v.fail("notify.email.from", "must be an email address, got %q", email.From)
+		}
+		if len(email.To) == 0 {
+			v.fail("notify.email.to", "must list at least one recipient")
+		}
+		for i, to := range email.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				v.fail(fmt.Sprintf("notify.email.to[%d]", i), "must be an email address, got %q", to)
+			}
+		}
+		if len(email.Events) == 0 {
+			v.fail("notify.email.events", "must list at least one event type")
+		}
+		v.nonNegative("notify.email.throttle", float64(email.Throttle))
+	}
+}
+
+// validateScheduler checks the scheduled jobs
+func (c *Config) validateScheduler(v *validator) {
+	names := make(map[string]bool)
+	for i, job := range c.Scheduler.Jobs {
+		field := fmt.Sprintf("scheduler.jobs[%d]", i)
+		v.required(field+".name", job.Name)
+		if names[job.Name] {
+			v.fail(field+".name", "duplicate job %q", job.Name)
+		}
+		names[job.Name] = true
+		v.oneOf(field+".type", job.Type, "rebalance", "pnl_snapshot", "funding_check", "stale_orders")
+		for j, at := range job.At {
+			v.clock(fmt.Sprintf("%s.at[%d]", field, j), at)
+		}
+		v.nonNegative(field+".every", float64(job.Every))
+		v.nonNegative(field+".before_funding", float64(job.BeforeFunding))
+		if len(job.At) == 0 && job.Every == 0 && job.BeforeFunding == 0 {
+			v.fail(field, "needs at, every or before_funding")
+		}
+		if job.BeforeFunding > 0 && len(job.Pairs) == 0 {
+			v.fail(field+".pairs", "before_funding needs the pairs whose funding timestamps to follow")
+		}
+		if _, ok := c.Exchanges[job.Exchange]; job.Exchange != "" && len(c.Exchanges) > 0 && !ok {
+			v.fail(field+".exchange", "%q is not a configured exchange", job.Exchange)
+		}
+
+		switch job.Type {
+		case "rebalance":
+			if len(job.Targets) == 0 {
+				v.fail(field+".targets", "must not be empty")
+			}
+			v.between(field+".tolerance", job.Tolerance, 0, 1)
+		case "pnl_snapshot":
+			if c.Database.Driver == "" {
+				v.fail(field, "pnl_snapshot needs a database")
+			}
+		case "funding_check":
+			v.nonNegative(field+".max_funding_rate", job.MaxFundingRate)
+		case "stale_orders":
+			v.positive(field+".max_age", float64(job.MaxAge))
+		}
+	}
+}
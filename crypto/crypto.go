@@ -3,6 +3,8 @@ package crypto
 import (
 	"crypto/rand"
 	"encoding/base64"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 // GenerateRandomBytes generates random bytes of the specified length
@@ -24,16 +26,16 @@ func GenerateRandomString(length int) (string, error) {
 	return base64.StdEncoding.EncodeToString(bytes), nil
 }
 
-// HashPassword hashes a password using a secure hashing algorithm
+// HashPassword hashes a password using bcrypt
 func HashPassword(password string) (string, error) {
-	// Implementation will use bcrypt or similar
-	// This is a placeholder
-	return "hashed_" + password, nil
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
 }
 
-// CheckPasswordHash verifies a password against a hash
+// CheckPasswordHash verifies a password against a bcrypt hash
 func CheckPasswordHash(password, hash string) bool {
-	// Implementation will verify bcrypt hash
-	// This is a placeholder
-	return "hashed_" + password == hash
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
\ No newline at end of file
@@ -5,9 +5,13 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"io"
 )
 
+// ErrCiphertextTooShort is returned when a ciphertext is shorter than its nonce
+var ErrCiphertextTooShort = errors.New("ciphertext too short")
+
 // Encrypt encrypts plaintext using AES-GCM with the provided key
 func Encrypt(plaintext []byte, key []byte) (string, error) {
 	block, err := aes.NewCipher(key)
@@ -47,7 +51,7 @@ func Decrypt(ciphertextBase64 string, key []byte) ([]byte, error) {
 	}
 
 	if len(ciphertext) < gcm.NonceSize() {
-		return nil, aes.ErrInvalidKey
+		return nil, ErrCiphertextTooShort
 	}
 
 	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the length in bytes of AES-256 keys
+const KeySize = 32
+
+// GenerateKey generates a new random AES-256 key
+func GenerateKey() ([]byte, error) {
+	return GenerateRandomBytes(KeySize)
+}
+
+// WriteKey saves a key base64-encoded to a new file readable only by its
+// owner; an existing file is never overwritten, so a key in use isn't lost
+func WriteKey(path string, key []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadKey reads a key file holding either the raw key or its base64 encoding
+func LoadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == KeySize {
+		return data, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key in %s must be %d bytes, raw or base64-encoded", path, KeySize)
+	}
+	return key, nil
+}
+
+// EncryptFile encrypts plaintext into a file readable only by its owner
+func EncryptFile(path string, plaintext, key []byte) error {
+	ciphertext, err := Encrypt(plaintext, key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(ciphertext+"\n"), 0600)
+}
+
+// DecryptFile decrypts a file written by EncryptFile
+func DecryptFile(path string, key []byte) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decrypt(strings.TrimSpace(string(data)), key)
+}
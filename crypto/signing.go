@@ -0,0 +1,47 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+)
+
+// SignChained returns the hex encoded HMAC-SHA256 of payload chained to the
+// signature of the previous record, so altering, removing or reordering any
+// record breaks every signature after it
+func SignChained(key []byte, previous string, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(previous))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyChained reports whether signature is the chained signature of payload
+func VerifyChained(key []byte, previous string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(SignChained(key, previous, payload)), []byte(signature))
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of payload
+func Sign(key, payload []byte) string {
+	return SignChained(key, "", payload)
+}
+
+// Verify reports whether signature is the signature of payload
+func Verify(key, payload []byte, signature string) bool {
+	return VerifyChained(key, "", payload, signature)
+}
+
+// SignSHA512 returns the hex encoded HMAC-SHA512 of payload, as exchange
+// APIs such as Gate.io v4 sign their requests
+func SignSHA512(key, payload []byte) string {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HashSHA512 returns the hex encoded SHA-512 digest of payload
+func HashSHA512(payload []byte) string {
+	sum := sha512.Sum512(payload)
+	return hex.EncodeToString(sum[:])
+}
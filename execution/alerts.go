@@ -0,0 +1,554 @@
+package execution
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/journal"
+	"github.com/nofx/logger"
+	"github.com/nofx/risk"
+	"github.com/nofx/trader"
+)
+
+// ErrInvalidAlert is returned for alerts missing a field or naming an
+// unknown action
+var ErrInvalidAlert = errors.New("invalid alert")
+
+// ErrReplayedAlert is returned for alerts fired outside the replay window or
+// already received within it
+var ErrReplayedAlert = errors.New("replayed alert")
+
+// maxRecentAlerts is how many handled alerts are kept
+const maxRecentAlerts = 100
+
+// AlertIntent is the intent recorded for the orders of alerts
+const AlertIntent = "tradingview"
+
+// Alert actions: buy and sell enter a position, the close actions exit
+// positions of the symbol, of either or one side
+const (
+	AlertBuy        = "buy"
+	AlertSell       = "sell"
+	AlertClose      = "close"
+	AlertCloseLong  = "close_long"
+	AlertCloseShort = "close_short"
+)
+
+// alertActions maps the accepted action names, including the names
+// TradingView strategies use, to alert actions
+var alertActions = map[string]string{
+	"buy":         AlertBuy,
+	"long":        AlertBuy,
+	"sell":        AlertSell,
+	"short":       AlertSell,
+	"close":       AlertClose,
+	"exit":        AlertClose,
+	"flat":        AlertClose,
+	"close_long":  AlertCloseLong,
+	"exit_long":   AlertCloseLong,
+	"close_short": AlertCloseShort,
+	"exit_short":  AlertCloseShort,
+}
+
+// alertQuotes are the quote currencies recognized at the end of symbols
+// without a separator, longest first
+var alertQuotes = []string{"USDT", "USDC", "USD"}
+
+// AlertNumber is a number of an alert; TradingView renders placeholders
+// such as {{strategy.order.contracts}} inside quotes, so JSON strings are
+// accepted too
+type AlertNumber float64
+
+// UnmarshalJSON accepts a JSON number or a string holding one
+func (n *AlertNumber) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		if s = strings.TrimSpace(s); s == "" {
+			*n = 0
+			return nil
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		*n = AlertNumber(v)
+		return nil
+	}
+	var v float64
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*n = AlertNumber(v)
+	return nil
+}
+
+// AlertTime is the time an alert fired, as RFC 3339 (TradingView's
+// {{timenow}}) or unix seconds or milliseconds
+type AlertTime struct {
+	time.Time
+}
+
+// UnmarshalJSON accepts a JSON string or number
+func (t *AlertTime) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		s = string(b)
+	}
+	s = strings.TrimSpace(s)
+	if s == "" || s == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if v > 1e12 {
+			t.Time = time.UnixMilli(v)
+		} else {
+			t.Time = time.Unix(v, 0)
+		}
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return fmt.Errorf("invalid time %q", s)
+	}
+	t.Time = parsed
+	return nil
+}
+
+// TradingViewAlert represents the JSON message of a TradingView alert. Size
+// is in contracts; an entry with Price is a limit order, and StopLoss and
+// TakeProfit place protective orders for the entry.
+type TradingViewAlert struct {
+	Secret     string      `json:"secret,omitempty"`
+	Symbol     string      `json:"symbol"`
+	Action     string      `json:"action"`
+	Size       AlertNumber `json:"size"`
+	Price      AlertNumber `json:"price,omitempty"`
+	StopLoss   AlertNumber `json:"sl,omitempty"`
+	TakeProfit AlertNumber `json:"tp,omitempty"`
+	Leverage   AlertNumber `json:"leverage,omitempty"`
+	Strategy   string      `json:"strategy,omitempty"`
+	Exchange   string      `json:"exchange,omitempty"`
+	ID         string      `json:"id,omitempty"`
+	Timestamp  AlertTime   `json:"timestamp"`
+}
+
+// AlertPolicy represents how alerts are traded: on Exchange (the default
+// exchange when empty) under Strategy unless the alert names others, with
+// Symbols mapping alert symbols to pairs; entries above MaxNotional are
+// rejected (0 means uncapped). Alerts must have fired within ReplayWindow
+// and are accepted once in it (0 disables the check).
+type AlertPolicy struct {
+	Exchange     string
+	Strategy     string
+	Symbols      map[string]string
+	MaxNotional  float64
+	PriceType    trader.TriggerPriceType
+	ReplayWindow time.Duration
+}
+
+// AlertResult represents the outcome of an alert: the order group of an
+// entry, the closes of an exit, or why it was skipped
+type AlertResult struct {
+	Alert    TradingViewAlert     `json:"alert"`
+	Exchange string               `json:"exchange"`
+	Pair     string               `json:"currency_pair"`
+	Action   string               `json:"action"`
+	Notional float64              `json:"notional,omitempty"`
+	Group    *journal.OrderGroup  `json:"group,omitempty"`
+	Closed   []trader.CloseResult `json:"closed,omitempty"`
+	Skipped  bool                 `json:"skipped"`
+	Reason   string               `json:"reason,omitempty"`
+	// DelayedUntil is when an entry held back by the strategy's funding
+	// policy is placed; its group is recorded as a separate result then
+	DelayedUntil *time.Time `json:"delayed_until,omitempty"`
+	Time         time.Time  `json:"time"`
+}
+
+// AlertRouter converts TradingView alerts into orders. Entries pass the risk
+// engine's trading hours, liquidity and correlation bucket checks before
+// their order group goes through the risk limits of the traders; alerts the
+// risk checks refuse are skipped with the reason. Entries that would pay the
+// upcoming funding are placed after it as the strategy's funding policy
+// requires.
+type AlertRouter struct {
+	traders   *trader.Manager
+	engine    *risk.Engine
+	funding   *FundingTimer
+	contracts ContractSource
+	prices    PriceSource
+	tag       *trader.OrderTag
+	orders    *trader.OrderRegistry
+	journal   *journal.Journal
+	guard     *trader.SlippageGuard
+	policy    AlertPolicy
+
+	mu     sync.Mutex
+	recent []AlertResult
+	// seen maps the alerts received within the replay window to when they
+	// fired
+	seen map[string]time.Time
+}
+
+// NewAlertRouter creates a new alert router; funding may be nil to place
+// entries right away
+func NewAlertRouter(policy AlertPolicy, traders *trader.Manager, engine *risk.Engine, funding *FundingTimer, contracts ContractSource, prices PriceSource,
+	tag *trader.OrderTag, orders *trader.OrderRegistry, j *journal.Journal, guard *trader.SlippageGuard) *AlertRouter {
+	// Symbols are matched case-insensitively
+	symbols := make(map[string]string, len(policy.Symbols))
+	for symbol, pair := range policy.Symbols {
+		symbols[strings.ToUpper(symbol)] = pair
+	}
+	policy.Symbols = symbols
+	return &AlertRouter{
+		traders:   traders,
+		engine:    engine,
+		funding:   funding,
+		contracts: contracts,
+		prices:    prices,
+		tag:       tag,
+		orders:    orders,
+		journal:   j,
+		guard:     guard,
+		policy:    policy,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// checkReplay rejects an alert without a timestamp or fired outside the
+// replay window (ErrInvalidAlert), or already received within it, known by
+// its ID or else its content (ErrReplayedAlert)
+func (r *AlertRouter) checkReplay(alert TradingViewAlert) error {
+	window := r.policy.ReplayWindow
+	if window <= 0 {
+		return nil
+	}
+	if alert.Timestamp.IsZero() {
+		return fmt.Errorf("%w: timestamp is required", ErrInvalidAlert)
+	}
+	now := time.Now()
+	if age := now.Sub(alert.Timestamp.Time); age > window || age < -window {
+		return fmt.Errorf("%w: fired at %s, outside the %s window", ErrReplayedAlert,
+			alert.Timestamp.UTC().Format(time.RFC3339), window)
+	}
+
+	key := alert.ID
+	if key == "" {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		key = hex.EncodeToString(sum[:])
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, fired := range r.seen {
+		if now.Sub(fired) > window {
+			delete(r.seen, k)
+		}
+	}
+	if _, ok := r.seen[key]; ok {
+		return fmt.Errorf("%w: already received", ErrReplayedAlert)
+	}
+	r.seen[key] = alert.Timestamp.Time
+	return nil
+}
+
+// AlertPair returns the currency pair of an alert symbol: a mapped symbol,
+// or the symbol without its "EXCHANGE:" prefix and ".P" perpetual suffix,
+// split before a USDT, USDC or USD quote when it has no separator
+func AlertPair(symbol string, symbols map[string]string) string {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if pair, ok := symbols[symbol]; ok {
+		return pair
+	}
+	if _, rest, found := strings.Cut(symbol, ":"); found {
+		symbol = rest
+	}
+	if pair, ok := symbols[symbol]; ok {
+		return pair
+	}
+	symbol = strings.TrimSuffix(symbol, ".P")
+	symbol = strings.NewReplacer("-", "_", "/", "_").Replace(symbol)
+	if strings.Contains(symbol, "_") {
+		return symbol
+	}
+	for _, quote := range alertQuotes {
+		if base := strings.TrimSuffix(symbol, quote); base != symbol && base != "" {
+			return base + "_" + quote
+		}
+	}
+	return symbol
+}
+
+// Handle trades an alert. Skipped alerts are returned with their reason;
+// errors are returned for invalid alerts (ErrInvalidAlert) and failures to
+// reach the exchange.
+func (r *AlertRouter) Handle(ctx context.Context, alert TradingViewAlert) (*AlertResult, error) {
+	alert.Secret = ""
+	if err := r.checkReplay(alert); err != nil {
+		return nil, err
+	}
+	action, ok := alertActions[strings.ToLower(strings.TrimSpace(alert.Action))]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidAlert, alert.Action)
+	}
+	if alert.Symbol == "" {
+		return nil, fmt.Errorf("%w: symbol is required", ErrInvalidAlert)
+	}
+
+	exchange := alert.Exchange
+	if exchange == "" {
+		exchange = r.policy.Exchange
+	}
+	if exchange == "" {
+		exchange = r.traders.DefaultName()
+	}
+	t, err := r.traders.Get(exchange)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAlert, err)
+	}
+	if alert.Strategy == "" {
+		alert.Strategy = r.policy.Strategy
+	}
+
+	result := &AlertResult{
+		Alert:    alert,
+		Exchange: exchange,
+		Pair:     AlertPair(alert.Symbol, r.policy.Symbols),
+		Action:   action,
+		Time:     time.Now(),
+	}
+	ctx = trader.WithClientOrder(ctx, r.tag, r.orders, trader.ClientOrder{
+		Exchange: exchange,
+		Pair:     result.Pair,
+		Strategy: alert.Strategy,
+		Intent:   AlertIntent,
+	})
+	if action == AlertBuy || action == AlertSell {
+		err = r.enter(ctx, t, result)
+	} else {
+		err = r.exit(ctx, t, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.record(*result)
+	return result, nil
+}
+
+// enter places the entry of an alert and its protective orders as one group
+func (r *AlertRouter) enter(ctx context.Context, t trader.Trader, result *AlertResult) error {
+	alert := result.Alert
+	side := trader.BuySide
+	if result.Action == AlertSell {
+		side = trader.SellSide
+	}
+	amount := float64(alert.Size)
+	if amount <= 0 {
+		return fmt.Errorf("%w: a positive size is required", ErrInvalidAlert)
+	}
+
+	price := float64(alert.Price)
+	if price <= 0 {
+		var err error
+		if price, err = r.prices.Price(result.Pair); err != nil {
+			return err
+		}
+	}
+	// Protective orders must sit on the losing and winning side of the entry
+	sl, tp := float64(alert.StopLoss), float64(alert.TakeProfit)
+	long := side == trader.BuySide
+	if sl > 0 && (sl >= price) == long {
+		return fmt.Errorf("%w: sl %v is on the wrong side of the price %v", ErrInvalidAlert, sl, price)
+	}
+	if tp > 0 && (tp <= price) == long {
+		return fmt.Errorf("%w: tp %v is on the wrong side of the price %v", ErrInvalidAlert, tp, price)
+	}
+
+	contract, err := r.contracts.Get(result.Pair)
+	if err != nil {
+		return err
+	}
+	amount = trader.FloorToStep(amount, contract.QuantityStep)
+	if amount <= 0 || amount < contract.MinQuantity {
+		r.skip(result, fmt.Sprintf("size %v is below the minimum quantity %v", amount, contract.MinQuantity))
+		return nil
+	}
+	result.Notional = trader.QuoteNotional(contract, amount, price)
+	if max := r.policy.MaxNotional; max > 0 && result.Notional > max {
+		r.skip(result, fmt.Sprintf("notional %.2f exceeds the maximum %.2f", result.Notional, max))
+		return nil
+	}
+
+	if r.engine != nil {
+		if err := r.engine.CheckEntry(result.Pair); err != nil {
+			r.skip(result, err.Error())
+			return nil
+		}
+		positions, err := t.GetPositions(ctx)
+		if err != nil {
+			return err
+		}
+		if err := r.engine.CheckBucketExposure(result.Pair, result.Notional, positions, r.contracts); err != nil {
+			r.skip(result, err.Error())
+			return nil
+		}
+	}
+
+	entry := Leg{
+		Exchange: result.Exchange,
+		Kind:     OrderLeg,
+		Pair:     result.Pair,
+		Side:     side,
+		Type:     trader.MarketOrder,
+		Amount:   amount,
+		Leverage: int64(alert.Leverage),
+	}
+	if alert.Price > 0 {
+		entry.Type, entry.Price = trader.LimitOrder, float64(alert.Price)
+	}
+	legs := []Leg{entry}
+	for _, protective := range []struct {
+		kind  LegKind
+		price float64
+	}{{StopLossLeg, sl}, {TakeProfitLeg, tp}} {
+		if protective.price > 0 {
+			legs = append(legs, Leg{
+				Exchange:     result.Exchange,
+				Kind:         protective.kind,
+				Pair:         result.Pair,
+				Side:         side,
+				Amount:       amount,
+				TriggerPrice: protective.price,
+				PriceType:    r.policy.PriceType,
+			})
+		}
+	}
+
+	if r.funding != nil {
+		delay, err := r.funding.EntryDelay(alert.Strategy, result.Pair, side, result.Time)
+		if err != nil {
+			logger.Warning("Failed to time the %s alert entry around funding: %v", result.Pair, err)
+		}
+		if delay > 0 {
+			until := result.Time.Add(delay)
+			result.DelayedUntil = &until
+			logger.Info("TradingView alert entry of %s %s on %s delayed until %s, after funding",
+				result.Pair, side, result.Exchange, until.Format(time.RFC3339))
+			r.delay(ctx, t, *result, legs, delay)
+			return nil
+		}
+	}
+	return r.place(ctx, t, result, legs)
+}
+
+// delay places the order group of an entry after delay, in the background,
+// and records its outcome as a new result
+func (r *AlertRouter) delay(ctx context.Context, t trader.Trader, result AlertResult, legs []Leg, delay time.Duration) {
+	// The request that raised the alert is gone by then; its client order
+	// tagging carries over
+	o, _ := trader.ClientOrderFrom(ctx)
+	time.AfterFunc(delay, func() {
+		ctx := trader.WithClientOrder(context.Background(), r.tag, r.orders, o)
+		result.DelayedUntil, result.Time = nil, time.Now()
+		if err := r.place(ctx, t, &result, legs); err != nil {
+			r.skip(&result, err.Error())
+		}
+		r.record(result)
+	})
+}
+
+// place places the order group of an entry
+func (r *AlertRouter) place(ctx context.Context, t trader.Trader, result *AlertResult, legs []Leg) error {
+	side, amount := legs[0].Side, legs[0].Amount
+	group, err := PlaceGroup(ctx, func(string) (trader.Trader, error) { return t, nil }, legs, r.journal)
+	switch {
+	case err == nil:
+	case !errors.Is(err, ErrGroupFailed):
+		return fmt.Errorf("%w: %v", ErrInvalidAlert, err)
+	case risk.IsRejection(err):
+		result.Group = &group
+		r.skip(result, err.Error())
+		return nil
+	default:
+		return err
+	}
+	result.Group = &group
+	logger.Info("TradingView alert entered %s %s %.8f on %s (group %s)", result.Pair, side, amount, result.Exchange, group.ID)
+	return nil
+}
+
+// exit closes the positions of the alert's symbol on the selected sides
+func (r *AlertRouter) exit(ctx context.Context, t trader.Trader, result *AlertResult) error {
+	filter := trader.CloseFilter{Pairs: []string{result.Pair}}
+	switch result.Action {
+	case AlertCloseLong:
+		filter.Side = trader.BuySide
+	case AlertCloseShort:
+		filter.Side = trader.SellSide
+	}
+	positions, err := t.GetPositions(ctx)
+	if err != nil {
+		return err
+	}
+	matched := false
+	for _, p := range positions {
+		if filter.Match(p) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		r.skip(result, "no position to close")
+		return nil
+	}
+
+	result.Closed = trader.CloseBatch(ctx, t, positions, filter, r.guard)
+	for _, c := range result.Closed {
+		if c.Error != "" {
+			logger.Warning("TradingView alert failed to close %s %s on %s: %s", c.Pair, c.Side, result.Exchange, c.Error)
+			continue
+		}
+		logger.Info("TradingView alert closed %s %s on %s", c.Pair, c.Side, result.Exchange)
+	}
+	return nil
+}
+
+// skip marks an alert skipped and logs why
+func (r *AlertRouter) skip(result *AlertResult, reason string) {
+	result.Skipped, result.Reason = true, reason
+	logger.Log(logger.WarningLevel, logger.MsgSignalSkipped,
+		"source", AlertIntent, "symbol", result.Pair, "side", result.Action, "reason", reason)
+}
+
+// record keeps a handled alert
+func (r *AlertRouter) record(result AlertResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recent = append(r.recent, result)
+	if len(r.recent) > maxRecentAlerts {
+		r.recent = r.recent[len(r.recent)-maxRecentAlerts:]
+	}
+}
+
+// Recent returns the alerts handled most recently, newest first
+func (r *AlertRouter) Recent() []AlertResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recent := make([]AlertResult, len(r.recent))
+	for i, a := range r.recent {
+		recent[len(r.recent)-1-i] = a
+	}
+	return recent
+}
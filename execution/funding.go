@@ -0,0 +1,104 @@
+package execution
+
+import (
+	"time"
+
+	"github.com/nofx/trader"
+)
+
+// fundingMargin is how far after a funding timestamp delayed entries are
+// released, and how far before it accelerated exits are due
+const fundingMargin = 30 * time.Second
+
+// FundingPolicy represents how a strategy times orders around funding: entries
+// that would pay funding within EntryWindow are delayed until just after the
+// funding timestamp, and exits that would otherwise happen within ExitWindow
+// after it are brought forward to just before it; zero disables either
+type FundingPolicy struct {
+	EntryWindow time.Duration
+	ExitWindow  time.Duration
+}
+
+// FundingTimer applies per-strategy funding policies to orders
+type FundingTimer struct {
+	contracts ContractSource
+	fallback  FundingPolicy
+	policies  map[string]FundingPolicy
+}
+
+// NewFundingTimer creates a new funding timer; strategies without a policy use fallback
+func NewFundingTimer(contracts ContractSource, fallback FundingPolicy, policies map[string]FundingPolicy) *FundingTimer {
+	return &FundingTimer{
+		contracts: contracts,
+		fallback:  fallback,
+		policies:  policies,
+	}
+}
+
+// policy returns the funding policy of a strategy
+func (f *FundingTimer) policy(strategy string) FundingPolicy {
+	if p, ok := f.policies[strategy]; ok {
+		return p
+	}
+	return f.fallback
+}
+
+// nextFunding returns the next funding time after now and whether a position
+// on side pays it at the current rate
+func (f *FundingTimer) nextFunding(pair string, side trader.Side, now time.Time) (time.Time, bool, error) {
+	contract, err := f.contracts.Get(pair)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if contract.NextFundingTime == 0 {
+		return time.Time{}, false, nil
+	}
+
+	// Cached contracts keep an old funding time; roll it forward by the interval
+	interval := contract.FundingInterval
+	if interval <= 0 {
+		interval = defaultFundingInterval
+	}
+	next := contract.NextFundingTime
+	for next <= now.Unix() {
+		next += interval
+	}
+
+	// Positive funding is paid by longs, negative by shorts
+	pays := (side == trader.BuySide && contract.FundingRate > 0) || (side == trader.SellSide && contract.FundingRate < 0)
+	return time.Unix(next, 0), pays, nil
+}
+
+// EntryDelay returns how long an entry on side should wait so the new
+// position doesn't pay the upcoming funding, or 0 to enter now
+func (f *FundingTimer) EntryDelay(strategy, pair string, side trader.Side, now time.Time) (time.Duration, error) {
+	window := f.policy(strategy).EntryWindow
+	if window <= 0 {
+		return 0, nil
+	}
+	funding, pays, err := f.nextFunding(pair, side, now)
+	if err != nil || !pays || funding.Sub(now) > window {
+		return 0, err
+	}
+	return funding.Sub(now) + fundingMargin, nil
+}
+
+// ExitTime returns when an exit of a position on side planned at the given
+// time should happen: just before the funding timestamp when the plan falls
+// shortly after a funding the position pays, otherwise as planned
+func (f *FundingTimer) ExitTime(strategy, pair string, side trader.Side, planned, now time.Time) (time.Time, error) {
+	window := f.policy(strategy).ExitWindow
+	if window <= 0 {
+		return planned, nil
+	}
+	funding, pays, err := f.nextFunding(pair, side, now)
+	if err != nil || !pays || planned.Before(funding) || planned.Sub(funding) > window {
+		return planned, err
+	}
+
+	early := funding.Add(-fundingMargin)
+	if early.Before(now) {
+		early = now
+	}
+	return early, nil
+}
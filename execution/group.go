@@ -0,0 +1,215 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nofx/journal"
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// LegKind represents the kind of order a group leg places
+type LegKind string
+
+const (
+	// OrderLeg places a regular order
+	OrderLeg LegKind = "order"
+	// StopLossLeg places a stop-loss order
+	StopLossLeg LegKind = "stop_loss"
+	// TakeProfitLeg places a take-profit order
+	TakeProfitLeg LegKind = "take_profit"
+)
+
+// Order group and leg statuses recorded in the journal
+const (
+	GroupPlaced         = "placed"
+	GroupRolledBack     = "rolled_back"
+	GroupRollbackFailed = "rollback_failed"
+
+	LegPlaced         = "placed"
+	LegFailed         = "failed"
+	LegSkipped        = "skipped"
+	LegRolledBack     = "rolled_back"
+	LegRollbackFailed = "rollback_failed"
+)
+
+// ErrGroupFailed is returned when a leg failed and the group was rolled back
+var ErrGroupFailed = errors.New("order group failed")
+
+// Leg represents one order of a multi-leg group; an empty exchange selects the default one
+type Leg struct {
+	Exchange     string                  `json:"exchange,omitempty"`
+	Kind         LegKind                 `json:"kind"`
+	Pair         string                  `json:"currency_pair"`
+	Side         trader.Side             `json:"side"`
+	Type         trader.OrderType        `json:"type,omitempty"`
+	Amount       float64                 `json:"amount"`
+	Price        float64                 `json:"price,omitempty"`
+	Leverage     int64                   `json:"leverage,omitempty"`
+	TriggerPrice float64                 `json:"trigger_price,omitempty"`
+	PriceType    trader.TriggerPriceType `json:"price_type,omitempty"`
+}
+
+// validate checks the leg fields
+func (l Leg) validate() error {
+	if l.Pair == "" {
+		return errors.New("currency_pair is required")
+	}
+	if l.Side != trader.BuySide && l.Side != trader.SellSide {
+		return fmt.Errorf("invalid side %q", l.Side)
+	}
+	if l.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	switch l.Kind {
+	case OrderLeg:
+		if l.Type == trader.LimitOrder && l.Price <= 0 {
+			return errors.New("price is required for limit orders")
+		}
+	case StopLossLeg, TakeProfitLeg:
+		if l.TriggerPrice <= 0 {
+			return errors.New("trigger_price is required for protective orders")
+		}
+	default:
+		return fmt.Errorf("invalid leg kind %q", l.Kind)
+	}
+	return nil
+}
+
+// place submits the leg
+func (l Leg) place(ctx context.Context, t trader.Trader) (*trader.Order, error) {
+	switch l.Kind {
+	case StopLossLeg:
+		return t.SetStopLoss(ctx, l.Pair, l.Side, l.Amount, l.TriggerPrice, l.PriceType)
+	case TakeProfitLeg:
+		return t.SetTakeProfit(ctx, l.Pair, l.Side, l.Amount, l.TriggerPrice, l.PriceType)
+	default:
+		orderType := l.Type
+		if orderType == "" {
+			orderType = trader.MarketOrder
+		}
+		return t.CreateOrder(ctx, trader.OrderRequest{
+			Pair:     l.Pair,
+			Side:     l.Side,
+			Type:     orderType,
+			Amount:   l.Amount,
+			Price:    l.Price,
+			Leverage: l.Leverage,
+		})
+	}
+}
+
+// rollback undoes a placed leg: protective orders are canceled, while the
+// unfilled rest of a regular order is canceled and its filled part closed
+func (l Leg) rollback(ctx context.Context, t trader.Trader, order *trader.Order) error {
+	if l.Kind != OrderLeg {
+		return t.CancelOrder(ctx, order.ID)
+	}
+
+	// Cancel before reading the fills, so none land after they're unwound; a
+	// failed cancel is fine when the order has meanwhile ended
+	var cancelErr error
+	if open(order.Status) {
+		cancelErr = t.CancelOrder(ctx, order.ID)
+	}
+	current, err := t.GetOrder(ctx, order.ID)
+	if err == nil && current == nil {
+		err = errors.New("exchange returned no order")
+	}
+	if cancelErr != nil && (err != nil || open(current.Status)) {
+		return cancelErr
+	}
+	if err != nil {
+		return err
+	}
+	order = current
+
+	filled := order.FilledAmount
+	if filled == 0 && order.Status == trader.OrderStatusFilled {
+		filled = order.Amount
+	}
+	if filled > 0 {
+		_, err := t.ClosePosition(ctx, l.Pair, filled)
+		return err
+	}
+	return nil
+}
+
+// open reports whether an order in status may still fill
+func open(status trader.Status) bool {
+	return status == trader.OrderStatusNew || status == trader.OrderStatusPartiallyFilled
+}
+
+// PlaceGroup submits legs in order with all-or-nothing semantics: when a leg
+// fails, the legs already placed are rolled back in reverse order. The group
+// is recorded in the journal as one unit, and ErrGroupFailed is returned
+// when it was rolled back. The rollback runs even when ctx ends mid-group.
+func PlaceGroup(ctx context.Context, resolve func(exchange string) (trader.Trader, error), legs []Leg, j *journal.Journal) (journal.OrderGroup, error) {
+	group := journal.OrderGroup{Status: GroupPlaced, Legs: make([]journal.GroupLeg, len(legs))}
+	if len(legs) == 0 {
+		return group, errors.New("an order group needs at least one leg")
+	}
+
+	// Validate every leg before placing any
+	traders := make([]trader.Trader, len(legs))
+	for i, leg := range legs {
+		if err := leg.validate(); err != nil {
+			return group, fmt.Errorf("leg %d: %v", i, err)
+		}
+		t, err := resolve(leg.Exchange)
+		if err != nil {
+			return group, fmt.Errorf("leg %d: %v", i, err)
+		}
+		traders[i] = t
+		group.Legs[i] = journal.GroupLeg{
+			Exchange: leg.Exchange,
+			Kind:     string(leg.Kind),
+			Pair:     leg.Pair,
+			Side:     string(leg.Side),
+			Amount:   leg.Amount,
+			Status:   LegSkipped,
+		}
+	}
+	group = j.RecordGroup(group)
+
+	orders := make([]*trader.Order, len(legs))
+	failed := -1
+	var failure error
+	for i, leg := range legs {
+		order, err := leg.place(ctx, traders[i])
+		if err == nil && order == nil {
+			err = errors.New("exchange returned no order")
+		}
+		if err != nil {
+			group.Legs[i].Status, group.Legs[i].Error = LegFailed, err.Error()
+			group.Error = fmt.Sprintf("leg %d (%s %s %s) failed: %v", i, leg.Kind, leg.Side, leg.Pair, err)
+			failed, failure = i, err
+			break
+		}
+		orders[i] = order
+		group.Legs[i].Status, group.Legs[i].OrderID = LegPlaced, order.ID
+	}
+
+	if failed < 0 {
+		logger.Log(logger.InfoLevel, logger.MsgOrderGroupPlaced, "group_id", group.ID, "legs", len(legs))
+		return j.RecordGroup(group), nil
+	}
+
+	group.Status = GroupRolledBack
+	rollbackCtx := context.WithoutCancel(ctx)
+	for i := failed - 1; i >= 0; i-- {
+		if err := legs[i].rollback(rollbackCtx, traders[i], orders[i]); err != nil {
+			group.Status = GroupRollbackFailed
+			group.Legs[i].Status, group.Legs[i].Error = LegRollbackFailed, err.Error()
+			logger.Error("Failed to roll back leg %d of order group %s: %v", i, group.ID, err)
+			continue
+		}
+		group.Legs[i].Status = LegRolledBack
+	}
+	logger.Warning("Order group %s %s: %s", group.ID, group.Status, group.Error)
+	// The leg's error stays inspectable, e.g. for risk rejections
+	return j.RecordGroup(group), fmt.Errorf("%w: leg %d (%s %s %s) failed: %w", ErrGroupFailed,
+		failed, legs[failed].Kind, legs[failed].Side, legs[failed].Pair, failure)
+}
@@ -0,0 +1,94 @@
+package execution
+
+import (
+	"math"
+	"time"
+
+	"github.com/nofx/market"
+	"github.com/nofx/trader"
+)
+
+// ContractSource provides contract metadata, typically the contract cache
+type ContractSource interface {
+	Get(pair string) (*market.ContractInfo, error)
+}
+
+// HeadroomPolicy represents the leverage and exposure policy new positions are sized under
+type HeadroomPolicy struct {
+	Currency    string
+	Leverage    int64
+	ExposureCap float64
+}
+
+// Headroom represents the margin available for new positions
+type Headroom struct {
+	Currency          string    `json:"currency"`
+	Balance           float64   `json:"balance"`
+	UnrealizedPnl     float64   `json:"unrealized_pnl"`
+	Equity            float64   `json:"equity"`
+	InOrders          float64   `json:"in_orders"`
+	Exposure          float64   `json:"exposure"`
+	InitialMargin     float64   `json:"initial_margin"`
+	MaintenanceMargin float64   `json:"maintenance_margin"`
+	FreeMargin        float64   `json:"free_margin"`
+	Withdrawable      float64   `json:"withdrawable"`
+	Leverage          int64     `json:"leverage"`
+	MaxNewNotional    float64   `json:"max_new_notional"`
+	SnapshotTime      time.Time `json:"snapshot_time"`
+}
+
+// ComputeHeadroom derives the margin free for new positions from an account
+// snapshot. The equity is the balance of the policy currency, which includes
+// unrealized PnL, and Balance the part of it excluding unrealized PnL. Open
+// positions, valued with their contract size, hold initial margin at their
+// own leverage (the policy leverage when unknown) and maintenance margin at
+// their contract's maintenance rate; unrealized profit counts towards free
+// margin but is not withdrawable. New notional is sized at the policy
+// leverage and capped by the remaining exposure allowance.
+func ComputeHeadroom(snapshot *trader.Snapshot, contracts ContractSource, policy HeadroomPolicy) *Headroom {
+	leverage := policy.Leverage
+	if leverage <= 0 {
+		leverage = 1
+	}
+	h := &Headroom{
+		Currency:     policy.Currency,
+		Leverage:     leverage,
+		SnapshotTime: snapshot.Time,
+	}
+
+	for _, b := range snapshot.Balances {
+		if b.Currency == policy.Currency {
+			h.Equity += b.Total
+			h.Balance += b.Wallet()
+			h.InOrders += b.InOrders
+		}
+	}
+	h.UnrealizedPnl = h.Equity - h.Balance
+
+	for _, p := range snapshot.Positions {
+		notional := trader.Notional(contracts, p.Pair, p.Size, p.MarkPrice)
+		h.Exposure += notional
+
+		positionLeverage := p.Leverage
+		if positionLeverage <= 0 {
+			positionLeverage = leverage
+		}
+		h.InitialMargin += notional / float64(positionLeverage)
+
+		if contracts != nil {
+			if contract, err := contracts.Get(p.Pair); err == nil {
+				h.MaintenanceMargin += notional * contract.MaintenanceRate
+			}
+		}
+	}
+
+	used := h.InitialMargin + h.InOrders
+	h.FreeMargin = math.Max(0, h.Equity-used)
+	h.Withdrawable = math.Max(0, math.Min(h.FreeMargin, h.Balance-used))
+
+	h.MaxNewNotional = h.FreeMargin * float64(leverage)
+	if policy.ExposureCap > 0 {
+		h.MaxNewNotional = math.Max(0, math.Min(h.MaxNewNotional, policy.ExposureCap-h.Exposure))
+	}
+	return h
+}
@@ -0,0 +1,50 @@
+package execution
+
+import (
+	"context"
+	"math"
+
+	"github.com/nofx/market"
+)
+
+// Mode represents how an order is worked in the market
+type Mode string
+
+const (
+	// ImmediateMode sends the whole order at once
+	ImmediateMode Mode = "immediate"
+	// TWAPMode slices the order over time
+	TWAPMode Mode = "twap"
+)
+
+// Plan represents the execution decision for an order
+type Plan struct {
+	Mode             Mode    `json:"mode"`
+	Size             float64 `json:"size"`
+	MaxImmediateSize float64 `json:"max_immediate_size"`
+	Slices           int     `json:"slices"`
+}
+
+// PlanOrder decides between immediate execution and TWAP by comparing the
+// order size with what the current book can absorb within maxImpactBps
+func PlanOrder(ctx context.Context, depth *market.DepthCalculator, pair string, buy bool, size, maxImpactBps float64) (*Plan, error) {
+	maxSize, err := depth.MaxOrderSize(ctx, pair, buy, maxImpactBps)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Mode:             ImmediateMode,
+		Size:             size,
+		MaxImmediateSize: maxSize,
+		Slices:           1,
+	}
+	if size > maxSize {
+		plan.Mode = TWAPMode
+		if maxSize > 0 {
+			plan.Slices = int(math.Ceil(size / maxSize))
+		}
+	}
+
+	return plan, nil
+}
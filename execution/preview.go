@@ -0,0 +1,100 @@
+package execution
+
+import (
+	"math"
+	"time"
+
+	"github.com/nofx/market"
+	"github.com/nofx/trader"
+)
+
+// defaultFundingInterval is used when the contract doesn't report its funding interval
+const defaultFundingInterval = 8 * 3600
+
+// PreviewRequest represents a prospective trade to be costed
+type PreviewRequest struct {
+	Pair         string      `json:"currency_pair"`
+	Side         trader.Side `json:"side"`
+	Amount       float64     `json:"amount"`
+	Price        float64     `json:"price"`
+	Leverage     int64       `json:"leverage"`
+	HoldingHours float64     `json:"holding_hours"`
+	Strategy     string      `json:"strategy,omitempty"`
+}
+
+// Preview represents the projected costs of a prospective trade
+type Preview struct {
+	Pair string `json:"currency_pair"`
+	// Price is the entry price costed: the requested one, else the mark price
+	Price            float64 `json:"price"`
+	Notional         float64 `json:"notional"`
+	Margin           float64 `json:"margin"`
+	EstimatedFees    float64 `json:"estimated_fees"`
+	FundingRate      float64 `json:"funding_rate"`
+	FundingPeriods   float64 `json:"funding_periods"`
+	ProjectedFunding float64 `json:"projected_funding"`
+	TotalCost        float64 `json:"total_cost"`
+	// EntryDelay is how long the strategy's funding policy holds the entry back, in seconds
+	EntryDelay float64 `json:"entry_delay_seconds"`
+}
+
+// BuildPreview projects the total cost of holding a trade entered at now:
+// round-trip taker fees plus funding at the current rate for every funding
+// time within the expected holding time. A zero price costs the trade at the
+// contract's mark price. Positive funding is paid by longs and received by
+// shorts.
+func BuildPreview(contract *market.ContractInfo, req PreviewRequest, now time.Time) *Preview {
+	price := req.Price
+	if price <= 0 {
+		price = contract.MarkPrice
+	}
+	notional := trader.QuoteNotional(contract, req.Amount, price)
+
+	preview := &Preview{
+		Pair:          req.Pair,
+		Price:         price,
+		Notional:      notional,
+		Margin:        notional,
+		EstimatedFees: 2 * notional * contract.TakerFeeRate,
+		FundingRate:   contract.FundingRate,
+	}
+	if req.Leverage > 0 {
+		preview.Margin = notional / float64(req.Leverage)
+	}
+
+	preview.FundingPeriods = fundingPeriods(contract, now, req.HoldingHours)
+
+	funding := notional * contract.FundingRate * preview.FundingPeriods
+	if req.Side == trader.SellSide {
+		funding = -funding
+	}
+	preview.ProjectedFunding = funding
+	preview.TotalCost = preview.EstimatedFees + funding
+
+	return preview
+}
+
+// fundingPeriods counts the funding times within holdingHours of now,
+// starting from the contract's next funding time; without one, every
+// interval of the holding time is counted
+func fundingPeriods(contract *market.ContractInfo, now time.Time, holdingHours float64) float64 {
+	interval := contract.FundingInterval
+	if interval <= 0 {
+		interval = defaultFundingInterval
+	}
+	holding := holdingHours * 3600
+	if contract.NextFundingTime <= 0 {
+		return math.Floor(holding / float64(interval))
+	}
+
+	// Cached contracts keep an old funding time; roll it forward by the interval
+	next := contract.NextFundingTime
+	for next <= now.Unix() {
+		next += interval
+	}
+	until := float64(next - now.Unix())
+	if until > holding {
+		return 0
+	}
+	return 1 + math.Floor((holding-until)/float64(interval))
+}
@@ -0,0 +1,176 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// RandomizePolicy represents how much a strategy's entry orders vary: the
+// amount by up to ±Size (0.1 = 10%) and the sending by a delay of up to Delay
+type RandomizePolicy struct {
+	Size  float64
+	Delay time.Duration
+}
+
+// Randomization represents how an order was varied, as recorded in the audit trail
+type Randomization struct {
+	Strategy        string  `json:"strategy"`
+	Pair            string  `json:"currency_pair"`
+	RequestedAmount float64 `json:"requested_amount"`
+	Amount          float64 `json:"amount"`
+	// Delay is how long the order was held back, in seconds
+	Delay float64 `json:"delay"`
+}
+
+// Auditor appends records to the audit trail, typically the history store
+type Auditor interface {
+	AppendAudit(exchange, event, reference string, payload interface{}) error
+}
+
+// Randomizer varies the size and timing of the entry orders of strategies
+// that don't want a regular, detectable footprint. Orders without a
+// strategy policy, and reduce-only orders, which must match a position, are
+// sent unchanged.
+type Randomizer struct {
+	contracts ContractSource
+	policies  map[string]RandomizePolicy
+	audit     Auditor
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewRandomizer creates a new order randomizer; audit may be nil to vary
+// orders without recording how
+func NewRandomizer(contracts ContractSource, policies map[string]RandomizePolicy, audit Auditor) *Randomizer {
+	return &Randomizer{
+		contracts: contracts,
+		policies:  policies,
+		audit:     audit,
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Randomize returns the varied order of a strategy and how long to hold it
+// back. The amount is rounded to the contract's quantity step and kept as
+// requested when the varied amount would fall below the minimum quantity.
+func (r *Randomizer) Randomize(strategy string, req trader.OrderRequest) (trader.OrderRequest, time.Duration) {
+	policy, ok := r.policies[strategy]
+	if !ok || req.ReduceOnly {
+		return req, 0
+	}
+
+	r.mu.Lock()
+	factor := 1 + policy.Size*(2*r.rng.Float64()-1)
+	var delay time.Duration
+	if policy.Delay > 0 {
+		delay = time.Duration(r.rng.Int63n(int64(policy.Delay) + 1))
+	}
+	r.mu.Unlock()
+
+	amount := req.Amount * factor
+	if contract, err := r.contracts.Get(req.Pair); err == nil {
+		amount = trader.RoundToStep(amount, contract.QuantityStep)
+		if amount < contract.MinQuantity {
+			amount = req.Amount
+		}
+	}
+	if amount > 0 {
+		req.Amount = amount
+	}
+	return req, delay
+}
+
+// Wrap returns t with the entry orders of randomized strategies varied
+// before they're sent; the strategy is read from the order's client order
+// tagging
+func (r *Randomizer) Wrap(exchange string, t trader.Trader) trader.Trader {
+	return &randomizedTrader{Trader: t, exchange: exchange, randomizer: r}
+}
+
+// randomizedTrader wraps a trader and varies its entry orders
+type randomizedTrader struct {
+	trader.Trader
+
+	exchange   string
+	randomizer *Randomizer
+}
+
+var _ trader.Trader = (*randomizedTrader)(nil)
+
+// Unwrap returns the wrapped trader
+func (t *randomizedTrader) Unwrap() trader.Trader {
+	return t.Trader
+}
+
+// CreateOrder varies the order, waits out its delay and records how it was
+// varied once it was placed
+func (t *randomizedTrader) CreateOrder(ctx context.Context, req trader.OrderRequest) (*trader.Order, error) {
+	o, _ := trader.ClientOrderFrom(ctx)
+	varied, delay := t.randomizer.Randomize(o.Strategy, req)
+	if varied == req && delay == 0 {
+		return t.Trader.CreateOrder(ctx, req)
+	}
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	order, err := t.Trader.CreateOrder(ctx, varied)
+	if err == nil && order == nil {
+		err = errors.New("exchange returned no order")
+	}
+	if err != nil || t.randomizer.audit == nil {
+		return order, err
+	}
+
+	record := Randomization{
+		Strategy:        o.Strategy,
+		Pair:            req.Pair,
+		RequestedAmount: req.Amount,
+		Amount:          varied.Amount,
+		Delay:           delay.Seconds(),
+	}
+	if err := t.randomizer.audit.AppendAudit(t.exchange, "randomization", order.ID, record); err != nil {
+		logger.Warning("Failed to audit randomization of order %s: %v", order.ID, err)
+	}
+	return order, nil
+}
+
+// SetTrailingStop places a native trailing stop through the wrapped trader
+func (t *randomizedTrader) SetTrailingStop(ctx context.Context, pair string, side trader.Side, callbackRate float64) (*trader.Order, error) {
+	return trader.SetTrailingStop(ctx, t.Trader, pair, side, callbackRate)
+}
+
+// GetOrderByClientID looks an order up by its client order ID through the
+// wrapped trader
+func (t *randomizedTrader) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*trader.Order, error) {
+	return trader.GetOrderByClientID(ctx, t.Trader, pair, clientOrderID)
+}
+
+// PositionMode returns the position mode of the wrapped trader's account
+func (t *randomizedTrader) PositionMode(ctx context.Context) (trader.PositionMode, error) {
+	return trader.GetPositionMode(ctx, t.Trader)
+}
+
+// LockSymbol holds the trading lock of pair on the wrapped trader
+func (t *randomizedTrader) LockSymbol(ctx context.Context, pair string) (context.Context, func(), error) {
+	return trader.LockSymbol(ctx, t.Trader, pair)
+}
+
+// GetTransfers lists the account's deposits and withdrawals through the
+// wrapped trader
+func (t *randomizedTrader) GetTransfers(ctx context.Context, since time.Time) ([]trader.Transfer, error) {
+	return trader.GetTransfers(ctx, t.Trader, since)
+}
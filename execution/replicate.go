@@ -0,0 +1,258 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/risk"
+	"github.com/nofx/trader"
+)
+
+// ScalingMode represents how the size of a leader's trade is scaled
+type ScalingMode string
+
+const (
+	// FixedScaling trades a fixed amount whatever the leader's size
+	FixedScaling ScalingMode = "fixed"
+	// ProportionalScaling scales the leader's amount by our equity over the leader's
+	ProportionalScaling ScalingMode = "proportional"
+)
+
+// maxSkippedSignals bounds the history of skipped signals
+const maxSkippedSignals = 200
+
+var (
+	// ErrUnknownSource is returned for a signal from an unconfigured source
+	ErrUnknownSource = errors.New("unknown signal source")
+	// ErrInvalidSignal is returned for a signal missing what its rule needs
+	ErrInvalidSignal = errors.New("invalid signal")
+)
+
+// ReplicationRule represents how the trades of a signal source are copied:
+// to which exchange and strategy, scaled how and capped at what notional.
+// Entries leaving less than MinFreeMargin of the equity free are skipped.
+type ReplicationRule struct {
+	Exchange      string      `json:"exchange"`
+	Strategy      string      `json:"strategy"`
+	Mode          ScalingMode `json:"mode"`
+	Amount        float64     `json:"amount"`
+	Multiplier    float64     `json:"multiplier"`
+	MaxNotional   float64     `json:"max_notional"`
+	Leverage      int64       `json:"leverage"`
+	MinFreeMargin float64     `json:"min_free_margin"`
+}
+
+// LeaderSignal represents a trade of a signal source: its amount in
+// contracts, the price it traded at and the leader's equity, which
+// proportional scaling needs. Reduce-only signals shrink our position.
+type LeaderSignal struct {
+	Pair         string      `json:"currency_pair"`
+	Side         trader.Side `json:"side"`
+	Amount       float64     `json:"amount"`
+	Price        float64     `json:"price"`
+	LeaderEquity float64     `json:"leader_equity"`
+	Leverage     int64       `json:"leverage"`
+	ReduceOnly   bool        `json:"reduce_only"`
+}
+
+// Replication represents the outcome of a signal: the order copying it, or
+// why it was skipped
+type Replication struct {
+	Source   string        `json:"source"`
+	Exchange string        `json:"exchange"`
+	Signal   LeaderSignal  `json:"signal"`
+	Amount   float64       `json:"amount"`
+	Notional float64       `json:"notional"`
+	Capped   bool          `json:"capped"`
+	Skipped  bool          `json:"skipped"`
+	Reason   string        `json:"reason,omitempty"`
+	Order    *trader.Order `json:"order,omitempty"`
+	Time     time.Time     `json:"time"`
+}
+
+// PriceSource provides the last price of a symbol, typically the screener
+type PriceSource interface {
+	Price(pair string) (float64, error)
+}
+
+// Replicator copies the trades of signal sources through the traders, and
+// so the risk guard. Entries are scaled by their source's rule and throttled:
+// a signal is skipped, and logged, when our margin headroom can't carry it
+// or the risk limits refuse it, rather than failing the source.
+type Replicator struct {
+	rules     map[string]ReplicationRule
+	traders   *trader.Manager
+	contracts ContractSource
+	prices    PriceSource
+	tag       *trader.OrderTag
+	orders    *trader.OrderRegistry
+	currency  string
+
+	mu      sync.Mutex
+	skipped []Replication
+}
+
+// NewReplicator creates a new replicator of the signal sources of rules;
+// currency is the settlement currency headroom is computed in
+func NewReplicator(rules map[string]ReplicationRule, traders *trader.Manager, contracts ContractSource, prices PriceSource,
+	tag *trader.OrderTag, orders *trader.OrderRegistry, currency string) *Replicator {
+	return &Replicator{
+		rules:     rules,
+		traders:   traders,
+		contracts: contracts,
+		prices:    prices,
+		tag:       tag,
+		orders:    orders,
+		currency:  currency,
+	}
+}
+
+// Rules returns the replication rule of every source
+func (r *Replicator) Rules() map[string]ReplicationRule {
+	return r.rules
+}
+
+// Skipped returns the signals skipped most recently, newest first
+func (r *Replicator) Skipped() []Replication {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	skipped := make([]Replication, len(r.skipped))
+	for i, s := range r.skipped {
+		skipped[len(r.skipped)-1-i] = s
+	}
+	return skipped
+}
+
+// Replicate copies a signal of source. A signal the throttle refuses is
+// returned skipped with its reason; errors are returned for invalid
+// signals (ErrInvalidSignal) and failures to reach the exchange.
+func (r *Replicator) Replicate(ctx context.Context, source string, signal LeaderSignal) (*Replication, error) {
+	rule, ok := r.rules[source]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSource, source)
+	}
+	if signal.Pair == "" || signal.Amount <= 0 {
+		return nil, fmt.Errorf("%w: currency_pair and a positive amount are required", ErrInvalidSignal)
+	}
+	if signal.Side != trader.BuySide && signal.Side != trader.SellSide {
+		return nil, fmt.Errorf("%w: side must be buy or sell", ErrInvalidSignal)
+	}
+
+	exchange := rule.Exchange
+	if exchange == "" {
+		exchange = r.traders.DefaultName()
+	}
+	t, err := r.traders.Get(exchange)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := trader.TakeSnapshot(ctx, t, r.currency)
+	if err != nil {
+		return nil, err
+	}
+
+	price := signal.Price
+	if price <= 0 {
+		if price, err = r.prices.Price(signal.Pair); err != nil {
+			return nil, err
+		}
+	}
+	contract, err := r.contracts.Get(signal.Pair)
+	if err != nil {
+		return nil, err
+	}
+	// One contract's worth in the quote currency
+	unit := trader.QuoteNotional(contract, 1, price)
+	leverage := rule.Leverage
+	if leverage <= 0 {
+		leverage = signal.Leverage
+	}
+	headroom := ComputeHeadroom(snapshot, r.contracts, HeadroomPolicy{Currency: r.currency, Leverage: leverage})
+
+	result := &Replication{Source: source, Exchange: exchange, Signal: signal, Time: time.Now()}
+	amount := rule.Amount
+	if rule.Mode == ProportionalScaling {
+		if signal.LeaderEquity <= 0 {
+			return nil, fmt.Errorf("%w: proportional scaling needs the leader_equity", ErrInvalidSignal)
+		}
+		multiplier := rule.Multiplier
+		if multiplier <= 0 {
+			multiplier = 1
+		}
+		amount = signal.Amount * headroom.Equity / signal.LeaderEquity * multiplier
+	}
+	if rule.MaxNotional > 0 && amount*unit > rule.MaxNotional {
+		amount = rule.MaxNotional / unit
+		result.Capped = true
+	}
+
+	if signal.ReduceOnly {
+		var held float64
+		for _, p := range snapshot.Positions {
+			if p.Pair == signal.Pair && p.Side != signal.Side {
+				held += p.Size
+			}
+		}
+		if held <= 0 {
+			return r.skip(result, "no position to reduce"), nil
+		}
+		amount = math.Min(amount, held)
+	}
+	result.Amount = trader.FloorToStep(amount, contract.QuantityStep)
+	result.Notional = result.Amount * unit
+	if result.Amount <= 0 || result.Amount < contract.MinQuantity {
+		return r.skip(result, fmt.Sprintf("scaled amount %v is below the minimum quantity %v", result.Amount, contract.MinQuantity)), nil
+	}
+
+	if !signal.ReduceOnly {
+		if result.Notional > headroom.MaxNewNotional {
+			return r.skip(result, fmt.Sprintf("notional %.2f exceeds the margin headroom %.2f", result.Notional, headroom.MaxNewNotional)), nil
+		}
+		margin := result.Notional / float64(headroom.Leverage)
+		if reserve := rule.MinFreeMargin * headroom.Equity; headroom.FreeMargin-margin < reserve {
+			return r.skip(result, fmt.Sprintf("free margin would fall below %.2f", reserve)), nil
+		}
+	}
+
+	ctx = trader.WithClientOrder(ctx, r.tag, r.orders, trader.ClientOrder{
+		Exchange: exchange,
+		Strategy: rule.Strategy,
+		Intent:   "replication:" + source,
+	})
+	order, err := t.CreateOrder(ctx, trader.OrderRequest{
+		Pair:       signal.Pair,
+		Side:       signal.Side,
+		Type:       trader.MarketOrder,
+		Amount:     result.Amount,
+		Leverage:   rule.Leverage,
+		ReduceOnly: signal.ReduceOnly,
+	})
+	if risk.IsRejection(err) {
+		return r.skip(result, err.Error()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Order = order
+	return result, nil
+}
+
+// skip records and logs a skipped signal
+func (r *Replicator) skip(result *Replication, reason string) *Replication {
+	result.Skipped, result.Reason = true, reason
+	logger.Log(logger.WarningLevel, logger.MsgSignalSkipped,
+		"source", result.Source, "symbol", result.Signal.Pair, "side", result.Signal.Side, "reason", reason)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skipped = append(r.skipped, *result)
+	if len(r.skipped) > maxSkippedSignals {
+		r.skipped = r.skipped[len(r.skipped)-maxSkippedSignals:]
+	}
+	return result
+}
@@ -0,0 +1,198 @@
+package execution
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nofx/indicators"
+	"github.com/nofx/market"
+	"github.com/nofx/strategy"
+	"github.com/nofx/trader"
+)
+
+// SizingMethod represents an algorithm converting a signal into an order quantity
+type SizingMethod string
+
+const (
+	// FixedFraction commits a fixed fraction of the balance as margin
+	FixedFraction SizingMethod = "fixed_fraction"
+	// VolatilitySizing risks a fixed fraction of the balance on a stop placed
+	// a multiple of the ATR away from the entry
+	VolatilitySizing SizingMethod = "volatility"
+	// KellySizing commits the Kelly fraction of the balance as margin, capped
+	KellySizing SizingMethod = "kelly"
+)
+
+// SizingPolicy represents the parameters of the sizing algorithms
+type SizingPolicy struct {
+	Method   SizingMethod `json:"method"`
+	Fraction float64      `json:"fraction"`
+	Leverage int64        `json:"leverage"`
+
+	// ATRPeriod and ATRMultiple place the stop of volatility sizing
+	ATRPeriod   int     `json:"atr_period"`
+	ATRMultiple float64 `json:"atr_multiple"`
+
+	// WinRate and Payoff (average win over average loss) feed the Kelly
+	// fraction, which is capped at KellyCap
+	WinRate  float64 `json:"win_rate"`
+	Payoff   float64 `json:"payoff"`
+	KellyCap float64 `json:"kelly_cap"`
+
+	// MaxNotional caps the size of a single order; 0 means unlimited
+	MaxNotional float64 `json:"max_notional"`
+}
+
+// SizeRequest represents a signal to be sized
+type SizeRequest struct {
+	Pair    string          `json:"currency_pair"`
+	Signal  strategy.Signal `json:"signal"`
+	Balance float64         `json:"balance"`
+	Price   float64         `json:"price"`
+	// HoldingHours projects the cost of holding the order when positive
+	HoldingHours float64 `json:"holding_hours,omitempty"`
+}
+
+// Size represents the order a signal converts into; Amount is in contracts
+type Size struct {
+	Pair     string       `json:"currency_pair"`
+	Method   SizingMethod `json:"method"`
+	Side     trader.Side  `json:"side"`
+	Amount   float64      `json:"amount"`
+	Notional float64      `json:"notional"`
+	Margin   float64      `json:"margin"`
+	Fraction float64      `json:"fraction"`
+	ATR      float64      `json:"atr,omitempty"`
+	Capped   bool         `json:"capped"`
+	// Cost is the projected cost of holding the order for the requested
+	// holding time: round-trip fees and funding
+	Cost *Preview `json:"cost,omitempty"`
+}
+
+// Sizer converts signals into order quantities under a sizing policy,
+// respecting the contract's quantity step, minimum quantity and minimum
+// notional
+type Sizer struct {
+	contracts ContractSource
+
+	mu     sync.RWMutex
+	policy SizingPolicy
+}
+
+// NewSizer creates a new sizer
+func NewSizer(contracts ContractSource, policy SizingPolicy) *Sizer {
+	return &Sizer{contracts: contracts, policy: policy}
+}
+
+// Policy returns the sizing policy
+func (s *Sizer) Policy() SizingPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// SetPolicy replaces the sizing policy, as when the risk profile switches
+func (s *Sizer) SetPolicy(policy SizingPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
+// Size converts a signal into an order quantity. Candles are only needed by
+// volatility sizing; a flat signal sizes to nothing.
+func (s *Sizer) Size(req SizeRequest, candles []market.CandleData) (*Size, error) {
+	return s.SizeWith(s.Policy(), req, candles)
+}
+
+// SizeWith sizes a signal under the given policy instead of the sizer's own
+func (s *Sizer) SizeWith(policy SizingPolicy, req SizeRequest, candles []market.CandleData) (*Size, error) {
+	size := &Size{Pair: req.Pair, Method: policy.Method}
+	switch req.Signal {
+	case strategy.Long:
+		size.Side = trader.BuySide
+	case strategy.Short:
+		size.Side = trader.SellSide
+	default:
+		return size, nil
+	}
+	if req.Balance <= 0 || req.Price <= 0 {
+		return nil, fmt.Errorf("balance and price must be positive")
+	}
+
+	contract, err := s.contracts.Get(req.Pair)
+	if err != nil {
+		return nil, err
+	}
+	contractSize := contract.ContractSize
+	if contractSize <= 0 {
+		contractSize = 1
+	}
+	leverage := policy.Leverage
+	if leverage <= 0 {
+		leverage = 1
+	}
+
+	switch policy.Method {
+	case FixedFraction, "":
+		size.Method = FixedFraction
+		size.Fraction = policy.Fraction
+		size.Notional = req.Balance * policy.Fraction * float64(leverage)
+	case VolatilitySizing:
+		highs, lows, closes := make([]float64, len(candles)), make([]float64, len(candles)), make([]float64, len(candles))
+		for i, c := range candles {
+			highs[i], lows[i], closes[i] = c.High, c.Low, c.Close
+		}
+		size.ATR = indicators.ATR(highs, lows, closes, policy.ATRPeriod)
+		stop := size.ATR * policy.ATRMultiple
+		if stop <= 0 {
+			return nil, fmt.Errorf("not enough candles for a %d period ATR of %s", policy.ATRPeriod, req.Pair)
+		}
+		// Losing the stop distance on every unit costs the risked fraction
+		size.Fraction = policy.Fraction
+		size.Notional = req.Balance * policy.Fraction / stop * req.Price
+		if max := req.Balance * float64(leverage); size.Notional > max {
+			size.Notional = max
+			size.Capped = true
+		}
+	case KellySizing:
+		if policy.Payoff <= 0 {
+			return nil, fmt.Errorf("kelly sizing needs a positive payoff ratio")
+		}
+		size.Fraction = math.Max(0, policy.WinRate-(1-policy.WinRate)/policy.Payoff)
+		if policy.KellyCap > 0 && size.Fraction > policy.KellyCap {
+			size.Fraction = policy.KellyCap
+			size.Capped = true
+		}
+		size.Notional = req.Balance * size.Fraction * float64(leverage)
+	default:
+		return nil, fmt.Errorf("unknown sizing method %q", policy.Method)
+	}
+
+	if policy.MaxNotional > 0 && size.Notional > policy.MaxNotional {
+		size.Notional = policy.MaxNotional
+		size.Capped = true
+	}
+
+	size.Amount = trader.FloorToStep(size.Notional/(req.Price*contractSize), contract.QuantityStep)
+	if size.Amount <= 0 || size.Amount < contract.MinQuantity {
+		return nil, fmt.Errorf("size %v for %s is below the minimum quantity %v", size.Amount, req.Pair, contract.MinQuantity)
+	}
+	size.Notional = size.Amount * req.Price * contractSize
+	if size.Notional < contract.MinNotional {
+		return nil, fmt.Errorf("notional %v for %s is below the minimum %v", size.Notional, req.Pair, contract.MinNotional)
+	}
+	size.Margin = size.Notional / float64(leverage)
+	if req.HoldingHours > 0 {
+		size.Cost = BuildPreview(contract, PreviewRequest{
+			Pair:         req.Pair,
+			Side:         size.Side,
+			Amount:       size.Amount,
+			Price:        req.Price,
+			Leverage:     leverage,
+			HoldingHours: req.HoldingHours,
+		}, time.Now())
+	}
+	return size, nil
+}
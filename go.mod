@@ -1,6 +1,6 @@
 module github.com/nofx
 
-go 1.20
+go 1.21
 
 require (
 	github.com/joho/godotenv v1.5.1
@@ -9,6 +9,11 @@ require (
 	github.com/shopspring/decimal v1.3.1
 	github.com/golang-jwt/jwt/v4 v4.5.0
 	github.com/gorilla/websocket v1.5.0
+	github.com/lib/pq v1.10.9
 	github.com/stretchr/testify v1.8.2
 	golang.org/x/crypto v0.9.0
+	gopkg.in/yaml.v3 v3.0.1
+	github.com/BurntSushi/toml v1.3.2
+	github.com/fsnotify/fsnotify v1.7.0
+	golang.org/x/sys v0.13.0 // indirect
 )
\ No newline at end of file
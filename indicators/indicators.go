@@ -0,0 +1,179 @@
+package indicators
+
+import (
+	"math"
+	"sort"
+)
+
+// TrueRange returns the true range series; the first value is high-low
+func TrueRange(high, low, close []float64) []float64 {
+	tr := make([]float64, len(close))
+	for i := range close {
+		tr[i] = high[i] - low[i]
+		if i > 0 {
+			tr[i] = math.Max(tr[i], math.Max(math.Abs(high[i]-close[i-1]), math.Abs(low[i]-close[i-1])))
+		}
+	}
+	return tr
+}
+
+// ATR returns the latest average true range using Wilder smoothing, or 0
+// when there are fewer than period+1 values
+func ATR(high, low, close []float64, period int) float64 {
+	if period <= 0 || len(close) <= period {
+		return 0
+	}
+	return wilder(TrueRange(high, low, close)[1:], period)
+}
+
+// ADX returns the latest average directional index with the +DI and -DI
+// lines, or zeros when there are fewer than 2*period+1 values
+func ADX(high, low, close []float64, period int) (adx, plusDI, minusDI float64) {
+	n := len(close)
+	if period <= 0 || n <= 2*period {
+		return 0, 0, 0
+	}
+
+	tr := TrueRange(high, low, close)
+	plusDM := make([]float64, n)
+	minusDM := make([]float64, n)
+	for i := 1; i < n; i++ {
+		up, down := high[i]-high[i-1], low[i-1]-low[i]
+		if up > down && up > 0 {
+			plusDM[i] = up
+		}
+		if down > up && down > 0 {
+			minusDM[i] = down
+		}
+	}
+
+	// Wilder-smoothed sums seeded with the first period values
+	var trSum, plusSum, minusSum float64
+	for i := 1; i <= period; i++ {
+		trSum += tr[i]
+		plusSum += plusDM[i]
+		minusSum += minusDM[i]
+	}
+
+	var dxs []float64
+	for i := period; i < n; i++ {
+		if i > period {
+			trSum = trSum - trSum/float64(period) + tr[i]
+			plusSum = plusSum - plusSum/float64(period) + plusDM[i]
+			minusSum = minusSum - minusSum/float64(period) + minusDM[i]
+		}
+		if trSum == 0 {
+			dxs = append(dxs, 0)
+			continue
+		}
+		plusDI = 100 * plusSum / trSum
+		minusDI = 100 * minusSum / trSum
+		if plusDI+minusDI == 0 {
+			dxs = append(dxs, 0)
+			continue
+		}
+		dxs = append(dxs, 100*math.Abs(plusDI-minusDI)/(plusDI+minusDI))
+	}
+
+	return wilder(dxs, period), plusDI, minusDI
+}
+
+// wilder returns the Wilder-smoothed average of a series seeded with the
+// simple average of the first period values
+func wilder(values []float64, period int) float64 {
+	if len(values) < period {
+		return 0
+	}
+	var avg float64
+	for _, v := range values[:period] {
+		avg += v
+	}
+	avg /= float64(period)
+	for _, v := range values[period:] {
+		avg = (avg*float64(period-1) + v) / float64(period)
+	}
+	return avg
+}
+
+// Returns returns the simple period-over-period returns of a price series
+func Returns(prices []float64) []float64 {
+	if len(prices) < 2 {
+		return nil
+	}
+	r := make([]float64, 0, len(prices)-1)
+	for i := 1; i < len(prices); i++ {
+		if prices[i-1] == 0 {
+			r = append(r, 0)
+			continue
+		}
+		r = append(r, prices[i]/prices[i-1]-1)
+	}
+	return r
+}
+
+// Mean returns the arithmetic mean of a series
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// StdDev returns the sample standard deviation of a series
+func StdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	mean := Mean(values)
+	var sum float64
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// Correlation returns the Pearson correlation of two equally long series, or
+// 0 when either has no variance
+func Correlation(a, b []float64) float64 {
+	n := len(a)
+	if n != len(b) || n < 2 {
+		return 0
+	}
+
+	meanA, meanB := Mean(a), Mean(b)
+	var cov, varA, varB float64
+	for i := 0; i < n; i++ {
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// Percentile returns the p-th percentile (0-100) of a series, interpolating
+// linearly between the closest ranks
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	if rank <= 0 {
+		return sorted[0]
+	}
+	if rank >= float64(len(sorted)-1) {
+		return sorted[len(sorted)-1]
+	}
+	lower := int(rank)
+	return sorted[lower] + (sorted[lower+1]-sorted[lower])*(rank-float64(lower))
+}
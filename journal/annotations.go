@@ -0,0 +1,185 @@
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnnotationTarget represents what an annotation is attached to
+type AnnotationTarget string
+
+const (
+	// OrderTarget annotates a trade; the reference is the order ID
+	OrderTarget AnnotationTarget = "order"
+	// PositionTarget annotates a position; the reference is the currency pair
+	PositionTarget AnnotationTarget = "position"
+)
+
+// ErrAnnotationNotFound is returned when an annotation ID is unknown
+var ErrAnnotationNotFound = errors.New("annotation not found")
+
+// Annotation represents free-form tags and a note attached to a trade or position
+type Annotation struct {
+	ID        string           `json:"id"`
+	Target    AnnotationTarget `json:"target"`
+	Reference string           `json:"reference"`
+	Pair      string           `json:"currency_pair,omitempty"`
+	Tags      []string         `json:"tags"`
+	Note      string           `json:"note,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// AnnotationFilter selects annotations; zero values match everything
+type AnnotationFilter struct {
+	Target    AnnotationTarget
+	Reference string
+	Pair      string
+	Tag       string
+}
+
+// Match reports whether an annotation is selected by the filter
+func (f AnnotationFilter) Match(a Annotation) bool {
+	if f.Target != "" && a.Target != f.Target {
+		return false
+	}
+	if f.Reference != "" && a.Reference != f.Reference {
+		return false
+	}
+	if f.Pair != "" && a.Pair != f.Pair {
+		return false
+	}
+	if f.Tag != "" && !hasTag(a.Tags, normalizeTag(f.Tag)) {
+		return false
+	}
+	return true
+}
+
+// AnnotationStore persists annotations, typically the history store
+type AnnotationStore interface {
+	SaveAnnotation(a Annotation) error
+	DeleteAnnotation(id string) error
+	Annotations() ([]Annotation, error)
+}
+
+// SetAnnotationStore loads the persisted annotations and writes every later
+// change through to the store
+func (j *Journal) SetAnnotationStore(store AnnotationStore) error {
+	annotations, err := store.Annotations()
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.store = store
+	j.annotations = annotations
+	return nil
+}
+
+// Annotate attaches tags and a note to a trade or position
+func (j *Journal) Annotate(a Annotation) (Annotation, error) {
+	if a.Target != OrderTarget && a.Target != PositionTarget {
+		return a, fmt.Errorf("invalid annotation target %q", a.Target)
+	}
+	if a.Reference == "" {
+		return a, errors.New("annotation reference is required")
+	}
+
+	a.Tags = normalizeTags(a.Tags)
+	a.Note = strings.TrimSpace(a.Note)
+	if len(a.Tags) == 0 && a.Note == "" {
+		return a, errors.New("annotation needs a tag or a note")
+	}
+	if a.Timestamp.IsZero() {
+		a.Timestamp = time.Now()
+	}
+	a.ID = strconv.FormatInt(a.Timestamp.UnixNano(), 36)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.store != nil {
+		if err := j.store.SaveAnnotation(a); err != nil {
+			return a, err
+		}
+	}
+	j.annotations = append(j.annotations, a)
+	return a, nil
+}
+
+// DeleteAnnotation removes an annotation
+func (j *Journal) DeleteAnnotation(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i, a := range j.annotations {
+		if a.ID != id {
+			continue
+		}
+		if j.store != nil {
+			if err := j.store.DeleteAnnotation(id); err != nil {
+				return err
+			}
+		}
+		j.annotations = append(j.annotations[:i], j.annotations[i+1:]...)
+		return nil
+	}
+	return fmt.Errorf("%s: %w", id, ErrAnnotationNotFound)
+}
+
+// Annotations returns the annotations selected by a filter, oldest first
+func (j *Journal) Annotations(filter AnnotationFilter) []Annotation {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	result := []Annotation{}
+	for _, a := range j.annotations {
+		if filter.Match(a) {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// Tagged returns the references of a target carrying a tag, for filtering trades
+func (j *Journal) Tagged(target AnnotationTarget, tag string) map[string]bool {
+	refs := make(map[string]bool)
+	for _, a := range j.Annotations(AnnotationFilter{Target: target, Tag: tag}) {
+		refs[a.Reference] = true
+	}
+	return refs
+}
+
+// normalizeTags lowercases, trims and deduplicates tags
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = normalizeTag(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		result = append(result, t)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// normalizeTag lowercases and trims a tag
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// hasTag reports whether tags contains tag
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
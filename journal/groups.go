@@ -0,0 +1,72 @@
+package journal
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrGroupNotFound is returned when an order group ID is unknown
+var ErrGroupNotFound = errors.New("order group not found")
+
+// GroupLeg represents one order of an order group
+type GroupLeg struct {
+	Exchange string  `json:"exchange"`
+	Kind     string  `json:"kind"`
+	Pair     string  `json:"currency_pair"`
+	Side     string  `json:"side"`
+	Amount   float64 `json:"amount"`
+	OrderID  string  `json:"order_id,omitempty"`
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// OrderGroup represents orders submitted together that succeed or are rolled back as one unit
+type OrderGroup struct {
+	ID        string     `json:"id"`
+	Status    string     `json:"status"`
+	Legs      []GroupLeg `json:"legs"`
+	Error     string     `json:"error,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// RecordGroup records an order group, replacing an earlier record with the
+// same ID, and returns it with its ID and timestamp set
+func (j *Journal) RecordGroup(g OrderGroup) OrderGroup {
+	if g.Timestamp.IsZero() {
+		g.Timestamp = time.Now()
+	}
+	if g.ID == "" {
+		g.ID = strconv.FormatInt(g.Timestamp.UnixNano(), 36)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range j.groups {
+		if j.groups[i].ID == g.ID {
+			j.groups[i] = g
+			return g
+		}
+	}
+	j.groups = append(j.groups, g)
+	return g
+}
+
+// Group returns the order group with an ID
+func (j *Journal) Group(id string) (OrderGroup, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	for _, g := range j.groups {
+		if g.ID == id {
+			return g, nil
+		}
+	}
+	return OrderGroup{}, ErrGroupNotFound
+}
+
+// Groups returns all recorded order groups, oldest first
+func (j *Journal) Groups() []OrderGroup {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return append([]OrderGroup(nil), j.groups...)
+}
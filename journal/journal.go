@@ -0,0 +1,82 @@
+package journal
+
+import (
+	"sync"
+	"time"
+)
+
+// EntryType represents the kind of balance-affecting event
+type EntryType string
+
+const (
+	// TradeEntry is realized PnL from a closed or reduced position
+	TradeEntry EntryType = "trade"
+	// FeeEntry is a trading fee charged by the exchange
+	FeeEntry EntryType = "fee"
+	// FundingEntry is a funding payment received or paid
+	FundingEntry EntryType = "funding"
+	// TransferEntry is a known deposit, withdrawal or internal transfer
+	TransferEntry EntryType = "transfer"
+)
+
+// Entry represents a single balance-affecting event
+type Entry struct {
+	Type      EntryType `json:"type"`
+	Currency  string    `json:"currency"`
+	Amount    float64   `json:"amount"`
+	Pair      string    `json:"currency_pair,omitempty"`
+	Reference string    `json:"reference,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Journal is an in-memory ledger of every balance change we are responsible
+// for, plus the annotations attached to trades and positions and the order
+// groups submitted as one unit
+type Journal struct {
+	mu          sync.RWMutex
+	entries     []Entry
+	annotations []Annotation
+	groups      []OrderGroup
+	store       AnnotationStore
+}
+
+// New creates an empty journal
+func New() *Journal {
+	return &Journal{}
+}
+
+// Record appends an entry to the journal
+func (j *Journal) Record(entry Entry) {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, entry)
+}
+
+// Entries returns all entries recorded in the half-open interval [from, to)
+func (j *Journal) Entries(from, to time.Time) []Entry {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	var result []Entry
+	for _, e := range j.entries {
+		if !e.Timestamp.Before(from) && e.Timestamp.Before(to) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Net returns the net balance change for a currency in the interval [from, to)
+func (j *Journal) Net(currency string, from, to time.Time) float64 {
+	var net float64
+	for _, e := range j.Entries(from, to) {
+		if e.Currency == currency {
+			net += e.Amount
+		}
+	}
+	return net
+}
@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// MessageID identifies a catalogued log message; it is logged as the
+// msg_id field, so pipelines can match messages whatever their language
+type MessageID string
+
+// Catalogued messages; their templates name the fields they're logged with
+const (
+	MsgKillSwitchEngaged  MessageID = "kill_switch_engaged"
+	MsgKillSwitchReleased MessageID = "kill_switch_released"
+	MsgProfitLockEngaged  MessageID = "profit_lock_engaged"
+	MsgOrderRejected      MessageID = "order_rejected"
+	MsgEntryQueued        MessageID = "entry_queued"
+	MsgOrderGroupPlaced   MessageID = "order_group_placed"
+	MsgConfigReloaded     MessageID = "config_reloaded"
+	MsgConfigNeedsRestart MessageID = "config_needs_restart"
+	MsgConfigReloadFailed MessageID = "config_reload_failed"
+	MsgSignalSkipped      MessageID = "signal_skipped"
+)
+
+// Languages of the message catalog
+const (
+	English = "en"
+	Chinese = "zh"
+)
+
+// FieldMessageID is the field carrying the ID of a catalogued message
+const FieldMessageID = "msg_id"
+
+// catalog holds the message templates per language; {name} is replaced by
+// the value of the field name
+var catalog = map[MessageID]map[string]string{
+	MsgKillSwitchEngaged: {
+		English: "Kill switch engaged: {reason}",
+		Chinese: "熔断开关已启用：{reason}",
+	},
+	MsgKillSwitchReleased: {
+		English: "Kill switch released",
+		Chinese: "熔断开关已解除",
+	},
+	MsgProfitLockEngaged: {
+		English: "Daily profit target reached: {pnl} >= {target} {currency}, {effect} until the next UTC day",
+		Chinese: "已达到每日盈利目标：{pnl} >= {target} {currency}，UTC 次日前{effect}",
+	},
+	MsgOrderRejected: {
+		English: "Rejected {side} {type} order for {symbol} on {exchange}: {error}",
+		Chinese: "已拒绝 {exchange} 上 {symbol} 的 {side} {type} 订单：{error}",
+	},
+	MsgEntryQueued: {
+		English: "Queueing entry on {exchange} for up to {timeout} until a position closes",
+		Chinese: "{exchange} 上的开仓已排队，最多等待 {timeout} 直到有仓位平仓",
+	},
+	MsgOrderGroupPlaced: {
+		English: "Order group {group_id} placed with {legs} legs",
+		Chinese: "订单组 {group_id} 已下单，共 {legs} 条腿",
+	},
+	MsgConfigReloaded: {
+		English: "Configuration reloaded: {fields}",
+		Chinese: "配置已重新加载：{fields}",
+	},
+	MsgConfigNeedsRestart: {
+		English: "Configuration change to {field} requires a restart and was not applied",
+		Chinese: "配置项 {field} 的更改需要重启，未生效",
+	},
+	MsgConfigReloadFailed: {
+		English: "Failed to reload configuration from {path}, keeping the current one: {error}",
+		Chinese: "从 {path} 重新加载配置失败，保留当前配置：{error}",
+	},
+	MsgSignalSkipped: {
+		English: "Skipped {side} signal for {symbol} from {source}: {reason}",
+		Chinese: "已跳过来自 {source} 的 {symbol} {side} 信号：{reason}",
+	},
+}
+
+var (
+	languageMu sync.RWMutex
+	language   = English
+)
+
+// SetLanguage selects the language of catalogued messages; unknown
+// languages fall back to English
+func SetLanguage(lang string) {
+	languageMu.Lock()
+	defer languageMu.Unlock()
+	language = strings.ToLower(lang)
+}
+
+// render returns the text of a message in the selected language, falling
+// back to English and then to its ID, with the fields filled in
+func render(id MessageID, attrs []slog.Attr) string {
+	languageMu.RLock()
+	lang := language
+	languageMu.RUnlock()
+
+	templates := catalog[id]
+	text, ok := templates[lang]
+	if !ok {
+		text, ok = templates[English]
+	}
+	if !ok {
+		text = string(id)
+	}
+	if !strings.Contains(text, "{") {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(attrs))
+	for _, a := range attrs {
+		pairs = append(pairs, "{"+a.Key+"}", fmt.Sprint(a.Value.Any()))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Log logs a catalogued message with key/value fields, e.g.
+// Log(InfoLevel, MsgConfigReloaded, "fields", "risk.max_leverage"); the
+// fields fill in the message text and are logged as structured fields
+func (l *Logger) Log(level LogLevel, id MessageID, args ...interface{}) {
+	attrs := l.With(args...).attrs
+	message := render(id, attrs)
+	logMessage(append(attrs, slog.String(FieldMessageID, string(id))), level, "%s", message)
+}
+
+// Log logs a catalogued message with key/value fields
+func Log(level LogLevel, id MessageID, args ...interface{}) {
+	attrs := With(args...).attrs
+	message := render(id, attrs)
+	logMessage(append(attrs, slog.String(FieldMessageID, string(id))), level, "%s", message)
+}
@@ -1,10 +1,17 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/nofx/config"
 )
 
 // LogLevel represents the severity level of a log message
@@ -23,6 +30,13 @@ const (
 	FatalLevel
 )
 
+// Common field names of structured log messages
+const (
+	FieldSymbol   = "symbol"
+	FieldOrderID  = "order_id"
+	FieldExchange = "exchange"
+)
+
 var levelNames = map[LogLevel]string{
 	DebugLevel:   "DEBUG",
 	InfoLevel:    "INFO",
@@ -31,29 +45,29 @@ var levelNames = map[LogLevel]string{
 	FatalLevel:   "FATAL",
 }
 
-var currentLevel LogLevel
-var logFile *os.File
+var slogLevels = map[LogLevel]slog.Level{
+	DebugLevel:   slog.LevelDebug,
+	InfoLevel:    slog.LevelInfo,
+	WarningLevel: slog.LevelWarn,
+	ErrorLevel:   slog.LevelError,
+	FatalLevel:   slog.LevelError + 4,
+}
+
+var (
+	levelsMu     sync.RWMutex
+	currentLevel LogLevel
+	moduleLevels map[string]LogLevel
+	handler      slog.Handler = newTextHandler(os.Stdout)
+	logFile      *os.File
+)
 
 // Init initializes the logger with the specified configuration
-func Init(config LoggingConfig) {
-	// Set log level
-	switch config.Level {
-	case "debug":
-		currentLevel = DebugLevel
-	case "info":
-		currentLevel = InfoLevel
-	case "warning":
-		currentLevel = WarningLevel
-	case "error":
-		currentLevel = ErrorLevel
-	case "fatal":
-		currentLevel = FatalLevel
-	default:
-		currentLevel = InfoLevel
-	}
+func Init(cfg config.LoggingConfig) {
+	SetLevels(cfg)
 
 	// Open log file if specified
-	if config.File != "" {
+	var out io.Writer = os.Stdout
+	if cfg.File != "" {
 		dir := "logs"
 		if _, err := os.Stat(dir); os.IsNotExist(err) {
 			if err := os.Mkdir(dir, 0755); err != nil {
@@ -62,58 +76,167 @@ func Init(config LoggingConfig) {
 		}
 
 		var err error
-		logFile, err = os.OpenFile(config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		logFile, err = os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			log.Printf("Warning: Failed to open log file: %v", err)
+		} else {
+			out = io.MultiWriter(os.Stdout, logFile)
 		}
 	}
+
+	if strings.EqualFold(cfg.Format, "json") {
+		handler = slog.NewJSONHandler(out, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.LevelKey && len(groups) == 0 {
+					a.Value = slog.StringValue(levelName(a.Value.Any().(slog.Level)))
+				}
+				return a
+			},
+		})
+	} else {
+		handler = newTextHandler(out)
+	}
+
+	startSinks(cfg)
 }
 
-// logMessage logs a message with the specified level
-func logMessage(level LogLevel, format string, args ...interface{}) {
-	if level < currentLevel {
+// SetLevels sets the global and per-module log levels and the language of
+// catalogued messages, as on a configuration reload
+func SetLevels(cfg config.LoggingConfig) {
+	SetLanguage(cfg.Language)
+
+	modules := make(map[string]LogLevel, len(cfg.Modules))
+	for module, level := range cfg.Modules {
+		modules[module] = ParseLevel(level)
+	}
+
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	currentLevel = ParseLevel(cfg.Level)
+	moduleLevels = modules
+}
+
+// levelName returns the name of a slog level
+func levelName(level slog.Level) string {
+	for l, sl := range slogLevels {
+		if sl == level {
+			return levelNames[l]
+		}
+	}
+	return level.String()
+}
+
+// enabled reports whether messages of a level are logged for a module
+func enabled(level LogLevel, module string) bool {
+	levelsMu.RLock()
+	defer levelsMu.RUnlock()
+	if min, ok := moduleLevels[module]; ok {
+		return level >= min
+	}
+	return level >= currentLevel
+}
+
+// logMessage logs a message with the specified level and fields
+func logMessage(attrs []slog.Attr, level LogLevel, format string, args ...interface{}) {
+	// Skip logMessage and the level function
+	module := callerModule(2)
+	if !enabled(level, module) {
 		return
 	}
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	now := time.Now()
 	message := fmt.Sprintf(format, args...)
-	logEntry := fmt.Sprintf("[%s] [%s] %s\n", timestamp, levelNames[level], message)
-
-	// Write to stdout
-	fmt.Print(logEntry)
 
-	// Write to file if configured
-	if logFile != nil {
-		logFile.WriteString(logEntry)
+	// Keep the entry for remote tailing
+	entry := Entry{Time: now, Level: levelNames[level], Module: module, Message: message, level: level}
+	if len(attrs) > 0 {
+		entry.Fields = make(map[string]interface{}, len(attrs))
+		for _, a := range attrs {
+			entry.Fields[a.Key] = a.Value.Any()
+		}
 	}
+	publish(entry)
+	ship(entry)
+
+	record := slog.NewRecord(now, slogLevels[level], message, 0)
+	record.AddAttrs(slog.String("module", module))
+	record.AddAttrs(attrs...)
+	handler.Handle(context.Background(), record)
 
 	// Exit on fatal level
 	if level == FatalLevel {
+		Flush()
 		os.Exit(1)
 	}
 }
 
+// Logger logs messages carrying structured fields
+type Logger struct {
+	attrs []slog.Attr
+}
+
+// With returns a logger adding key/value fields to every message, e.g.
+// With(FieldExchange, "gate", FieldSymbol, "BTC_USDT")
+func With(args ...interface{}) *Logger {
+	return (&Logger{}).With(args...)
+}
+
+// With returns a logger adding further key/value fields
+func (l *Logger) With(args ...interface{}) *Logger {
+	attrs := append([]slog.Attr(nil), l.attrs...)
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs = append(attrs, slog.Any(fmt.Sprint(args[i]), args[i+1]))
+	}
+	return &Logger{attrs: attrs}
+}
+
+// Debug logs a debug message
+func (l *Logger) Debug(format string, args ...interface{}) {
+	logMessage(l.attrs, DebugLevel, format, args...)
+}
+
+// Info logs an info message
+func (l *Logger) Info(format string, args ...interface{}) {
+	logMessage(l.attrs, InfoLevel, format, args...)
+}
+
+// Warning logs a warning message
+func (l *Logger) Warning(format string, args ...interface{}) {
+	logMessage(l.attrs, WarningLevel, format, args...)
+}
+
+// Error logs an error message
+func (l *Logger) Error(format string, args ...interface{}) {
+	logMessage(l.attrs, ErrorLevel, format, args...)
+}
+
+// Fatal logs a fatal message and exits the program
+func (l *Logger) Fatal(format string, args ...interface{}) {
+	logMessage(l.attrs, FatalLevel, format, args...)
+}
+
 // Debug logs a debug message
 func Debug(format string, args ...interface{}) {
-	logMessage(DebugLevel, format, args...)
+	logMessage(nil, DebugLevel, format, args...)
 }
 
 // Info logs an info message
 func Info(format string, args ...interface{}) {
-	logMessage(InfoLevel, format, args...)
+	logMessage(nil, InfoLevel, format, args...)
 }
 
 // Warning logs a warning message
 func Warning(format string, args ...interface{}) {
-	logMessage(WarningLevel, format, args...)
+	logMessage(nil, WarningLevel, format, args...)
 }
 
 // Error logs an error message
 func Error(format string, args ...interface{}) {
-	logMessage(ErrorLevel, format, args...)
+	logMessage(nil, ErrorLevel, format, args...)
 }
 
 // Fatal logs a fatal message and exits the program
 func Fatal(format string, args ...interface{}) {
-	logMessage(FatalLevel, format, args...)
-}
\ No newline at end of file
+	logMessage(nil, FatalLevel, format, args...)
+}
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nofx/config"
+)
+
+// LokiSink pushes log entries to Loki, one stream per level
+type LokiSink struct {
+	cfg config.LokiLogConfig
+}
+
+// NewLokiSink creates a new Loki sink
+func NewLokiSink(cfg config.LokiLogConfig) *LokiSink {
+	return &LokiSink{cfg: cfg}
+}
+
+// Name implements Sink
+func (s *LokiSink) Name() string {
+	return "loki"
+}
+
+// lokiStream represents a stream of the Loki push API
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Send implements Sink, pushing a gzipped JSON body to /loki/api/v1/push
+func (s *LokiSink) Send(ctx context.Context, entries []Entry) error {
+	streams := make(map[string]*lokiStream)
+	for _, e := range entries {
+		level := strings.ToLower(e.Level)
+		stream, ok := streams[level]
+		if !ok {
+			labels := make(map[string]string, len(s.cfg.Labels)+1)
+			for k, v := range s.cfg.Labels {
+				labels[k] = v
+			}
+			labels["level"] = level
+			stream = &lokiStream{Stream: labels}
+			streams[level] = stream
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), string(line)})
+	}
+
+	push := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, stream := range streams {
+		// Loki rejects entries older than the last one of their stream
+		sort.SliceStable(stream.Values, func(i, j int) bool {
+			return len(stream.Values[i][0]) < len(stream.Values[j][0]) ||
+				len(stream.Values[i][0]) == len(stream.Values[j][0]) && stream.Values[i][0] < stream.Values[j][0]
+		})
+		push.Streams = append(push.Streams, stream)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(push); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(s.cfg.URL, "/")+"/loki/api/v1/push", &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if s.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", s.cfg.TenantID)
+	}
+	if s.cfg.Username != "" || s.cfg.Password != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	resp, err := sinkClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nofx/config"
+)
+
+// S3Sink uploads batches of log entries to S3 as gzipped JSON lines objects
+type S3Sink struct {
+	cfg config.S3LogConfig
+	seq uint64
+}
+
+// NewS3Sink creates a new S3 sink
+func NewS3Sink(cfg config.S3LogConfig) *S3Sink {
+	return &S3Sink{cfg: cfg}
+}
+
+// Name implements Sink
+func (s *S3Sink) Name() string {
+	return "s3"
+}
+
+// Send implements Sink, putting the batch under
+// <prefix><yyyy>/<mm>/<dd>/<time>-<seq>.jsonl.gz
+func (s *S3Sink) Send(ctx context.Context, entries []Entry) error {
+	body, err := gzipLines(entries)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s%s/%s-%d.jsonl.gz", s.cfg.Prefix, now.Format("2006/01/02"),
+		now.Format("20060102T150405.000Z"), atomic.AddUint64(&s.seq, 1))
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	s.sign(req, body, now)
+
+	resp, err := sinkClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+// objectURL returns the URL of an object, virtual-hosted unless PathStyle is set
+func (s *S3Sink) objectURL(key string) string {
+	endpoint := strings.TrimRight(s.cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.cfg.Region)
+	}
+	path := (&url.URL{Path: "/" + key}).EscapedPath()
+	if s.cfg.PathStyle {
+		return endpoint + "/" + s.cfg.Bucket + path
+	}
+	scheme, host, _ := strings.Cut(endpoint, "://")
+	return scheme + "://" + s.cfg.Bucket + "." + host + path
+}
+
+// sign signs a request with AWS Signature Version 4
+func (s *S3Sink) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := []string{"content-encoding", "content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	var headers strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// sha256Hex returns the hex encoded SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,206 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nofx/config"
+)
+
+// sinkTimeout bounds a single upload of a batch
+const sinkTimeout = 30 * time.Second
+
+// Sink ships batches of log entries to remote storage
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, entries []Entry) error
+}
+
+// shipper batches the entries of a sink in the background. Failed batches
+// are retried with the next flush; when the sink stays unreachable the
+// oldest entries beyond a few batches are dropped, so logging never blocks.
+type shipper struct {
+	sink     Sink
+	size     int
+	interval time.Duration
+	entries  chan Entry
+	flush    chan chan struct{}
+	done     chan struct{}
+}
+
+// newShipper starts shipping the entries of a sink
+func newShipper(sink Sink, size int, interval time.Duration) *shipper {
+	if size <= 0 {
+		size = 500
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	s := &shipper{
+		sink:     sink,
+		size:     size,
+		interval: interval,
+		entries:  make(chan Entry, 4*size),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// enqueue queues an entry, dropping it when the queue is full
+func (s *shipper) enqueue(e Entry) {
+	select {
+	case s.entries <- e:
+	default:
+	}
+}
+
+// run collects entries into batches and sends them
+func (s *shipper) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	var batch []Entry
+	send := func() {
+		// Drain what is already queued, so a flush ships everything logged before it
+		for drained := false; !drained; {
+			select {
+			case e := <-s.entries:
+				batch = append(batch, e)
+			default:
+				drained = true
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+		err := s.sink.Send(ctx, batch)
+		cancel()
+		if err != nil {
+			// Logging through the logger would feed the failure back to the sink
+			log.Printf("Warning: Failed to ship %d log entries to %s: %v", len(batch), s.sink.Name(), err)
+			if max := 4 * s.size; len(batch) > max {
+				batch = append([]Entry(nil), batch[len(batch)-max:]...)
+			}
+			return
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-s.entries:
+			batch = append(batch, e)
+			if len(batch) >= s.size {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case ack := <-s.flush:
+			send()
+			close(ack)
+		case <-s.done:
+			send()
+			return
+		}
+	}
+}
+
+// Flush sends the queued entries and waits for the upload
+func (s *shipper) Flush() {
+	ack := make(chan struct{})
+	select {
+	case s.flush <- ack:
+		<-ack
+	case <-s.done:
+	}
+}
+
+var sinks = struct {
+	mu       sync.RWMutex
+	shippers []*shipper
+}{}
+
+// startSinks replaces the remote sinks with those configured
+func startSinks(cfg config.LoggingConfig) {
+	var shippers []*shipper
+	for _, name := range cfg.Sinks {
+		switch name {
+		case "loki":
+			loki := cfg.Loki
+			shippers = append(shippers, newShipper(NewLokiSink(loki), loki.BatchSize, time.Duration(loki.FlushInterval)*time.Second))
+		case "s3":
+			s3 := cfg.S3
+			shippers = append(shippers, newShipper(NewS3Sink(s3), s3.BatchSize, time.Duration(s3.FlushInterval)*time.Second))
+		default:
+			log.Printf("Warning: Unknown log sink %q", name)
+		}
+	}
+
+	sinks.mu.Lock()
+	previous := sinks.shippers
+	sinks.shippers = shippers
+	sinks.mu.Unlock()
+	for _, s := range previous {
+		s.Flush()
+		close(s.done)
+	}
+}
+
+// ship queues an entry on every remote sink
+func ship(e Entry) {
+	sinks.mu.RLock()
+	defer sinks.mu.RUnlock()
+	for _, s := range sinks.shippers {
+		s.enqueue(e)
+	}
+}
+
+// Flush sends the entries queued for the remote sinks and waits for the
+// uploads, e.g. before the process exits
+func Flush() {
+	sinks.mu.RLock()
+	shippers := sinks.shippers
+	sinks.mu.RUnlock()
+	for _, s := range shippers {
+		s.Flush()
+	}
+}
+
+// sinkClient is the HTTP client of the remote sinks
+var sinkClient = &http.Client{Timeout: sinkTimeout}
+
+// gzipLines encodes entries as gzipped JSON lines
+func gzipLines(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkResponse turns an unsuccessful upload response into an error
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+}
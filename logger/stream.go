@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historySize is the number of recent entries kept for tailing
+const historySize = 1000
+
+// Entry represents a single log message
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Module  string    `json:"module"`
+	Message string    `json:"message"`
+
+	Fields map[string]interface{} `json:"fields,omitempty"`
+
+	level LogLevel
+}
+
+// Filter selects log entries by minimum level and module; zero values match everything
+type Filter struct {
+	Level  LogLevel
+	Module string
+}
+
+// Match reports whether an entry is selected by the filter
+func (f Filter) Match(e Entry) bool {
+	return e.level >= f.Level && (f.Module == "" || e.Module == f.Module)
+}
+
+// ParseLevel parses a level name, defaulting to info
+func ParseLevel(name string) LogLevel {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DebugLevel
+	case "warning", "warn":
+		return WarningLevel
+	case "error":
+		return ErrorLevel
+	case "fatal":
+		return FatalLevel
+	default:
+		return InfoLevel
+	}
+}
+
+var stream = struct {
+	mu          sync.RWMutex
+	history     []Entry
+	next        int
+	subscribers map[chan Entry]Filter
+}{
+	subscribers: make(map[chan Entry]Filter),
+}
+
+// publish records an entry for tailing and delivers it to matching
+// subscribers, dropping it for subscribers that can't keep up
+func publish(e Entry) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if len(stream.history) < historySize {
+		stream.history = append(stream.history, e)
+	} else {
+		stream.history[stream.next] = e
+		stream.next = (stream.next + 1) % historySize
+	}
+
+	for ch, f := range stream.subscribers {
+		if !f.Match(e) {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Recent returns up to limit of the most recent entries matching a filter, oldest first
+func Recent(f Filter, limit int) []Entry {
+	stream.mu.RLock()
+	defer stream.mu.RUnlock()
+
+	n := len(stream.history)
+	var matched []Entry
+	for i := n - 1; i >= 0 && (limit <= 0 || len(matched) < limit); i-- {
+		e := stream.history[(stream.next+i)%n]
+		if f.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	return matched
+}
+
+// Subscribe returns a channel receiving new entries matching a filter and a
+// function that ends the subscription
+func Subscribe(f Filter) (<-chan Entry, func()) {
+	ch := make(chan Entry, 256)
+	stream.mu.Lock()
+	stream.subscribers[ch] = f
+	stream.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			stream.mu.Lock()
+			delete(stream.subscribers, ch)
+			stream.mu.Unlock()
+		})
+	}
+}
+
+// callerModule returns the package name of the function skip frames above the caller
+func callerModule(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+	name := runtime.FuncForPC(pc).Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// textHandler writes records in the classic "[time] [LEVEL] message" format
+// followed by their fields as key=value pairs
+type textHandler struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	attrs  []slog.Attr
+	prefix string
+}
+
+// newTextHandler creates a new text handler writing to out
+func newTextHandler(out io.Writer) *textHandler {
+	return &textHandler{mu: &sync.Mutex{}, out: out}
+}
+
+// Enabled implements slog.Handler; levels are filtered before records are created
+func (h *textHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+// Handle implements slog.Handler
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString("[")
+	b.WriteString(r.Time.Format("2006-01-02 15:04:05"))
+	b.WriteString("] [")
+	b.WriteString(levelName(r.Level))
+	b.WriteString("] ")
+	b.WriteString(r.Message)
+
+	write := func(prefix string, a slog.Attr) {
+		// The module is implied by the message and only kept in structured output
+		if a.Key == "module" || a.Key == "" {
+			return
+		}
+		b.WriteString(" ")
+		b.WriteString(prefix + a.Key)
+		b.WriteString("=")
+		value := a.Value.Resolve().String()
+		if strings.ContainsAny(value, " =\"") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+	for _, a := range h.attrs {
+		write("", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		write(h.prefix, a)
+		return true
+	})
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, b.String())
+	return err
+}
+
+// WithAttrs implements slog.Handler
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		c.attrs = append(c.attrs, a)
+	}
+	return &c
+}
+
+// WithGroup implements slog.Handler by prefixing later keys with the group name
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
@@ -1,18 +1,27 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
 	"github.com/joho/godotenv"
 	"github.com/nofx/bootstrap"
 	"github.com/nofx/config"
+	"github.com/nofx/crypto"
 	"github.com/nofx/logger"
+	"github.com/nofx/storage"
 	"github.com/nofx/api"
 )
 
 func main() {
+	if len(os.Args) > 1 && runCommand(os.Args[1], os.Args[2:]) {
+		return
+	}
+
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("Warning: .env file not found, using environment variables")
@@ -34,16 +43,99 @@ func main() {
 	}
 
 	// Initialize API server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	server, err := api.NewServer(ctx, fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port))
+	if err != nil {
+		log.Fatalf("Failed to initialize API server: %v", err)
 	}
 
-	server := api.NewServer(ctx, fmt.Sprintf("%s:%s", cfg.Server.Host, port))
-
 	// Start server
-	log.Printf("Server starting on %s:%s", cfg.Server.Host, port)
+	log.Printf("Server starting on %s:%s", cfg.Server.Host, cfg.Server.Port)
 	if err := server.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
-}
\ No newline at end of file
+}
+// runCommand runs a maintenance subcommand and reports whether one was given:
+//
+//	nofx hash-password <password>        prints a bcrypt hash for security.users
+//	nofx generate-key <key-file>         writes a new encryption key
+//	nofx encrypt <key-file> < value      prints an encrypted credential for config.json,
+//	                                     reading the value from stdin
+//	nofx encrypt-secrets <key-file> <secrets.json> <out-file>
+//	                                     encrypts exchange credentials into the secrets file
+//	nofx verify-audit <key-file>         verifies the order audit trail and its head
+func runCommand(name string, args []string) bool {
+	switch {
+	case name == "hash-password" && len(args) == 1:
+		hash, err := crypto.HashPassword(args[0])
+		if err != nil {
+			log.Fatalf("Failed to hash password: %v", err)
+		}
+		fmt.Println(hash)
+	case name == "generate-key" && len(args) == 1:
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		if err := crypto.WriteKey(args[0], key); err != nil {
+			log.Fatalf("Failed to write key: %v", err)
+		}
+	case name == "encrypt" && len(args) == 1:
+		key, err := crypto.LoadKey(args[0])
+		if err != nil {
+			log.Fatalf("Failed to load key: %v", err)
+		}
+		// The value comes from stdin so it stays out of the shell history
+		// and the process list
+		value, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("Failed to read value: %v", err)
+		}
+		value = bytes.TrimRight(value, "\r\n")
+		if len(value) == 0 {
+			log.Fatalf("No value to encrypt on stdin")
+		}
+		ciphertext, err := crypto.Encrypt(value, key)
+		if err != nil {
+			log.Fatalf("Failed to encrypt: %v", err)
+		}
+		fmt.Println(ciphertext)
+	case name == "encrypt-secrets" && len(args) == 3:
+		key, err := crypto.LoadKey(args[0])
+		if err != nil {
+			log.Fatalf("Failed to load key: %v", err)
+		}
+		plaintext, err := os.ReadFile(args[1])
+		if err != nil {
+			log.Fatalf("Failed to read secrets: %v", err)
+		}
+		var secrets map[string]config.ExchangeSecret
+		if err := json.Unmarshal(plaintext, &secrets); err != nil {
+			log.Fatalf("Invalid secrets file: %v", err)
+		}
+		if err := crypto.EncryptFile(args[2], plaintext, key); err != nil {
+			log.Fatalf("Failed to write secrets: %v", err)
+		}
+	case name == "verify-audit" && len(args) == 1:
+		key, err := crypto.LoadKey(args[0])
+		if err != nil {
+			log.Fatalf("Failed to load key: %v", err)
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		store, err := storage.Open(cfg.Database)
+		if err != nil {
+			log.Fatalf("Failed to open history store: %v", err)
+		}
+		defer store.Close()
+		count, err := store.VerifyAudit(key, storage.AuditHeadPath(args[0]))
+		if err != nil {
+			log.Fatalf("Audit trail verification failed after %d valid records: %v", count, err)
+		}
+		fmt.Printf("Audit trail intact: %d records verified\n", count)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,344 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// AnnouncementEventType is the MarketEvent type used for exchange announcements
+const AnnouncementEventType = "announcement"
+
+// maxRecentAnnouncements is how many announcements the monitor keeps for the API
+const maxRecentAnnouncements = 100
+
+// AnnouncementCategory represents what an announcement is about
+type AnnouncementCategory string
+
+const (
+	// ListingAnnouncement announces a new listing
+	ListingAnnouncement AnnouncementCategory = "listing"
+	// DelistingAnnouncement announces a delisting
+	DelistingAnnouncement AnnouncementCategory = "delisting"
+	// ContractAnnouncement announces a change of contract parameters
+	ContractAnnouncement AnnouncementCategory = "contract_change"
+	// MaintenanceAnnouncement announces exchange maintenance
+	MaintenanceAnnouncement AnnouncementCategory = "maintenance"
+	// OtherAnnouncement is anything else
+	OtherAnnouncement AnnouncementCategory = "other"
+)
+
+// Announcement represents an exchange announcement; Pairs are the USDT pairs
+// named in the title and Perpetual is set when it concerns perpetual contracts
+type Announcement struct {
+	ID          string               `json:"id"`
+	Exchange    string               `json:"exchange"`
+	Category    AnnouncementCategory `json:"category"`
+	Title       string               `json:"title"`
+	URL         string               `json:"url"`
+	Pairs       []string             `json:"pairs,omitempty"`
+	Perpetual   bool                 `json:"perpetual"`
+	PublishedAt int64                `json:"published_at"`
+}
+
+// AnnouncementFeed provides the latest announcements of an exchange
+type AnnouncementFeed interface {
+	// Exchange returns the name of the exchange
+	Exchange() string
+
+	// Latest returns the most recent announcements
+	Latest() ([]Announcement, error)
+}
+
+// announcementClient fetches announcement feeds, which are public
+var announcementClient = &http.Client{Timeout: 10 * time.Second}
+
+// announcementPair matches USDT pairs such as BTCUSDT, BTC-USDT or BTC/USDT
+var announcementPair = regexp.MustCompile(`\b([A-Z0-9]{2,20})[-/_]?USDT\b`)
+
+// newAnnouncement builds an announcement, deriving the pairs and contract
+// type from its title
+func newAnnouncement(exchange string, category AnnouncementCategory, title, url string, published int64) Announcement {
+	a := Announcement{
+		ID:          exchange + "|" + url,
+		Exchange:    exchange,
+		Category:    category,
+		Title:       title,
+		URL:         url,
+		PublishedAt: published,
+	}
+	if url == "" {
+		a.ID = exchange + "|" + strconv.FormatInt(published, 10) + "|" + title
+	}
+	seen := make(map[string]bool)
+	for _, m := range announcementPair.FindAllStringSubmatch(title, -1) {
+		if pair := m[1] + "_USDT"; !seen[pair] {
+			seen[pair] = true
+			a.Pairs = append(a.Pairs, pair)
+		}
+	}
+	lower := strings.ToLower(title)
+	a.Perpetual = strings.Contains(lower, "perpetual") || strings.Contains(lower, "swap")
+	return a
+}
+
+// getJSON fetches a JSON document
+func getJSON(url string, out interface{}) error {
+	resp, err := announcementClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// bybitAnnouncements reads Bybit's announcement feed
+type bybitAnnouncements struct {
+	baseURL string
+}
+
+// NewBybitAnnouncements creates the announcement feed of Bybit
+func NewBybitAnnouncements(baseURL string) AnnouncementFeed {
+	if baseURL == "" {
+		baseURL = "https://api.bybit.com"
+	}
+	return &bybitAnnouncements{baseURL: baseURL}
+}
+
+// Exchange implements the AnnouncementFeed interface
+func (f *bybitAnnouncements) Exchange() string {
+	return "bybit"
+}
+
+// Latest implements the AnnouncementFeed interface
+func (f *bybitAnnouncements) Latest() ([]Announcement, error) {
+	var resp struct {
+		RetCode int    `json:"retCode"`
+		RetMsg  string `json:"retMsg"`
+		Result  struct {
+			List []struct {
+				Title string `json:"title"`
+				URL   string `json:"url"`
+				Type  struct {
+					Key string `json:"key"`
+				} `json:"type"`
+				PublishTime int64 `json:"publishTime"`
+			} `json:"list"`
+		} `json:"result"`
+	}
+	if err := getJSON(f.baseURL+"/v5/announcements/index?locale=en-US&limit=50", &resp); err != nil {
+		return nil, err
+	}
+	if resp.RetCode != 0 {
+		return nil, fmt.Errorf("bybit announcements: %s", resp.RetMsg)
+	}
+
+	announcements := make([]Announcement, 0, len(resp.Result.List))
+	for _, a := range resp.Result.List {
+		category := OtherAnnouncement
+		switch a.Type.Key {
+		case "new_crypto":
+			category = ListingAnnouncement
+		case "delistings":
+			category = DelistingAnnouncement
+		case "product_updates":
+			category = ContractAnnouncement
+		case "maintenance_updates":
+			category = MaintenanceAnnouncement
+		}
+		announcements = append(announcements, newAnnouncement(f.Exchange(), category, a.Title, a.URL, a.PublishTime))
+	}
+	return announcements, nil
+}
+
+// okxAnnouncements reads OKX's announcement feed
+type okxAnnouncements struct {
+	baseURL string
+}
+
+// NewOKXAnnouncements creates the announcement feed of OKX
+func NewOKXAnnouncements(baseURL string) AnnouncementFeed {
+	if baseURL == "" {
+		baseURL = "https://www.okx.com"
+	}
+	return &okxAnnouncements{baseURL: baseURL}
+}
+
+// Exchange implements the AnnouncementFeed interface
+func (f *okxAnnouncements) Exchange() string {
+	return "okx"
+}
+
+// Latest implements the AnnouncementFeed interface
+func (f *okxAnnouncements) Latest() ([]Announcement, error) {
+	var resp struct {
+		Code string `json:"code"`
+		Msg  string `json:"msg"`
+		Data []struct {
+			Details []struct {
+				AnnType string `json:"annType"`
+				Title   string `json:"title"`
+				URL     string `json:"url"`
+				PTime   string `json:"pTime"`
+			} `json:"details"`
+		} `json:"data"`
+	}
+	if err := getJSON(f.baseURL+"/api/v5/support/announcements", &resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("okx announcements: %s", resp.Msg)
+	}
+
+	var announcements []Announcement
+	for _, page := range resp.Data {
+		for _, a := range page.Details {
+			category := OtherAnnouncement
+			switch {
+			case strings.Contains(a.AnnType, "delisting"):
+				category = DelistingAnnouncement
+			case strings.Contains(a.AnnType, "new-listings"):
+				category = ListingAnnouncement
+			case strings.Contains(a.AnnType, "trading-updates"):
+				category = ContractAnnouncement
+			case strings.Contains(a.AnnType, "maintenance") || strings.Contains(a.AnnType, "upgrade"):
+				category = MaintenanceAnnouncement
+			}
+			published, _ := strconv.ParseInt(a.PTime, 10, 64)
+			announcements = append(announcements, newAnnouncement(f.Exchange(), category, a.Title, a.URL, published))
+		}
+	}
+	return announcements, nil
+}
+
+// AnnouncementMonitor polls exchange announcement feeds and publishes every
+// new announcement as a market event. Announcements already out when a feed
+// is first read are remembered without being published.
+type AnnouncementMonitor struct {
+	feeds    []AnnouncementFeed
+	bus      *EventBus
+	interval time.Duration
+
+	// OnAnnouncement is called for every new announcement; defaults to logging it
+	OnAnnouncement func(Announcement)
+
+	mu     sync.Mutex
+	seen   map[string]bool
+	primed map[string]bool
+	recent []Announcement
+	stop   chan struct{}
+}
+
+// NewAnnouncementMonitor creates a new announcement monitor; bus may be nil
+func NewAnnouncementMonitor(feeds []AnnouncementFeed, bus *EventBus, interval time.Duration) *AnnouncementMonitor {
+	return &AnnouncementMonitor{
+		feeds:    feeds,
+		bus:      bus,
+		interval: interval,
+		seen:     make(map[string]bool),
+		primed:   make(map[string]bool),
+		OnAnnouncement: func(a Announcement) {
+			logger.Info("%s announcement [%s]: %s", a.Exchange, a.Category, a.Title)
+		},
+	}
+}
+
+// Start begins polling in the background
+func (m *AnnouncementMonitor) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	go func() {
+		m.Check()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.Check()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts polling
+func (m *AnnouncementMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Check reads every feed and publishes the announcements not seen before
+func (m *AnnouncementMonitor) Check() []Announcement {
+	var published []Announcement
+	for _, feed := range m.feeds {
+		announcements, err := feed.Latest()
+		if err != nil {
+			logger.Warning("Failed to read %s announcements: %v", feed.Exchange(), err)
+			continue
+		}
+
+		m.mu.Lock()
+		primed := m.primed[feed.Exchange()]
+		m.primed[feed.Exchange()] = true
+		var fresh []Announcement
+		for _, a := range announcements {
+			if m.seen[a.ID] {
+				continue
+			}
+			m.seen[a.ID] = true
+			m.recent = append(m.recent, a)
+			if primed {
+				fresh = append(fresh, a)
+			}
+		}
+		sort.SliceStable(m.recent, func(i, j int) bool { return m.recent[i].PublishedAt < m.recent[j].PublishedAt })
+		if n := len(m.recent); n > maxRecentAnnouncements {
+			m.recent = append([]Announcement(nil), m.recent[n-maxRecentAnnouncements:]...)
+		}
+		m.mu.Unlock()
+
+		for _, a := range fresh {
+			m.OnAnnouncement(a)
+			if m.bus != nil {
+				pair := ""
+				if len(a.Pairs) > 0 {
+					pair = a.Pairs[0]
+				}
+				m.bus.Publish(MarketEvent{Type: AnnouncementEventType, Pair: pair, Data: a, Timestamp: time.Now()})
+			}
+		}
+		published = append(published, fresh...)
+	}
+	return published
+}
+
+// Recent returns the latest announcements seen, oldest first
+func (m *AnnouncementMonitor) Recent() []Announcement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Announcement(nil), m.recent...)
+}
@@ -1,11 +1,40 @@
 package market
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/nofx/crypto"
+	"github.com/nofx/ratelimit"
+	"github.com/nofx/retry"
+)
+
+// DefaultMaxResponseSize is the largest response body read when the client
+// sets no limit of its own
+const DefaultMaxResponseSize = 16 << 20
+
+var (
+	// ErrUnauthorized is returned when the API rejects the credentials or
+	// signature of a request
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is returned when the requested resource doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited is returned when the API rejects a request for
+	// exceeding its rate limits
+	ErrRateLimited = errors.New("rate limited")
+	// ErrBadRequest is returned when the API rejects the parameters of a request
+	ErrBadRequest = errors.New("bad request")
+	// ErrResponseTooLarge is returned when a response body exceeds the
+	// client's size limit
+	ErrResponseTooLarge = errors.New("response too large")
 )
 
 // APIClient represents a client for interacting with exchange APIs
@@ -14,6 +43,14 @@ type APIClient struct {
 	APIKey     string
 	SecretKey  string
 	HTTPClient *http.Client
+
+	// Limiter throttles the requests as Gate.io public calls when set
+	Limiter *ratelimit.Limiter
+	// Retry sets how requests failing with a timeout, 429 or 5xx are retried
+	Retry retry.Policy
+	// MaxResponseSize caps the bytes read of a response body; zero means
+	// DefaultMaxResponseSize
+	MaxResponseSize int64
 }
 
 // NewAPIClient creates a new API client
@@ -22,6 +59,7 @@ func NewAPIClient(baseURL, apiKey, secretKey string) *APIClient {
 		BaseURL: baseURL,
 		APIKey:  apiKey,
 		SecretKey: secretKey,
+		Retry:     retry.DefaultPolicy,
 		HTTPClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
@@ -29,15 +67,9 @@ func NewAPIClient(baseURL, apiKey, secretKey string) *APIClient {
 }
 
 // GetPrice gets the current price for a trading pair
-func (c *APIClient) GetPrice(pair string) (*PriceData, error) {
+func (c *APIClient) GetPrice(ctx context.Context, pair string) (*PriceData, error) {
 	url := fmt.Sprintf("%s/market/price?currency_pair=%s", c.BaseURL, pair)
-	resp, err := c.doRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := c.doRequest(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -51,16 +83,27 @@ func (c *APIClient) GetPrice(pair string) (*PriceData, error) {
 }
 
 // GetCandles gets historical price data (candles) for a trading pair
-func (c *APIClient) GetCandles(pair, interval string, limit int) ([]CandleData, error) {
+func (c *APIClient) GetCandles(ctx context.Context, pair, interval string, limit int) ([]CandleData, error) {
 	url := fmt.Sprintf("%s/market/candles?currency_pair=%s\u0026interval=%s\u0026limit=%d",
 		c.BaseURL, pair, interval, limit)
-	resp, err := c.doRequest("GET", url, nil)
+	body, err := c.doRequest(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	var candles []CandleData
+	if err := json.Unmarshal(body, &candles); err != nil {
+		return nil, err
+	}
+
+	return candles, nil
+}
+
+// GetCandlesRange gets the candles of a trading pair with from <= timestamp <= to, in unix seconds
+func (c *APIClient) GetCandlesRange(ctx context.Context, pair, interval string, from, to int64) ([]CandleData, error) {
+	url := fmt.Sprintf("%s/market/candles?currency_pair=%s\u0026interval=%s\u0026from=%d\u0026to=%d",
+		c.BaseURL, pair, interval, from, to)
+	body, err := c.doRequest(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -73,21 +116,220 @@ func (c *APIClient) GetCandles(pair, interval string, limit int) ([]CandleData,
 	return candles, nil
 }
 
-// doRequest performs an HTTP request with authentication
-func (c *APIClient) doRequest(method, url string, body []byte) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, nil)
+// GetTicker gets the 24h ticker for a trading pair
+func (c *APIClient) GetTicker(ctx context.Context, pair string) (*TickerData, error) {
+	url := fmt.Sprintf("%s/market/tickers?currency_pair=%s", c.BaseURL, pair)
+	body, err := c.doRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ticker TickerData
+	if err := json.Unmarshal(body, &ticker); err != nil {
+		return nil, err
+	}
+
+	return &ticker, nil
+}
+
+// GetOrderBook gets the order book for a trading pair up to the given depth
+func (c *APIClient) GetOrderBook(ctx context.Context, pair string, limit int) (*OrderBook, error) {
+	url := fmt.Sprintf("%s/market/order_book?currency_pair=%s\u0026limit=%d\u0026with_id=true", c.BaseURL, pair, limit)
+	body, err := c.doRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var book OrderBook
+	if err := json.Unmarshal(body, &book); err != nil {
+		return nil, err
+	}
+
+	return &book, nil
+}
+
+// GetContract gets the trading rules and metadata for a contract
+func (c *APIClient) GetContract(ctx context.Context, pair string) (*ContractInfo, error) {
+	url := fmt.Sprintf("%s/market/contracts/%s", c.BaseURL, pair)
+	body, err := c.doRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var contract ContractInfo
+	if err := json.Unmarshal(body, &contract); err != nil {
+		return nil, err
+	}
+
+	return &contract, nil
+}
+
+// GetContracts lists the trading rules and metadata of every contract
+func (c *APIClient) GetContracts(ctx context.Context) ([]ContractInfo, error) {
+	url := fmt.Sprintf("%s/market/contracts", c.BaseURL)
+	body, err := c.doRequest(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add authentication headers
-	if c.APIKey != "" {
-		req.Header.Set("KEY", c.APIKey)
-		// Add signature for authenticated requests
-		// This is a placeholder for actual signature implementation
+	var contracts []ContractInfo
+	if err := json.Unmarshal(body, &contracts); err != nil {
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	return contracts, nil
+}
 
-	return c.HTTPClient.Do(req)
-}
\ No newline at end of file
+// GetFundingRate gets the current funding rate of a perpetual contract
+func (c *APIClient) GetFundingRate(ctx context.Context, pair string) (*FundingRate, error) {
+	url := fmt.Sprintf("%s/market/funding_rate?currency_pair=%s", c.BaseURL, pair)
+	body, err := c.doRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rate FundingRate
+	if err := json.Unmarshal(body, &rate); err != nil {
+		return nil, err
+	}
+
+	return &rate, nil
+}
+
+// GetFundingHistoryRange gets up to limit funding rates of a perpetual
+// contract settled with from <= time <= to, in unix seconds
+func (c *APIClient) GetFundingHistoryRange(ctx context.Context, pair string, from, to int64, limit int) ([]FundingRate, error) {
+	url := fmt.Sprintf("%s/market/funding_rate/history?currency_pair=%s\u0026from=%d\u0026to=%d\u0026limit=%d",
+		c.BaseURL, pair, from, to, limit)
+	body, err := c.doRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []FundingRate
+	if err := json.Unmarshal(body, &rates); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// GetFundingHistory gets the most recent settled funding rates of a perpetual contract
+func (c *APIClient) GetFundingHistory(ctx context.Context, pair string, limit int) ([]FundingRate, error) {
+	url := fmt.Sprintf("%s/market/funding_rate/history?currency_pair=%s\u0026limit=%d", c.BaseURL, pair, limit)
+	body, err := c.doRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []FundingRate
+	if err := json.Unmarshal(body, &rates); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// doRequest performs an HTTP request, signed when the client has API
+// credentials, and returns the response body. Non-2xx responses fail with a
+// *retry.StatusError wrapped in the sentinel of their kind, if any.
+func (c *APIClient) doRequest(ctx context.Context, method, endpoint string, body []byte) ([]byte, error) {
+	var data []byte
+	err := c.Retry.Do(ctx, "Gate.io "+method+" "+endpoint, func(int) error {
+		if err := c.Limiter.Wait(ctx, "gate", ratelimit.Public, 1); err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		if c.APIKey != "" {
+			c.sign(req, body)
+		}
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if data, err = c.readBody(resp); err != nil {
+			return fmt.Errorf("Gate.io %s %s: %w", method, req.URL.Path, err)
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("Gate.io %s %s: %w", method, req.URL.Path, statusError(resp.StatusCode, data))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// sign adds the Gate.io v4 authentication headers: the HMAC-SHA512 of the
+// method, path, query, body digest and timestamp, keyed by the secret key
+func (c *APIClient) sign(req *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	payload := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		crypto.HashSHA512(body),
+		timestamp,
+	}, "\n")
+	req.Header.Set("KEY", c.APIKey)
+	req.Header.Set("Timestamp", timestamp)
+	req.Header.Set("SIGN", crypto.SignSHA512([]byte(c.SecretKey), []byte(payload)))
+}
+
+// readBody reads a response body of at most MaxResponseSize bytes
+func (c *APIClient) readBody(resp *http.Response) ([]byte, error) {
+	limit := c.MaxResponseSize
+	if limit <= 0 {
+		limit = DefaultMaxResponseSize
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, limit)
+	}
+	return data, nil
+}
+
+// statusError returns the error of a non-2xx response, with the label and
+// message of a Gate.io error body when present
+func statusError(status int, data []byte) error {
+	message := string(data)
+	var apiErr struct {
+		Label   string `json:"label"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &apiErr) == nil && apiErr.Label != "" {
+		message = apiErr.Label
+		if apiErr.Message != "" {
+			message += ": " + apiErr.Message
+		}
+	}
+
+	err := &retry.StatusError{Status: status, Message: message}
+	var kind error
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		kind = ErrUnauthorized
+	case status == http.StatusNotFound:
+		kind = ErrNotFound
+	case status == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case status >= 400 && status < 500:
+		kind = ErrBadRequest
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
@@ -0,0 +1,327 @@
+package market
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+const (
+	// BarUpdateEvent is the MarketEvent type of partial updates of a live bar
+	BarUpdateEvent = "bar_update"
+	// BarCloseEvent is the MarketEvent type of a live bar once it closed
+	BarCloseEvent = "bar_close"
+)
+
+// barCloseCheck is how often bars are closed once their interval ended,
+// bounding the latency between the close time and the close event
+const barCloseCheck = 250 * time.Millisecond
+
+// barUpdateInterval is the minimum time between two published partial
+// updates of a bar; closes are always published
+const barUpdateInterval = time.Second
+
+// barBufferSize is the channel capacity of each bar subscription
+const barBufferSize = 64
+
+// Trade represents a public trade of a contract; sells have a negative Size
+type Trade struct {
+	Pair  string    `json:"currency_pair"`
+	Price float64   `json:"price"`
+	Size  float64   `json:"size"`
+	Time  time.Time `json:"time"`
+}
+
+// Bar represents a live candle built from trades; Closed is set once its
+// interval ended and the candle is final
+type Bar struct {
+	Pair     string     `json:"currency_pair"`
+	Interval string     `json:"interval"`
+	Candle   CandleData `json:"candle"`
+	Closed   bool       `json:"closed"`
+}
+
+// CloseTime returns when the bar's interval ends
+func (b Bar) CloseTime() time.Time {
+	length, _ := IntervalSeconds(b.Interval)
+	return time.Unix(b.Candle.Timestamp+length, 0)
+}
+
+// liveBar is the bar being built for a series
+type liveBar struct {
+	pair      string
+	interval  string
+	length    int64
+	candle    CandleData
+	open      bool
+	published time.Time
+}
+
+// BarSubscription receives the bars of one series: every close, and with
+// partial updates every trade's update, dropped while the subscriber lags
+type BarSubscription struct {
+	builder *BarBuilder
+	key     string
+	partial bool
+
+	// C receives the bars; it's closed by Close
+	C chan Bar
+
+	once sync.Once
+}
+
+// Close ends the subscription
+func (s *BarSubscription) Close() {
+	s.once.Do(func() {
+		s.builder.unsubscribe(s)
+	})
+}
+
+// BarBuilder builds live candles from the trade stream instead of polling the
+// candle endpoint. Each series publishes partial updates as trades arrive and
+// a close event as soon as its interval ends, even without a trade; intervals
+// without trades close flat at the previous close. Closed candles are merged
+// into the candle store.
+type BarBuilder struct {
+	intervals []string
+	store     *CandleStore
+	events    *EventBus
+
+	// OnPair is called for pairs subscribed that no bar was built for yet,
+	// so their trades can be streamed
+	OnPair func(pair string)
+
+	mu     sync.Mutex
+	series map[string]*liveBar
+	pairs  map[string][]*liveBar
+	subs   map[string][]*BarSubscription
+	stop   chan struct{}
+}
+
+// NewBarBuilder creates a new bar builder building the given intervals of
+// every traded pair; store and events may be nil
+func NewBarBuilder(intervals []string, store *CandleStore, events *EventBus) *BarBuilder {
+	return &BarBuilder{
+		intervals: intervals,
+		store:     store,
+		events:    events,
+		series:    make(map[string]*liveBar),
+		pairs:     make(map[string][]*liveBar),
+		subs:      make(map[string][]*BarSubscription),
+	}
+}
+
+// Start closes the bars whose interval ended in the background
+func (b *BarBuilder) Start() {
+	b.mu.Lock()
+	if b.stop != nil {
+		b.mu.Unlock()
+		return
+	}
+	b.stop = make(chan struct{})
+	stop := b.stop
+	b.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(barCloseCheck)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				b.CloseDue(now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts closing bars in the background
+func (b *BarBuilder) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+}
+
+// Subscribe returns a subscription to the bars of a pair and interval,
+// building the series from now on if it wasn't yet; partial selects the
+// partial updates besides the closes
+func (b *BarBuilder) Subscribe(pair, interval string, partial bool) (*BarSubscription, error) {
+	b.mu.Lock()
+	_, known := b.pairs[pair]
+	if _, err := b.add(pair, interval); err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+	s := &BarSubscription{
+		builder: b,
+		key:     seriesKey(pair, interval),
+		partial: partial,
+		C:       make(chan Bar, barBufferSize),
+	}
+	b.subs[s.key] = append(b.subs[s.key], s)
+	onPair := b.OnPair
+	b.mu.Unlock()
+
+	if !known && onPair != nil {
+		onPair(pair)
+	}
+	return s, nil
+}
+
+// unsubscribe removes a subscription and closes its channel
+func (b *BarBuilder) unsubscribe(s *BarSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := b.subs[s.key]
+	for i, sub := range subs {
+		if sub == s {
+			b.subs[s.key] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(b.subs[s.key]) == 0 {
+		delete(b.subs, s.key)
+	}
+	close(s.C)
+}
+
+// add returns the bar of a series, adding it to the pair's built series;
+// the caller must hold the lock
+func (b *BarBuilder) add(pair, interval string) (*liveBar, error) {
+	key := seriesKey(pair, interval)
+	if bar, ok := b.series[key]; ok {
+		return bar, nil
+	}
+	length, err := IntervalSeconds(interval)
+	if err != nil {
+		return nil, err
+	}
+	bar := &liveBar{pair: pair, interval: interval, length: length}
+	b.series[key] = bar
+	b.pairs[pair] = append(b.pairs[pair], bar)
+	return bar, nil
+}
+
+// AddTrade updates the bars of the trade's pair, closing those whose
+// interval ended before the trade; trades older than a bar are ignored
+func (b *BarBuilder) AddTrade(t Trade) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.pairs[t.Pair]; !ok {
+		for _, interval := range b.intervals {
+			if _, err := b.add(t.Pair, interval); err != nil {
+				logger.Warning("Failed to build %s bars of %s: %v", interval, t.Pair, err)
+			}
+		}
+	}
+
+	var out []Bar
+	ts := t.Time.Unix()
+	for _, bar := range b.pairs[t.Pair] {
+		start := ts - ts%bar.length
+		if bar.open && start < bar.candle.Timestamp {
+			continue
+		}
+		if bar.open && start > bar.candle.Timestamp {
+			out = append(out, bar.close())
+		}
+
+		size := t.Size
+		if size < 0 {
+			size = -size
+		}
+		if !bar.open || start > bar.candle.Timestamp {
+			bar.candle = CandleData{Timestamp: start}
+			bar.open = true
+		}
+		// The first trade opens the bar, replacing a flat open
+		c := &bar.candle
+		if c.Volume == 0 {
+			c.Open, c.High, c.Low = t.Price, t.Price, t.Price
+		}
+		if t.Price > c.High {
+			c.High = t.Price
+		}
+		if t.Price < c.Low {
+			c.Low = t.Price
+		}
+		c.Close = t.Price
+		c.Volume += size
+
+		if t.Time.Sub(bar.published) >= barUpdateInterval {
+			bar.published = t.Time
+			out = append(out, bar.snapshot(false))
+		}
+	}
+	b.publish(out)
+}
+
+// CloseDue closes every bar whose interval ended by now and opens the next
+// one flat at its close
+func (b *BarBuilder) CloseDue(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []Bar
+	ts := now.Unix()
+	for _, bar := range b.series {
+		if bar.open && bar.candle.Timestamp+bar.length <= ts {
+			out = append(out, bar.close())
+		}
+	}
+	b.publish(out)
+}
+
+// close returns the closed bar and opens the next one flat at its close;
+// the caller must hold the lock
+func (bar *liveBar) close() Bar {
+	closed := bar.snapshot(true)
+	last := bar.candle.Close
+	bar.candle = CandleData{
+		Timestamp: bar.candle.Timestamp + bar.length,
+		Open:      last,
+		High:      last,
+		Low:       last,
+		Close:     last,
+	}
+	return closed
+}
+
+// snapshot returns the current state of the bar
+func (bar *liveBar) snapshot(closed bool) Bar {
+	return Bar{Pair: bar.pair, Interval: bar.interval, Candle: bar.candle, Closed: closed}
+}
+
+// publish stores closed bars and delivers bars to the event bus and the
+// subscribers of their series, in order; the caller must hold the lock
+func (b *BarBuilder) publish(bars []Bar) {
+	for _, bar := range bars {
+		if bar.Closed && b.store != nil {
+			b.store.Add(bar.Pair, bar.Interval, bar.Candle)
+		}
+		if b.events != nil {
+			eventType := BarUpdateEvent
+			if bar.Closed {
+				eventType = BarCloseEvent
+			}
+			b.events.Publish(MarketEvent{Type: eventType, Pair: bar.Pair, Data: bar, Timestamp: time.Now()})
+		}
+
+		for _, s := range b.subs[seriesKey(bar.Pair, bar.Interval)] {
+			if !bar.Closed && !s.partial {
+				continue
+			}
+			select {
+			case s.C <- bar:
+			default:
+				if bar.Closed {
+					logger.Warning("Dropped the %s %s bar close of a lagging subscriber", bar.Pair, bar.Interval)
+				}
+			}
+		}
+	}
+}
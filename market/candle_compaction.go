@@ -0,0 +1,190 @@
+package market
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// intervalSeconds maps the candle intervals that take part in compaction to their length
+var intervalSeconds = map[string]int64{
+	"1m": 60,
+	"5m": 300,
+	"1h": 3600,
+	"1d": 86400,
+}
+
+// CompactionTier rolls candles of interval From older than Retain up into interval To
+type CompactionTier struct {
+	From   string
+	To     string
+	Retain time.Duration
+}
+
+// CandleArchive persists compacted candles, so they outlive the memory of
+// the store and restarts
+type CandleArchive interface {
+	SaveCandles(pair, interval string, candles []CandleData) error
+	DeleteCandles(pair, interval string, before int64) error
+	LatestCandles(pair, interval string, limit int) ([]CandleData, error)
+}
+
+// archived is a compaction step to mirror in the archive: the target
+// candles produced and the source candles before cutoff rolled up
+type archived struct {
+	pair, from, to string
+	cutoff         int64
+	candles        []CandleData
+}
+
+// Compact applies the tiers in order, so candles cascade from fine to coarse
+// intervals, and returns the number of candles removed. Only complete target
+// buckets are compacted; target candles already stored (typically fetched
+// from the exchange) take precedence over aggregated ones. With an archive
+// the compacted candles are saved and the rolled up ones deleted from it.
+func (s *CandleStore) Compact(now time.Time, tiers []CompactionTier) int {
+	removed, steps := s.compact(now, tiers)
+	archive := s.archiveOf()
+	if archive == nil {
+		return removed
+	}
+	for _, step := range steps {
+		if err := archive.SaveCandles(step.pair, step.to, step.candles); err != nil {
+			logger.Warning("Failed to archive compacted %s %s candles: %v", step.pair, step.to, err)
+			continue
+		}
+		if err := archive.DeleteCandles(step.pair, step.from, step.cutoff); err != nil {
+			logger.Warning("Failed to drop compacted %s %s candles from the archive: %v", step.pair, step.from, err)
+		}
+	}
+	return removed
+}
+
+// compact compacts the series in memory and returns the steps to archive
+func (s *CandleStore) compact(now time.Time, tiers []CompactionTier) (int, []archived) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	var steps []archived
+	for _, tier := range tiers {
+		to := intervalSeconds[tier.To]
+		if to == 0 || intervalSeconds[tier.From] == 0 {
+			continue
+		}
+		cutoff := now.Add(-tier.Retain).Unix()
+		cutoff -= cutoff % to
+
+		for key, series := range s.series {
+			pair, interval, _ := strings.Cut(key, "|")
+			if interval != tier.From {
+				continue
+			}
+
+			n := 0
+			for n < len(series) && series[n].Timestamp < cutoff {
+				n++
+			}
+			if n == 0 {
+				continue
+			}
+
+			aggregated := aggregateCandles(series[:n], to)
+			target := seriesKey(pair, tier.To)
+			s.merge(target, aggregated, false)
+			s.series[key] = append([]CandleData(nil), series[n:]...)
+			if cutoff > s.compacted[key] {
+				s.compacted[key] = cutoff
+			}
+			removed += n
+			steps = append(steps, archived{
+				pair:    pair,
+				from:    tier.From,
+				to:      tier.To,
+				cutoff:  cutoff,
+				candles: s.between(target, aggregated[0].Timestamp, aggregated[len(aggregated)-1].Timestamp+1),
+			})
+		}
+	}
+	return removed, steps
+}
+
+// aggregateCandles combines sorted candles into buckets of the given length in seconds
+func aggregateCandles(candles []CandleData, length int64) []CandleData {
+	var out []CandleData
+	for _, c := range candles {
+		bucket := c.Timestamp - c.Timestamp%length
+		if len(out) == 0 || out[len(out)-1].Timestamp != bucket {
+			c.Timestamp = bucket
+			out = append(out, c)
+			continue
+		}
+		last := &out[len(out)-1]
+		if c.High > last.High {
+			last.High = c.High
+		}
+		if c.Low < last.Low {
+			last.Low = c.Low
+		}
+		last.Close = c.Close
+		last.Volume += c.Volume
+	}
+	return out
+}
+
+// CandleCompactor periodically compacts a candle store in the background
+type CandleCompactor struct {
+	store    *CandleStore
+	tiers    []CompactionTier
+	interval time.Duration
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// NewCandleCompactor creates a new compactor running every interval
+func NewCandleCompactor(store *CandleStore, tiers []CompactionTier, interval time.Duration) *CandleCompactor {
+	return &CandleCompactor{
+		store:    store,
+		tiers:    tiers,
+		interval: interval,
+	}
+}
+
+// Start begins periodic compaction
+func (c *CandleCompactor) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		return
+	}
+	c.stop = make(chan struct{})
+	stop := c.stop
+
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if n := c.store.Compact(time.Now(), c.tiers); n > 0 {
+					logger.Debug("Compacted %d candles", n)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts periodic compaction
+func (c *CandleCompactor) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
@@ -0,0 +1,285 @@
+package market
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// candlePageSize is the number of candles requested per page, below the
+// exchange's cap of points per query
+const candlePageSize = 1000
+
+// intervalUnits maps candle interval suffixes to their length in seconds
+var intervalUnits = map[byte]int64{
+	's': 1,
+	'm': 60,
+	'h': 3600,
+	'd': 86400,
+	'w': 7 * 86400,
+}
+
+// IntervalSeconds returns the length of a candle interval such as "5m" or "4h" in seconds
+func IntervalSeconds(interval string) (int64, error) {
+	if len(interval) < 2 {
+		return 0, fmt.Errorf("invalid interval %q", interval)
+	}
+	unit, ok := intervalUnits[interval[len(interval)-1]]
+	n, err := strconv.ParseInt(interval[:len(interval)-1], 10, 64)
+	if !ok || err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", interval)
+	}
+	return n * unit, nil
+}
+
+// CandleDownloader fetches arbitrary ranges of closed candles page by page and
+// caches them on disk as one CSV file per series, so every range is downloaded
+// once. Candles are deduplicated by timestamp, and holes the exchange has no
+// data for are filled with flat zero-volume candles at the previous close.
+type CandleDownloader struct {
+	client *APIClient
+	dir    string
+
+	// mu serializes access to the cache files
+	mu sync.Mutex
+}
+
+// NewCandleDownloader creates a new candle downloader caching into dir
+func NewCandleDownloader(client *APIClient, dir string) *CandleDownloader {
+	return &CandleDownloader{
+		client: client,
+		dir:    dir,
+	}
+}
+
+// Download returns the closed candles of a series with from <= timestamp < to,
+// downloading the parts missing from the cache
+func (d *CandleDownloader) Download(ctx context.Context, pair, interval string, from, to time.Time) ([]CandleData, error) {
+	step, err := IntervalSeconds(interval)
+	if err != nil {
+		return nil, err
+	}
+	start := from.Unix()
+	if r := start % step; r != 0 {
+		start += step - r
+	}
+	end := to.Unix()
+	if open := time.Now().Unix(); end > open-open%step {
+		end = open - open%step
+	}
+	if start >= end {
+		return []CandleData{}, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	series, err := d.load(pair, interval)
+	if err != nil {
+		return nil, err
+	}
+	missing := missingRanges(series, start, end, step)
+	if len(missing) > 0 {
+		var fetched []CandleData
+		for _, r := range missing {
+			candles, err := d.fetch(ctx, pair, interval, r[0], r[1], step)
+			if err != nil {
+				return nil, err
+			}
+			fetched = append(fetched, candles...)
+		}
+		series = fillGaps(mergeCandles(series, fetched), start, end, step)
+		if err := d.save(pair, interval, series); err != nil {
+			return nil, err
+		}
+	}
+
+	first := sort.Search(len(series), func(i int) bool { return series[i].Timestamp >= start })
+	last := sort.Search(len(series), func(i int) bool { return series[i].Timestamp >= end })
+	return append([]CandleData{}, series[first:last]...), nil
+}
+
+// fetch downloads the candles with from <= timestamp < to page by page
+func (d *CandleDownloader) fetch(ctx context.Context, pair, interval string, from, to, step int64) ([]CandleData, error) {
+	var candles []CandleData
+	for page := from; page < to; page += candlePageSize * step {
+		pageEnd := page + candlePageSize*step
+		if pageEnd > to {
+			pageEnd = to
+		}
+		batch, err := d.client.GetCandlesRange(ctx, pair, interval, page, pageEnd-step)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range batch {
+			if c.Timestamp >= page && c.Timestamp < pageEnd {
+				candles = append(candles, c)
+			}
+		}
+	}
+	return candles, nil
+}
+
+// path returns the cache file of a series
+func (d *CandleDownloader) path(pair, interval string) string {
+	return filepath.Join(d.dir, pair+"_"+interval+".csv")
+}
+
+// load reads the cached candles of a series, none when it isn't cached yet
+func (d *CandleDownloader) load(pair, interval string) ([]CandleData, error) {
+	path := d.path(pair, interval)
+	records, err := readCSV(path)
+	if err != nil {
+		return nil, err
+	}
+	candles := make([]CandleData, 0, len(records))
+	for i, r := range records {
+		var c CandleData
+		var values [5]float64
+		if c.Timestamp, err = strconv.ParseInt(r[0], 10, 64); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, i+2, err)
+		}
+		for j := range values {
+			if values[j], err = strconv.ParseFloat(r[j+1], 64); err != nil {
+				return nil, fmt.Errorf("%s line %d: %v", path, i+2, err)
+			}
+		}
+		c.Open, c.High, c.Low, c.Close, c.Volume = values[0], values[1], values[2], values[3], values[4]
+		candles = append(candles, c)
+	}
+	return mergeCandles(nil, candles), nil
+}
+
+// save replaces the cache file of a series
+func (d *CandleDownloader) save(pair, interval string, candles []CandleData) error {
+	rows := make([][]string, len(candles))
+	for i, c := range candles {
+		rows[i] = []string{
+			strconv.FormatInt(c.Timestamp, 10),
+			formatFloat(c.Open), formatFloat(c.High), formatFloat(c.Low), formatFloat(c.Close), formatFloat(c.Volume),
+		}
+	}
+	return writeCSV(d.path(pair, interval), []string{"timestamp", "open", "high", "low", "close", "volume"}, rows)
+}
+
+// formatFloat formats a value for a cache file without losing precision
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// readCSV reads the records of a cache file after its header, none when the
+// file doesn't exist
+func readCSV(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[1:], nil
+}
+
+// writeCSV replaces a cache file, atomically so a crash never leaves a
+// truncated file
+func writeCSV(path string, header []string, rows [][]string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".cache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := csv.NewWriter(tmp)
+	w.Write(header)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// mergeCandles merges candles into a sorted series deduplicated by
+// timestamp, later candles replacing earlier ones
+func mergeCandles(series, candles []CandleData) []CandleData {
+	byTime := make(map[int64]CandleData, len(series)+len(candles))
+	for _, c := range series {
+		byTime[c.Timestamp] = c
+	}
+	for _, c := range candles {
+		byTime[c.Timestamp] = c
+	}
+
+	merged := make([]CandleData, 0, len(byTime))
+	for _, c := range byTime {
+		merged = append(merged, c)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Timestamp < merged[j].Timestamp })
+	return merged
+}
+
+// missingRanges returns the [from, to) spans of candle timestamps between
+// start and end absent from a sorted series
+func missingRanges(series []CandleData, start, end, step int64) [][2]int64 {
+	have := make(map[int64]bool, len(series))
+	for _, c := range series {
+		have[c.Timestamp] = true
+	}
+
+	var ranges [][2]int64
+	for t := start; t < end; t += step {
+		if have[t] {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1][1] == t {
+			ranges[n-1][1] = t + step
+			continue
+		}
+		ranges = append(ranges, [2]int64{t, t + step})
+	}
+	return ranges
+}
+
+// fillGaps fills the holes between start and end of a sorted series that
+// have candles on both sides with flat candles at the previous close
+func fillGaps(series []CandleData, start, end, step int64) []CandleData {
+	var filled []CandleData
+	for i := 1; i < len(series); i++ {
+		prev := series[i-1]
+		for t := prev.Timestamp + step; t < series[i].Timestamp; t += step {
+			if t < start || t >= end {
+				continue
+			}
+			filled = append(filled, CandleData{
+				Timestamp: t,
+				Open:      prev.Close,
+				High:      prev.Close,
+				Low:       prev.Close,
+				Close:     prev.Close,
+			})
+		}
+	}
+	if len(filled) == 0 {
+		return series
+	}
+	return mergeCandles(series, filled)
+}
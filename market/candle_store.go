@@ -0,0 +1,206 @@
+package market
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// CandleStore keeps candles per pair and interval, sorted by timestamp and
+// deduplicated, backfilling from the exchange when it holds too few
+type CandleStore struct {
+	client     *APIClient
+	downloader *CandleDownloader
+	archive    CandleArchive
+	mu         sync.RWMutex
+	series     map[string][]CandleData
+	// compacted is the time before which a series was rolled up into a
+	// coarser one
+	compacted map[string]int64
+}
+
+// NewCandleStore creates a new candle store; client may be nil for a purely local store
+func NewCandleStore(client *APIClient) *CandleStore {
+	return &CandleStore{
+		client:    client,
+		series:    make(map[string][]CandleData),
+		compacted: make(map[string]int64),
+	}
+}
+
+// SetArchive makes the store persist compacted candles and read series it
+// holds too few candles of from the archive before the exchange
+func (s *CandleStore) SetArchive(archive CandleArchive) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.archive = archive
+}
+
+// archiveOf returns the archive of the store, nil without one
+func (s *CandleStore) archiveOf() CandleArchive {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.archive
+}
+
+// SetDownloader makes the store backfill more candles than a single request
+// returns through a paginating, caching downloader
+func (s *CandleStore) SetDownloader(d *CandleDownloader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.downloader = d
+}
+
+// seriesKey identifies a candle series
+func seriesKey(pair, interval string) string {
+	return pair + "|" + interval
+}
+
+// Add merges candles into a series, replacing candles with the same timestamp
+func (s *CandleStore) Add(pair, interval string, candles ...CandleData) {
+	if len(candles) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.merge(seriesKey(pair, interval), candles, true)
+}
+
+// merge merges candles into a series, replacing stored candles with the same
+// timestamp when replace is set; the caller must hold the write lock
+func (s *CandleStore) merge(key string, candles []CandleData, replace bool) {
+	byTime := make(map[int64]CandleData, len(s.series[key])+len(candles))
+	for _, c := range s.series[key] {
+		byTime[c.Timestamp] = c
+	}
+	for _, c := range candles {
+		if _, ok := byTime[c.Timestamp]; ok && !replace {
+			continue
+		}
+		byTime[c.Timestamp] = c
+	}
+
+	merged := make([]CandleData, 0, len(byTime))
+	for _, c := range byTime {
+		merged = append(merged, c)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Timestamp < merged[j].Timestamp })
+	s.series[key] = merged
+}
+
+// Get returns the latest limit candles of a series, reading the archive
+// when the store holds fewer and fetching from the exchange when it still
+// does or its newest candle is more than an interval old. Fetched candles
+// from before the series was compacted are returned but not stored, so
+// they aren't rolled up again.
+func (s *CandleStore) Get(pair, interval string, limit int) ([]CandleData, error) {
+	key := seriesKey(pair, interval)
+	s.mu.RLock()
+	n := len(s.series[key])
+	archive := s.archive
+	s.mu.RUnlock()
+
+	if n < limit && archive != nil {
+		candles, err := archive.LatestCandles(pair, interval, limit)
+		if err != nil {
+			logger.Warning("Failed to read archived %s %s candles: %v", pair, interval, err)
+		} else if len(candles) > 0 {
+			s.mu.Lock()
+			s.merge(key, candles, false)
+			s.mu.Unlock()
+		}
+	}
+
+	s.mu.RLock()
+	series := s.series[key]
+	n = len(series)
+	var newest int64
+	if n > 0 {
+		newest = series[n-1].Timestamp
+	}
+	downloader := s.downloader
+	s.mu.RUnlock()
+
+	var compacted []CandleData
+	if s.client != nil {
+		fetch := 0
+		if n < limit {
+			fetch = limit
+		} else if missed := missedIntervals(interval, newest); missed > 0 {
+			// The newest candle was still forming when stored, so it's
+			// refetched along with the ones opened since
+			fetch = missed + 1
+			if limit > 0 && fetch > limit {
+				fetch = limit
+			}
+		}
+		if fetch > 0 {
+			candles, err := s.backfill(downloader, pair, interval, fetch)
+			if err != nil {
+				return nil, err
+			}
+			sort.Slice(candles, func(i, j int) bool { return candles[i].Timestamp < candles[j].Timestamp })
+			s.mu.Lock()
+			cutoff := s.compacted[key]
+			i := sort.Search(len(candles), func(i int) bool { return candles[i].Timestamp >= cutoff })
+			compacted = candles[:i]
+			s.merge(key, candles[i:], true)
+			s.mu.Unlock()
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	series = s.series[key]
+	if len(compacted) > 0 {
+		series = mergeCandles(compacted, series)
+	}
+	if limit > 0 && len(series) > limit {
+		series = series[len(series)-limit:]
+	}
+	return append([]CandleData(nil), series...), nil
+}
+
+// missedIntervals returns the number of intervals that opened after the
+// candle at newest
+func missedIntervals(interval string, newest int64) int {
+	step, err := IntervalSeconds(interval)
+	if err != nil || step <= 0 {
+		return 0
+	}
+	return int((time.Now().Unix() - newest) / step)
+}
+
+// backfill fetches the latest limit candles of a series, through the
+// downloader when a single request can't return that many
+func (s *CandleStore) backfill(downloader *CandleDownloader, pair, interval string, limit int) ([]CandleData, error) {
+	if downloader == nil || limit <= candlePageSize {
+		return s.client.GetCandles(context.Background(), pair, interval, limit)
+	}
+	step, err := IntervalSeconds(interval)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return downloader.Download(context.Background(), pair, interval, now.Add(-time.Duration(int64(limit)*step)*time.Second), now)
+}
+
+// Range returns the stored candles of a series with from <= timestamp < to
+func (s *CandleStore) Range(pair, interval string, from, to int64) []CandleData {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.between(seriesKey(pair, interval), from, to)
+}
+
+// between returns a copy of the candles of a series with from <= timestamp
+// < to; the caller must hold the lock
+func (s *CandleStore) between(key string, from, to int64) []CandleData {
+	series := s.series[key]
+	start := sort.Search(len(series), func(i int) bool { return series[i].Timestamp >= from })
+	end := sort.Search(len(series), func(i int) bool { return series[i].Timestamp >= to })
+	return append([]CandleData(nil), series[start:end]...)
+}
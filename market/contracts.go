@@ -0,0 +1,72 @@
+package market
+
+import (
+	"context"
+	"sync"
+)
+
+// ContractCache caches contract metadata by trading pair
+type ContractCache struct {
+	client    *APIClient
+	mu        sync.RWMutex
+	contracts map[string]*ContractInfo
+}
+
+// NewContractCache creates a new contract metadata cache
+func NewContractCache(client *APIClient) *ContractCache {
+	return &ContractCache{
+		client:    client,
+		contracts: make(map[string]*ContractInfo),
+	}
+}
+
+// Get returns the cached metadata for a pair, fetching it on first use
+func (c *ContractCache) Get(pair string) (*ContractInfo, error) {
+	c.mu.RLock()
+	contract, ok := c.contracts[pair]
+	c.mu.RUnlock()
+	if ok {
+		return contract, nil
+	}
+
+	return c.Refresh(pair)
+}
+
+// Cached returns the cached metadata for a pair without fetching it
+func (c *ContractCache) Cached(pair string) (*ContractInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	contract, ok := c.contracts[pair]
+	return contract, ok
+}
+
+// Refresh fetches the metadata for a pair and replaces the cached entry
+func (c *ContractCache) Refresh(pair string) (*ContractInfo, error) {
+	contract, err := c.client.GetContract(context.Background(), pair)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.contracts[pair] = contract
+	c.mu.Unlock()
+
+	return contract, nil
+}
+
+// ListContracts implements ContractLister, caching every listed contract
+func (c *ContractCache) ListContracts(ctx context.Context) ([]ContractInfo, error) {
+	contracts, err := c.client.GetContracts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	for i := range contracts {
+		contract := contracts[i]
+		c.contracts[contract.Pair] = &contract
+	}
+	c.mu.Unlock()
+
+	return contracts, nil
+}
@@ -0,0 +1,139 @@
+package market
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nofx/indicators"
+)
+
+// CorrelationMatrix represents rolling return correlations between symbols
+type CorrelationMatrix struct {
+	Pairs     []string    `json:"pairs"`
+	Interval  string      `json:"interval"`
+	Window    int         `json:"window"`
+	Values    [][]float64 `json:"values"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// Get returns the correlation between two pairs of the matrix
+func (m *CorrelationMatrix) Get(a, b string) float64 {
+	i, j := indexOf(m.Pairs, a), indexOf(m.Pairs, b)
+	if i < 0 || j < 0 {
+		return 0
+	}
+	return m.Values[i][j]
+}
+
+// Buckets groups pairs whose correlation is at least threshold, directly or
+// through a chain of correlated pairs
+func (m *CorrelationMatrix) Buckets(threshold float64) [][]string {
+	parent := make([]int, len(m.Pairs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range m.Pairs {
+		for j := i + 1; j < len(m.Pairs); j++ {
+			if m.Values[i][j] >= threshold {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	groups := make(map[int][]string)
+	for i, pair := range m.Pairs {
+		root := find(i)
+		groups[root] = append(groups[root], pair)
+	}
+
+	buckets := make([][]string, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group)
+		buckets = append(buckets, group)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i][0] < buckets[j][0] })
+	return buckets
+}
+
+// CorrelationService computes rolling correlation matrices from the candle store
+type CorrelationService struct {
+	store *CandleStore
+}
+
+// NewCorrelationService creates a new correlation service
+func NewCorrelationService(store *CandleStore) *CorrelationService {
+	return &CorrelationService{store: store}
+}
+
+// Matrix computes the correlation of close-to-close returns over the last
+// window candles, using only timestamps present for both pairs
+func (s *CorrelationService) Matrix(pairs []string, interval string, window int) (*CorrelationMatrix, error) {
+	closes := make([]map[int64]float64, len(pairs))
+	for i, pair := range pairs {
+		candles, err := s.store.Get(pair, interval, window+1)
+		if err != nil {
+			return nil, err
+		}
+		closes[i] = make(map[int64]float64, len(candles))
+		for _, c := range candles {
+			closes[i][c.Timestamp] = c.Close
+		}
+	}
+
+	values := make([][]float64, len(pairs))
+	for i := range pairs {
+		values[i] = make([]float64, len(pairs))
+		values[i][i] = 1
+	}
+	for i := range pairs {
+		for j := i + 1; j < len(pairs); j++ {
+			a, b := alignedCloses(closes[i], closes[j])
+			corr := indicators.Correlation(indicators.Returns(a), indicators.Returns(b))
+			values[i][j], values[j][i] = corr, corr
+		}
+	}
+
+	return &CorrelationMatrix{
+		Pairs:     pairs,
+		Interval:  interval,
+		Window:    window,
+		Values:    values,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// alignedCloses returns the closes of two series at their common timestamps
+func alignedCloses(a, b map[int64]float64) ([]float64, []float64) {
+	var timestamps []int64
+	for ts := range a {
+		if _, ok := b[ts]; ok {
+			timestamps = append(timestamps, ts)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	x := make([]float64, len(timestamps))
+	y := make([]float64, len(timestamps))
+	for i, ts := range timestamps {
+		x[i], y[i] = a[ts], b[ts]
+	}
+	return x, y
+}
+
+// indexOf returns the index of s in values, or -1
+func indexOf(values []string, s string) int {
+	for i, v := range values {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
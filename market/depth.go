@@ -0,0 +1,93 @@
+package market
+
+import (
+	"context"
+	"math"
+)
+
+// DefaultDepthLimit is the number of book levels fetched for depth calculations
+const DefaultDepthLimit = 100
+
+// MaxOrderSize returns the largest quantity that can be executed against the
+// book without the fill price moving more than maxImpactBps away from the
+// best price. Buys consume asks and sells consume bids.
+func (b *OrderBook) MaxOrderSize(buy bool, maxImpactBps float64) float64 {
+	levels := b.Bids
+	if buy {
+		levels = b.Asks
+	}
+	if len(levels) == 0 || len(levels[0]) < 2 {
+		return 0
+	}
+
+	best := levels[0][0]
+	limit := best * (1 - maxImpactBps/10000)
+	if buy {
+		limit = best * (1 + maxImpactBps/10000)
+	}
+
+	var size float64
+	for _, level := range levels {
+		if len(level) < 2 {
+			continue
+		}
+		price, amount := level[0], level[1]
+		if (buy && price > limit) || (!buy && price < limit) {
+			break
+		}
+		size += amount
+	}
+
+	return size
+}
+
+// ImpactBps returns the price impact in basis points of executing size
+// against the book, or +Inf if the book is too thin to absorb it
+func (b *OrderBook) ImpactBps(buy bool, size float64) float64 {
+	levels := b.Bids
+	if buy {
+		levels = b.Asks
+	}
+	if len(levels) == 0 || len(levels[0]) < 2 {
+		return math.Inf(1)
+	}
+
+	best := levels[0][0]
+	remaining := size
+	for _, level := range levels {
+		if len(level) < 2 {
+			continue
+		}
+		remaining -= level[1]
+		if remaining <= 0 {
+			return math.Abs(level[0]-best) / best * 10000
+		}
+	}
+
+	return math.Inf(1)
+}
+
+// DepthCalculator computes order size limits from live order books
+type DepthCalculator struct {
+	client *APIClient
+	limit  int
+}
+
+// NewDepthCalculator creates a new depth calculator
+func NewDepthCalculator(client *APIClient) *DepthCalculator {
+	return &DepthCalculator{
+		client: client,
+		limit:  DefaultDepthLimit,
+	}
+}
+
+// MaxOrderSize returns the largest quantity the current book for a pair can
+// absorb within maxImpactBps
+func (d *DepthCalculator) MaxOrderSize(ctx context.Context, pair string, buy bool, maxImpactBps float64) (float64, error) {
+	book, err := d.client.GetOrderBook(ctx, pair, d.limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return book.MaxOrderSize(buy, maxImpactBps), nil
+}
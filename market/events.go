@@ -0,0 +1,51 @@
+package market
+
+import "sync"
+
+// eventBufferSize is the channel capacity of each subscriber
+const eventBufferSize = 256
+
+// EventBus fans market events out to subscribers; slow subscribers drop
+// events rather than blocking publishers
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[chan MarketEvent]struct{}
+}
+
+// NewEventBus creates a new event bus
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[chan MarketEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving every published event
+func (b *EventBus) Subscribe() chan MarketEvent {
+	ch := make(chan MarketEvent, eventBufferSize)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe stops delivering events to a channel and closes it
+func (b *EventBus) Unsubscribe(ch chan MarketEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish delivers an event to all subscribers without blocking
+func (b *EventBus) Publish(event MarketEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nofx/indicators"
+)
+
+// fundingPageSize is the number of funding rates requested per page
+const fundingPageSize = 1000
+
+// defaultFundingPeriod is the settlement period in seconds assumed until a
+// contract's history shows its own
+const defaultFundingPeriod = 8 * 3600
+
+// FundingStats summarizes the settled funding rates of a contract over a
+// period; Annualized is the mean rate times the settlements in a year
+type FundingStats struct {
+	Pair          string  `json:"currency_pair"`
+	From          int64   `json:"from"`
+	To            int64   `json:"to"`
+	Count         int     `json:"count"`
+	Mean          float64 `json:"mean"`
+	StdDev        float64 `json:"std_dev"`
+	Min           float64 `json:"min"`
+	Max           float64 `json:"max"`
+	P5            float64 `json:"p5"`
+	P25           float64 `json:"p25"`
+	Median        float64 `json:"median"`
+	P75           float64 `json:"p75"`
+	P95           float64 `json:"p95"`
+	PositiveShare float64 `json:"positive_share"`
+	Annualized    float64 `json:"annualized"`
+}
+
+// FundingHistory downloads and stores the settled funding rates of perpetual
+// contracts, cached on disk as one CSV file per contract so every range is
+// downloaded once
+type FundingHistory struct {
+	client *APIClient
+	dir    string
+
+	mu       sync.Mutex
+	rates    map[string][]FundingRate
+	earliest map[string]int64
+}
+
+// NewFundingHistory creates a new funding rate store caching into dir; an
+// empty dir keeps the rates in memory only
+func NewFundingHistory(client *APIClient, dir string) *FundingHistory {
+	return &FundingHistory{
+		client:   client,
+		dir:      dir,
+		rates:    make(map[string][]FundingRate),
+		earliest: make(map[string]int64),
+	}
+}
+
+// Rates returns the funding rates of a contract settled with from <= time < to,
+// downloading the parts of the range not stored yet
+func (h *FundingHistory) Rates(pair string, from, to time.Time) ([]FundingRate, error) {
+	start, end := from.Unix(), to.Unix()
+	if now := time.Now().Unix(); end > now {
+		end = now
+	}
+	if start >= end {
+		return []FundingRate{}, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rates, err := h.series(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	var fetched []FundingRate
+	if len(rates) == 0 {
+		if fetched, err = h.fetch(pair, start, end); err != nil {
+			return nil, err
+		}
+	} else {
+		period := fundingPeriod(rates)
+		// Before the first stored rate; contracts listed later have none
+		if earliest, ok := h.earliest[pair]; start < rates[0].Time-period && (!ok || start < earliest) {
+			older, err := h.fetch(pair, start, rates[0].Time)
+			if err != nil {
+				return nil, err
+			}
+			fetched = append(fetched, older...)
+		}
+		if last := rates[len(rates)-1].Time; end > last+period {
+			newer, err := h.fetch(pair, last+1, end)
+			if err != nil {
+				return nil, err
+			}
+			fetched = append(fetched, newer...)
+		}
+	}
+	if earliest, ok := h.earliest[pair]; !ok || start < earliest {
+		h.earliest[pair] = start
+	}
+
+	if len(fetched) > 0 {
+		rates = mergeFunding(rates, fetched)
+		h.rates[pair] = rates
+		if err := h.save(pair, rates); err != nil {
+			return nil, err
+		}
+	}
+
+	first := sort.Search(len(rates), func(i int) bool { return rates[i].Time >= start })
+	last := sort.Search(len(rates), func(i int) bool { return rates[i].Time >= end })
+	return append([]FundingRate{}, rates[first:last]...), nil
+}
+
+// Stats returns the distribution of the funding rates of a contract settled
+// with from <= time < to
+func (h *FundingHistory) Stats(pair string, from, to time.Time) (*FundingStats, error) {
+	rates, err := h.Rates(pair, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &FundingStats{Pair: pair, From: from.Unix(), To: to.Unix(), Count: len(rates)}
+	if len(rates) == 0 {
+		return stats, nil
+	}
+	values := make([]float64, len(rates))
+	positive := 0
+	for i, r := range rates {
+		values[i] = r.Rate
+		if r.Rate > 0 {
+			positive++
+		}
+	}
+	stats.Mean = indicators.Mean(values)
+	stats.StdDev = indicators.StdDev(values)
+	stats.Min = indicators.Percentile(values, 0)
+	stats.Max = indicators.Percentile(values, 100)
+	stats.P5 = indicators.Percentile(values, 5)
+	stats.P25 = indicators.Percentile(values, 25)
+	stats.Median = indicators.Percentile(values, 50)
+	stats.P75 = indicators.Percentile(values, 75)
+	stats.P95 = indicators.Percentile(values, 95)
+	stats.PositiveShare = float64(positive) / float64(len(rates))
+	stats.Annualized = stats.Mean * 365 * 86400 / float64(fundingPeriod(rates))
+	return stats, nil
+}
+
+// fetch downloads the funding rates settled with from <= time < to. The
+// exchange returns the newest rates first, so full pages continue backwards.
+func (h *FundingHistory) fetch(pair string, from, to int64) ([]FundingRate, error) {
+	var rates []FundingRate
+	for to > from {
+		batch, err := h.client.GetFundingHistoryRange(context.Background(), pair, from, to-1, fundingPageSize)
+		if err != nil {
+			return nil, err
+		}
+		oldest := to
+		for _, r := range batch {
+			r.Pair = pair
+			if r.Time >= from && r.Time < to {
+				rates = append(rates, r)
+			}
+			if r.Time < oldest {
+				oldest = r.Time
+			}
+		}
+		if len(batch) < fundingPageSize || oldest >= to {
+			break
+		}
+		to = oldest
+	}
+	return rates, nil
+}
+
+// series returns the stored rates of a contract, loading them from disk on
+// first use; the caller must hold mu
+func (h *FundingHistory) series(pair string) ([]FundingRate, error) {
+	if rates, ok := h.rates[pair]; ok || h.dir == "" {
+		return rates, nil
+	}
+
+	path := h.path(pair)
+	records, err := readCSV(path)
+	if err != nil {
+		return nil, err
+	}
+	rates := make([]FundingRate, 0, len(records))
+	for i, r := range records {
+		rate := FundingRate{Pair: pair}
+		if rate.Time, err = strconv.ParseInt(r[0], 10, 64); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, i+2, err)
+		}
+		if rate.Rate, err = strconv.ParseFloat(r[1], 64); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, i+2, err)
+		}
+		rates = append(rates, rate)
+	}
+	rates = mergeFunding(nil, rates)
+	h.rates[pair] = rates
+	return rates, nil
+}
+
+// path returns the cache file of a contract
+func (h *FundingHistory) path(pair string) string {
+	return filepath.Join(h.dir, pair+"_funding.csv")
+}
+
+// save replaces the cache file of a contract
+func (h *FundingHistory) save(pair string, rates []FundingRate) error {
+	if h.dir == "" {
+		return nil
+	}
+	rows := make([][]string, len(rates))
+	for i, r := range rates {
+		rows[i] = []string{strconv.FormatInt(r.Time, 10), formatFloat(r.Rate)}
+	}
+	return writeCSV(h.path(pair), []string{"funding_time", "rate"}, rows)
+}
+
+// mergeFunding merges rates into a sorted series deduplicated by time, later
+// rates replacing earlier ones
+func mergeFunding(series, rates []FundingRate) []FundingRate {
+	byTime := make(map[int64]FundingRate, len(series)+len(rates))
+	for _, r := range series {
+		byTime[r.Time] = r
+	}
+	for _, r := range rates {
+		byTime[r.Time] = r
+	}
+
+	merged := make([]FundingRate, 0, len(byTime))
+	for _, r := range byTime {
+		merged = append(merged, r)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Time < merged[j].Time })
+	return merged
+}
+
+// fundingPeriod returns the most recent settlement period of a sorted series in seconds
+func fundingPeriod(rates []FundingRate) int64 {
+	if n := len(rates); n >= 2 && rates[n-1].Time > rates[n-2].Time {
+		return rates[n-1].Time - rates[n-2].Time
+	}
+	return defaultFundingPeriod
+}
@@ -0,0 +1,224 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// ContractLister lists the contracts a venue trades with their metadata
+type ContractLister interface {
+	ListContracts(ctx context.Context) ([]ContractInfo, error)
+}
+
+// FundingReader provides the current funding rate of a contract, for venues
+// whose contract listing doesn't carry it
+type FundingReader interface {
+	GetFundingRate(ctx context.Context, pair string) (*FundingRate, error)
+}
+
+// Instrument represents a contract of a venue
+type Instrument struct {
+	Exchange string `json:"exchange"`
+	ContractInfo
+}
+
+// venueListing is the cached contract listing of a venue, indexed by pair
+type venueListing struct {
+	source    ContractLister
+	contracts []ContractInfo
+	byPair    map[string]int
+	fetched   time.Time
+}
+
+// InstrumentIndex searches the contracts of every venue. Listings are
+// cached for ttl; a venue failing to list its contracts is searched in its
+// last listing, if any.
+type InstrumentIndex struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	venues map[string]*venueListing
+}
+
+// NewInstrumentIndex creates a new instrument index caching listings for ttl
+func NewInstrumentIndex(ttl time.Duration) *InstrumentIndex {
+	return &InstrumentIndex{ttl: ttl, venues: make(map[string]*venueListing)}
+}
+
+// Add registers the contract listing of a venue
+func (x *InstrumentIndex) Add(exchange string, source ContractLister) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.venues[exchange] = &venueListing{source: source}
+}
+
+// listing returns the contracts of a venue, listing them again once the
+// cached listing expired
+func (x *InstrumentIndex) listing(ctx context.Context, exchange string) ([]ContractInfo, error) {
+	x.mu.Lock()
+	venue := x.venues[exchange]
+	contracts, fresh := venue.contracts, time.Since(venue.fetched) < x.ttl
+	x.mu.Unlock()
+	if fresh {
+		return contracts, nil
+	}
+
+	listed, err := venue.source.ListContracts(ctx)
+	if err != nil {
+		if contracts != nil {
+			logger.Warning("Failed to list %s contracts, searching the listing of %s: %v",
+				exchange, venue.fetched.Format(time.RFC3339), err)
+			return contracts, nil
+		}
+		return nil, err
+	}
+	byPair := make(map[string]int, len(listed))
+	for i, c := range listed {
+		byPair[c.Pair] = i
+	}
+	x.mu.Lock()
+	venue.contracts, venue.byPair, venue.fetched = listed, byPair, time.Now()
+	x.mu.Unlock()
+	return listed, nil
+}
+
+// Contract returns the metadata of a contract of a venue from its cached
+// listing, so every venue rounds and values its orders with its own tick
+// sizes, quantity steps and contract sizes
+func (x *InstrumentIndex) Contract(exchange, pair string) (*ContractInfo, error) {
+	x.mu.Lock()
+	_, ok := x.venues[exchange]
+	x.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("exchange %q has no contract listing", exchange)
+	}
+	if _, err := x.listing(context.Background(), exchange); err != nil {
+		return nil, err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	venue := x.venues[exchange]
+	i, ok := venue.byPair[pair]
+	if !ok {
+		return nil, fmt.Errorf("%s contract %s: %w", exchange, pair, ErrNotFound)
+	}
+	contract := venue.contracts[i]
+	return &contract, nil
+}
+
+// VenueContracts provides the contract metadata of one venue
+type VenueContracts struct {
+	index    *InstrumentIndex
+	exchange string
+}
+
+// Venue returns the contract metadata source of a venue
+func (x *InstrumentIndex) Venue(exchange string) *VenueContracts {
+	return &VenueContracts{index: x, exchange: exchange}
+}
+
+// Get returns the metadata of a contract of the venue
+func (v *VenueContracts) Get(pair string) (*ContractInfo, error) {
+	return v.index.Contract(v.exchange, pair)
+}
+
+// normalizeSymbol strips separators and case, so "pepe-usdt", "PEPEUSDT"
+// and "PEPE_USDT" compare equal
+func normalizeSymbol(s string) string {
+	return strings.ToUpper(strings.NewReplacer("_", "", "-", "", "/", "", " ", "").Replace(s))
+}
+
+// matchRank ranks how well a pair matches a normalized query: 0 for the
+// base asset, 1 for a prefix, 2 for a substring, -1 for no match
+func matchRank(pair, query string) int {
+	base := pair
+	if i := strings.Index(pair, "_"); i > 0 {
+		base = pair[:i]
+	}
+	symbol := normalizeSymbol(pair)
+	switch {
+	case normalizeSymbol(base) == query || symbol == query:
+		return 0
+	case strings.HasPrefix(symbol, query):
+		return 1
+	case strings.Contains(symbol, query):
+		return 2
+	}
+	return -1
+}
+
+// Search returns up to limit contracts matching query across venues, best
+// matches first, and the error of every venue that couldn't be searched.
+// Matches without a funding rate get it from their venue when it's a
+// FundingReader.
+func (x *InstrumentIndex) Search(ctx context.Context, query string, limit int) ([]Instrument, map[string]error) {
+	x.mu.Lock()
+	exchanges := make([]string, 0, len(x.venues))
+	for exchange := range x.venues {
+		exchanges = append(exchanges, exchange)
+	}
+	x.mu.Unlock()
+	sort.Strings(exchanges)
+
+	query = normalizeSymbol(query)
+	type match struct {
+		Instrument
+		rank int
+	}
+	var matches []match
+	failed := make(map[string]error)
+	for _, exchange := range exchanges {
+		contracts, err := x.listing(ctx, exchange)
+		if err != nil {
+			failed[exchange] = err
+			continue
+		}
+		for _, c := range contracts {
+			if rank := matchRank(c.Pair, query); rank >= 0 {
+				matches = append(matches, match{Instrument{Exchange: exchange, ContractInfo: c}, rank})
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].Pair < matches[j].Pair
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	instruments := make([]Instrument, 0, len(matches))
+	for _, m := range matches {
+		if m.FundingRate == 0 && m.NextFundingTime == 0 {
+			x.fillFunding(ctx, &m.Instrument)
+		}
+		instruments = append(instruments, m.Instrument)
+	}
+	return instruments, failed
+}
+
+// fillFunding sets the funding rate of an instrument from its venue
+func (x *InstrumentIndex) fillFunding(ctx context.Context, instrument *Instrument) {
+	x.mu.Lock()
+	reader, ok := x.venues[instrument.Exchange].source.(FundingReader)
+	x.mu.Unlock()
+	if !ok {
+		return
+	}
+	rate, err := reader.GetFundingRate(ctx, instrument.Pair)
+	if err != nil {
+		logger.Debug("Failed to get the %s funding rate of %s: %v", instrument.Exchange, instrument.Pair, err)
+		return
+	}
+	instrument.FundingRate, instrument.NextFundingTime = rate.Rate, rate.Time
+}
@@ -0,0 +1,194 @@
+package market
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// defaultProfileBins is the number of price buckets in a volume profile
+const defaultProfileBins = 24
+
+// PivotLevels represents classic floor-trader pivot levels
+type PivotLevels struct {
+	P  float64 `json:"p"`
+	R1 float64 `json:"r1"`
+	R2 float64 `json:"r2"`
+	R3 float64 `json:"r3"`
+	S1 float64 `json:"s1"`
+	S2 float64 `json:"s2"`
+	S3 float64 `json:"s3"`
+}
+
+// VolumeNode represents the volume traded around a price level
+type VolumeNode struct {
+	Price  float64 `json:"price"`
+	Volume float64 `json:"volume"`
+}
+
+// Levels represents the support and resistance levels of a symbol
+type Levels struct {
+	Pair           string       `json:"currency_pair"`
+	Pivots         PivotLevels  `json:"pivots"`
+	PrevDayHigh    float64      `json:"prev_day_high"`
+	PrevDayLow     float64      `json:"prev_day_low"`
+	PrevWeekHigh   float64      `json:"prev_week_high"`
+	PrevWeekLow    float64      `json:"prev_week_low"`
+	PointOfControl float64      `json:"point_of_control"`
+	VolumeNodes    []VolumeNode `json:"volume_nodes"`
+}
+
+// ClassicPivots computes pivot levels from the previous period's high, low and close
+func ClassicPivots(high, low, close float64) PivotLevels {
+	p := (high + low + close) / 3
+	return PivotLevels{
+		P:  p,
+		R1: 2*p - low,
+		R2: p + (high - low),
+		R3: high + 2*(p-low),
+		S1: 2*p - high,
+		S2: p - (high - low),
+		S3: low - 2*(high-p),
+	}
+}
+
+// VolumeProfile distributes candle volume over price buckets by typical
+// price and returns the buckets sorted by price
+func VolumeProfile(candles []CandleData, bins int) []VolumeNode {
+	if len(candles) == 0 || bins <= 0 {
+		return nil
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, c := range candles {
+		low, high = math.Min(low, c.Low), math.Max(high, c.High)
+	}
+	if high <= low {
+		return []VolumeNode{{Price: low, Volume: totalVolume(candles)}}
+	}
+
+	width := (high - low) / float64(bins)
+	nodes := make([]VolumeNode, bins)
+	for i := range nodes {
+		nodes[i].Price = low + (float64(i)+0.5)*width
+	}
+	for _, c := range candles {
+		typical := (c.High + c.Low + c.Close) / 3
+		i := int((typical - low) / width)
+		if i >= bins {
+			i = bins - 1
+		}
+		nodes[i].Volume += c.Volume
+	}
+	return nodes
+}
+
+// ComputeLevels derives pivots and prior day/week extremes from daily candles
+// and a volume profile from intraday candles; both series must be sorted and
+// the last daily candle is treated as the current, unfinished day
+func ComputeLevels(pair string, daily, intraday []CandleData) Levels {
+	levels := Levels{Pair: pair}
+
+	if len(daily) >= 2 {
+		prev := daily[len(daily)-2]
+		levels.Pivots = ClassicPivots(prev.High, prev.Low, prev.Close)
+		levels.PrevDayHigh, levels.PrevDayLow = prev.High, prev.Low
+
+		currentYear, currentWeek := time.Unix(daily[len(daily)-1].Timestamp, 0).UTC().ISOWeek()
+		prevWeekYear, prevWeek := time.Unix(daily[len(daily)-1].Timestamp, 0).UTC().AddDate(0, 0, -7).ISOWeek()
+		levels.PrevWeekLow = math.Inf(1)
+		for _, c := range daily {
+			year, week := time.Unix(c.Timestamp, 0).UTC().ISOWeek()
+			if year == prevWeekYear && week == prevWeek && !(year == currentYear && week == currentWeek) {
+				levels.PrevWeekHigh = math.Max(levels.PrevWeekHigh, c.High)
+				levels.PrevWeekLow = math.Min(levels.PrevWeekLow, c.Low)
+			}
+		}
+		if math.IsInf(levels.PrevWeekLow, 1) {
+			levels.PrevWeekLow = 0
+		}
+	}
+
+	levels.VolumeNodes = VolumeProfile(intraday, defaultProfileBins)
+	var maxVolume float64
+	for _, n := range levels.VolumeNodes {
+		if n.Volume > maxVolume {
+			maxVolume, levels.PointOfControl = n.Volume, n.Price
+		}
+	}
+
+	return levels
+}
+
+// all returns every non-zero level price, sorted ascending
+func (l Levels) all() []float64 {
+	candidates := []float64{
+		l.Pivots.P, l.Pivots.R1, l.Pivots.R2, l.Pivots.R3, l.Pivots.S1, l.Pivots.S2, l.Pivots.S3,
+		l.PrevDayHigh, l.PrevDayLow, l.PrevWeekHigh, l.PrevWeekLow, l.PointOfControl,
+	}
+	var prices []float64
+	for _, p := range candidates {
+		if p > 0 {
+			prices = append(prices, p)
+		}
+	}
+	sort.Float64s(prices)
+	return prices
+}
+
+// NearestSupport returns the highest level below price, or 0 when there is none;
+// strategies use it as a stop anchor for longs and a target for shorts
+func (l Levels) NearestSupport(price float64) float64 {
+	var support float64
+	for _, p := range l.all() {
+		if p < price {
+			support = p
+		}
+	}
+	return support
+}
+
+// NearestResistance returns the lowest level above price, or 0 when there is none
+func (l Levels) NearestResistance(price float64) float64 {
+	for _, p := range l.all() {
+		if p > price {
+			return p
+		}
+	}
+	return 0
+}
+
+// totalVolume sums the volume of a candle series
+func totalVolume(candles []CandleData) float64 {
+	var v float64
+	for _, c := range candles {
+		v += c.Volume
+	}
+	return v
+}
+
+// LevelService computes support and resistance levels from the candle store
+type LevelService struct {
+	store *CandleStore
+}
+
+// NewLevelService creates a new level service
+func NewLevelService(store *CandleStore) *LevelService {
+	return &LevelService{store: store}
+}
+
+// Levels computes the current levels of a pair from 30 daily candles and a
+// one-week hourly volume profile
+func (s *LevelService) Levels(pair string) (*Levels, error) {
+	daily, err := s.store.Get(pair, "1d", 30)
+	if err != nil {
+		return nil, err
+	}
+	hourly, err := s.store.Get(pair, "1h", 168)
+	if err != nil {
+		return nil, err
+	}
+
+	levels := ComputeLevels(pair, daily, hourly)
+	return &levels, nil
+}
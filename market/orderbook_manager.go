@@ -0,0 +1,264 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// ErrBookDesync is returned when an incremental update doesn't continue the
+// local book's sequence and the book must be resynchronized
+var ErrBookDesync = errors.New("order book out of sync")
+
+// maxPendingUpdates bounds the updates buffered while waiting for a snapshot
+const maxPendingUpdates = 1000
+
+// BookUpdate represents an incremental L2 update; a zero size removes the level
+type BookUpdate struct {
+	Pair          string
+	FirstUpdateID int64
+	LastUpdateID  int64
+	Bids          [][2]float64
+	Asks          [][2]float64
+}
+
+// localBook represents the locally maintained L2 book of a symbol
+type localBook struct {
+	bids    map[float64]float64
+	asks    map[float64]float64
+	lastID  int64
+	synced  bool
+	pending []BookUpdate
+	updated time.Time
+}
+
+// OrderBookManager maintains locally synchronized L2 order books from a REST
+// snapshot plus incremental stream updates, detecting sequence gaps
+type OrderBookManager struct {
+	client *APIClient
+
+	// OnDesync is called when a gap is detected; the stream resubscribes the pair
+	OnDesync func(pair string)
+
+	mu    sync.RWMutex
+	books map[string]*localBook
+}
+
+// NewOrderBookManager creates a new order book manager
+func NewOrderBookManager(client *APIClient) *OrderBookManager {
+	return &OrderBookManager{
+		client: client,
+		books:  make(map[string]*localBook),
+	}
+}
+
+// book returns the local book of a pair, creating it unsynchronized; callers hold mu
+func (m *OrderBookManager) book(pair string) *localBook {
+	b, ok := m.books[pair]
+	if !ok {
+		b = &localBook{bids: make(map[float64]float64), asks: make(map[float64]float64)}
+		m.books[pair] = b
+	}
+	return b
+}
+
+// Resync fetches a fresh REST snapshot for a pair and replays buffered updates
+func (m *OrderBookManager) Resync(pair string) error {
+	m.mu.Lock()
+	m.book(pair).synced = false
+	m.mu.Unlock()
+
+	snapshot, err := m.client.GetOrderBook(context.Background(), pair, DefaultDepthLimit)
+	if err != nil {
+		return err
+	}
+	return m.ApplySnapshot(pair, snapshot)
+}
+
+// ApplySnapshot replaces the local book of a pair and replays the buffered
+// updates that continue the snapshot's sequence
+func (m *OrderBookManager) ApplySnapshot(pair string, snapshot *OrderBook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := m.book(pair)
+	b.bids = make(map[float64]float64, len(snapshot.Bids))
+	b.asks = make(map[float64]float64, len(snapshot.Asks))
+	for _, level := range snapshot.Bids {
+		if len(level) >= 2 {
+			b.bids[level[0]] = level[1]
+		}
+	}
+	for _, level := range snapshot.Asks {
+		if len(level) >= 2 {
+			b.asks[level[0]] = level[1]
+		}
+	}
+	b.lastID = snapshot.ID
+	b.synced = true
+	b.updated = time.Now()
+
+	pending := b.pending
+	b.pending = nil
+	for _, u := range pending {
+		if u.LastUpdateID <= b.lastID {
+			continue
+		}
+		if err := m.apply(b, u); err != nil {
+			b.synced = false
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyUpdate applies an incremental update, buffering it while the book
+// awaits a snapshot; a sequence gap marks the book unsynchronized, calls
+// OnDesync and returns ErrBookDesync
+func (m *OrderBookManager) ApplyUpdate(u BookUpdate) error {
+	m.mu.Lock()
+	b := m.book(u.Pair)
+	if !b.synced {
+		if len(b.pending) < maxPendingUpdates {
+			b.pending = append(b.pending, u)
+		}
+		m.mu.Unlock()
+		return nil
+	}
+
+	err := m.apply(b, u)
+	if err != nil {
+		b.synced = false
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		logger.Warning("Order book for %s desynchronized: %v", u.Pair, err)
+		if m.OnDesync != nil {
+			m.OnDesync(u.Pair)
+		}
+	}
+	return err
+}
+
+// apply applies an update to a synchronized book; callers hold mu
+func (m *OrderBookManager) apply(b *localBook, u BookUpdate) error {
+	if u.LastUpdateID <= b.lastID {
+		return nil
+	}
+	if b.lastID != 0 && u.FirstUpdateID > b.lastID+1 {
+		return fmt.Errorf("%w: expected update %d, got %d-%d", ErrBookDesync, b.lastID+1, u.FirstUpdateID, u.LastUpdateID)
+	}
+
+	for _, level := range u.Bids {
+		setLevel(b.bids, level)
+	}
+	for _, level := range u.Asks {
+		setLevel(b.asks, level)
+	}
+	b.lastID = u.LastUpdateID
+	b.updated = time.Now()
+
+	if bid, _, ok := bestLevel(b.bids, true); ok {
+		if ask, _, ok := bestLevel(b.asks, false); ok && bid >= ask {
+			return fmt.Errorf("%w: crossed book (bid %v >= ask %v)", ErrBookDesync, bid, ask)
+		}
+	}
+	return nil
+}
+
+// setLevel sets or removes a price level
+func setLevel(side map[float64]float64, level [2]float64) {
+	if level[1] == 0 {
+		delete(side, level[0])
+		return
+	}
+	side[level[0]] = level[1]
+}
+
+// bestLevel returns the best price of a book side
+func bestLevel(side map[float64]float64, highest bool) (float64, float64, bool) {
+	var price float64
+	found := false
+	for p := range side {
+		if !found || (highest && p > price) || (!highest && p < price) {
+			price, found = p, true
+		}
+	}
+	return price, side[price], found
+}
+
+// Synced reports whether the local book of a pair is synchronized
+func (m *OrderBookManager) Synced(pair string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.books[pair]
+	return ok && b.synced
+}
+
+// BestBid returns the best bid price and size of a synchronized book
+func (m *OrderBookManager) BestBid(pair string) (float64, float64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.books[pair]
+	if !ok || !b.synced {
+		return 0, 0, false
+	}
+	return bestLevel(b.bids, true)
+}
+
+// BestAsk returns the best ask price and size of a synchronized book
+func (m *OrderBookManager) BestAsk(pair string) (float64, float64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.books[pair]
+	if !ok || !b.synced {
+		return 0, 0, false
+	}
+	return bestLevel(b.asks, false)
+}
+
+// Depth returns the top levels of a synchronized book, bids descending and asks ascending
+func (m *OrderBookManager) Depth(pair string, levels int) (*OrderBook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	b, ok := m.books[pair]
+	if !ok || !b.synced {
+		return nil, fmt.Errorf("%s: %w", pair, ErrBookDesync)
+	}
+
+	return &OrderBook{
+		ID:        b.lastID,
+		Bids:      sortedLevels(b.bids, true, levels),
+		Asks:      sortedLevels(b.asks, false, levels),
+		Timestamp: b.updated.Unix(),
+	}, nil
+}
+
+// sortedLevels returns up to limit levels of a book side sorted from best to worst
+func sortedLevels(side map[float64]float64, descending bool, limit int) [][]float64 {
+	prices := make([]float64, 0, len(side))
+	for p := range side {
+		prices = append(prices, p)
+	}
+	if descending {
+		sort.Sort(sort.Reverse(sort.Float64Slice(prices)))
+	} else {
+		sort.Float64s(prices)
+	}
+	if limit > 0 && len(prices) > limit {
+		prices = prices[:limit]
+	}
+
+	levels := make([][]float64, len(prices))
+	for i, p := range prices {
+		levels[i] = []float64{p, side[p]}
+	}
+	return levels
+}
@@ -0,0 +1,282 @@
+package market
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+const (
+	orderBookChannel    = "futures.order_book_update"
+	orderBookFrequency  = "100ms"
+	orderBookStreamSize = "100"
+)
+
+// wsRequest represents a websocket subscription request
+type wsRequest struct {
+	Time    int64    `json:"time"`
+	Channel string   `json:"channel"`
+	Event   string   `json:"event"`
+	Payload []string `json:"payload"`
+}
+
+// wsMessage represents a websocket push message
+type wsMessage struct {
+	Channel string          `json:"channel"`
+	Event   string          `json:"event"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// wsLevel represents a price level of a book update
+type wsLevel struct {
+	Price string  `json:"p"`
+	Size  float64 `json:"s"`
+}
+
+// wsBookUpdate represents the result of an order book update message
+type wsBookUpdate struct {
+	Contract string    `json:"s"`
+	First    int64     `json:"U"`
+	Last     int64     `json:"u"`
+	Bids     []wsLevel `json:"b"`
+	Asks     []wsLevel `json:"a"`
+}
+
+// OrderBookStream subscribes to incremental order book updates over websocket
+// and feeds them into an OrderBookManager, resynchronizing from REST when a
+// gap is detected and reconnecting with backoff when the connection drops.
+// Subscriptions are replayed on every reconnect, and books going silent are
+// resubscribed.
+type OrderBookStream struct {
+	url    string
+	opts   WSOptions
+	subs   *subscriptionSet
+	health *streamHealth
+	books  *OrderBookManager
+
+	mu     sync.Mutex
+	conn   *wsConn
+	resync chan string
+	stop   chan struct{}
+}
+
+// NewOrderBookStream creates a new order book stream for the given pairs
+func NewOrderBookStream(url string, opts WSOptions, pairs []string, books *OrderBookManager) *OrderBookStream {
+	s := &OrderBookStream{
+		url:    url,
+		opts:   opts,
+		subs:   newSubscriptionSet(pairs),
+		health: newStreamHealth(opts.Metrics, "order_book", url),
+		books:  books,
+		resync: make(chan string, len(pairs)+1),
+	}
+	books.OnDesync = s.queueResync
+	return s
+}
+
+// queueResync schedules a REST resynchronization of a pair
+func (s *OrderBookStream) queueResync(pair string) {
+	select {
+	case s.resync <- pair:
+	default:
+	}
+}
+
+// Start connects and maintains the stream in the background
+func (s *OrderBookStream) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	go s.resyncLoop(stop)
+	go reconnect("Order book", s.health, stop, s.connect)
+}
+
+// Stop closes the stream
+func (s *OrderBookStream) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Pairs returns the subscribed pairs, sorted
+func (s *OrderBookStream) Pairs() []string {
+	return s.subs.list()
+}
+
+// Subscribe adds pairs to the stream; while disconnected they are
+// subscribed on the next connection
+func (s *OrderBookStream) Subscribe(pairs ...string) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	for _, pair := range s.subs.add(pairs...) {
+		if conn == nil {
+			continue
+		}
+		if err := conn.send(orderBookRequest("subscribe", pair)); err != nil {
+			return err
+		}
+		s.queueResync(pair)
+	}
+	return nil
+}
+
+// Unsubscribe removes pairs from the stream
+func (s *OrderBookStream) Unsubscribe(pairs ...string) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	for _, pair := range s.subs.remove(pairs...) {
+		if conn == nil {
+			continue
+		}
+		if err := conn.send(orderBookRequest("unsubscribe", pair)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release forgets a connection once it ended
+func (s *OrderBookStream) release(conn *wsConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == conn {
+		s.conn = nil
+	}
+}
+
+// orderBookRequest returns an order book subscription request for a pair
+func orderBookRequest(event, pair string) wsRequest {
+	return wsRequest{
+		Time:    time.Now().Unix(),
+		Channel: orderBookChannel,
+		Event:   event,
+		Payload: []string{pair, orderBookFrequency, orderBookStreamSize},
+	}
+}
+
+// connect subscribes to every pair, resynchronizes the books and reads
+// updates until the connection fails or the stream is stopped
+func (s *OrderBookStream) connect(stop chan struct{}) error {
+	raw, err := s.opts.dial(s.url)
+	if err != nil {
+		return err
+	}
+	conn := &wsConn{Conn: raw}
+	defer conn.Close()
+
+	s.mu.Lock()
+	select {
+	case <-stop:
+		s.mu.Unlock()
+		return nil
+	default:
+	}
+	s.conn = conn
+	s.mu.Unlock()
+	defer s.release(conn)
+
+	pairs := s.subs.list()
+	for _, pair := range pairs {
+		if err := conn.send(orderBookRequest("subscribe", pair)); err != nil {
+			return err
+		}
+	}
+	s.subs.reset(time.Now())
+	s.health.connected(true)
+	logger.Info("Order book stream connected for %d pairs", len(pairs))
+
+	// Updates received before the snapshot are buffered by the manager
+	for _, pair := range pairs {
+		s.queueResync(pair)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.opts.watchStale("Order book", conn, s.subs, s.health, func(pair string) error {
+		if err := conn.send(orderBookRequest("unsubscribe", pair)); err != nil {
+			return err
+		}
+		if err := conn.send(orderBookRequest("subscribe", pair)); err != nil {
+			return err
+		}
+		s.queueResync(pair)
+		return nil
+	}, done)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		s.opts.extendDeadline(conn.Conn)
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logger.Warning("Failed to decode order book message: %v", err)
+			continue
+		}
+		if msg.Channel != orderBookChannel || msg.Event != "update" {
+			continue
+		}
+
+		var update wsBookUpdate
+		if err := json.Unmarshal(msg.Result, &update); err != nil {
+			logger.Warning("Failed to decode order book update: %v", err)
+			continue
+		}
+		s.subs.touch(update.Contract, time.Now())
+		s.books.ApplyUpdate(BookUpdate{
+			Pair:          update.Contract,
+			FirstUpdateID: update.First,
+			LastUpdateID:  update.Last,
+			Bids:          parseLevels(update.Bids),
+			Asks:          parseLevels(update.Asks),
+		})
+	}
+}
+
+// resyncLoop fetches REST snapshots for pairs that need resynchronization
+func (s *OrderBookStream) resyncLoop(stop chan struct{}) {
+	for {
+		select {
+		case pair := <-s.resync:
+			if err := s.books.Resync(pair); err != nil {
+				logger.Error("Failed to resync order book for %s: %v", pair, err)
+				time.AfterFunc(time.Second, func() { s.queueResync(pair) })
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// parseLevels converts websocket price levels to price/size pairs
+func parseLevels(levels []wsLevel) [][2]float64 {
+	parsed := make([][2]float64, 0, len(levels))
+	for _, l := range levels {
+		price, err := strconv.ParseFloat(l.Price, 64)
+		if err != nil {
+			continue
+		}
+		parsed = append(parsed, [2]float64{price, l.Size})
+	}
+	return parsed
+}
@@ -0,0 +1,252 @@
+package market
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// PatternType represents a candlestick pattern
+type PatternType string
+
+const (
+	// BullishEngulfing is a bullish body fully engulfing the previous bearish body
+	BullishEngulfing PatternType = "bullish_engulfing"
+	// BearishEngulfing is a bearish body fully engulfing the previous bullish body
+	BearishEngulfing PatternType = "bearish_engulfing"
+	// BullishPinBar is a small body with a long lower wick (hammer)
+	BullishPinBar PatternType = "bullish_pin_bar"
+	// BearishPinBar is a small body with a long upper wick (shooting star)
+	BearishPinBar PatternType = "bearish_pin_bar"
+	// InsideBar is a candle whose range lies within the previous candle's range
+	InsideBar PatternType = "inside_bar"
+	// Doji is a candle with a negligible body
+	Doji PatternType = "doji"
+	// DragonflyDoji is a doji with a long lower wick and no upper wick
+	DragonflyDoji PatternType = "dragonfly_doji"
+	// GravestoneDoji is a doji with a long upper wick and no lower wick
+	GravestoneDoji PatternType = "gravestone_doji"
+	// LongLeggedDoji is a doji with long wicks on both sides
+	LongLeggedDoji PatternType = "long_legged_doji"
+)
+
+// PatternEventType is the MarketEvent type used for detected patterns
+const PatternEventType = "pattern"
+
+// Pattern represents a candlestick pattern detected on a candle
+type Pattern struct {
+	Type      PatternType `json:"type"`
+	Direction string      `json:"direction"`
+	Pair      string      `json:"currency_pair,omitempty"`
+	Interval  string      `json:"interval,omitempty"`
+	Timestamp int64       `json:"timestamp"`
+}
+
+// Thresholds are fractions of the candle's high-low range
+const (
+	dojiBodyRatio  = 0.1
+	pinBodyRatio   = 0.3
+	pinWickRatio   = 0.6
+	smallWickRatio = 0.1
+	longWickRatio  = 0.3
+)
+
+// DetectPatterns returns every pattern found on every candle of the series
+func DetectPatterns(candles []CandleData) []Pattern {
+	var patterns []Pattern
+	for i := range candles {
+		patterns = append(patterns, detectAt(candles, i)...)
+	}
+	return patterns
+}
+
+// DetectLatest returns the patterns found on the last candle of the series
+func DetectLatest(candles []CandleData) []Pattern {
+	if len(candles) == 0 {
+		return nil
+	}
+	return detectAt(candles, len(candles)-1)
+}
+
+// detectAt detects the patterns completed by candle i
+func detectAt(candles []CandleData, i int) []Pattern {
+	c := candles[i]
+	rng := c.High - c.Low
+	if rng <= 0 {
+		return nil
+	}
+
+	body := math.Abs(c.Close - c.Open)
+	upper := c.High - math.Max(c.Open, c.Close)
+	lower := math.Min(c.Open, c.Close) - c.Low
+
+	var patterns []Pattern
+	add := func(t PatternType, direction string) {
+		patterns = append(patterns, Pattern{Type: t, Direction: direction, Timestamp: c.Timestamp})
+	}
+
+	switch {
+	case body <= dojiBodyRatio*rng:
+		switch {
+		case upper <= smallWickRatio*rng && lower >= longWickRatio*rng:
+			add(DragonflyDoji, "bullish")
+		case lower <= smallWickRatio*rng && upper >= longWickRatio*rng:
+			add(GravestoneDoji, "bearish")
+		case upper >= longWickRatio*rng && lower >= longWickRatio*rng:
+			add(LongLeggedDoji, "neutral")
+		default:
+			add(Doji, "neutral")
+		}
+	case body <= pinBodyRatio*rng && lower >= pinWickRatio*rng:
+		add(BullishPinBar, "bullish")
+	case body <= pinBodyRatio*rng && upper >= pinWickRatio*rng:
+		add(BearishPinBar, "bearish")
+	}
+
+	if i == 0 {
+		return patterns
+	}
+
+	prev := candles[i-1]
+	prevBullish, bullish := prev.Close > prev.Open, c.Close > c.Open
+	prevBearish, bearish := prev.Close < prev.Open, c.Close < c.Open
+	if prevBearish && bullish && c.Open <= prev.Close && c.Close >= prev.Open {
+		add(BullishEngulfing, "bullish")
+	}
+	if prevBullish && bearish && c.Open >= prev.Close && c.Close <= prev.Open {
+		add(BearishEngulfing, "bearish")
+	}
+	if c.High < prev.High && c.Low > prev.Low {
+		add(InsideBar, "neutral")
+	}
+
+	return patterns
+}
+
+// PatternDetector scans candle series from the store and publishes newly
+// completed patterns as market events
+type PatternDetector struct {
+	store *CandleStore
+	bus   *EventBus
+
+	mu      sync.Mutex
+	scanned map[string]int64
+	stop    chan struct{}
+}
+
+// NewPatternDetector creates a new pattern detector
+func NewPatternDetector(store *CandleStore, bus *EventBus) *PatternDetector {
+	return &PatternDetector{
+		store:   store,
+		bus:     bus,
+		scanned: make(map[string]int64),
+	}
+}
+
+// Patterns returns all patterns over the latest limit candles of a series
+func (d *PatternDetector) Patterns(pair, interval string, limit int) ([]Pattern, error) {
+	candles, err := d.store.Get(pair, interval, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := DetectPatterns(candles)
+	for i := range patterns {
+		patterns[i].Pair, patterns[i].Interval = pair, interval
+	}
+	return patterns, nil
+}
+
+// Scan detects patterns on the latest closed candle of a series and
+// publishes them; a candle already scanned is skipped
+func (d *PatternDetector) Scan(pair, interval string) ([]Pattern, error) {
+	step, err := IntervalSeconds(interval)
+	if err != nil {
+		return nil, err
+	}
+	candles, err := d.store.Get(pair, interval, 3)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(candles); n > 0 && candles[n-1].Timestamp+step > time.Now().Unix() {
+		candles = candles[:n-1]
+	}
+	if len(candles) == 0 {
+		return nil, nil
+	}
+
+	key := seriesKey(pair, interval)
+	closed := candles[len(candles)-1].Timestamp
+	d.mu.Lock()
+	if d.scanned[key] >= closed {
+		d.mu.Unlock()
+		return nil, nil
+	}
+	d.scanned[key] = closed
+	d.mu.Unlock()
+
+	patterns := DetectLatest(candles)
+	for i := range patterns {
+		patterns[i].Pair, patterns[i].Interval = pair, interval
+		if d.bus != nil {
+			d.bus.Publish(MarketEvent{
+				Type:      PatternEventType,
+				Pair:      pair,
+				Data:      patterns[i],
+				Timestamp: time.Now(),
+			})
+		}
+	}
+	return patterns, nil
+}
+
+// Start scans the pairs on interval as each candle closes, until Stop
+func (d *PatternDetector) Start(pairs []string, interval string) error {
+	step, err := IntervalSeconds(interval)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		return nil
+	}
+	d.stop = make(chan struct{})
+	stop := d.stop
+
+	go func() {
+		for {
+			// Wake just after the next candle opens, when the previous closed
+			next := time.Unix((time.Now().Unix()/step+1)*step, 0).Add(time.Second)
+			select {
+			case <-time.After(time.Until(next)):
+			case <-stop:
+				return
+			}
+			for _, pair := range pairs {
+				patterns, err := d.Scan(pair, interval)
+				if err != nil {
+					logger.Warning("Pattern scan of %s %s failed: %v", pair, interval, err)
+					continue
+				}
+				for _, p := range patterns {
+					logger.Debug("Detected %s on %s %s", p.Type, pair, interval)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop halts the scanning
+func (d *PatternDetector) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+}
@@ -0,0 +1,128 @@
+package market
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nofx/indicators"
+)
+
+// RegimeType represents the market regime of a symbol
+type RegimeType string
+
+const (
+	// TrendingUpRegime is a strong upward trend
+	TrendingUpRegime RegimeType = "trending_up"
+	// TrendingDownRegime is a strong downward trend
+	TrendingDownRegime RegimeType = "trending_down"
+	// RangingRegime is a sideways, mean-reverting market
+	RangingRegime RegimeType = "ranging"
+	// TransitionRegime is between trend and range
+	TransitionRegime RegimeType = "transition"
+)
+
+// Regime classification thresholds
+const (
+	regimePeriod      = 14
+	trendADX          = 25.0
+	rangeADX          = 20.0
+	highVolatilityATR = 0.05
+	regimeCandles     = 100
+	regimeCacheTTL    = time.Minute
+)
+
+// Regime represents the classified regime of a symbol on a timeframe
+type Regime struct {
+	Pair           string     `json:"currency_pair"`
+	Interval       string     `json:"interval"`
+	Type           RegimeType `json:"type"`
+	ADX            float64    `json:"adx"`
+	PlusDI         float64    `json:"plus_di"`
+	MinusDI        float64    `json:"minus_di"`
+	ATRPercent     float64    `json:"atr_percent"`
+	HighVolatility bool       `json:"high_volatility"`
+	Timestamp      time.Time  `json:"timestamp"`
+}
+
+// Trending reports whether the regime is a trend in either direction
+func (r *Regime) Trending() bool {
+	return r.Type == TrendingUpRegime || r.Type == TrendingDownRegime
+}
+
+// ClassifyRegime classifies a candle series by ADX trend strength and
+// ATR-relative volatility
+func ClassifyRegime(candles []CandleData) (RegimeType, float64, float64, float64, float64) {
+	high := make([]float64, len(candles))
+	low := make([]float64, len(candles))
+	close := make([]float64, len(candles))
+	for i, c := range candles {
+		high[i], low[i], close[i] = c.High, c.Low, c.Close
+	}
+
+	adx, plusDI, minusDI := indicators.ADX(high, low, close, regimePeriod)
+	var atrPercent float64
+	if n := len(close); n > 0 && close[n-1] > 0 {
+		atrPercent = indicators.ATR(high, low, close, regimePeriod) / close[n-1]
+	}
+
+	regime := TransitionRegime
+	switch {
+	case adx >= trendADX && plusDI >= minusDI:
+		regime = TrendingUpRegime
+	case adx >= trendADX:
+		regime = TrendingDownRegime
+	case adx < rangeADX:
+		regime = RangingRegime
+	}
+	return regime, adx, plusDI, minusDI, atrPercent
+}
+
+// RegimeService classifies and caches regimes per symbol and timeframe so
+// strategies can cheaply query whether to enable themselves
+type RegimeService struct {
+	store *CandleStore
+	mu    sync.RWMutex
+	cache map[string]*Regime
+}
+
+// NewRegimeService creates a new regime service
+func NewRegimeService(store *CandleStore) *RegimeService {
+	return &RegimeService{
+		store: store,
+		cache: make(map[string]*Regime),
+	}
+}
+
+// Regime returns the current regime of a pair on a timeframe
+func (s *RegimeService) Regime(pair, interval string) (*Regime, error) {
+	key := seriesKey(pair, interval)
+	s.mu.RLock()
+	cached, ok := s.cache[key]
+	s.mu.RUnlock()
+	if ok && time.Since(cached.Timestamp) < regimeCacheTTL {
+		return cached, nil
+	}
+
+	candles, err := s.store.Get(pair, interval, regimeCandles)
+	if err != nil {
+		return nil, err
+	}
+
+	regimeType, adx, plusDI, minusDI, atrPercent := ClassifyRegime(candles)
+	regime := &Regime{
+		Pair:           pair,
+		Interval:       interval,
+		Type:           regimeType,
+		ADX:            adx,
+		PlusDI:         plusDI,
+		MinusDI:        minusDI,
+		ATRPercent:     atrPercent,
+		HighVolatility: atrPercent >= highVolatilityATR,
+		Timestamp:      time.Now(),
+	}
+
+	s.mu.Lock()
+	s.cache[key] = regime
+	s.mu.Unlock()
+	return regime, nil
+}
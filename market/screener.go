@@ -0,0 +1,107 @@
+package market
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Screener caches 24h ticker statistics for watched symbols
+type Screener struct {
+	client *APIClient
+	ttl    time.Duration
+
+	mu        sync.RWMutex
+	tickers   map[string]*TickerData
+	fetchedAt map[string]time.Time
+	watchlist map[string]bool
+}
+
+// NewScreener creates a new screener that refreshes tickers older than ttl
+func NewScreener(client *APIClient, ttl time.Duration) *Screener {
+	return &Screener{
+		client:    client,
+		ttl:       ttl,
+		tickers:   make(map[string]*TickerData),
+		fetchedAt: make(map[string]time.Time),
+		watchlist: make(map[string]bool),
+	}
+}
+
+// Watch adds pairs to the watchlist and returns those that weren't on it
+func (s *Screener) Watch(pairs ...string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var added []string
+	for _, pair := range pairs {
+		if !s.watchlist[pair] {
+			s.watchlist[pair] = true
+			added = append(added, pair)
+		}
+	}
+	return added
+}
+
+// Watchlist returns the watched pairs, sorted
+func (s *Screener) Watchlist() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pairs := make([]string, 0, len(s.watchlist))
+	for pair := range s.watchlist {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// Ticker returns the 24h ticker for a pair, refreshing it when stale
+func (s *Screener) Ticker(pair string) (*TickerData, error) {
+	s.mu.RLock()
+	ticker, ok := s.tickers[pair]
+	fresh := time.Since(s.fetchedAt[pair]) < s.ttl
+	s.mu.RUnlock()
+	if ok && fresh {
+		return ticker, nil
+	}
+
+	ticker, err := s.client.GetTicker(context.Background(), pair)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.tickers[pair], s.fetchedAt[pair] = ticker, time.Now()
+	s.mu.Unlock()
+
+	return ticker, nil
+}
+
+// Volume24h returns the 24h quote volume for a pair
+func (s *Screener) Volume24h(pair string) (float64, error) {
+	ticker, err := s.Ticker(pair)
+	if err != nil {
+		return 0, err
+	}
+	return ticker.QuoteVolume, nil
+}
+
+// Price returns the last price for a pair
+func (s *Screener) Price(pair string) (float64, error) {
+	ticker, err := s.Ticker(pair)
+	if err != nil {
+		return 0, err
+	}
+	return ticker.Last, nil
+}
+
+// Update stores streamed tickers, sparing the REST refresh
+func (s *Screener) Update(tickers []TickerData) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range tickers {
+		ticker := tickers[i]
+		s.tickers[ticker.Pair], s.fetchedAt[ticker.Pair] = &ticker, now
+	}
+}
@@ -0,0 +1,189 @@
+package market
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// TickerFanout distributes ticks to subscribers through per-symbol
+// subscriber lists spread over shards, so publishers of different symbols
+// rarely contend. Subscribers receive the latest tick per symbol rather than
+// every tick, so a fast feed costs them at most one copy per symbol per
+// delivery.
+type TickerFanout struct {
+	shards []*tickerShard
+}
+
+// tickerShard holds the subscriber lists of a subset of symbols
+type tickerShard struct {
+	mu      sync.RWMutex
+	symbols map[string][]*TickerSubscription
+}
+
+// TickerSubscription receives coalesced ticks for a set of symbols at up to
+// a maximum delivery rate
+type TickerSubscription struct {
+	fanout  *TickerFanout
+	symbols []string
+
+	// C is signaled whenever new ticks are pending
+	C chan struct{}
+
+	mu       sync.Mutex
+	interval time.Duration
+	latest   map[string]*TickerData
+	pending  []string
+	closed   bool
+}
+
+// NewTickerFanout creates a new fan-out with the given number of shards
+func NewTickerFanout(shards int) *TickerFanout {
+	if shards <= 0 {
+		shards = 1
+	}
+	f := &TickerFanout{shards: make([]*tickerShard, shards)}
+	for i := range f.shards {
+		f.shards[i] = &tickerShard{symbols: make(map[string][]*TickerSubscription)}
+	}
+	return f
+}
+
+// shard returns the shard owning a symbol
+func (f *TickerFanout) shard(symbol string) *tickerShard {
+	h := fnv.New32a()
+	h.Write([]byte(symbol))
+	return f.shards[h.Sum32()%uint32(len(f.shards))]
+}
+
+// Subscribe registers a subscription for symbols delivering at most maxRate
+// batches per second; maxRate <= 0 disables the limit
+func (f *TickerFanout) Subscribe(symbols []string, maxRate float64) *TickerSubscription {
+	s := &TickerSubscription{
+		fanout:  f,
+		symbols: append([]string(nil), symbols...),
+		C:       make(chan struct{}, 1),
+		latest:  make(map[string]*TickerData, len(symbols)),
+	}
+	s.SetMaxRate(maxRate)
+
+	for _, symbol := range s.symbols {
+		shard := f.shard(symbol)
+		shard.mu.Lock()
+		// Copy on write so Publish can iterate without holding the lock
+		subs := make([]*TickerSubscription, 0, len(shard.symbols[symbol])+1)
+		subs = append(subs, shard.symbols[symbol]...)
+		shard.symbols[symbol] = append(subs, s)
+		shard.mu.Unlock()
+	}
+	return s
+}
+
+// Publish delivers a tick to the subscribers of its symbol
+func (f *TickerFanout) Publish(t *TickerData) {
+	shard := f.shard(t.Pair)
+	shard.mu.RLock()
+	subs := shard.symbols[t.Pair]
+	shard.mu.RUnlock()
+
+	for _, s := range subs {
+		s.offer(t)
+	}
+}
+
+// SetMaxRate changes the maximum delivery rate in batches per second; maxRate
+// <= 0 disables the limit
+func (s *TickerSubscription) SetMaxRate(maxRate float64) {
+	var interval time.Duration
+	if maxRate > 0 {
+		interval = time.Duration(float64(time.Second) / maxRate)
+	}
+	s.mu.Lock()
+	s.interval = interval
+	s.mu.Unlock()
+}
+
+// offer stores a tick as the latest of its symbol, reusing the previous struct
+func (s *TickerSubscription) offer(t *TickerData) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	latest, ok := s.latest[t.Pair]
+	if !ok {
+		latest = new(TickerData)
+		s.latest[t.Pair] = latest
+	}
+	if !ok || latest.Pair == "" {
+		s.pending = append(s.pending, t.Pair)
+	}
+	*latest = *t
+	s.mu.Unlock()
+
+	select {
+	case s.C <- struct{}{}:
+	default:
+	}
+}
+
+// Drain appends the pending latest tick of every updated symbol to dst and
+// returns it; passing the previous result back in avoids allocations
+func (s *TickerSubscription) Drain(dst []TickerData) []TickerData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, symbol := range s.pending {
+		latest := s.latest[symbol]
+		dst = append(dst, *latest)
+		// An empty pair marks the symbol as delivered
+		latest.Pair = ""
+	}
+	s.pending = s.pending[:0]
+	return dst
+}
+
+// Run delivers batches of coalesced ticks to fn until the subscription is
+// closed, waiting at least the subscription interval between batches
+func (s *TickerSubscription) Run(fn func([]TickerData)) {
+	var batch []TickerData
+	for range s.C {
+		batch = s.Drain(batch[:0])
+		if len(batch) > 0 {
+			fn(batch)
+		}
+		s.mu.Lock()
+		interval := s.interval
+		s.mu.Unlock()
+		if interval > 0 {
+			time.Sleep(interval)
+		}
+	}
+}
+
+// Close ends the subscription and releases Run
+func (s *TickerSubscription) Close() {
+	for _, symbol := range s.symbols {
+		shard := s.fanout.shard(symbol)
+		shard.mu.Lock()
+		old := shard.symbols[symbol]
+		subs := make([]*TickerSubscription, 0, len(old))
+		for _, sub := range old {
+			if sub != s {
+				subs = append(subs, sub)
+			}
+		}
+		if len(subs) == 0 {
+			delete(shard.symbols, symbol)
+		} else {
+			shard.symbols[symbol] = subs
+		}
+		shard.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.C)
+	}
+}
@@ -0,0 +1,216 @@
+package market
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+const tickerChannel = "futures.tickers"
+
+// wsTicker represents a ticker of a futures ticker message
+type wsTicker struct {
+	Contract       string `json:"contract"`
+	Last           string `json:"last"`
+	ChangePercent  string `json:"change_percentage"`
+	Low24h         string `json:"low_24h"`
+	High24h        string `json:"high_24h"`
+	Volume24hBase  string `json:"volume_24h_base"`
+	Volume24hQuote string `json:"volume_24h_quote"`
+}
+
+// TickerStream subscribes to futures tickers over websocket and publishes
+// them to a TickerFanout. Subscriptions are replayed on every reconnect, and
+// symbols going silent are resubscribed.
+type TickerStream struct {
+	url    string
+	opts   WSOptions
+	subs   *subscriptionSet
+	health *streamHealth
+	fanout *TickerFanout
+
+	mu   sync.Mutex
+	conn *wsConn
+	stop chan struct{}
+}
+
+// NewTickerStream creates a new ticker stream for the given pairs
+func NewTickerStream(url string, opts WSOptions, pairs []string, fanout *TickerFanout) *TickerStream {
+	return &TickerStream{
+		url:    url,
+		opts:   opts,
+		subs:   newSubscriptionSet(pairs),
+		health: newStreamHealth(opts.Metrics, "ticker", url),
+		fanout: fanout,
+	}
+}
+
+// Start connects and maintains the stream in the background
+func (s *TickerStream) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	go reconnect("Ticker", s.health, s.stop, s.connect)
+}
+
+// Stop closes the stream
+func (s *TickerStream) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Pairs returns the subscribed pairs, sorted
+func (s *TickerStream) Pairs() []string {
+	return s.subs.list()
+}
+
+// Subscribe adds pairs to the stream; while disconnected they are
+// subscribed on the next connection
+func (s *TickerStream) Subscribe(pairs ...string) error {
+	return s.send("subscribe", s.subs.add(pairs...))
+}
+
+// Unsubscribe removes pairs from the stream
+func (s *TickerStream) Unsubscribe(pairs ...string) error {
+	return s.send("unsubscribe", s.subs.remove(pairs...))
+}
+
+// send sends a subscription request on the live connection, if any
+func (s *TickerStream) send(event string, pairs []string) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn == nil || len(pairs) == 0 {
+		return nil
+	}
+	return conn.send(tickerRequest(event, pairs))
+}
+
+// release forgets a connection once it ended
+func (s *TickerStream) release(conn *wsConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == conn {
+		s.conn = nil
+	}
+}
+
+// tickerRequest returns a ticker subscription request
+func tickerRequest(event string, pairs []string) wsRequest {
+	return wsRequest{
+		Time:    time.Now().Unix(),
+		Channel: tickerChannel,
+		Event:   event,
+		Payload: pairs,
+	}
+}
+
+// connect subscribes to every pair and publishes tickers until the
+// connection fails or the stream is stopped
+func (s *TickerStream) connect(stop chan struct{}) error {
+	raw, err := s.opts.dial(s.url)
+	if err != nil {
+		return err
+	}
+	conn := &wsConn{Conn: raw}
+	defer conn.Close()
+
+	s.mu.Lock()
+	select {
+	case <-stop:
+		s.mu.Unlock()
+		return nil
+	default:
+	}
+	s.conn = conn
+	s.mu.Unlock()
+	defer s.release(conn)
+
+	pairs := s.subs.list()
+	if len(pairs) > 0 {
+		if err := conn.send(tickerRequest("subscribe", pairs)); err != nil {
+			return err
+		}
+	}
+	s.subs.reset(time.Now())
+	s.health.connected(true)
+	logger.Info("Ticker stream connected for %d pairs", len(pairs))
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.opts.watchStale("Ticker", conn, s.subs, s.health, func(pair string) error {
+		if err := conn.send(tickerRequest("unsubscribe", []string{pair})); err != nil {
+			return err
+		}
+		return conn.send(tickerRequest("subscribe", []string{pair}))
+	}, done)
+
+	// The message, decoded tickers and published struct are reused across
+	// messages; the fan-out copies what it keeps
+	var (
+		msg     wsMessage
+		tickers []wsTicker
+		tick    TickerData
+	)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		s.opts.extendDeadline(conn.Conn)
+
+		msg.Result = msg.Result[:0]
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logger.Warning("Failed to decode ticker message: %v", err)
+			continue
+		}
+		if msg.Channel != tickerChannel || msg.Event != "update" {
+			continue
+		}
+
+		tickers = tickers[:0]
+		if err := json.Unmarshal(msg.Result, &tickers); err != nil {
+			logger.Warning("Failed to decode ticker update: %v", err)
+			continue
+		}
+		now := time.Now()
+		for i := range tickers {
+			s.subs.touch(tickers[i].Contract, now)
+			tickers[i].fill(&tick)
+			s.fanout.Publish(&tick)
+		}
+	}
+}
+
+// fill converts a websocket ticker into t
+func (w *wsTicker) fill(t *TickerData) {
+	*t = TickerData{
+		Pair:          w.Contract,
+		Last:          parseFloat(w.Last),
+		PercentChange: parseFloat(w.ChangePercent),
+		BaseVolume:    parseFloat(w.Volume24hBase),
+		QuoteVolume:   parseFloat(w.Volume24hQuote),
+		High24hr:      parseFloat(w.High24h),
+		Low24hr:       parseFloat(w.Low24h),
+	}
+}
+
+// parseFloat parses a decimal string, returning 0 when malformed
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
@@ -0,0 +1,187 @@
+package market
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+const tradeChannel = "futures.trades"
+
+// wsTrade represents a trade of a futures trades message; sells have a
+// negative size
+type wsTrade struct {
+	Contract     string  `json:"contract"`
+	Size         float64 `json:"size"`
+	Price        string  `json:"price"`
+	CreateTimeMs int64   `json:"create_time_ms"`
+}
+
+// TradeStream subscribes to the public futures trades over websocket and
+// hands them to a handler, typically a BarBuilder. Subscriptions are
+// replayed on every reconnect. Quiet contracts may trade rarely, so silent
+// symbols aren't resubscribed.
+type TradeStream struct {
+	url     string
+	opts    WSOptions
+	subs    *subscriptionSet
+	health  *streamHealth
+	handler func(Trade)
+
+	mu   sync.Mutex
+	conn *wsConn
+	stop chan struct{}
+}
+
+// NewTradeStream creates a new trade stream for the given pairs
+func NewTradeStream(url string, opts WSOptions, pairs []string, handler func(Trade)) *TradeStream {
+	return &TradeStream{
+		url:     url,
+		opts:    opts,
+		subs:    newSubscriptionSet(pairs),
+		health:  newStreamHealth(opts.Metrics, "trades", url),
+		handler: handler,
+	}
+}
+
+// Start connects and maintains the stream in the background
+func (s *TradeStream) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	go reconnect("Trade", s.health, s.stop, s.connect)
+}
+
+// Stop closes the stream
+func (s *TradeStream) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Pairs returns the subscribed pairs, sorted
+func (s *TradeStream) Pairs() []string {
+	return s.subs.list()
+}
+
+// Subscribe adds pairs to the stream; while disconnected they are
+// subscribed on the next connection
+func (s *TradeStream) Subscribe(pairs ...string) error {
+	return s.send("subscribe", s.subs.add(pairs...))
+}
+
+// Unsubscribe removes pairs from the stream
+func (s *TradeStream) Unsubscribe(pairs ...string) error {
+	return s.send("unsubscribe", s.subs.remove(pairs...))
+}
+
+// send sends a subscription request on the live connection, if any
+func (s *TradeStream) send(event string, pairs []string) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn == nil || len(pairs) == 0 {
+		return nil
+	}
+	return conn.send(tradeRequest(event, pairs))
+}
+
+// release forgets a connection once it ended
+func (s *TradeStream) release(conn *wsConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == conn {
+		s.conn = nil
+	}
+}
+
+// tradeRequest returns a trades subscription request
+func tradeRequest(event string, pairs []string) wsRequest {
+	return wsRequest{
+		Time:    time.Now().Unix(),
+		Channel: tradeChannel,
+		Event:   event,
+		Payload: pairs,
+	}
+}
+
+// connect subscribes to every pair and hands trades over until the
+// connection fails or the stream is stopped
+func (s *TradeStream) connect(stop chan struct{}) error {
+	raw, err := s.opts.dial(s.url)
+	if err != nil {
+		return err
+	}
+	conn := &wsConn{Conn: raw}
+	defer conn.Close()
+
+	s.mu.Lock()
+	select {
+	case <-stop:
+		s.mu.Unlock()
+		return nil
+	default:
+	}
+	s.conn = conn
+	s.mu.Unlock()
+	defer s.release(conn)
+
+	pairs := s.subs.list()
+	if len(pairs) > 0 {
+		if err := conn.send(tradeRequest("subscribe", pairs)); err != nil {
+			return err
+		}
+	}
+	s.subs.reset(time.Now())
+	s.health.connected(true)
+	logger.Info("Trade stream connected for %d pairs", len(pairs))
+
+	var (
+		msg    wsMessage
+		trades []wsTrade
+	)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		s.opts.extendDeadline(conn.Conn)
+
+		msg.Result = msg.Result[:0]
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logger.Warning("Failed to decode trade message: %v", err)
+			continue
+		}
+		if msg.Channel != tradeChannel || msg.Event != "update" {
+			continue
+		}
+
+		trades = trades[:0]
+		if err := json.Unmarshal(msg.Result, &trades); err != nil {
+			logger.Warning("Failed to decode trade update: %v", err)
+			continue
+		}
+		now := time.Now()
+		for _, t := range trades {
+			s.subs.touch(t.Contract, now)
+			s.handler(Trade{
+				Pair:  t.Contract,
+				Price: parseFloat(t.Price),
+				Size:  t.Size,
+				Time:  time.UnixMilli(t.CreateTimeMs),
+			})
+		}
+	}
+}
@@ -35,6 +35,7 @@ type TickerData struct {
 
 // OrderBook represents the order book for a trading pair
 type OrderBook struct {
+	ID   int64 `json:"id,omitempty"`
 	Asks [][]float64 `json:"asks"`
 	Bids [][]float64 `json:"bids"`
 	Timestamp int64 `json:"timestamp"`
@@ -46,4 +47,71 @@ type MarketEvent struct {
 	Pair      string      `json:"pair"`
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
-}
\ No newline at end of file
+}
+
+// ContractInfo represents trading rules and metadata for a contract
+type ContractInfo struct {
+	Pair             string  `json:"currency_pair"`
+	TickSize         float64 `json:"tick_size"`
+	QuantityStep     float64 `json:"quantity_step"`
+	MinQuantity      float64 `json:"min_quantity"`
+	MinNotional      float64 `json:"min_notional"`
+	ContractSize     float64 `json:"contract_size"`
+	MaxLeverage      int64   `json:"max_leverage"`
+	MaintenanceRate  float64 `json:"maintenance_rate"`
+	MakerFeeRate     float64 `json:"maker_fee_rate"`
+	TakerFeeRate     float64 `json:"taker_fee_rate"`
+	FundingRate      float64 `json:"funding_rate"`
+	FundingInterval  int64   `json:"funding_interval"`
+	NextFundingTime  int64   `json:"next_funding_time"`
+	// MarkPrice is the mark price when the contract was listed, if reported
+	MarkPrice        float64 `json:"mark_price,omitempty"`
+	// Settle is the settlement currency, e.g. "usdt" or "btc". Inverse
+	// (coin-margined) contracts are margined and settled in their base
+	// currency, and their ContractSize is in the quote currency (USD).
+	Settle  string `json:"settle,omitempty"`
+	Inverse bool   `json:"inverse,omitempty"`
+}
+
+// PnL returns the PnL of qty contracts, negative for a short, entered at
+// entry and marked or closed at exit: in the quote currency for linear
+// contracts, and in the settle currency for inverse contracts, whose PnL
+// follows the change of the reciprocal of the price
+func (c *ContractInfo) PnL(qty, entry, exit float64) float64 {
+	size := c.ContractSize
+	if size <= 0 {
+		size = 1
+	}
+	if !c.Inverse {
+		return qty * size * (exit - entry)
+	}
+	if entry <= 0 || exit <= 0 {
+		return 0
+	}
+	return qty * size * (1/entry - 1/exit)
+}
+
+// Notional returns the value of qty contracts at price, in the settle
+// currency: the contracts' quote value for linear contracts, and their USD
+// value converted at price for inverse contracts
+func (c *ContractInfo) Notional(qty, price float64) float64 {
+	size := c.ContractSize
+	if size <= 0 {
+		size = 1
+	}
+	if !c.Inverse {
+		return qty * size * price
+	}
+	if price <= 0 {
+		return 0
+	}
+	return qty * size / price
+}
+
+// FundingRate represents a funding rate of a perpetual contract; for history
+// entries Time is when it was settled, for the current rate when it will be
+type FundingRate struct {
+	Pair string  `json:"currency_pair"`
+	Rate float64 `json:"rate"`
+	Time int64   `json:"funding_time"`
+}
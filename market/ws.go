@@ -0,0 +1,334 @@
+package market
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nofx/logger"
+	"github.com/nofx/metrics"
+)
+
+// maxReconnectBackoff caps the delay between reconnection attempts
+const maxReconnectBackoff = time.Minute
+
+// WSOptions represents websocket dial settings shared by the streamers
+type WSOptions struct {
+	// Proxy is an http, https or socks5 proxy URL; empty uses the environment
+	Proxy            string
+	Headers          map[string]string
+	PingInterval     time.Duration
+	HandshakeTimeout time.Duration
+	Compression      bool
+
+	// StaleAfter is how long a subscribed symbol may go without a message
+	// before it is resubscribed; if it stays silent the connection is
+	// replaced. Zero disables the check
+	StaleAfter time.Duration
+
+	// Metrics records connection state, reconnects and resubscribes when set
+	Metrics *metrics.Registry
+}
+
+// dial opens a websocket connection with the options applied
+func (o WSOptions) dial(endpoint string) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		Proxy:             http.ProxyFromEnvironment,
+		HandshakeTimeout:  45 * time.Second,
+		EnableCompression: o.Compression,
+	}
+	if o.HandshakeTimeout > 0 {
+		dialer.HandshakeTimeout = o.HandshakeTimeout
+	}
+	if o.Proxy != "" {
+		proxy, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		dialer.Proxy = http.ProxyURL(proxy)
+	}
+
+	header := make(http.Header, len(o.Headers))
+	for k, v := range o.Headers {
+		header.Set(k, v)
+	}
+
+	conn, _, err := dialer.Dial(endpoint, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pings keep idle tunnels open; a connection silent for three intervals is dead
+	if o.PingInterval > 0 {
+		timeout := 3 * o.PingInterval
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(timeout))
+		})
+		go ping(conn, o.PingInterval)
+	}
+	return conn, nil
+}
+
+// extendDeadline pushes the read deadline after a received message
+func (o WSOptions) extendDeadline(conn *websocket.Conn) {
+	if o.PingInterval > 0 {
+		conn.SetReadDeadline(time.Now().Add(3 * o.PingInterval))
+	}
+}
+
+// ping sends websocket pings until the connection fails
+func ping(conn *websocket.Conn, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(interval)); err != nil {
+			return
+		}
+	}
+}
+
+// reconnect keeps a stream connected until stop is closed, reconnecting with
+// exponential backoff
+func reconnect(name string, health *streamHealth, stop chan struct{}, connect func(stop chan struct{}) error) {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			health.reconnected()
+		}
+		start := time.Now()
+		if err := connect(stop); err != nil {
+			logger.Warning("%s stream disconnected: %v", name, err)
+		}
+		health.connected(false)
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		// A connection that stayed up for a while resets the backoff
+		if time.Since(start) > maxReconnectBackoff {
+			backoff = time.Second
+		}
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return
+		}
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// wsConn serializes writes to a websocket connection, which allows only one
+// concurrent writer
+type wsConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+// send writes a JSON message
+func (c *wsConn) send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.WriteJSON(v)
+}
+
+// subscriptionSet holds the symbols subscribed on a stream, replayed on every
+// reconnect, with the time of their last message
+type subscriptionSet struct {
+	mu      sync.Mutex
+	last    map[string]time.Time
+	retried map[string]bool
+}
+
+// newSubscriptionSet creates a subscription set of pairs
+func newSubscriptionSet(pairs []string) *subscriptionSet {
+	s := &subscriptionSet{last: make(map[string]time.Time), retried: make(map[string]bool)}
+	s.add(pairs...)
+	return s
+}
+
+// add subscribes pairs and returns those not subscribed yet
+func (s *subscriptionSet) add(pairs ...string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var added []string
+	for _, pair := range pairs {
+		if _, ok := s.last[pair]; !ok {
+			s.last[pair] = time.Now()
+			added = append(added, pair)
+		}
+	}
+	return added
+}
+
+// remove unsubscribes pairs and returns those that were subscribed
+func (s *subscriptionSet) remove(pairs ...string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed []string
+	for _, pair := range pairs {
+		if _, ok := s.last[pair]; ok {
+			delete(s.last, pair)
+			delete(s.retried, pair)
+			removed = append(removed, pair)
+		}
+	}
+	return removed
+}
+
+// list returns the subscribed pairs, sorted
+func (s *subscriptionSet) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pairs := make([]string, 0, len(s.last))
+	for pair := range s.last {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// touch records a message for a subscribed pair
+func (s *subscriptionSet) touch(pair string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.last[pair]; ok {
+		s.last[pair] = now
+		delete(s.retried, pair)
+	}
+}
+
+// reset gives every pair a fresh staleness window, as after a reconnect
+func (s *subscriptionSet) reset(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for pair := range s.last {
+		s.last[pair] = now
+	}
+	s.retried = make(map[string]bool)
+}
+
+// stale returns the pairs silent for longer than after: those to resubscribe,
+// which get a fresh window, and those still silent after a resubscribe
+func (s *subscriptionSet) stale(now time.Time, after time.Duration) (resubscribe, dead []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for pair, last := range s.last {
+		if now.Sub(last) <= after {
+			continue
+		}
+		if s.retried[pair] {
+			dead = append(dead, pair)
+			continue
+		}
+		s.retried[pair] = true
+		s.last[pair] = now
+		resubscribe = append(resubscribe, pair)
+	}
+	sort.Strings(resubscribe)
+	sort.Strings(dead)
+	return resubscribe, dead
+}
+
+// watchStale resubscribes the pairs of a connection that went silent for
+// longer than the stale timeout, and closes the connection to force a
+// reconnect when a resubscribed pair stays silent, until done is closed
+func (o WSOptions) watchStale(name string, conn *wsConn, subs *subscriptionSet, health *streamHealth,
+	resubscribe func(pair string) error, done chan struct{}) {
+	if o.StaleAfter <= 0 {
+		return
+	}
+	period := o.StaleAfter / 2
+	if period < time.Second {
+		period = time.Second
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+
+		pairs, dead := subs.stale(time.Now(), o.StaleAfter)
+		health.stale(len(pairs) + len(dead))
+		if len(dead) > 0 {
+			logger.Warning("%s stream silent for %v after resubscribing %v, reconnecting", name, o.StaleAfter, dead)
+			conn.Close()
+			return
+		}
+		for _, pair := range pairs {
+			logger.Warning("%s stream received nothing for %s in %v, resubscribing", name, pair, o.StaleAfter)
+			if err := resubscribe(pair); err != nil {
+				conn.Close()
+				return
+			}
+			health.resubscribed()
+		}
+	}
+}
+
+// streamHealth records the connection state, reconnects and resubscribes of
+// a stream as metrics labeled by stream and venue host, when a registry is set
+type streamHealth struct {
+	registry *metrics.Registry
+	labels   metrics.Labels
+}
+
+// newStreamHealth creates the health metrics of a stream connecting to endpoint
+func newStreamHealth(registry *metrics.Registry, stream, endpoint string) *streamHealth {
+	venue := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		venue = u.Host
+	}
+	if registry != nil {
+		registry.Describe("ws_connected", "Whether the websocket stream is connected")
+		registry.Describe("ws_reconnects_total", "Websocket stream reconnection attempts")
+		registry.Describe("ws_resubscribes_total", "Resubscriptions of stale websocket symbols")
+		registry.Describe("ws_stale_symbols", "Subscribed symbols without a recent message")
+	}
+	return &streamHealth{registry: registry, labels: metrics.Labels{"stream": stream, "venue": venue}}
+}
+
+// connected records the connection state
+func (h *streamHealth) connected(up bool) {
+	if h.registry == nil {
+		return
+	}
+	value := 0.0
+	if up {
+		value = 1
+	}
+	h.registry.Set("ws_connected", h.labels, value)
+}
+
+// reconnected counts a reconnection attempt
+func (h *streamHealth) reconnected() {
+	if h.registry != nil {
+		h.registry.Add("ws_reconnects_total", h.labels, 1)
+	}
+}
+
+// resubscribed counts the resubscription of a stale symbol
+func (h *streamHealth) resubscribed() {
+	if h.registry != nil {
+		h.registry.Add("ws_resubscribes_total", h.labels, 1)
+	}
+}
+
+// stale records the number of stale symbols
+func (h *streamHealth) stale(n int) {
+	if h.registry != nil {
+		h.registry.Set("ws_stale_symbols", h.labels, float64(n))
+	}
+}
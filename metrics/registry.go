@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Labels represents the label set of a series
+type Labels map[string]string
+
+// kind is the Prometheus type of a metric family
+type kind string
+
+const (
+	gauge   kind = "gauge"
+	counter kind = "counter"
+)
+
+// family holds the series of one metric name keyed by rendered labels
+type family struct {
+	kind   kind
+	help   string
+	series map[string]float64
+}
+
+// Registry holds gauges and counters and serves them in the Prometheus text
+// exposition format; metrics appear on first use, no registration needed
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates a new metric registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Describe sets the help text of a metric
+func (r *Registry) Describe(name, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(Name(name), gauge).help = help
+}
+
+// Set sets a gauge
+func (r *Registry) Set(name string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(Name(name), gauge).series[render(labels)] = value
+}
+
+// Add increments a counter
+func (r *Registry) Add(name string, labels Labels, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(Name(name), counter).series[render(labels)] += delta
+}
+
+// Delete removes a series, e.g. of a stopped strategy
+func (r *Registry) Delete(name string, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[Name(name)]; ok {
+		delete(f.series, render(labels))
+	}
+}
+
+// family returns a metric family, creating it with the given kind; the
+// caller must hold mu
+func (r *Registry) family(name string, k kind) *family {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{kind: k, series: make(map[string]float64)}
+		r.families[name] = f
+	} else if len(f.series) == 0 {
+		f.kind = k
+	}
+	return f
+}
+
+// Write renders every metric in the text exposition format, sorted by name
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		if len(f.series) == 0 {
+			continue
+		}
+		if f.help != "" {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n", name, f.help); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, f.kind); err != nil {
+			return err
+		}
+		series := make([]string, 0, len(f.series))
+		for labels := range f.series {
+			series = append(series, labels)
+		}
+		sort.Strings(series)
+		for _, labels := range series {
+			value := strconv.FormatFloat(f.series[labels], 'g', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, labels, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Write(w)
+}
+
+// Name converts a name into a valid metric name, replacing invalid characters with underscores
+func Name(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+			b.WriteRune(c)
+		case c >= '0' && c <= '9' && i > 0:
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// labelEscaper escapes label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// render renders a label set as {a="1",b="2"}, sorted by label name
+func render(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = Name(name) + `="` + labelEscaper.Replace(labels[name]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,264 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nofx/journal"
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// TimeStopAlert is raised when a position outlived its maximum holding time
+const TimeStopAlert AlertType = "time_stop"
+
+// TimeStopReason is the exit reason tagged on time-stop closes and flagged positions
+const TimeStopReason = "time-stop"
+
+// TimeStopAction represents what happens to a position held too long
+type TimeStopAction string
+
+const (
+	// TimeStopClose closes the position
+	TimeStopClose TimeStopAction = "close"
+	// TimeStopFlag only flags the position for review
+	TimeStopFlag TimeStopAction = "flag"
+)
+
+// HoldingRule represents the maximum holding time of positions; a zero
+// MaxAge disables the time stop
+type HoldingRule struct {
+	MaxAge time.Duration
+	Action TimeStopAction
+}
+
+// FundingTimer times orders around funding, typically the execution
+// funding timer: entries that would pay an upcoming funding are delayed
+// past it and exits planned shortly after one are brought forward
+type FundingTimer interface {
+	EntryDelay(strategy, pair string, side trader.Side, now time.Time) (time.Duration, error)
+	ExitTime(strategy, pair string, side trader.Side, planned, now time.Time) (time.Time, error)
+}
+
+// AgingMonitor enforces maximum holding times, closing positions held longer
+// than their rule allows, or flagging them for review. Closes are annotated
+// in the journal with the "time-stop" exit reason; a close due shortly after
+// a funding the position pays happens before it as the strategy's funding
+// policy requires.
+type AgingMonitor struct {
+	traders  *trader.Manager
+	guard    *trader.SlippageGuard
+	journal  *journal.Journal
+	funding  FundingTimer
+	fallback HoldingRule
+	rules    map[string]HoldingRule
+	interval time.Duration
+
+	// OnAlert is called for every raised alert; defaults to logging a warning
+	OnAlert func(Alert)
+
+	mu      sync.Mutex
+	flagged map[string]bool
+	stop    chan struct{}
+}
+
+// NewAgingMonitor creates a new aging monitor. Rules override the fallback
+// per strategy name or currency pair, a pair taking precedence; funding may
+// be nil to close positions exactly at their maximum age.
+func NewAgingMonitor(traders *trader.Manager, guard *trader.SlippageGuard, j *journal.Journal, funding FundingTimer, fallback HoldingRule, rules map[string]HoldingRule, interval time.Duration) *AgingMonitor {
+	return &AgingMonitor{
+		traders:  traders,
+		guard:    guard,
+		journal:  j,
+		funding:  funding,
+		fallback: fallback,
+		rules:    rules,
+		interval: interval,
+		flagged:  make(map[string]bool),
+		OnAlert: func(a Alert) {
+			logger.Warning("Time stop alarm [%s]: %s", a.Type, a.Message)
+		},
+	}
+}
+
+// Start begins checking positions in the background
+func (m *AgingMonitor) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.Check(ctx, now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the checks
+func (m *AgingMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Rule returns the holding rule applying to a position
+func (m *AgingMonitor) Rule(p trader.Position) HoldingRule {
+	if rule, ok := m.rules[p.Pair]; ok {
+		return rule
+	}
+	if rule, ok := m.rules[p.Strategy]; ok && p.Strategy != "" {
+		return rule
+	}
+	return m.fallback
+}
+
+// Check closes or flags every position on every exchange held longer than
+// its rule allows and returns the results of the closes. A position is
+// flagged once.
+func (m *AgingMonitor) Check(ctx context.Context, now time.Time) map[string][]trader.CloseResult {
+	results := make(map[string][]trader.CloseResult)
+	open := make(map[string]bool)
+	complete := true
+	for _, name := range m.traders.Names() {
+		t, err := m.traders.Get(name)
+		if err != nil {
+			complete = false
+			continue
+		}
+		positions, err := t.GetPositions(ctx)
+		if err != nil {
+			logger.Warning("Failed to get positions on %s for time stops: %v", name, err)
+			complete = false
+			continue
+		}
+
+		for _, p := range positions {
+			if p.Size == 0 || p.CreatedTime == 0 {
+				continue
+			}
+			key := name + "|" + p.Pair + "|" + string(p.Side) + "|" + strconv.FormatInt(p.CreatedTime, 10)
+			open[key] = true
+
+			rule := m.Rule(p)
+			age := now.Sub(time.UnixMilli(p.CreatedTime))
+			if rule.MaxAge <= 0 || now.Before(m.due(p, rule, now)) {
+				continue
+			}
+			if rule.Action == TimeStopFlag {
+				m.flag(name, key, p, age, rule)
+				continue
+			}
+			results[name] = append(results[name], m.close(ctx, name, t, p, age, rule)...)
+		}
+	}
+
+	// Forget flags of positions closed since, unless an exchange couldn't be read
+	if complete {
+		m.mu.Lock()
+		for key := range m.flagged {
+			if !open[key] {
+				delete(m.flagged, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+	return results
+}
+
+// due returns when a position reaches its maximum age, brought forward
+// before a funding the position would pay shortly before then
+func (m *AgingMonitor) due(p trader.Position, rule HoldingRule, now time.Time) time.Time {
+	due := time.UnixMilli(p.CreatedTime).Add(rule.MaxAge)
+	if m.funding == nil || rule.Action != TimeStopClose {
+		return due
+	}
+	exit, err := m.funding.ExitTime(p.Strategy, p.Pair, p.Side, due, now)
+	if err != nil {
+		logger.Warning("Failed to time the time stop of %s %s around funding: %v", p.Pair, p.Side, err)
+		return due
+	}
+	return exit
+}
+
+// close closes a position with the time-stop exit reason
+func (m *AgingMonitor) close(ctx context.Context, name string, t trader.Trader, p trader.Position, age time.Duration, rule HoldingRule) []trader.CloseResult {
+	note := fmt.Sprintf("Held %s, beyond the maximum of %s", age.Round(time.Minute), rule.MaxAge)
+	if age < rule.MaxAge {
+		note = fmt.Sprintf("Held %s, closed ahead of funding short of the maximum of %s", age.Round(time.Minute), rule.MaxAge)
+	}
+	results := trader.CloseBatch(ctx, t, []trader.Position{p}, trader.CloseFilter{}, m.guard)
+	for _, r := range results {
+		if r.Error != "" {
+			m.OnAlert(Alert{
+				Type:      TimeStopAlert,
+				Pair:      r.Pair,
+				Message:   fmt.Sprintf("Failed to time-stop %s %s on %s: %s", r.Pair, r.Side, name, r.Error),
+				Timestamp: time.Now(),
+			})
+			continue
+		}
+		logger.Info("Time stop closed %s %s on %s: %s", r.Pair, r.Side, name, note)
+		if r.Order != nil && m.journal != nil {
+			if _, err := m.journal.Annotate(journal.Annotation{
+				Target:    journal.OrderTarget,
+				Reference: r.Order.ID,
+				Pair:      r.Pair,
+				Tags:      []string{TimeStopReason},
+				Note:      note,
+			}); err != nil {
+				logger.Warning("Failed to record time stop of %s: %v", r.Pair, err)
+			}
+		}
+	}
+	return results
+}
+
+// flag raises an alert and annotates a position for review, once per position
+func (m *AgingMonitor) flag(name, key string, p trader.Position, age time.Duration, rule HoldingRule) {
+	m.mu.Lock()
+	flagged := m.flagged[key]
+	m.flagged[key] = true
+	m.mu.Unlock()
+	if flagged {
+		return
+	}
+
+	note := fmt.Sprintf("Held %s, beyond the maximum of %s; review", age.Round(time.Minute), rule.MaxAge)
+	m.OnAlert(Alert{
+		Type:      TimeStopAlert,
+		Pair:      p.Pair,
+		Message:   fmt.Sprintf("%s %s on %s: %s", p.Pair, p.Side, name, note),
+		Timestamp: time.Now(),
+	})
+	if m.journal != nil {
+		if _, err := m.journal.Annotate(journal.Annotation{
+			Target:    journal.PositionTarget,
+			Reference: p.Pair,
+			Pair:      p.Pair,
+			Tags:      []string{TimeStopReason, "review"},
+			Note:      note,
+		}); err != nil {
+			logger.Warning("Failed to flag %s for review: %v", p.Pair, err)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// BracketAlert is raised when a protective order went missing and was re-placed
+const BracketAlert AlertType = "bracket_integrity"
+
+// LegKind represents the kind of protective order in a bracket
+type LegKind string
+
+const (
+	// StopLossLeg is a stop-loss order
+	StopLossLeg LegKind = "stop_loss"
+	// TakeProfitLeg is a take-profit order
+	TakeProfitLeg LegKind = "take_profit"
+)
+
+// BracketLeg represents a protective order expected to stay alive while its position is open
+type BracketLeg struct {
+	Kind          LegKind                 `json:"kind"`
+	Pair          string                  `json:"currency_pair"`
+	Side          trader.Side             `json:"side"`
+	Amount        float64                 `json:"amount"`
+	TriggerPrice  float64                 `json:"trigger_price"`
+	PriceType     trader.TriggerPriceType `json:"price_type"`
+	OrderID       string                  `json:"order_id"`
+	ClientOrderID string                  `json:"client_order_id"`
+	// External marks orders placed outside nofx, which are never re-placed or canceled
+	External bool `json:"external,omitempty"`
+}
+
+// key identifies a leg by position and kind; external legs also by order ID,
+// as a position may carry several
+func (l BracketLeg) key() string {
+	key := l.Pair + "|" + string(l.Side) + "|" + string(l.Kind)
+	if l.External {
+		key += "|" + l.OrderID
+	}
+	return key
+}
+
+// BracketMonitor continuously verifies that every open position still has its
+// protective orders alive on the exchange and re-places any that went missing
+type BracketMonitor struct {
+	trader   trader.Trader
+	tag      *trader.OrderTag
+	interval time.Duration
+
+	// OnAlert is called for every raised alert; defaults to logging a warning
+	OnAlert func(Alert)
+
+	mu   sync.Mutex
+	legs map[string]*BracketLeg
+	stop chan struct{}
+}
+
+// NewBracketMonitor creates a new bracket integrity monitor; orders whose
+// client order ID the tag doesn't own are imported as external
+func NewBracketMonitor(t trader.Trader, tag *trader.OrderTag, interval time.Duration) *BracketMonitor {
+	return &BracketMonitor{
+		trader:   t,
+		tag:      tag,
+		interval: interval,
+		legs:     make(map[string]*BracketLeg),
+		OnAlert: func(a Alert) {
+			logger.Warning("Bracket alarm [%s]: %s", a.Type, a.Message)
+		},
+	}
+}
+
+// Track registers a protective order that should stay alive while its position is open
+func (m *BracketMonitor) Track(leg BracketLeg) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.legs[leg.key()] = &leg
+}
+
+// Legs returns a copy of all tracked protective orders
+func (m *BracketMonitor) Legs() []BracketLeg {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	legs := make([]BracketLeg, 0, len(m.legs))
+	for _, leg := range m.legs {
+		legs = append(legs, *leg)
+	}
+	return legs
+}
+
+// Start begins periodic integrity checks in the background
+func (m *BracketMonitor) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.Check(ctx)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts periodic integrity checks
+func (m *BracketMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Check imports the protective orders placed outside nofx, then verifies every
+// tracked leg: legs whose position is closed are forgotten, external legs
+// gone from the exchange are dropped, and our own missing legs are re-placed
+// unless an external order of the same kind now protects the position
+func (m *BracketMonitor) Check(ctx context.Context) []Alert {
+	positions, err := m.trader.GetPositions(ctx)
+	if err != nil {
+		logger.Error("Bracket check failed to get positions: %v", err)
+		return nil
+	}
+
+	open := make(map[string]trader.Position, len(positions))
+	for _, p := range positions {
+		if p.Size != 0 {
+			open[p.Pair+"|"+string(p.Side)] = p
+		}
+	}
+
+	// Fetch the open orders of every pair with a position, importing the
+	// conditional orders we didn't place
+	alive := make(map[string]map[string]bool)
+	for _, p := range open {
+		if _, ok := alive[p.Pair]; ok {
+			continue
+		}
+		orders, err := m.trader.GetOrders(ctx, p.Pair, trader.OrderStatusNew)
+		if err != nil {
+			logger.Error("Bracket check failed to get open orders for %s: %v", p.Pair, err)
+			continue
+		}
+		ids := make(map[string]bool, 2*len(orders))
+		for _, o := range orders {
+			ids[o.ID] = true
+			if o.ClientOrderID != "" {
+				ids[o.ClientOrderID] = true
+			}
+		}
+		alive[p.Pair] = ids
+		m.importExternal(orders, open)
+	}
+
+	legs := m.Legs()
+	external := make(map[string]bool)
+	for _, leg := range legs {
+		if leg.External && alive[leg.Pair][leg.OrderID] {
+			external[leg.Pair+"|"+string(leg.Side)+"|"+string(leg.Kind)] = true
+		}
+	}
+
+	var alerts []Alert
+	for _, leg := range legs {
+		ids, checked := alive[leg.Pair]
+		if _, ok := open[leg.Pair+"|"+string(leg.Side)]; !ok {
+			m.forget(leg)
+			continue
+		}
+		if !checked || ids[leg.OrderID] || (leg.ClientOrderID != "" && ids[leg.ClientOrderID]) {
+			continue
+		}
+
+		switch {
+		case leg.External:
+			logger.Info("External %s %s for %s %s is gone from the exchange", leg.Kind, leg.OrderID, leg.Pair, leg.Side)
+			m.forget(leg)
+		case external[leg.Pair+"|"+string(leg.Side)+"|"+string(leg.Kind)]:
+			logger.Info("%s %s for %s %s was replaced by an external order, not re-placing",
+				leg.Kind, leg.OrderID, leg.Pair, leg.Side)
+			m.forget(leg)
+		default:
+			alert := m.replace(ctx, leg)
+			m.OnAlert(alert)
+			alerts = append(alerts, alert)
+		}
+	}
+
+	return alerts
+}
+
+// importExternal tracks the open conditional orders placed outside nofx, e.g.
+// stops set on the exchange UI, as external legs of the positions they
+// protect; a trigger beyond the mark price in the position's favor is a take
+// profit, otherwise a stop loss
+func (m *BracketMonitor) importExternal(orders []trader.Order, open map[string]trader.Position) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	own := make(map[string]bool, len(m.legs))
+	for _, leg := range m.legs {
+		own[leg.OrderID] = true
+	}
+
+	for _, o := range orders {
+		if o.Type != trader.StopOrder || own[o.ID] || (m.tag != nil && m.tag.Owns(o.ClientOrderID)) {
+			continue
+		}
+
+		// A protective order trades against the position it protects
+		side := trader.BuySide
+		if o.Side == trader.BuySide {
+			side = trader.SellSide
+		}
+		p, ok := open[o.Pair+"|"+string(side)]
+		if !ok {
+			continue
+		}
+
+		reference := p.MarkPrice
+		if reference <= 0 {
+			reference = p.EntryPrice
+		}
+		kind := StopLossLeg
+		if (side == trader.BuySide && o.Price > reference) || (side == trader.SellSide && o.Price < reference) {
+			kind = TakeProfitLeg
+		}
+
+		leg := BracketLeg{
+			Kind:          kind,
+			Pair:          o.Pair,
+			Side:          side,
+			Amount:        o.Amount,
+			TriggerPrice:  o.Price,
+			OrderID:       o.ID,
+			ClientOrderID: o.ClientOrderID,
+			External:      true,
+		}
+		if _, known := m.legs[leg.key()]; !known {
+			logger.Info("Imported external %s %s for %s %s at %.8f", kind, o.ID, o.Pair, side, o.Price)
+		}
+		m.legs[leg.key()] = &leg
+	}
+}
+
+// forget stops tracking a leg
+func (m *BracketMonitor) forget(leg BracketLeg) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.legs, leg.key())
+}
+
+// replace re-places a missing protective order and updates the tracked leg
+func (m *BracketMonitor) replace(ctx context.Context, leg BracketLeg) Alert {
+	place := m.trader.SetStopLoss
+	if leg.Kind == TakeProfitLeg {
+		place = m.trader.SetTakeProfit
+	}
+
+	alert := Alert{Type: BracketAlert, Pair: leg.Pair, Timestamp: time.Now()}
+	order, err := place(ctx, leg.Pair, leg.Side, leg.Amount, leg.TriggerPrice, leg.PriceType)
+	if err == nil && order == nil {
+		err = errors.New("exchange returned no order")
+	}
+	if err != nil {
+		alert.Message = fmt.Sprintf("%s for %s %s (order %s) is missing and re-placing failed: %v",
+			leg.Kind, leg.Pair, leg.Side, leg.OrderID, err)
+		return alert
+	}
+
+	leg.OrderID, leg.ClientOrderID = order.ID, order.ClientOrderID
+	m.Track(leg)
+
+	alert.Message = fmt.Sprintf("%s for %s %s was missing on the exchange and has been re-placed at %.8f",
+		leg.Kind, leg.Pair, leg.Side, leg.TriggerPrice)
+	return alert
+}
@@ -0,0 +1,170 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nofx/journal"
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// AlertType represents the kind of account alarm
+type AlertType string
+
+const (
+	// PermissionAlert is raised when the exchange rejects our account queries
+	PermissionAlert AlertType = "permission"
+	// DriftAlert is raised when a balance change is not explained by the journal
+	DriftAlert AlertType = "balance_drift"
+)
+
+// Alert represents an alarm raised by a monitor
+type Alert struct {
+	Type        AlertType `json:"type"`
+	Exchange    string    `json:"exchange,omitempty"`
+	Pair        string    `json:"currency_pair,omitempty"`
+	Currency    string    `json:"currency,omitempty"`
+	Expected    float64   `json:"expected"`
+	Actual      float64   `json:"actual"`
+	Unexplained float64   `json:"unexplained"`
+	Message     string    `json:"message"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// DriftMonitor periodically verifies that balance changes are fully explained
+// by the journal; deposits, withdrawals or trades placed by someone else
+// sharing our keys show up as unexplained drift
+type DriftMonitor struct {
+	trader    trader.Trader
+	journal   *journal.Journal
+	interval  time.Duration
+	tolerance float64
+
+	// OnAlert is called for every raised alert; defaults to logging a warning
+	OnAlert func(Alert)
+
+	mu       sync.Mutex
+	last     map[string]float64
+	lastTime time.Time
+	stop     chan struct{}
+}
+
+// NewDriftMonitor creates a new balance drift monitor
+func NewDriftMonitor(t trader.Trader, j *journal.Journal, interval time.Duration, tolerance float64) *DriftMonitor {
+	return &DriftMonitor{
+		trader:    t,
+		journal:   j,
+		interval:  interval,
+		tolerance: tolerance,
+		OnAlert: func(a Alert) {
+			logger.Warning("Account alarm [%s]: %s", a.Type, a.Message)
+		},
+	}
+}
+
+// Start begins periodic drift checks in the background
+func (m *DriftMonitor) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		m.Check(ctx)
+		for {
+			select {
+			case <-ticker.C:
+				m.Check(ctx)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts periodic drift checks
+func (m *DriftMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Check compares the current balances with the previous snapshot and raises an
+// alert for every currency whose change exceeds what the journal explains
+func (m *DriftMonitor) Check(ctx context.Context) []Alert {
+	now := time.Now()
+	balances, err := m.trader.GetBalance(ctx)
+	if err != nil {
+		alert := Alert{
+			Type:      PermissionAlert,
+			Message:   "failed to query account balance: " + err.Error(),
+			Timestamp: now,
+		}
+		m.OnAlert(alert)
+		return []Alert{alert}
+	}
+
+	// Unrealized PnL moves with the market and isn't journaled
+	current := make(map[string]float64, len(balances))
+	for _, b := range balances {
+		current[b.Currency] = b.Wallet()
+	}
+
+	m.mu.Lock()
+	previous, since := m.last, m.lastTime
+	m.last, m.lastTime = current, now
+	m.mu.Unlock()
+
+	// The first snapshot only establishes a baseline
+	if previous == nil {
+		return nil
+	}
+
+	currencies := make(map[string]struct{}, len(current))
+	for currency := range previous {
+		currencies[currency] = struct{}{}
+	}
+	for currency := range current {
+		currencies[currency] = struct{}{}
+	}
+
+	var alerts []Alert
+	for currency := range currencies {
+		actual := current[currency] - previous[currency]
+		expected := m.journal.Net(currency, since, now)
+		unexplained := actual - expected
+		if math.Abs(unexplained) <= m.tolerance {
+			continue
+		}
+
+		alert := Alert{
+			Type:        DriftAlert,
+			Currency:    currency,
+			Expected:    expected,
+			Actual:      actual,
+			Unexplained: unexplained,
+			Message: fmt.Sprintf("%s balance changed by %.8f but journal explains %.8f (unexplained %.8f)",
+				currency, actual, expected, unexplained),
+			Timestamp: now,
+		}
+		m.OnAlert(alert)
+		alerts = append(alerts, alert)
+	}
+
+	return alerts
+}
@@ -0,0 +1,238 @@
+package monitor
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// DustAction represents what happens to dust positions
+type DustAction string
+
+const (
+	// DustClose closes dust positions fully
+	DustClose DustAction = "close"
+	// DustMerge folds dust positions into the next entry on their pair
+	DustMerge DustAction = "merge"
+)
+
+// DustPosition represents a position below its contract's minimum quantity or notional
+type DustPosition struct {
+	Exchange   string      `json:"exchange"`
+	Pair       string      `json:"currency_pair"`
+	Side       trader.Side `json:"side"`
+	Size       float64     `json:"size"`
+	Notional   float64     `json:"notional"`
+	DetectedAt time.Time   `json:"detected_at"`
+	// Closed is set once the position was closed by the cleanup
+	Closed bool   `json:"closed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DustCleaner detects positions that fell below their contract's minimums,
+// which can't be reduced normally, and closes them fully or, in merge mode,
+// folds them into the next entry on their pair: an entry on the same side
+// absorbs the dust, and one on the opposite side is enlarged to close it.
+type DustCleaner struct {
+	traders   *trader.Manager
+	contracts trader.ContractSource
+	action    DustAction
+	interval  time.Duration
+
+	mu      sync.Mutex
+	pending map[string]DustPosition
+	stop    chan struct{}
+}
+
+// NewDustCleaner creates a new dust cleaner
+func NewDustCleaner(traders *trader.Manager, contracts trader.ContractSource, action DustAction, interval time.Duration) *DustCleaner {
+	return &DustCleaner{
+		traders:   traders,
+		contracts: contracts,
+		action:    action,
+		interval:  interval,
+		pending:   make(map[string]DustPosition),
+	}
+}
+
+// Start begins checking for dust in the background
+func (c *DustCleaner) Start() {
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.stop = make(chan struct{})
+	stop := c.stop
+	c.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.Check(ctx)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the checks
+func (c *DustCleaner) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// Check finds the dust positions on every exchange and closes them, or in
+// merge mode keeps them pending for the next entry
+func (c *DustCleaner) Check(ctx context.Context) []DustPosition {
+	var found []DustPosition
+	for _, name := range c.traders.Names() {
+		t, err := c.traders.Get(name)
+		if err != nil {
+			continue
+		}
+		positions, err := t.GetPositions(ctx)
+		if err != nil {
+			logger.Warning("Failed to get positions on %s for dust cleanup: %v", name, err)
+			continue
+		}
+
+		open := make(map[string]bool)
+		for _, p := range positions {
+			contract, err := c.contracts.Get(p.Pair)
+			if err != nil || !trader.IsDust(p, contract) {
+				continue
+			}
+			size := contract.ContractSize
+			if size <= 0 {
+				size = 1
+			}
+			dust := DustPosition{
+				Exchange:   name,
+				Pair:       p.Pair,
+				Side:       p.Side,
+				Size:       p.Size,
+				Notional:   p.Size * p.MarkPrice * size,
+				DetectedAt: time.Now(),
+			}
+			key := dustKey(name, p.Pair)
+			open[key] = true
+
+			if c.action == DustMerge {
+				c.mu.Lock()
+				if known, ok := c.pending[key]; ok {
+					dust.DetectedAt = known.DetectedAt
+				} else {
+					logger.Info("Dust position %s %s (%v) on %s will merge into the next entry", p.Pair, p.Side, p.Size, name)
+				}
+				c.pending[key] = dust
+				c.mu.Unlock()
+			} else if _, err := t.ClosePosition(ctx, p.Pair, p.Size); err != nil {
+				dust.Error = err.Error()
+				logger.Warning("Failed to close dust position %s %s on %s: %v", p.Pair, p.Side, name, err)
+			} else {
+				dust.Closed = true
+				logger.Info("Closed dust position %s %s (%v) on %s", p.Pair, p.Side, p.Size, name)
+			}
+			found = append(found, dust)
+		}
+
+		// Forget dust positions of this exchange closed or grown since
+		c.mu.Lock()
+		for key, dust := range c.pending {
+			if dust.Exchange == name && !open[key] {
+				delete(c.pending, key)
+			}
+		}
+		c.mu.Unlock()
+	}
+	return found
+}
+
+// Pending returns the dust positions waiting to merge into an entry
+func (c *DustCleaner) Pending() []DustPosition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending := make([]DustPosition, 0, len(c.pending))
+	for _, dust := range c.pending {
+		pending = append(pending, dust)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].DetectedAt.Before(pending[j].DetectedAt) })
+	return pending
+}
+
+// Merge returns the amount of an entry on a pair folding in its pending dust
+// position: an entry on the opposite side is enlarged to close the dust
+func (c *DustCleaner) Merge(exchange, pair string, side trader.Side, amount float64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := dustKey(exchange, pair)
+	dust, ok := c.pending[key]
+	if !ok {
+		return amount
+	}
+	delete(c.pending, key)
+	if dust.Side != side {
+		logger.Info("Merging dust %s %s (%v) on %s into the %s entry", pair, dust.Side, dust.Size, exchange, side)
+		return amount + dust.Size
+	}
+	return amount
+}
+
+// Wrap returns a trader folding pending dust into the orders placed through t
+func (c *DustCleaner) Wrap(exchange string, t trader.Trader) trader.Trader {
+	return &dustMerger{Trader: t, exchange: exchange, cleaner: c}
+}
+
+// dustKey identifies a position by exchange and pair
+func dustKey(exchange, pair string) string {
+	return exchange + "|" + pair
+}
+
+// dustMerger wraps a Trader and folds pending dust into new orders
+type dustMerger struct {
+	trader.Trader
+	exchange string
+	cleaner  *DustCleaner
+}
+
+// CreateOrder places the order enlarged by any opposite dust on its pair;
+// reduce-only orders are placed unchanged, since dust only folds into
+// orders opening a position
+func (m *dustMerger) CreateOrder(ctx context.Context, req trader.OrderRequest) (*trader.Order, error) {
+	if !req.ReduceOnly {
+		req.Amount = m.cleaner.Merge(m.exchange, req.Pair, req.Side, req.Amount)
+	}
+	return m.Trader.CreateOrder(ctx, req)
+}
+
+// PositionMode returns the position mode of the wrapped trader's account
+func (m *dustMerger) PositionMode(ctx context.Context) (trader.PositionMode, error) {
+	return trader.GetPositionMode(ctx, m.Trader)
+}
+
+// GetTransfers lists the account's deposits and withdrawals through the
+// wrapped trader
+func (m *dustMerger) GetTransfers(ctx context.Context, since time.Time) ([]trader.Transfer, error) {
+	return trader.GetTransfers(ctx, m.Trader, since)
+}
+
+// GetOrderByClientID looks an order up by its client order ID through the
+// wrapped trader
+func (m *dustMerger) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*trader.Order, error) {
+	return trader.GetOrderByClientID(ctx, m.Trader, pair, clientOrderID)
+}
@@ -0,0 +1,230 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+const (
+	// FlattenWarningAlert is raised ahead of the end-of-day flatten
+	FlattenWarningAlert AlertType = "flatten_warning"
+	// FlattenAlert is raised when the end-of-day flatten failed to close a position
+	FlattenAlert AlertType = "flatten"
+)
+
+// flattenGrace is how late a scheduled flatten or warning may still fire,
+// so a restart after the close time doesn't flatten immediately
+const flattenGrace = 2 * time.Minute
+
+// Flattener closes positions on every exchange at a fixed UTC time of day,
+// for intraday-only systems, warning ahead of the close
+type Flattener struct {
+	traders    *trader.Manager
+	guard      *trader.SlippageGuard
+	at         time.Duration
+	warnings   []time.Duration
+	strategies map[string]bool
+
+	// OnAlert is called for every raised alert; defaults to logging a warning
+	OnAlert func(Alert)
+
+	mu    sync.Mutex
+	fired map[time.Duration]string
+	stop  chan struct{}
+}
+
+// NewFlattener creates a new flattener closing positions at the given offset
+// from UTC midnight, warning the given durations ahead; when strategies are
+// given, only positions tagged with one of them are closed
+func NewFlattener(traders *trader.Manager, guard *trader.SlippageGuard, at time.Duration, warnings []time.Duration, strategies []string) *Flattener {
+	f := &Flattener{
+		traders:  traders,
+		guard:    guard,
+		at:       at,
+		warnings: warnings,
+		fired:    make(map[time.Duration]string),
+		OnAlert: func(a Alert) {
+			logger.Warning("Flatten alarm [%s]: %s", a.Type, a.Message)
+		},
+	}
+	if len(strategies) > 0 {
+		f.strategies = make(map[string]bool, len(strategies))
+		for _, s := range strategies {
+			f.strategies[s] = true
+		}
+	}
+	return f
+}
+
+// Start begins checking the schedule in the background
+func (f *Flattener) Start() {
+	f.mu.Lock()
+	if f.stop != nil {
+		f.mu.Unlock()
+		return
+	}
+	f.stop = make(chan struct{})
+	stop := f.stop
+	f.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				f.Check(ctx, now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the schedule
+func (f *Flattener) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+}
+
+// Check raises warnings and flattens when their time of day has come; each
+// fires at most once a day. A flatten failing to close a position is tried
+// again on the next check within flattenGrace.
+func (f *Flattener) Check(ctx context.Context, now time.Time) {
+	now = now.UTC()
+	day := now.Format("2006-01-02")
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	due := func(lead time.Duration) bool {
+		offset := f.at - lead
+		if offset < 0 {
+			offset += 24 * time.Hour
+		}
+		at := midnight.Add(offset)
+		if now.Before(at) || now.Sub(at) >= flattenGrace {
+			return false
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.fired[lead] != day
+	}
+	fired := func(lead time.Duration) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.fired[lead] = day
+	}
+
+	for _, lead := range f.warnings {
+		if lead > 0 && due(lead) {
+			fired(lead)
+			f.warn(ctx, lead)
+		}
+	}
+	if due(0) {
+		if _, ok := f.flatten(ctx); ok {
+			fired(0)
+		}
+	}
+}
+
+// warn raises a warning listing the positions the flatten will close
+func (f *Flattener) warn(ctx context.Context, lead time.Duration) {
+	var open []string
+	for _, name := range f.traders.Names() {
+		positions, err := f.positions(ctx, name)
+		if err != nil {
+			logger.Warning("Failed to get positions on %s before flatten: %v", name, err)
+			continue
+		}
+		for _, p := range positions {
+			open = append(open, name+":"+p.Pair)
+		}
+	}
+	if len(open) == 0 {
+		return
+	}
+	sort.Strings(open)
+
+	f.OnAlert(Alert{
+		Type:      FlattenWarningAlert,
+		Message:   fmt.Sprintf("End-of-day flatten in %s will close %d positions: %s", lead, len(open), strings.Join(open, ", ")),
+		Timestamp: time.Now(),
+	})
+}
+
+// Flatten closes the selected positions on every exchange now
+func (f *Flattener) Flatten(ctx context.Context) map[string][]trader.CloseResult {
+	results, _ := f.flatten(ctx)
+	return results
+}
+
+// flatten closes the selected positions on every exchange, alerting on
+// failures, and reports whether there were none
+func (f *Flattener) flatten(ctx context.Context) (map[string][]trader.CloseResult, bool) {
+	results := make(map[string][]trader.CloseResult)
+	ok := true
+	for _, name := range f.traders.Names() {
+		positions, err := f.positions(ctx, name)
+		if err != nil {
+			ok = false
+			f.OnAlert(Alert{
+				Type:      FlattenAlert,
+				Message:   fmt.Sprintf("Failed to get positions on %s for flatten: %v", name, err),
+				Timestamp: time.Now(),
+			})
+			continue
+		}
+		if len(positions) == 0 {
+			continue
+		}
+
+		t, _ := f.traders.Get(name)
+		results[name] = trader.CloseBatch(ctx, t, positions, trader.CloseFilter{}, f.guard)
+		for _, r := range results[name] {
+			if r.Error != "" {
+				ok = false
+				f.OnAlert(Alert{
+					Type:      FlattenAlert,
+					Pair:      r.Pair,
+					Message:   fmt.Sprintf("Failed to flatten %s %s on %s: %s", r.Pair, r.Side, name, r.Error),
+					Timestamp: time.Now(),
+				})
+			}
+		}
+		logger.Info("End-of-day flatten processed %d positions on %s", len(positions), name)
+	}
+	return results, ok
+}
+
+// positions returns the open positions of an exchange selected for flattening
+func (f *Flattener) positions(ctx context.Context, name string) ([]trader.Position, error) {
+	t, err := f.traders.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	all, err := t.GetPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []trader.Position
+	for _, p := range all {
+		if p.Size != 0 && (f.strategies == nil || f.strategies[p.Strategy]) {
+			selected = append(selected, p)
+		}
+	}
+	return selected, nil
+}
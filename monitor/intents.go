@@ -0,0 +1,466 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/trader"
+)
+
+// ConditionType represents what an intent waits for
+type ConditionType string
+
+const (
+	// PriceAbove triggers as soon as the last price trades at or above the level
+	PriceAbove ConditionType = "price_above"
+	// PriceBelow triggers as soon as the last price trades at or below the level
+	PriceBelow ConditionType = "price_below"
+	// CloseAbove triggers when a candle of the interval closes above the level
+	CloseAbove ConditionType = "close_above"
+	// CloseBelow triggers when a candle of the interval closes below the level
+	CloseBelow ConditionType = "close_below"
+)
+
+// IntentStatus represents the lifecycle of a trade intent: pending until its
+// condition is met, then triggered, or failed when the entry was refused;
+// canceled or expired when it never triggered
+type IntentStatus string
+
+const (
+	IntentPending   IntentStatus = "pending"
+	IntentTriggered IntentStatus = "triggered"
+	IntentFailed    IntentStatus = "failed"
+	IntentCanceled  IntentStatus = "canceled"
+	IntentExpired   IntentStatus = "expired"
+)
+
+// maxFinishedIntents bounds the history of intents no longer pending
+const maxFinishedIntents = 200
+
+// ErrIntentNotFound is returned for an unknown intent ID
+var ErrIntentNotFound = errors.New("trade intent not found")
+
+// Condition represents the market condition an intent waits for; Interval is
+// the candle interval of close conditions, e.g. "4h"
+type Condition struct {
+	Type     ConditionType `json:"type"`
+	Price    float64       `json:"price"`
+	Interval string        `json:"interval,omitempty"`
+}
+
+// String describes the condition, e.g. "close_above 4000 on 4h"
+func (c Condition) String() string {
+	s := string(c.Type) + " " + strconv.FormatFloat(c.Price, 'f', -1, 64)
+	if c.Interval != "" {
+		s += " on " + c.Interval
+	}
+	return s
+}
+
+// Intent represents a queued trade: a market entry of Notional settle
+// currency placed once its condition is met, unless it expires first
+type Intent struct {
+	ID        string       `json:"id"`
+	Exchange  string       `json:"exchange"`
+	Pair      string       `json:"currency_pair"`
+	Side      trader.Side  `json:"side"`
+	Notional  float64      `json:"notional"`
+	Leverage  int64        `json:"leverage"`
+	Strategy  string       `json:"strategy,omitempty"`
+	Condition Condition    `json:"condition"`
+	Status    IntentStatus `json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	// DelayedUntil is when an intent whose condition was met enters, held
+	// back so the position doesn't pay the funding in between
+	DelayedUntil *time.Time `json:"delayed_until,omitempty"`
+	// Price is the market price the intent triggered at and OrderID its entry
+	Price         float64 `json:"price,omitempty"`
+	OrderID       string  `json:"order_id,omitempty"`
+	ClientOrderID string  `json:"client_order_id,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// CandleSource provides recent candles, typically the market client
+type CandleSource interface {
+	GetCandles(ctx context.Context, pair, interval string, limit int) ([]market.CandleData, error)
+}
+
+// IntentMonitor holds trade intents ("long ETH 500 USDT if price closes above
+// 4000 on 4h") and enters them through the traders, and so the risk guard,
+// once their condition is met. Close conditions only consider candles closed
+// after the intent was created. Entries are tagged with the intent's strategy
+// and recorded in the order registry under the intent's ID; an entry that
+// would pay the upcoming funding waits until after it as the strategy's
+// funding policy requires.
+type IntentMonitor struct {
+	traders   *trader.Manager
+	prices    PriceSource
+	candles   CandleSource
+	contracts trader.ContractSource
+	funding   FundingTimer
+	tag       *trader.OrderTag
+	orders    *trader.OrderRegistry
+	interval  time.Duration
+
+	mu      sync.Mutex
+	intents map[string]*Intent
+	stop    chan struct{}
+}
+
+// NewIntentMonitor creates a new trade intent monitor; funding may be nil to
+// enter as soon as a condition is met
+func NewIntentMonitor(traders *trader.Manager, prices PriceSource, candles CandleSource, contracts trader.ContractSource,
+	funding FundingTimer, tag *trader.OrderTag, orders *trader.OrderRegistry, interval time.Duration) *IntentMonitor {
+	return &IntentMonitor{
+		traders:   traders,
+		prices:    prices,
+		candles:   candles,
+		contracts: contracts,
+		funding:   funding,
+		tag:       tag,
+		orders:    orders,
+		interval:  interval,
+		intents:   make(map[string]*Intent),
+	}
+}
+
+// Add queues an intent expiring after ttl
+func (m *IntentMonitor) Add(intent Intent, ttl time.Duration) (Intent, error) {
+	if _, err := m.traders.Get(intent.Exchange); err != nil {
+		return Intent{}, err
+	}
+	if intent.Pair == "" || (intent.Side != trader.BuySide && intent.Side != trader.SellSide) {
+		return Intent{}, errors.New("currency_pair and a buy or sell side are required")
+	}
+	if intent.Notional <= 0 {
+		return Intent{}, errors.New("notional must be positive")
+	}
+	if intent.Condition.Price <= 0 {
+		return Intent{}, errors.New("condition price must be positive")
+	}
+	switch intent.Condition.Type {
+	case PriceAbove, PriceBelow:
+		intent.Condition.Interval = ""
+	case CloseAbove, CloseBelow:
+		if _, err := market.IntervalSeconds(intent.Condition.Interval); err != nil {
+			return Intent{}, fmt.Errorf("condition interval: %v", err)
+		}
+	default:
+		return Intent{}, fmt.Errorf("unknown condition type %q", intent.Condition.Type)
+	}
+	if ttl <= 0 {
+		return Intent{}, errors.New("ttl must be positive")
+	}
+
+	now := time.Now()
+	intent.ID = strconv.FormatInt(now.UnixNano(), 36)
+	intent.Status = IntentPending
+	intent.CreatedAt, intent.UpdatedAt = now, now
+	intent.ExpiresAt = now.Add(ttl)
+	intent.Price, intent.OrderID, intent.ClientOrderID, intent.Error = 0, "", "", ""
+	intent.DelayedUntil = nil
+
+	m.mu.Lock()
+	m.intents[intent.ID] = &intent
+	m.mu.Unlock()
+
+	logger.Info("Queued trade intent %s: %s %s %.2f on %s when %s, expiring %s",
+		intent.ID, intent.Side, intent.Pair, intent.Notional, intent.Exchange, intent.Condition, intent.ExpiresAt.Format(time.RFC3339))
+	return intent, nil
+}
+
+// Cancel cancels a pending intent
+func (m *IntentMonitor) Cancel(id string) (Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	intent, ok := m.intents[id]
+	if !ok {
+		return Intent{}, ErrIntentNotFound
+	}
+	if intent.Status != IntentPending {
+		return *intent, fmt.Errorf("trade intent %s is already %s", id, intent.Status)
+	}
+	m.finish(intent, IntentCanceled, time.Now())
+	logger.Info("Canceled trade intent %s", id)
+	return *intent, nil
+}
+
+// Intent returns an intent by ID
+func (m *IntentMonitor) Intent(id string) (Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	intent, ok := m.intents[id]
+	if !ok {
+		return Intent{}, ErrIntentNotFound
+	}
+	return *intent, nil
+}
+
+// Intents returns a copy of all intents, oldest first
+func (m *IntentMonitor) Intents() []Intent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	intents := make([]Intent, 0, len(m.intents))
+	for _, intent := range m.intents {
+		intents = append(intents, *intent)
+	}
+	sort.Slice(intents, func(i, j int) bool { return intents[i].CreatedAt.Before(intents[j].CreatedAt) })
+	return intents
+}
+
+// Start begins evaluating intents in the background
+func (m *IntentMonitor) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.Check(ctx)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts evaluating intents
+func (m *IntentMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Check expires the pending intents past their TTL and enters those whose
+// condition is met, or whose entry delay is over
+func (m *IntentMonitor) Check(ctx context.Context) {
+	now := time.Now()
+	for _, intent := range m.Intents() {
+		if intent.Status != IntentPending {
+			continue
+		}
+		if intent.DelayedUntil != nil {
+			// The condition was met; the entry waits out the funding
+			if now.Before(*intent.DelayedUntil) {
+				continue
+			}
+			price, err := m.prices.Price(intent.Pair)
+			if err != nil {
+				logger.Warning("Failed to price the delayed trade intent %s on %s: %v", intent.ID, intent.Pair, err)
+				continue
+			}
+			m.trigger(ctx, intent, price)
+			continue
+		}
+		if !now.Before(intent.ExpiresAt) {
+			if m.transition(intent.ID, func(i *Intent) { m.finish(i, IntentExpired, now) }) {
+				logger.Info("Trade intent %s expired before %s", intent.ID, intent.Condition)
+			}
+			continue
+		}
+
+		price, met, err := m.evaluate(ctx, intent, now)
+		if err != nil {
+			logger.Warning("Failed to evaluate trade intent %s on %s: %v", intent.ID, intent.Pair, err)
+			continue
+		}
+		if !met {
+			continue
+		}
+		if delay := m.entryDelay(intent, now); delay > 0 {
+			until := now.Add(delay)
+			if m.transition(intent.ID, func(i *Intent) { i.DelayedUntil, i.Price = &until, price }) {
+				logger.Info("Trade intent %s met %s at %v, entering after funding at %s",
+					intent.ID, intent.Condition, price, until.Format(time.RFC3339))
+			}
+			continue
+		}
+		m.trigger(ctx, intent, price)
+	}
+	m.prune()
+}
+
+// entryDelay returns how long the entry of an intent should wait so it
+// doesn't pay the upcoming funding
+func (m *IntentMonitor) entryDelay(intent Intent, now time.Time) time.Duration {
+	if m.funding == nil {
+		return 0
+	}
+	delay, err := m.funding.EntryDelay(intent.Strategy, intent.Pair, intent.Side, now)
+	if err != nil {
+		logger.Warning("Failed to time trade intent %s around funding: %v", intent.ID, err)
+		return 0
+	}
+	return delay
+}
+
+// evaluate reports whether an intent's condition is met, with the price it
+// was met at
+func (m *IntentMonitor) evaluate(ctx context.Context, intent Intent, now time.Time) (float64, bool, error) {
+	c := intent.Condition
+	switch c.Type {
+	case PriceAbove, PriceBelow:
+		price, err := m.prices.Price(intent.Pair)
+		if err != nil {
+			return 0, false, err
+		}
+		if c.Type == PriceAbove {
+			return price, price >= c.Price, nil
+		}
+		return price, price <= c.Price, nil
+	}
+
+	step, err := market.IntervalSeconds(c.Interval)
+	if err != nil {
+		return 0, false, err
+	}
+	candles, err := m.candles.GetCandles(ctx, intent.Pair, c.Interval, 2)
+	if err != nil {
+		return 0, false, err
+	}
+	// The latest candle may still be open
+	for i := len(candles) - 1; i >= 0; i-- {
+		closed := time.Unix(candles[i].Timestamp+step, 0)
+		if closed.After(now) {
+			continue
+		}
+		if !closed.After(intent.CreatedAt) {
+			return 0, false, nil
+		}
+		last := candles[i].Close
+		if c.Type == CloseAbove {
+			return last, last > c.Price, nil
+		}
+		return last, last < c.Price, nil
+	}
+	return 0, false, nil
+}
+
+// trigger places the market entry of an intent whose condition is met
+func (m *IntentMonitor) trigger(ctx context.Context, intent Intent, price float64) {
+	// Claim the intent first, so a concurrent cancel can't race the entry
+	if !m.transition(intent.ID, func(i *Intent) { i.Status, i.Price = IntentTriggered, price }) {
+		return
+	}
+	logger.Info("Trade intent %s triggered: %s met at %v", intent.ID, intent.Condition, price)
+
+	order, err := m.enter(ctx, intent, price)
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := m.intents[intent.ID]
+	if err != nil {
+		current.Error = err.Error()
+		m.finish(current, IntentFailed, now)
+		logger.Error("Trade intent %s failed to enter %s %s: %v", intent.ID, intent.Side, intent.Pair, err)
+		return
+	}
+	current.OrderID, current.ClientOrderID, current.UpdatedAt = order.ID, order.ClientOrderID, now
+	logger.Info("Trade intent %s entered %s %s with order %s", intent.ID, intent.Side, intent.Pair, order.ID)
+}
+
+// enter places a market order of the intent's notional at price
+func (m *IntentMonitor) enter(ctx context.Context, intent Intent, price float64) (*trader.Order, error) {
+	t, err := m.traders.Get(intent.Exchange)
+	if err != nil {
+		return nil, err
+	}
+	if price <= 0 {
+		if price, err = m.prices.Price(intent.Pair); err != nil {
+			return nil, err
+		}
+	}
+
+	unit, step := price, 0.0
+	if m.contracts != nil {
+		contract, err := m.contracts.Get(intent.Pair)
+		if err != nil {
+			return nil, err
+		}
+		unit, step = trader.QuoteNotional(contract, 1, price), contract.QuantityStep
+	}
+	amount := trader.FloorToStep(intent.Notional/unit, step)
+	if amount <= 0 {
+		return nil, fmt.Errorf("notional %.2f is below one contract of %s", intent.Notional, intent.Pair)
+	}
+
+	ctx = trader.WithClientOrder(ctx, m.tag, m.orders, trader.ClientOrder{
+		Exchange: intent.Exchange,
+		Strategy: intent.Strategy,
+		Intent:   "intent:" + intent.ID,
+	})
+	order, err := t.CreateOrder(ctx, trader.OrderRequest{
+		Pair:     intent.Pair,
+		Side:     intent.Side,
+		Type:     trader.MarketOrder,
+		Amount:   amount,
+		Leverage: intent.Leverage,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, errors.New("exchange returned no order")
+	}
+	return order, nil
+}
+
+// transition applies fn to a pending intent, reporting whether it was pending
+func (m *IntentMonitor) transition(id string, fn func(*Intent)) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	intent, ok := m.intents[id]
+	if !ok || intent.Status != IntentPending {
+		return false
+	}
+	fn(intent)
+	intent.UpdatedAt = time.Now()
+	return true
+}
+
+// finish moves an intent to a final status; the caller must hold mu
+func (m *IntentMonitor) finish(intent *Intent, status IntentStatus, now time.Time) {
+	intent.Status, intent.UpdatedAt = status, now
+}
+
+// prune forgets the oldest finished intents beyond maxFinishedIntents
+func (m *IntentMonitor) prune() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var finished []*Intent
+	for _, intent := range m.intents {
+		if intent.Status != IntentPending {
+			finished = append(finished, intent)
+		}
+	}
+	if len(finished) <= maxFinishedIntents {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].UpdatedAt.Before(finished[j].UpdatedAt) })
+	for _, intent := range finished[:len(finished)-maxFinishedIntents] {
+		delete(m.intents, intent.ID)
+	}
+}
@@ -0,0 +1,271 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+const (
+	// LossAlert is raised when a position's unrealized loss crosses its threshold
+	LossAlert AlertType = "unrealized_loss"
+	// LiquidationAlert is raised when the mark price of a position comes
+	// within the liquidation distance of its liquidation price
+	LiquidationAlert AlertType = "liquidation_risk"
+	// AuthAlert is raised when an exchange rejects our API credentials
+	AuthAlert AlertType = "exchange_auth"
+)
+
+// PnLThreshold represents the unrealized loss at which a position raises an
+// alert, as an amount of settle currency or a percentage of the position
+// margin; 0 disables either
+type PnLThreshold struct {
+	LossAmount  float64 `json:"loss_amount"`
+	LossPercent float64 `json:"loss_percent"`
+}
+
+// PnLThresholds represents the global threshold and per-position overrides
+// keyed by currency pair, and the distance of the mark price from the
+// liquidation price, as a percentage of the mark price, at which positions
+// alert; 0 disables it
+type PnLThresholds struct {
+	Global              PnLThreshold            `json:"global"`
+	Positions           map[string]PnLThreshold `json:"positions"`
+	LiquidationDistance float64                 `json:"liquidation_distance"`
+}
+
+// MarketMonitor periodically evaluates the open positions on every exchange
+// against the unrealized loss thresholds and the liquidation distance. A
+// position alerts once when it crosses its threshold and again only after
+// recovering below it; an exchange rejecting our credentials alerts once
+// until it accepts them again.
+type MarketMonitor struct {
+	traders  *trader.Manager
+	interval time.Duration
+
+	// OnAlert is called for every raised alert; defaults to logging a warning
+	OnAlert func(Alert)
+
+	mu         sync.Mutex
+	thresholds PnLThresholds
+	breached   map[string]bool
+	stop       chan struct{}
+}
+
+// NewMarketMonitor creates a new market monitor
+func NewMarketMonitor(traders *trader.Manager, interval time.Duration, thresholds PnLThresholds) *MarketMonitor {
+	return &MarketMonitor{
+		traders:    traders,
+		interval:   interval,
+		thresholds: thresholds,
+		breached:   make(map[string]bool),
+		OnAlert: func(a Alert) {
+			logger.Warning("Position alarm [%s]: %s", a.Type, a.Message)
+		},
+	}
+}
+
+// Thresholds returns the current loss thresholds
+func (m *MarketMonitor) Thresholds() PnLThresholds {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.thresholds
+	t.Positions = make(map[string]PnLThreshold, len(m.thresholds.Positions))
+	for pair, threshold := range m.thresholds.Positions {
+		t.Positions[pair] = threshold
+	}
+	return t
+}
+
+// SetThresholds replaces the loss thresholds
+func (m *MarketMonitor) SetThresholds(t PnLThresholds) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.thresholds = t
+}
+
+// Start begins periodic checks in the background
+func (m *MarketMonitor) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.Check(ctx)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts periodic checks
+func (m *MarketMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Check evaluates every open position and raises an alert for each one that
+// newly crossed its loss threshold or liquidation distance
+func (m *MarketMonitor) Check(ctx context.Context) []Alert {
+	now := time.Now()
+	thresholds := m.Thresholds()
+	seen := make(map[string]bool)
+
+	var alerts []Alert
+	for _, name := range m.traders.Names() {
+		t, err := m.traders.Get(name)
+		if err != nil {
+			continue
+		}
+		positions, err := t.GetPositions(ctx)
+		if err != nil {
+			logger.Warning("Failed to get positions on %s for PnL alerts: %v", name, err)
+			// Keep the state of an exchange we couldn't check
+			m.mu.Lock()
+			for key := range m.breached {
+				if strings.HasPrefix(key, name+":") {
+					seen[key] = true
+				}
+			}
+			m.mu.Unlock()
+			if errors.Is(err, trader.ErrUnauthorized) {
+				key := name + ":auth"
+				seen[key] = true
+				if m.breach(key) {
+					alert := Alert{
+						Type:      AuthAlert,
+						Exchange:  name,
+						Message:   fmt.Sprintf("%s rejected the API credentials: %v", name, err),
+						Timestamp: now,
+					}
+					m.OnAlert(alert)
+					alerts = append(alerts, alert)
+				}
+			}
+			continue
+		}
+
+		for _, p := range positions {
+			if p.Size == 0 {
+				continue
+			}
+			if distance, ok := liquidationDistance(p); ok && thresholds.LiquidationDistance > 0 && distance <= thresholds.LiquidationDistance {
+				key := name + ":" + p.Pair + ":" + string(p.Side) + ":liquidation"
+				seen[key] = true
+				if m.breach(key) {
+					alert := Alert{
+						Type:     LiquidationAlert,
+						Exchange: name,
+						Pair:     p.Pair,
+						Expected: p.LiquidationPrice,
+						Actual:   p.MarkPrice,
+						Message: fmt.Sprintf("%s %s position on %s is %.2f%% from liquidation (mark %v, liquidation %v)",
+							p.Pair, p.Side, name, distance, p.MarkPrice, p.LiquidationPrice),
+						Timestamp: now,
+					}
+					m.OnAlert(alert)
+					alerts = append(alerts, alert)
+				}
+			}
+			threshold, ok := thresholds.Positions[p.Pair]
+			if !ok {
+				threshold = thresholds.Global
+			}
+
+			key := name + ":" + p.Pair + ":" + string(p.Side)
+			loss, percent := -p.UnrealizedPnl, lossPercent(p)
+			breached := (threshold.LossAmount > 0 && loss >= threshold.LossAmount) ||
+				(threshold.LossPercent > 0 && percent >= threshold.LossPercent)
+			if !breached {
+				continue
+			}
+			seen[key] = true
+			if !m.breach(key) {
+				continue
+			}
+
+			alert := Alert{
+				Type:     LossAlert,
+				Exchange: name,
+				Pair:     p.Pair,
+				Actual:   p.UnrealizedPnl,
+				Message: fmt.Sprintf("%s %s position on %s has unrealized loss %.2f (%.2f%% of margin)",
+					p.Pair, p.Side, name, loss, percent),
+				Timestamp: now,
+			}
+			m.OnAlert(alert)
+			alerts = append(alerts, alert)
+		}
+	}
+
+	// Positions that recovered or closed may alert again
+	m.mu.Lock()
+	for key := range m.breached {
+		if !seen[key] {
+			delete(m.breached, key)
+		}
+	}
+	m.mu.Unlock()
+
+	return alerts
+}
+
+// breach marks a position or exchange breached and reports whether it
+// newly is
+func (m *MarketMonitor) breach(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	already := m.breached[key]
+	m.breached[key] = true
+	return !already
+}
+
+// liquidationDistance returns the distance of a position's mark price from
+// its liquidation price as a percentage of the mark price, if both are known
+func liquidationDistance(p trader.Position) (float64, bool) {
+	if p.LiquidationPrice <= 0 || p.MarkPrice <= 0 {
+		return 0, false
+	}
+	return math.Abs(p.MarkPrice-p.LiquidationPrice) / p.MarkPrice * 100, true
+}
+
+// lossPercent returns the loss of a position as a percentage of its margin,
+// from the adverse price move scaled by leverage
+func lossPercent(p trader.Position) float64 {
+	if p.EntryPrice <= 0 || p.MarkPrice <= 0 {
+		return 0
+	}
+	move := (p.EntryPrice - p.MarkPrice) / p.EntryPrice
+	if p.Side == trader.SellSide {
+		move = -move
+	}
+	leverage := float64(p.Leverage)
+	if leverage <= 0 {
+		leverage = 1
+	}
+	return move * leverage * 100
+}
@@ -0,0 +1,268 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// trailingStep is the fraction of the callback distance the stop must gain
+// before it is moved, so small ticks don't churn orders
+const trailingStep = 0.2
+
+// PriceSource provides last prices, typically the screener
+type PriceSource interface {
+	Price(pair string) (float64, error)
+}
+
+// TrailingStop represents a client-side trailing stop; Side is the side of
+// the protected position and Extreme its best price since the stop was set
+type TrailingStop struct {
+	Exchange     string      `json:"exchange"`
+	Pair         string      `json:"currency_pair"`
+	Side         trader.Side `json:"side"`
+	Amount       float64     `json:"amount"`
+	CallbackRate float64     `json:"callback_rate"`
+	Extreme      float64     `json:"extreme_price"`
+	StopPrice    float64     `json:"stop_price"`
+	OrderID      string      `json:"order_id"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// key identifies a trailing stop by exchange and position
+func (s TrailingStop) key() string {
+	return s.Exchange + "|" + s.Pair + "|" + string(s.Side)
+}
+
+// trail returns the stop price callbackRate away from the extreme price
+func (s TrailingStop) trail() float64 {
+	if s.Side == trader.SellSide {
+		return s.Extreme * (1 + s.CallbackRate)
+	}
+	return s.Extreme * (1 - s.CallbackRate)
+}
+
+// TrailingMonitor emulates trailing stops on exchanges without native
+// support: it follows the price and moves a regular stop-loss order along
+// with the position's best price, placing the new stop before canceling the
+// old one so the position is never left unprotected
+type TrailingMonitor struct {
+	traders   *trader.Manager
+	prices    PriceSource
+	priceType trader.TriggerPriceType
+	interval  time.Duration
+
+	mu    sync.Mutex
+	stops map[string]*TrailingStop
+	stop  chan struct{}
+}
+
+// NewTrailingMonitor creates a new trailing stop emulator
+func NewTrailingMonitor(traders *trader.Manager, prices PriceSource, priceType trader.TriggerPriceType, interval time.Duration) *TrailingMonitor {
+	return &TrailingMonitor{
+		traders:   traders,
+		prices:    prices,
+		priceType: priceType,
+		interval:  interval,
+		stops:     make(map[string]*TrailingStop),
+	}
+}
+
+// Add places the initial stop of a trailing stop covering the whole position
+// of the given side, replacing an earlier trailing stop of the position
+func (m *TrailingMonitor) Add(ctx context.Context, exchange, pair string, side trader.Side, callbackRate float64) (TrailingStop, error) {
+	t, err := m.traders.Get(exchange)
+	if err != nil {
+		return TrailingStop{}, err
+	}
+	position, err := t.GetPosition(ctx, pair)
+	if err != nil {
+		return TrailingStop{}, err
+	}
+	if position == nil || position.Size == 0 || position.Side != side {
+		return TrailingStop{}, fmt.Errorf("no open %s position for %s", side, pair)
+	}
+	price, err := m.prices.Price(pair)
+	if err != nil {
+		return TrailingStop{}, err
+	}
+
+	s := TrailingStop{
+		Exchange:     exchange,
+		Pair:         pair,
+		Side:         side,
+		Amount:       position.Size,
+		CallbackRate: callbackRate,
+		Extreme:      price,
+	}
+	s.StopPrice = s.trail()
+	order, err := t.SetStopLoss(ctx, pair, side, s.Amount, s.StopPrice, m.priceType)
+	if err != nil {
+		return TrailingStop{}, err
+	}
+	if order == nil {
+		return TrailingStop{}, errors.New("exchange returned no order")
+	}
+	s.OrderID, s.UpdatedAt = order.ID, time.Now()
+
+	m.mu.Lock()
+	previous := m.stops[s.key()]
+	m.stops[s.key()] = &s
+	m.mu.Unlock()
+	if previous != nil {
+		m.cancel(ctx, t, *previous)
+	}
+
+	logger.Info("Trailing stop for %s %s on %s set at %.8f with callback %.4f", pair, side, exchange, s.StopPrice, callbackRate)
+	return s, nil
+}
+
+// Stops returns a copy of all emulated trailing stops
+func (m *TrailingMonitor) Stops() []TrailingStop {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stops := make([]TrailingStop, 0, len(m.stops))
+	for _, s := range m.stops {
+		stops = append(stops, *s)
+	}
+	return stops
+}
+
+// Start begins following prices in the background
+func (m *TrailingMonitor) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.Check(ctx)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts following prices
+func (m *TrailingMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Check moves every trailing stop whose position reached a better price and
+// forgets those whose position is closed
+func (m *TrailingMonitor) Check(ctx context.Context) {
+	positions := make(map[string]map[string]bool)
+	for _, s := range m.Stops() {
+		t, err := m.traders.Get(s.Exchange)
+		if err != nil {
+			continue
+		}
+
+		open, ok := positions[s.Exchange]
+		if !ok {
+			all, err := t.GetPositions(ctx)
+			if err != nil {
+				logger.Warning("Failed to get positions on %s for trailing stops: %v", s.Exchange, err)
+				continue
+			}
+			open = make(map[string]bool, len(all))
+			for _, p := range all {
+				if p.Size != 0 {
+					open[p.Pair+"|"+string(p.Side)] = true
+				}
+			}
+			positions[s.Exchange] = open
+		}
+		if !open[s.Pair+"|"+string(s.Side)] {
+			m.forget(s)
+			m.cancel(ctx, t, s)
+			logger.Info("Trailing stop for %s %s on %s ended, position closed", s.Pair, s.Side, s.Exchange)
+			continue
+		}
+
+		price, err := m.prices.Price(s.Pair)
+		if err != nil {
+			logger.Warning("Failed to get price of %s for trailing stop: %v", s.Pair, err)
+			continue
+		}
+		m.follow(ctx, t, s, price)
+	}
+}
+
+// follow moves a trailing stop when price improved its stop by at least a step
+func (m *TrailingMonitor) follow(ctx context.Context, t trader.Trader, s TrailingStop, price float64) {
+	better := price > s.Extreme
+	if s.Side == trader.SellSide {
+		better = price < s.Extreme
+	}
+	if !better {
+		return
+	}
+
+	moved := s
+	moved.Extreme = price
+	moved.StopPrice = moved.trail()
+	gain := moved.StopPrice - s.StopPrice
+	if s.Side == trader.SellSide {
+		gain = -gain
+	}
+	if gain < s.Extreme*s.CallbackRate*trailingStep {
+		m.update(s.key(), func(current *TrailingStop) { current.Extreme = price })
+		return
+	}
+
+	order, err := t.SetStopLoss(ctx, s.Pair, s.Side, s.Amount, moved.StopPrice, m.priceType)
+	if err != nil || order == nil {
+		logger.Warning("Failed to move trailing stop for %s %s on %s to %.8f: %v", s.Pair, s.Side, s.Exchange, moved.StopPrice, err)
+		return
+	}
+	moved.OrderID, moved.UpdatedAt = order.ID, time.Now()
+	m.update(s.key(), func(current *TrailingStop) { *current = moved })
+	m.cancel(ctx, t, s)
+	logger.Info("Trailing stop for %s %s on %s moved to %.8f", s.Pair, s.Side, s.Exchange, moved.StopPrice)
+}
+
+// update applies fn to a tracked trailing stop, if still tracked
+func (m *TrailingMonitor) update(key string, fn func(*TrailingStop)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if current, ok := m.stops[key]; ok {
+		fn(current)
+	}
+}
+
+// forget stops tracking a trailing stop
+func (m *TrailingMonitor) forget(s TrailingStop) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.stops, s.key())
+}
+
+// cancel cancels the stop order of a trailing stop, which may already be gone
+func (m *TrailingMonitor) cancel(ctx context.Context, t trader.Trader, s TrailingStop) {
+	if err := t.CancelOrder(ctx, s.OrderID); err != nil {
+		logger.Warning("Failed to cancel trailing stop order %s for %s: %v", s.OrderID, s.Pair, err)
+	}
+}
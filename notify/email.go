@@ -0,0 +1,252 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/config"
+	"github.com/nofx/logger"
+)
+
+// defaultEmailTemplate is the HTML body of event emails
+const defaultEmailTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, Helvetica, Arial, sans-serif; color: #222;">
+  <h2 style="color: {{.Color}}; margin-bottom: 4px;">{{.Title}}</h2>
+  <p style="color: #666; margin-top: 0;">{{.Severity}} · {{.Type}} · {{.Time}}</p>
+  <p style="font-size: 15px;">{{.Message}}</p>
+  {{- if .Fields}}
+  <table style="border-collapse: collapse;">
+    {{- range .Fields}}
+    <tr>
+      <td style="padding: 4px 12px 4px 0; color: #666;">{{.Name}}</td>
+      <td style="padding: 4px 0;"><b>{{.Value}}</b></td>
+    </tr>
+    {{- end}}
+  </table>
+  {{- end}}
+  <p style="color: #999; font-size: 12px;">Sent by nofx. Repeats of this event are held back for {{.Throttle}}.</p>
+</body>
+</html>
+`
+
+// emailField is a field of an event as rendered in emails
+type emailField struct {
+	Name  string
+	Value string
+}
+
+// emailData is the data of the email template
+type emailData struct {
+	Type     string
+	Severity string
+	Title    string
+	Message  string
+	Fields   []emailField
+	Time     string
+	Color    string
+	Throttle string
+}
+
+// EmailNotifier mails the events of a configured list of types as HTML over
+// SMTP with TLS. Repeats of an event, keyed by its type, exchange and pair,
+// are throttled so a flapping condition doesn't flood the inboxes.
+type EmailNotifier struct {
+	cfg      config.EmailConfig
+	events   map[string]bool
+	throttle time.Duration
+	body     *template.Template
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+// NewEmailNotifier creates a new SMTP notifier, parsing its body template
+func NewEmailNotifier(cfg config.EmailConfig) (*EmailNotifier, error) {
+	body := template.New("email")
+	var err error
+	if cfg.Template != "" {
+		body, err = template.ParseFiles(cfg.Template)
+	} else {
+		body, err = body.Parse(defaultEmailTemplate)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("email template: %w", err)
+	}
+
+	n := &EmailNotifier{
+		cfg:      cfg,
+		events:   make(map[string]bool, len(cfg.Events)),
+		throttle: time.Duration(cfg.Throttle) * time.Minute,
+		body:     body,
+		sent:     make(map[string]time.Time),
+	}
+	for _, event := range cfg.Events {
+		n.events[event] = true
+	}
+	return n, nil
+}
+
+// Name implements Notifier
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Accepts implements Filter, selecting the configured event types
+func (n *EmailNotifier) Accepts(e Event) bool {
+	return n.events[e.Type]
+}
+
+// throttleKey identifies repeats of an event
+func throttleKey(e Event) string {
+	return e.Type + "|" + e.Fields["exchange"] + "|" + e.Fields["pair"]
+}
+
+// Notify implements Notifier; a repeat of an event mailed less than the
+// throttle period ago is dropped
+func (n *EmailNotifier) Notify(ctx context.Context, e Event) error {
+	key := throttleKey(e)
+	n.mu.Lock()
+	last, mailed := n.sent[key]
+	if mailed && e.Time.Sub(last) < n.throttle {
+		n.mu.Unlock()
+		logger.Info("Throttled the %s email, last sent at %s", e.Type, last.Format(time.RFC3339))
+		return nil
+	}
+	n.sent[key] = e.Time
+	n.mu.Unlock()
+
+	msg, err := n.message(e)
+	if err == nil {
+		err = n.send(ctx, msg)
+	}
+	if err != nil {
+		// A failed email doesn't hold back the next attempt
+		n.mu.Lock()
+		if mailed {
+			n.sent[key] = last
+		} else {
+			delete(n.sent, key)
+		}
+		n.mu.Unlock()
+	}
+	return err
+}
+
+// message renders the MIME message of an event
+func (n *EmailNotifier) message(e Event) ([]byte, error) {
+	data := emailData{
+		Type:     e.Type,
+		Severity: strings.ToUpper(string(e.Severity)),
+		Title:    e.Title,
+		Message:  e.Message,
+		Time:     e.Time.UTC().Format("2006-01-02 15:04:05 UTC"),
+		Color:    fmt.Sprintf("#%06x", severityColors[e.Severity]),
+		Throttle: n.throttle.String(),
+	}
+	for _, name := range e.fieldNames() {
+		data.Fields = append(data.Fields, emailField{Name: name, Value: e.Fields[name]})
+	}
+	var html bytes.Buffer
+	if err := n.body.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("email template: %w", err)
+	}
+
+	var msg bytes.Buffer
+	subject := fmt.Sprintf("[nofx] %s: %s", data.Severity, e.Title)
+	fmt.Fprintf(&msg, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", e.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write(html.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// send delivers a message to the recipients, over implicit TLS or after
+// upgrading the connection with STARTTLS
+func (n *EmailNotifier) send(ctx context.Context, msg []byte) error {
+	addr := net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: n.cfg.Host, MinVersion: tls.VersionTLS12}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if n.cfg.TLS == "implicit" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if n.cfg.TLS != "implicit" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server doesn't support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if n.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	from, err := mail.ParseAddress(n.cfg.From)
+	if err != nil {
+		return err
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range n.cfg.To {
+		rcpt, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := c.Rcpt(rcpt.Address); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
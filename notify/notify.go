@@ -0,0 +1,184 @@
+package notify
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// sendTimeout bounds the delivery of an event to a channel
+const sendTimeout = 15 * time.Second
+
+// Severity represents how urgent an event is
+type Severity string
+
+// Event severities
+const (
+	Info     Severity = "info"
+	Warning  Severity = "warning"
+	Critical Severity = "critical"
+)
+
+// Severities lists the severities from the least to the most urgent
+var Severities = []Severity{Info, Warning, Critical}
+
+// Valid reports whether the severity is known
+func (s Severity) Valid() bool {
+	for _, severity := range Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// Event represents a notification: Type names the kind of event (an alert
+// type such as "balance_drift", or "kill_switch") and Fields its details
+type Event struct {
+	Type     string            `json:"type"`
+	Severity Severity          `json:"severity"`
+	Title    string            `json:"title"`
+	Message  string            `json:"message"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// fieldNames returns the names of the fields of an event, sorted
+func (e Event) fieldNames() []string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Notifier delivers events to a channel such as a chat webhook
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, e Event) error
+}
+
+// Filter is implemented by notifiers receiving only some of the events of
+// their severities
+type Filter interface {
+	Accepts(e Event) bool
+}
+
+// Delivery represents the outcome of sending an event to a channel
+type Delivery struct {
+	Channel string `json:"channel"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Channel represents a configured channel and the severities it receives
+type Channel struct {
+	Name       string     `json:"name"`
+	Severities []Severity `json:"severities"`
+}
+
+// route is a notifier and the severities it receives; none means all
+type route struct {
+	notifier   Notifier
+	severities map[Severity]bool
+}
+
+// Dispatcher fans events out to the notifiers receiving their severity.
+// Event types may be given a severity overriding the one they're raised
+// with.
+type Dispatcher struct {
+	mu        sync.RWMutex
+	routes    []route
+	overrides map[string]Severity
+}
+
+// NewDispatcher creates a new dispatcher; overrides sets the severity of
+// event types
+func NewDispatcher(overrides map[string]Severity) *Dispatcher {
+	return &Dispatcher{overrides: overrides}
+}
+
+// Add routes the events of severities, or of every severity when none are
+// given, to a notifier
+func (d *Dispatcher) Add(n Notifier, severities ...Severity) {
+	r := route{notifier: n}
+	if len(severities) > 0 {
+		r.severities = make(map[Severity]bool, len(severities))
+		for _, s := range severities {
+			r.severities[s] = true
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes = append(d.routes, r)
+}
+
+// Channels returns the channels and the severities they receive
+func (d *Dispatcher) Channels() []Channel {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	channels := make([]Channel, 0, len(d.routes))
+	for _, r := range d.routes {
+		c := Channel{Name: r.notifier.Name()}
+		for _, s := range Severities {
+			if r.severities == nil || r.severities[s] {
+				c.Severities = append(c.Severities, s)
+			}
+		}
+		channels = append(channels, c)
+	}
+	return channels
+}
+
+// Dispatch sends an event to its channels concurrently and returns the
+// outcome of each
+func (d *Dispatcher) Dispatch(ctx context.Context, e Event) []Delivery {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Title == "" {
+		e.Title = e.Type
+	}
+
+	d.mu.RLock()
+	if s, ok := d.overrides[e.Type]; ok {
+		e.Severity = s
+	}
+	var notifiers []Notifier
+	for _, r := range d.routes {
+		if r.severities != nil && !r.severities[e.Severity] {
+			continue
+		}
+		if f, ok := r.notifier.(Filter); ok && !f.Accepts(e) {
+			continue
+		}
+		notifiers = append(notifiers, r.notifier)
+	}
+	d.mu.RUnlock()
+
+	deliveries := make([]Delivery, len(notifiers))
+	var wg sync.WaitGroup
+	for i, n := range notifiers {
+		wg.Add(1)
+		go func(i int, n Notifier) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+			defer cancel()
+			deliveries[i] = Delivery{Channel: n.Name()}
+			if err := n.Notify(ctx, e); err != nil {
+				deliveries[i].Error = err.Error()
+				logger.Warning("Failed to send %s notification to %s: %v", e.Type, n.Name(), err)
+			}
+		}(i, n)
+	}
+	wg.Wait()
+	return deliveries
+}
+
+// Send dispatches an event in the background, so raising it never blocks
+func (d *Dispatcher) Send(e Event) {
+	go d.Dispatch(context.Background(), e)
+}
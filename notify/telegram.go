@@ -0,0 +1,248 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// telegramAPI is the base URL of the Telegram Bot API
+const telegramAPI = "https://api.telegram.org/bot"
+
+// telegramPollTimeout is how long a getUpdates long poll waits for messages
+const telegramPollTimeout = 30 * time.Second
+
+// telegramRetryDelay is the wait after a failed poll
+const telegramRetryDelay = 5 * time.Second
+
+// Command handles the arguments of a bot command and returns the reply
+type Command func(args []string) (string, error)
+
+// TelegramBot posts events to a Telegram chat and answers the commands,
+// such as /tag, sent from that chat; messages from other chats are ignored
+type TelegramBot struct {
+	token  string
+	chatID int64
+	client *http.Client
+
+	mu       sync.Mutex
+	commands map[string]Command
+	usage    map[string]string
+	stop     chan struct{}
+}
+
+// NewTelegramBot creates a new bot with the token issued by BotFather,
+// talking to one chat
+func NewTelegramBot(token string, chatID int64) *TelegramBot {
+	return &TelegramBot{
+		token:    token,
+		chatID:   chatID,
+		client:   &http.Client{Timeout: telegramPollTimeout + sendTimeout},
+		commands: make(map[string]Command),
+		usage:    make(map[string]string),
+	}
+}
+
+// Name implements Notifier
+func (b *TelegramBot) Name() string {
+	return "telegram"
+}
+
+// Notify implements Notifier, posting the event as a plain text message
+func (b *TelegramBot) Notify(ctx context.Context, e Event) error {
+	var text strings.Builder
+	fmt.Fprintf(&text, "[%s] %s\n%s", strings.ToUpper(string(e.Severity)), e.Title, e.Message)
+	for _, name := range e.fieldNames() {
+		fmt.Fprintf(&text, "\n%s: %s", name, e.Fields[name])
+	}
+	return b.send(ctx, text.String())
+}
+
+// Handle registers a command, e.g. "tag" for /tag, with its usage shown by
+// /help
+func (b *TelegramBot) Handle(name, usage string, cmd Command) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commands[name] = cmd
+	b.usage[name] = usage
+}
+
+// Start begins polling for commands
+func (b *TelegramBot) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop != nil {
+		return
+	}
+	b.stop = make(chan struct{})
+	stop := b.stop
+
+	go func() {
+		var offset int64
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			updates, err := b.updates(offset)
+			if err != nil {
+				logger.Warning("Failed to poll Telegram for commands: %v", err)
+				select {
+				case <-time.After(telegramRetryDelay):
+				case <-stop:
+					return
+				}
+				continue
+			}
+			for _, u := range updates {
+				offset = u.UpdateID + 1
+				if u.Message == nil {
+					continue
+				}
+				if u.Message.Chat.ID != b.chatID {
+					logger.Warning("Ignored a Telegram message from chat %d", u.Message.Chat.ID)
+					continue
+				}
+				b.command(u.Message.Text)
+			}
+		}
+	}()
+}
+
+// Stop halts polling for commands
+func (b *TelegramBot) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+}
+
+// telegramUpdate is an update returned by getUpdates
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// telegramResponse is the envelope of Bot API responses
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+// updates long polls the updates from offset on
+func (b *TelegramBot) updates(offset int64) ([]telegramUpdate, error) {
+	params := url.Values{
+		"offset":          {strconv.FormatInt(offset, 10)},
+		"timeout":         {strconv.Itoa(int(telegramPollTimeout / time.Second))},
+		"allowed_updates": {`["message"]`},
+	}
+	resp, err := b.client.Get(telegramAPI + b.token + "/getUpdates?" + params.Encode())
+	if err != nil {
+		return nil, redactToken(err, b.token)
+	}
+	defer resp.Body.Close()
+
+	var r telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	if !r.OK {
+		return nil, errors.New(r.Description)
+	}
+	var updates []telegramUpdate
+	return updates, json.Unmarshal(r.Result, &updates)
+}
+
+// command runs the command of a message and replies with its outcome
+func (b *TelegramBot) command(text string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return
+	}
+	// Commands in groups are addressed as /tag@botname
+	name, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+
+	b.mu.Lock()
+	cmd := b.commands[name]
+	b.mu.Unlock()
+
+	var reply string
+	if cmd == nil {
+		reply = b.help()
+	} else if out, err := cmd(fields[1:]); err != nil {
+		reply = "Error: " + err.Error()
+	} else {
+		reply = out
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	if err := b.send(ctx, reply); err != nil {
+		logger.Warning("Failed to answer the Telegram /%s command: %v", name, err)
+	}
+}
+
+// help lists the commands with their usage
+func (b *TelegramBot) help() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := make([]string, 0, len(b.usage))
+	for _, usage := range b.usage {
+		lines = append(lines, usage)
+	}
+	sort.Strings(lines)
+	return "Commands:\n" + strings.Join(lines, "\n")
+}
+
+// send posts a plain text message to the chat
+func (b *TelegramBot) send(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]interface{}{"chat_id": b.chatID, "text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", telegramAPI+b.token+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return redactToken(err, b.token)
+	}
+	defer resp.Body.Close()
+
+	var r telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if !r.OK {
+		return errors.New(r.Description)
+	}
+	return nil
+}
+
+// redactToken removes the bot token, part of every request URL, from an error
+func redactToken(err error, token string) error {
+	return errors.New(strings.ReplaceAll(err.Error(), token, "<token>"))
+}
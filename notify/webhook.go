@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// webhookClient is the HTTP client of the chat webhooks
+var webhookClient = &http.Client{Timeout: sendTimeout}
+
+// postJSON posts a JSON payload to a webhook URL
+func postJSON(ctx context.Context, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+}
+
+// severityColors are the colors events are shown with, as RGB
+var severityColors = map[Severity]int{
+	Info:     0x3498db,
+	Warning:  0xf1c40f,
+	Critical: 0xe74c3c,
+}
+
+// DiscordNotifier posts events to a Discord channel webhook as embeds
+type DiscordNotifier struct {
+	name     string
+	url      string
+	username string
+}
+
+// NewDiscordNotifier creates a new Discord notifier posting to a webhook URL
+// as username, or the webhook's name when empty
+func NewDiscordNotifier(name, url, username string) *DiscordNotifier {
+	return &DiscordNotifier{name: name, url: url, username: username}
+}
+
+// Name implements Notifier
+func (n *DiscordNotifier) Name() string {
+	return n.name
+}
+
+// discordField is a field of a Discord embed
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordEmbed is a Discord message embed
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Footer      struct {
+		Text string `json:"text"`
+	} `json:"footer"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Notify implements Notifier
+func (n *DiscordNotifier) Notify(ctx context.Context, e Event) error {
+	embed := discordEmbed{
+		Title:       e.Title,
+		Description: e.Message,
+		Color:       severityColors[e.Severity],
+		Timestamp:   e.Time.UTC().Format(time.RFC3339),
+	}
+	embed.Footer.Text = fmt.Sprintf("nofx · %s · %s", e.Severity, e.Type)
+	for _, name := range e.fieldNames() {
+		embed.Fields = append(embed.Fields, discordField{Name: name, Value: e.Fields[name], Inline: true})
+	}
+	return postJSON(ctx, n.url, struct {
+		Username string         `json:"username,omitempty"`
+		Embeds   []discordEmbed `json:"embeds"`
+	}{n.username, []discordEmbed{embed}})
+}
+
+// SlackNotifier posts events to a Slack incoming webhook as attachments
+type SlackNotifier struct {
+	name    string
+	url     string
+	channel string
+}
+
+// NewSlackNotifier creates a new Slack notifier posting to an incoming
+// webhook URL, in channel or the webhook's channel when empty
+func NewSlackNotifier(name, url, channel string) *SlackNotifier {
+	return &SlackNotifier{name: name, url: url, channel: channel}
+}
+
+// Name implements Notifier
+func (n *SlackNotifier) Name() string {
+	return n.name
+}
+
+// slackField is a field of a Slack attachment
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// slackAttachment is a Slack message attachment
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields,omitempty"`
+	Footer   string       `json:"footer"`
+	Ts       int64        `json:"ts"`
+}
+
+// Notify implements Notifier
+func (n *SlackNotifier) Notify(ctx context.Context, e Event) error {
+	attachment := slackAttachment{
+		Fallback: fmt.Sprintf("[%s] %s: %s", strings.ToUpper(string(e.Severity)), e.Title, e.Message),
+		Color:    fmt.Sprintf("#%06x", severityColors[e.Severity]),
+		Title:    e.Title,
+		Text:     e.Message,
+		Footer:   fmt.Sprintf("nofx · %s · %s", e.Severity, e.Type),
+		Ts:       e.Time.Unix(),
+	}
+	for _, name := range e.fieldNames() {
+		attachment.Fields = append(attachment.Fields, slackField{Title: name, Value: e.Fields[name], Short: true})
+	}
+	payload := map[string]interface{}{
+		"attachments": []slackAttachment{attachment},
+	}
+	if n.channel != "" {
+		payload["channel"] = n.channel
+	}
+	return postJSON(ctx, n.url, payload)
+}
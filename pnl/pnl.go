@@ -0,0 +1,534 @@
+package pnl
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/market"
+	"github.com/nofx/storage"
+	"github.com/nofx/trader"
+)
+
+// ledgerTTL is how long a replayed ledger is reused before the recorded
+// fills and funding payments are read again
+const ledgerTTL = 10 * time.Second
+
+// Period lengths of PnL aggregates
+const (
+	Day   = "day"
+	Week  = "week"
+	Month = "month"
+)
+
+// ContractSource provides the contract metadata of the pairs of each
+// exchange, used for contract sizes and fee rates
+type ContractSource interface {
+	Contract(exchange, pair string) (*market.ContractInfo, error)
+}
+
+// PriceSource provides the last price of a symbol, used to mark open lots
+type PriceSource interface {
+	Price(pair string) (float64, error)
+}
+
+// Trade represents a quantity of an entry lot closed by an exit fill. Fees
+// are the entry and exit fees of the quantity, Net the realized PnL after them.
+type Trade struct {
+	Exchange    string      `json:"exchange"`
+	Pair        string      `json:"currency_pair"`
+	Strategy    string      `json:"strategy,omitempty"`
+	Side        trader.Side `json:"side"`
+	Quantity    float64     `json:"quantity"`
+	EntryPrice  float64     `json:"entry_price"`
+	ExitPrice   float64     `json:"exit_price"`
+	Opened      time.Time   `json:"opened"`
+	Closed      time.Time   `json:"closed"`
+	Realized    float64     `json:"realized_pnl"`
+	Fees        float64     `json:"fees"`
+	Net         float64     `json:"net_pnl"`
+	ExitOrderID string      `json:"exit_order_id"`
+	// Settle is the currency of the PnL and fees of inverse contracts; it's
+	// empty for linear contracts, whose PnL is in the quote currency
+	Settle string `json:"settle,omitempty"`
+}
+
+// OpenPosition represents the open lots of a strategy on a pair, marked at
+// the last price
+type OpenPosition struct {
+	Exchange   string      `json:"exchange"`
+	Pair       string      `json:"currency_pair"`
+	Strategy   string      `json:"strategy,omitempty"`
+	Side       trader.Side `json:"side"`
+	Quantity   float64     `json:"quantity"`
+	EntryPrice float64     `json:"entry_price"`
+	MarkPrice  float64     `json:"mark_price"`
+	Unrealized float64     `json:"unrealized_pnl"`
+	Settle     string      `json:"settle,omitempty"`
+}
+
+// FillResult represents the estimated fee of a fill and the PnL it realized
+// closing earlier entries, before fees
+type FillResult struct {
+	Fee      float64 `json:"fee"`
+	Realized float64 `json:"realized_pnl"`
+}
+
+// Aggregate represents the PnL of a period: realized PnL of the trades
+// closed in it, the fees of its fills and the funding settled in it
+type Aggregate struct {
+	Period   string    `json:"period"`
+	Start    time.Time `json:"start"`
+	Realized float64   `json:"realized_pnl"`
+	Fees     float64   `json:"fees"`
+	Funding  float64   `json:"funding"`
+	Net      float64   `json:"net_pnl"`
+	Trades   int       `json:"trades"`
+}
+
+// add records the PnL of a trade, fill fee or funding payment
+func (a *Aggregate) add(realized, fees, funding float64, trades int) {
+	a.Realized += realized
+	a.Fees += fees
+	a.Funding += funding
+	a.Net = a.Realized - a.Fees + a.Funding
+	a.Trades += trades
+}
+
+// Summary represents the PnL over a range, its breakdown by period and the
+// unrealized PnL of the lots open now
+type Summary struct {
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Period     string         `json:"period"`
+	Total      Aggregate      `json:"total"`
+	Unrealized float64        `json:"unrealized_pnl"`
+	Open       []OpenPosition `json:"open"`
+	Periods    []Aggregate    `json:"periods"`
+}
+
+// lot is an open entry: a signed quantity, its price, when it was filled and
+// the fee paid per unit
+type lot struct {
+	qty   float64
+	price float64
+	time  time.Time
+	fee   float64
+}
+
+// position identifies the lots of a strategy on a pair
+type position struct {
+	exchange, pair, strategy string
+}
+
+// fee is a fee paid by a fill
+type fee struct {
+	exchange, pair, strategy string
+	amount                   float64
+	time                     time.Time
+}
+
+// ledger is the result of replaying the recorded fills
+type ledger struct {
+	trades  []Trade
+	fees    []fee
+	funding []storage.FundingPayment
+	open    map[position][]lot
+	// fills holds the result of every fill by ID
+	fills map[int64]FillResult
+	built time.Time
+}
+
+// Engine computes realized PnL trade by trade, matching exit fills with the
+// oldest entries of the same strategy first (FIFO), along with fees, funding
+// payments, the unrealized PnL of open lots and period aggregates. Fees are
+// estimated from the contract's taker fee rate. Funding payments are
+// recorded per position rather than per strategy, so they're left out when
+// filtering by strategy.
+type Engine struct {
+	store     *storage.Store
+	contracts ContractSource
+	prices    PriceSource
+	feeRate   float64
+
+	mu     sync.Mutex
+	ledger *ledger
+}
+
+// NewEngine creates a new PnL engine over the recorded history; feeRate is
+// the taker fee rate assumed when a contract doesn't report one
+func NewEngine(store *storage.Store, contracts ContractSource, prices PriceSource, feeRate float64) *Engine {
+	return &Engine{store: store, contracts: contracts, prices: prices, feeRate: feeRate}
+}
+
+// replay returns the ledger, replaying the recorded fills again once it's
+// older than ledgerTTL
+func (e *Engine) replay() (*ledger, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ledger != nil && time.Since(e.ledger.built) < ledgerTTL {
+		return e.ledger, nil
+	}
+
+	fills, err := e.store.Fills(storage.Query{})
+	if err != nil {
+		return nil, err
+	}
+	funding, err := e.store.FundingPayments(storage.Query{})
+	if err != nil {
+		return nil, err
+	}
+
+	l := &ledger{funding: funding, open: make(map[position][]lot), fills: make(map[int64]FillResult), built: time.Now()}
+	pairs := make(map[[2]string]terms)
+	// Fills come newest first; replay them oldest first
+	for i := len(fills) - 1; i >= 0; i-- {
+		f := fills[i]
+		if f.Price <= 0 || f.Amount <= 0 {
+			continue
+		}
+		key := [2]string{f.Exchange, f.Pair}
+		t, ok := pairs[key]
+		if !ok {
+			t = e.terms(f.Exchange, f.Pair)
+			pairs[key] = t
+		}
+		l.fill(f, t)
+	}
+	e.ledger = l
+	return l, nil
+}
+
+// fill applies a fill: it closes the oldest opposite lots first and opens a
+// lot with the remaining quantity
+func (l *ledger) fill(f storage.Fill, t terms) {
+	key := position{f.Exchange, f.Pair, f.Strategy}
+	qty := f.Amount
+	if f.Side == trader.SellSide {
+		qty = -qty
+	}
+	unitFee := t.notional(f.Price) * t.rate
+	l.fees = append(l.fees, fee{f.Exchange, f.Pair, f.Strategy, f.Amount * unitFee, f.Timestamp})
+	result := FillResult{Fee: f.Amount * unitFee}
+
+	lots := l.open[key]
+	for len(lots) > 0 && qty != 0 && (lots[0].qty > 0) != (qty > 0) {
+		entry := &lots[0]
+		closed := math.Min(math.Abs(qty), math.Abs(entry.qty))
+		side, realized := trader.BuySide, t.pnl(closed, entry.price, f.Price)
+		if entry.qty < 0 {
+			side, realized = trader.SellSide, -realized
+		}
+		fees := closed * (entry.fee + unitFee)
+		result.Realized += realized
+		l.trades = append(l.trades, Trade{
+			Exchange:    f.Exchange,
+			Pair:        f.Pair,
+			Strategy:    f.Strategy,
+			Side:        side,
+			Quantity:    closed,
+			EntryPrice:  entry.price,
+			ExitPrice:   f.Price,
+			Opened:      entry.time,
+			Closed:      f.Timestamp,
+			Realized:    realized,
+			Fees:        fees,
+			Net:         realized - fees,
+			ExitOrderID: f.OrderID,
+			Settle:      t.settle(),
+		})
+
+		if entry.qty > 0 {
+			entry.qty -= closed
+			qty += closed
+		} else {
+			entry.qty += closed
+			qty -= closed
+		}
+		if math.Abs(entry.qty) < 1e-12 {
+			lots = lots[1:]
+		}
+		if math.Abs(qty) < 1e-12 {
+			qty = 0
+		}
+	}
+	if qty != 0 {
+		lots = append(lots, lot{qty: qty, price: f.Price, time: f.Timestamp, fee: unitFee})
+	}
+	if len(lots) == 0 {
+		delete(l.open, key)
+	} else {
+		l.open[key] = lots
+	}
+	l.fills[f.ID] = result
+}
+
+// terms are the contract terms fills of a pair are priced with: the taker
+// fee rate, and the contract whose size quantities are counted in and
+// whose settle currency the PnL and fees of inverse pairs are in
+type terms struct {
+	rate     float64
+	contract *market.ContractInfo
+}
+
+// terms returns the contract terms of a pair of an exchange; without
+// contract metadata quantities are taken as units of the base currency
+func (e *Engine) terms(exchange, pair string) terms {
+	t := terms{rate: e.feeRate}
+	if e.contracts == nil {
+		return t
+	}
+	contract, err := e.contracts.Contract(exchange, pair)
+	if err != nil {
+		return t
+	}
+	if contract.TakerFeeRate > 0 {
+		t.rate = contract.TakerFeeRate
+	}
+	t.contract = contract
+	return t
+}
+
+// notional returns the value of a contract of the pair at price
+func (t terms) notional(price float64) float64 {
+	if t.contract != nil {
+		return t.contract.Notional(1, price)
+	}
+	return price
+}
+
+// pnl returns the PnL of a signed quantity entered at entry and marked or
+// closed at exit
+func (t terms) pnl(qty, entry, exit float64) float64 {
+	if t.contract != nil {
+		return t.contract.PnL(qty, entry, exit)
+	}
+	return (exit - entry) * qty
+}
+
+// settle returns the currency of the PnL of inverse pairs
+func (t terms) settle() string {
+	if t.contract != nil && t.contract.Inverse {
+		return t.contract.Settle
+	}
+	return ""
+}
+
+// currency returns the currency the PnL, fees and funding of a pair are
+// paid in: its contract's settle currency, else the pair's quote currency
+func (t terms) currency(pair string) string {
+	if t.contract != nil && t.contract.Settle != "" {
+		return strings.ToUpper(t.contract.Settle)
+	}
+	_, quote, _ := strings.Cut(pair, "_")
+	return strings.ToUpper(quote)
+}
+
+// matches reports whether a record passes the exchange, pair, strategy and
+// time filters of a query
+func matches(q storage.Query, exchange, pair, strategy string, at time.Time) bool {
+	return (q.Exchange == "" || q.Exchange == exchange) &&
+		(q.Pair == "" || q.Pair == pair) &&
+		(q.Strategy == "" || q.Strategy == strategy) &&
+		(q.From.IsZero() || !at.Before(q.From)) &&
+		(q.To.IsZero() || at.Before(q.To))
+}
+
+// Trades returns the closed trades matching a query, newest first
+func (e *Engine) Trades(q storage.Query) ([]Trade, error) {
+	l, err := e.replay()
+	if err != nil {
+		return nil, err
+	}
+	trades := []Trade{}
+	for i := len(l.trades) - 1; i >= 0; i-- {
+		t := l.trades[i]
+		if !matches(q, t.Exchange, t.Pair, t.Strategy, t.Closed) {
+			continue
+		}
+		trades = append(trades, t)
+		if q.Limit > 0 && len(trades) == q.Limit {
+			break
+		}
+	}
+	return trades, nil
+}
+
+// Fills returns the fee and realized PnL of recorded fills by ID; fills
+// recorded after the ledger was replayed are missing
+func (e *Engine) Fills(ids []int64) (map[int64]FillResult, error) {
+	l, err := e.replay()
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[int64]FillResult, len(ids))
+	for _, id := range ids {
+		if r, ok := l.fills[id]; ok {
+			results[id] = r
+		}
+	}
+	return results, nil
+}
+
+// Settle returns the fee and realized PnL of a fill just recorded,
+// replaying the recorded fills again when the ledger predates it
+func (e *Engine) Settle(f storage.Fill) (realized, fee float64, err error) {
+	e.mu.Lock()
+	if e.ledger != nil {
+		if _, ok := e.ledger.fills[f.ID]; !ok {
+			e.ledger = nil
+		}
+	}
+	e.mu.Unlock()
+
+	l, err := e.replay()
+	if err != nil {
+		return 0, 0, err
+	}
+	r := l.fills[f.ID]
+	return r.Realized, r.Fee, nil
+}
+
+// Currency returns the currency the PnL, fees and funding of a pair of an
+// exchange are paid in
+func (e *Engine) Currency(exchange, pair string) string {
+	return e.terms(exchange, pair).currency(pair)
+}
+
+// periodStart returns the start of the UTC day, ISO week or month of t and its label
+func periodStart(t time.Time, period string) (time.Time, string) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case Week:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		year, week := start.ISOWeek()
+		return start, fmt.Sprintf("%d-W%02d", year, week)
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), t.Format("2006-01")
+	default:
+		return day, day.Format("2006-01-02")
+	}
+}
+
+// Summarize returns the PnL of the records matching a query, broken down
+// by day, week or month, and the unrealized PnL of the matching open lots
+func (e *Engine) Summarize(q storage.Query, period string) (*Summary, error) {
+	l, err := e.replay()
+	if err != nil {
+		return nil, err
+	}
+	if period == "" {
+		period = Day
+	}
+
+	s := &Summary{From: q.From, To: q.To, Period: period, Open: []OpenPosition{}}
+	periods := make(map[string]*Aggregate)
+	add := func(at time.Time, realized, fees, funding float64, trades int) {
+		start, label := periodStart(at, period)
+		a, ok := periods[label]
+		if !ok {
+			a = &Aggregate{Period: label, Start: start}
+			periods[label] = a
+		}
+		a.add(realized, fees, funding, trades)
+		s.Total.add(realized, fees, funding, trades)
+	}
+
+	for _, t := range l.trades {
+		if matches(q, t.Exchange, t.Pair, t.Strategy, t.Closed) {
+			add(t.Closed, t.Realized, 0, 0, 1)
+		}
+	}
+	for _, f := range l.fees {
+		if matches(q, f.exchange, f.pair, f.strategy, f.time) {
+			add(f.time, 0, f.amount, 0, 0)
+		}
+	}
+	if q.Strategy == "" {
+		for _, f := range l.funding {
+			if matches(q, f.Exchange, f.Pair, "", f.Timestamp) {
+				add(f.Timestamp, 0, 0, f.Amount, 0)
+			}
+		}
+	}
+
+	s.Periods = make([]Aggregate, 0, len(periods))
+	for _, a := range periods {
+		s.Periods = append(s.Periods, *a)
+	}
+	sort.Slice(s.Periods, func(i, j int) bool { return s.Periods[i].Start.Before(s.Periods[j].Start) })
+
+	open := storage.Query{Exchange: q.Exchange, Pair: q.Pair, Strategy: q.Strategy}
+	for _, p := range e.openPositions(l) {
+		if matches(open, p.Exchange, p.Pair, p.Strategy, time.Time{}) {
+			s.Open = append(s.Open, p)
+			s.Unrealized += p.Unrealized
+		}
+	}
+	return s, nil
+}
+
+// openPositions returns the open lots of every strategy and pair, marked at
+// the last price; lots whose price is unavailable are marked at entry
+func (e *Engine) openPositions(l *ledger) []OpenPosition {
+	positions := make([]OpenPosition, 0, len(l.open))
+	for key, lots := range l.open {
+		var qty, cost float64
+		for _, lot := range lots {
+			qty += lot.qty
+			cost += lot.qty * lot.price
+		}
+		if qty == 0 {
+			continue
+		}
+		p := OpenPosition{
+			Exchange:   key.exchange,
+			Pair:       key.pair,
+			Strategy:   key.strategy,
+			Side:       trader.BuySide,
+			Quantity:   math.Abs(qty),
+			EntryPrice: cost / qty,
+		}
+		if qty < 0 {
+			p.Side = trader.SellSide
+		}
+		p.MarkPrice = p.EntryPrice
+		if e.prices != nil {
+			if price, err := e.prices.Price(key.pair); err == nil && price > 0 {
+				p.MarkPrice = price
+			}
+		}
+		// Lots are marked one by one, as inverse PnL isn't linear in the price
+		t := e.terms(key.exchange, key.pair)
+		for _, lot := range lots {
+			p.Unrealized += t.pnl(lot.qty, lot.price, p.MarkPrice)
+		}
+		p.Settle = t.settle()
+		positions = append(positions, p)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		a, b := positions[i], positions[j]
+		if a.Exchange != b.Exchange {
+			return a.Exchange < b.Exchange
+		}
+		if a.Pair != b.Pair {
+			return a.Pair < b.Pair
+		}
+		return a.Strategy < b.Strategy
+	})
+	return positions
+}
+
+// RealizedSince returns the realized PnL of an exchange since a time, after
+// fees and funding; the risk limits can use it for the daily loss
+func (e *Engine) RealizedSince(exchange string, since time.Time) (float64, error) {
+	s, err := e.Summarize(storage.Query{Exchange: exchange, From: since}, Day)
+	if err != nil {
+		return 0, err
+	}
+	return s.Total.Net, nil
+}
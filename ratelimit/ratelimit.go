@@ -0,0 +1,242 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nofx/config"
+	"github.com/nofx/metrics"
+)
+
+// Category groups the endpoints of an exchange sharing a rate limit
+type Category string
+
+const (
+	// Public covers unauthenticated market data endpoints
+	Public Category = "public"
+	// Account covers balance, position and order queries and account settings
+	Account Category = "account"
+	// Trading covers order placement and cancellation
+	Trading Category = "trading"
+)
+
+// Limit represents a token bucket refilled at Rate weight units per second,
+// holding at most Burst units
+type Limit struct {
+	Rate  float64
+	Burst float64
+}
+
+// Defaults are the documented limits of the supported exchanges, slightly
+// under the published figures
+var Defaults = map[string]map[Category]Limit{
+	"gate": {
+		Public:  {Rate: 18, Burst: 20},
+		Account: {Rate: 13, Burst: 15},
+		Trading: {Rate: 90, Burst: 100},
+	},
+	"okx": {
+		Public:  {Rate: 9, Burst: 20},
+		Account: {Rate: 4, Burst: 10},
+		Trading: {Rate: 27, Burst: 60},
+	},
+	"bybit": {
+		Public:  {Rate: 9, Burst: 10},
+		Account: {Rate: 9, Burst: 10},
+		Trading: {Rate: 9, Burst: 10},
+	},
+	"kraken": {
+		Public:  {Rate: 9, Burst: 10},
+		Account: {Rate: 4, Burst: 20},
+		Trading: {Rate: 4, Burst: 40},
+	},
+}
+
+// bucket represents the token bucket of an exchange's endpoint category
+type bucket struct {
+	exchange string
+	category Category
+	limit    Limit
+	tokens   float64
+	updated  time.Time
+	queued   int
+}
+
+// refill adds the tokens accrued since the last update
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.updated).Seconds() * b.limit.Rate
+	if b.tokens > b.limit.Burst {
+		b.tokens = b.limit.Burst
+	}
+	b.updated = now
+}
+
+// reserve takes weight tokens and returns how long to wait until they are
+// available. Tokens may go negative, so later callers queue behind earlier ones.
+func (b *bucket) reserve(now time.Time, weight float64) time.Duration {
+	b.refill(now)
+	b.tokens -= weight
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
+
+// Limiter coordinates the calls of every goroutine to the exchange APIs with a
+// token bucket per exchange and endpoint category. Calls carry a weight, e.g.
+// the number of orders of a batch, and wait in line for enough tokens. A nil
+// Limiter doesn't limit.
+type Limiter struct {
+	registry *metrics.Registry
+
+	mu       sync.Mutex
+	limits   map[string]map[Category]Limit
+	fallback Limit
+	buckets  map[string]*bucket
+}
+
+// New creates a new limiter from configuration, recording its queues in
+// registry when set
+func New(cfg config.APIConfig, registry *metrics.Registry) *Limiter {
+	l := &Limiter{registry: registry, buckets: make(map[string]*bucket)}
+	l.Configure(cfg)
+	if registry != nil {
+		registry.Describe("ratelimit_requests_total", "Exchange API calls passed through the rate limiter")
+		registry.Describe("ratelimit_weight_total", "Rate limit weight consumed by exchange API calls")
+		registry.Describe("ratelimit_throttled_total", "Exchange API calls that waited for the rate limiter")
+		registry.Describe("ratelimit_wait_seconds_total", "Time exchange API calls waited for the rate limiter")
+		registry.Describe("ratelimit_queued", "Exchange API calls currently waiting for the rate limiter")
+	}
+	return l
+}
+
+// Configure applies the configured limits over the exchange defaults, as on a
+// configuration reload: RateLimits overrides them per exchange and category,
+// and RateLimit applies to exchanges without defaults
+func (l *Limiter) Configure(cfg config.APIConfig) {
+	limits := make(map[string]map[Category]Limit, len(Defaults)+len(cfg.RateLimits))
+	for exchange, categories := range Defaults {
+		limits[exchange] = make(map[Category]Limit, len(categories))
+		for category, limit := range categories {
+			limits[exchange][category] = limit
+		}
+	}
+	for exchange, categories := range cfg.RateLimits {
+		if limits[exchange] == nil {
+			limits[exchange] = make(map[Category]Limit, len(categories))
+		}
+		for category, limit := range categories {
+			limits[exchange][Category(category)] = Limit{Rate: limit.Rate, Burst: limit.Burst}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	l.fallback = Limit{Rate: float64(cfg.RateLimit)}
+	for _, b := range l.buckets {
+		b.limit = l.limit(b.exchange, b.category)
+		if b.tokens > b.limit.Burst {
+			b.tokens = b.limit.Burst
+		}
+	}
+}
+
+// limit returns the limit of an exchange's endpoint category, with the burst
+// defaulting to one second of rate; the caller must hold mu
+func (l *Limiter) limit(exchange string, category Category) Limit {
+	limit, ok := l.limits[exchange][category]
+	if !ok {
+		limit = l.fallback
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Rate
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return limit
+}
+
+// Wait blocks until a call of the given weight to an exchange's endpoint
+// category is allowed, or fails when ctx ends first or its deadline falls
+// before the call's turn
+func (l *Limiter) Wait(ctx context.Context, exchange string, category Category, weight float64) (err error) {
+	if l == nil {
+		return nil
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+	labels := metrics.Labels{"exchange": exchange, "category": string(category)}
+	l.count("ratelimit_requests_total", labels, 1)
+	defer func() {
+		if err == nil {
+			l.count("ratelimit_weight_total", labels, weight)
+		}
+	}()
+
+	now := time.Now()
+	l.mu.Lock()
+	key := exchange + "|" + string(category)
+	b, ok := l.buckets[key]
+	if !ok {
+		limit := l.limit(exchange, category)
+		b = &bucket{exchange: exchange, category: category, limit: limit, tokens: limit.Burst, updated: now}
+		l.buckets[key] = b
+	}
+	if b.limit.Rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	delay := b.reserve(now, weight)
+	if delay <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		b.tokens += weight
+		l.mu.Unlock()
+		return fmt.Errorf("%s %s rate limit: waiting %v would exceed the deadline", exchange, category, delay.Round(time.Millisecond))
+	}
+	b.queued++
+	l.gauge("ratelimit_queued", labels, b.queued)
+	l.mu.Unlock()
+
+	l.count("ratelimit_throttled_total", labels, 1)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	if err != nil {
+		// Give the unused tokens back to the callers queued behind
+		b.tokens += weight
+	}
+	b.queued--
+	l.gauge("ratelimit_queued", labels, b.queued)
+	l.mu.Unlock()
+	l.count("ratelimit_wait_seconds_total", labels, time.Since(now).Seconds())
+	return err
+}
+
+// count increments a counter when a registry is set
+func (l *Limiter) count(name string, labels metrics.Labels, delta float64) {
+	if l.registry != nil {
+		l.registry.Add(name, labels, delta)
+	}
+}
+
+// gauge sets a gauge when a registry is set
+func (l *Limiter) gauge(name string, labels metrics.Labels, value int) {
+	if l.registry != nil {
+		l.registry.Set(name, labels, float64(value))
+	}
+}
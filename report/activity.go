@@ -0,0 +1,253 @@
+package report
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/nofx/market"
+	"github.com/nofx/storage"
+	"github.com/nofx/trader"
+)
+
+// ContractSource provides contract metadata, used for fee rates
+type ContractSource interface {
+	Get(pair string) (*market.ContractInfo, error)
+}
+
+// TradeActivity represents trading frequency and cost over a period. Fees
+// are estimated from the taker fee rate, RealizedPnl is the gross PnL of the
+// fills before fees and FeeToPnl the fees as a fraction of it (0 when nothing
+// was realized); Turnover is the traded volume relative to average equity.
+type TradeActivity struct {
+	Trades       int     `json:"trades"`
+	TradesPerDay float64 `json:"trades_per_day"`
+	Volume       float64 `json:"volume"`
+	Turnover     float64 `json:"turnover"`
+	Fees         float64 `json:"fees"`
+	RealizedPnl  float64 `json:"realized_pnl"`
+	FeeToPnl     float64 `json:"fee_to_pnl"`
+}
+
+// add records one fill
+func (a *TradeActivity) add(notional, fee, pnl float64) {
+	a.Trades++
+	a.Volume += notional
+	a.Fees += fee
+	a.RealizedPnl += pnl
+}
+
+// finish derives the ratios over a period of days against average equity
+func (a *TradeActivity) finish(days, equity float64) {
+	if days > 0 {
+		a.TradesPerDay = float64(a.Trades) / days
+	}
+	if equity > 0 {
+		a.Turnover = a.Volume / equity
+	}
+	if a.RealizedPnl != 0 {
+		a.FeeToPnl = a.Fees / math.Abs(a.RealizedPnl)
+	}
+}
+
+// StrategyActivity represents the trade activity of one strategy
+type StrategyActivity struct {
+	Strategy string `json:"strategy"`
+	TradeActivity
+}
+
+// DayActivity represents the trade activity of one UTC day
+type DayActivity struct {
+	Date string `json:"date"`
+	TradeActivity
+}
+
+// ActivityStats represents portfolio turnover and trade frequency over a
+// period, overall, per strategy and per day; Tag is the journal tag the
+// trades were limited to, if any
+type ActivityStats struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Tag           string    `json:"tag,omitempty"`
+	Days          float64   `json:"days"`
+	AverageEquity float64   `json:"average_equity"`
+	TradeActivity
+	Strategies []StrategyActivity `json:"strategies"`
+	Daily      []DayActivity      `json:"daily"`
+}
+
+// Activity computes trade activity statistics from the recorded history
+type Activity struct {
+	store     *storage.Store
+	contracts ContractSource
+	feeRate   float64
+}
+
+// NewActivity creates a new activity calculator; feeRate is the taker fee
+// rate assumed when a contract doesn't report one
+func NewActivity(store *storage.Store, contracts ContractSource, feeRate float64) *Activity {
+	return &Activity{
+		store:     store,
+		contracts: contracts,
+		feeRate:   feeRate,
+	}
+}
+
+// holding tracks the net position a strategy built on one pair, to realize
+// PnL as fills reduce it
+type holding struct {
+	size  float64
+	price float64
+}
+
+// fill applies a signed fill quantity and returns the PnL it realized
+func (h *holding) fill(qty, price float64) float64 {
+	if h.size == 0 || (h.size > 0) == (qty > 0) {
+		total := math.Abs(h.size) + math.Abs(qty)
+		h.price = (h.price*math.Abs(h.size) + price*math.Abs(qty)) / total
+		h.size += qty
+		return 0
+	}
+
+	closed := math.Min(math.Abs(qty), math.Abs(h.size))
+	pnl := (price - h.price) * closed
+	if h.size < 0 {
+		pnl = -pnl
+	}
+	wasLong := h.size > 0
+	h.size += qty
+	switch {
+	case math.Abs(h.size) < 1e-12:
+		h.size, h.price = 0, 0
+	case (h.size > 0) != wasLong:
+		h.price = price
+	}
+	return pnl
+}
+
+// Compute returns the activity between from and to, of the fills of orders
+// only when it isn't nil. Fills before from, and those of other orders, are
+// replayed to know the entry price of positions closed in the period; fills
+// without a price can't be valued and are only counted.
+func (a *Activity) Compute(from, to time.Time, orders map[string]bool) (*ActivityStats, error) {
+	fills, err := a.store.Fills(storage.Query{To: to})
+	if err != nil {
+		return nil, err
+	}
+	equity, err := a.averageEquity(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ActivityStats{
+		From:          from,
+		To:            to,
+		Days:          to.Sub(from).Hours() / 24,
+		AverageEquity: equity,
+	}
+	strategies := make(map[string]*StrategyActivity)
+	days := make(map[string]*DayActivity)
+	holdings := make(map[string]*holding)
+	rates := make(map[string]float64)
+
+	// Fills come newest first; replay them oldest first
+	for i := len(fills) - 1; i >= 0; i-- {
+		f := fills[i]
+		key := f.Exchange + "|" + f.Pair + "|" + f.Strategy
+		h, ok := holdings[key]
+		if !ok {
+			h = &holding{}
+			holdings[key] = h
+		}
+		qty := f.Amount
+		if f.Side == trader.SellSide {
+			qty = -qty
+		}
+		var pnl float64
+		if f.Price > 0 {
+			pnl = h.fill(qty, f.Price)
+		}
+		if f.Timestamp.Before(from) || (orders != nil && !orders[f.OrderID]) {
+			continue
+		}
+
+		rate, ok := rates[f.Pair]
+		if !ok {
+			rate = a.takerFee(f.Pair)
+			rates[f.Pair] = rate
+		}
+		notional := f.Price * f.Amount
+		fee := notional * rate
+
+		s, ok := strategies[f.Strategy]
+		if !ok {
+			s = &StrategyActivity{Strategy: f.Strategy}
+			strategies[f.Strategy] = s
+		}
+		date := f.Timestamp.UTC().Format("2006-01-02")
+		d, ok := days[date]
+		if !ok {
+			d = &DayActivity{Date: date}
+			days[date] = d
+		}
+		stats.add(notional, fee, pnl)
+		s.add(notional, fee, pnl)
+		d.add(notional, fee, pnl)
+	}
+
+	stats.finish(stats.Days, equity)
+	stats.Strategies = make([]StrategyActivity, 0, len(strategies))
+	for _, s := range strategies {
+		s.finish(stats.Days, equity)
+		stats.Strategies = append(stats.Strategies, *s)
+	}
+	sort.Slice(stats.Strategies, func(i, j int) bool {
+		return stats.Strategies[i].Turnover > stats.Strategies[j].Turnover
+	})
+	stats.Daily = make([]DayActivity, 0, len(days))
+	for _, d := range days {
+		d.finish(1, equity)
+		stats.Daily = append(stats.Daily, *d)
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool {
+		return stats.Daily[i].Date < stats.Daily[j].Date
+	})
+	return stats, nil
+}
+
+// takerFee returns the taker fee rate of a pair
+func (a *Activity) takerFee(pair string) float64 {
+	if a.contracts != nil {
+		if contract, err := a.contracts.Get(pair); err == nil && contract.TakerFeeRate > 0 {
+			return contract.TakerFeeRate
+		}
+	}
+	return a.feeRate
+}
+
+// averageEquity returns the total balance averaged over the recorded balance
+// snapshots between from and to, summed across exchanges
+func (a *Activity) averageEquity(from, to time.Time) (float64, error) {
+	balances, err := a.store.Balances(storage.Query{From: from, To: to})
+	if err != nil {
+		return 0, err
+	}
+
+	snapshots := make(map[string]map[int64]float64)
+	for _, b := range balances {
+		if snapshots[b.Exchange] == nil {
+			snapshots[b.Exchange] = make(map[int64]float64)
+		}
+		snapshots[b.Exchange][b.Timestamp.UnixMilli()] += b.Total
+	}
+
+	var equity float64
+	for _, totals := range snapshots {
+		var sum float64
+		for _, total := range totals {
+			sum += total
+		}
+		equity += sum / float64(len(totals))
+	}
+	return equity, nil
+}
@@ -0,0 +1,223 @@
+package report
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/risk"
+	"github.com/nofx/trader"
+)
+
+// DailyReport represents the end-of-day account summary
+type DailyReport struct {
+	Date          string            `json:"date"`
+	Balances      []trader.Balance  `json:"balances"`
+	Positions     []trader.Position `json:"positions"`
+	UnrealizedPnl float64           `json:"unrealized_pnl"`
+	Funding       float64           `json:"funding"`
+	Risk          *risk.VaRReport   `json:"risk,omitempty"`
+	Activity      *ActivityStats    `json:"activity,omitempty"`
+	TCA           *TCAReport        `json:"tca,omitempty"`
+	// ProfitLocks holds the daily profit lock-in of the previous and the
+	// current UTC day
+	ProfitLocks []risk.ProfitLock `json:"profit_locks,omitempty"`
+	Errors      []string          `json:"errors,omitempty"`
+	Timestamp   time.Time         `json:"timestamp"`
+}
+
+// DailyReporter generates the daily report once a day at a fixed UTC hour
+type DailyReporter struct {
+	trader     trader.Trader
+	contracts  trader.ContractSource
+	calculator *risk.VaRCalculator
+	activity   *Activity
+	window     time.Duration
+	tca        *TCA
+	tcaWindow  time.Duration
+	limits     *risk.Limiter
+	hour       int
+
+	// OnReport is called with every generated report; defaults to logging a summary
+	OnReport func(*DailyReport)
+
+	mu   sync.Mutex
+	last *DailyReport
+	stop chan struct{}
+}
+
+// NewDailyReporter creates a new daily reporter firing at the given UTC hour,
+// valuing the positions of t with contracts; with activity set, reports include the trade activity over the trailing
+// window, with tca set the trade cost analysis over tcaWindow and with limits
+// set the daily profit lock-in
+func NewDailyReporter(t trader.Trader, contracts trader.ContractSource, v *risk.VaRCalculator, activity *Activity,
+	window time.Duration, tca *TCA, tcaWindow time.Duration, limits *risk.Limiter, hour int) *DailyReporter {
+	return &DailyReporter{
+		trader:     t,
+		contracts:  contracts,
+		calculator: v,
+		activity:   activity,
+		window:     window,
+		tca:        tca,
+		tcaWindow:  tcaWindow,
+		limits:     limits,
+		hour:       hour,
+		OnReport:   logReport,
+	}
+}
+
+// Start schedules daily report generation in the background
+func (r *DailyReporter) Start() {
+	r.mu.Lock()
+	if r.stop != nil {
+		r.mu.Unlock()
+		return
+	}
+	r.stop = make(chan struct{})
+	stop := r.stop
+	r.mu.Unlock()
+
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(r.next(time.Now())))
+			select {
+			case <-timer.C:
+				r.OnReport(r.Generate(context.Background()))
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts daily report generation
+func (r *DailyReporter) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// next returns the next report time after now
+func (r *DailyReporter) next(now time.Time) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), r.hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Generate builds a report from the current account state; failures of
+// individual sections are recorded in the report instead of aborting it
+func (r *DailyReporter) Generate(ctx context.Context) *DailyReport {
+	now := time.Now()
+	report := &DailyReport{
+		Date:      now.UTC().Format("2006-01-02"),
+		Timestamp: now,
+	}
+
+	balances, err := r.trader.GetBalance(ctx)
+	if err != nil {
+		report.Errors = append(report.Errors, "balance: "+err.Error())
+	}
+	report.Balances = balances
+
+	positions, err := r.trader.GetPositions(ctx)
+	if err != nil {
+		report.Errors = append(report.Errors, "positions: "+err.Error())
+	}
+	report.Positions = positions
+	for _, p := range positions {
+		report.UnrealizedPnl += p.UnrealizedPnl
+		report.Funding += p.Funding
+	}
+
+	if r.calculator != nil && err == nil {
+		v, err := r.calculator.Compute(positions, r.contracts)
+		if err != nil {
+			report.Errors = append(report.Errors, "var: "+err.Error())
+		}
+		report.Risk = v
+	}
+
+	if r.activity != nil {
+		a, err := r.activity.Compute(now.Add(-r.window), now, nil)
+		if err != nil {
+			report.Errors = append(report.Errors, "activity: "+err.Error())
+		}
+		report.Activity = a
+	}
+
+	if r.tca != nil {
+		tca, err := r.tca.Compute(now.Add(-r.tcaWindow), now)
+		if err != nil {
+			report.Errors = append(report.Errors, "tca: "+err.Error())
+		}
+		report.TCA = tca
+	}
+
+	if r.limits != nil && r.limits.ProfitLock().Target > 0 {
+		report.ProfitLocks = r.limits.ProfitLocks()
+	}
+
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+	return report
+}
+
+// Last returns the most recently generated report, or nil
+func (r *DailyReporter) Last() *DailyReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// logReport logs a summary of a daily report
+func logReport(report *DailyReport) {
+	logger.Info("Daily report %s: %d positions, unrealized PnL %.2f, funding %.2f",
+		report.Date, len(report.Positions), report.UnrealizedPnl, report.Funding)
+	if v := report.Risk; v != nil {
+		logger.Info("Daily report %s: gross exposure %.2f, %.0f%% VaR parametric %.2f / historical %.2f",
+			report.Date, v.GrossExposure, v.Confidence*100, v.Parametric, v.Historical)
+		for _, s := range v.Stress {
+			logger.Info("Daily report %s: stress %s PnL %.2f", report.Date, s.Scenario.Name, s.PnL)
+		}
+	}
+	if a := report.Activity; a != nil {
+		logger.Info("Daily report %s: %.0f-day turnover %.2fx, %.1f trades/day, fees %.2f (%.0f%% of PnL)",
+			report.Date, a.Days, a.Turnover, a.TradesPerDay, a.Fees, a.FeeToPnl*100)
+		for _, s := range a.Strategies {
+			logger.Info("Daily report %s: strategy %q turnover %.2fx, %.1f trades/day, fees %.2f (%.0f%% of PnL)",
+				report.Date, s.Strategy, s.Turnover, s.TradesPerDay, s.Fees, s.FeeToPnl*100)
+		}
+	}
+	if t := report.TCA; t != nil {
+		logger.Info("Daily report %s: %d orders cost %.1f bps vs arrival, %.1f bps vs VWAP, %.1f bps vs close",
+			report.Date, t.Orders, t.ArrivalBps, t.VWAPBps, t.CloseBps)
+		for _, s := range t.Strategies {
+			logger.Info("Daily report %s: strategy %q cost %.1f bps vs arrival, %.1f bps vs VWAP, %.1f bps vs close",
+				report.Date, s.Strategy, s.ArrivalBps, s.VWAPBps, s.CloseBps)
+		}
+		for _, v := range t.Venues {
+			logger.Info("Daily report %s: venue %s cost %.1f bps vs arrival, %.1f bps vs VWAP, %.1f bps vs close",
+				report.Date, v.Exchange, v.ArrivalBps, v.VWAPBps, v.CloseBps)
+		}
+	}
+	for _, p := range report.ProfitLocks {
+		if p.Engaged {
+			logger.Info("Daily report %s: profit target %.2f reached on %s at %s with %.2f, action %s",
+				report.Date, p.Target, p.Day, p.Since.UTC().Format("15:04"), p.PnL, p.Action)
+		} else {
+			logger.Info("Daily report %s: realized PnL %.2f of profit target %.2f on %s", report.Date, p.PnL, p.Target, p.Day)
+		}
+	}
+	for _, e := range report.Errors {
+		logger.Warning("Daily report %s: %s", report.Date, e)
+	}
+}
@@ -0,0 +1,290 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/nofx/market"
+	"github.com/nofx/storage"
+	"github.com/nofx/trader"
+)
+
+// tcaInterval is the candle interval benchmarks are taken from
+const tcaInterval = "1m"
+
+// CandleSource provides historical candles
+type CandleSource interface {
+	Download(ctx context.Context, pair, interval string, from, to time.Time) ([]market.CandleData, error)
+}
+
+// TCASummary represents the execution cost of a set of orders against three
+// benchmarks: the price when the order was created (arrival), the volume
+// weighted price while it executed (VWAP) and the close of its UTC day.
+// Costs are in basis points, notional weighted and positive when the
+// execution was worse than the benchmark.
+type TCASummary struct {
+	Orders     int     `json:"orders"`
+	Notional   float64 `json:"notional"`
+	ArrivalBps float64 `json:"arrival_bps"`
+	VWAPBps    float64 `json:"vwap_bps"`
+	CloseBps   float64 `json:"close_bps"`
+}
+
+// add records the costs of one order
+func (s *TCASummary) add(notional, arrival, vwap, close float64) {
+	s.Orders++
+	s.Notional += notional
+	s.ArrivalBps += arrival * notional
+	s.VWAPBps += vwap * notional
+	s.CloseBps += close * notional
+}
+
+// finish turns the notional weighted sums into averages
+func (s *TCASummary) finish() {
+	if s.Notional > 0 {
+		s.ArrivalBps /= s.Notional
+		s.VWAPBps /= s.Notional
+		s.CloseBps /= s.Notional
+	}
+}
+
+// StrategyTCA represents the execution cost of one strategy
+type StrategyTCA struct {
+	Strategy string `json:"strategy"`
+	TCASummary
+}
+
+// VenueTCA represents the execution cost on one exchange
+type VenueTCA struct {
+	Exchange string `json:"exchange"`
+	TCASummary
+}
+
+// TCAReport represents the trade cost analysis of the orders created in a
+// period, overall, per strategy and per venue. Skipped counts filled orders
+// without candles to benchmark them against.
+type TCAReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	TCASummary
+	Strategies []StrategyTCA `json:"strategies"`
+	Venues     []VenueTCA    `json:"venues"`
+	Skipped    int           `json:"skipped"`
+}
+
+// TCA analyzes the recorded executions against market benchmarks
+type TCA struct {
+	store   *storage.Store
+	candles CandleSource
+}
+
+// NewTCA creates a new trade cost analyzer
+func NewTCA(store *storage.Store, candles CandleSource) *TCA {
+	return &TCA{store: store, candles: candles}
+}
+
+// execution represents the fills of one order
+type execution struct {
+	order    storage.OrderRecord
+	amount   float64
+	notional float64
+	last     time.Time
+}
+
+// ExecutionCost represents the cost of one order against the benchmarks
+type ExecutionCost struct {
+	Exchange   string      `json:"exchange"`
+	OrderID    string      `json:"order_id"`
+	Pair       string      `json:"currency_pair"`
+	Side       trader.Side `json:"side"`
+	Strategy   string      `json:"strategy,omitempty"`
+	Price      float64     `json:"price"`
+	Notional   float64     `json:"notional"`
+	ArrivalBps float64     `json:"arrival_bps"`
+	VWAPBps    float64     `json:"vwap_bps"`
+	CloseBps   float64     `json:"close_bps"`
+	// Filled is the time of the last fill
+	Filled time.Time `json:"filled"`
+}
+
+// Compute returns the trade cost analysis of the orders created between
+// from and to
+func (t *TCA) Compute(from, to time.Time) (*TCAReport, error) {
+	costs, skipped, err := t.Executions(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TCAReport{From: from, To: to, Skipped: skipped}
+	strategies := make(map[string]*StrategyTCA)
+	venues := make(map[string]*VenueTCA)
+	for _, c := range costs {
+		s, ok := strategies[c.Strategy]
+		if !ok {
+			s = &StrategyTCA{Strategy: c.Strategy}
+			strategies[c.Strategy] = s
+		}
+		v, ok := venues[c.Exchange]
+		if !ok {
+			v = &VenueTCA{Exchange: c.Exchange}
+			venues[c.Exchange] = v
+		}
+		report.add(c.Notional, c.ArrivalBps, c.VWAPBps, c.CloseBps)
+		s.add(c.Notional, c.ArrivalBps, c.VWAPBps, c.CloseBps)
+		v.add(c.Notional, c.ArrivalBps, c.VWAPBps, c.CloseBps)
+	}
+
+	report.finish()
+	report.Strategies = make([]StrategyTCA, 0, len(strategies))
+	for _, s := range strategies {
+		s.finish()
+		report.Strategies = append(report.Strategies, *s)
+	}
+	sort.Slice(report.Strategies, func(i, j int) bool {
+		return report.Strategies[i].Notional > report.Strategies[j].Notional
+	})
+	report.Venues = make([]VenueTCA, 0, len(venues))
+	for _, v := range venues {
+		v.finish()
+		report.Venues = append(report.Venues, *v)
+	}
+	sort.Slice(report.Venues, func(i, j int) bool {
+		return report.Venues[i].Notional > report.Venues[j].Notional
+	})
+	return report, nil
+}
+
+// Executions returns the costs of the orders created between from and to,
+// ordered by their last fill, and the number of filled orders skipped for
+// lack of candles. An order's execution price is the average price of its
+// recorded fills; orders without priced fills are left out.
+func (t *TCA) Executions(from, to time.Time) ([]ExecutionCost, int, error) {
+	if t.candles == nil {
+		return nil, 0, errors.New("no candle source for benchmarks")
+	}
+	orders, err := t.store.Orders(storage.Query{From: from, To: to})
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]string, len(orders))
+	for i, o := range orders {
+		ids[i] = o.ID
+	}
+	fills, err := t.store.Fills(storage.Query{Refs: ids})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	executions := make(map[string]*execution, len(orders))
+	for _, o := range orders {
+		executions[o.Exchange+"|"+o.ID] = &execution{order: o}
+	}
+	for _, f := range fills {
+		e, ok := executions[f.Exchange+"|"+f.OrderID]
+		if !ok || f.Price <= 0 {
+			continue
+		}
+		e.amount += f.Amount
+		e.notional += f.Price * f.Amount
+		if f.Timestamp.After(e.last) {
+			e.last = f.Timestamp
+		}
+	}
+
+	costs := []ExecutionCost{}
+	skipped := 0
+	series := make(map[string][]market.CandleData)
+	for _, e := range executions {
+		if e.amount <= 0 {
+			continue
+		}
+		pair := e.order.Pair
+		candles, ok := series[pair]
+		if !ok {
+			candles, err = t.candles.Download(context.Background(), pair, tcaInterval, dayStart(from), dayStart(to).AddDate(0, 0, 1))
+			if err != nil {
+				return nil, 0, err
+			}
+			series[pair] = candles
+		}
+
+		arrival, vwap, close, ok := benchmarks(candles, time.UnixMilli(e.order.CreatedTime), e.last)
+		if !ok {
+			skipped++
+			continue
+		}
+		price := e.notional / e.amount
+		side := e.order.Side
+		costs = append(costs, ExecutionCost{
+			Exchange:   e.order.Exchange,
+			OrderID:    e.order.ID,
+			Pair:       pair,
+			Side:       side,
+			Strategy:   e.order.Strategy,
+			Price:      price,
+			Notional:   e.notional,
+			ArrivalBps: cost(side, price, arrival),
+			VWAPBps:    cost(side, price, vwap),
+			CloseBps:   cost(side, price, close),
+			Filled:     e.last,
+		})
+	}
+	sort.Slice(costs, func(i, j int) bool { return costs[i].Filled.Before(costs[j].Filled) })
+	return costs, skipped, nil
+}
+
+// benchmarks returns the open of the candle an order arrived in, the volume
+// weighted typical price of the candles until its last fill and the close
+// of its UTC day, or of the latest candle while the day is still open
+func benchmarks(candles []market.CandleData, arrived, filled time.Time) (arrival, vwap, close float64, ok bool) {
+	start := arrived.Unix()
+	end := filled.Unix()
+	if end < start {
+		end = start
+	}
+	first := sort.Search(len(candles), func(i int) bool { return candles[i].Timestamp > start }) - 1
+	if first < 0 || candles[first].Open <= 0 {
+		return 0, 0, 0, false
+	}
+	arrival = candles[first].Open
+
+	var volume, weighted, closes float64
+	n := 0
+	for _, c := range candles[first:] {
+		if c.Timestamp > end {
+			break
+		}
+		typical := (c.High + c.Low + c.Close) / 3
+		volume += c.Volume
+		weighted += typical * c.Volume
+		closes += c.Close
+		n++
+	}
+	vwap = closes / float64(n)
+	if volume > 0 {
+		vwap = weighted / volume
+	}
+
+	dayEnd := dayStart(arrived).AddDate(0, 0, 1).Unix()
+	last := sort.Search(len(candles), func(i int) bool { return candles[i].Timestamp >= dayEnd }) - 1
+	close = candles[last].Close
+	return arrival, vwap, close, vwap > 0 && close > 0
+}
+
+// cost returns the cost in basis points of executing at price against a
+// benchmark: buying above it or selling below it is positive
+func cost(side trader.Side, price, benchmark float64) float64 {
+	bps := (price - benchmark) / benchmark * 10000
+	if side == trader.SellSide {
+		return -bps
+	}
+	return bps
+}
+
+// dayStart returns the start of the UTC day of t
+func dayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
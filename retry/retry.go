@@ -0,0 +1,128 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// Policy represents how failed exchange calls are retried
+type Policy struct {
+	// Attempts is the total number of attempts; 1 disables retries
+	Attempts int
+	// BaseDelay is the backoff ceiling of the first retry, doubling on each
+	// following one up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultPolicy is the retry policy of exchange clients not configured otherwise
+var DefaultPolicy = Policy{Attempts: 3, BaseDelay: 250 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// StatusError represents an HTTP error status returned by an exchange API
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.Status, e.Message)
+}
+
+// transient marks an error as retryable
+type transient struct {
+	err error
+}
+
+func (t transient) Error() string { return t.err.Error() }
+func (t transient) Unwrap() error { return t.err }
+
+// Transient marks an error as retryable, e.g. an exchange's "system busy" code
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transient{err: err}
+}
+
+// Retryable reports whether an error is transient: a network timeout or
+// connection failure, an HTTP 429 or 5xx status, or an error marked Transient.
+// Anything else, like a rejected order or invalid request, is fatal.
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var t transient
+	if errors.As(err, &t) {
+		return true
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Status == 429 || status.Status >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// Backoff returns the delay before retry n, counting from 1: a random
+// duration up to BaseDelay doubled n-1 times and capped at MaxDelay, so
+// clients failing together don't retry in lockstep
+func (p Policy) Backoff(n int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < n && (p.MaxDelay <= 0 || ceiling < p.MaxDelay); i++ {
+		ceiling *= 2
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't Retryable,
+// runs out of attempts or ctx ends, backing off between attempts; name
+// describes the call in logs. fn receives the attempt number from 0, and
+// must be safe to repeat: calls placing orders resend the same client order ID.
+func (p Policy) Do(ctx context.Context, name string, fn func(attempt int) error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			delay := p.Backoff(attempt)
+			logger.Warning("%s failed, retrying in %v (attempt %d of %d): %v",
+				name, delay.Round(time.Millisecond), attempt+1, attempts, err)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+		}
+		if err = fn(attempt); err == nil || !Retryable(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nofx/trader"
+)
+
+// ErrBucketExposure is returned when an entry would push a correlation bucket over its notional limit
+var ErrBucketExposure = errors.New("correlation bucket exposure limit exceeded")
+
+// SetCorrelationBuckets replaces the groups of correlated pairs whose combined
+// exposure is limited, typically from the correlation service
+func (e *Engine) SetCorrelationBuckets(buckets [][]string) {
+	index := make(map[string]int)
+	for i, bucket := range buckets {
+		for _, pair := range bucket {
+			index[pair] = i
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.buckets = buckets
+	e.bucketIndex = index
+}
+
+// CorrelationBuckets returns the current groups of correlated pairs
+func (e *Engine) CorrelationBuckets() [][]string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.buckets
+}
+
+// CheckBucketExposure verifies that adding notional on a pair keeps the
+// combined exposure of its correlation bucket, with positions valued with
+// contracts, under the configured limit
+func (e *Engine) CheckBucketExposure(pair string, notional float64, positions []trader.Position, contracts trader.ContractSource) error {
+	if e.maxBucketNotional <= 0 {
+		return nil
+	}
+
+	e.mu.RLock()
+	i, ok := e.bucketIndex[pair]
+	var bucket []string
+	if ok {
+		bucket = e.buckets[i]
+	}
+	e.mu.RUnlock()
+	if !ok {
+		bucket = []string{pair}
+	}
+
+	members := make(map[string]bool, len(bucket))
+	for _, p := range bucket {
+		members[p] = true
+	}
+
+	exposure := notional
+	for _, p := range positions {
+		if members[p.Pair] {
+			exposure += trader.Notional(contracts, p.Pair, p.Size, p.MarkPrice)
+		}
+	}
+
+	if exposure > e.maxBucketNotional {
+		return fmt.Errorf("%s: %w (%.2f > %.2f across %v)", pair, ErrBucketExposure, exposure, e.maxBucketNotional, bucket)
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// Guard wraps a Trader and rejects orders breaching the limiter's limits or
+// the risk engine's entry rules before they reach the exchange; orders
+// reducing a position always pass
+type Guard struct {
+	trader.Trader
+	exchange  string
+	limiter   *Limiter
+	engine    *Engine
+	contracts trader.ContractSource
+
+	mu       sync.Mutex
+	day      string
+	dayStart float64
+	// transfers is the net of the day's deposits and withdrawals, as last read
+	transfers float64
+	stop      chan struct{}
+}
+
+// NewGuard creates a new guard for an exchange's trader, valuing orders and
+// positions with the exchange's contract metadata; engine may be nil
+func NewGuard(exchange string, t trader.Trader, limiter *Limiter, engine *Engine, contracts trader.ContractSource) *Guard {
+	return &Guard{
+		Trader:    t,
+		exchange:  exchange,
+		limiter:   limiter,
+		engine:    engine,
+		contracts: contracts,
+	}
+}
+
+// Start samples the daily PnL every interval in the background, so the day's
+// starting balance is captured early and the kill switch and profit lock-in
+// engage without waiting for the next order. Sampling is skipped while
+// neither a daily loss limit nor a profit target is set, so one added by a
+// configuration reload takes effect
+func (g *Guard) Start(interval time.Duration) {
+	g.mu.Lock()
+	if g.stop != nil {
+		g.mu.Unlock()
+		return
+	}
+	g.stop = make(chan struct{})
+	stop := g.stop
+	g.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if lim := g.limiter.current(); lim.maxDailyLoss > 0 || lim.dailyProfitTarget > 0 {
+				pnl, err := g.DailyPnL(ctx)
+				if err != nil {
+					logger.Warning("Failed to sample daily PnL on %s: %v", g.exchange, err)
+				} else {
+					g.limiter.checkDailyLoss(g.exchange, pnl)
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts daily PnL sampling
+func (g *Guard) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stop != nil {
+		close(g.stop)
+		g.stop = nil
+	}
+}
+
+// openPositionRetry is how often a queued entry rechecks the open position limits
+const openPositionRetry = 5 * time.Second
+
+// CreateOrder checks the order against the limits before placing it;
+// reduce-only orders only ever shrink a position, so they aren't checked.
+// With the queue action, an entry beyond the open position limits waits for
+// a position to close, up to the queue timeout, before it's rejected.
+func (g *Guard) CreateOrder(ctx context.Context, req trader.OrderRequest) (*trader.Order, error) {
+	if req.ReduceOnly {
+		return g.Trader.CreateOrder(ctx, req)
+	}
+	o, _ := trader.ClientOrderFrom(ctx)
+	err := g.check(ctx, o.Strategy, req.Pair, req.Side, req.Amount, req.Price, req.Leverage)
+	if lim := g.limiter.current(); errors.Is(err, ErrOpenPositionLimit) && lim.openPositionAction == OpenPositionQueue {
+		err = g.queue(ctx, lim.openPositionQueue, func() error {
+			return g.check(ctx, o.Strategy, req.Pair, req.Side, req.Amount, req.Price, req.Leverage)
+		})
+	}
+	if err != nil {
+		logger.With(logger.FieldExchange, g.exchange, logger.FieldSymbol, req.Pair).
+			Log(logger.WarningLevel, logger.MsgOrderRejected, "side", req.Side, "type", req.Type, "error", err.Error())
+		return nil, err
+	}
+
+	order, err := g.Trader.CreateOrder(ctx, req)
+	if err == nil {
+		g.limiter.recordEntry(g.exchange, o.Strategy, req.Pair, req.Side)
+	}
+	return order, err
+}
+
+// queue rechecks an entry held by the open position limits until it passes,
+// another check fails, the timeout passes or ctx is done
+func (g *Guard) queue(ctx context.Context, timeout time.Duration, check func() error) error {
+	logger.Log(logger.InfoLevel, logger.MsgEntryQueued, logger.FieldExchange, g.exchange, "timeout", timeout.String())
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(openPositionRetry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return check()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := check(); !errors.Is(err, ErrOpenPositionLimit) {
+			return err
+		}
+	}
+}
+
+// SetTrailingStop places a native trailing stop; it only ever reduces a
+// position, so it isn't checked
+func (g *Guard) SetTrailingStop(ctx context.Context, pair string, side trader.Side, callbackRate float64) (*trader.Order, error) {
+	return trader.SetTrailingStop(ctx, g.Trader, pair, side, callbackRate)
+}
+
+// PositionMode returns the position mode of the wrapped trader's account
+func (g *Guard) PositionMode(ctx context.Context) (trader.PositionMode, error) {
+	return trader.GetPositionMode(ctx, g.Trader)
+}
+
+// GetTransfers lists the account's deposits and withdrawals through the
+// wrapped trader
+func (g *Guard) GetTransfers(ctx context.Context, since time.Time) ([]trader.Transfer, error) {
+	return trader.GetTransfers(ctx, g.Trader, since)
+}
+
+// GetOrderByClientID looks an order up by its client order ID through the
+// wrapped trader
+func (g *Guard) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*trader.Order, error) {
+	return trader.GetOrderByClientID(ctx, g.Trader, pair, clientOrderID)
+}
+
+// check verifies an order of a strategy, letting reductions of an open
+// position through. Only in single position mode does an order against the
+// open position reduce it; in dual mode it opens the other side, so only
+// reduce-only orders pass unchecked.
+func (g *Guard) check(ctx context.Context, strategy, pair string, side trader.Side, amount, price float64, leverage int64) error {
+	positions, err := g.Trader.GetPositions(ctx)
+	if err != nil {
+		return err
+	}
+	g.limiter.observePositions(g.exchange, positions)
+	mode, err := trader.GetPositionMode(ctx, g.Trader)
+	if err != nil {
+		return err
+	}
+	if mode != trader.DualMode {
+		for _, p := range positions {
+			if p.Pair == pair && p.Side != side && amount <= p.Size {
+				return nil
+			}
+		}
+	}
+
+	if g.engine != nil {
+		if err := g.engine.CheckEntry(pair); err != nil {
+			return err
+		}
+	}
+	if lim := g.limiter.current(); lim.maxDailyLoss > 0 || lim.dailyProfitTarget > 0 {
+		pnl, err := g.DailyPnL(ctx)
+		if err != nil {
+			return err
+		}
+		if err := g.limiter.checkDailyLoss(g.exchange, pnl); err != nil {
+			return err
+		}
+	}
+	if err := g.limiter.checkEntry(g.contracts, pair, side, amount, price, leverage, positions); err != nil {
+		return err
+	}
+	if err := g.checkBucket(pair, amount, price, positions); err != nil {
+		return err
+	}
+	return g.limiter.checkOpenPositions(g.exchange, strategy, pair, side)
+}
+
+// checkBucket verifies that an entry keeps the exposure of its correlation
+// bucket under the risk engine's limit, valuing market orders at the last
+// price
+func (g *Guard) checkBucket(pair string, amount, price float64, positions []trader.Position) error {
+	if g.engine == nil || g.engine.maxBucketNotional <= 0 {
+		return nil
+	}
+	if price <= 0 {
+		last, err := g.limiter.prices.Price(pair)
+		if err != nil {
+			return fmt.Errorf("%s: failed to get price: %v", pair, err)
+		}
+		price = last
+	}
+	notional := trader.Notional(g.contracts, pair, amount, price)
+	return g.engine.CheckBucketExposure(pair, notional, positions, g.contracts)
+}
+
+// DailyPnL returns the day's PnL and records it towards the daily profit
+// target. By default it's the change since the start of the current UTC day
+// of the settlement wallet balance, which excludes unrealized PnL, net of
+// the day's deposits and withdrawals; the starting balance is kept in the
+// baseline store, if any, so it survives restarts. With the "ledger" daily
+// loss source it's the PnL ledger's realized PnL since the start of the day.
+func (g *Guard) DailyPnL(ctx context.Context) (float64, error) {
+	if g.limiter.ledger != nil && g.limiter.current().dailyLossSource == DailyLossLedger {
+		pnl, err := g.limiter.ledger.RealizedSince(g.exchange, g.limiter.midnight())
+		if err != nil {
+			return 0, err
+		}
+		g.limiter.checkDailyProfit(g.exchange, pnl)
+		return pnl, nil
+	}
+
+	balances, err := g.Trader.GetBalance(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var wallet float64
+	for _, b := range balances {
+		if b.Currency == g.limiter.settleCurrency {
+			wallet += b.Wallet()
+		}
+	}
+	transfers, err := g.dayTransfers(ctx)
+
+	g.mu.Lock()
+	if day := g.limiter.today(); day != g.day {
+		g.day, g.dayStart, g.transfers = day, g.baseline(day, wallet-transfers), 0
+	}
+	if err != nil {
+		logger.Warning("Failed to get the %s deposits and withdrawals of the day, using the last read: %v", g.exchange, err)
+	} else {
+		g.transfers = transfers
+	}
+	pnl := wallet - g.dayStart - g.transfers
+	g.mu.Unlock()
+
+	g.limiter.checkDailyProfit(g.exchange, pnl)
+	return pnl, nil
+}
+
+// baseline returns the settlement balance the exchange started day with:
+// the stored one, or else start, which is stored
+func (g *Guard) baseline(day string, start float64) float64 {
+	store := g.limiter.baselines
+	if store == nil {
+		return start
+	}
+	stored, ok, err := store.DayStart(g.exchange, day)
+	if err != nil {
+		logger.Warning("Failed to load the %s starting balance of %s: %v", g.exchange, day, err)
+		return start
+	}
+	if ok {
+		return stored
+	}
+	if err := store.SaveDayStart(g.exchange, day, start); err != nil {
+		logger.Warning("Failed to save the %s starting balance of %s: %v", g.exchange, day, err)
+	}
+	return start
+}
+
+// dayTransfers returns the net of the completed deposits and withdrawals of
+// the settlement currency since the start of the UTC day, or zero when the
+// trader can't list them
+func (g *Guard) dayTransfers(ctx context.Context) (float64, error) {
+	transfers, err := trader.GetTransfers(ctx, g.Trader, g.limiter.midnight())
+	if errors.Is(err, trader.ErrTransfersNotSupported) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var net float64
+	for _, t := range transfers {
+		if t.Completed && strings.EqualFold(t.Currency, g.limiter.settleCurrency) {
+			net += t.Net()
+		}
+	}
+	return net, nil
+}
+
+var _ trader.Trader = (*Guard)(nil)
@@ -0,0 +1,402 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nofx/config"
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+var (
+	// ErrKillSwitch is returned for new entries while the kill switch is engaged
+	ErrKillSwitch = errors.New("kill switch engaged")
+	// ErrPositionLimit is returned when an entry would exceed the per-symbol notional limit
+	ErrPositionLimit = errors.New("position notional limit exceeded")
+	// ErrExposureLimit is returned when an entry would exceed the total exposure limit
+	ErrExposureLimit = errors.New("total exposure limit exceeded")
+	// ErrLeverageLimit is returned when an order requests more than the maximum leverage
+	ErrLeverageLimit = errors.New("leverage limit exceeded")
+	// ErrDailyLoss is returned when the daily realized loss limit has been reached
+	ErrDailyLoss = errors.New("daily loss limit exceeded")
+	// ErrProfitLock is returned for new entries once the daily profit target
+	// has been reached with the stop action
+	ErrProfitLock = errors.New("daily profit target reached")
+)
+
+// Daily profit lock-in actions
+const (
+	// ProfitLockStop allows no new entries for the rest of the day
+	ProfitLockStop = "stop"
+	// ProfitLockHalve halves the position and exposure limits for the rest of the day
+	ProfitLockHalve = "halve"
+)
+
+// IsRejection reports whether an error is a pre-trade limit or risk engine
+// rejection
+func IsRejection(err error) bool {
+	for _, target := range []error{ErrKillSwitch, ErrPositionLimit, ErrExposureLimit, ErrLeverageLimit, ErrDailyLoss, ErrProfitLock, ErrOpenPositionLimit, ErrBlackout,
+		ErrOutsideTradingHours, ErrInsufficientLiquidity, ErrBucketExposure} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// PriceSource provides the last price of a symbol, typically the screener
+type PriceSource interface {
+	Price(pair string) (float64, error)
+}
+
+// PnLSource provides the realized PnL of an exchange since a time, after
+// fees and funding, typically the PnL ledger
+type PnLSource interface {
+	RealizedSince(exchange string, since time.Time) (float64, error)
+}
+
+// BaselineStore persists the settlement balance each exchange started a UTC
+// day with, typically the history store, so a restart doesn't forget the
+// losses taken earlier in the day
+type BaselineStore interface {
+	DayStart(exchange, day string) (float64, bool, error)
+	SaveDayStart(exchange, day string, balance float64) error
+}
+
+// Daily loss sources
+const (
+	// DailyLossBalance measures the day's PnL as the change of the settlement balance
+	DailyLossBalance = "balance"
+	// DailyLossLedger measures the day's PnL with the PnL ledger
+	DailyLossLedger = "ledger"
+)
+
+// KillSwitch represents the state of the kill switch
+type KillSwitch struct {
+	Engaged bool      `json:"engaged"`
+	Reason  string    `json:"reason,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// ProfitLock represents the daily profit lock-in of a UTC day
+type ProfitLock struct {
+	Day string `json:"day"`
+	// PnL is the realized PnL of the day summed across exchanges, as last sampled
+	PnL    float64 `json:"pnl"`
+	Target float64 `json:"target"`
+	// Engaged reports whether the target was reached, after which Action
+	// applies until the end of the day
+	Engaged bool      `json:"engaged"`
+	Action  string    `json:"action,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// Limiter enforces pre-trade limits on orders opening or increasing a
+// position and owns the kill switch blocking new entries
+type Limiter struct {
+	settleCurrency string
+	prices         PriceSource
+	now            func() time.Time
+	ledger         PnLSource
+	baselines      BaselineStore
+
+	mu     sync.RWMutex
+	limits limits
+	killed KillSwitch
+	// daily holds the realized PnL of the day per exchange behind profit;
+	// previous is the lock-in of the day before
+	daily    map[string]float64
+	profit   ProfitLock
+	previous *ProfitLock
+	// open holds the open positions per exchange and owners the strategy
+	// behind each position opened through the guard, by position key
+	open   map[string]map[string]bool
+	owners map[string]positionOwner
+	// base holds the risk configuration the active profile applies over
+	base      config.RiskConfig
+	profiles  map[string]config.RiskProfileConfig
+	active    ActiveProfile
+	blackouts []hourWindow
+	onProfile func(ActiveProfile)
+	// onKillSwitch is called when the kill switch is engaged or released
+	onKillSwitch func(KillSwitch)
+}
+
+// limits represents the configured pre-trade limits; zero disables a limit
+type limits struct {
+	maxPositionNotional float64
+	maxTotalExposure    float64
+	maxLeverage         int64
+	maxDailyLoss        float64
+	dailyLossSource     string
+	dailyProfitTarget   float64
+	dailyProfitAction   string
+	// maxOpenPositions caps the positions open at once across exchanges,
+	// maxStrategyPositions the positions opened by each strategy
+	maxOpenPositions     int
+	maxStrategyPositions map[string]int
+	openPositionAction   string
+	openPositionQueue    time.Duration
+}
+
+// limitsFrom returns the pre-trade limits of a risk configuration
+func limitsFrom(cfg config.RiskConfig) limits {
+	return limits{
+		maxPositionNotional: cfg.MaxPositionNotional,
+		maxTotalExposure:    cfg.MaxTotalExposure,
+		maxLeverage:         cfg.MaxLeverage,
+		maxDailyLoss:        cfg.MaxDailyLoss,
+		dailyLossSource:     cfg.DailyLossSource,
+		dailyProfitTarget:   cfg.DailyProfitTarget,
+		dailyProfitAction:   cfg.DailyProfitAction,
+
+		maxOpenPositions:     cfg.MaxOpenPositions,
+		maxStrategyPositions: copyLimits(cfg.MaxStrategyPositions),
+		openPositionAction:   cfg.OpenPositionAction,
+		openPositionQueue:    time.Duration(cfg.OpenPositionQueueTimeout) * time.Second,
+	}
+}
+
+// NewLimiter creates a new limiter from configuration; the kill switch starts
+// engaged when configured so
+func NewLimiter(cfg config.RiskConfig, prices PriceSource) *Limiter {
+	l := &Limiter{
+		settleCurrency: cfg.SettleCurrency,
+		prices:         prices,
+		now:            time.Now,
+		limits:         limitsFrom(cfg),
+		base:           cfg,
+		profiles:       cfg.Profiles,
+	}
+	l.active = ActiveProfile{Name: cfg.Profile, Source: ProfileSourceConfig, Since: l.now()}
+	l.applyProfile()
+	if cfg.Profile != "" {
+		logger.Info("Risk profile %s in force", cfg.Profile)
+	}
+	if cfg.KillSwitch {
+		l.Engage("engaged at startup")
+	}
+	return l
+}
+
+// SetLimits replaces the position, exposure, leverage, daily loss and open
+// position limits and the daily profit target, as on a configuration reload; the kill switch,
+// an engaged profit lock-in and the active risk profile keep their state
+func (l *Limiter) SetLimits(cfg config.RiskConfig) {
+	l.mu.Lock()
+	l.limits = limitsFrom(cfg)
+	l.base = cfg
+	l.applyProfile()
+	active, hook := l.active, l.onProfile
+	l.mu.Unlock()
+	if hook != nil {
+		hook(active)
+	}
+}
+
+// current returns the limits in force
+func (l *Limiter) current() limits {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.limits
+}
+
+// SetPnLSource sets the PnL ledger measuring the day's realized PnL when
+// the daily loss source is "ledger"; it's set once at startup
+func (l *Limiter) SetPnLSource(ledger PnLSource) {
+	l.ledger = ledger
+}
+
+// SetBaselineStore sets the store persisting the daily starting balances
+// of the "balance" daily loss source; it's set once at startup
+func (l *Limiter) SetBaselineStore(baselines BaselineStore) {
+	l.baselines = baselines
+}
+
+// Engage blocks new entries until Release is called
+func (l *Limiter) Engage(reason string) {
+	l.mu.Lock()
+	if l.killed.Engaged {
+		l.mu.Unlock()
+		return
+	}
+	l.killed = KillSwitch{Engaged: true, Reason: reason, Since: l.now()}
+	killed, hook := l.killed, l.onKillSwitch
+	l.mu.Unlock()
+	logger.Log(logger.ErrorLevel, logger.MsgKillSwitchEngaged, "reason", reason)
+	if hook != nil {
+		hook(killed)
+	}
+}
+
+// Release allows new entries again
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	engaged, hook := l.killed.Engaged, l.onKillSwitch
+	l.killed = KillSwitch{}
+	l.mu.Unlock()
+	if !engaged {
+		return
+	}
+	logger.Log(logger.WarningLevel, logger.MsgKillSwitchReleased)
+	if hook != nil {
+		hook(KillSwitch{})
+	}
+}
+
+// OnKillSwitch sets a function called with the state of the kill switch
+// whenever it's engaged or released; it's set once at startup
+func (l *Limiter) OnKillSwitch(fn func(KillSwitch)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onKillSwitch = fn
+}
+
+// KillSwitch returns the state of the kill switch
+func (l *Limiter) KillSwitch() KillSwitch {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.killed
+}
+
+// checkEntry verifies an order opening or increasing a position on pair
+// against the kill switch, the blackouts of the risk profile and the
+// leverage, position and exposure limits; notionals are valued with the
+// contract sizes of contracts
+func (l *Limiter) checkEntry(contracts trader.ContractSource, pair string, side trader.Side, amount, price float64, leverage int64, positions []trader.Position) error {
+	if ks := l.KillSwitch(); ks.Engaged {
+		return fmt.Errorf("%w: %s", ErrKillSwitch, ks.Reason)
+	}
+	if w, ok := l.blackout(l.now()); ok {
+		return fmt.Errorf("%s: %w (%s UTC in the %s profile)", pair, ErrBlackout, w, l.Profile().Name)
+	}
+	lim := l.current()
+	if lock := l.ProfitLock(); lock.Engaged {
+		if lock.Action != ProfitLockHalve {
+			return fmt.Errorf("%s: %w (%.2f >= %.2f %s), no new entries until the next UTC day",
+				pair, ErrProfitLock, lock.PnL, lock.Target, l.settleCurrency)
+		}
+		lim.maxPositionNotional /= 2
+		lim.maxTotalExposure /= 2
+	}
+	if lim.maxLeverage > 0 && leverage > lim.maxLeverage {
+		return fmt.Errorf("%s: %w (%dx > %dx)", pair, ErrLeverageLimit, leverage, lim.maxLeverage)
+	}
+	if lim.maxPositionNotional <= 0 && lim.maxTotalExposure <= 0 {
+		return nil
+	}
+
+	if price <= 0 {
+		last, err := l.prices.Price(pair)
+		if err != nil {
+			return fmt.Errorf("%s: failed to get price: %v", pair, err)
+		}
+		price = last
+	}
+	notional := trader.Notional(contracts, pair, amount, price)
+
+	position, exposure := notional, notional
+	for _, p := range positions {
+		value := trader.Notional(contracts, p.Pair, p.Size, p.MarkPrice)
+		exposure += value
+		if p.Pair == pair && p.Side == side {
+			position += value
+		}
+	}
+
+	if lim.maxPositionNotional > 0 && position > lim.maxPositionNotional {
+		return fmt.Errorf("%s: %w (%.2f > %.2f)", pair, ErrPositionLimit, position, lim.maxPositionNotional)
+	}
+	if lim.maxTotalExposure > 0 && exposure > lim.maxTotalExposure {
+		return fmt.Errorf("%s: %w (%.2f > %.2f)", pair, ErrExposureLimit, exposure, lim.maxTotalExposure)
+	}
+	return nil
+}
+
+// checkDailyLoss engages the kill switch when a realized loss reaches the limit
+func (l *Limiter) checkDailyLoss(exchange string, pnl float64) error {
+	maxDailyLoss := l.current().maxDailyLoss
+	if maxDailyLoss <= 0 || -pnl < maxDailyLoss {
+		return nil
+	}
+	err := fmt.Errorf("%s: %w (%.2f >= %.2f %s)", exchange, ErrDailyLoss, -pnl, maxDailyLoss, l.settleCurrency)
+	l.Engage(err.Error())
+	return err
+}
+
+// today returns the current UTC day
+func (l *Limiter) today() string {
+	return l.now().UTC().Format("2006-01-02")
+}
+
+// midnight returns the start of the current UTC day
+func (l *Limiter) midnight() time.Time {
+	now := l.now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ProfitLock returns the daily profit lock-in of the current UTC day
+func (l *Limiter) ProfitLock() ProfitLock {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if day := l.today(); l.profit.Day != day {
+		return ProfitLock{Day: day, Target: l.limits.dailyProfitTarget}
+	}
+	return l.profit
+}
+
+// ProfitLocks returns the daily profit lock-in of the previous UTC day, when
+// one was sampled, followed by the current one
+func (l *Limiter) ProfitLocks() []ProfitLock {
+	current := l.ProfitLock()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	locks := []ProfitLock{}
+	if l.profit.Day != "" && l.profit.Day != current.Day {
+		// No sample since the day rolled over
+		locks = append(locks, l.profit)
+	} else if l.previous != nil {
+		locks = append(locks, *l.previous)
+	}
+	return append(locks, current)
+}
+
+// checkDailyProfit records the realized PnL of the day on an exchange and
+// engages the profit lock-in once the total reaches the target; it stays
+// engaged until the day ends
+func (l *Limiter) checkDailyProfit(exchange string, pnl float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if day := l.today(); l.profit.Day != day {
+		if l.profit.Day != "" {
+			previous := l.profit
+			l.previous = &previous
+		}
+		l.daily = make(map[string]float64)
+		l.profit = ProfitLock{Day: day}
+	}
+	l.daily[exchange] = pnl
+	var total float64
+	for _, p := range l.daily {
+		total += p
+	}
+	l.profit.PnL = total
+	if l.profit.Engaged {
+		return
+	}
+	l.profit.Target = l.limits.dailyProfitTarget
+	if l.profit.Target <= 0 || total < l.profit.Target {
+		return
+	}
+	l.profit.Engaged, l.profit.Action, l.profit.Since = true, l.limits.dailyProfitAction, l.now()
+	effect := "no new entries"
+	if l.profit.Action == ProfitLockHalve {
+		effect = "position and exposure limits halved"
+	}
+	logger.Log(logger.WarningLevel, logger.MsgProfitLockEngaged,
+		"pnl", fmt.Sprintf("%.2f", total), "target", fmt.Sprintf("%.2f", l.profit.Target),
+		"currency", l.settleCurrency, "effect", effect)
+}
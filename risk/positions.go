@@ -0,0 +1,187 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nofx/trader"
+)
+
+// ErrOpenPositionLimit is returned when an entry would open a position
+// beyond the global or its strategy's open position limit
+var ErrOpenPositionLimit = errors.New("open position limit reached")
+
+// Open position limit actions
+const (
+	// OpenPositionReject rejects entries beyond a limit
+	OpenPositionReject = "reject"
+	// OpenPositionQueue holds entries beyond a limit until a position closes
+	OpenPositionQueue = "queue"
+)
+
+// pendingEntryTTL is how long an entry counts towards its strategy's open
+// positions before its position shows up, e.g. while a limit order rests
+const pendingEntryTTL = 10 * time.Minute
+
+// OpenPositionLimitError reports the open position limit an entry hit
+type OpenPositionLimitError struct {
+	// Strategy is the strategy whose limit was hit, empty for the global limit
+	Strategy string
+	Open     int
+	Limit    int
+}
+
+// Error implements the error interface
+func (e *OpenPositionLimitError) Error() string {
+	if e.Strategy == "" {
+		return fmt.Sprintf("%v (%d of %d open)", ErrOpenPositionLimit, e.Open, e.Limit)
+	}
+	return fmt.Sprintf("%v for strategy %s (%d of %d open)", ErrOpenPositionLimit, e.Strategy, e.Open, e.Limit)
+}
+
+// Unwrap returns ErrOpenPositionLimit
+func (e *OpenPositionLimitError) Unwrap() error {
+	return ErrOpenPositionLimit
+}
+
+// OpenPositions represents the open position limits and counts
+type OpenPositions struct {
+	Max        int            `json:"max_open_positions"`
+	Strategies map[string]int `json:"max_strategy_positions"`
+	Action     string         `json:"open_position_action"`
+	Open       int            `json:"open"`
+	ByStrategy map[string]int `json:"by_strategy"`
+}
+
+// positionOwner records the strategy that opened a position on an exchange;
+// a position not yet seen open is pending since the entry
+type positionOwner struct {
+	exchange string
+	strategy string
+	seen     bool
+	since    time.Time
+}
+
+// positionKey identifies a position across exchanges
+func positionKey(exchange, pair string, side trader.Side) string {
+	return exchange + "|" + pair + "|" + string(side)
+}
+
+// observePositions records the open positions of an exchange, releasing the
+// slots of the positions that closed
+func (l *Limiter) observePositions(exchange string, positions []trader.Position) {
+	open := make(map[string]bool, len(positions))
+	for _, p := range positions {
+		if p.Size > 0 {
+			open[positionKey(exchange, p.Pair, p.Side)] = true
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open == nil {
+		l.open = make(map[string]map[string]bool)
+	}
+	l.open[exchange] = open
+	now := l.now()
+	for key, owner := range l.owners {
+		if owner.exchange != exchange {
+			continue
+		}
+		switch {
+		case open[key]:
+			owner.seen = true
+			l.owners[key] = owner
+		case owner.seen || now.Sub(owner.since) > pendingEntryTTL:
+			delete(l.owners, key)
+		}
+	}
+}
+
+// recordEntry records an entry placed by a strategy, so its position counts
+// towards the strategy's limit before it shows up
+func (l *Limiter) recordEntry(exchange, strategy, pair string, side trader.Side) {
+	if strategy == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := positionKey(exchange, pair, side)
+	if _, ok := l.owners[key]; ok {
+		return
+	}
+	if l.owners == nil {
+		l.owners = make(map[string]positionOwner)
+	}
+	l.owners[key] = positionOwner{exchange: exchange, strategy: strategy, since: l.now()}
+}
+
+// counts returns the number of open positions, pending entries included,
+// and the number per strategy. The caller must hold the lock.
+func (l *Limiter) counts() (int, map[string]int) {
+	open := 0
+	for _, positions := range l.open {
+		open += len(positions)
+	}
+	byStrategy := make(map[string]int)
+	for key, owner := range l.owners {
+		byStrategy[owner.strategy]++
+		if !l.open[owner.exchange][key] {
+			open++
+		}
+	}
+	return open, byStrategy
+}
+
+// checkOpenPositions verifies that an entry adds to an open or pending
+// position, or opens one within the global and its strategy's limit
+func (l *Limiter) checkOpenPositions(exchange, strategy, pair string, side trader.Side) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	key := positionKey(exchange, pair, side)
+	if _, ok := l.owners[key]; ok || l.open[exchange][key] {
+		return nil
+	}
+
+	open, byStrategy := l.counts()
+	if max := l.limits.maxOpenPositions; max > 0 && open >= max {
+		return &OpenPositionLimitError{Open: open, Limit: max}
+	}
+	if max := l.limits.maxStrategyPositions[strategy]; strategy != "" && max > 0 && byStrategy[strategy] >= max {
+		return &OpenPositionLimitError{Strategy: strategy, Open: byStrategy[strategy], Limit: max}
+	}
+	return nil
+}
+
+// SetOpenPositionLimits replaces the global and per-strategy open position
+// limits until the next configuration reload; zero disables a limit
+func (l *Limiter) SetOpenPositionLimits(max int, strategies map[string]int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits.maxOpenPositions = max
+	l.limits.maxStrategyPositions = copyLimits(strategies)
+}
+
+// OpenPositions returns the open position limits and counts
+func (l *Limiter) OpenPositions() OpenPositions {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	open, byStrategy := l.counts()
+	return OpenPositions{
+		Max:        l.limits.maxOpenPositions,
+		Strategies: copyLimits(l.limits.maxStrategyPositions),
+		Action:     l.limits.openPositionAction,
+		Open:       open,
+		ByStrategy: byStrategy,
+	}
+}
+
+// copyLimits returns a copy of per-strategy limits
+func copyLimits(limits map[string]int) map[string]int {
+	copied := make(map[string]int, len(limits))
+	for name, max := range limits {
+		copied[name] = max
+	}
+	return copied
+}
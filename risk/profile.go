@@ -0,0 +1,80 @@
+package risk
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nofx/config"
+)
+
+// hourWindow represents an allowed entry window in minutes since midnight UTC
+type hourWindow struct {
+	start int
+	end   int
+}
+
+// contains reports whether a minute of the day falls inside the window,
+// handling windows that wrap past midnight
+func (w hourWindow) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// symbolProfile represents the parsed trading hours and liquidity rules for a symbol
+type symbolProfile struct {
+	windows      []hourWindow
+	minVolume24h float64
+}
+
+// allowsEntryAt reports whether new entries are allowed at t
+func (p *symbolProfile) allowsEntryAt(t time.Time) bool {
+	if len(p.windows) == 0 {
+		return true
+	}
+	t = t.UTC()
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range p.windows {
+		if w.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProfile parses a symbol profile from configuration
+func parseProfile(cfg config.SymbolProfile) (*symbolProfile, error) {
+	profile := &symbolProfile{minVolume24h: cfg.MinVolume24h}
+	for _, window := range cfg.EntryHours {
+		w, err := parseWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		profile.windows = append(profile.windows, w)
+	}
+	return profile, nil
+}
+
+// parseWindow parses an "HH:MM-HH:MM" UTC window
+func parseWindow(s string) (hourWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return hourWindow{}, fmt.Errorf("invalid entry window %q, expected HH:MM-HH:MM", s)
+	}
+
+	start, err := time.Parse("15:04", strings.TrimSpace(parts[0]))
+	if err != nil {
+		return hourWindow{}, fmt.Errorf("invalid entry window %q: %v", s, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(parts[1]))
+	if err != nil {
+		return hourWindow{}, fmt.Errorf("invalid entry window %q: %v", s, err)
+	}
+
+	return hourWindow{
+		start: start.Hour()*60 + start.Minute(),
+		end:   end.Hour()*60 + end.Minute(),
+	}, nil
+}
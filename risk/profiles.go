@@ -0,0 +1,309 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nofx/config"
+	"github.com/nofx/logger"
+)
+
+var (
+	// ErrBlackout is returned for new entries during a blackout window of the
+	// active risk profile
+	ErrBlackout = errors.New("risk profile blackout")
+	// ErrUnknownProfile is returned when switching to a risk profile that
+	// isn't configured
+	ErrUnknownProfile = errors.New("unknown risk profile")
+)
+
+// Risk profile switch sources
+const (
+	ProfileSourceConfig   = "config"
+	ProfileSourceAdmin    = "admin"
+	ProfileSourceSchedule = "schedule"
+)
+
+// ProfileLimits represents the limits a risk profile puts in force; a zero
+// SizingFraction keeps the configured sizing fraction
+type ProfileLimits struct {
+	MaxLeverage         int64    `json:"max_leverage"`
+	MaxPositionNotional float64  `json:"max_position_notional"`
+	MaxTotalExposure    float64  `json:"max_total_exposure"`
+	SizingFraction      float64  `json:"sizing_fraction,omitempty"`
+	Blackouts           []string `json:"blackouts,omitempty"`
+}
+
+// ActiveProfile represents the risk profile in force; an empty Name stands
+// for the base limits of the risk configuration
+type ActiveProfile struct {
+	Name   string        `json:"name"`
+	Source string        `json:"source"`
+	Since  time.Time     `json:"since"`
+	Limits ProfileLimits `json:"limits"`
+}
+
+// RiskState represents the state of the pre-trade limits
+type RiskState struct {
+	KillSwitch    KillSwitch    `json:"kill_switch"`
+	ProfitLock    ProfitLock    `json:"profit_lock"`
+	OpenPositions OpenPositions `json:"open_positions"`
+	Profile       ActiveProfile `json:"profile"`
+	Profiles      []string      `json:"profiles"`
+	// Blackout is the blackout window of the active profile in force, if any
+	Blackout string `json:"blackout,omitempty"`
+}
+
+// String formats the window as "HH:MM-HH:MM"
+func (w hourWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+// profileLimits returns the limits of a profile over the base limits of a
+// risk configuration
+func profileLimits(base config.RiskConfig, p config.RiskProfileConfig) ProfileLimits {
+	lim := ProfileLimits{
+		MaxLeverage:         base.MaxLeverage,
+		MaxPositionNotional: base.MaxPositionNotional,
+		MaxTotalExposure:    base.MaxTotalExposure,
+		SizingFraction:      p.SizingFraction,
+		Blackouts:           p.Blackouts,
+	}
+	if p.MaxLeverage > 0 {
+		lim.MaxLeverage = p.MaxLeverage
+	}
+	if p.MaxPositionNotional > 0 {
+		lim.MaxPositionNotional = p.MaxPositionNotional
+	}
+	if p.MaxTotalExposure > 0 {
+		lim.MaxTotalExposure = p.MaxTotalExposure
+	}
+	return lim
+}
+
+// applyProfile puts the limits of the active profile in force; the caller
+// must hold the lock
+func (l *Limiter) applyProfile() {
+	lim := profileLimits(l.base, l.profiles[l.active.Name])
+	l.active.Limits = lim
+	l.limits.maxLeverage = lim.MaxLeverage
+	l.limits.maxPositionNotional = lim.MaxPositionNotional
+	l.limits.maxTotalExposure = lim.MaxTotalExposure
+
+	l.blackouts = l.blackouts[:0]
+	for _, window := range lim.Blackouts {
+		w, err := parseWindow(window)
+		if err != nil {
+			logger.Warning("Ignoring blackout of risk profile %s: %v", l.active.Name, err)
+			continue
+		}
+		l.blackouts = append(l.blackouts, w)
+	}
+}
+
+// SetProfile switches to a configured risk profile, or back to the base
+// limits with an empty name; source records who switched. The kill switch,
+// the profit lock-in and the open position limits keep their state.
+func (l *Limiter) SetProfile(name, source string) error {
+	l.mu.Lock()
+	if _, ok := l.profiles[name]; name != "" && !ok {
+		l.mu.Unlock()
+		return fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+	previous := l.active.Name
+	l.active = ActiveProfile{Name: name, Source: source, Since: l.now()}
+	l.applyProfile()
+	active, hook := l.active, l.onProfile
+	l.mu.Unlock()
+
+	logger.With("profile", name, "previous", previous, "source", source).
+		Warning("Risk profile switched from %s to %s by %s", profileName(previous), profileName(name), source)
+	if hook != nil {
+		hook(active)
+	}
+	return nil
+}
+
+// profileName returns the display name of a risk profile
+func profileName(name string) string {
+	if name == "" {
+		return "base limits"
+	}
+	return name
+}
+
+// Profile returns the risk profile in force
+func (l *Limiter) Profile() ActiveProfile {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.active
+}
+
+// Profiles returns the names of the configured risk profiles, sorted
+func (l *Limiter) Profiles() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	names := make([]string, 0, len(l.profiles))
+	for name := range l.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OnProfile sets a function called with the profile in force whenever it
+// switches or the base limits change; it's set once at startup
+func (l *Limiter) OnProfile(fn func(ActiveProfile)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onProfile = fn
+}
+
+// blackout returns the blackout window of the active profile containing t
+func (l *Limiter) blackout(t time.Time) (hourWindow, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	t = t.UTC()
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range l.blackouts {
+		if w.contains(minute) {
+			return w, true
+		}
+	}
+	return hourWindow{}, false
+}
+
+// State returns the kill switch, the profit lock-in, the open positions and
+// the risk profile in force
+func (l *Limiter) State() RiskState {
+	state := RiskState{
+		KillSwitch:    l.KillSwitch(),
+		ProfitLock:    l.ProfitLock(),
+		OpenPositions: l.OpenPositions(),
+		Profile:       l.Profile(),
+		Profiles:      l.Profiles(),
+	}
+	if w, ok := l.blackout(l.now()); ok {
+		state.Blackout = w.String()
+	}
+	return state
+}
+
+// profileSwitch represents a scheduled switch at a minute of the UTC day
+type profileSwitch struct {
+	minute  int
+	profile string
+}
+
+// profileScheduleCheck is how often the profile schedule is checked
+const profileScheduleCheck = 30 * time.Second
+
+// ProfileScheduler switches the risk profile of a limiter at scheduled UTC
+// times of day. A switch through the admin API holds until the next
+// scheduled one.
+type ProfileScheduler struct {
+	limits *Limiter
+
+	mu       sync.Mutex
+	switches []profileSwitch
+	last     time.Time
+	stop     chan struct{}
+}
+
+// NewProfileScheduler creates a new profile scheduler
+func NewProfileScheduler(limits *Limiter, schedule []config.ProfileSwitch) *ProfileScheduler {
+	s := &ProfileScheduler{limits: limits}
+	s.SetSchedule(schedule)
+	return s
+}
+
+// SetSchedule replaces the schedule, as on a configuration reload
+func (s *ProfileScheduler) SetSchedule(schedule []config.ProfileSwitch) {
+	switches := make([]profileSwitch, 0, len(schedule))
+	for _, sw := range schedule {
+		at, err := time.Parse("15:04", sw.At)
+		if err != nil {
+			logger.Warning("Ignoring risk profile switch at %q: %v", sw.At, err)
+			continue
+		}
+		switches = append(switches, profileSwitch{minute: at.Hour()*60 + at.Minute(), profile: sw.Profile})
+	}
+	sort.SliceStable(switches, func(i, j int) bool { return switches[i].minute < switches[j].minute })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.switches = switches
+}
+
+// Start checks the schedule in the background
+func (s *ProfileScheduler) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.last = time.Now()
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(profileScheduleCheck)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.Check(now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the schedule
+func (s *ProfileScheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Check switches to the profile of the latest scheduled switch due since the
+// previous check
+func (s *ProfileScheduler) Check(now time.Time) {
+	s.mu.Lock()
+	last := s.last
+	s.last = now
+	due := ""
+	found := false
+	for _, sw := range s.switches {
+		if at := scheduledAt(sw.minute, now); at.After(last) && !at.After(now) {
+			due, found = sw.profile, true
+		}
+	}
+	s.mu.Unlock()
+
+	if !found || s.limits.Profile().Name == due {
+		return
+	}
+	if err := s.limits.SetProfile(due, ProfileSourceSchedule); err != nil {
+		logger.Warning("Scheduled risk profile switch failed: %v", err)
+	}
+}
+
+// scheduledAt returns the latest time at or before now falling on a minute
+// of the UTC day
+func scheduledAt(minute int, now time.Time) time.Time {
+	now = now.UTC()
+	at := time.Date(now.Year(), now.Month(), now.Day(), minute/60, minute%60, 0, 0, time.UTC)
+	if at.After(now) {
+		at = at.AddDate(0, 0, -1)
+	}
+	return at
+}
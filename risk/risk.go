@@ -0,0 +1,78 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nofx/config"
+)
+
+var (
+	// ErrOutsideTradingHours is returned when an entry is attempted outside the symbol's allowed hours
+	ErrOutsideTradingHours = errors.New("outside allowed trading hours")
+	// ErrInsufficientLiquidity is returned when the symbol's 24h volume is below the configured minimum
+	ErrInsufficientLiquidity = errors.New("insufficient 24h volume")
+)
+
+// VolumeSource provides 24h quote volume for a symbol, typically the screener
+type VolumeSource interface {
+	Volume24h(pair string) (float64, error)
+}
+
+// Engine enforces risk rules before new positions are opened
+type Engine struct {
+	profiles          map[string]*symbolProfile
+	volumes           VolumeSource
+	maxBucketNotional float64
+	now               func() time.Time
+
+	mu          sync.RWMutex
+	buckets     [][]string
+	bucketIndex map[string]int
+}
+
+// NewEngine creates a new risk engine from configuration
+func NewEngine(cfg config.RiskConfig, volumes VolumeSource) (*Engine, error) {
+	e := &Engine{
+		profiles:          make(map[string]*symbolProfile, len(cfg.Symbols)),
+		volumes:           volumes,
+		maxBucketNotional: cfg.MaxBucketNotional,
+		now:               time.Now,
+	}
+
+	for pair, profileCfg := range cfg.Symbols {
+		profile, err := parseProfile(profileCfg)
+		if err != nil {
+			return nil, fmt.Errorf("risk.symbols.%s: %v", pair, err)
+		}
+		e.profiles[pair] = profile
+	}
+
+	return e, nil
+}
+
+// CheckEntry verifies that a new position may be opened on a pair right now
+func (e *Engine) CheckEntry(pair string) error {
+	profile, ok := e.profiles[pair]
+	if !ok {
+		return nil
+	}
+
+	if !profile.allowsEntryAt(e.now()) {
+		return fmt.Errorf("%s: %w", pair, ErrOutsideTradingHours)
+	}
+
+	if profile.minVolume24h > 0 && e.volumes != nil {
+		volume, err := e.volumes.Volume24h(pair)
+		if err != nil {
+			return fmt.Errorf("%s: failed to get 24h volume: %v", pair, err)
+		}
+		if volume < profile.minVolume24h {
+			return fmt.Errorf("%s: %w (%.2f < %.2f)", pair, ErrInsufficientLiquidity, volume, profile.minVolume24h)
+		}
+	}
+
+	return nil
+}
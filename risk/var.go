@@ -0,0 +1,229 @@
+package risk
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nofx/indicators"
+	"github.com/nofx/market"
+	"github.com/nofx/trader"
+)
+
+// CandleSource provides historical candles, typically the candle store
+type CandleSource interface {
+	Get(pair, interval string, limit int) ([]market.CandleData, error)
+}
+
+// Scenario represents a stress scenario applying instantaneous price shocks;
+// BTC applies to BTC pairs and Alts to every other pair
+type Scenario struct {
+	Name string  `json:"name"`
+	BTC  float64 `json:"btc"`
+	Alts float64 `json:"alts"`
+}
+
+// DefaultScenarios are the predefined stress scenarios
+var DefaultScenarios = []Scenario{
+	{Name: "BTC -20%", BTC: -0.20},
+	{Name: "Alts -40%", Alts: -0.40},
+	{Name: "BTC -20%, alts -40%", BTC: -0.20, Alts: -0.40},
+}
+
+// Shock returns the relative price move the scenario applies to a pair
+func (s Scenario) Shock(pair string) float64 {
+	if isBTC(pair) {
+		return s.BTC
+	}
+	return s.Alts
+}
+
+// isBTC reports whether a pair's base currency is BTC
+func isBTC(pair string) bool {
+	base := strings.ToUpper(pair)
+	if i := strings.IndexAny(base, "_-/"); i >= 0 {
+		base = base[:i]
+	}
+	return base == "BTC" || base == "XBT"
+}
+
+// StressResult represents the portfolio PnL under a stress scenario
+type StressResult struct {
+	Scenario Scenario `json:"scenario"`
+	PnL      float64  `json:"pnl"`
+}
+
+// Exposure represents the signed notional held on a pair; shorts are negative
+type Exposure struct {
+	Pair     string  `json:"currency_pair"`
+	Notional float64 `json:"notional"`
+}
+
+// VaRReport represents the value at risk and stress results of a portfolio.
+// VaR figures are positive losses over one candle interval.
+type VaRReport struct {
+	Confidence    float64        `json:"confidence"`
+	Interval      string         `json:"interval"`
+	Window        int            `json:"window"`
+	Observations  int            `json:"observations"`
+	GrossExposure float64        `json:"gross_exposure"`
+	NetExposure   float64        `json:"net_exposure"`
+	Parametric    float64        `json:"parametric_var"`
+	Historical    float64        `json:"historical_var"`
+	Exposures     []Exposure     `json:"exposures"`
+	Stress        []StressResult `json:"stress"`
+	Timestamp     time.Time      `json:"timestamp"`
+}
+
+// VaRCalculator computes portfolio VaR from historical candles
+type VaRCalculator struct {
+	candles    CandleSource
+	confidence float64
+	interval   string
+	window     int
+	scenarios  []Scenario
+}
+
+// NewVaRCalculator creates a new VaR calculator
+func NewVaRCalculator(candles CandleSource, confidence float64, interval string, window int) *VaRCalculator {
+	return &VaRCalculator{
+		candles:    candles,
+		confidence: confidence,
+		interval:   interval,
+		window:     window,
+		scenarios:  DefaultScenarios,
+	}
+}
+
+// Compute computes VaR and stress results for the given positions, valued
+// with the contract sizes of their exchange's contracts
+func (c *VaRCalculator) Compute(positions []trader.Position, contracts trader.ContractSource) (*VaRReport, error) {
+	exposures := netExposures(positions, contracts)
+	report := &VaRReport{
+		Confidence: c.confidence,
+		Interval:   c.interval,
+		Window:     c.window,
+		Exposures:  exposures,
+		Stress:     Stress(exposures, c.scenarios),
+		Timestamp:  time.Now(),
+	}
+	for _, e := range exposures {
+		report.GrossExposure += math.Abs(e.Notional)
+		report.NetExposure += e.Notional
+	}
+	if len(exposures) == 0 {
+		return report, nil
+	}
+
+	series := make([]map[int64]float64, len(exposures))
+	for i, e := range exposures {
+		candles, err := c.candles.Get(e.Pair, c.interval, c.window+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Pair, err)
+		}
+		series[i] = make(map[int64]float64, len(candles))
+		for _, candle := range candles {
+			series[i][candle.Timestamp] = candle.Close
+		}
+	}
+
+	pnl := portfolioPnL(exposures, series)
+	report.Observations = len(pnl)
+	report.Parametric = ParametricVaR(pnl, c.confidence)
+	report.Historical = HistoricalVaR(pnl, c.confidence)
+	return report, nil
+}
+
+// netExposures aggregates positions into signed notional per pair
+func netExposures(positions []trader.Position, contracts trader.ContractSource) []Exposure {
+	notional := make(map[string]float64)
+	for _, p := range positions {
+		value := trader.Notional(contracts, p.Pair, p.Size, p.MarkPrice)
+		if p.Side == trader.SellSide {
+			value = -value
+		}
+		notional[p.Pair] += value
+	}
+
+	exposures := make([]Exposure, 0, len(notional))
+	for pair, value := range notional {
+		if value != 0 {
+			exposures = append(exposures, Exposure{Pair: pair, Notional: value})
+		}
+	}
+	sort.Slice(exposures, func(i, j int) bool { return exposures[i].Pair < exposures[j].Pair })
+	return exposures
+}
+
+// portfolioPnL returns the PnL the current exposures would have made over each
+// historical interval, using only timestamps present for every pair
+func portfolioPnL(exposures []Exposure, series []map[int64]float64) []float64 {
+	var timestamps []int64
+	for ts := range series[0] {
+		common := true
+		for _, s := range series[1:] {
+			if _, ok := s[ts]; !ok {
+				common = false
+				break
+			}
+		}
+		if common {
+			timestamps = append(timestamps, ts)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	if len(timestamps) < 2 {
+		return nil
+	}
+
+	pnl := make([]float64, len(timestamps)-1)
+	for i, e := range exposures {
+		closes := make([]float64, len(timestamps))
+		for j, ts := range timestamps {
+			closes[j] = series[i][ts]
+		}
+		for j, r := range indicators.Returns(closes) {
+			pnl[j] += e.Notional * r
+		}
+	}
+	return pnl
+}
+
+// ParametricVaR returns the variance-covariance VaR of a PnL series assuming
+// normally distributed returns
+func ParametricVaR(pnl []float64, confidence float64) float64 {
+	if len(pnl) < 2 {
+		return 0
+	}
+	z := math.Sqrt2 * math.Erfinv(2*confidence-1)
+	return math.Max(0, z*indicators.StdDev(pnl)-indicators.Mean(pnl))
+}
+
+// HistoricalVaR returns the loss at the (1 - confidence) quantile of a PnL series
+func HistoricalVaR(pnl []float64, confidence float64) float64 {
+	if len(pnl) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), pnl...)
+	sort.Float64s(sorted)
+
+	i := int(math.Floor((1 - confidence) * float64(len(sorted))))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return math.Max(0, -sorted[i])
+}
+
+// Stress returns the PnL of the exposures under each scenario
+func Stress(exposures []Exposure, scenarios []Scenario) []StressResult {
+	results := make([]StressResult, len(scenarios))
+	for i, s := range scenarios {
+		results[i].Scenario = s
+		for _, e := range exposures {
+			results[i].PnL += e.Notional * s.Shock(e.Pair)
+		}
+	}
+	return results
+}
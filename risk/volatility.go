@@ -0,0 +1,320 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nofx/indicators"
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// VolatilityPolicy represents when entries trade at reduced leverage: once a
+// pair's realized volatility, the standard deviation of the returns over
+// Window candles of Interval, rises above Threshold, its leverage is scaled
+// by Factor until the volatility falls back below Restore
+type VolatilityPolicy struct {
+	Interval  string
+	Window    int
+	Threshold float64
+	Restore   float64
+	Factor    float64
+}
+
+// VolatilityState represents the latest volatility assessment of a pair
+type VolatilityState struct {
+	Pair       string    `json:"currency_pair"`
+	Volatility float64   `json:"volatility"`
+	Elevated   bool      `json:"elevated"`
+	Since      time.Time `json:"since"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// VolatilityLeverage reduces the leverage of entries on pairs whose realized
+// volatility spiked and restores it once the volatility normalizes. The
+// volatility is assessed in the background; the leverage is applied with
+// SetLeverage right before the next entry on the pair, while holding its
+// symbol lock. Reduce-only orders pass unchanged.
+type VolatilityLeverage struct {
+	candles         CandleSource
+	policy          VolatilityPolicy
+	defaultLeverage int64
+
+	mu      sync.Mutex
+	pairs   map[string]bool
+	states  map[string]VolatilityState
+	applied map[string]int64
+	stop    chan struct{}
+}
+
+// NewVolatilityLeverage creates a new volatility leverage policy assessing
+// the given pairs; entries without a leverage of their own are assumed to
+// trade at defaultLeverage. A Restore above Threshold is lowered to it.
+func NewVolatilityLeverage(candles CandleSource, policy VolatilityPolicy, defaultLeverage int64, pairs []string) *VolatilityLeverage {
+	if policy.Restore <= 0 || policy.Restore > policy.Threshold {
+		policy.Restore = policy.Threshold
+	}
+	v := &VolatilityLeverage{
+		candles:         candles,
+		policy:          policy,
+		defaultLeverage: defaultLeverage,
+		pairs:           make(map[string]bool, len(pairs)),
+		states:          make(map[string]VolatilityState),
+		applied:         make(map[string]int64),
+	}
+	for _, pair := range pairs {
+		v.pairs[pair] = true
+	}
+	return v
+}
+
+// Start assesses the volatility of the pairs every interval in the background
+func (v *VolatilityLeverage) Start(interval time.Duration) {
+	v.mu.Lock()
+	if v.stop != nil {
+		v.mu.Unlock()
+		return
+	}
+	v.stop = make(chan struct{})
+	stop := v.stop
+	v.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			v.Check(time.Now())
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the assessments
+func (v *VolatilityLeverage) Stop() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.stop != nil {
+		close(v.stop)
+		v.stop = nil
+	}
+}
+
+// Check assesses the realized volatility of every pair, switching pairs
+// above the threshold to reduced leverage and those back below the restore
+// level to their configured leverage
+func (v *VolatilityLeverage) Check(now time.Time) {
+	v.mu.Lock()
+	pairs := make([]string, 0, len(v.pairs))
+	for pair := range v.pairs {
+		pairs = append(pairs, pair)
+	}
+	v.mu.Unlock()
+	sort.Strings(pairs)
+
+	for _, pair := range pairs {
+		vol, err := v.Volatility(pair)
+		if err != nil {
+			logger.Warning("Failed to assess the volatility of %s: %v", pair, err)
+			continue
+		}
+		v.update(pair, vol, now)
+	}
+}
+
+// Volatility returns the realized volatility of a pair over the policy window
+func (v *VolatilityLeverage) Volatility(pair string) (float64, error) {
+	candles, err := v.candles.Get(pair, v.policy.Interval, v.policy.Window+1)
+	if err != nil {
+		return 0, err
+	}
+	if len(candles) < 3 {
+		return 0, fmt.Errorf("only %d candles", len(candles))
+	}
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
+	}
+	return indicators.StdDev(indicators.Returns(closes)), nil
+}
+
+// update records a volatility assessment and logs switches of the policy
+func (v *VolatilityLeverage) update(pair string, vol float64, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	state, ok := v.states[pair]
+	if !ok {
+		state = VolatilityState{Pair: pair, Since: now}
+	}
+	state.Volatility, state.CheckedAt = vol, now
+
+	switch {
+	case !state.Elevated && vol > v.policy.Threshold:
+		state.Elevated, state.Since = true, now
+		logger.Warning("Volatility of %s at %.2f%% is above %.2f%%: entries trade at %.0f%% of their leverage",
+			pair, vol*100, v.policy.Threshold*100, v.policy.Factor*100)
+	case state.Elevated && vol < v.policy.Restore:
+		state.Elevated, state.Since = false, now
+		logger.Info("Volatility of %s at %.2f%% is back below %.2f%%: entries trade at their configured leverage",
+			pair, vol*100, v.policy.Restore*100)
+	}
+	v.states[pair] = state
+}
+
+// States returns the latest volatility assessment of every pair
+func (v *VolatilityLeverage) States() []VolatilityState {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	states := make([]VolatilityState, 0, len(v.states))
+	for _, s := range v.states {
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Pair < states[j].Pair })
+	return states
+}
+
+// Leverage returns the leverage an entry on pair requesting leverage trades
+// at: scaled by the policy factor, but at least 1x, while the pair's
+// volatility is elevated, and as requested otherwise. A requested leverage
+// of zero stands for the default leverage.
+func (v *VolatilityLeverage) Leverage(pair string, leverage int64) int64 {
+	if leverage <= 0 {
+		leverage = v.defaultLeverage
+	}
+	v.mu.Lock()
+	elevated := v.states[pair].Elevated
+	v.mu.Unlock()
+	if !elevated || leverage <= 0 {
+		return leverage
+	}
+	return int64(math.Max(1, math.Floor(float64(leverage)*v.policy.Factor)))
+}
+
+// watch adds a pair to the assessed pairs
+func (v *VolatilityLeverage) watch(pair string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.pairs[pair] = true
+}
+
+// Wrap returns t with the leverage of its entries following the policy
+func (v *VolatilityLeverage) Wrap(exchange string, t trader.Trader) trader.Trader {
+	return &volatilityTrader{Trader: t, exchange: exchange, policy: v}
+}
+
+// volatilityTrader wraps a trader and applies the volatility leverage policy
+// to its entries
+type volatilityTrader struct {
+	trader.Trader
+
+	exchange string
+	policy   *VolatilityLeverage
+}
+
+var _ trader.Trader = (*volatilityTrader)(nil)
+
+// Unwrap returns the wrapped trader
+func (t *volatilityTrader) Unwrap() trader.Trader {
+	return t.Trader
+}
+
+// CreateOrder sets the leverage the policy gives an entry on the exchange
+// when it differs from the one last applied, then places the order at it
+func (t *volatilityTrader) CreateOrder(ctx context.Context, req trader.OrderRequest) (*trader.Order, error) {
+	if req.ReduceOnly {
+		return t.Trader.CreateOrder(ctx, req)
+	}
+	t.policy.watch(req.Pair)
+
+	requested := req.Leverage
+	if requested <= 0 {
+		requested = t.policy.defaultLeverage
+	}
+	leverage := t.policy.Leverage(req.Pair, req.Leverage)
+	key := t.exchange + "|" + req.Pair
+
+	t.policy.mu.Lock()
+	applied, adjusted := t.policy.applied[key]
+	t.policy.mu.Unlock()
+	switch {
+	case leverage <= 0, !adjusted && leverage == requested:
+		return t.Trader.CreateOrder(ctx, req)
+	case adjusted && applied == leverage:
+		req.Leverage = leverage
+		return t.Trader.CreateOrder(ctx, req)
+	}
+
+	ctx, unlock, err := trader.LockSymbol(ctx, t.Trader, req.Pair)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := t.Trader.SetLeverage(ctx, req.Pair, leverage); err != nil && !errors.Is(err, trader.ErrLeverageAlreadySet) {
+		return nil, fmt.Errorf("set leverage %dx on %s: %w", leverage, req.Pair, err)
+	}
+
+	t.policy.mu.Lock()
+	if leverage == requested {
+		delete(t.policy.applied, key)
+	} else {
+		t.policy.applied[key] = leverage
+	}
+	t.policy.mu.Unlock()
+	if leverage == requested {
+		logger.Info("Leverage of %s on %s restored to %dx", req.Pair, t.exchange, leverage)
+	} else {
+		logger.Info("Leverage of %s on %s reduced from %dx to %dx on elevated volatility", req.Pair, t.exchange, requested, leverage)
+	}
+
+	req.Leverage = leverage
+	return t.Trader.CreateOrder(ctx, req)
+}
+
+// SetLeverage sets the leverage through the wrapped trader; the policy
+// applies its own again before the next entry if it differs
+func (t *volatilityTrader) SetLeverage(ctx context.Context, pair string, leverage int64) error {
+	if err := t.Trader.SetLeverage(ctx, pair, leverage); err != nil {
+		return err
+	}
+	t.policy.mu.Lock()
+	delete(t.policy.applied, t.exchange+"|"+pair)
+	t.policy.mu.Unlock()
+	return nil
+}
+
+// SetTrailingStop places a native trailing stop through the wrapped trader
+func (t *volatilityTrader) SetTrailingStop(ctx context.Context, pair string, side trader.Side, callbackRate float64) (*trader.Order, error) {
+	return trader.SetTrailingStop(ctx, t.Trader, pair, side, callbackRate)
+}
+
+// GetOrderByClientID looks an order up by its client order ID through the
+// wrapped trader
+func (t *volatilityTrader) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*trader.Order, error) {
+	return trader.GetOrderByClientID(ctx, t.Trader, pair, clientOrderID)
+}
+
+// PositionMode returns the position mode of the wrapped trader's account
+func (t *volatilityTrader) PositionMode(ctx context.Context) (trader.PositionMode, error) {
+	return trader.GetPositionMode(ctx, t.Trader)
+}
+
+// LockSymbol holds the trading lock of pair on the wrapped trader
+func (t *volatilityTrader) LockSymbol(ctx context.Context, pair string) (context.Context, func(), error) {
+	return trader.LockSymbol(ctx, t.Trader, pair)
+}
+
+// GetTransfers lists the account's deposits and withdrawals through the
+// wrapped trader
+func (t *volatilityTrader) GetTransfers(ctx context.Context, since time.Time) ([]trader.Transfer, error) {
+	return trader.GetTransfers(ctx, t.Trader, since)
+}
@@ -0,0 +1,267 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/pnl"
+	"github.com/nofx/storage"
+	"github.com/nofx/trader"
+)
+
+// exchanges returns the traders of exchange, or of every exchange when empty
+func exchanges(traders *trader.Manager, exchange string) ([]string, error) {
+	if exchange != "" {
+		if _, err := traders.Get(exchange); err != nil {
+			return nil, err
+		}
+		return []string{exchange}, nil
+	}
+	return traders.Names(), nil
+}
+
+// PnLSnapshot represents the PnL of a UTC day and the unrealized PnL of the
+// lots open when it was taken
+type PnLSnapshot struct {
+	Day        string        `json:"day"`
+	Exchange   string        `json:"exchange,omitempty"`
+	Total      pnl.Aggregate `json:"total"`
+	Unrealized float64       `json:"unrealized_pnl"`
+	Open       int           `json:"open_positions"`
+	Taken      time.Time     `json:"taken"`
+}
+
+// PnLSnapshotter records the PnL of the previous UTC day, typically run at
+// midnight
+type PnLSnapshotter struct {
+	engine   *pnl.Engine
+	exchange string
+}
+
+// NewPnLSnapshotter creates a new PnL snapshotter of exchange, or of every
+// exchange when empty
+func NewPnLSnapshotter(engine *pnl.Engine, exchange string) *PnLSnapshotter {
+	return &PnLSnapshotter{engine: engine, exchange: exchange}
+}
+
+// Run takes the snapshot of the last UTC day that ended by now
+func (s *PnLSnapshotter) Run(ctx context.Context, now time.Time) (interface{}, error) {
+	now = now.UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -1)
+	summary, err := s.engine.Summarize(storage.Query{Exchange: s.exchange, From: from, To: to}, pnl.Day)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := PnLSnapshot{
+		Day:        from.Format("2006-01-02"),
+		Exchange:   s.exchange,
+		Total:      summary.Total,
+		Unrealized: summary.Unrealized,
+		Open:       len(summary.Open),
+		Taken:      now,
+	}
+	snapshot.Total.Period = snapshot.Day
+	snapshot.Total.Start = from
+	logger.With("day", snapshot.Day, "realized", snapshot.Total.Realized, "fees", snapshot.Total.Fees,
+		"funding", snapshot.Total.Funding, "net", snapshot.Total.Net, "unrealized", snapshot.Unrealized).
+		Info("PnL of %s: net %.2f over %d trades (realized %.2f, fees %.2f, funding %.2f), unrealized %.2f",
+			snapshot.Day, snapshot.Total.Net, snapshot.Total.Trades, snapshot.Total.Realized, snapshot.Total.Fees,
+			snapshot.Total.Funding, snapshot.Unrealized)
+	return snapshot, nil
+}
+
+// FundingExposure represents the funding due on an open position at the
+// next funding timestamp; Payment is negative when the position pays
+type FundingExposure struct {
+	Exchange    string      `json:"exchange"`
+	Pair        string      `json:"currency_pair"`
+	Side        trader.Side `json:"side"`
+	Rate        float64     `json:"funding_rate"`
+	Payment     float64     `json:"payment"`
+	FundingTime time.Time   `json:"funding_time,omitempty"`
+	// Alert is set when the position pays a rate above the maximum
+	Alert bool `json:"alert"`
+}
+
+// FundingCheck estimates the funding of the open positions, typically run
+// ahead of funding timestamps, and warns about those paying a rate above a
+// maximum
+type FundingCheck struct {
+	traders   *trader.Manager
+	contracts ContractSource
+	prices    PriceSource
+	exchange  string
+	maxRate   float64
+}
+
+// NewFundingCheck creates a new funding check of the positions of exchange,
+// or of every exchange when empty; maxRate 0 warns about every payment
+func NewFundingCheck(traders *trader.Manager, contracts ContractSource, prices PriceSource, exchange string, maxRate float64) *FundingCheck {
+	return &FundingCheck{
+		traders:   traders,
+		contracts: contracts,
+		prices:    prices,
+		exchange:  exchange,
+		maxRate:   maxRate,
+	}
+}
+
+// Run returns the funding exposure of every open position
+func (f *FundingCheck) Run(ctx context.Context, now time.Time) (interface{}, error) {
+	names, err := exchanges(f.traders, f.exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	exposures := []FundingExposure{}
+	for _, name := range names {
+		t, err := f.traders.Get(name)
+		if err != nil {
+			return exposures, err
+		}
+		positions, err := t.GetPositions(ctx)
+		if err != nil {
+			return exposures, fmt.Errorf("%s positions: %w", name, err)
+		}
+		for _, p := range positions {
+			if p.Size == 0 {
+				continue
+			}
+			contract, err := f.contracts.Get(p.Pair)
+			if err != nil {
+				logger.Warning("Funding check skipped %s on %s: %v", p.Pair, name, err)
+				continue
+			}
+			price := p.MarkPrice
+			if price <= 0 {
+				if price, err = f.prices.Price(p.Pair); err != nil {
+					price = p.EntryPrice
+				}
+			}
+			// Positive funding is paid by longs, negative by shorts
+			notional := trader.QuoteNotional(contract, p.Size, price)
+			payment := -contract.FundingRate * notional
+			paidRate := contract.FundingRate
+			if p.Side == trader.SellSide {
+				payment, paidRate = -payment, -paidRate
+			}
+			exposure := FundingExposure{
+				Exchange: name,
+				Pair:     p.Pair,
+				Side:     p.Side,
+				Rate:     contract.FundingRate,
+				Payment:  payment,
+				Alert:    paidRate > 0 && paidRate > f.maxRate,
+			}
+			if contract.NextFundingTime > 0 {
+				exposure.FundingTime = time.Unix(contract.NextFundingTime, 0)
+			}
+			if exposure.Alert {
+				logger.With("exchange", name, "symbol", p.Pair, "rate", contract.FundingRate).
+					Warning("%s %s on %s pays funding at %.4f%%, about %.2f", p.Pair, p.Side, name, paidRate*100, -payment)
+			}
+			exposures = append(exposures, exposure)
+		}
+	}
+	return exposures, nil
+}
+
+// StaleOrder represents an open order canceled for its age
+type StaleOrder struct {
+	Exchange      string  `json:"exchange"`
+	Pair          string  `json:"currency_pair"`
+	OrderID       string  `json:"order_id"`
+	ClientOrderID string  `json:"client_order_id"`
+	Age           float64 `json:"age"`
+	Canceled      bool    `json:"canceled"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// StaleOrderCleaner cancels our open orders left resting longer than a
+// maximum age. Orders of other tools and those serving a tracked intent,
+// such as brackets, are kept.
+type StaleOrderCleaner struct {
+	traders  *trader.Manager
+	tag      *trader.OrderTag
+	orders   *trader.OrderRegistry
+	exchange string
+	pairs    []string
+	maxAge   time.Duration
+}
+
+// NewStaleOrderCleaner creates a new cleaner of the orders on pairs of
+// exchange, or of every exchange when empty
+func NewStaleOrderCleaner(traders *trader.Manager, tag *trader.OrderTag, orders *trader.OrderRegistry, exchange string,
+	pairs []string, maxAge time.Duration) *StaleOrderCleaner {
+	return &StaleOrderCleaner{
+		traders:  traders,
+		tag:      tag,
+		orders:   orders,
+		exchange: exchange,
+		pairs:    pairs,
+		maxAge:   maxAge,
+	}
+}
+
+// Run cancels the stale orders and returns them
+func (c *StaleOrderCleaner) Run(ctx context.Context, now time.Time) (interface{}, error) {
+	names, err := exchanges(c.traders, c.exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := []StaleOrder{}
+	failed := 0
+	for _, name := range names {
+		t, err := c.traders.Get(name)
+		if err != nil {
+			return stale, err
+		}
+		for _, pair := range c.pairs {
+			orders, err := t.GetOrders(ctx, pair, trader.OrderStatusNew)
+			if err != nil {
+				logger.Warning("Stale order cleanup failed to list open orders for %s on %s: %v", pair, name, err)
+				failed++
+				continue
+			}
+			for _, order := range orders {
+				if !c.tag.Owns(order.ClientOrderID) || order.CreatedTime == 0 {
+					continue
+				}
+				age := now.Sub(time.UnixMilli(order.CreatedTime))
+				if age < c.maxAge {
+					continue
+				}
+				if tracked, ok := c.orders.Lookup(order.ClientOrderID); ok && tracked.Intent != "" && tracked.Intent != RebalanceIntent {
+					continue
+				}
+
+				s := StaleOrder{
+					Exchange:      name,
+					Pair:          pair,
+					OrderID:       order.ID,
+					ClientOrderID: order.ClientOrderID,
+					Age:           age.Seconds(),
+				}
+				if err := t.CancelOrder(ctx, order.ID); err != nil {
+					s.Error = err.Error()
+					failed++
+					logger.Warning("Failed to cancel stale order %s (%s) on %s: %v", order.ID, order.ClientOrderID, pair, err)
+				} else {
+					s.Canceled = true
+					logger.Info("Canceled stale order %s (%s) on %s after %s: %s %s %.8f @ %.8f",
+						order.ID, order.ClientOrderID, pair, age.Round(time.Minute), order.Side, order.Type, order.Amount, order.Price)
+				}
+				stale = append(stale, s)
+			}
+		}
+	}
+	if failed > 0 {
+		return stale, fmt.Errorf("%d stale order listings or cancellations failed", failed)
+	}
+	return stale, nil
+}
@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/risk"
+	"github.com/nofx/trader"
+)
+
+// RebalanceIntent is the intent recorded for the orders of rebalances
+const RebalanceIntent = "rebalance"
+
+// PriceSource provides the last price of a symbol
+type PriceSource interface {
+	Price(pair string) (float64, error)
+}
+
+// RebalanceOrder represents the trade of a pair towards its target notional;
+// notionals are signed, negative for a short
+type RebalanceOrder struct {
+	Pair       string      `json:"currency_pair"`
+	Current    float64     `json:"current_notional"`
+	Target     float64     `json:"target_notional"`
+	Side       trader.Side `json:"side,omitempty"`
+	Amount     float64     `json:"amount,omitempty"`
+	ReduceOnly bool        `json:"reduce_only,omitempty"`
+	OrderID    string      `json:"order_id,omitempty"`
+	// Skipped is why the pair wasn't traded, if it wasn't
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// Rebalancer trades the positions of an exchange to target notionals once
+// they drift more than a tolerance from them. Orders are market orders
+// through the risk limits; a target crossing zero closes the position
+// before opening the other side.
+type Rebalancer struct {
+	traders   *trader.Manager
+	contracts ContractSource
+	prices    PriceSource
+	tag       *trader.OrderTag
+	orders    *trader.OrderRegistry
+	exchange  string
+	targets   map[string]float64
+	tolerance float64
+}
+
+// NewRebalancer creates a new rebalancer of the positions of exchange, or
+// the default exchange when empty; targets are signed notionals by pair and
+// tolerance the drift from a target left alone, as a fraction of it
+func NewRebalancer(traders *trader.Manager, contracts ContractSource, prices PriceSource, tag *trader.OrderTag,
+	orders *trader.OrderRegistry, exchange string, targets map[string]float64, tolerance float64) *Rebalancer {
+	return &Rebalancer{
+		traders:   traders,
+		contracts: contracts,
+		prices:    prices,
+		tag:       tag,
+		orders:    orders,
+		exchange:  exchange,
+		targets:   targets,
+		tolerance: tolerance,
+	}
+}
+
+// Run rebalances every target pair and returns the orders placed or skipped
+func (r *Rebalancer) Run(ctx context.Context, now time.Time) (interface{}, error) {
+	exchange := r.exchange
+	if exchange == "" {
+		exchange = r.traders.DefaultName()
+	}
+	t, err := r.traders.Get(exchange)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := t.GetPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[string][]trader.Position)
+	for _, p := range positions {
+		if p.Size != 0 {
+			held[p.Pair] = append(held[p.Pair], p)
+		}
+	}
+
+	pairs := make([]string, 0, len(r.targets))
+	for pair := range r.targets {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	ctx = trader.WithClientOrder(ctx, r.tag, r.orders, trader.ClientOrder{Exchange: exchange, Intent: RebalanceIntent})
+	var results []RebalanceOrder
+	var failed []string
+	for _, pair := range pairs {
+		orders, err := r.rebalance(ctx, t, pair, held[pair])
+		results = append(results, orders...)
+		if err != nil {
+			logger.Warning("Failed to rebalance %s on %s: %v", pair, exchange, err)
+			failed = append(failed, pair)
+		}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("failed to rebalance %v", failed)
+	}
+	return results, nil
+}
+
+// rebalance trades one pair towards its target
+func (r *Rebalancer) rebalance(ctx context.Context, t trader.Trader, pair string, positions []trader.Position) ([]RebalanceOrder, error) {
+	price, err := r.prices.Price(pair)
+	if err != nil {
+		return nil, err
+	}
+	contract, err := r.contracts.Get(pair)
+	if err != nil {
+		return nil, err
+	}
+	// One contract's worth in the quote currency, which targets are in
+	unit := trader.QuoteNotional(contract, 1, price)
+
+	// Positions are signed contracts, negative for a short
+	var size float64
+	for _, p := range positions {
+		if p.Side == trader.SellSide {
+			size -= p.Size
+		} else {
+			size += p.Size
+		}
+	}
+	target := r.targets[pair]
+	order := RebalanceOrder{Pair: pair, Current: size * unit, Target: target}
+	drift := target - order.Current
+	if math.Abs(drift) <= r.tolerance*math.Abs(target) {
+		order.Skipped = "within tolerance"
+		return []RebalanceOrder{order}, nil
+	}
+
+	// A target on the other side closes the position first
+	var orders []RebalanceOrder
+	if size != 0 && (target == 0 || (target > 0) != (size > 0)) {
+		closing := order
+		closing.Side, closing.Amount, closing.ReduceOnly = trader.BuySide, math.Abs(size), true
+		if size > 0 {
+			closing.Side = trader.SellSide
+		}
+		if err := r.place(ctx, t, &closing); err != nil {
+			return append(orders, closing), err
+		}
+		orders = append(orders, closing)
+		if closing.Skipped != "" || target == 0 {
+			return orders, nil
+		}
+		drift = target
+	}
+
+	order.Side = trader.BuySide
+	if drift < 0 {
+		order.Side = trader.SellSide
+	}
+	// Trimming a position towards a smaller target only reduces it
+	order.ReduceOnly = len(orders) == 0 && size != 0 && (drift > 0) != (size > 0)
+	order.Amount = trader.FloorToStep(math.Abs(drift)/unit, contract.QuantityStep)
+	if order.Amount <= 0 || order.Amount < contract.MinQuantity {
+		order.Skipped = fmt.Sprintf("amount %v is below the minimum quantity %v", order.Amount, contract.MinQuantity)
+		return append(orders, order), nil
+	}
+	err = r.place(ctx, t, &order)
+	return append(orders, order), err
+}
+
+// place sends a rebalance order; risk rejections skip it
+func (r *Rebalancer) place(ctx context.Context, t trader.Trader, order *RebalanceOrder) error {
+	placed, err := t.CreateOrder(ctx, trader.OrderRequest{
+		Pair:       order.Pair,
+		Side:       order.Side,
+		Type:       trader.MarketOrder,
+		Amount:     order.Amount,
+		ReduceOnly: order.ReduceOnly,
+	})
+	if err == nil && placed == nil {
+		err = errors.New("exchange returned no order")
+	}
+	if risk.IsRejection(err) {
+		order.Skipped = err.Error()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	order.OrderID = placed.ID
+	logger.Info("Rebalanced %s: %s %.8f from %.2f towards %.2f", order.Pair, order.Side, order.Amount, order.Current, order.Target)
+	return nil
+}
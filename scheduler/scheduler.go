@@ -0,0 +1,411 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+)
+
+var (
+	// ErrUnknownJob is returned for a job name that isn't scheduled
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobRunning is returned when running a job that is still running
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// scheduleCheck is how often the schedules are checked
+const scheduleCheck = 30 * time.Second
+
+// defaultFundingInterval is the funding interval of contracts that don't
+// report one, in seconds
+const defaultFundingInterval = 8 * 3600
+
+// ContractSource provides contract metadata, used for funding timestamps
+type ContractSource interface {
+	Get(pair string) (*market.ContractInfo, error)
+}
+
+// RunFunc runs a job and returns its result, reported by the job's status
+type RunFunc func(ctx context.Context, now time.Time) (interface{}, error)
+
+// Schedule represents when a job runs: at UTC times of day ("HH:MM"), every
+// Every, and BeforeFunding ahead of each funding timestamp of Pairs; zero
+// fields don't schedule anything
+type Schedule struct {
+	At            []string
+	Every         time.Duration
+	BeforeFunding time.Duration
+	Pairs         []string
+}
+
+// String describes the schedule, e.g. "at 00:00 UTC, every 15m0s"
+func (s Schedule) String() string {
+	var parts []string
+	if len(s.At) > 0 {
+		parts = append(parts, "at "+strings.Join(s.At, ", ")+" UTC")
+	}
+	if s.Every > 0 {
+		parts = append(parts, "every "+s.Every.String())
+	}
+	if s.BeforeFunding > 0 {
+		parts = append(parts, fmt.Sprintf("%s before the funding of %s", s.BeforeFunding, strings.Join(s.Pairs, ", ")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Job represents a periodic job
+type Job struct {
+	Name     string
+	Type     string
+	Schedule Schedule
+	Run      RunFunc
+}
+
+// JobStatus represents the schedule and the last run of a job
+type JobStatus struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Schedule string    `json:"schedule"`
+	Running  bool      `json:"running"`
+	NextRun  time.Time `json:"next_run,omitempty"`
+	LastRun  time.Time `json:"last_run,omitempty"`
+	// Duration is how long the last run took, in seconds
+	Duration float64     `json:"duration"`
+	Trigger  string      `json:"trigger,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+	Runs     int         `json:"runs"`
+	Failures int         `json:"failures"`
+}
+
+// Run triggers
+const (
+	TriggerAt      = "at"
+	TriggerEvery   = "every"
+	TriggerFunding = "funding"
+	TriggerManual  = "manual"
+)
+
+// job is a scheduled job and its state
+type job struct {
+	Job
+	minutes []int
+
+	running bool
+	// due is when an every schedule is due next
+	due time.Time
+	// funded is the funding timestamp the job last ran ahead of
+	funded time.Time
+	status JobStatus
+}
+
+// Scheduler runs periodic jobs: at fixed UTC times of day, at intervals, or
+// ahead of funding timestamps. A job still running when it's due again is
+// skipped, and each keeps the result of its last run.
+type Scheduler struct {
+	contracts ContractSource
+
+	mu    sync.Mutex
+	jobs  map[string]*job
+	names []string
+	last  time.Time
+	stop  chan struct{}
+}
+
+// NewScheduler creates a new scheduler; contracts provides the funding
+// timestamps and may be nil without jobs run before funding
+func NewScheduler(contracts ContractSource) *Scheduler {
+	return &Scheduler{
+		contracts: contracts,
+		jobs:      make(map[string]*job),
+		last:      time.Now(),
+	}
+}
+
+// Add schedules a job, replacing a job of the same name
+func (s *Scheduler) Add(j Job) error {
+	minutes := make([]int, 0, len(j.Schedule.At))
+	for _, at := range j.Schedule.At {
+		t, err := time.Parse("15:04", strings.TrimSpace(at))
+		if err != nil {
+			return fmt.Errorf("job %s: invalid time of day %q", j.Name, at)
+		}
+		minutes = append(minutes, t.Hour()*60+t.Minute())
+	}
+	sort.Ints(minutes)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[j.Name]; !ok {
+		s.names = append(s.names, j.Name)
+		sort.Strings(s.names)
+	}
+	scheduled := &job{Job: j, minutes: minutes}
+	scheduled.status = JobStatus{Name: j.Name, Type: j.Type, Schedule: j.Schedule.String()}
+	if j.Schedule.Every > 0 {
+		scheduled.due = time.Now().Add(j.Schedule.Every)
+	}
+	s.jobs[j.Name] = scheduled
+	return nil
+}
+
+// Start checks the schedules in the background
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.last = time.Now()
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(scheduleCheck)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.Check(now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the schedules; running jobs complete
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Check starts the jobs due since the previous check
+func (s *Scheduler) Check(now time.Time) {
+	s.mu.Lock()
+	last := s.last
+	s.last = now
+	jobs := make([]*job, 0, len(s.names))
+	for _, name := range s.names {
+		jobs = append(jobs, s.jobs[name])
+	}
+	s.mu.Unlock()
+
+	for _, j := range jobs {
+		if trigger := s.due(j, last, now); trigger != "" {
+			if err := s.start(j, trigger, now); err != nil {
+				logger.Warning("Skipped the %s run of job %s: %v", trigger, j.Name, err)
+			}
+		}
+	}
+}
+
+// due returns the trigger of a job due between last and now, if any
+func (s *Scheduler) due(j *job, last, now time.Time) string {
+	for _, minute := range j.minutes {
+		if at := scheduledAt(minute, now); at.After(last) && !at.After(now) {
+			return TriggerAt
+		}
+	}
+
+	s.mu.Lock()
+	due := j.due
+	funded := j.funded
+	s.mu.Unlock()
+	if j.Schedule.Every > 0 && !now.Before(due) {
+		s.mu.Lock()
+		j.due = now.Add(j.Schedule.Every)
+		s.mu.Unlock()
+		return TriggerEvery
+	}
+
+	if j.Schedule.BeforeFunding > 0 {
+		next, ok := s.nextFunding(j.Schedule.Pairs, now)
+		if ok && !next.Equal(funded) && !now.Before(next.Add(-j.Schedule.BeforeFunding)) {
+			s.mu.Lock()
+			j.funded = next
+			s.mu.Unlock()
+			return TriggerFunding
+		}
+	}
+	return ""
+}
+
+// nextFunding returns the earliest funding timestamp of pairs after now
+func (s *Scheduler) nextFunding(pairs []string, now time.Time) (time.Time, bool) {
+	if s.contracts == nil {
+		return time.Time{}, false
+	}
+	var earliest int64
+	for _, pair := range pairs {
+		contract, err := s.contracts.Get(pair)
+		if err != nil {
+			logger.Debug("No funding timestamp of %s for scheduled jobs: %v", pair, err)
+			continue
+		}
+		if contract.NextFundingTime == 0 {
+			continue
+		}
+		// Cached contracts keep an old funding time; roll it forward by the interval
+		interval := contract.FundingInterval
+		if interval <= 0 {
+			interval = defaultFundingInterval
+		}
+		next := contract.NextFundingTime
+		for next <= now.Unix() {
+			next += interval
+		}
+		if earliest == 0 || next < earliest {
+			earliest = next
+		}
+	}
+	if earliest == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(earliest, 0), true
+}
+
+// start runs a job in the background unless it's still running
+func (s *Scheduler) start(j *job, trigger string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j.running {
+		return ErrJobRunning
+	}
+	j.running = true
+	go s.run(j, trigger, now)
+	return nil
+}
+
+// run runs a job and records its outcome
+func (s *Scheduler) run(j *job, trigger string, now time.Time) {
+	logger.Info("Running job %s (%s)", j.Name, trigger)
+	start := time.Now()
+	result, err := j.Run.safe(context.Background(), now)
+	duration := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.running = false
+	j.status.LastRun = start
+	j.status.Duration = duration.Seconds()
+	j.status.Trigger = trigger
+	j.status.Result = result
+	j.status.Runs++
+	j.status.Error = ""
+	if err != nil {
+		j.status.Error = err.Error()
+		j.status.Failures++
+		logger.With("job", j.Name, "type", j.Type).Warning("Job %s failed after %s: %v", j.Name, duration.Round(time.Millisecond), err)
+		return
+	}
+	logger.With("job", j.Name, "type", j.Type).Info("Job %s completed in %s", j.Name, duration.Round(time.Millisecond))
+}
+
+// safe runs fn, turning a panic into an error so a failing job can't take
+// the process down
+func (fn RunFunc) safe(ctx context.Context, now time.Time) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, now)
+}
+
+// Run starts a job now, outside its schedule
+func (s *Scheduler) Run(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownJob, name)
+	}
+	return s.start(j, TriggerManual, time.Now())
+}
+
+// Jobs returns the status of every job, by name
+func (s *Scheduler) Jobs() []JobStatus {
+	now := time.Now()
+	s.mu.Lock()
+	jobs := make([]*job, 0, len(s.names))
+	for _, name := range s.names {
+		jobs = append(jobs, s.jobs[name])
+	}
+	s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		next := s.nextRun(j, now)
+		s.mu.Lock()
+		status := j.status
+		status.Running = j.running
+		s.mu.Unlock()
+		status.NextRun = next
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Job returns the status of a job
+func (s *Scheduler) Job(name string) (JobStatus, error) {
+	for _, status := range s.Jobs() {
+		if status.Name == name {
+			return status, nil
+		}
+	}
+	return JobStatus{}, fmt.Errorf("%w %q", ErrUnknownJob, name)
+}
+
+// nextRun returns when a job is due next, or zero without a schedule
+func (s *Scheduler) nextRun(j *job, now time.Time) time.Time {
+	var next time.Time
+	earlier := func(t time.Time) {
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	for _, minute := range j.minutes {
+		earlier(scheduledAt(minute, now).AddDate(0, 0, 1))
+	}
+	s.mu.Lock()
+	due, funded := j.due, j.funded
+	s.mu.Unlock()
+	if j.Schedule.Every > 0 {
+		earlier(due)
+	}
+	if j.Schedule.BeforeFunding > 0 {
+		// Once the job ran ahead of the next funding, it's due before the one after
+		from := now
+		if funded.After(now) {
+			from = funded
+		}
+		if funding, ok := s.nextFunding(j.Schedule.Pairs, from); ok {
+			earlier(funding.Add(-j.Schedule.BeforeFunding))
+		}
+	}
+	return next
+}
+
+// scheduledAt returns the latest time at or before now falling on a minute
+// of the UTC day
+func scheduledAt(minute int, now time.Time) time.Time {
+	now = now.UTC()
+	at := time.Date(now.Year(), now.Month(), now.Day(), minute/60, minute%60, 0, 0, time.UTC)
+	if at.After(now) {
+		at = at.AddDate(0, 0, -1)
+	}
+	return at
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nofx/journal"
+)
+
+var _ journal.AnnotationStore = (*Store)(nil)
+
+// SaveAnnotation inserts a trade or position annotation, its tags one row
+// each so they match exactly whatever they contain
+func (s *Store) SaveAnnotation(a journal.Annotation) error {
+	if err := s.exec(`INSERT INTO annotations (id, target, reference, pair, note, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		a.ID, string(a.Target), a.Reference, a.Pair, a.Note, a.Timestamp.UnixMilli()); err != nil {
+		return err
+	}
+	for _, tag := range a.Tags {
+		if err := s.exec(`INSERT INTO annotation_tags (annotation_id, tag) VALUES (?, ?)
+			ON CONFLICT (annotation_id, tag) DO NOTHING`, a.ID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAnnotation removes an annotation and its tags
+func (s *Store) DeleteAnnotation(id string) error {
+	if err := s.exec(`DELETE FROM annotation_tags WHERE annotation_id = ?`, id); err != nil {
+		return err
+	}
+	return s.exec(`DELETE FROM annotations WHERE id = ?`, id)
+}
+
+// Annotations returns every stored annotation, oldest first. Annotations
+// saved before tags got their own table keep their comma-joined tags.
+func (s *Store) Annotations() ([]journal.Annotation, error) {
+	tags, err := s.annotationTags()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT id, target, reference, pair, tags, note, timestamp
+		FROM annotations ORDER BY timestamp`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var annotations []journal.Annotation
+	for rows.Next() {
+		var a journal.Annotation
+		var target, legacy string
+		var ts int64
+		if err := rows.Scan(&a.ID, &target, &a.Reference, &a.Pair, &legacy, &a.Note, &ts); err != nil {
+			return nil, err
+		}
+		a.Target, a.Timestamp = journal.AnnotationTarget(target), time.UnixMilli(ts)
+		a.Tags = tags[a.ID]
+		if a.Tags == nil && legacy != "" {
+			a.Tags = strings.Split(legacy, ",")
+		}
+		if a.Tags == nil {
+			a.Tags = []string{}
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, rows.Err()
+}
+
+// annotationTags returns the tags of every annotation by its ID, sorted
+func (s *Store) annotationTags() (map[string][]string, error) {
+	rows, err := s.db.Query(`SELECT annotation_id, tag FROM annotation_tags ORDER BY annotation_id, tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return tags, rows.Err()
+}
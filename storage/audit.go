@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nofx/crypto"
+)
+
+// AuditRecord represents a signed entry of the order audit trail
+type AuditRecord struct {
+	Seq       int64           `json:"seq"`
+	Exchange  string          `json:"exchange"`
+	Event     string          `json:"event"`
+	Reference string          `json:"reference"`
+	Payload   json.RawMessage `json:"payload"`
+	Timestamp time.Time       `json:"timestamp"`
+	Signature string          `json:"signature"`
+}
+
+// signed returns the bytes covered by the signature of a record, its fields
+// JSON encoded so no field can spill into the next
+func (r AuditRecord) signed() []byte {
+	data, _ := json.Marshal([]interface{}{r.Timestamp.UnixMilli(), r.Exchange, r.Event, r.Reference, string(r.Payload)})
+	return data
+}
+
+// AuditHead is the signed checkpoint of the newest audit record, kept in a
+// file outside the database so removing records from the end of the trail,
+// which leaves the chain intact, is detected too
+type AuditHead struct {
+	Records   int    `json:"records"`
+	Signature string `json:"signature"`
+	MAC       string `json:"mac"`
+}
+
+// signed returns the bytes covered by the MAC of a head
+func (h AuditHead) signed() []byte {
+	data, _ := json.Marshal([]interface{}{h.Records, h.Signature})
+	return data
+}
+
+// AuditHeadPath returns the head file kept next to an audit key file
+func AuditHeadPath(keyPath string) string {
+	return keyPath + ".head"
+}
+
+// readAuditHead reads and authenticates a head file; ok is false when there
+// is none
+func readAuditHead(path string, key []byte) (head AuditHead, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return head, false, nil
+	}
+	if err != nil {
+		return head, false, err
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return head, false, fmt.Errorf("audit head %s: %w", path, err)
+	}
+	if !crypto.Verify(key, head.signed(), head.MAC) {
+		return head, false, fmt.Errorf("audit head %s was altered", path)
+	}
+	return head, true, nil
+}
+
+// writeAuditHead replaces the head file, readable only by its owner
+func writeAuditHead(path string, key []byte, records int, signature string) error {
+	head := AuditHead{Records: records, Signature: signature}
+	head.MAC = crypto.Sign(key, head.signed())
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// EnableAudit signs every audit record appended from now on with key,
+// continuing the chain of the records already stored, and keeps the head of
+// the trail in headPath. It fails when the stored trail no longer reaches
+// the head, so a truncation isn't covered up by the next record.
+func (s *Store) EnableAudit(key []byte, headPath string) error {
+	var records int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM audit_log`).Scan(&records); err != nil {
+		return err
+	}
+	last, err := s.auditSignature(records)
+	if err != nil {
+		return err
+	}
+	head, ok, err := readAuditHead(headPath, key)
+	if err != nil {
+		return err
+	}
+	if ok {
+		signature, err := s.auditSignature(head.Records)
+		if err != nil {
+			return err
+		}
+		if records < head.Records || signature != head.Signature {
+			return &AuditTruncatedError{Records: records, Head: head.Records}
+		}
+	} else if err := writeAuditHead(headPath, key, records, last); err != nil {
+		return err
+	}
+
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	s.auditKey, s.auditLast, s.auditRecords, s.auditHead = key, last, records, headPath
+	return nil
+}
+
+// auditSignature returns the signature of the n-th audit record, or "" when
+// n is 0 or past the end
+func (s *Store) auditSignature(n int) (string, error) {
+	if n == 0 {
+		return "", nil
+	}
+	var signature string
+	err := s.db.QueryRow(s.rebind(`SELECT signature FROM audit_log ORDER BY seq LIMIT 1 OFFSET ?`), n-1).Scan(&signature)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return signature, err
+}
+
+// AppendAudit appends a signed record of an event to the audit trail; it
+// does nothing unless EnableAudit was called
+func (s *Store) AppendAudit(exchange, event, reference string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	if s.auditKey == nil {
+		return nil
+	}
+
+	r := AuditRecord{
+		Exchange:  exchange,
+		Event:     event,
+		Reference: reference,
+		Payload:   data,
+		Timestamp: time.Now(),
+	}
+	r.Signature = crypto.SignChained(s.auditKey, s.auditLast, r.signed())
+	if err := s.exec(`INSERT INTO audit_log (exchange, event, reference, payload, timestamp, signature)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		r.Exchange, r.Event, r.Reference, string(r.Payload), r.Timestamp.UnixMilli(), r.Signature); err != nil {
+		return err
+	}
+	s.auditLast = r.Signature
+	s.auditRecords++
+	return writeAuditHead(s.auditHead, s.auditKey, s.auditRecords, s.auditLast)
+}
+
+// AuditError reports the first audit record whose signature does not match
+type AuditError struct {
+	Seq int64
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit record %d was altered, removed or reordered", e.Seq)
+}
+
+// AuditTruncatedError reports an audit trail that no longer reaches its head
+type AuditTruncatedError struct {
+	Records int
+	Head    int
+}
+
+func (e *AuditTruncatedError) Error() string {
+	return fmt.Sprintf("audit trail holds %d records but its head is record %d: records were removed from the end", e.Records, e.Head)
+}
+
+// VerifyAudit checks the signature chain of the whole audit trail with key
+// and that it reaches the head in headPath, and returns the number of valid
+// records, an *AuditError at the first record that fails verification or an
+// *AuditTruncatedError
+func (s *Store) VerifyAudit(key []byte, headPath string) (int, error) {
+	head, ok, err := readAuditHead(headPath, key)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := s.db.Query(`SELECT seq, exchange, event, reference, payload, timestamp, signature
+		FROM audit_log ORDER BY seq`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var previous, headSignature string
+	count := 0
+	for rows.Next() {
+		var r AuditRecord
+		var payload string
+		var ts int64
+		if err := rows.Scan(&r.Seq, &r.Exchange, &r.Event, &r.Reference, &payload, &ts, &r.Signature); err != nil {
+			return count, err
+		}
+		r.Payload, r.Timestamp = json.RawMessage(payload), time.UnixMilli(ts)
+		if !crypto.VerifyChained(key, previous, r.signed(), r.Signature) {
+			return count, &AuditError{Seq: r.Seq}
+		}
+		previous = r.Signature
+		count++
+		if count == head.Records {
+			headSignature = r.Signature
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	if !ok {
+		if count > 0 {
+			return count, fmt.Errorf("audit head %s is missing", headPath)
+		}
+		return count, nil
+	}
+	if count < head.Records || headSignature != head.Signature {
+		return count, &AuditTruncatedError{Records: count, Head: head.Records}
+	}
+	return count, nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nofx/backtest"
+)
+
+var _ backtest.CandidateStore = (*Store)(nil)
+
+// SaveCandidate inserts a promotion candidate or updates its stage; the
+// approvals are saved one by one with SaveApproval
+func (s *Store) SaveCandidate(c backtest.Candidate) error {
+	c.Approvals = nil
+	config, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.exec(`INSERT INTO candidates (id, stage, config, created) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET stage = excluded.stage`,
+		c.ID, string(c.Stage), string(config), c.Created.UnixMilli())
+}
+
+// SaveApproval appends a stage transition of a promotion candidate
+func (s *Store) SaveApproval(id string, a backtest.Approval) error {
+	return s.exec(`INSERT INTO candidate_approvals (candidate_id, from_stage, to_stage, approved_by, note, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		id, string(a.From), string(a.To), a.By, a.Note, a.At.UnixNano())
+}
+
+// Candidates returns every promotion candidate with its approvals, oldest first
+func (s *Store) Candidates() ([]backtest.Candidate, error) {
+	rows, err := s.db.Query(`SELECT id, stage, config FROM candidates ORDER BY created, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []backtest.Candidate
+	index := make(map[string]int)
+	for rows.Next() {
+		var id, stage, config string
+		if err := rows.Scan(&id, &stage, &config); err != nil {
+			return nil, err
+		}
+		var c backtest.Candidate
+		if err := json.Unmarshal([]byte(config), &c); err != nil {
+			return nil, err
+		}
+		c.ID, c.Stage, c.Approvals = id, backtest.Stage(stage), []backtest.Approval{}
+		index[id] = len(candidates)
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	approvals, err := s.db.Query(`SELECT candidate_id, from_stage, to_stage, approved_by, note, timestamp
+		FROM candidate_approvals ORDER BY timestamp`)
+	if err != nil {
+		return nil, err
+	}
+	defer approvals.Close()
+	for approvals.Next() {
+		var id, from, to string
+		var a backtest.Approval
+		var ts int64
+		if err := approvals.Scan(&id, &from, &to, &a.By, &a.Note, &ts); err != nil {
+			return nil, err
+		}
+		i, ok := index[id]
+		if !ok {
+			continue
+		}
+		a.From, a.To, a.At = backtest.Stage(from), backtest.Stage(to), time.Unix(0, ts)
+		candidates[i].Approvals = append(candidates[i].Approvals, a)
+	}
+	return candidates, approvals.Err()
+}
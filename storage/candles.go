@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"github.com/nofx/market"
+)
+
+var _ market.CandleArchive = (*Store)(nil)
+
+// SaveCandles inserts candles of a series or replaces those with the same
+// timestamp
+func (s *Store) SaveCandles(pair, interval string, candles []market.CandleData) error {
+	for _, c := range candles {
+		if err := s.exec(`INSERT INTO candles (pair, timeframe, timestamp, open, high, low, close, volume)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (pair, timeframe, timestamp) DO UPDATE SET open = excluded.open, high = excluded.high,
+				low = excluded.low, close = excluded.close, volume = excluded.volume`,
+			pair, interval, c.Timestamp, c.Open, c.High, c.Low, c.Close, c.Volume); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteCandles removes the candles of a series older than before
+func (s *Store) DeleteCandles(pair, interval string, before int64) error {
+	return s.exec(`DELETE FROM candles WHERE pair = ? AND timeframe = ? AND timestamp < ?`, pair, interval, before)
+}
+
+// LatestCandles returns the latest limit candles of a series, oldest first
+func (s *Store) LatestCandles(pair, interval string, limit int) ([]market.CandleData, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT timestamp, open, high, low, close, volume FROM candles
+		WHERE pair = ? AND timeframe = ? ORDER BY timestamp DESC LIMIT ?`), pair, interval, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candles []market.CandleData
+	for rows.Next() {
+		var c market.CandleData
+		if err := rows.Scan(&c.Timestamp, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume); err != nil {
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+	for i, j := 0, len(candles)-1; i < j; i, j = i+1, j-1 {
+		candles[i], candles[j] = candles[j], candles[i]
+	}
+	return candles, rows.Err()
+}
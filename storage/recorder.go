@@ -0,0 +1,494 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nofx/journal"
+	"github.com/nofx/logger"
+	"github.com/nofx/trader"
+)
+
+// Recorder wraps a Trader and persists every order it places or observes,
+// the fills implied by increases of an order's filled amount, position
+// changes and the account's deposits and withdrawals. Positions are
+// attributed to the strategy of the latest fill on their side. With a
+// journal set, the realized PnL and fees of fills, funding payments and
+// completed transfers are entered in it too. Recording failures are logged
+// and never fail the trading call.
+type Recorder struct {
+	trader.Trader
+
+	exchange string
+	store    *Store
+	tag      *trader.OrderTag
+	interval time.Duration
+	journal  *journal.Journal
+	ledger   FillLedger
+
+	// orderMu serializes recording orders, so two polls of an order can't
+	// both record the same fill
+	orderMu sync.Mutex
+
+	mu        sync.Mutex
+	positions map[string]trader.Position
+	// funding holds the funding each position had accumulated when last seen
+	funding map[string]float64
+	// strategies holds the strategy of the latest fill on each pair and side
+	strategies map[string]string
+	stop       chan struct{}
+	// transfersPolled is when deposits and withdrawals were last listed
+	transfersPolled time.Time
+	// journaled holds the completed transfers entered in the journal
+	journaled map[string]bool
+}
+
+// FillLedger prices recorded fills for the journal
+type FillLedger interface {
+	// Settle returns the realized PnL and fee of a recorded fill
+	Settle(f Fill) (realized, fee float64, err error)
+	// Currency returns the currency the PnL, fees and funding of a pair
+	// are paid in
+	Currency(exchange, pair string) string
+}
+
+const (
+	// transferPollInterval is how often snapshots list deposits and withdrawals
+	transferPollInterval = 10 * time.Minute
+	// transferLookback is how far back the first listing reaches, and
+	// transferOverlap how far later ones reach before the previous listing,
+	// so pending transfers are seen completing
+	transferLookback = 30 * 24 * time.Hour
+	transferOverlap  = 24 * time.Hour
+)
+
+var _ trader.Trader = (*Recorder)(nil)
+
+// NewRecorder creates a new recording trader for an exchange
+func NewRecorder(exchange string, t trader.Trader, store *Store, tag *trader.OrderTag, interval time.Duration) *Recorder {
+	return &Recorder{
+		Trader:     t,
+		exchange:   exchange,
+		store:      store,
+		tag:        tag,
+		interval:   interval,
+		positions:  make(map[string]trader.Position),
+		funding:    make(map[string]float64),
+		strategies: make(map[string]string),
+		journaled:  make(map[string]bool),
+	}
+}
+
+// SetJournal enters the balance changes of the recorded fills, funding
+// payments and transfers in a journal, fills and funding priced by ledger;
+// it must be called before Start
+func (r *Recorder) SetJournal(j *journal.Journal, ledger FillLedger) {
+	r.journal = j
+	r.ledger = ledger
+}
+
+// Start takes periodic balance and position snapshots in the background
+func (r *Recorder) Start() {
+	r.mu.Lock()
+	if r.stop != nil || r.interval <= 0 {
+		r.mu.Unlock()
+		return
+	}
+	r.stop = make(chan struct{})
+	stop := r.stop
+	r.mu.Unlock()
+
+	go func() {
+		ctx := context.Background()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		r.Snapshot(ctx)
+		for {
+			select {
+			case <-ticker.C:
+				r.Snapshot(ctx)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts periodic snapshots
+func (r *Recorder) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// Snapshot records the current balances and any position changes
+func (r *Recorder) Snapshot(ctx context.Context) {
+	balances, err := r.Trader.GetBalance(ctx)
+	if err != nil {
+		logger.Warning("Failed to snapshot %s balances: %v", r.exchange, err)
+	} else if err := r.store.SaveBalances(r.exchange, balances, time.Now()); err != nil {
+		logger.Warning("Failed to record %s balances: %v", r.exchange, err)
+	}
+
+	if _, err := r.GetPositions(ctx); err != nil {
+		logger.Warning("Failed to snapshot %s positions: %v", r.exchange, err)
+	}
+	r.pollTransfers(ctx)
+}
+
+// pollTransfers lists the deposits and withdrawals every
+// transferPollInterval; exchanges that can't list them are skipped
+func (r *Recorder) pollTransfers(ctx context.Context) {
+	r.mu.Lock()
+	polled := r.transfersPolled
+	r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(polled) < transferPollInterval {
+		return
+	}
+
+	since := now.Add(-transferLookback)
+	if !polled.IsZero() {
+		since = polled.Add(-transferOverlap)
+	}
+	_, err := r.GetTransfers(ctx, since)
+	switch {
+	case errors.Is(err, trader.ErrTransfersNotSupported):
+	case err != nil:
+		logger.Warning("Failed to list %s deposits and withdrawals: %v", r.exchange, err)
+		return
+	}
+	r.mu.Lock()
+	r.transfersPolled = now
+	r.mu.Unlock()
+}
+
+// recordTransfers stores deposits and withdrawals, updating their status,
+// and enters each in the journal once it completes
+func (r *Recorder) recordTransfers(transfers []trader.Transfer) {
+	for _, t := range transfers {
+		if err := r.store.SaveTransfer(TransferRecord{Transfer: t, Exchange: r.exchange}); err != nil {
+			logger.Warning("Failed to record %s %s %s: %v", r.exchange, t.Type, t.ID, err)
+		}
+		if r.journal == nil || !t.Completed {
+			continue
+		}
+		key := string(t.Type) + "|" + t.ID
+		r.mu.Lock()
+		done := r.journaled[key]
+		r.journaled[key] = true
+		r.mu.Unlock()
+		if !done {
+			r.journal.Record(journal.Entry{
+				Type:      journal.TransferEntry,
+				Currency:  t.Currency,
+				Amount:    t.Net(),
+				Reference: t.ID,
+				Timestamp: t.Time,
+			})
+		}
+	}
+}
+
+// CreateOrder creates an order and records it
+func (r *Recorder) CreateOrder(ctx context.Context, req trader.OrderRequest) (*trader.Order, error) {
+	order, err := r.Trader.CreateOrder(ctx, req)
+	r.recordOrder(order, err)
+	return order, err
+}
+
+// CancelOrder cancels an order and records its final state
+func (r *Recorder) CancelOrder(ctx context.Context, orderID string) error {
+	if err := r.Trader.CancelOrder(ctx, orderID); err != nil {
+		return err
+	}
+	order, err := r.Trader.GetOrder(ctx, orderID)
+	r.recordOrder(order, err)
+	return nil
+}
+
+// GetOrder retrieves an order and records its state
+func (r *Recorder) GetOrder(ctx context.Context, orderID string) (*trader.Order, error) {
+	order, err := r.Trader.GetOrder(ctx, orderID)
+	r.recordOrder(order, err)
+	return order, err
+}
+
+// GetOrders retrieves orders and records their state
+func (r *Recorder) GetOrders(ctx context.Context, pair string, status trader.Status) ([]trader.Order, error) {
+	orders, err := r.Trader.GetOrders(ctx, pair, status)
+	for i := range orders {
+		r.recordOrder(&orders[i], nil)
+	}
+	return orders, err
+}
+
+// ClosePosition closes a position and records the closing order
+func (r *Recorder) ClosePosition(ctx context.Context, pair string, amount float64) (*trader.Order, error) {
+	order, err := r.Trader.ClosePosition(ctx, pair, amount)
+	r.recordOrder(order, err)
+	return order, err
+}
+
+// SetStopLoss places a stop-loss order and records it
+func (r *Recorder) SetStopLoss(ctx context.Context, pair string, side trader.Side, amount, triggerPrice float64, priceType trader.TriggerPriceType) (*trader.Order, error) {
+	order, err := r.Trader.SetStopLoss(ctx, pair, side, amount, triggerPrice, priceType)
+	r.recordOrder(order, err)
+	return order, err
+}
+
+// SetTakeProfit places a take-profit order and records it
+func (r *Recorder) SetTakeProfit(ctx context.Context, pair string, side trader.Side, amount, triggerPrice float64, priceType trader.TriggerPriceType) (*trader.Order, error) {
+	order, err := r.Trader.SetTakeProfit(ctx, pair, side, amount, triggerPrice, priceType)
+	r.recordOrder(order, err)
+	return order, err
+}
+
+// SetTrailingStop places a native trailing stop and records it
+func (r *Recorder) SetTrailingStop(ctx context.Context, pair string, side trader.Side, callbackRate float64) (*trader.Order, error) {
+	order, err := trader.SetTrailingStop(ctx, r.Trader, pair, side, callbackRate)
+	r.recordOrder(order, err)
+	return order, err
+}
+
+// PositionMode returns the position mode of the wrapped trader's account
+func (r *Recorder) PositionMode(ctx context.Context) (trader.PositionMode, error) {
+	return trader.GetPositionMode(ctx, r.Trader)
+}
+
+// GetTransfers lists the account's deposits and withdrawals and records them
+func (r *Recorder) GetTransfers(ctx context.Context, since time.Time) ([]trader.Transfer, error) {
+	transfers, err := trader.GetTransfers(ctx, r.Trader, since)
+	if err == nil {
+		r.recordTransfers(transfers)
+	}
+	return transfers, err
+}
+
+// GetOrderByClientID retrieves an order by its client order ID and records its state
+func (r *Recorder) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*trader.Order, error) {
+	order, err := trader.GetOrderByClientID(ctx, r.Trader, pair, clientOrderID)
+	r.recordOrder(order, err)
+	return order, err
+}
+
+// GetPosition retrieves a position and records it when changed
+func (r *Recorder) GetPosition(ctx context.Context, pair string) (*trader.Position, error) {
+	position, err := r.Trader.GetPosition(ctx, pair)
+	if err == nil && position != nil {
+		position.Strategy = r.strategy(position.Pair, position.Side)
+		r.recordPositions([]trader.Position{*position}, false)
+	}
+	return position, err
+}
+
+// GetPositions retrieves all positions and records every change, including
+// positions that disappeared since the last call
+func (r *Recorder) GetPositions(ctx context.Context) ([]trader.Position, error) {
+	positions, err := r.Trader.GetPositions(ctx)
+	if err == nil {
+		for i := range positions {
+			positions[i].Strategy = r.strategy(positions[i].Pair, positions[i].Side)
+		}
+		r.recordPositions(positions, true)
+	}
+	return positions, err
+}
+
+// recordOrder stores an order and a fill for any increase of its filled
+// amount, at the average price of the increase and the exchange's update time
+func (r *Recorder) recordOrder(order *trader.Order, err error) {
+	if err != nil || order == nil || order.ID == "" {
+		return
+	}
+
+	record := OrderRecord{Order: *order, Exchange: r.exchange}
+	if r.tag != nil {
+		record.Strategy = r.tag.Strategy(order.ClientOrderID)
+	}
+
+	r.orderMu.Lock()
+	defer r.orderMu.Unlock()
+	previous, err := r.store.Order(r.exchange, order.ID)
+	if err != nil {
+		logger.Warning("Failed to load recorded order %s: %v", order.ID, err)
+		return
+	}
+	var filled, avg float64
+	if previous != nil {
+		filled, avg = previous.FilledAmount, previous.AvgPrice
+	}
+	if delta := order.FilledAmount - filled; delta > 0 {
+		at := time.Now()
+		if order.UpdatedTime > 0 {
+			at = time.UnixMilli(order.UpdatedTime)
+		}
+		fill := Fill{
+			Exchange:  r.exchange,
+			OrderID:   order.ID,
+			Pair:      order.Pair,
+			Side:      order.Side,
+			Price:     fillPrice(order, filled, avg, delta),
+			Amount:    delta,
+			Strategy:  record.Strategy,
+			Timestamp: at,
+		}
+		if fill.Price <= 0 {
+			logger.Warning("Recording the fill of %s order %s without a price", r.exchange, order.ID)
+		}
+		if fill.ID, err = r.store.SaveFill(fill); err != nil {
+			logger.Warning("Failed to record fill of order %s: %v", order.ID, err)
+		} else {
+			r.journalFill(fill)
+		}
+		r.mu.Lock()
+		r.strategies[order.Pair+"|"+string(order.Side)] = record.Strategy
+		r.mu.Unlock()
+	}
+
+	if err := r.store.SaveOrder(record); err != nil {
+		logger.Warning("Failed to record order %s: %v", order.ID, err)
+	}
+
+	// Audit new orders and every change of their status or filled amount
+	if previous == nil || previous.Status != order.Status || previous.FilledAmount != order.FilledAmount {
+		if err := r.store.AppendAudit(r.exchange, "order", order.ID, record); err != nil {
+			logger.Warning("Failed to audit order %s: %v", order.ID, err)
+		}
+	}
+}
+
+// journalFill enters the realized PnL and fee of a recorded fill in the
+// journal
+func (r *Recorder) journalFill(f Fill) {
+	if r.journal == nil || r.ledger == nil {
+		return
+	}
+	realized, fee, err := r.ledger.Settle(f)
+	if err != nil {
+		logger.Warning("Failed to price the fill of %s order %s for the journal: %v", r.exchange, f.OrderID, err)
+		return
+	}
+	currency := r.ledger.Currency(r.exchange, f.Pair)
+	if realized != 0 {
+		r.journal.Record(journal.Entry{Type: journal.TradeEntry, Currency: currency, Amount: realized,
+			Pair: f.Pair, Reference: f.OrderID, Timestamp: f.Timestamp})
+	}
+	if fee != 0 {
+		r.journal.Record(journal.Entry{Type: journal.FeeEntry, Currency: currency, Amount: -fee,
+			Pair: f.Pair, Reference: f.OrderID, Timestamp: f.Timestamp})
+	}
+}
+
+// fillPrice returns the average price of the delta filled since an order
+// was recorded with filled at avg, derived from the order's average fill
+// price; orders without one, as stop orders on some venues, fall back to
+// their limit or trigger price
+func fillPrice(order *trader.Order, filled, avg, delta float64) float64 {
+	if order.AvgPrice <= 0 {
+		return order.Price
+	}
+	if filled <= 0 || avg <= 0 {
+		return order.AvgPrice
+	}
+	if price := (order.AvgPrice*order.FilledAmount - avg*filled) / delta; price > 0 {
+		return price
+	}
+	return order.AvgPrice
+}
+
+// strategy returns the strategy a position on a side of a pair is
+// attributed to, loading the latest fill on that side the first time
+func (r *Recorder) strategy(pair string, side trader.Side) string {
+	key := pair + "|" + string(side)
+	r.mu.Lock()
+	strategy, ok := r.strategies[key]
+	r.mu.Unlock()
+	if ok {
+		return strategy
+	}
+	strategy, err := r.store.EntryStrategy(r.exchange, pair, side)
+	if err != nil {
+		logger.Warning("Failed to load the strategy of %s %s %s: %v", r.exchange, pair, side, err)
+		return ""
+	}
+	r.mu.Lock()
+	// A fill recorded meanwhile is newer than the one loaded
+	if current, ok := r.strategies[key]; ok {
+		strategy = current
+	} else {
+		r.strategies[key] = strategy
+	}
+	r.mu.Unlock()
+	return strategy
+}
+
+// recordPositions stores positions whose side or size changed; with complete
+// set, positions missing from the list are recorded as closed
+func (r *Recorder) recordPositions(positions []trader.Position, complete bool) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]bool, len(positions))
+	for _, p := range positions {
+		seen[p.Pair] = true
+		last, ok := r.positions[p.Pair]
+		if ok && last.Side != p.Side {
+			delete(r.funding, p.Pair+"|"+string(last.Side))
+		}
+		r.recordFunding(p, now)
+		if ok && last.Side == p.Side && last.Size == p.Size {
+			continue
+		}
+		r.positions[p.Pair] = p
+		r.savePosition(p, now)
+	}
+
+	if !complete {
+		return
+	}
+	for pair, last := range r.positions {
+		if seen[pair] {
+			continue
+		}
+		delete(r.positions, pair)
+		delete(r.funding, pair+"|"+string(last.Side))
+		last.Size, last.UnrealizedPnl = 0, 0
+		r.savePosition(last, now)
+	}
+}
+
+// recordFunding stores the funding a position accumulated since it was last
+// seen; the first sighting only sets the baseline, so funding settled before
+// it, or after the last sighting of a closed position, isn't recorded.
+// Callers hold mu.
+func (r *Recorder) recordFunding(p trader.Position, at time.Time) {
+	key := p.Pair + "|" + string(p.Side)
+	last, ok := r.funding[key]
+	r.funding[key] = p.Funding
+	if !ok || p.Funding == last {
+		return
+	}
+	payment := FundingPayment{Exchange: r.exchange, Pair: p.Pair, Side: p.Side, Amount: p.Funding - last, Timestamp: at}
+	if err := r.store.SaveFundingPayment(payment); err != nil {
+		logger.Warning("Failed to record %s funding of %s: %v", r.exchange, p.Pair, err)
+	}
+	if r.journal != nil && r.ledger != nil {
+		r.journal.Record(journal.Entry{Type: journal.FundingEntry, Currency: r.ledger.Currency(r.exchange, p.Pair),
+			Amount: payment.Amount, Pair: p.Pair, Timestamp: at})
+	}
+}
+
+// savePosition stores a position change; callers hold mu
+func (r *Recorder) savePosition(p trader.Position, at time.Time) {
+	if err := r.store.SavePosition(PositionRecord{Position: p, Exchange: r.exchange, Timestamp: at}); err != nil {
+		logger.Warning("Failed to record %s position %s: %v", r.exchange, p.Pair, err)
+	}
+}
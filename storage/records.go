@@ -0,0 +1,455 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nofx/trader"
+)
+
+// OrderRecord represents a stored order
+type OrderRecord struct {
+	trader.Order
+	Exchange string `json:"exchange"`
+	Strategy string `json:"strategy,omitempty"`
+}
+
+// Fill represents an execution of part of an order; ID is assigned by the store
+type Fill struct {
+	ID        int64       `json:"id,omitempty"`
+	Exchange  string      `json:"exchange"`
+	OrderID   string      `json:"order_id"`
+	Pair      string      `json:"currency_pair"`
+	Side      trader.Side `json:"side"`
+	Price     float64     `json:"price"`
+	Amount    float64     `json:"amount"`
+	Strategy  string      `json:"strategy,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// TradeRecord represents a fill with the client order ID of its order
+type TradeRecord struct {
+	Fill
+	ClientOrderID string `json:"client_order_id"`
+}
+
+// ErrInvalidCursor is returned for a malformed pagination cursor
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PositionRecord represents a stored position change
+type PositionRecord struct {
+	trader.Position
+	Exchange  string    `json:"exchange"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// FundingPayment represents funding a position received, or paid when
+// negative, between two position snapshots
+type FundingPayment struct {
+	Exchange  string      `json:"exchange"`
+	Pair      string      `json:"currency_pair"`
+	Side      trader.Side `json:"side"`
+	Amount    float64     `json:"amount"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// BalanceRecord represents a stored balance snapshot of one currency
+type BalanceRecord struct {
+	Exchange  string    `json:"exchange"`
+	Currency  string    `json:"currency"`
+	Total     float64   `json:"total"`
+	Available float64   `json:"available"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TransferRecord represents a stored deposit or withdrawal
+type TransferRecord struct {
+	trader.Transfer
+	Exchange string `json:"exchange"`
+}
+
+// SaveOrder inserts or updates an order
+func (s *Store) SaveOrder(r OrderRecord) error {
+	updated := r.UpdatedTime
+	if updated == 0 {
+		updated = time.Now().UnixMilli()
+	}
+	created := r.CreatedTime
+	if created == 0 {
+		created = updated
+	}
+	return s.exec(`INSERT INTO orders (exchange, id, client_order_id, pair, type, side, price, amount,
+			filled_amount, avg_price, status, strategy, created_time, updated_time)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (exchange, id) DO UPDATE SET
+			filled_amount = excluded.filled_amount,
+			avg_price = excluded.avg_price,
+			status = excluded.status,
+			updated_time = excluded.updated_time`,
+		r.Exchange, r.ID, r.ClientOrderID, r.Pair, string(r.Type), string(r.Side), r.Price, r.Amount,
+		r.FilledAmount, r.AvgPrice, string(r.Status), r.Strategy, created, updated)
+}
+
+// Order returns a stored order, or nil when unknown
+func (s *Store) Order(exchange, id string) (*OrderRecord, error) {
+	orders, err := s.queryOrders(" WHERE exchange = ? AND id = ?", exchange, id)
+	if err != nil || len(orders) == 0 {
+		return nil, err
+	}
+	return &orders[0], nil
+}
+
+// Orders returns stored orders matching a query, newest first
+func (s *Store) Orders(q Query) ([]OrderRecord, error) {
+	clause, args := q.where("pair", "strategy", "id", "created_time")
+	return s.queryOrders(clause, args...)
+}
+
+// queryOrders selects orders with a WHERE/ORDER clause
+func (s *Store) queryOrders(clause string, args ...interface{}) ([]OrderRecord, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT exchange, id, client_order_id, pair, type, side, price, amount,
+		filled_amount, avg_price, status, strategy, created_time, updated_time FROM orders`+clause), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []OrderRecord{}
+	for rows.Next() {
+		var r OrderRecord
+		var orderType, side, status string
+		if err := rows.Scan(&r.Exchange, &r.ID, &r.ClientOrderID, &r.Pair, &orderType, &side, &r.Price, &r.Amount,
+			&r.FilledAmount, &r.AvgPrice, &status, &r.Strategy, &r.CreatedTime, &r.UpdatedTime); err != nil {
+			return nil, err
+		}
+		r.Type, r.Side, r.Status = trader.OrderType(orderType), trader.Side(side), trader.Status(status)
+		orders = append(orders, r)
+	}
+	return orders, rows.Err()
+}
+
+// OpenOrders returns the stored orders of an exchange that were last seen
+// new or partially filled
+func (s *Store) OpenOrders(exchange string) ([]OrderRecord, error) {
+	return s.queryOrders(" WHERE exchange = ? AND status IN (?, ?)", exchange,
+		string(trader.OrderStatusNew), string(trader.OrderStatusPartiallyFilled))
+}
+
+// SaveFill inserts a fill and returns its ID
+func (s *Store) SaveFill(f Fill) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(s.rebind(`INSERT INTO fills (exchange, order_id, pair, side, price, amount, strategy, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		f.Exchange, f.OrderID, f.Pair, string(f.Side), f.Price, f.Amount, f.Strategy, f.Timestamp.UnixMilli()).Scan(&id)
+	return id, err
+}
+
+// Fills returns stored fills matching a query, newest first
+func (s *Store) Fills(q Query) ([]Fill, error) {
+	clause, args := q.where("pair", "strategy", "order_id", "timestamp")
+	rows, err := s.db.Query(s.rebind(`SELECT id, exchange, order_id, pair, side, price, amount, strategy, timestamp
+		FROM fills`+clause), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fills := []Fill{}
+	for rows.Next() {
+		var f Fill
+		var side string
+		var ts int64
+		if err := rows.Scan(&f.ID, &f.Exchange, &f.OrderID, &f.Pair, &side, &f.Price, &f.Amount, &f.Strategy, &ts); err != nil {
+			return nil, err
+		}
+		f.Side, f.Timestamp = trader.Side(side), time.UnixMilli(ts)
+		fills = append(fills, f)
+	}
+	return fills, rows.Err()
+}
+
+// EntryStrategy returns the strategy of the latest fill on a side of a pair
+// of an exchange, which opened or added to the position of that side last
+func (s *Store) EntryStrategy(exchange, pair string, side trader.Side) (string, error) {
+	var strategy string
+	err := s.db.QueryRow(s.rebind(`SELECT strategy FROM fills WHERE exchange = ? AND pair = ? AND side = ?
+		ORDER BY timestamp DESC, id DESC LIMIT 1`), exchange, pair, string(side)).Scan(&strategy)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return strategy, err
+}
+
+// Trades returns a page of q.Limit fills matching a query and side (empty
+// for both), newest first, with the client order ID of their order, and the
+// cursor of the following page, empty after the last one. cursor is the one
+// returned with the previous page, empty for the first.
+func (s *Store) Trades(q Query, side trader.Side, cursor string) ([]TradeRecord, string, error) {
+	conds, args := q.conditions("pair", "strategy", "order_id", "timestamp")
+	if side != "" {
+		conds = append(conds, "side = ?")
+		args = append(args, string(side))
+	}
+	if cursor != "" {
+		ts, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		conds = append(conds, "(timestamp < ? OR (timestamp = ? AND id < ?))")
+		args = append(args, ts, ts, id)
+	}
+	clause := ""
+	if len(conds) > 0 {
+		clause = " WHERE " + strings.Join(conds, " AND ")
+	}
+	clause += " ORDER BY timestamp DESC, id DESC"
+	if q.Limit > 0 {
+		// One more row tells whether another page follows
+		clause += " LIMIT " + strconv.Itoa(q.Limit+1)
+	}
+
+	rows, err := s.db.Query(s.rebind(`SELECT id, exchange, order_id, pair, side, price, amount, strategy, timestamp,
+		COALESCE((SELECT o.client_order_id FROM orders o WHERE o.exchange = fills.exchange AND o.id = fills.order_id), '')
+		FROM fills`+clause), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	trades := []TradeRecord{}
+	for rows.Next() {
+		var t TradeRecord
+		var side string
+		var ts int64
+		if err := rows.Scan(&t.ID, &t.Exchange, &t.OrderID, &t.Pair, &side, &t.Price, &t.Amount, &t.Strategy, &ts,
+			&t.ClientOrderID); err != nil {
+			return nil, "", err
+		}
+		t.Side, t.Timestamp = trader.Side(side), time.UnixMilli(ts)
+		trades = append(trades, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if q.Limit > 0 && len(trades) > q.Limit {
+		trades = trades[:q.Limit]
+		last := trades[len(trades)-1]
+		next = encodeCursor(last.Timestamp.UnixMilli(), last.ID)
+	}
+	return trades, next, nil
+}
+
+// encodeCursor returns the opaque pagination cursor of a fill
+func encodeCursor(ts, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(ts, 10) + ":" + strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor returns the timestamp and ID of a pagination cursor
+func decodeCursor(cursor string) (int64, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 2 {
+		return 0, 0, ErrInvalidCursor
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	return ts, id, nil
+}
+
+// SaveFundingPayment inserts a funding payment
+func (s *Store) SaveFundingPayment(f FundingPayment) error {
+	return s.exec(`INSERT INTO funding_payments (exchange, pair, side, amount, timestamp) VALUES (?, ?, ?, ?, ?)`,
+		f.Exchange, f.Pair, string(f.Side), f.Amount, f.Timestamp.UnixMilli())
+}
+
+// FundingPayments returns stored funding payments matching a query, newest first
+func (s *Store) FundingPayments(q Query) ([]FundingPayment, error) {
+	clause, args := q.where("pair", "", "pair", "timestamp")
+	rows, err := s.db.Query(s.rebind(`SELECT exchange, pair, side, amount, timestamp FROM funding_payments`+clause), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []FundingPayment{}
+	for rows.Next() {
+		var f FundingPayment
+		var side string
+		var ts int64
+		if err := rows.Scan(&f.Exchange, &f.Pair, &side, &f.Amount, &ts); err != nil {
+			return nil, err
+		}
+		f.Side, f.Timestamp = trader.Side(side), time.UnixMilli(ts)
+		payments = append(payments, f)
+	}
+	return payments, rows.Err()
+}
+
+// SavePosition inserts a position change
+func (s *Store) SavePosition(r PositionRecord) error {
+	return s.exec(`INSERT INTO positions (exchange, pair, side, size, entry_price, mark_price,
+			unrealized_pnl, realized_pnl, strategy, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Exchange, r.Pair, string(r.Side), r.Size, r.EntryPrice, r.MarkPrice,
+		r.UnrealizedPnl, r.RealizedPnl, r.Strategy, r.Timestamp.UnixMilli())
+}
+
+// Positions returns stored position changes matching a query, newest first
+func (s *Store) Positions(q Query) ([]PositionRecord, error) {
+	clause, args := q.where("pair", "strategy", "pair", "timestamp")
+	rows, err := s.db.Query(s.rebind(`SELECT exchange, pair, side, size, entry_price, mark_price,
+		unrealized_pnl, realized_pnl, strategy, timestamp FROM positions`+clause), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := []PositionRecord{}
+	for rows.Next() {
+		var r PositionRecord
+		var side string
+		var ts int64
+		if err := rows.Scan(&r.Exchange, &r.Pair, &side, &r.Size, &r.EntryPrice, &r.MarkPrice,
+			&r.UnrealizedPnl, &r.RealizedPnl, &r.Strategy, &ts); err != nil {
+			return nil, err
+		}
+		r.Side, r.Timestamp = trader.Side(side), time.UnixMilli(ts)
+		positions = append(positions, r)
+	}
+	return positions, rows.Err()
+}
+
+// OpenPositions returns the latest stored change of every position of an
+// exchange that was still open
+func (s *Store) OpenPositions(exchange string) ([]PositionRecord, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT exchange, pair, side, size, entry_price, mark_price,
+		unrealized_pnl, realized_pnl, strategy, timestamp FROM positions p
+		WHERE exchange = ? AND size > 0 AND id = (
+			SELECT MAX(id) FROM positions WHERE exchange = p.exchange AND pair = p.pair)`), exchange)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := []PositionRecord{}
+	for rows.Next() {
+		var r PositionRecord
+		var side string
+		var ts int64
+		if err := rows.Scan(&r.Exchange, &r.Pair, &side, &r.Size, &r.EntryPrice, &r.MarkPrice,
+			&r.UnrealizedPnl, &r.RealizedPnl, &r.Strategy, &ts); err != nil {
+			return nil, err
+		}
+		r.Side, r.Timestamp = trader.Side(side), time.UnixMilli(ts)
+		positions = append(positions, r)
+	}
+	return positions, rows.Err()
+}
+
+// SaveBalances inserts a balance snapshot
+func (s *Store) SaveBalances(exchange string, balances []trader.Balance, at time.Time) error {
+	for _, b := range balances {
+		if err := s.exec(`INSERT INTO balances (exchange, currency, total, available, timestamp)
+			VALUES (?, ?, ?, ?, ?)`, exchange, b.Currency, b.Total, b.Available, at.UnixMilli()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Balances returns stored balance snapshots matching a query, newest first;
+// Query.Pair filters by currency
+func (s *Store) Balances(q Query) ([]BalanceRecord, error) {
+	clause, args := q.where("currency", "", "", "timestamp")
+	rows, err := s.db.Query(s.rebind(`SELECT exchange, currency, total, available, timestamp
+		FROM balances`+clause), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []BalanceRecord{}
+	for rows.Next() {
+		var r BalanceRecord
+		var ts int64
+		if err := rows.Scan(&r.Exchange, &r.Currency, &r.Total, &r.Available, &ts); err != nil {
+			return nil, err
+		}
+		r.Timestamp = time.UnixMilli(ts)
+		balances = append(balances, r)
+	}
+	return balances, rows.Err()
+}
+
+// DayStart returns the settlement balance an exchange started a UTC day
+// with, as "2006-01-02", and whether one was saved
+func (s *Store) DayStart(exchange, day string) (float64, bool, error) {
+	var balance float64
+	err := s.db.QueryRow(s.rebind(`SELECT balance FROM day_starts WHERE exchange = ? AND day = ?`),
+		exchange, day).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return balance, true, nil
+}
+
+// SaveDayStart saves the settlement balance an exchange started a UTC day
+// with; the first one saved for a day is kept
+func (s *Store) SaveDayStart(exchange, day string, balance float64) error {
+	return s.exec(`INSERT INTO day_starts (exchange, day, balance) VALUES (?, ?, ?)
+		ON CONFLICT (exchange, day) DO NOTHING`, exchange, day, balance)
+}
+
+// SaveTransfer inserts a deposit or withdrawal, or updates its status
+func (s *Store) SaveTransfer(r TransferRecord) error {
+	return s.exec(`INSERT INTO transfers (exchange, id, type, currency, amount, status, completed, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (exchange, id, type) DO UPDATE SET
+			status = excluded.status,
+			completed = excluded.completed,
+			timestamp = excluded.timestamp`,
+		r.Exchange, r.ID, string(r.Type), r.Currency, r.Amount, r.Status, r.Completed, r.Time.UnixMilli())
+}
+
+// Transfers returns stored deposits and withdrawals matching a query, newest
+// first; Query.Pair filters by currency
+func (s *Store) Transfers(q Query) ([]TransferRecord, error) {
+	clause, args := q.where("currency", "", "", "timestamp")
+	rows, err := s.db.Query(s.rebind(`SELECT exchange, id, type, currency, amount, status, completed, timestamp
+		FROM transfers`+clause), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []TransferRecord{}
+	for rows.Next() {
+		var r TransferRecord
+		var kind string
+		var ts int64
+		if err := rows.Scan(&r.Exchange, &r.ID, &kind, &r.Currency, &r.Amount, &r.Status, &r.Completed, &ts); err != nil {
+			return nil, err
+		}
+		r.Type, r.Time = trader.TransferType(kind), time.UnixMilli(ts)
+		transfers = append(transfers, r)
+	}
+	return transfers, rows.Err()
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"math"
+	"time"
+)
+
+// Point represents a value of a time series; on the equity series,
+// Transfers is the net amount deposited (negative: withdrawn) since the
+// previous point, the part of the change that isn't trading PnL
+type Point struct {
+	Time      time.Time `json:"time"`
+	Value     float64   `json:"value"`
+	Transfers float64   `json:"transfers,omitempty"`
+}
+
+// EquitySeries returns the total balance over time, summed across
+// currencies and across the exchanges matching q (each at its latest
+// snapshot), one point per snapshot between q.From and q.To, each labelled
+// with the completed deposits and withdrawals since the previous snapshot
+func (s *Store) EquitySeries(q Query) ([]Point, error) {
+	balances, err := s.Balances(Query{Exchange: q.Exchange, To: q.To})
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := s.Transfers(Query{Exchange: q.Exchange, To: q.To})
+	if err != nil {
+		return nil, err
+	}
+	next := len(transfers) - 1
+
+	// Balances come newest first; replay them oldest first
+	latest := make(map[string]float64)
+	snapshot := make(map[string]int64)
+	points := []Point{}
+	for i := len(balances) - 1; i >= 0; {
+		ts := balances[i].Timestamp.UnixMilli()
+		// A snapshot is every currency of an exchange recorded at once
+		for ; i >= 0 && balances[i].Timestamp.UnixMilli() == ts; i-- {
+			b := balances[i]
+			if snapshot[b.Exchange] != ts {
+				snapshot[b.Exchange], latest[b.Exchange] = ts, 0
+			}
+			latest[b.Exchange] += b.Total
+		}
+		// Transfers come newest first too; those up to the snapshot label it
+		var moved float64
+		for ; next >= 0 && transfers[next].Time.UnixMilli() <= ts; next-- {
+			if transfers[next].Completed {
+				moved += transfers[next].Net()
+			}
+		}
+		if time.UnixMilli(ts).Before(q.From) {
+			continue
+		}
+		var equity float64
+		for _, total := range latest {
+			equity += total
+		}
+		points = append(points, Point{Time: time.UnixMilli(ts), Value: equity, Transfers: moved})
+	}
+	return points, nil
+}
+
+// ExposureSeries returns the gross notional of the open positions matching
+// q over time, one point per recorded position change between q.From and q.To
+func (s *Store) ExposureSeries(q Query) ([]Point, error) {
+	positions, err := s.Positions(Query{Exchange: q.Exchange, Pair: q.Pair, Strategy: q.Strategy, To: q.To})
+	if err != nil {
+		return nil, err
+	}
+
+	exposure := make(map[string]float64)
+	points := []Point{}
+	for i := len(positions) - 1; i >= 0; i-- {
+		p := positions[i]
+		price := p.MarkPrice
+		if price <= 0 {
+			price = p.EntryPrice
+		}
+		exposure[p.Exchange+"|"+p.Pair] = math.Abs(p.Size * price)
+		if p.Timestamp.Before(q.From) || i > 0 && positions[i-1].Timestamp.Equal(p.Timestamp) {
+			continue
+		}
+		var gross float64
+		for _, notional := range exposure {
+			gross += notional
+		}
+		points = append(points, Point{Time: p.Timestamp, Value: gross})
+	}
+	return points, nil
+}
@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/nofx/config"
+)
+
+// Store persists orders, fills, position changes, funding payments, balance
+// snapshots, deposits and withdrawals and the signed order audit trail
+type Store struct {
+	db       *sql.DB
+	postgres bool
+
+	// auditKey signs the audit trail; auditLast is the newest signature,
+	// auditRecords the number of records and auditHead the head file
+	auditMu      sync.Mutex
+	auditKey     []byte
+	auditLast    string
+	auditRecords int
+	auditHead    string
+}
+
+// Open opens the configured database and creates the schema if needed
+func Open(cfg config.DatabaseConfig) (*Store, error) {
+	var postgres bool
+	switch cfg.Driver {
+	case "sqlite3", "sqlite":
+		cfg.Driver = "sqlite3"
+		if dir := filepath.Dir(cfg.ConnectionString); cfg.ConnectionString != ":memory:" && dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, err
+			}
+		}
+	case "postgres", "postgresql":
+		cfg.Driver, postgres = "postgres", true
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+
+	db, err := sql.Open(cfg.Driver, cfg.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+	if !postgres {
+		// SQLite serializes writers; a single connection avoids "database is locked"
+		db.SetMaxOpenConns(1)
+	}
+
+	s := &Store{db: db, postgres: postgres}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+	return s, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// migrate creates the tables and indexes
+func (s *Store) migrate() error {
+	serial := "INTEGER PRIMARY KEY AUTOINCREMENT"
+	if s.postgres {
+		serial = "BIGSERIAL PRIMARY KEY"
+	}
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS orders (
+			exchange TEXT NOT NULL,
+			id TEXT NOT NULL,
+			client_order_id TEXT NOT NULL DEFAULT '',
+			pair TEXT NOT NULL,
+			type TEXT NOT NULL,
+			side TEXT NOT NULL,
+			price DOUBLE PRECISION NOT NULL,
+			amount DOUBLE PRECISION NOT NULL,
+			filled_amount DOUBLE PRECISION NOT NULL,
+			status TEXT NOT NULL,
+			strategy TEXT NOT NULL DEFAULT '',
+			created_time BIGINT NOT NULL,
+			updated_time BIGINT NOT NULL,
+			PRIMARY KEY (exchange, id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS orders_pair_time ON orders (pair, created_time)`,
+		`CREATE TABLE IF NOT EXISTS fills (
+			id ` + serial + `,
+			exchange TEXT NOT NULL,
+			order_id TEXT NOT NULL,
+			pair TEXT NOT NULL,
+			side TEXT NOT NULL,
+			price DOUBLE PRECISION NOT NULL,
+			amount DOUBLE PRECISION NOT NULL,
+			strategy TEXT NOT NULL DEFAULT '',
+			timestamp BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS fills_pair_time ON fills (pair, timestamp)`,
+		`CREATE TABLE IF NOT EXISTS positions (
+			id ` + serial + `,
+			exchange TEXT NOT NULL,
+			pair TEXT NOT NULL,
+			side TEXT NOT NULL,
+			size DOUBLE PRECISION NOT NULL,
+			entry_price DOUBLE PRECISION NOT NULL,
+			mark_price DOUBLE PRECISION NOT NULL,
+			unrealized_pnl DOUBLE PRECISION NOT NULL,
+			realized_pnl DOUBLE PRECISION NOT NULL,
+			strategy TEXT NOT NULL DEFAULT '',
+			timestamp BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS positions_pair_time ON positions (pair, timestamp)`,
+		`CREATE TABLE IF NOT EXISTS balances (
+			id ` + serial + `,
+			exchange TEXT NOT NULL,
+			currency TEXT NOT NULL,
+			total DOUBLE PRECISION NOT NULL,
+			available DOUBLE PRECISION NOT NULL,
+			timestamp BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS balances_currency_time ON balances (currency, timestamp)`,
+		`CREATE TABLE IF NOT EXISTS transfers (
+			exchange TEXT NOT NULL,
+			id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			currency TEXT NOT NULL,
+			amount DOUBLE PRECISION NOT NULL,
+			status TEXT NOT NULL,
+			completed BOOLEAN NOT NULL,
+			timestamp BIGINT NOT NULL,
+			PRIMARY KEY (exchange, id, type)
+		)`,
+		`CREATE INDEX IF NOT EXISTS transfers_time ON transfers (timestamp)`,
+		`CREATE TABLE IF NOT EXISTS funding_payments (
+			id ` + serial + `,
+			exchange TEXT NOT NULL,
+			pair TEXT NOT NULL,
+			side TEXT NOT NULL,
+			amount DOUBLE PRECISION NOT NULL,
+			timestamp BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS funding_payments_pair_time ON funding_payments (pair, timestamp)`,
+		`CREATE TABLE IF NOT EXISTS annotations (
+			id TEXT PRIMARY KEY,
+			target TEXT NOT NULL,
+			reference TEXT NOT NULL,
+			pair TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT '',
+			note TEXT NOT NULL DEFAULT '',
+			timestamp BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS annotation_tags (
+			annotation_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (annotation_id, tag)
+		)`,
+		`CREATE INDEX IF NOT EXISTS annotation_tags_tag ON annotation_tags (tag)`,
+		`CREATE TABLE IF NOT EXISTS day_starts (
+			exchange TEXT NOT NULL,
+			day TEXT NOT NULL,
+			balance DOUBLE PRECISION NOT NULL,
+			PRIMARY KEY (exchange, day)
+		)`,
+		`CREATE TABLE IF NOT EXISTS candidates (
+			id TEXT PRIMARY KEY,
+			stage TEXT NOT NULL,
+			config TEXT NOT NULL,
+			created BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS candidate_approvals (
+			candidate_id TEXT NOT NULL,
+			from_stage TEXT NOT NULL,
+			to_stage TEXT NOT NULL,
+			approved_by TEXT NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			timestamp BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS candles (
+			pair TEXT NOT NULL,
+			timeframe TEXT NOT NULL,
+			timestamp BIGINT NOT NULL,
+			open DOUBLE PRECISION NOT NULL,
+			high DOUBLE PRECISION NOT NULL,
+			low DOUBLE PRECISION NOT NULL,
+			close DOUBLE PRECISION NOT NULL,
+			volume DOUBLE PRECISION NOT NULL,
+			PRIMARY KEY (pair, timeframe, timestamp)
+		)`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			seq ` + serial + `,
+			exchange TEXT NOT NULL,
+			event TEXT NOT NULL,
+			reference TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			timestamp BIGINT NOT NULL,
+			signature TEXT NOT NULL
+		)`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	// Columns added since the tables were first created
+	columns := []struct{ table, column, definition string }{
+		{"orders", "avg_price", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := s.addColumn(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column to a table unless it already has it
+func (s *Store) addColumn(table, column, definition string) error {
+	rows, err := s.db.Query("SELECT " + column + " FROM " + table + " LIMIT 0")
+	if err == nil {
+		return rows.Close()
+	}
+	_, err = s.db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// rebind converts ? placeholders to the $n form Postgres expects
+func (s *Store) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// exec runs a statement with ? placeholders
+func (s *Store) exec(query string, args ...interface{}) error {
+	_, err := s.db.Exec(s.rebind(query), args...)
+	return err
+}
+
+// Query represents history query filters; zero values match everything
+type Query struct {
+	Exchange string
+	Pair     string
+	Strategy string
+	From     time.Time
+	To       time.Time
+	Limit    int
+
+	// Refs restricts results to these order IDs (pairs for positions), e.g.
+	// the references carrying a tag; nil disables the filter
+	Refs []string
+}
+
+// where builds the WHERE clause and arguments of a query against a table
+// with the given columns; Pair also filters balances by currency
+func (q Query) where(pairColumn, strategyColumn, refColumn, timeColumn string) (string, []interface{}) {
+	conds, args := q.conditions(pairColumn, strategyColumn, refColumn, timeColumn)
+	clause := ""
+	if len(conds) > 0 {
+		clause = " WHERE " + strings.Join(conds, " AND ")
+	}
+	clause += " ORDER BY " + timeColumn + " DESC"
+	if q.Limit > 0 {
+		clause += " LIMIT " + strconv.Itoa(q.Limit)
+	}
+	return clause, args
+}
+
+// conditions returns the conditions of the filters of a query and their arguments
+func (q Query) conditions(pairColumn, strategyColumn, refColumn, timeColumn string) ([]string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if q.Exchange != "" {
+		conds = append(conds, "exchange = ?")
+		args = append(args, q.Exchange)
+	}
+	if q.Pair != "" && pairColumn != "" {
+		conds = append(conds, pairColumn+" = ?")
+		args = append(args, q.Pair)
+	}
+	if q.Strategy != "" && strategyColumn != "" {
+		conds = append(conds, strategyColumn+" = ?")
+		args = append(args, q.Strategy)
+	}
+	if q.Refs != nil && refColumn != "" {
+		if len(q.Refs) == 0 {
+			conds = append(conds, "1 = 0")
+		} else {
+			conds = append(conds, refColumn+" IN (?"+strings.Repeat(", ?", len(q.Refs)-1)+")")
+			for _, ref := range q.Refs {
+				args = append(args, ref)
+			}
+		}
+	}
+	if !q.From.IsZero() {
+		conds = append(conds, timeColumn+" >= ?")
+		args = append(args, q.From.UnixMilli())
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, timeColumn+" < ?")
+		args = append(args, q.To.UnixMilli())
+	}
+	return conds, args
+}
@@ -0,0 +1,166 @@
+package strategy
+
+import (
+	"github.com/nofx/indicators"
+	"github.com/nofx/market"
+)
+
+// The built-in strategies, available to the promotion workflow, shadow
+// accounts and re-optimization by name
+func init() {
+	Define(TrendFollowing{})
+	Define(Breakout{})
+	Define(MeanReversion{})
+}
+
+// param returns a parameter as a period of at least 1, or fallback when unset
+func param(params Params, name string, fallback float64) int {
+	v, ok := params[name]
+	if !ok || v < 1 {
+		v = fallback
+	}
+	return int(v)
+}
+
+// closes returns the close prices of the last n candles
+func closes(candles []market.CandleData, n int) []float64 {
+	if n > len(candles) {
+		n = len(candles)
+	}
+	prices := make([]float64, n)
+	for i, c := range candles[len(candles)-n:] {
+		prices[i] = c.Close
+	}
+	return prices
+}
+
+// TrendFollowing holds the side of the fast moving average of closes
+// relative to the slow one ("trend"; params fast and slow, in candles)
+type TrendFollowing struct{}
+
+// Name implements Strategy
+func (TrendFollowing) Name() string {
+	return "trend"
+}
+
+// Signal implements Strategy
+func (TrendFollowing) Signal(candles []market.CandleData, params Params) Signal {
+	fast, slow := param(params, "fast", 20), param(params, "slow", 50)
+	if fast >= slow || len(candles) < slow {
+		return Flat
+	}
+	fastMA, slowMA := indicators.Mean(closes(candles, fast)), indicators.Mean(closes(candles, slow))
+	switch {
+	case fastMA > slowMA:
+		return Long
+	case fastMA < slowMA:
+		return Short
+	}
+	return Flat
+}
+
+// ParamGrid implements Strategy
+func (TrendFollowing) ParamGrid() map[string][]float64 {
+	return map[string][]float64{
+		"fast": {10, 20, 30},
+		"slow": {50, 100, 200},
+	}
+}
+
+// Lookback implements Lookback
+func (TrendFollowing) Lookback(params Params) int {
+	return param(params, "slow", 50)
+}
+
+// Breakout goes long on a close above the highest high of the previous
+// period candles and short on one below their lowest low, holding the
+// position until the opposite breakout ("breakout"; param period)
+type Breakout struct{}
+
+// Name implements Strategy
+func (Breakout) Name() string {
+	return "breakout"
+}
+
+// Signal implements Strategy
+func (Breakout) Signal(candles []market.CandleData, params Params) Signal {
+	period := param(params, "period", 20)
+	signal := Flat
+	for i := period; i < len(candles); i++ {
+		high, low := candles[i-period].High, candles[i-period].Low
+		for _, c := range candles[i-period+1 : i] {
+			if c.High > high {
+				high = c.High
+			}
+			if c.Low < low {
+				low = c.Low
+			}
+		}
+		switch {
+		case candles[i].Close > high:
+			signal = Long
+		case candles[i].Close < low:
+			signal = Short
+		}
+	}
+	return signal
+}
+
+// ParamGrid implements Strategy
+func (Breakout) ParamGrid() map[string][]float64 {
+	return map[string][]float64{
+		"period": {10, 20, 55},
+	}
+}
+
+// Lookback implements Lookback
+func (Breakout) Lookback(params Params) int {
+	return 4 * param(params, "period", 20)
+}
+
+// MeanReversion fades closes more than entry standard deviations away from
+// their period mean, and is flat otherwise ("mean_reversion"; params period
+// and entry)
+type MeanReversion struct{}
+
+// Name implements Strategy
+func (MeanReversion) Name() string {
+	return "mean_reversion"
+}
+
+// Signal implements Strategy
+func (MeanReversion) Signal(candles []market.CandleData, params Params) Signal {
+	period := param(params, "period", 20)
+	entry, ok := params["entry"]
+	if !ok || entry <= 0 {
+		entry = 2
+	}
+	if len(candles) < period {
+		return Flat
+	}
+	prices := closes(candles, period)
+	mean, sd := indicators.Mean(prices), indicators.StdDev(prices)
+	if sd <= 0 {
+		return Flat
+	}
+	switch z := (prices[len(prices)-1] - mean) / sd; {
+	case z > entry:
+		return Short
+	case z < -entry:
+		return Long
+	}
+	return Flat
+}
+
+// ParamGrid implements Strategy
+func (MeanReversion) ParamGrid() map[string][]float64 {
+	return map[string][]float64{
+		"period": {20, 50},
+		"entry":  {1.5, 2, 2.5},
+	}
+}
+
+// Lookback implements Lookback
+func (MeanReversion) Lookback(params Params) int {
+	return param(params, "period", 20)
+}
@@ -0,0 +1,46 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	catalogMu sync.RWMutex
+	catalog   = make(map[string]Strategy)
+)
+
+// Define makes a strategy implementation available by name, typically from
+// the init function of the package implementing it
+func Define(s Strategy) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	if _, ok := catalog[s.Name()]; ok {
+		panic("strategy: Define called twice for " + s.Name())
+	}
+	catalog[s.Name()] = s
+}
+
+// Lookup returns the defined strategy implementation with a name
+func Lookup(name string) (Strategy, error) {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	s, ok := catalog[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+	return s, nil
+}
+
+// Defined returns the names of all defined strategy implementations, sorted
+func Defined() []string {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	names := make([]string, 0, len(catalog))
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,89 @@
+package strategy
+
+import (
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+)
+
+// BarSource delivers the live bars of a series, typically the bar builder
+type BarSource interface {
+	Subscribe(pair, interval string, partial bool) (*market.BarSubscription, error)
+}
+
+// SignalEventType is the MarketEvent type used for published live signals
+const SignalEventType = "strategy_signal"
+
+// SignalEvent represents the signal of an instance at a bar close published
+// as a market event
+type SignalEvent struct {
+	Instance string `json:"instance"`
+	Strategy string `json:"strategy"`
+	Interval string `json:"interval"`
+	Stage    string `json:"stage"`
+	Signal   Signal `json:"signal"`
+	BarTime  int64  `json:"bar_time"`
+	// Latency is the time from the bar close to the signal, in seconds
+	Latency float64 `json:"latency"`
+}
+
+// SignalSink receives the signal of an instance after every bar close
+type SignalSink func(instance *Instance, signal Signal, bar market.Bar)
+
+// FollowBars evaluates every instance, registered now or later, at each
+// close of its live bars and hands the signals to sink; sink may be nil to
+// only keep the instances' histories current
+func (r *Registry) FollowBars(bars BarSource, sink SignalSink) {
+	r.mu.Lock()
+	r.bars, r.onSignal = bars, sink
+	instances := make([]*Instance, 0, len(r.instances))
+	for _, i := range r.instances {
+		instances = append(instances, i)
+	}
+	r.mu.Unlock()
+
+	for _, i := range instances {
+		r.follow(i)
+	}
+}
+
+// follow subscribes an instance to the closes of its live bars
+func (r *Registry) follow(i *Instance) {
+	r.mu.Lock()
+	bars, sink := r.bars, r.onSignal
+	r.mu.Unlock()
+	if bars == nil {
+		return
+	}
+
+	sub, err := bars.Subscribe(i.Pair, i.Interval, false)
+	if err != nil {
+		logger.Warning("Strategy %s can't follow live bars: %v", i.Name(), err)
+		return
+	}
+	r.mu.Lock()
+	if old, ok := r.live[i.Name()]; ok {
+		old.Close()
+	}
+	r.live[i.Name()] = sub
+	r.mu.Unlock()
+
+	go func() {
+		for bar := range sub.C {
+			signal, ok := i.Update(bar.Candle)
+			if ok && sink != nil {
+				sink(i, signal, bar)
+			}
+		}
+	}()
+}
+
+// unfollow ends the live bar subscription of an instance, if any
+func (r *Registry) unfollow(name string) {
+	r.mu.Lock()
+	sub, ok := r.live[name]
+	delete(r.live, name)
+	r.mu.Unlock()
+	if ok {
+		sub.Close()
+	}
+}
@@ -0,0 +1,58 @@
+package strategy
+
+import "github.com/nofx/market"
+
+// Metrics is implemented by strategies exposing custom named values of their
+// internals, e.g. "signal_strength", evaluated alongside every live signal
+type Metrics interface {
+	// Metrics returns the metric values after the last candle
+	Metrics(candles []market.CandleData, params Params) map[string]float64
+}
+
+// MetricsEventType is the MarketEvent type used for published strategy metrics
+const MetricsEventType = "strategy_metrics"
+
+// MetricsEvent represents the custom metrics of an instance published as a market event
+type MetricsEvent struct {
+	Instance string             `json:"instance"`
+	Strategy string             `json:"strategy"`
+	Interval string             `json:"interval"`
+	Stage    string             `json:"stage"`
+	Values   map[string]float64 `json:"values"`
+}
+
+// MetricSink receives the custom metrics of an instance after every signal
+type MetricSink func(instance *Instance, values map[string]float64)
+
+// Metrics returns a copy of the custom metrics of the last signal, nil when
+// the strategy doesn't expose any
+func (i *Instance) Metrics() map[string]float64 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.metrics == nil {
+		return nil
+	}
+	values := make(map[string]float64, len(i.metrics))
+	for name, v := range i.metrics {
+		values[name] = v
+	}
+	return values
+}
+
+// evaluateMetrics records the custom metrics of the strategy, if any, and
+// hands them to the sink
+func (i *Instance) evaluateMetrics(candles []market.CandleData, params Params) {
+	m, ok := i.Strategy.(Metrics)
+	if !ok {
+		return
+	}
+	values := m.Metrics(candles, params)
+
+	i.mu.Lock()
+	i.metrics = values
+	sink := i.sink
+	i.mu.Unlock()
+	if sink != nil && len(values) > 0 {
+		sink(i, values)
+	}
+}
@@ -0,0 +1,203 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/nofx/market"
+)
+
+// Signal represents the position a strategy wants to hold
+type Signal int
+
+const (
+	// Flat means no position
+	Flat Signal = 0
+	// Long means a long position
+	Long Signal = 1
+	// Short means a short position
+	Short Signal = -1
+)
+
+// Params represents the tunable parameters of a strategy
+type Params map[string]float64
+
+// Clone returns a copy of the parameters
+func (p Params) Clone() Params {
+	c := make(Params, len(p))
+	for k, v := range p {
+		c[k] = v
+	}
+	return c
+}
+
+// Strategy is a stateless trading rule evaluated over a candle series
+type Strategy interface {
+	// Name returns the unique strategy name
+	Name() string
+
+	// Signal returns the desired position after the last candle
+	Signal(candles []market.CandleData, params Params) Signal
+
+	// ParamGrid returns the candidate values of every tunable parameter
+	ParamGrid() map[string][]float64
+}
+
+// Budget represents the risk a strategy instance may take; 0 means unlimited
+type Budget struct {
+	MaxNotional  float64 `json:"max_notional"`
+	MaxDailyLoss float64 `json:"max_daily_loss"`
+}
+
+// Instance represents a strategy running on a pair with its current parameters
+type Instance struct {
+	Strategy Strategy
+	Pair     string
+	Interval string
+
+	mu      sync.RWMutex
+	params  Params
+	budget  Budget
+	history []market.CandleData
+	warm    bool
+	metrics map[string]float64
+	sink    MetricSink
+}
+
+// NewInstance creates a new strategy instance
+func NewInstance(s Strategy, pair, interval string, params Params) *Instance {
+	return &Instance{
+		Strategy: s,
+		Pair:     pair,
+		Interval: interval,
+		params:   params.Clone(),
+	}
+}
+
+// Name returns the instance name
+func (i *Instance) Name() string {
+	return i.Strategy.Name() + ":" + i.Pair
+}
+
+// Params returns a copy of the current parameters
+func (i *Instance) Params() Params {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.params.Clone()
+}
+
+// SetParams replaces the current parameters
+func (i *Instance) SetParams(params Params) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.params = params.Clone()
+}
+
+// Budget returns the risk budget
+func (i *Instance) Budget() Budget {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.budget
+}
+
+// SetBudget replaces the risk budget
+func (i *Instance) SetBudget(budget Budget) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.budget = budget
+}
+
+// Signal evaluates the strategy with the current parameters, along with its
+// custom metrics
+func (i *Instance) Signal(candles []market.CandleData) Signal {
+	params := i.Params()
+	signal := i.Strategy.Signal(candles, params)
+	i.evaluateMetrics(candles, params)
+	return signal
+}
+
+// Registry holds the running strategy instances
+type Registry struct {
+	source CandleSource
+
+	// OnMetrics receives the custom metrics of instances registered afterwards
+	OnMetrics MetricSink
+
+	mu        sync.RWMutex
+	instances map[string]*Instance
+	bars      BarSource
+	onSignal  SignalSink
+	live      map[string]*market.BarSubscription
+}
+
+// NewRegistry creates a new strategy registry warming instances up from
+// source when they are registered; source may be nil to skip the warm-up
+func NewRegistry(source CandleSource) *Registry {
+	return &Registry{
+		source:    source,
+		instances: make(map[string]*Instance),
+		live:      make(map[string]*market.BarSubscription),
+	}
+}
+
+// Register warms a strategy instance up and adds it
+func (r *Registry) Register(i *Instance) error {
+	r.mu.RLock()
+	_, exists := r.instances[i.Name()]
+	r.mu.RUnlock()
+	if exists {
+		return fmt.Errorf("strategy %s already registered", i.Name())
+	}
+
+	if r.source != nil {
+		if err := i.WarmUp(r.source); err != nil {
+			return fmt.Errorf("strategy %s warm-up: %v", i.Name(), err)
+		}
+	}
+
+	r.mu.Lock()
+	if _, ok := r.instances[i.Name()]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("strategy %s already registered", i.Name())
+	}
+	i.mu.Lock()
+	i.sink = r.OnMetrics
+	i.mu.Unlock()
+	r.instances[i.Name()] = i
+	r.mu.Unlock()
+
+	r.follow(i)
+	return nil
+}
+
+// Get returns a strategy instance by name
+func (r *Registry) Get(name string) (*Instance, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	i, ok := r.instances[name]
+	if !ok {
+		return nil, fmt.Errorf("strategy %s not found", name)
+	}
+	return i, nil
+}
+
+// Remove removes a strategy instance by name
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	delete(r.instances, name)
+	r.mu.Unlock()
+	r.unfollow(name)
+}
+
+// All returns every registered instance sorted by name
+func (r *Registry) All() []*Instance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := make([]*Instance, 0, len(r.instances))
+	for _, i := range r.instances {
+		all = append(all, i)
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].Name() < all[b].Name() })
+	return all
+}
@@ -0,0 +1,115 @@
+package strategy
+
+import (
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+)
+
+// maxHistory is how many candles an instance keeps when its strategy
+// doesn't declare a lookback
+const maxHistory = 1000
+
+// CandleSource provides historical candles, typically the candle store
+type CandleSource interface {
+	Get(pair, interval string, limit int) ([]market.CandleData, error)
+}
+
+// Lookback is implemented by strategies whose indicators need a minimum
+// number of candles before their signals mean anything
+type Lookback interface {
+	// Lookback returns the number of candles the strategy needs with the given parameters
+	Lookback(params Params) int
+}
+
+// Lookback returns the number of candles the instance needs before it
+// processes live data, 0 when its strategy doesn't declare one
+func (i *Instance) Lookback() int {
+	if l, ok := i.Strategy.(Lookback); ok {
+		return l.Lookback(i.Params())
+	}
+	return 0
+}
+
+// WarmUp loads the instance's lookback of historical candles from source so
+// the first live candles are evaluated over a full history
+func (i *Instance) WarmUp(source CandleSource) error {
+	lookback := i.Lookback()
+	if lookback <= 0 {
+		i.mu.Lock()
+		i.warm = true
+		i.mu.Unlock()
+		return nil
+	}
+
+	candles, err := source.Get(i.Pair, i.Interval, lookback)
+	if err != nil {
+		return err
+	}
+	if len(candles) < lookback {
+		logger.Warning("Strategy %s warmed up with %d of %d candles, waiting for live data",
+			i.Name(), len(candles), lookback)
+	} else {
+		logger.Info("Strategy %s warmed up with %d %s candles", i.Name(), len(candles), i.Interval)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.history = nil
+	for _, c := range candles {
+		i.append(c, lookback)
+	}
+	i.warm = len(i.history) >= lookback
+	return nil
+}
+
+// Warm reports whether the instance holds enough candles to emit signals
+func (i *Instance) Warm() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.warm
+}
+
+// Update adds a live candle, replacing the last one when it has the same
+// timestamp, and returns the resulting signal; ok is false while the instance
+// still lacks its lookback
+func (i *Instance) Update(c market.CandleData) (signal Signal, ok bool) {
+	lookback := i.Lookback()
+
+	i.mu.Lock()
+	i.append(c, lookback)
+	if !i.warm && len(i.history) >= lookback {
+		i.warm = true
+	}
+	warm := i.warm
+	history := append([]market.CandleData(nil), i.history...)
+	i.mu.Unlock()
+
+	if !warm {
+		return Flat, false
+	}
+	return i.Signal(history), true
+}
+
+// append adds a candle to the history, keeping at most lookback candles;
+// older candles are ignored. The caller must hold the write lock.
+func (i *Instance) append(c market.CandleData, lookback int) {
+	if n := len(i.history); n > 0 {
+		last := i.history[n-1].Timestamp
+		if c.Timestamp < last {
+			return
+		}
+		if c.Timestamp == last {
+			i.history[n-1] = c
+			return
+		}
+	}
+	i.history = append(i.history, c)
+
+	limit := lookback
+	if limit <= 0 {
+		limit = maxHistory
+	}
+	if len(i.history) > limit {
+		i.history = i.history[len(i.history)-limit:]
+	}
+}
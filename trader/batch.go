@@ -0,0 +1,79 @@
+package trader
+
+import (
+	"context"
+	"sync"
+)
+
+// CloseFilter selects the positions closed by a batch close; empty fields match everything
+type CloseFilter struct {
+	Side       Side     `json:"side,omitempty"`
+	Pairs      []string `json:"pairs,omitempty"`
+	Strategy   string   `json:"strategy,omitempty"`
+	LosingOnly bool     `json:"losing_only,omitempty"`
+}
+
+// Match reports whether a position is selected by the filter
+func (f CloseFilter) Match(p Position) bool {
+	if p.Size == 0 {
+		return false
+	}
+	if f.Side != "" && p.Side != f.Side {
+		return false
+	}
+	if f.Strategy != "" && p.Strategy != f.Strategy {
+		return false
+	}
+	if f.LosingOnly && p.UnrealizedPnl >= 0 {
+		return false
+	}
+	if len(f.Pairs) == 0 {
+		return true
+	}
+	for _, pair := range f.Pairs {
+		if pair == p.Pair {
+			return true
+		}
+	}
+	return false
+}
+
+// CloseResult represents the outcome of closing a single position in a batch
+type CloseResult struct {
+	Pair  string  `json:"currency_pair"`
+	Side  Side    `json:"side"`
+	Size  float64 `json:"size"`
+	Order *Order  `json:"order,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// CloseBatch concurrently closes every position matching the filter through
+// the slippage guard and returns one result per matched position
+func CloseBatch(ctx context.Context, t Trader, positions []Position, filter CloseFilter, guard *SlippageGuard) []CloseResult {
+	var matched []Position
+	for _, p := range positions {
+		if filter.Match(p) {
+			matched = append(matched, p)
+		}
+	}
+
+	results := make([]CloseResult, len(matched))
+	var wg sync.WaitGroup
+	for i, p := range matched {
+		wg.Add(1)
+		go func(i int, p Position) {
+			defer wg.Done()
+			result := CloseResult{Pair: p.Pair, Side: p.Side, Size: p.Size}
+			order, err := guard.Close(ctx, t, p, p.Size)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Order = order
+			}
+			results[i] = result
+		}(i, p)
+	}
+	wg.Wait()
+
+	return results
+}
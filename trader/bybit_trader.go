@@ -0,0 +1,924 @@
+package trader
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/ratelimit"
+	"github.com/nofx/retry"
+)
+
+// BybitTrader must satisfy the typed Trader interface
+var _ Trader = (*BybitTrader)(nil)
+
+// bybitRecvWindow is the validity window in milliseconds for signed requests
+const bybitRecvWindow = "5000"
+
+// bybitLeverageNotModified is returned when the requested leverage is already set
+const bybitLeverageNotModified = 110043
+
+// bybitDuplicateOrderLinkID is returned when an orderLinkId was already used
+const bybitDuplicateOrderLinkID = 110072
+
+// bybitErrorKinds maps Bybit error codes to the trading errors they represent
+var bybitErrorKinds = map[int]error{
+	10006:  ErrRateLimited,
+	10018:  ErrRateLimited,
+	10429:  ErrRateLimited,
+	110004: ErrInsufficientBalance,
+	110007: ErrInsufficientBalance,
+	110012: ErrInsufficientBalance,
+	110045: ErrInsufficientBalance,
+	110017: ErrNoPosition,
+	110094: ErrMinNotional,
+	10003:  ErrUnauthorized,
+	10004:  ErrUnauthorized,
+	10005:  ErrUnauthorized,
+	10007:  ErrUnauthorized,
+	10010:  ErrUnauthorized,
+	33004:  ErrUnauthorized,
+
+	bybitLeverageNotModified: ErrLeverageAlreadySet,
+}
+
+// bybitTransientCodes are the Bybit error codes of temporary conditions:
+// request timeout, server error, unknown error and rate limited
+var bybitTransientCodes = map[int]bool{10000: true, 10006: true, 10016: true, 10429: true}
+
+// BybitTrader implements the Trader interface for Bybit v5 unified trading
+// accounts on USDT linear perpetuals
+type BybitTrader struct {
+	apiKey     string
+	secretKey  string
+	baseURL    string
+	prefix     string
+	contracts  ContractSource
+	limiter    *ratelimit.Limiter
+	retries    retry.Policy
+	httpClient *http.Client
+
+	// Bybit needs the symbol to query or cancel an order by ID
+	mu         sync.RWMutex
+	orderPairs map[string]string
+}
+
+// NewBybitTrader creates a new Bybit trader
+func NewBybitTrader(apiKey, secretKey, baseURL string) *BybitTrader {
+	if baseURL == "" {
+		baseURL = "https://api.bybit.com"
+	}
+	return &BybitTrader{
+		apiKey:     apiKey,
+		secretKey:  secretKey,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		retries:    retry.DefaultPolicy,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		orderPairs: make(map[string]string),
+	}
+}
+
+// SetContracts sets the contract metadata source used for price and quantity precision
+func (t *BybitTrader) SetContracts(contracts ContractSource) {
+	t.contracts = contracts
+}
+
+// SetRateLimiter sets the limiter throttling the REST calls
+func (t *BybitTrader) SetRateLimiter(limiter *ratelimit.Limiter) {
+	t.limiter = limiter
+}
+
+// SetRetryPolicy sets how failed REST calls are retried
+func (t *BybitTrader) SetRetryPolicy(policy retry.Policy) {
+	t.retries = policy
+}
+
+// SetClientOrderPrefix sets the prefix tagging every order placed by this instance
+func (t *BybitTrader) SetClientOrderPrefix(prefix string) {
+	t.prefix = prefix
+}
+
+// clientOrderID generates and tracks the orderLinkId of an order on pair,
+// which Bybit limits to 36 characters
+func (t *BybitTrader) clientOrderID(ctx context.Context, pair string) string {
+	id := NewClientOrderID(bybitTag(clientOrderPrefix(ctx, t.prefix)))
+	trackClientOrder(ctx, pair, id)
+	return id
+}
+
+// BybitSymbol converts a pair such as BTC_USDT to a Bybit symbol (BTCUSDT)
+func BybitSymbol(pair string) string {
+	return strings.ToUpper(strings.NewReplacer("_", "", "-", "", "/", "").Replace(pair))
+}
+
+// BybitPair converts a Bybit linear symbol back to a pair such as BTC_USDT
+func BybitPair(symbol string) string {
+	for _, quote := range []string{"USDT", "USDC"} {
+		if strings.HasSuffix(symbol, quote) && len(symbol) > len(quote) {
+			return strings.TrimSuffix(symbol, quote) + "_" + quote
+		}
+	}
+	return symbol
+}
+
+// bybitResponse represents the common Bybit v5 response envelope
+type bybitResponse struct {
+	RetCode int             `json:"retCode"`
+	RetMsg  string          `json:"retMsg"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// bybitOrder represents an order as returned by Bybit
+type bybitOrder struct {
+	OrderID       string `json:"orderId"`
+	OrderLinkID   string `json:"orderLinkId"`
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`
+	OrderType     string `json:"orderType"`
+	StopOrderType string `json:"stopOrderType"`
+	Price         string `json:"price"`
+	TriggerPrice  string `json:"triggerPrice"`
+	Qty           string `json:"qty"`
+	CumExecQty    string `json:"cumExecQty"`
+	AvgPrice      string `json:"avgPrice"`
+	OrderStatus   string `json:"orderStatus"`
+	TimeInForce   string `json:"timeInForce"`
+	CreatedTime   string `json:"createdTime"`
+	UpdatedTime   string `json:"updatedTime"`
+}
+
+// GetBalance implements the Trader interface
+func (t *BybitTrader) GetBalance(ctx context.Context) ([]Balance, error) {
+	var result struct {
+		List []struct {
+			Coin []struct {
+				Coin            string `json:"coin"`
+				Equity          string `json:"equity"`
+				Locked          string `json:"locked"`
+				TotalOrderIM    string `json:"totalOrderIM"`
+				TotalPositionIM string `json:"totalPositionIM"`
+				UnrealisedPnl   string `json:"unrealisedPnl"`
+			} `json:"coin"`
+		} `json:"list"`
+	}
+	query := url.Values{"accountType": {"UNIFIED"}}
+	if err := t.request(ctx, "GET", "/v5/account/wallet-balance", query, nil, &result); err != nil {
+		return nil, err
+	}
+
+	var balances []Balance
+	for _, account := range result.List {
+		for _, c := range account.Coin {
+			total := parseFloat(c.Equity)
+			inOrders := parseFloat(c.Locked) + parseFloat(c.TotalOrderIM)
+			balances = append(balances, Balance{
+				Currency:      c.Coin,
+				Total:         total,
+				Available:     total - inOrders - parseFloat(c.TotalPositionIM),
+				InOrders:      inOrders,
+				UnrealizedPnl: parseFloat(c.UnrealisedPnl),
+			})
+		}
+	}
+	return balances, nil
+}
+
+// GetPosition implements the Trader interface
+func (t *BybitTrader) GetPosition(ctx context.Context, pair string) (*Position, error) {
+	positions, err := t.positions(ctx, url.Values{"category": {"linear"}, "symbol": {BybitSymbol(pair)}})
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		return nil, nil
+	}
+	return &positions[0], nil
+}
+
+// GetPositions implements the Trader interface
+func (t *BybitTrader) GetPositions(ctx context.Context) ([]Position, error) {
+	return t.positions(ctx, url.Values{"category": {"linear"}, "settleCoin": {"USDT"}})
+}
+
+// positions queries open positions matching the given filters
+func (t *BybitTrader) positions(ctx context.Context, query url.Values) ([]Position, error) {
+	var result struct {
+		List []struct {
+			Symbol         string `json:"symbol"`
+			Side           string `json:"side"`
+			Size           string `json:"size"`
+			AvgPrice       string `json:"avgPrice"`
+			MarkPrice      string `json:"markPrice"`
+			UnrealisedPnl  string `json:"unrealisedPnl"`
+			CumRealisedPnl string `json:"cumRealisedPnl"`
+			Leverage       string `json:"leverage"`
+			LiqPrice       string `json:"liqPrice"`
+			PositionStatus string `json:"positionStatus"`
+			CreatedTime    string `json:"createdTime"`
+			UpdatedTime    string `json:"updatedTime"`
+		} `json:"list"`
+	}
+	if err := t.request(ctx, "GET", "/v5/position/list", query, nil, &result); err != nil {
+		return nil, err
+	}
+
+	var positions []Position
+	for _, p := range result.List {
+		size := parseFloat(p.Size)
+		if size == 0 {
+			continue
+		}
+		positions = append(positions, Position{
+			ID:               p.Symbol + "-" + p.Side,
+			Pair:             BybitPair(p.Symbol),
+			Side:             bybitSide(p.Side),
+			Size:             size,
+			EntryPrice:       parseFloat(p.AvgPrice),
+			MarkPrice:        parseFloat(p.MarkPrice),
+			UnrealizedPnl:    parseFloat(p.UnrealisedPnl),
+			RealizedPnl:      parseFloat(p.CumRealisedPnl),
+			Leverage:         int64(parseFloat(p.Leverage)),
+			LiquidationPrice: parseFloat(p.LiqPrice),
+			Status:           strings.ToLower(p.PositionStatus),
+			CreatedTime:      int64(parseFloat(p.CreatedTime)),
+			UpdatedTime:      int64(parseFloat(p.UpdatedTime)),
+		})
+	}
+	if err := t.fillFunding(ctx, positions); err != nil {
+		logger.Warning("Failed to get Bybit funding payments: %v", err)
+	}
+	return positions, nil
+}
+
+// bybitFundingLookback is the longest range the transaction log can be queried over
+const bybitFundingLookback = 7 * 24 * time.Hour
+
+// fillFunding sets the funding each position received or paid since it
+// opened, from the settlement entries of the transaction log; the log only
+// covers the last seven days, so older positions report a partial sum
+func (t *BybitTrader) fillFunding(ctx context.Context, positions []Position) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	start := time.Now().UnixMilli()
+	for _, p := range positions {
+		if p.CreatedTime < start {
+			start = p.CreatedTime
+		}
+	}
+	if earliest := time.Now().Add(-bybitFundingLookback).UnixMilli(); start < earliest {
+		start = earliest
+	}
+
+	query := url.Values{
+		"accountType": {"UNIFIED"},
+		"category":    {"linear"},
+		"type":        {"SETTLEMENT"},
+		"startTime":   {strconv.FormatInt(start, 10)},
+		"limit":       {"50"},
+	}
+	for {
+		var result struct {
+			List []struct {
+				Symbol          string `json:"symbol"`
+				Side            string `json:"side"`
+				Change          string `json:"change"`
+				TransactionTime string `json:"transactionTime"`
+			} `json:"list"`
+			NextPageCursor string `json:"nextPageCursor"`
+		}
+		if err := t.request(ctx, "GET", "/v5/account/transaction-log", query, nil, &result); err != nil {
+			return err
+		}
+		for _, entry := range result.List {
+			at := int64(parseFloat(entry.TransactionTime))
+			for i := range positions {
+				p := &positions[i]
+				if BybitPair(entry.Symbol) == p.Pair && bybitSide(entry.Side) == p.Side && at >= p.CreatedTime {
+					p.Funding += parseFloat(entry.Change)
+				}
+			}
+		}
+		if result.NextPageCursor == "" || len(result.List) == 0 {
+			return nil
+		}
+		query.Set("cursor", result.NextPageCursor)
+	}
+}
+
+// CreateOrder implements the Trader interface
+func (t *BybitTrader) CreateOrder(ctx context.Context, req OrderRequest) (*Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.Type != MarketOrder && req.Type != LimitOrder {
+		return nil, unsupportedType(req.Type)
+	}
+	if req.Leverage > 0 {
+		if err := t.SetLeverage(ctx, req.Pair, req.Leverage); err != nil && !errors.Is(err, ErrLeverageAlreadySet) {
+			return nil, err
+		}
+	}
+
+	qty, err := roundQuantity(t.contracts, req.Pair, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"category":  "linear",
+		"symbol":    BybitSymbol(req.Pair),
+		"side":      bybitOrderSide(req.Side),
+		"orderType": "Market",
+		"qty":       strconv.FormatFloat(qty, 'f', -1, 64),
+	}
+	if req.ReduceOnly {
+		body["reduceOnly"] = true
+	}
+	price := req.Price
+	if req.Type == LimitOrder {
+		price = roundPrice(t.contracts, req.Pair, price)
+		body["orderType"] = "Limit"
+		body["price"] = formatPrice(t.contracts, req.Pair, price)
+		body["timeInForce"] = bybitTimeInForce(req)
+	}
+
+	return t.placeOrder(ctx, req.Pair, req.Side, req.Type, qty, price, body)
+}
+
+// bybitTimeInForce returns the Bybit time in force expressing the execution
+// flags of a limit order
+func bybitTimeInForce(req OrderRequest) string {
+	switch {
+	case req.PostOnly:
+		return "PostOnly"
+	case req.TimeInForce == ImmediateOrCancel:
+		return "IOC"
+	case req.TimeInForce == FillOrKill:
+		return "FOK"
+	default:
+		return "GTC"
+	}
+}
+
+// placeOrder submits an order and returns it in the local model
+func (t *BybitTrader) placeOrder(ctx context.Context, pair string, side Side, orderType OrderType, amount, price float64, body map[string]interface{}) (*Order, error) {
+	body["orderLinkId"] = t.clientOrderID(ctx, pair)
+
+	var result struct {
+		OrderID     string `json:"orderId"`
+		OrderLinkID string `json:"orderLinkId"`
+	}
+	err := t.request(ctx, "POST", "/v5/order/create", nil, body, &result)
+	if errors.Is(err, errDuplicateClientOrderID) {
+		// An earlier attempt reached the exchange before failing
+		clientOrderID := body["orderLinkId"].(string)
+		logger.Info("Bybit order %s was placed by an earlier attempt, looking it up", clientOrderID)
+		return t.GetOrderByClientID(ctx, pair, clientOrderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.orderPairs[result.OrderID] = pair
+	t.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	return &Order{
+		ID:            result.OrderID,
+		ClientOrderID: result.OrderLinkID,
+		Pair:          pair,
+		Type:          orderType,
+		Side:          side,
+		Price:         price,
+		Amount:        amount,
+		Status:        OrderStatusNew,
+		CreatedTime:   now,
+		UpdatedTime:   now,
+	}, nil
+}
+
+// GetOrderByClientID implements ClientOrderLookup
+func (t *BybitTrader) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*Order, error) {
+	orders, err := t.orders(ctx, url.Values{"category": {"linear"}, "symbol": {BybitSymbol(pair)}, "orderLinkId": {clientOrderID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("Bybit order %s: %w", clientOrderID, ErrOrderNotFound)
+	}
+	return &orders[0], nil
+}
+
+// bybitTransferWindow is the longest range Bybit's transfer records cover per request
+const bybitTransferWindow = 30 * 24 * time.Hour
+
+// GetTransfers implements TransferReader with the deposit and withdrawal
+// records since a time, at most the last 30 days
+func (t *BybitTrader) GetTransfers(ctx context.Context, since time.Time) ([]Transfer, error) {
+	now := time.Now()
+	if earliest := now.Add(-bybitTransferWindow); since.Before(earliest) {
+		since = earliest
+	}
+	query := url.Values{
+		"startTime": {strconv.FormatInt(since.UnixMilli(), 10)},
+		"endTime":   {strconv.FormatInt(now.UnixMilli(), 10)},
+	}
+
+	var deposits struct {
+		Rows []struct {
+			ID        string `json:"id"`
+			TxID      string `json:"txID"`
+			Coin      string `json:"coin"`
+			Amount    string `json:"amount"`
+			Status    int    `json:"status"`
+			SuccessAt string `json:"successAt"`
+		} `json:"rows"`
+	}
+	if err := t.request(ctx, "GET", "/v5/asset/deposit/query-record", query, nil, &deposits); err != nil {
+		return nil, err
+	}
+	var withdrawals struct {
+		Rows []struct {
+			WithdrawID string `json:"withdrawId"`
+			Coin       string `json:"coin"`
+			Amount     string `json:"amount"`
+			Status     string `json:"status"`
+			CreateTime string `json:"createTime"`
+		} `json:"rows"`
+	}
+	if err := t.request(ctx, "GET", "/v5/asset/withdraw/query-record", query, nil, &withdrawals); err != nil {
+		return nil, err
+	}
+
+	transfers := make([]Transfer, 0, len(deposits.Rows)+len(withdrawals.Rows))
+	for _, d := range deposits.Rows {
+		id := d.ID
+		if id == "" {
+			id = d.TxID
+		}
+		transfers = append(transfers, Transfer{
+			ID:        id,
+			Type:      Deposit,
+			Currency:  d.Coin,
+			Amount:    parseFloat(d.Amount),
+			Status:    strconv.Itoa(d.Status),
+			Completed: d.Status == 3,
+			Time:      time.UnixMilli(int64(parseFloat(d.SuccessAt))),
+		})
+	}
+	for _, w := range withdrawals.Rows {
+		transfers = append(transfers, Transfer{
+			ID:        w.WithdrawID,
+			Type:      Withdrawal,
+			Currency:  w.Coin,
+			Amount:    parseFloat(w.Amount),
+			Status:    w.Status,
+			Completed: w.Status == "success",
+			Time:      time.UnixMilli(int64(parseFloat(w.CreateTime))),
+		})
+	}
+	return transfers, nil
+}
+
+// ListContracts implements market.ContractLister with the trading
+// USDT-settled linear perpetuals and their current funding rates
+func (t *BybitTrader) ListContracts(ctx context.Context) ([]market.ContractInfo, error) {
+	var contracts []market.ContractInfo
+	query := url.Values{"category": {"linear"}, "limit": {"1000"}}
+	for {
+		var result struct {
+			List []struct {
+				Symbol          string `json:"symbol"`
+				Status          string `json:"status"`
+				ContractType    string `json:"contractType"`
+				SettleCoin      string `json:"settleCoin"`
+				FundingInterval int64  `json:"fundingInterval"`
+				LeverageFilter  struct {
+					MaxLeverage string `json:"maxLeverage"`
+				} `json:"leverageFilter"`
+				PriceFilter struct {
+					TickSize string `json:"tickSize"`
+				} `json:"priceFilter"`
+				LotSizeFilter struct {
+					QtyStep          string `json:"qtyStep"`
+					MinOrderQty      string `json:"minOrderQty"`
+					MinNotionalValue string `json:"minNotionalValue"`
+				} `json:"lotSizeFilter"`
+			} `json:"list"`
+			NextPageCursor string `json:"nextPageCursor"`
+		}
+		if err := t.request(ctx, "GET", "/v5/market/instruments-info", query, nil, &result); err != nil {
+			return nil, err
+		}
+		for _, i := range result.List {
+			if i.Status != "Trading" || i.SettleCoin != "USDT" || i.ContractType != "LinearPerpetual" {
+				continue
+			}
+			contracts = append(contracts, market.ContractInfo{
+				Pair:            BybitPair(i.Symbol),
+				TickSize:        parseFloat(i.PriceFilter.TickSize),
+				QuantityStep:    parseFloat(i.LotSizeFilter.QtyStep),
+				MinQuantity:     parseFloat(i.LotSizeFilter.MinOrderQty),
+				MinNotional:     parseFloat(i.LotSizeFilter.MinNotionalValue),
+				ContractSize:    1,
+				MaxLeverage:     int64(parseFloat(i.LeverageFilter.MaxLeverage)),
+				FundingInterval: i.FundingInterval * 60,
+			})
+		}
+		if result.NextPageCursor == "" || len(result.List) == 0 {
+			break
+		}
+		query.Set("cursor", result.NextPageCursor)
+	}
+
+	var tickers struct {
+		List []struct {
+			Symbol          string `json:"symbol"`
+			FundingRate     string `json:"fundingRate"`
+			NextFundingTime string `json:"nextFundingTime"`
+			MarkPrice       string `json:"markPrice"`
+		} `json:"list"`
+	}
+	if err := t.request(ctx, "GET", "/v5/market/tickers", url.Values{"category": {"linear"}}, nil, &tickers); err != nil {
+		logger.Warning("Failed to get Bybit funding rates, listing contracts without them: %v", err)
+		return contracts, nil
+	}
+	index := make(map[string]int, len(contracts))
+	for i, c := range contracts {
+		index[c.Pair] = i
+	}
+	for _, ticker := range tickers.List {
+		if i, ok := index[BybitPair(ticker.Symbol)]; ok {
+			contracts[i].FundingRate = parseFloat(ticker.FundingRate)
+			contracts[i].NextFundingTime = int64(parseFloat(ticker.NextFundingTime)) / 1000
+			contracts[i].MarkPrice = parseFloat(ticker.MarkPrice)
+		}
+	}
+	return contracts, nil
+}
+
+// CancelOrder implements the Trader interface
+func (t *BybitTrader) CancelOrder(ctx context.Context, orderID string) error {
+	pair, err := t.orderPair(orderID)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"category": "linear",
+		"symbol":   BybitSymbol(pair),
+		"orderId":  orderID,
+	}
+	return t.request(ctx, "POST", "/v5/order/cancel", nil, body, nil)
+}
+
+// GetOrder implements the Trader interface
+func (t *BybitTrader) GetOrder(ctx context.Context, orderID string) (*Order, error) {
+	pair, err := t.orderPair(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := t.orders(ctx, url.Values{"category": {"linear"}, "symbol": {BybitSymbol(pair)}, "orderId": {orderID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("Bybit order %s not found", orderID)
+	}
+	return &orders[0], nil
+}
+
+// GetOrders implements the Trader interface; only open orders, including
+// conditional orders, can be listed
+func (t *BybitTrader) GetOrders(ctx context.Context, pair string, status Status) ([]Order, error) {
+	query := url.Values{"category": {"linear"}, "settleCoin": {"USDT"}}
+	if pair != "" {
+		query = url.Values{"category": {"linear"}, "symbol": {BybitSymbol(pair)}}
+	}
+
+	orders, err := t.orders(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []Order
+	for _, o := range orders {
+		if status == "" || o.Status == status {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered, nil
+}
+
+// orders queries realtime orders matching the given filters
+func (t *BybitTrader) orders(ctx context.Context, query url.Values) ([]Order, error) {
+	var result struct {
+		List []bybitOrder `json:"list"`
+	}
+	if err := t.request(ctx, "GET", "/v5/order/realtime", query, nil, &result); err != nil {
+		return nil, err
+	}
+
+	orders := make([]Order, 0, len(result.List))
+	for _, o := range result.List {
+		order := o.toOrder()
+		t.mu.Lock()
+		t.orderPairs[order.ID] = order.Pair
+		t.mu.Unlock()
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// ClosePosition implements the Trader interface
+func (t *BybitTrader) ClosePosition(ctx context.Context, pair string, amount float64) (*Order, error) {
+	position, err := t.GetPosition(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	if position == nil {
+		return nil, noPosition(pair)
+	}
+
+	side := SellSide
+	if position.Side == SellSide {
+		side = BuySide
+	}
+	if amount <= 0 || amount > position.Size {
+		amount = position.Size
+	}
+
+	qty, err := roundQuantity(t.contracts, pair, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"category":   "linear",
+		"symbol":     BybitSymbol(pair),
+		"side":       bybitOrderSide(side),
+		"orderType":  "Market",
+		"qty":        strconv.FormatFloat(qty, 'f', -1, 64),
+		"reduceOnly": true,
+	}
+	return t.placeOrder(ctx, pair, side, MarketOrder, qty, 0, body)
+}
+
+// SetLeverage implements the Trader interface
+func (t *BybitTrader) SetLeverage(ctx context.Context, pair string, leverage int64) error {
+	lever := strconv.FormatInt(leverage, 10)
+	body := map[string]interface{}{
+		"category":     "linear",
+		"symbol":       BybitSymbol(pair),
+		"buyLeverage":  lever,
+		"sellLeverage": lever,
+	}
+	return t.request(ctx, "POST", "/v5/position/set-leverage", nil, body, nil)
+}
+
+// SetStopLoss implements the Trader interface
+func (t *BybitTrader) SetStopLoss(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	// A long is stopped out when price falls to the trigger, a short when it rises
+	direction := 2
+	if side == SellSide {
+		direction = 1
+	}
+	return t.placeConditional(ctx, pair, side, amount, triggerPrice, priceType, direction)
+}
+
+// SetTakeProfit implements the Trader interface
+func (t *BybitTrader) SetTakeProfit(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	direction := 1
+	if side == SellSide {
+		direction = 2
+	}
+	return t.placeConditional(ctx, pair, side, amount, triggerPrice, priceType, direction)
+}
+
+// placeConditional places a reduce-only conditional market order closing a
+// position of the given side; direction 1 triggers on rise, 2 on fall
+func (t *BybitTrader) placeConditional(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType, direction int) (*Order, error) {
+	closeSide := SellSide
+	if side == SellSide {
+		closeSide = BuySide
+	}
+
+	qty, err := roundQuantity(t.contracts, pair, amount)
+	if err != nil {
+		return nil, err
+	}
+	triggerPrice = roundPrice(t.contracts, pair, triggerPrice)
+
+	body := map[string]interface{}{
+		"category":         "linear",
+		"symbol":           BybitSymbol(pair),
+		"side":             bybitOrderSide(closeSide),
+		"orderType":        "Market",
+		"qty":              strconv.FormatFloat(qty, 'f', -1, 64),
+		"triggerPrice":     formatPrice(t.contracts, pair, triggerPrice),
+		"triggerDirection": direction,
+		"triggerBy":        bybitTriggerBy(priceType),
+		"reduceOnly":       true,
+	}
+
+	order, err := t.placeOrder(ctx, pair, closeSide, StopOrder, qty, triggerPrice, body)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Placed Bybit conditional order for %s %s %.4f @ %v (%s)", pair, side, qty, triggerPrice, priceType)
+	return order, nil
+}
+
+// toOrder converts a Bybit order to the local model
+func (o bybitOrder) toOrder() Order {
+	orderType := MarketOrder
+	price := parseFloat(o.Price)
+	if o.OrderType == "Limit" {
+		orderType = LimitOrder
+	}
+	if o.StopOrderType != "" || parseFloat(o.TriggerPrice) > 0 {
+		orderType = StopOrder
+		price = parseFloat(o.TriggerPrice)
+	}
+
+	status := OrderStatusNew
+	switch o.OrderStatus {
+	case "PartiallyFilled":
+		status = OrderStatusPartiallyFilled
+	case "Filled":
+		status = OrderStatusFilled
+	case "Cancelled", "PartiallyFilledCanceled", "Deactivated":
+		status = OrderStatusCanceled
+	case "Rejected":
+		status = OrderStatusRejected
+	}
+
+	return Order{
+		ID:            o.OrderID,
+		ClientOrderID: o.OrderLinkID,
+		Pair:          BybitPair(o.Symbol),
+		Type:          orderType,
+		Side:          bybitSide(o.Side),
+		Price:         price,
+		Amount:        parseFloat(o.Qty),
+		FilledAmount:  parseFloat(o.CumExecQty),
+		AvgPrice:      parseFloat(o.AvgPrice),
+		Status:        status,
+		TimeInForce:   o.TimeInForce,
+		CreatedTime:   int64(parseFloat(o.CreatedTime)),
+		UpdatedTime:   int64(parseFloat(o.UpdatedTime)),
+	}
+}
+
+// orderPair returns the pair of a known order
+func (t *BybitTrader) orderPair(orderID string) (string, error) {
+	t.mu.RLock()
+	pair, ok := t.orderPairs[orderID]
+	t.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown Bybit order %s", orderID)
+	}
+	return pair, nil
+}
+
+// bybitCategory returns the rate limit category of a Bybit endpoint
+func bybitCategory(method, path string) ratelimit.Category {
+	switch {
+	case strings.HasPrefix(path, "/v5/market/"):
+		return ratelimit.Public
+	case method == "POST" && strings.HasPrefix(path, "/v5/order/"):
+		return ratelimit.Trading
+	}
+	return ratelimit.Account
+}
+
+// request performs a signed Bybit v5 request and decodes the result field into out
+func (t *BybitTrader) request(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	return t.retries.Do(ctx, "Bybit "+method+" "+path, func(int) error {
+		if err := t.limiter.Wait(ctx, "bybit", bybitCategory(method, path), requestWeight(body)); err != nil {
+			return err
+		}
+		return t.send(ctx, method, path, query, payload, out)
+	})
+}
+
+// send performs a single signed request; the signature covers a fresh timestamp
+func (t *BybitTrader) send(ctx context.Context, method, path string, query url.Values, payload []byte, out interface{}) error {
+	endpoint := t.baseURL + path
+	signed := string(payload)
+	if method == "GET" {
+		signed = query.Encode()
+		if signed != "" {
+			endpoint += "?" + signed
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	req.Header.Set("X-BAPI-API-KEY", t.apiKey)
+	req.Header.Set("X-BAPI-TIMESTAMP", timestamp)
+	req.Header.Set("X-BAPI-RECV-WINDOW", bybitRecvWindow)
+	req.Header.Set("X-BAPI-SIGN", t.sign(timestamp+t.apiKey+bybitRecvWindow+signed))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope bybitResponse
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		status := &retry.StatusError{Status: resp.StatusCode, Message: string(data)}
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests:
+			return fmt.Errorf("Bybit %s %s: %w: %w", method, path, ErrRateLimited, status)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("Bybit %s %s: %w: %w", method, path, ErrUnauthorized, status)
+		}
+		return fmt.Errorf("Bybit %s %s: %w", method, path, status)
+	}
+	if envelope.RetCode != 0 {
+		err := classify(fmt.Errorf("Bybit %s %s: %s (code %d)", method, path, envelope.RetMsg, envelope.RetCode), bybitErrorKinds[envelope.RetCode])
+		switch {
+		case envelope.RetCode == bybitDuplicateOrderLinkID:
+			return fmt.Errorf("%w: %v", errDuplicateClientOrderID, err)
+		case bybitTransientCodes[envelope.RetCode]:
+			return retry.Transient(err)
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Result, out)
+}
+
+// sign computes the hex HMAC-SHA256 signature Bybit expects
+func (t *BybitTrader) sign(message string) string {
+	mac := hmac.New(sha256.New, []byte(t.secretKey))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// bybitSide converts a Bybit side (Buy/Sell) to the local model
+func bybitSide(side string) Side {
+	if side == "Sell" {
+		return SellSide
+	}
+	return BuySide
+}
+
+// bybitOrderSide converts a local side to Bybit's Buy/Sell
+func bybitOrderSide(side Side) string {
+	if side == SellSide {
+		return "Sell"
+	}
+	return "Buy"
+}
+
+// bybitTriggerBy converts a trigger price type to Bybit's triggerBy value
+func bybitTriggerBy(priceType TriggerPriceType) string {
+	switch priceType {
+	case MarkPriceTrigger:
+		return "MarkPrice"
+	case IndexPriceTrigger:
+		return "IndexPrice"
+	default:
+		return "LastPrice"
+	}
+}
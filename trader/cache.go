@@ -0,0 +1,206 @@
+package trader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+const (
+	// DefaultCacheTTL is how long cached account state is served before refetching
+	DefaultCacheTTL = 15 * time.Second
+	// DefaultCacheMaxStale is how long cached account state is still served,
+	// marked stale, while the exchange can't be reached
+	DefaultCacheMaxStale = 2 * time.Minute
+)
+
+// Cache keeps recently fetched account state so that callers don't each hit
+// the exchange for balances, positions and open orders. Once started, a
+// background refresher renews the account snapshot before it expires, so
+// readers don't wait on the exchange and get the last snapshot, marked
+// stale, while refreshes fail.
+type Cache struct {
+	trader   Trader
+	ttl      time.Duration
+	maxStale time.Duration
+	currency string
+
+	mu          sync.RWMutex
+	balances    []Balance
+	balancesAt  time.Time
+	positions   []Position
+	positionsAt time.Time
+	orders      map[string][]Order
+	ordersAt    map[string]time.Time
+	snapshot    *Snapshot
+	// refreshErr is the error of the last failed snapshot refresh, nil once one succeeds
+	refreshErr error
+	stop       chan struct{}
+}
+
+// NewCache creates a new account state cache in front of a trader; currency
+// is the settlement currency snapshots value the equity in
+func NewCache(t Trader, ttl time.Duration, currency string) *Cache {
+	return &Cache{
+		trader:   t,
+		ttl:      ttl,
+		maxStale: DefaultCacheMaxStale,
+		currency: currency,
+		orders:   make(map[string][]Order),
+		ordersAt: make(map[string]time.Time),
+	}
+}
+
+// GetBalance returns the cached balance, refreshing it when expired. While
+// the background refresher runs, or when the refresh fails, balances up to
+// the maximum staleness are served as they are.
+func (c *Cache) GetBalance(ctx context.Context) ([]Balance, error) {
+	c.mu.RLock()
+	balances, age, background := c.balances, time.Since(c.balancesAt), c.stop != nil
+	c.mu.RUnlock()
+	if age < c.ttl || (background && age < c.maxStale) {
+		return balances, nil
+	}
+
+	fresh, err := c.RefreshBalance(ctx)
+	if err != nil && age < c.maxStale {
+		return balances, nil
+	}
+	return fresh, err
+}
+
+// RefreshBalance fetches the balance from the exchange and caches it
+func (c *Cache) RefreshBalance(ctx context.Context) ([]Balance, error) {
+	balances, err := c.trader.GetBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.balances, c.balancesAt = balances, time.Now()
+	c.mu.Unlock()
+
+	return balances, nil
+}
+
+// GetPositions returns the cached positions, refreshing them when expired;
+// stale positions are served like balances
+func (c *Cache) GetPositions(ctx context.Context) ([]Position, error) {
+	c.mu.RLock()
+	positions, age, background := c.positions, time.Since(c.positionsAt), c.stop != nil
+	c.mu.RUnlock()
+	if age < c.ttl || (background && age < c.maxStale) {
+		return positions, nil
+	}
+
+	fresh, err := c.RefreshPositions(ctx)
+	if err != nil && age < c.maxStale {
+		return positions, nil
+	}
+	return fresh, err
+}
+
+// RefreshPositions fetches all positions from the exchange and caches them
+func (c *Cache) RefreshPositions(ctx context.Context) ([]Position, error) {
+	positions, err := c.trader.GetPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.positions, c.positionsAt = positions, time.Now()
+	c.mu.Unlock()
+
+	return positions, nil
+}
+
+// GetOpenOrders returns the cached open orders for a pair, refreshing them when expired
+func (c *Cache) GetOpenOrders(ctx context.Context, pair string) ([]Order, error) {
+	c.mu.RLock()
+	if time.Since(c.ordersAt[pair]) < c.ttl {
+		defer c.mu.RUnlock()
+		return c.orders[pair], nil
+	}
+	c.mu.RUnlock()
+
+	return c.RefreshOpenOrders(ctx, pair)
+}
+
+// RefreshOpenOrders fetches the open orders for a pair from the exchange and caches them
+func (c *Cache) RefreshOpenOrders(ctx context.Context, pair string) ([]Order, error) {
+	orders, err := c.trader.GetOrders(ctx, pair, OrderStatusNew)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.orders[pair], c.ordersAt[pair] = orders, time.Now()
+	c.mu.Unlock()
+
+	return orders, nil
+}
+
+// Invalidate drops all cached state so the next read hits the exchange
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.balancesAt = time.Time{}
+	c.positionsAt = time.Time{}
+	c.snapshot = nil
+	c.ordersAt = make(map[string]time.Time)
+}
+
+// Start runs the background refresher, renewing the account snapshot once
+// two thirds of its TTL have passed
+func (c *Cache) Start() {
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.stop = make(chan struct{})
+	stop := c.stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(c.ttl / 5)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.mu.RLock()
+				due := c.snapshot == nil || time.Since(c.snapshot.Time) >= c.ttl*2/3
+				failing := c.refreshErr != nil
+				c.mu.RUnlock()
+				if !due {
+					continue
+				}
+				// Failures are logged once, not on every tick until recovery
+				refresh, cancel := context.WithTimeout(context.Background(), c.ttl)
+				_, err := c.RefreshSnapshot(refresh)
+				cancel()
+				switch {
+				case err != nil && !failing:
+					logger.Warning("Background account refresh failed, serving cached state: %v", err)
+				case err == nil && failing:
+					logger.Info("Background account refresh recovered")
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the background refresher
+func (c *Cache) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
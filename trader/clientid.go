@@ -0,0 +1,100 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// ErrOrderNotFound is returned when no order matches a client order ID
+var ErrOrderNotFound = errors.New("order not found")
+
+// ClientOrder represents a client order ID recorded before its order was
+// sent, with what placed it
+type ClientOrder struct {
+	ID       string `json:"client_order_id"`
+	Exchange string `json:"exchange"`
+	Pair     string `json:"currency_pair"`
+	Strategy string `json:"strategy,omitempty"`
+	// Intent names the internal intent the order serves, e.g. "intent:<id>"
+	Intent    string    `json:"intent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// clientOrderKey is the context key of the client order tagging
+type clientOrderKey struct{}
+
+// clientOrderTag represents how the orders placed with a context are tagged
+type clientOrderTag struct {
+	prefix   string
+	order    ClientOrder
+	registry *OrderRegistry
+}
+
+// WithClientOrder returns a context tagging the orders placed with it: their
+// client order IDs carry the prefix of o.Strategy, and each ID is recorded
+// with o in registry, when set, before its order is sent, so orders found on
+// the exchange after a crash can be matched to what placed them
+func WithClientOrder(ctx context.Context, tag *OrderTag, registry *OrderRegistry, o ClientOrder) context.Context {
+	var prefix string
+	if tag != nil {
+		prefix = tag.ForStrategy(o.Strategy)
+	}
+	return context.WithValue(ctx, clientOrderKey{}, clientOrderTag{prefix: prefix, order: o, registry: registry})
+}
+
+// ClientOrderFrom returns what placed the orders of ctx, as given to
+// WithClientOrder
+func ClientOrderFrom(ctx context.Context) (ClientOrder, bool) {
+	tag, ok := ctx.Value(clientOrderKey{}).(clientOrderTag)
+	return tag.order, ok
+}
+
+// clientOrderPrefix returns the client order ID prefix of the orders placed
+// with ctx, or fallback when it has none
+func clientOrderPrefix(ctx context.Context, fallback string) string {
+	if tag, ok := ctx.Value(clientOrderKey{}).(clientOrderTag); ok && tag.prefix != "" {
+		return tag.prefix
+	}
+	return fallback
+}
+
+// trackClientOrder records a client order ID about to be sent; recording
+// failures are logged and never block the order
+func trackClientOrder(ctx context.Context, pair, id string) {
+	tag, ok := ctx.Value(clientOrderKey{}).(clientOrderTag)
+	if !ok || tag.registry == nil {
+		return
+	}
+	o := tag.order
+	o.ID, o.Pair, o.CreatedAt = id, pair, time.Now()
+	if err := tag.registry.Track(o); err != nil {
+		logger.Warning("Failed to record client order ID %s: %v", id, err)
+	}
+}
+
+// ClientOrderLookup is implemented by traders able to query an order by its
+// client order ID, including orders no longer open
+type ClientOrderLookup interface {
+	GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*Order, error)
+}
+
+// GetOrderByClientID returns an order by its client order ID through t,
+// searching the open orders of pair when t can't query by client order ID
+func GetOrderByClientID(ctx context.Context, t Trader, pair, clientOrderID string) (*Order, error) {
+	if l, ok := t.(ClientOrderLookup); ok {
+		return l.GetOrderByClientID(ctx, pair, clientOrderID)
+	}
+	orders, err := t.GetOrders(ctx, pair, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		if orders[i].ClientOrderID == clientOrderID {
+			return &orders[i], nil
+		}
+	}
+	return nil, ErrOrderNotFound
+}
@@ -0,0 +1,51 @@
+package trader
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Trading errors callers branch on, whichever exchange reported them; the
+// exchange clients wrap them around the exchange's own message and code
+var (
+	// ErrInsufficientBalance is returned when the account lacks the balance
+	// or margin an order needs
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrMinNotional is returned when an order's quantity or notional is
+	// below the contract minimum
+	ErrMinNotional = errors.New("order below the contract minimum")
+	// ErrLeverageAlreadySet is returned by SetLeverage when the pair already
+	// trades at the requested leverage
+	ErrLeverageAlreadySet = errors.New("leverage already set")
+	// ErrNoPosition is returned when closing, reducing or protecting a
+	// position that isn't open
+	ErrNoPosition = errors.New("no open position")
+	// ErrRateLimited is returned when the exchange rejects a request for
+	// exceeding its rate limits
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUnauthorized is returned when the exchange rejects the API key, its
+	// signature or its permissions
+	ErrUnauthorized = errors.New("exchange rejected the API credentials")
+	// ErrOrderTypeNotSupported is returned by CreateOrder for order types
+	// it can't place, such as stop orders, which carry no trigger price;
+	// protective stops go through SetStopLoss and SetTakeProfit
+	ErrOrderTypeNotSupported = errors.New("order type not supported")
+)
+
+// noPosition returns the error of a missing position on pair
+func noPosition(pair string) error {
+	return fmt.Errorf("%w for %s", ErrNoPosition, pair)
+}
+
+// unsupportedType returns the error of an order type CreateOrder can't place
+func unsupportedType(orderType OrderType) error {
+	return fmt.Errorf("%w: %s", ErrOrderTypeNotSupported, orderType)
+}
+
+// classify wraps an exchange error in the sentinel of its kind, if any
+func classify(err error, kind error) error {
+	if kind == nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
@@ -1,88 +1,702 @@
 package trader
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"github.com/nofx/crypto"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/ratelimit"
+	"github.com/nofx/retry"
 )
 
+// GateTrader must satisfy the typed Trader interface
+var _ Trader = (*GateTrader)(nil)
+
 // GateTrader implements the Trader interface for Gate.io exchange
 type GateTrader struct {
 	apiKey    string
 	secretKey string
 	baseURL   string
 	encrypted bool
+	prefix    string
+	contracts ContractSource
+	limiter   *ratelimit.Limiter
+	retries   retry.Policy
+	client    *http.Client
+
+	// mode caches the detected position mode
+	mu   sync.Mutex
+	mode PositionMode
+
+	// settles holds the settle currency of each pair traded or configured
+	settleMu sync.Mutex
+	settles  map[string]string
 }
 
 // NewGateTrader creates a new Gate.io trader
 func NewGateTrader(apiKey, secretKey, baseURL string, encrypted bool) *GateTrader {
+	if baseURL == "" {
+		baseURL = "https://api.gateio.ws/api/v4"
+	}
 	return &GateTrader{
 		apiKey:    apiKey,
 		secretKey: secretKey,
-		baseURL:   baseURL,
+		baseURL:   strings.TrimRight(baseURL, "/"),
 		encrypted: encrypted,
+		retries:   retry.DefaultPolicy,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		settles:   make(map[string]string),
 	}
 }
 
-// GetBalance implements the Trader interface
-func (t *GateTrader) GetBalance() ([]Balance, error) {
-	logger.Info("Getting balance from Gate.io")
-	// Implementation will be added
-	return nil, nil
+// gateDefaultSettle is the settle currency of the USDT-margined contracts
+const gateDefaultSettle = "usdt"
+
+// SetSettleCurrencies sets the settle currency of pairs, e.g. "btc" for the
+// BTC-settled inverse BTC_USD contract
+func (t *GateTrader) SetSettleCurrencies(settles map[string]string) {
+	t.settleMu.Lock()
+	defer t.settleMu.Unlock()
+	for pair, settle := range settles {
+		t.settles[pair] = strings.ToLower(settle)
+	}
 }
 
-// GetPosition implements the Trader interface
-func (t *GateTrader) GetPosition(pair string) (*Position, error) {
-	logger.Info("Getting position for %s from Gate.io", pair)
-	// Implementation will be added
-	return nil, nil
+// settle returns the settle currency of pair, selecting the futures API
+// (/futures/{settle}/...) its orders and positions go through: the
+// configured one, else the contract's, else the base currency of pairs
+// quoted in USD, which Gate.io lists as inverse contracts, else usdt
+func (t *GateTrader) settle(pair string) string {
+	t.settleMu.Lock()
+	settle, ok := t.settles[pair]
+	t.settleMu.Unlock()
+	if ok {
+		return settle
+	}
+
+	settle = gateListedSettle(pair)
+	if t.contracts != nil {
+		if contract, err := t.contracts.Get(pair); err == nil && contract.Settle != "" {
+			settle = strings.ToLower(contract.Settle)
+		}
+	}
+	t.settleMu.Lock()
+	t.settles[pair] = settle
+	t.settleMu.Unlock()
+	return settle
 }
 
-// GetPositions implements the Trader interface
-func (t *GateTrader) GetPositions() ([]Position, error) {
-	logger.Info("Getting all positions from Gate.io")
-	// Implementation will be added
+// gateListedSettle returns the settle currency Gate.io lists a pair in: the
+// base currency of pairs quoted in USD, which are inverse, else usdt
+func gateListedSettle(pair string) string {
+	if base, quote, found := strings.Cut(pair, "_"); found && quote == "USD" {
+		return strings.ToLower(base)
+	}
+	return gateDefaultSettle
+}
+
+// gateContracts lists the contracts of a market data listing with the
+// settle currency Gate.io trades them in
+type gateContracts struct {
+	trader  *GateTrader
+	listing market.ContractLister
+}
+
+// ListContracts implements market.ContractLister
+func (c gateContracts) ListContracts(ctx context.Context) ([]market.ContractInfo, error) {
+	contracts, err := c.listing.ListContracts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range contracts {
+		contract := &contracts[i]
+		// The configured settle currency wins over the listing's
+		c.trader.settleMu.Lock()
+		settle, ok := c.trader.settles[contract.Pair]
+		c.trader.settleMu.Unlock()
+		if !ok {
+			settle = strings.ToLower(contract.Settle)
+		}
+		if settle == "" {
+			settle = gateListedSettle(contract.Pair)
+		}
+		contract.Settle = settle
+		if base, _, found := strings.Cut(contract.Pair, "_"); found && strings.EqualFold(settle, base) {
+			contract.Inverse = true
+		}
+	}
+	return contracts, nil
+}
+
+// Contracts returns the contracts of a market data listing as Gate.io trades
+// them: with their settle currency, and marked inverse when settled in their
+// base currency
+func (t *GateTrader) Contracts(listing market.ContractLister) market.ContractLister {
+	return gateContracts{trader: t, listing: listing}
+}
+
+// settleCurrencies returns the settle currencies in use, sorted: usdt and
+// those of the pairs traded or configured
+func (t *GateTrader) settleCurrencies() []string {
+	t.settleMu.Lock()
+	defer t.settleMu.Unlock()
+	seen := map[string]bool{gateDefaultSettle: true}
+	settles := []string{gateDefaultSettle}
+	for _, settle := range t.settles {
+		if !seen[settle] {
+			seen[settle] = true
+			settles = append(settles, settle)
+		}
+	}
+	sort.Strings(settles)
+	return settles
+}
+
+// SetContracts sets the contract metadata source used to round outgoing prices
+func (t *GateTrader) SetContracts(contracts ContractSource) {
+	t.contracts = contracts
+}
+
+// SetRateLimiter sets the limiter throttling the REST calls
+func (t *GateTrader) SetRateLimiter(limiter *ratelimit.Limiter) {
+	t.limiter = limiter
+}
+
+// SetRetryPolicy sets how failed REST calls are retried
+func (t *GateTrader) SetRetryPolicy(policy retry.Policy) {
+	t.retries = policy
+}
+
+// SetClientOrderPrefix sets the prefix of the order text tagging every order
+// placed by this instance; Gate.io requires texts to start with "t-"
+func (t *GateTrader) SetClientOrderPrefix(prefix string) {
+	if !strings.HasPrefix(prefix, "t-") {
+		prefix = "t-" + prefix
+	}
+	t.prefix = prefix
+}
+
+// clientOrderText generates and tracks the text of an order on pair, which
+// Gate.io requires to start with "t-" and limits to 30 characters
+func (t *GateTrader) clientOrderText(ctx context.Context, pair string) string {
+	text := NewClientOrderID(gateTag(clientOrderPrefix(ctx, t.prefix)))
+	trackClientOrder(ctx, pair, text)
+	return text
+}
+
+// gateAccount is a futures account of a settle currency; its total
+// excludes unrealized PnL
+type gateAccount struct {
+	Currency      string `json:"currency"`
+	Total         string `json:"total"`
+	UnrealisedPnl string `json:"unrealised_pnl"`
+	Available     string `json:"available"`
+	OrderMargin   string `json:"order_margin"`
+	InDualMode    bool   `json:"in_dual_mode"`
+}
+
+// GetBalance implements the Trader interface with the futures account of
+// every settle currency in use, each reported in its own currency
+func (t *GateTrader) GetBalance(ctx context.Context) ([]Balance, error) {
+	var balances []Balance
+	for _, settle := range t.settleCurrencies() {
+		var account gateAccount
+		if err := t.request(ctx, "GET", "/futures/"+settle+"/accounts", nil, nil, &account); err != nil {
+			return nil, err
+		}
+		currency := strings.ToUpper(account.Currency)
+		if currency == "" {
+			currency = strings.ToUpper(settle)
+		}
+		upl := parseFloat(account.UnrealisedPnl)
+		balances = append(balances, Balance{
+			Currency:      currency,
+			Total:         parseFloat(account.Total) + upl,
+			Available:     parseFloat(account.Available),
+			InOrders:      parseFloat(account.OrderMargin),
+			UnrealizedPnl: upl,
+		})
+	}
+	return balances, nil
+}
+
+// gatePosition is a futures position; size is in contracts, negative for
+// shorts, and mode tells single mode positions from dual mode ones
+type gatePosition struct {
+	Contract      string  `json:"contract"`
+	Size          float64 `json:"size"`
+	Leverage      string  `json:"leverage"`
+	EntryPrice    string  `json:"entry_price"`
+	MarkPrice     string  `json:"mark_price"`
+	LiqPrice      string  `json:"liq_price"`
+	UnrealisedPnl string  `json:"unrealised_pnl"`
+	RealisedPnl   string  `json:"realised_pnl"`
+	PnlFund       string  `json:"pnl_fund"`
+	Mode          string  `json:"mode"`
+	UpdateTime    int64   `json:"update_time"`
+}
+
+// position converts a Gate.io position to the local model
+func (p gatePosition) position() Position {
+	side := BuySide
+	if p.Size < 0 || p.Mode == "dual_short" {
+		side = SellSide
+	}
+	leverage, _ := strconv.ParseInt(p.Leverage, 10, 64)
+	return Position{
+		Pair:             p.Contract,
+		Side:             side,
+		Size:             math.Abs(p.Size),
+		EntryPrice:       parseFloat(p.EntryPrice),
+		MarkPrice:        parseFloat(p.MarkPrice),
+		UnrealizedPnl:    parseFloat(p.UnrealisedPnl),
+		RealizedPnl:      parseFloat(p.RealisedPnl),
+		Funding:          parseFloat(p.PnlFund),
+		Leverage:         leverage,
+		LiquidationPrice: parseFloat(p.LiqPrice),
+		Status:           "open",
+		UpdatedTime:      p.UpdateTime * 1000,
+	}
+}
+
+// GetPosition implements the Trader interface with the open position on
+// pair, nil when there is none
+func (t *GateTrader) GetPosition(ctx context.Context, pair string) (*Position, error) {
+	positions, err := t.positions(ctx, t.settle(pair))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range positions {
+		if p.Pair == pair {
+			return &p, nil
+		}
+	}
 	return nil, nil
 }
 
+// GetPositions implements the Trader interface with the positions of every
+// settle currency in use
+func (t *GateTrader) GetPositions(ctx context.Context) ([]Position, error) {
+	var positions []Position
+	for _, settle := range t.settleCurrencies() {
+		settled, err := t.positions(ctx, settle)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, settled...)
+	}
+	return positions, nil
+}
+
+// positions returns the open positions of a settle currency
+func (t *GateTrader) positions(ctx context.Context, settle string) ([]Position, error) {
+	var data []gatePosition
+	query := url.Values{"holding": {"true"}}
+	if err := t.request(ctx, "GET", "/futures/"+settle+"/positions", query, nil, &data); err != nil {
+		return nil, err
+	}
+	var positions []Position
+	for _, p := range data {
+		if p.Size != 0 {
+			positions = append(positions, p.position())
+		}
+	}
+	return positions, nil
+}
+
+// gateAccountBookEntry is a change of a futures account's balance
+type gateAccountBookEntry struct {
+	ID     string  `json:"id"`
+	Time   float64 `json:"time"`
+	Change string  `json:"change"`
+	Text   string  `json:"text"`
+}
+
+// gateAccountBookLimit is the most entries a futures account book page holds
+const gateAccountBookLimit = 1000
+
+// GetTransfers implements TransferReader with the funds moved in and out of
+// the futures account of every settle currency in use since a time, its
+// "dnw" account book entries: these, rather than the wallet's deposits and
+// withdrawals, are what change the futures balances. Gate books them once
+// they're done, so every transfer is completed.
+func (t *GateTrader) GetTransfers(ctx context.Context, since time.Time) ([]Transfer, error) {
+	logger.Info("Getting deposits and withdrawals since %s from Gate.io", since.Format(time.RFC3339))
+	var transfers []Transfer
+	for _, settle := range t.settleCurrencies() {
+		currency := strings.ToUpper(settle)
+		for offset := 0; ; offset += gateAccountBookLimit {
+			query := url.Values{
+				"type":   {"dnw"},
+				"from":   {strconv.FormatInt(since.Unix(), 10)},
+				"limit":  {strconv.Itoa(gateAccountBookLimit)},
+				"offset": {strconv.Itoa(offset)},
+			}
+			var book []gateAccountBookEntry
+			if err := t.request(ctx, "GET", "/futures/"+settle+"/account_book", query, nil, &book); err != nil {
+				return nil, err
+			}
+			for _, e := range book {
+				change := parseFloat(e.Change)
+				kind := Deposit
+				if change < 0 {
+					kind = Withdrawal
+				}
+				transfers = append(transfers, Transfer{
+					ID:        e.ID,
+					Type:      kind,
+					Currency:  currency,
+					Amount:    math.Abs(change),
+					Status:    e.Text,
+					Completed: true,
+					Time:      time.Unix(0, int64(e.Time*float64(time.Second))),
+				})
+			}
+			if len(book) < gateAccountBookLimit {
+				break
+			}
+		}
+	}
+	return transfers, nil
+}
+
+// PositionMode implements PositionModeReader; the mode is read once from the
+// in_dual_mode flag of the futures account and cached
+func (t *GateTrader) PositionMode(ctx context.Context) (PositionMode, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mode != "" {
+		return t.mode, nil
+	}
+
+	logger.Info("Getting position mode from Gate.io")
+	var account gateAccount
+	if err := t.request(ctx, "GET", "/futures/"+gateDefaultSettle+"/accounts", nil, nil, &account); err != nil {
+		return "", err
+	}
+	t.mode = SingleMode
+	if account.InDualMode {
+		t.mode = DualMode
+	}
+	logger.Info("Gate.io account is in %s position mode", t.mode)
+	return t.mode, nil
+}
+
 // CreateOrder implements the Trader interface
-func (t *GateTrader) CreateOrder(pair string, side Side, orderType OrderType, amount, price float64, leverage int64) (*Order, error) {
-	logger.Info("Creating order on Gate.io: %s %s %s %.2f @ %.2f", pair, side, orderType, amount, price)
-	// Implementation will be added
-	return nil, nil
+func (t *GateTrader) CreateOrder(ctx context.Context, req OrderRequest) (*Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	mode, err := t.PositionMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	price := roundPrice(t.contracts, req.Pair, req.Price)
+	text := t.clientOrderText(ctx, req.Pair)
+	logger.Info("Creating order on Gate.io: %s %s %s %.2f @ %.2f (tif %s, reduce-only %t, %s, %s-settled, text %s)",
+		req.Pair, req.Side, req.Type, req.Amount, price, gateTimeInForce(req), req.ReduceOnly, gateRoute(mode, req), t.settle(req.Pair), text)
+	// Every attempt resends the same text, so a retry can't fill twice
+	err = t.retries.Do(ctx, "Gate.io order "+text, func(int) error {
+		// Implementation will be added
+		return t.limiter.Wait(ctx, "gate", ratelimit.Trading, 1)
+	})
+	return nil, err
+}
+
+// gateRoute describes how an order reaches its position. In dual mode orders
+// go to the dual_comp endpoints: an opening order adds to the position of its
+// own side, while a reduce-only order closes the opposite position through
+// auto_size with a zero size, since the sign of the size alone can't tell
+// a long close from a short open.
+func gateRoute(mode PositionMode, req OrderRequest) string {
+	if mode != DualMode {
+		return "single position"
+	}
+	if req.ReduceOnly {
+		return "auto_size " + gateAutoSize(OppositeSide(req.Side))
+	}
+	return "dual " + gatePositionSide(req.Side) + " position"
+}
+
+// gatePositionSide names the dual mode position of a side
+func gatePositionSide(side Side) string {
+	if side == SellSide {
+		return "short"
+	}
+	return "long"
+}
+
+// gateAutoSize returns the auto_size closing the dual mode position of a side
+func gateAutoSize(positionSide Side) string {
+	return "close_" + gatePositionSide(positionSide)
+}
+
+// gateTimeInForce returns the Gate.io tif expressing the execution flags of
+// an order; market orders are sent with price 0 and ioc
+func gateTimeInForce(req OrderRequest) string {
+	switch {
+	case req.Type != LimitOrder:
+		return "ioc"
+	case req.PostOnly:
+		return "poc"
+	case req.TimeInForce == ImmediateOrCancel:
+		return "ioc"
+	case req.TimeInForce == FillOrKill:
+		return "fok"
+	default:
+		return "gtc"
+	}
 }
 
 // CancelOrder implements the Trader interface
-func (t *GateTrader) CancelOrder(orderID string) error {
+func (t *GateTrader) CancelOrder(ctx context.Context, orderID string) error {
 	logger.Info("Canceling order on Gate.io: %s", orderID)
+	if err := t.limiter.Wait(ctx, "gate", ratelimit.Trading, 1); err != nil {
+		return err
+	}
 	// Implementation will be added
 	return nil
 }
 
 // GetOrder implements the Trader interface
-func (t *GateTrader) GetOrder(orderID string) (*Order, error) {
+func (t *GateTrader) GetOrder(ctx context.Context, orderID string) (*Order, error) {
 	logger.Info("Getting order from Gate.io: %s", orderID)
+	if err := t.limiter.Wait(ctx, "gate", ratelimit.Account, 1); err != nil {
+		return nil, err
+	}
 	// Implementation will be added
 	return nil, nil
 }
 
+// GetOrderByClientID implements ClientOrderLookup; Gate.io accepts an
+// order's text in place of its ID
+func (t *GateTrader) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*Order, error) {
+	return t.GetOrder(ctx, clientOrderID)
+}
+
 // GetOrders implements the Trader interface
-func (t *GateTrader) GetOrders(pair string, status Status) ([]Order, error) {
+func (t *GateTrader) GetOrders(ctx context.Context, pair string, status Status) ([]Order, error) {
 	logger.Info("Getting orders from Gate.io for %s with status %s", pair, status)
+	if err := t.limiter.Wait(ctx, "gate", ratelimit.Account, 1); err != nil {
+		return nil, err
+	}
 	// Implementation will be added
 	return nil, nil
 }
 
 // ClosePosition implements the Trader interface
-func (t *GateTrader) ClosePosition(pair string, amount float64) (*Order, error) {
-	logger.Info("Closing position on Gate.io for %s with amount %.2f", pair, amount)
+func (t *GateTrader) ClosePosition(ctx context.Context, pair string, amount float64) (*Order, error) {
+	mode, err := t.PositionMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	route := "single position"
+	if mode == DualMode {
+		side, err := t.dualPositionSide(ctx, pair)
+		if err != nil {
+			return nil, err
+		}
+		route = "auto_size " + gateAutoSize(side)
+	}
+	logger.Info("Closing position on Gate.io for %s with amount %.2f (%s, %s-settled)", pair, amount, route, t.settle(pair))
+	if err := t.limiter.Wait(ctx, "gate", ratelimit.Trading, 1); err != nil {
+		return nil, err
+	}
 	// Implementation will be added
 	return nil, nil
 }
 
+// dualPositionSide returns the side of the one open dual mode position on
+// pair; with both sides open a close can't tell which one is meant
+func (t *GateTrader) dualPositionSide(ctx context.Context, pair string) (Side, error) {
+	positions, err := t.GetPositions(ctx)
+	if err != nil {
+		return "", err
+	}
+	var sides []Side
+	for _, p := range positions {
+		if p.Pair == pair && p.Size != 0 {
+			sides = append(sides, p.Side)
+		}
+	}
+	switch len(sides) {
+	case 0:
+		return "", noPosition(pair)
+	case 1:
+		return sides[0], nil
+	default:
+		return "", fmt.Errorf("%s has both a long and a short position open; close one with a reduce-only order", pair)
+	}
+}
+
 // SetLeverage implements the Trader interface
-func (t *GateTrader) SetLeverage(pair string, leverage int64) error {
-	logger.Info("Setting leverage on Gate.io for %s to %d", pair, leverage)
+func (t *GateTrader) SetLeverage(ctx context.Context, pair string, leverage int64) error {
+	logger.Info("Setting leverage on Gate.io for %s to %d (%s-settled)", pair, leverage, t.settle(pair))
+	if err := t.limiter.Wait(ctx, "gate", ratelimit.Account, 1); err != nil {
+		return err
+	}
 	// Implementation will be added
 	return nil
-}
\ No newline at end of file
+}
+
+// SetStopLoss implements the Trader interface
+func (t *GateTrader) SetStopLoss(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	mode, err := t.PositionMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	triggerPrice = roundPrice(t.contracts, pair, triggerPrice)
+	logger.Info("Setting stop loss on Gate.io for %s %s %.2f @ %v (price type %d, %s)",
+		pair, side, amount, triggerPrice, gatePriceType(priceType), gateProtectionRoute(mode, side))
+	if err := t.limiter.Wait(ctx, "gate", ratelimit.Trading, 1); err != nil {
+		return nil, err
+	}
+	// Implementation will be added
+	return nil, nil
+}
+
+// SetTakeProfit implements the Trader interface
+func (t *GateTrader) SetTakeProfit(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	mode, err := t.PositionMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	triggerPrice = roundPrice(t.contracts, pair, triggerPrice)
+	logger.Info("Setting take profit on Gate.io for %s %s %.2f @ %v (price type %d, %s)",
+		pair, side, amount, triggerPrice, gatePriceType(priceType), gateProtectionRoute(mode, side))
+	if err := t.limiter.Wait(ctx, "gate", ratelimit.Trading, 1); err != nil {
+		return nil, err
+	}
+	// Implementation will be added
+	return nil, nil
+}
+
+// gateProtectionRoute describes how a stop loss or take profit of a position
+// of side closes it: in dual mode its price order closes that side's
+// position through auto_size
+func gateProtectionRoute(mode PositionMode, side Side) string {
+	if mode != DualMode {
+		return "single position"
+	}
+	return "auto_size " + gateAutoSize(side)
+}
+
+// gatePriceType maps a trigger price type to Gate.io's price_type field
+func gatePriceType(priceType TriggerPriceType) int {
+	switch priceType {
+	case MarkPriceTrigger:
+		return 1
+	case IndexPriceTrigger:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// gateErrorKinds maps Gate.io error labels to the trading errors they represent
+var gateErrorKinds = map[string]error{
+	"INVALID_KEY":             ErrUnauthorized,
+	"INVALID_SIGNATURE":       ErrUnauthorized,
+	"MISSING_REQUIRED_HEADER": ErrUnauthorized,
+	"FORBIDDEN":               ErrUnauthorized,
+	"TOO_MANY_REQUESTS":       ErrRateLimited,
+	"INSUFFICIENT_AVAILABLE":  ErrInsufficientBalance,
+	"POSITION_NOT_FOUND":      ErrNoPosition,
+}
+
+// gateCategory returns the rate limit category of a Gate.io REST call
+func gateCategory(method string) ratelimit.Category {
+	if method == "GET" {
+		return ratelimit.Account
+	}
+	return ratelimit.Trading
+}
+
+// request performs a signed Gate.io REST request and decodes the response
+// into out, retrying transient failures
+func (t *GateTrader) request(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	return t.retries.Do(ctx, "Gate.io "+method+" "+path, func(int) error {
+		if err := t.limiter.Wait(ctx, "gate", gateCategory(method), requestWeight(body)); err != nil {
+			return err
+		}
+		return t.send(ctx, method, path, query, payload, out)
+	})
+}
+
+// send performs a single signed request; the signature covers a fresh timestamp
+func (t *GateTrader) send(ctx context.Context, method, path string, query url.Values, payload []byte, out interface{}) error {
+	endpoint, err := url.Parse(t.baseURL + path)
+	if err != nil {
+		return err
+	}
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	hashed := sha512.Sum512(payload)
+	req.Header.Set("KEY", t.apiKey)
+	req.Header.Set("Timestamp", timestamp)
+	req.Header.Set("SIGN", t.sign(method+"\n"+endpoint.Path+"\n"+endpoint.RawQuery+"\n"+hex.EncodeToString(hashed[:])+"\n"+timestamp))
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var failure struct {
+			Label   string `json:"label"`
+			Message string `json:"message"`
+		}
+		status := &retry.StatusError{Status: resp.StatusCode, Message: string(data)}
+		if json.Unmarshal(data, &failure) != nil || failure.Label == "" {
+			return fmt.Errorf("Gate.io %s %s: %w", method, path, status)
+		}
+		err := fmt.Errorf("Gate.io %s %s: %s (%s): %w", method, path, failure.Message, failure.Label, status)
+		return classify(err, gateErrorKinds[failure.Label])
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// sign computes the hex HMAC-SHA512 signature Gate.io expects
+func (t *GateTrader) sign(message string) string {
+	mac := hmac.New(sha512.New, []byte(t.secretKey))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
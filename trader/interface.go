@@ -1,5 +1,10 @@
 package trader
 
+import (
+	"context"
+	"errors"
+)
+
 // OrderType represents the type of order
 type OrderType string
 
@@ -42,6 +47,69 @@ const (
 	OrderStatusExpired Status = "expired"
 )
 
+// TriggerPriceType represents the price a conditional order triggers on
+type TriggerPriceType string
+
+const (
+	// LastPriceTrigger triggers on the last traded price
+	LastPriceTrigger TriggerPriceType = "last"
+	// MarkPriceTrigger triggers on the mark price, which ignores scam wicks
+	MarkPriceTrigger TriggerPriceType = "mark"
+	// IndexPriceTrigger triggers on the index price
+	IndexPriceTrigger TriggerPriceType = "index"
+)
+
+// Valid reports whether the trigger price type is supported
+func (p TriggerPriceType) Valid() bool {
+	return p == LastPriceTrigger || p == MarkPriceTrigger || p == IndexPriceTrigger
+}
+
+// TimeInForce represents how long a limit order rests on the book
+type TimeInForce string
+
+const (
+	// GoodTillCancel rests until filled or canceled
+	GoodTillCancel TimeInForce = "gtc"
+	// ImmediateOrCancel fills what it can at once and cancels the rest
+	ImmediateOrCancel TimeInForce = "ioc"
+	// FillOrKill fills entirely at once or not at all
+	FillOrKill TimeInForce = "fok"
+)
+
+// OrderRequest represents an order to create
+type OrderRequest struct {
+	Pair   string    `json:"currency_pair"`
+	Side   Side      `json:"side"`
+	Type   OrderType `json:"type"`
+	Amount float64   `json:"amount"`
+	// Price is the limit price, ignored by market orders
+	Price float64 `json:"price"`
+	// Leverage is set on the pair before the order when positive
+	Leverage int64 `json:"leverage"`
+	// ReduceOnly orders can only shrink the open position
+	ReduceOnly bool `json:"reduce_only"`
+	// PostOnly limit orders are canceled instead of taking liquidity
+	PostOnly bool `json:"post_only"`
+	// TimeInForce applies to limit orders; empty means good till cancel
+	TimeInForce TimeInForce `json:"time_in_force"`
+}
+
+// Validate checks that the execution flags of the request are consistent
+func (r OrderRequest) Validate() error {
+	switch r.TimeInForce {
+	case "", GoodTillCancel, ImmediateOrCancel, FillOrKill:
+	default:
+		return errors.New("time_in_force must be gtc, ioc or fok")
+	}
+	if r.Type != LimitOrder && (r.PostOnly || r.TimeInForce != "") {
+		return errors.New("post_only and time_in_force need a limit order")
+	}
+	if r.PostOnly && r.TimeInForce != "" && r.TimeInForce != GoodTillCancel {
+		return errors.New("post_only orders rest on the book and can't be " + string(r.TimeInForce))
+	}
+	return nil
+}
+
 // Order represents a trading order
 type Order struct {
 	ID            string    `json:"id"`
@@ -52,6 +120,8 @@ type Order struct {
 	Price         float64   `json:"price"`
 	Amount        float64   `json:"amount"`
 	FilledAmount  float64   `json:"filled_amount"`
+	// AvgPrice is the average price of the filled amount, zero until filled
+	AvgPrice      float64   `json:"avg_price,omitempty"`
 	Status        Status    `json:"status"`
 	TimeInForce   string    `json:"time_in_force"`
 	CreatedTime   int64     `json:"created_time"`
@@ -68,9 +138,12 @@ type Position struct {
 	MarkPrice    float64 `json:"mark_price"`
 	UnrealizedPnl float64 `json:"unrealized_pnl"`
 	RealizedPnl  float64 `json:"realized_pnl"`
+	// Funding is the funding accumulated since the position opened; negative when paid
+	Funding      float64 `json:"funding"`
 	Leverage     int64   `json:"leverage"`
 	LiquidationPrice float64 `json:"liquidation_price"`
 	Status       string  `json:"status"`
+	Strategy     string  `json:"strategy,omitempty"`
 	CreatedTime  int64   `json:"created_time"`
 	UpdatedTime  int64   `json:"updated_time"`
 }
@@ -82,34 +155,50 @@ type Balance struct {
 	Available    float64 `json:"available"`
 	InOrders     float64 `json:"in_orders"`
 	Staked       float64 `json:"staked,omitempty"`
+	// UnrealizedPnl is the unrealized PnL included in Total by venues
+	// reporting the account equity, such as OKX and Bybit
+	UnrealizedPnl float64 `json:"unrealized_pnl,omitempty"`
+}
+
+// Wallet returns the balance excluding unrealized PnL
+func (b Balance) Wallet() float64 {
+	return b.Total - b.UnrealizedPnl
 }
 
-// Trader interface defines methods for interacting with trading exchanges
+// Trader interface defines methods for interacting with trading exchanges;
+// every call honors the cancellation and deadline of its context
 type Trader interface {
 	// GetBalance retrieves the account balance
-	GetBalance() ([]Balance, error)
+	GetBalance(ctx context.Context) ([]Balance, error)
 
 	// GetPosition retrieves the current position for a trading pair
-	GetPosition(pair string) (*Position, error)
+	GetPosition(ctx context.Context, pair string) (*Position, error)
 
 	// GetPositions retrieves all current positions
-	GetPositions() ([]Position, error)
+	GetPositions(ctx context.Context) ([]Position, error)
 
 	// CreateOrder creates a new order
-	CreateOrder(pair string, side Side, orderType OrderType, amount, price float64, leverage int64) (*Order, error)
+	CreateOrder(ctx context.Context, req OrderRequest) (*Order, error)
 
 	// CancelOrder cancels an existing order
-	CancelOrder(orderID string) error
+	CancelOrder(ctx context.Context, orderID string) error
 
 	// GetOrder retrieves an order by ID
-	GetOrder(orderID string) (*Order, error)
+	GetOrder(ctx context.Context, orderID string) (*Order, error)
 
 	// GetOrders retrieves all orders
-	GetOrders(pair string, status Status) ([]Order, error)
+	GetOrders(ctx context.Context, pair string, status Status) ([]Order, error)
 
 	// ClosePosition closes an open position
-	ClosePosition(pair string, amount float64) (*Order, error)
+	ClosePosition(ctx context.Context, pair string, amount float64) (*Order, error)
+
+	// SetLeverage sets the leverage for a trading pair, returning
+	// ErrLeverageAlreadySet when the pair already trades at it
+	SetLeverage(ctx context.Context, pair string, leverage int64) error
+
+	// SetStopLoss places a stop-loss order protecting a position
+	SetStopLoss(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error)
 
-	// SetLeverage sets the leverage for a trading pair
-	SetLeverage(pair string, leverage int64) error
+	// SetTakeProfit places a take-profit order for a position
+	SetTakeProfit(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error)
 }
\ No newline at end of file
@@ -0,0 +1,1057 @@
+package trader
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/ratelimit"
+	"github.com/nofx/retry"
+)
+
+// KrakenFuturesTrader must satisfy the typed Trader interface
+var _ Trader = (*KrakenFuturesTrader)(nil)
+
+// krakenPathPrefix prefixes the REST paths, which are signed without it
+const krakenPathPrefix = "/derivatives"
+
+// krakenFundingInterval is the funding period of Kraken perpetuals, in seconds
+const krakenFundingInterval = 3600
+
+// krakenErrorKinds maps Kraken Futures errors and order statuses to the
+// trading errors they represent
+var krakenErrorKinds = map[string]error{
+	"apiLimitExceeded":           ErrRateLimited,
+	"insufficientAvailableFunds": ErrInsufficientBalance,
+	"wouldCauseLiquidation":      ErrInsufficientBalance,
+	"invalidSize":                ErrMinNotional,
+	"tooManySmallOrders":         ErrMinNotional,
+	"authenticationError":        ErrUnauthorized,
+}
+
+// krakenTransientErrors are the Kraken Futures errors of temporary
+// conditions; nonce errors pass on retry, which signs with a fresh nonce
+var krakenTransientErrors = map[string]bool{
+	"apiLimitExceeded":    true,
+	"Server Error":        true,
+	"Unavailable":         true,
+	"nonceBelowThreshold": true,
+	"nonceDuplicate":      true,
+}
+
+// KrakenFuturesTrader implements the Trader interface for Kraken Futures.
+// Pairs such as BTC_USD trade the multi-collateral linear perpetuals
+// (PF_XBTUSD); inverse contracts trade by their Kraken symbol (PI_XBTUSD).
+// Leverage is only adjustable on the multi-collateral contracts.
+type KrakenFuturesTrader struct {
+	apiKey     string
+	secretKey  string
+	baseURL    string
+	prefix     string
+	contracts  ContractSource
+	limiter    *ratelimit.Limiter
+	retries    retry.Policy
+	httpClient *http.Client
+
+	// nonce increases with every signed request
+	nonce int64
+}
+
+// NewKrakenFuturesTrader creates a new Kraken Futures trader; the secret is
+// the base64 encoded API secret
+func NewKrakenFuturesTrader(apiKey, secretKey, baseURL string) *KrakenFuturesTrader {
+	if baseURL == "" {
+		baseURL = "https://futures.kraken.com"
+	}
+	return &KrakenFuturesTrader{
+		apiKey:     apiKey,
+		secretKey:  secretKey,
+		baseURL:    strings.TrimSuffix(strings.TrimRight(baseURL, "/"), krakenPathPrefix),
+		retries:    retry.DefaultPolicy,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SetContracts sets the contract metadata source used for price and quantity precision
+func (t *KrakenFuturesTrader) SetContracts(contracts ContractSource) {
+	t.contracts = contracts
+}
+
+// SetRateLimiter sets the limiter throttling the REST calls
+func (t *KrakenFuturesTrader) SetRateLimiter(limiter *ratelimit.Limiter) {
+	t.limiter = limiter
+}
+
+// SetRetryPolicy sets how failed REST calls are retried
+func (t *KrakenFuturesTrader) SetRetryPolicy(policy retry.Policy) {
+	t.retries = policy
+}
+
+// SetClientOrderPrefix sets the prefix tagging every order placed by this instance
+func (t *KrakenFuturesTrader) SetClientOrderPrefix(prefix string) {
+	t.prefix = prefix
+}
+
+// krakenSymbolPrefixes are the prefixes of Kraken Futures symbols: linear
+// and inverse perpetuals and fixed maturity futures
+var krakenSymbolPrefixes = []string{"PF_", "PI_", "FF_", "FI_"}
+
+// KrakenFuturesSymbol converts a pair such as BTC_USD (or BTC_USDT) to the
+// symbol of its multi-collateral perpetual (PF_XBTUSD); Kraken symbols such
+// as PI_XBTUSD pass through
+func KrakenFuturesSymbol(pair string) string {
+	upper := strings.ToUpper(pair)
+	for _, prefix := range krakenSymbolPrefixes {
+		if strings.HasPrefix(upper, prefix) {
+			return upper
+		}
+	}
+	base := strings.NewReplacer("_", "", "-", "", "/", "").Replace(upper)
+	for _, quote := range []string{"USDT", "USD"} {
+		if strings.HasSuffix(base, quote) && len(base) > len(quote) {
+			base = strings.TrimSuffix(base, quote)
+			break
+		}
+	}
+	if base == "BTC" {
+		base = "XBT"
+	}
+	return "PF_" + base + "USD"
+}
+
+// KrakenFuturesPair converts a Kraken Futures symbol back to a pair: BTC_USD
+// for PF_XBTUSD, while other contracts keep their symbol
+func KrakenFuturesPair(symbol string) string {
+	symbol = strings.ToUpper(symbol)
+	if !strings.HasPrefix(symbol, "PF_") || !strings.HasSuffix(symbol, "USD") {
+		return symbol
+	}
+	base := strings.TrimSuffix(strings.TrimPrefix(symbol, "PF_"), "USD")
+	return krakenAsset(base) + "_USD"
+}
+
+// krakenAsset converts a Kraken currency code to the common one (XBT to BTC)
+func krakenAsset(code string) string {
+	code = strings.ToUpper(code)
+	if code == "XBT" {
+		return "BTC"
+	}
+	return code
+}
+
+// krakenFlexible reports whether a symbol is a multi-collateral contract
+func krakenFlexible(symbol string) bool {
+	return strings.HasPrefix(symbol, "PF_") || strings.HasPrefix(symbol, "FF_")
+}
+
+// krakenInverse reports whether a symbol is an inverse contract, margined
+// and settled in its base currency
+func krakenInverse(symbol string) bool {
+	return strings.HasPrefix(symbol, "PI_") || strings.HasPrefix(symbol, "FI_")
+}
+
+// krakenResponse represents the common Kraken Futures response envelope
+type krakenResponse struct {
+	Result string `json:"result"`
+	Error  string `json:"error"`
+}
+
+// krakenSendStatus represents the outcome of an order submission
+type krakenSendStatus struct {
+	OrderID      string `json:"order_id"`
+	CliOrdID     string `json:"cliOrdId"`
+	Status       string `json:"status"`
+	ReceivedTime string `json:"receivedTime"`
+	// OrderEvents include an EXECUTION event for every immediate fill
+	OrderEvents []struct {
+		Type   string  `json:"type"`
+		Amount float64 `json:"amount"`
+		Price  float64 `json:"price"`
+	} `json:"orderEvents"`
+}
+
+// krakenFill represents an execution as listed by the fills endpoint
+type krakenFill struct {
+	OrderID  string  `json:"order_id"`
+	Size     float64 `json:"size"`
+	Price    float64 `json:"price"`
+	FillTime string  `json:"fillTime"`
+}
+
+// krakenOpenOrder represents an order as listed by the open orders endpoint
+type krakenOpenOrder struct {
+	OrderID        string  `json:"order_id"`
+	CliOrdID       string  `json:"cliOrdId"`
+	Symbol         string  `json:"symbol"`
+	Side           string  `json:"side"`
+	OrderType      string  `json:"orderType"`
+	LimitPrice     float64 `json:"limitPrice"`
+	StopPrice      float64 `json:"stopPrice"`
+	FilledSize     float64 `json:"filledSize"`
+	UnfilledSize   float64 `json:"unfilledSize"`
+	Status         string  `json:"status"`
+	ReceivedTime   string  `json:"receivedTime"`
+	LastUpdateTime string  `json:"lastUpdateTime"`
+}
+
+// krakenOrderStatus represents an order as reported by the order status endpoint
+type krakenOrderStatus struct {
+	Order struct {
+		Type                string  `json:"type"`
+		OrderID             string  `json:"orderId"`
+		CliOrdID            string  `json:"cliOrdId"`
+		Symbol              string  `json:"symbol"`
+		Side                string  `json:"side"`
+		Quantity            float64 `json:"quantity"`
+		Filled              float64 `json:"filled"`
+		LimitPrice          float64 `json:"limitPrice"`
+		Timestamp           string  `json:"timestamp"`
+		LastUpdateTimestamp string  `json:"lastUpdateTimestamp"`
+		PriceTriggerOptions *struct {
+			TriggerPrice float64 `json:"triggerPrice"`
+		} `json:"priceTriggerOptions"`
+	} `json:"order"`
+	Status string `json:"status"`
+}
+
+// krakenMarginSummary represents the margin figures of the multi-collateral
+// wallet, in USD
+type krakenMarginSummary struct {
+	MarginEquity            float64 `json:"marginEquity"`
+	AvailableMargin         float64 `json:"availableMargin"`
+	InitialMargin           float64 `json:"initialMargin"`
+	InitialMarginWithOrders float64 `json:"initialMarginWithOrders"`
+	// TotalUnrealizedAsMargin is the unrealized PnL counted in MarginEquity
+	TotalUnrealizedAsMargin float64 `json:"totalUnrealizedAsMargin"`
+}
+
+// GetBalance implements the Trader interface. Each collateral currency of the
+// multi-collateral wallet is reported by quantity, except USD, which reports
+// the wallet's margin equity and available margin across every collateral
+// currency, in USD. The margin accounts of inverse contracts are reported in
+// their settlement currency.
+func (t *KrakenFuturesTrader) GetBalance(ctx context.Context) ([]Balance, error) {
+	var result struct {
+		Accounts map[string]json.RawMessage `json:"accounts"`
+	}
+	if err := t.request(ctx, "GET", "/api/v3/accounts", nil, &result); err != nil {
+		return nil, err
+	}
+
+	var balances []Balance
+	inverse := make(map[string]*Balance)
+	for name, raw := range result.Accounts {
+		var account struct {
+			Type string `json:"type"`
+			// Currency is the settlement currency of a margin account
+			Currency   string `json:"currency"`
+			Currencies map[string]struct {
+				Quantity  float64 `json:"quantity"`
+				Available float64 `json:"available"`
+			} `json:"currencies"`
+			Auxiliary struct {
+				PortfolioValue float64 `json:"pv"`
+				AvailableFunds float64 `json:"af"`
+				PnL            float64 `json:"pnl"`
+			} `json:"auxiliary"`
+			krakenMarginSummary
+		}
+		if err := json.Unmarshal(raw, &account); err != nil {
+			return nil, fmt.Errorf("Kraken Futures account %s: %v", name, err)
+		}
+
+		switch account.Type {
+		case "multiCollateralMarginAccount":
+			margin := Balance{
+				Currency:      "USD",
+				Total:         account.MarginEquity,
+				Available:     account.AvailableMargin,
+				InOrders:      account.InitialMarginWithOrders - account.InitialMargin,
+				UnrealizedPnl: account.TotalUnrealizedAsMargin,
+			}
+			balances = append(balances, margin)
+			for code, c := range account.Currencies {
+				if currency := krakenAsset(code); currency != "USD" {
+					balances = append(balances, Balance{Currency: currency, Total: c.Quantity, Available: c.Available})
+				}
+			}
+		case "marginAccount":
+			currency := krakenAsset(account.Currency)
+			b, ok := inverse[currency]
+			if !ok {
+				b = &Balance{Currency: currency}
+				inverse[currency] = b
+			}
+			b.Total += account.Auxiliary.PortfolioValue
+			b.Available += account.Auxiliary.AvailableFunds
+			b.UnrealizedPnl += account.Auxiliary.PnL
+		}
+	}
+	for _, b := range inverse {
+		balances = append(balances, *b)
+	}
+	return balances, nil
+}
+
+// GetPosition implements the Trader interface
+func (t *KrakenFuturesTrader) GetPosition(ctx context.Context, pair string) (*Position, error) {
+	positions, err := t.GetPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range positions {
+		if KrakenFuturesSymbol(positions[i].Pair) == KrakenFuturesSymbol(pair) {
+			return &positions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// GetPositions implements the Trader interface; Kraken doesn't report mark
+// prices with the positions, so the unrealized PnL is computed from the tickers
+func (t *KrakenFuturesTrader) GetPositions(ctx context.Context) ([]Position, error) {
+	var result struct {
+		OpenPositions []struct {
+			Side              string  `json:"side"`
+			Symbol            string  `json:"symbol"`
+			Price             float64 `json:"price"`
+			FillTime          string  `json:"fillTime"`
+			Size              float64 `json:"size"`
+			UnrealizedFunding float64 `json:"unrealizedFunding"`
+			MaxFixedLeverage  float64 `json:"maxFixedLeverage"`
+		} `json:"openPositions"`
+	}
+	if err := t.request(ctx, "GET", "/api/v3/openpositions", nil, &result); err != nil {
+		return nil, err
+	}
+	if len(result.OpenPositions) == 0 {
+		return nil, nil
+	}
+
+	tickers, err := t.tickers(ctx)
+	if err != nil {
+		logger.Warning("Failed to get Kraken Futures mark prices: %v", err)
+	}
+	var positions []Position
+	for _, p := range result.OpenPositions {
+		if p.Size == 0 {
+			continue
+		}
+		side := BuySide
+		if p.Side == "short" {
+			side = SellSide
+		}
+		opened := krakenTime(p.FillTime)
+		position := Position{
+			ID:          p.Symbol + "-" + p.Side,
+			Pair:        KrakenFuturesPair(p.Symbol),
+			Side:        side,
+			Size:        p.Size,
+			EntryPrice:  p.Price,
+			MarkPrice:   tickers[p.Symbol].MarkPrice,
+			Funding:     p.UnrealizedFunding,
+			Leverage:    int64(p.MaxFixedLeverage),
+			Status:      "open",
+			CreatedTime: opened,
+			UpdatedTime: opened,
+		}
+		position.UnrealizedPnl = krakenUnrealizedPnL(p.Symbol, side, p.Size, p.Price, position.MarkPrice)
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// krakenUnrealizedPnL returns the unrealized PnL of a position: in USD for
+// linear contracts, and in the base currency for inverse contracts, whose
+// size is in USD
+func krakenUnrealizedPnL(symbol string, side Side, size, entry, mark float64) float64 {
+	if entry <= 0 || mark <= 0 {
+		return 0
+	}
+	direction := 1.0
+	if side == SellSide {
+		direction = -1
+	}
+	if krakenInverse(symbol) {
+		return direction * size * (1/entry - 1/mark)
+	}
+	return direction * size * (mark - entry)
+}
+
+// krakenTicker represents the ticker of a contract
+type krakenTicker struct {
+	Symbol      string  `json:"symbol"`
+	MarkPrice   float64 `json:"markPrice"`
+	FundingRate float64 `json:"fundingRate"`
+	Suspended   bool    `json:"suspended"`
+}
+
+// tickers returns the tickers of every contract by symbol
+func (t *KrakenFuturesTrader) tickers(ctx context.Context) (map[string]krakenTicker, error) {
+	var result struct {
+		Tickers []krakenTicker `json:"tickers"`
+	}
+	if err := t.request(ctx, "GET", "/api/v3/tickers", nil, &result); err != nil {
+		return nil, err
+	}
+	tickers := make(map[string]krakenTicker, len(result.Tickers))
+	for _, ticker := range result.Tickers {
+		tickers[ticker.Symbol] = ticker
+	}
+	return tickers, nil
+}
+
+// krakenRelativeFunding converts the absolute hourly funding rate of a
+// contract, per contract in its margin currency, to a fraction of the notional
+func krakenRelativeFunding(symbol string, rate, mark float64) float64 {
+	if mark <= 0 {
+		return 0
+	}
+	if krakenInverse(symbol) {
+		return rate * mark
+	}
+	return rate / mark
+}
+
+// CreateOrder implements the Trader interface; Kraken Futures has no
+// fill-or-kill orders
+func (t *KrakenFuturesTrader) CreateOrder(ctx context.Context, req OrderRequest) (*Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.Type != MarketOrder && req.Type != LimitOrder {
+		return nil, unsupportedType(req.Type)
+	}
+	if req.TimeInForce == FillOrKill {
+		return nil, errors.New("Kraken Futures doesn't support fill-or-kill orders")
+	}
+	symbol := KrakenFuturesSymbol(req.Pair)
+	if req.Leverage > 0 && krakenFlexible(symbol) {
+		if err := t.SetLeverage(ctx, req.Pair, req.Leverage); err != nil && !errors.Is(err, ErrLeverageAlreadySet) {
+			return nil, err
+		}
+	}
+
+	size, err := roundQuantity(t.contracts, req.Pair, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"orderType": {"mkt"},
+		"symbol":    {symbol},
+		"side":      {string(req.Side)},
+		"size":      {strconv.FormatFloat(size, 'f', -1, 64)},
+	}
+	if req.ReduceOnly {
+		params.Set("reduceOnly", "true")
+	}
+	price := req.Price
+	if req.Type == LimitOrder {
+		price = roundPrice(t.contracts, req.Pair, price)
+		params.Set("orderType", krakenLimitType(req))
+		params.Set("limitPrice", formatPrice(t.contracts, req.Pair, price))
+	}
+
+	return t.placeOrder(ctx, req.Pair, req.Side, req.Type, size, price, params)
+}
+
+// krakenLimitType returns the Kraken order type expressing the execution
+// flags of a limit order
+func krakenLimitType(req OrderRequest) string {
+	switch {
+	case req.PostOnly:
+		return "post"
+	case req.TimeInForce == ImmediateOrCancel:
+		return "ioc"
+	default:
+		return "lmt"
+	}
+}
+
+// placeOrder submits an order and returns it in the local model
+func (t *KrakenFuturesTrader) placeOrder(ctx context.Context, pair string, side Side, orderType OrderType, amount, price float64, params url.Values) (*Order, error) {
+	clientOrderID := t.clientOrderID(ctx, pair)
+	params.Set("cliOrdId", clientOrderID)
+
+	var result struct {
+		SendStatus krakenSendStatus `json:"sendStatus"`
+	}
+	err := t.request(ctx, "POST", "/api/v3/sendorder", params, &result)
+	if err == nil {
+		err = krakenSendError(result.SendStatus.Status)
+	}
+	if errors.Is(err, errDuplicateClientOrderID) {
+		// An earlier attempt reached the exchange before failing
+		logger.Info("Kraken Futures order %s was placed by an earlier attempt, looking it up", clientOrderID)
+		return t.GetOrderByClientID(ctx, pair, clientOrderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := OrderStatusNew
+	switch result.SendStatus.Status {
+	case "filled":
+		status = OrderStatusFilled
+	case "partiallyFilled":
+		status = OrderStatusPartiallyFilled
+	}
+	now := time.Now().UnixMilli()
+	order := &Order{
+		ID:            result.SendStatus.OrderID,
+		ClientOrderID: clientOrderID,
+		Pair:          pair,
+		Type:          orderType,
+		Side:          side,
+		Price:         price,
+		Amount:        amount,
+		Status:        status,
+		CreatedTime:   now,
+		UpdatedTime:   now,
+	}
+	var cost float64
+	for _, e := range result.SendStatus.OrderEvents {
+		if e.Type == "EXECUTION" {
+			order.FilledAmount += e.Amount
+			cost += e.Amount * e.Price
+		}
+	}
+	if order.FilledAmount > 0 {
+		order.AvgPrice = cost / order.FilledAmount
+	}
+	return order, nil
+}
+
+// krakenSendError returns the error of an order submission status, or nil
+// once the order was accepted
+func krakenSendError(status string) error {
+	switch status {
+	case "placed", "filled", "partiallyFilled":
+		return nil
+	case "clientOrderIdAlreadyExist":
+		return fmt.Errorf("%w: Kraken Futures order %s", errDuplicateClientOrderID, status)
+	}
+	return classify(fmt.Errorf("Kraken Futures order %s", status), krakenErrorKinds[status])
+}
+
+// clientOrderID generates and tracks the cliOrdId of an order on pair
+func (t *KrakenFuturesTrader) clientOrderID(ctx context.Context, pair string) string {
+	id := NewClientOrderID(clientOrderPrefix(ctx, t.prefix))
+	trackClientOrder(ctx, pair, id)
+	return id
+}
+
+// GetOrderByClientID implements ClientOrderLookup
+func (t *KrakenFuturesTrader) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*Order, error) {
+	orders, err := t.orderStatus(ctx, url.Values{"cliOrdIds": {clientOrderID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("Kraken Futures order %s: %w", clientOrderID, ErrOrderNotFound)
+	}
+	return &orders[0], nil
+}
+
+// ListContracts implements market.ContractLister with the tradeable
+// perpetuals and their current funding rates
+func (t *KrakenFuturesTrader) ListContracts(ctx context.Context) ([]market.ContractInfo, error) {
+	var result struct {
+		Instruments []struct {
+			Symbol                      string  `json:"symbol"`
+			Tradeable                   bool    `json:"tradeable"`
+			TickSize                    float64 `json:"tickSize"`
+			ContractSize                float64 `json:"contractSize"`
+			ContractValueTradePrecision float64 `json:"contractValueTradePrecision"`
+			MarginLevels                []struct {
+				InitialMargin     float64 `json:"initialMargin"`
+				MaintenanceMargin float64 `json:"maintenanceMargin"`
+			} `json:"marginLevels"`
+		} `json:"instruments"`
+	}
+	if err := t.request(ctx, "GET", "/api/v3/instruments", nil, &result); err != nil {
+		return nil, err
+	}
+
+	var contracts []market.ContractInfo
+	for _, i := range result.Instruments {
+		symbol := strings.ToUpper(i.Symbol)
+		if !i.Tradeable || !strings.HasPrefix(symbol, "PF_") && !strings.HasPrefix(symbol, "PI_") {
+			continue
+		}
+		step := math.Pow(10, -i.ContractValueTradePrecision)
+		contract := market.ContractInfo{
+			Pair:            KrakenFuturesPair(symbol),
+			TickSize:        i.TickSize,
+			QuantityStep:    step,
+			MinQuantity:     step,
+			ContractSize:    i.ContractSize,
+			FundingInterval: krakenFundingInterval,
+			Settle:          "usd",
+		}
+		// Inverse contracts are margined and settled in their base currency
+		if strings.HasPrefix(symbol, "PI_") {
+			contract.Inverse = true
+			contract.Settle = strings.ToLower(krakenAsset(strings.TrimSuffix(strings.TrimPrefix(symbol, "PI_"), "USD")))
+		}
+		if len(i.MarginLevels) > 0 && i.MarginLevels[0].InitialMargin > 0 {
+			contract.MaxLeverage = int64(1 / i.MarginLevels[0].InitialMargin)
+			contract.MaintenanceRate = i.MarginLevels[0].MaintenanceMargin
+		}
+		contracts = append(contracts, contract)
+	}
+
+	tickers, err := t.tickers(ctx)
+	if err != nil {
+		logger.Warning("Failed to get Kraken Futures funding rates, listing contracts without them: %v", err)
+		return contracts, nil
+	}
+	// Funding settles every hour on the hour
+	next := time.Now().Truncate(time.Hour).Add(time.Hour).Unix()
+	for i := range contracts {
+		symbol := KrakenFuturesSymbol(contracts[i].Pair)
+		if ticker, ok := tickers[symbol]; ok {
+			contracts[i].FundingRate = krakenRelativeFunding(symbol, ticker.FundingRate, ticker.MarkPrice)
+			contracts[i].NextFundingTime = next
+			contracts[i].MarkPrice = ticker.MarkPrice
+		}
+	}
+	return contracts, nil
+}
+
+// CancelOrder implements the Trader interface
+func (t *KrakenFuturesTrader) CancelOrder(ctx context.Context, orderID string) error {
+	var result struct {
+		CancelStatus struct {
+			Status string `json:"status"`
+		} `json:"cancelStatus"`
+	}
+	if err := t.request(ctx, "POST", "/api/v3/cancelorder", url.Values{"order_id": {orderID}}, &result); err != nil {
+		return err
+	}
+	switch result.CancelStatus.Status {
+	case "cancelled":
+		return nil
+	case "notFound":
+		return fmt.Errorf("Kraken Futures order %s: %w", orderID, ErrOrderNotFound)
+	}
+	return fmt.Errorf("Kraken Futures order %s not cancelled: %s", orderID, result.CancelStatus.Status)
+}
+
+// GetOrder implements the Trader interface
+func (t *KrakenFuturesTrader) GetOrder(ctx context.Context, orderID string) (*Order, error) {
+	orders, err := t.orderStatus(ctx, url.Values{"orderIds": {orderID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("Kraken Futures order %s: %w", orderID, ErrOrderNotFound)
+	}
+	return &orders[0], nil
+}
+
+// orderStatus queries orders by their order or client order IDs, including
+// orders no longer open
+func (t *KrakenFuturesTrader) orderStatus(ctx context.Context, params url.Values) ([]Order, error) {
+	var result struct {
+		Orders []krakenOrderStatus `json:"orders"`
+	}
+	if err := t.request(ctx, "POST", "/api/v3/orders/status", params, &result); err != nil {
+		return nil, err
+	}
+	orders := make([]Order, 0, len(result.Orders))
+	filled := false
+	for _, o := range result.Orders {
+		order := o.toOrder()
+		filled = filled || order.FilledAmount > 0
+		orders = append(orders, order)
+	}
+	if filled {
+		t.fillPrices(ctx, orders)
+	}
+	return orders, nil
+}
+
+// fillPrices sets the average fill price and last fill time of filled
+// orders from the account's recent fills, which the order status lacks
+func (t *KrakenFuturesTrader) fillPrices(ctx context.Context, orders []Order) {
+	var result struct {
+		Fills []krakenFill `json:"fills"`
+	}
+	if err := t.request(ctx, "GET", "/api/v3/fills", nil, &result); err != nil {
+		logger.Warning("Failed to get Kraken Futures fills, orders lack their fill price: %v", err)
+		return
+	}
+	type total struct {
+		size, cost float64
+		last       int64
+	}
+	totals := make(map[string]*total)
+	for _, f := range result.Fills {
+		sum, ok := totals[f.OrderID]
+		if !ok {
+			sum = &total{}
+			totals[f.OrderID] = sum
+		}
+		sum.size += f.Size
+		sum.cost += f.Size * f.Price
+		if at := krakenTime(f.FillTime); at > sum.last {
+			sum.last = at
+		}
+	}
+	for i := range orders {
+		if sum, ok := totals[orders[i].ID]; ok && sum.size > 0 {
+			orders[i].AvgPrice = sum.cost / sum.size
+			if sum.last > 0 {
+				orders[i].UpdatedTime = sum.last
+			}
+		}
+	}
+}
+
+// GetOrders implements the Trader interface; only open orders, including
+// stop and take-profit orders, can be listed
+func (t *KrakenFuturesTrader) GetOrders(ctx context.Context, pair string, status Status) ([]Order, error) {
+	var result struct {
+		OpenOrders []krakenOpenOrder `json:"openOrders"`
+	}
+	if err := t.request(ctx, "GET", "/api/v3/openorders", nil, &result); err != nil {
+		return nil, err
+	}
+
+	var orders []Order
+	for _, o := range result.OpenOrders {
+		if pair != "" && !strings.EqualFold(o.Symbol, KrakenFuturesSymbol(pair)) {
+			continue
+		}
+		order := o.toOrder()
+		if status == "" || order.Status == status {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// ClosePosition implements the Trader interface
+func (t *KrakenFuturesTrader) ClosePosition(ctx context.Context, pair string, amount float64) (*Order, error) {
+	position, err := t.GetPosition(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	if position == nil {
+		return nil, noPosition(pair)
+	}
+
+	side := OppositeSide(position.Side)
+	if amount <= 0 || amount > position.Size {
+		amount = position.Size
+	}
+	size, err := roundQuantity(t.contracts, pair, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"orderType":  {"mkt"},
+		"symbol":     {KrakenFuturesSymbol(pair)},
+		"side":       {string(side)},
+		"size":       {strconv.FormatFloat(size, 'f', -1, 64)},
+		"reduceOnly": {"true"},
+	}
+	return t.placeOrder(ctx, pair, side, MarketOrder, size, 0, params)
+}
+
+// SetLeverage implements the Trader interface; it sets the maximum leverage
+// preference of a multi-collateral contract, which margins its position in
+// isolation
+func (t *KrakenFuturesTrader) SetLeverage(ctx context.Context, pair string, leverage int64) error {
+	symbol := KrakenFuturesSymbol(pair)
+	if !krakenFlexible(symbol) {
+		return fmt.Errorf("Kraken Futures %s: leverage is only adjustable on multi-collateral contracts", symbol)
+	}
+	params := url.Values{
+		"symbol":      {symbol},
+		"maxLeverage": {strconv.FormatInt(leverage, 10)},
+	}
+	return t.request(ctx, "PUT", "/api/v3/leveragepreferences", params, nil)
+}
+
+// SetStopLoss implements the Trader interface
+func (t *KrakenFuturesTrader) SetStopLoss(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	return t.placeTrigger(ctx, pair, side, amount, triggerPrice, priceType, "stp")
+}
+
+// SetTakeProfit implements the Trader interface
+func (t *KrakenFuturesTrader) SetTakeProfit(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	return t.placeTrigger(ctx, pair, side, amount, triggerPrice, priceType, "take_profit")
+}
+
+// placeTrigger places a reduce-only trigger order of a Kraken order type
+// closing a position of the given side
+func (t *KrakenFuturesTrader) placeTrigger(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType, orderType string) (*Order, error) {
+	closeSide := OppositeSide(side)
+	size, err := roundQuantity(t.contracts, pair, amount)
+	if err != nil {
+		return nil, err
+	}
+	triggerPrice = roundPrice(t.contracts, pair, triggerPrice)
+
+	params := url.Values{
+		"orderType":     {orderType},
+		"symbol":        {KrakenFuturesSymbol(pair)},
+		"side":          {string(closeSide)},
+		"size":          {strconv.FormatFloat(size, 'f', -1, 64)},
+		"stopPrice":     {formatPrice(t.contracts, pair, triggerPrice)},
+		"triggerSignal": {krakenTriggerSignal(priceType)},
+		"reduceOnly":    {"true"},
+	}
+	order, err := t.placeOrder(ctx, pair, closeSide, StopOrder, size, triggerPrice, params)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Placed Kraken Futures %s order for %s %s %.4f @ %v (%s)", orderType, pair, side, size, triggerPrice, priceType)
+	return order, nil
+}
+
+// SetTrailingStop implements TrailingStopper with a trailing stop following
+// the mark price for the whole position
+func (t *KrakenFuturesTrader) SetTrailingStop(ctx context.Context, pair string, side Side, callbackRate float64) (*Order, error) {
+	position, err := t.GetPosition(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	if position == nil || position.Side != side {
+		return nil, noPosition(pair)
+	}
+
+	closeSide := OppositeSide(side)
+	params := url.Values{
+		"orderType":                 {"trailing_stop"},
+		"symbol":                    {KrakenFuturesSymbol(pair)},
+		"side":                      {string(closeSide)},
+		"size":                      {strconv.FormatFloat(position.Size, 'f', -1, 64)},
+		"triggerSignal":             {"mark"},
+		"trailingStopDeviationUnit": {"PERCENT"},
+		"trailingStopMaxDeviation":  {strconv.FormatFloat(callbackRate*100, 'f', -1, 64)},
+		"reduceOnly":                {"true"},
+	}
+	return t.placeOrder(ctx, pair, closeSide, StopOrder, position.Size, 0, params)
+}
+
+// toOrder converts an open Kraken order to the local model
+func (o krakenOpenOrder) toOrder() Order {
+	orderType, price := LimitOrder, o.LimitPrice
+	if o.OrderType != "lmt" {
+		orderType, price = StopOrder, o.StopPrice
+	}
+	status := OrderStatusNew
+	if o.Status == "partiallyFilled" || o.FilledSize > 0 {
+		status = OrderStatusPartiallyFilled
+	}
+	return Order{
+		ID:            o.OrderID,
+		ClientOrderID: o.CliOrdID,
+		Pair:          KrakenFuturesPair(o.Symbol),
+		Type:          orderType,
+		Side:          krakenSide(o.Side),
+		Price:         price,
+		Amount:        o.FilledSize + o.UnfilledSize,
+		FilledAmount:  o.FilledSize,
+		Status:        status,
+		CreatedTime:   krakenTime(o.ReceivedTime),
+		UpdatedTime:   krakenTime(o.LastUpdateTime),
+	}
+}
+
+// toOrder converts a Kraken order status to the local model
+func (o krakenOrderStatus) toOrder() Order {
+	order := Order{
+		ID:            o.Order.OrderID,
+		ClientOrderID: o.Order.CliOrdID,
+		Pair:          KrakenFuturesPair(o.Order.Symbol),
+		Type:          MarketOrder,
+		Side:          krakenSide(o.Order.Side),
+		Price:         o.Order.LimitPrice,
+		Amount:        o.Order.Quantity,
+		FilledAmount:  o.Order.Filled,
+		Status:        OrderStatusNew,
+		CreatedTime:   krakenTime(o.Order.Timestamp),
+		UpdatedTime:   krakenTime(o.Order.LastUpdateTimestamp),
+	}
+	if o.Order.LimitPrice > 0 {
+		order.Type = LimitOrder
+	}
+	if o.Order.PriceTriggerOptions != nil {
+		order.Type, order.Price = StopOrder, o.Order.PriceTriggerOptions.TriggerPrice
+	}
+
+	switch o.Status {
+	case "ENTERED_BOOK", "TRIGGER_PLACED", "TRIGGER_ACTIVATED":
+		if order.FilledAmount > 0 {
+			order.Status = OrderStatusPartiallyFilled
+		}
+	case "FULLY_EXECUTED":
+		order.Status = OrderStatusFilled
+	case "CANCELLED", "TRIGGER_CANCELLED":
+		order.Status = OrderStatusCanceled
+	case "REJECTED", "TRIGGER_FAILED":
+		order.Status = OrderStatusRejected
+	}
+	return order
+}
+
+// krakenTime parses a Kraken timestamp into Unix milliseconds
+func krakenTime(s string) int64 {
+	at, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0
+	}
+	return at.UnixMilli()
+}
+
+// krakenSide converts a Kraken side (buy/sell) to the local model
+func krakenSide(side string) Side {
+	if strings.EqualFold(side, "sell") {
+		return SellSide
+	}
+	return BuySide
+}
+
+// krakenTriggerSignal converts a trigger price type to Kraken's triggerSignal value
+func krakenTriggerSignal(priceType TriggerPriceType) string {
+	switch priceType {
+	case MarkPriceTrigger:
+		return "mark"
+	case IndexPriceTrigger:
+		return "index"
+	default:
+		return "last"
+	}
+}
+
+// krakenCategory returns the rate limit category of a Kraken Futures endpoint
+func krakenCategory(method, path string) ratelimit.Category {
+	switch path {
+	case "/api/v3/instruments", "/api/v3/tickers":
+		return ratelimit.Public
+	case "/api/v3/sendorder", "/api/v3/cancelorder":
+		return ratelimit.Trading
+	}
+	return ratelimit.Account
+}
+
+// request performs a signed Kraken Futures request and decodes the response
+// into out; parameters travel in the query, or the form body of POST requests
+func (t *KrakenFuturesTrader) request(ctx context.Context, method, path string, params url.Values, out interface{}) error {
+	return t.retries.Do(ctx, "Kraken Futures "+method+" "+path, func(int) error {
+		if err := t.limiter.Wait(ctx, "kraken", krakenCategory(method, path), 1); err != nil {
+			return err
+		}
+		return t.send(ctx, method, path, params.Encode(), out)
+	})
+}
+
+// send performs a single signed request; the signature covers a fresh nonce
+func (t *KrakenFuturesTrader) send(ctx context.Context, method, path, postData string, out interface{}) error {
+	endpoint := t.baseURL + krakenPathPrefix + path
+	var body []byte
+	if method == "POST" {
+		body = []byte(postData)
+	} else if postData != "" {
+		endpoint += "?" + postData
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	nonce := t.nextNonce()
+	authent, err := t.sign(postData + nonce + path)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("APIKey", t.apiKey)
+	req.Header.Set("Nonce", nonce)
+	req.Header.Set("Authent", authent)
+	if method == "POST" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope krakenResponse
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		status := &retry.StatusError{Status: resp.StatusCode, Message: string(data)}
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests:
+			return fmt.Errorf("Kraken Futures %s %s: %w: %w", method, path, ErrRateLimited, status)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("Kraken Futures %s %s: %w: %w", method, path, ErrUnauthorized, status)
+		}
+		return fmt.Errorf("Kraken Futures %s %s: %w", method, path, status)
+	}
+	if envelope.Result != "success" {
+		err := classify(fmt.Errorf("Kraken Futures %s %s: %s", method, path, envelope.Error), krakenErrorKinds[envelope.Error])
+		if krakenTransientErrors[envelope.Error] || resp.StatusCode >= 500 {
+			return retry.Transient(err)
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// nextNonce returns a nonce above every one sent before
+func (t *KrakenFuturesTrader) nextNonce() string {
+	for {
+		last := atomic.LoadInt64(&t.nonce)
+		next := time.Now().UnixMilli()
+		if next <= last {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&t.nonce, last, next) {
+			return strconv.FormatInt(next, 10)
+		}
+	}
+}
+
+// sign computes the Authent header Kraken Futures expects: the base64
+// HMAC-SHA512, keyed with the decoded secret, of the SHA-256 of the message
+func (t *KrakenFuturesTrader) sign(message string) (string, error) {
+	secret, err := base64.StdEncoding.DecodeString(t.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("Kraken Futures secret must be base64: %v", err)
+	}
+	digest := sha256.Sum256([]byte(message))
+	mac := hmac.New(sha512.New, secret)
+	mac.Write(digest[:])
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
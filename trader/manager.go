@@ -0,0 +1,85 @@
+package trader
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Manager registers Trader implementations keyed by exchange name and
+// selects the default exchange used when callers don't name one
+type Manager struct {
+	mu          sync.RWMutex
+	traders     map[string]Trader
+	defaultName string
+}
+
+// NewManager creates an empty trader manager
+func NewManager() *Manager {
+	return &Manager{
+		traders: make(map[string]Trader),
+	}
+}
+
+// Register adds a trader under an exchange name; the first registered trader
+// becomes the default until SetDefault is called
+func (m *Manager) Register(name string, t Trader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.traders[name] = t
+	if m.defaultName == "" {
+		m.defaultName = name
+	}
+}
+
+// Get returns the trader registered under an exchange name
+func (m *Manager) Get(name string) (Trader, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.traders[name]
+	if !ok {
+		return nil, fmt.Errorf("exchange %q is not configured", name)
+	}
+	return t, nil
+}
+
+// Default returns the default trader, or nil when no exchange is configured
+func (m *Manager) Default() Trader {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.traders[m.defaultName]
+}
+
+// DefaultName returns the name of the default exchange
+func (m *Manager) DefaultName() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.defaultName
+}
+
+// SetDefault selects the default exchange at runtime
+func (m *Manager) SetDefault(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.traders[name]; !ok {
+		return fmt.Errorf("exchange %q is not configured", name)
+	}
+	m.defaultName = name
+	return nil
+}
+
+// Names returns the sorted names of all registered exchanges
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.traders))
+	for name := range m.traders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
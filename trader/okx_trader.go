@@ -0,0 +1,913 @@
+package trader
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+	"github.com/nofx/ratelimit"
+	"github.com/nofx/retry"
+)
+
+// OKXTrader must satisfy the typed Trader interface
+var _ Trader = (*OKXTrader)(nil)
+
+// OKX margin modes sent as tdMode on every order
+const (
+	OKXCrossMargin    = "cross"
+	OKXIsolatedMargin = "isolated"
+)
+
+// OKXTrader implements the Trader interface for OKX perpetual swaps.
+// Amounts are expressed in contracts, as OKX expects for SWAP instruments.
+type OKXTrader struct {
+	apiKey     string
+	secretKey  string
+	passphrase string
+	baseURL    string
+	marginMode string
+	prefix     string
+	contracts  ContractSource
+	limiter    *ratelimit.Limiter
+	retries    retry.Policy
+	httpClient *http.Client
+
+	// OKX needs the instrument ID to query or cancel an order by ID, and
+	// conditional (algo) orders live behind separate endpoints
+	mu         sync.RWMutex
+	orderPairs map[string]string
+	algoOrders map[string]bool
+}
+
+// NewOKXTrader creates a new OKX trader
+func NewOKXTrader(apiKey, secretKey, passphrase, baseURL string) *OKXTrader {
+	if baseURL == "" {
+		baseURL = "https://www.okx.com"
+	}
+	return &OKXTrader{
+		apiKey:     apiKey,
+		secretKey:  secretKey,
+		passphrase: passphrase,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		marginMode: OKXCrossMargin,
+		retries:    retry.DefaultPolicy,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		orderPairs: make(map[string]string),
+		algoOrders: make(map[string]bool),
+	}
+}
+
+// SetContracts sets the contract metadata source used to round outgoing prices
+func (t *OKXTrader) SetContracts(contracts ContractSource) {
+	t.contracts = contracts
+}
+
+// SetRateLimiter sets the limiter throttling the REST calls
+func (t *OKXTrader) SetRateLimiter(limiter *ratelimit.Limiter) {
+	t.limiter = limiter
+}
+
+// SetRetryPolicy sets how failed REST calls are retried
+func (t *OKXTrader) SetRetryPolicy(policy retry.Policy) {
+	t.retries = policy
+}
+
+// SetClientOrderPrefix sets the prefix tagging every order placed by this instance
+func (t *OKXTrader) SetClientOrderPrefix(prefix string) {
+	t.prefix = prefix
+}
+
+// clientOrderID generates and tracks the client order ID of an order on pair,
+// which OKX requires to be alphanumeric and at most 32 characters long
+func (t *OKXTrader) clientOrderID(ctx context.Context, pair string) string {
+	id := okxTag(clientOrderPrefix(ctx, t.prefix)) + clientOrderSuffix()
+	trackClientOrder(ctx, pair, id)
+	return id
+}
+
+// SetMarginMode sets the margin mode (cross or isolated) used for new orders
+func (t *OKXTrader) SetMarginMode(mode string) error {
+	if mode != OKXCrossMargin && mode != OKXIsolatedMargin {
+		return fmt.Errorf("invalid OKX margin mode %q", mode)
+	}
+	t.marginMode = mode
+	return nil
+}
+
+// OKXInstrumentID converts a pair such as BTC_USDT to an OKX swap instrument ID (BTC-USDT-SWAP)
+func OKXInstrumentID(pair string) string {
+	if strings.HasSuffix(pair, "-SWAP") {
+		return pair
+	}
+	return strings.ToUpper(strings.NewReplacer("_", "-", "/", "-").Replace(pair)) + "-SWAP"
+}
+
+// OKXPair converts an OKX swap instrument ID back to a pair such as BTC_USDT
+func OKXPair(instID string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(instID, "-SWAP"), "-", "_")
+}
+
+// okxResponse represents the common OKX response envelope
+type okxResponse struct {
+	Code string          `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// okxOrder represents an order as returned by OKX
+type okxOrder struct {
+	OrdID       string `json:"ordId"`
+	AlgoID      string `json:"algoId"`
+	ClOrdID     string `json:"clOrdId"`
+	AlgoClOrdID string `json:"algoClOrdId"`
+	InstID      string `json:"instId"`
+	OrdType     string `json:"ordType"`
+	Side        string `json:"side"`
+	Px          string `json:"px"`
+	SlTriggerPx string `json:"slTriggerPx"`
+	TpTriggerPx string `json:"tpTriggerPx"`
+	Sz          string `json:"sz"`
+	AccFillSz   string `json:"accFillSz"`
+	AvgPx       string `json:"avgPx"`
+	State       string `json:"state"`
+	CTime       string `json:"cTime"`
+	UTime       string `json:"uTime"`
+	SCode       string `json:"sCode"`
+	SMsg        string `json:"sMsg"`
+}
+
+// GetBalance implements the Trader interface
+func (t *OKXTrader) GetBalance(ctx context.Context) ([]Balance, error) {
+	var accounts []struct {
+		Details []struct {
+			Ccy       string `json:"ccy"`
+			Eq        string `json:"eq"`
+			AvailBal  string `json:"availBal"`
+			FrozenBal string `json:"frozenBal"`
+			Upl       string `json:"upl"`
+		} `json:"details"`
+	}
+	if err := t.request(ctx, "GET", "/api/v5/account/balance", nil, nil, &accounts); err != nil {
+		return nil, err
+	}
+
+	var balances []Balance
+	for _, account := range accounts {
+		for _, d := range account.Details {
+			balances = append(balances, Balance{
+				Currency:      d.Ccy,
+				Total:         parseFloat(d.Eq),
+				Available:     parseFloat(d.AvailBal),
+				InOrders:      parseFloat(d.FrozenBal),
+				UnrealizedPnl: parseFloat(d.Upl),
+			})
+		}
+	}
+	return balances, nil
+}
+
+// GetPosition implements the Trader interface
+func (t *OKXTrader) GetPosition(ctx context.Context, pair string) (*Position, error) {
+	positions, err := t.positions(ctx, url.Values{"instType": {"SWAP"}, "instId": {OKXInstrumentID(pair)}})
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		return nil, nil
+	}
+	return &positions[0], nil
+}
+
+// GetPositions implements the Trader interface
+func (t *OKXTrader) GetPositions(ctx context.Context) ([]Position, error) {
+	return t.positions(ctx, url.Values{"instType": {"SWAP"}})
+}
+
+// positions queries open positions matching the given filters
+func (t *OKXTrader) positions(ctx context.Context, query url.Values) ([]Position, error) {
+	var data []struct {
+		PosID       string `json:"posId"`
+		InstID      string `json:"instId"`
+		PosSide     string `json:"posSide"`
+		Pos         string `json:"pos"`
+		AvgPx       string `json:"avgPx"`
+		MarkPx      string `json:"markPx"`
+		Upl         string `json:"upl"`
+		RealizedPnl string `json:"realizedPnl"`
+		FundingFee  string `json:"fundingFee"`
+		Lever       string `json:"lever"`
+		LiqPx       string `json:"liqPx"`
+		CTime       string `json:"cTime"`
+		UTime       string `json:"uTime"`
+	}
+	if err := t.request(ctx, "GET", "/api/v5/account/positions", query, nil, &data); err != nil {
+		return nil, err
+	}
+
+	var positions []Position
+	for _, p := range data {
+		size := parseFloat(p.Pos)
+		if size == 0 {
+			continue
+		}
+
+		side := BuySide
+		if p.PosSide == "short" || (p.PosSide == "net" && size < 0) {
+			side = SellSide
+		}
+		if size < 0 {
+			size = -size
+		}
+
+		positions = append(positions, Position{
+			ID:               p.PosID,
+			Pair:             OKXPair(p.InstID),
+			Side:             side,
+			Size:             size,
+			EntryPrice:       parseFloat(p.AvgPx),
+			MarkPrice:        parseFloat(p.MarkPx),
+			UnrealizedPnl:    parseFloat(p.Upl),
+			RealizedPnl:      parseFloat(p.RealizedPnl),
+			Funding:          parseFloat(p.FundingFee),
+			Leverage:         int64(parseFloat(p.Lever)),
+			LiquidationPrice: parseFloat(p.LiqPx),
+			Status:           "open",
+			CreatedTime:      int64(parseFloat(p.CTime)),
+			UpdatedTime:      int64(parseFloat(p.UTime)),
+		})
+	}
+	return positions, nil
+}
+
+// CreateOrder implements the Trader interface
+func (t *OKXTrader) CreateOrder(ctx context.Context, req OrderRequest) (*Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.Type != MarketOrder && req.Type != LimitOrder {
+		return nil, unsupportedType(req.Type)
+	}
+	if req.Leverage > 0 {
+		if err := t.SetLeverage(ctx, req.Pair, req.Leverage); err != nil && !errors.Is(err, ErrLeverageAlreadySet) {
+			return nil, err
+		}
+	}
+
+	body := map[string]interface{}{
+		"instId":  OKXInstrumentID(req.Pair),
+		"tdMode":  t.marginMode,
+		"side":    string(req.Side),
+		"ordType": "market",
+		"sz":      strconv.FormatFloat(req.Amount, 'f', -1, 64),
+		"clOrdId": t.clientOrderID(ctx, req.Pair),
+	}
+	if req.ReduceOnly {
+		body["reduceOnly"] = true
+	}
+	price := req.Price
+	if req.Type == LimitOrder {
+		price = roundPrice(t.contracts, req.Pair, price)
+		body["ordType"] = okxLimitType(req)
+		body["px"] = formatPrice(t.contracts, req.Pair, price)
+	}
+
+	return t.placeOrder(ctx, req.Pair, req.Side, req.Type, req.Amount, price, body)
+}
+
+// okxLimitType returns the OKX order type expressing the execution flags of
+// a limit order
+func okxLimitType(req OrderRequest) string {
+	switch {
+	case req.PostOnly:
+		return "post_only"
+	case req.TimeInForce == ImmediateOrCancel:
+		return "ioc"
+	case req.TimeInForce == FillOrKill:
+		return "fok"
+	default:
+		return "limit"
+	}
+}
+
+// placeOrder submits an order and returns it in the local model
+func (t *OKXTrader) placeOrder(ctx context.Context, pair string, side Side, orderType OrderType, amount, price float64, body map[string]interface{}) (*Order, error) {
+	var data []okxOrder
+	err := t.request(ctx, "POST", "/api/v5/trade/order", nil, body, &data)
+	if errors.Is(err, errDuplicateClientOrderID) {
+		// An earlier attempt reached the exchange before failing
+		clientOrderID, _ := body["clOrdId"].(string)
+		logger.Info("OKX order %s was placed by an earlier attempt, looking it up", clientOrderID)
+		return t.GetOrderByClientID(ctx, pair, clientOrderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("OKX returned no order data")
+	}
+	if data[0].SCode != "" && data[0].SCode != "0" {
+		return nil, classify(fmt.Errorf("OKX order rejected: %s (%s)", data[0].SMsg, data[0].SCode), okxErrorKinds[data[0].SCode])
+	}
+
+	t.rememberOrder(data[0].OrdID, pair)
+	now := time.Now().UnixMilli()
+	return &Order{
+		ID:            data[0].OrdID,
+		ClientOrderID: data[0].ClOrdID,
+		Pair:          pair,
+		Type:          orderType,
+		Side:          side,
+		Price:         price,
+		Amount:        amount,
+		Status:        OrderStatusNew,
+		CreatedTime:   now,
+		UpdatedTime:   now,
+	}, nil
+}
+
+// GetOrderByClientID implements ClientOrderLookup
+func (t *OKXTrader) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*Order, error) {
+	var data []okxOrder
+	query := url.Values{"instId": {OKXInstrumentID(pair)}, "clOrdId": {clientOrderID}}
+	if err := t.request(ctx, "GET", "/api/v5/trade/order", query, nil, &data); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("OKX order %s: %w", clientOrderID, ErrOrderNotFound)
+	}
+
+	order := data[0].toOrder()
+	order.Pair = pair
+	t.rememberOrder(order.ID, pair)
+	return &order, nil
+}
+
+// GetTransfers implements TransferReader with the deposit and withdrawal
+// history of the funding account, the newest 100 of each since a time
+func (t *OKXTrader) GetTransfers(ctx context.Context, since time.Time) ([]Transfer, error) {
+	query := url.Values{"before": {strconv.FormatInt(since.UnixMilli(), 10)}}
+	var deposits []struct {
+		DepID string `json:"depId"`
+		Ccy   string `json:"ccy"`
+		Amt   string `json:"amt"`
+		State string `json:"state"`
+		Ts    string `json:"ts"`
+	}
+	if err := t.request(ctx, "GET", "/api/v5/asset/deposit-history", query, nil, &deposits); err != nil {
+		return nil, err
+	}
+	var withdrawals []struct {
+		WdID  string `json:"wdId"`
+		Ccy   string `json:"ccy"`
+		Amt   string `json:"amt"`
+		State string `json:"state"`
+		Ts    string `json:"ts"`
+	}
+	if err := t.request(ctx, "GET", "/api/v5/asset/withdrawal-history", query, nil, &withdrawals); err != nil {
+		return nil, err
+	}
+
+	transfers := make([]Transfer, 0, len(deposits)+len(withdrawals))
+	for _, d := range deposits {
+		transfers = append(transfers, Transfer{
+			ID:        d.DepID,
+			Type:      Deposit,
+			Currency:  d.Ccy,
+			Amount:    parseFloat(d.Amt),
+			Status:    d.State,
+			Completed: d.State == "2",
+			Time:      time.UnixMilli(int64(parseFloat(d.Ts))),
+		})
+	}
+	for _, w := range withdrawals {
+		transfers = append(transfers, Transfer{
+			ID:        w.WdID,
+			Type:      Withdrawal,
+			Currency:  w.Ccy,
+			Amount:    parseFloat(w.Amt),
+			Status:    w.State,
+			Completed: w.State == "2",
+			Time:      time.UnixMilli(int64(parseFloat(w.Ts))),
+		})
+	}
+	return transfers, nil
+}
+
+// ListContracts implements market.ContractLister with the live USDT-settled
+// swaps; quantities are in contracts of ContractSize
+func (t *OKXTrader) ListContracts(ctx context.Context) ([]market.ContractInfo, error) {
+	var instruments []struct {
+		InstID    string `json:"instId"`
+		SettleCcy string `json:"settleCcy"`
+		State     string `json:"state"`
+		CtVal     string `json:"ctVal"`
+		TickSz    string `json:"tickSz"`
+		LotSz     string `json:"lotSz"`
+		MinSz     string `json:"minSz"`
+		Lever     string `json:"lever"`
+	}
+	query := url.Values{"instType": {"SWAP"}}
+	if err := t.request(ctx, "GET", "/api/v5/public/instruments", query, nil, &instruments); err != nil {
+		return nil, err
+	}
+
+	contracts := make([]market.ContractInfo, 0, len(instruments))
+	for _, i := range instruments {
+		if i.SettleCcy != "USDT" || i.State != "live" {
+			continue
+		}
+		contracts = append(contracts, market.ContractInfo{
+			Pair:         OKXPair(i.InstID),
+			TickSize:     parseFloat(i.TickSz),
+			QuantityStep: parseFloat(i.LotSz),
+			MinQuantity:  parseFloat(i.MinSz),
+			ContractSize: parseFloat(i.CtVal),
+			MaxLeverage:  int64(parseFloat(i.Lever)),
+		})
+	}
+	return contracts, nil
+}
+
+// GetFundingRate implements market.FundingReader; OKX lists swaps without
+// their funding rate
+func (t *OKXTrader) GetFundingRate(ctx context.Context, pair string) (*market.FundingRate, error) {
+	var data []struct {
+		FundingRate string `json:"fundingRate"`
+		FundingTime string `json:"fundingTime"`
+	}
+	query := url.Values{"instId": {OKXInstrumentID(pair)}}
+	if err := t.request(ctx, "GET", "/api/v5/public/funding-rate", query, nil, &data); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("OKX returned no funding rate for %s", pair)
+	}
+	return &market.FundingRate{
+		Pair: pair,
+		Rate: parseFloat(data[0].FundingRate),
+		Time: int64(parseFloat(data[0].FundingTime)) / 1000,
+	}, nil
+}
+
+// CancelOrder implements the Trader interface
+func (t *OKXTrader) CancelOrder(ctx context.Context, orderID string) error {
+	pair, err := t.orderPair(orderID)
+	if err != nil {
+		return err
+	}
+
+	t.mu.RLock()
+	algo := t.algoOrders[orderID]
+	t.mu.RUnlock()
+
+	var data []okxOrder
+	if algo {
+		body := []map[string]interface{}{{"instId": OKXInstrumentID(pair), "algoId": orderID}}
+		if err := t.request(ctx, "POST", "/api/v5/trade/cancel-algos", nil, body, &data); err != nil {
+			return err
+		}
+	} else {
+		body := map[string]interface{}{"instId": OKXInstrumentID(pair), "ordId": orderID}
+		if err := t.request(ctx, "POST", "/api/v5/trade/cancel-order", nil, body, &data); err != nil {
+			return err
+		}
+	}
+	if len(data) > 0 && data[0].SCode != "" && data[0].SCode != "0" {
+		return fmt.Errorf("OKX cancel rejected: %s (%s)", data[0].SMsg, data[0].SCode)
+	}
+	return nil
+}
+
+// GetOrder implements the Trader interface
+func (t *OKXTrader) GetOrder(ctx context.Context, orderID string) (*Order, error) {
+	pair, err := t.orderPair(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []okxOrder
+	query := url.Values{"instId": {OKXInstrumentID(pair)}, "ordId": {orderID}}
+	if err := t.request(ctx, "GET", "/api/v5/trade/order", query, nil, &data); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("OKX order %s not found", orderID)
+	}
+
+	order := data[0].toOrder()
+	return &order, nil
+}
+
+// GetOrders implements the Trader interface; only open orders, including
+// conditional orders, can be listed
+func (t *OKXTrader) GetOrders(ctx context.Context, pair string, status Status) ([]Order, error) {
+	query := url.Values{"instType": {"SWAP"}}
+	if pair != "" {
+		query.Set("instId", OKXInstrumentID(pair))
+	}
+
+	var data []okxOrder
+	if err := t.request(ctx, "GET", "/api/v5/trade/orders-pending", query, nil, &data); err != nil {
+		return nil, err
+	}
+
+	// Stop-loss and take-profit orders are only listed by the algo endpoint
+	var algos []okxOrder
+	query.Set("ordType", "conditional")
+	if err := t.request(ctx, "GET", "/api/v5/trade/orders-algo-pending", query, nil, &algos); err != nil {
+		return nil, err
+	}
+	for _, a := range algos {
+		t.mu.Lock()
+		t.algoOrders[a.AlgoID] = true
+		t.mu.Unlock()
+		a.OrdID, a.ClOrdID, a.State = a.AlgoID, a.AlgoClOrdID, "live"
+		// Report the trigger price, which is all an algo order's price means here
+		a.Px = a.SlTriggerPx
+		if a.Px == "" {
+			a.Px = a.TpTriggerPx
+		}
+		data = append(data, a)
+	}
+
+	var orders []Order
+	for _, o := range data {
+		order := o.toOrder()
+		t.rememberOrder(order.ID, order.Pair)
+		if status == "" || order.Status == status {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// ClosePosition implements the Trader interface
+func (t *OKXTrader) ClosePosition(ctx context.Context, pair string, amount float64) (*Order, error) {
+	position, err := t.GetPosition(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	if position == nil {
+		return nil, noPosition(pair)
+	}
+
+	side := SellSide
+	if position.Side == SellSide {
+		side = BuySide
+	}
+	if amount <= 0 || amount > position.Size {
+		amount = position.Size
+	}
+
+	body := map[string]interface{}{
+		"instId":     OKXInstrumentID(pair),
+		"tdMode":     t.marginMode,
+		"side":       string(side),
+		"ordType":    "market",
+		"sz":         strconv.FormatFloat(amount, 'f', -1, 64),
+		"reduceOnly": true,
+		"clOrdId":    t.clientOrderID(ctx, pair),
+	}
+	return t.placeOrder(ctx, pair, side, MarketOrder, amount, 0, body)
+}
+
+// SetLeverage implements the Trader interface
+func (t *OKXTrader) SetLeverage(ctx context.Context, pair string, leverage int64) error {
+	body := map[string]interface{}{
+		"instId":  OKXInstrumentID(pair),
+		"lever":   strconv.FormatInt(leverage, 10),
+		"mgnMode": t.marginMode,
+	}
+	return t.request(ctx, "POST", "/api/v5/account/set-leverage", nil, body, nil)
+}
+
+// SetStopLoss implements the Trader interface
+func (t *OKXTrader) SetStopLoss(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	return t.placeAlgo(ctx, pair, side, amount, triggerPrice, priceType, "sl")
+}
+
+// SetTakeProfit implements the Trader interface
+func (t *OKXTrader) SetTakeProfit(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	return t.placeAlgo(ctx, pair, side, amount, triggerPrice, priceType, "tp")
+}
+
+// SetTrailingStop implements TrailingStopper with an OKX move_order_stop
+// algo order covering the whole position
+func (t *OKXTrader) SetTrailingStop(ctx context.Context, pair string, side Side, callbackRate float64) (*Order, error) {
+	position, err := t.GetPosition(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	if position == nil || position.Size == 0 {
+		return nil, noPosition(pair)
+	}
+
+	closeSide := SellSide
+	if side == SellSide {
+		closeSide = BuySide
+	}
+	body := map[string]interface{}{
+		"instId":        OKXInstrumentID(pair),
+		"tdMode":        t.marginMode,
+		"side":          string(closeSide),
+		"ordType":       "move_order_stop",
+		"sz":            strconv.FormatFloat(position.Size, 'f', -1, 64),
+		"reduceOnly":    true,
+		"algoClOrdId":   t.clientOrderID(ctx, pair),
+		"callbackRatio": strconv.FormatFloat(callbackRate, 'f', -1, 64),
+	}
+
+	var data []okxOrder
+	if err := t.request(ctx, "POST", "/api/v5/trade/order-algo", nil, body, &data); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("OKX returned no algo order data")
+	}
+	if data[0].SCode != "" && data[0].SCode != "0" {
+		return nil, classify(fmt.Errorf("OKX trailing stop rejected: %s (%s)", data[0].SMsg, data[0].SCode), okxErrorKinds[data[0].SCode])
+	}
+
+	t.rememberOrder(data[0].AlgoID, pair)
+	t.mu.Lock()
+	t.algoOrders[data[0].AlgoID] = true
+	t.mu.Unlock()
+
+	logger.Info("Placed OKX trailing stop for %s %s %.4f with callback %.4f", pair, side, position.Size, callbackRate)
+	now := time.Now().UnixMilli()
+	return &Order{
+		ID:            data[0].AlgoID,
+		ClientOrderID: data[0].AlgoClOrdID,
+		Pair:          pair,
+		Type:          StopOrder,
+		Side:          closeSide,
+		Amount:        position.Size,
+		Status:        OrderStatusNew,
+		CreatedTime:   now,
+		UpdatedTime:   now,
+	}, nil
+}
+
+// placeAlgo places a reduce-only conditional order closing a position of the
+// given side when the trigger price is reached; kind is "sl" or "tp"
+func (t *OKXTrader) placeAlgo(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType, kind string) (*Order, error) {
+	closeSide := SellSide
+	if side == SellSide {
+		closeSide = BuySide
+	}
+	if priceType == "" {
+		priceType = LastPriceTrigger
+	}
+
+	triggerPrice = roundPrice(t.contracts, pair, triggerPrice)
+	body := map[string]interface{}{
+		"instId":               OKXInstrumentID(pair),
+		"tdMode":               t.marginMode,
+		"side":                 string(closeSide),
+		"ordType":              "conditional",
+		"sz":                   strconv.FormatFloat(amount, 'f', -1, 64),
+		"reduceOnly":           true,
+		"algoClOrdId":          t.clientOrderID(ctx, pair),
+		kind + "TriggerPx":     formatPrice(t.contracts, pair, triggerPrice),
+		kind + "OrdPx":         "-1",
+		kind + "TriggerPxType": string(priceType),
+	}
+
+	var data []okxOrder
+	if err := t.request(ctx, "POST", "/api/v5/trade/order-algo", nil, body, &data); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("OKX returned no algo order data")
+	}
+	if data[0].SCode != "" && data[0].SCode != "0" {
+		return nil, classify(fmt.Errorf("OKX algo order rejected: %s (%s)", data[0].SMsg, data[0].SCode), okxErrorKinds[data[0].SCode])
+	}
+
+	t.rememberOrder(data[0].AlgoID, pair)
+	t.mu.Lock()
+	t.algoOrders[data[0].AlgoID] = true
+	t.mu.Unlock()
+
+	logger.Info("Placed OKX %s for %s %s %.4f @ %v (%s)", kind, pair, side, amount, triggerPrice, priceType)
+	now := time.Now().UnixMilli()
+	return &Order{
+		ID:            data[0].AlgoID,
+		ClientOrderID: data[0].AlgoClOrdID,
+		Pair:          pair,
+		Type:          StopOrder,
+		Side:          closeSide,
+		Price:         triggerPrice,
+		Amount:        amount,
+		Status:        OrderStatusNew,
+		CreatedTime:   now,
+		UpdatedTime:   now,
+	}, nil
+}
+
+// toOrder converts an OKX order to the local model
+func (o okxOrder) toOrder() Order {
+	orderType := MarketOrder
+	switch o.OrdType {
+	case "limit", "post_only", "ioc", "fok":
+		orderType = LimitOrder
+	case "conditional", "trigger", "oco":
+		orderType = StopOrder
+	}
+
+	status := OrderStatusNew
+	switch o.State {
+	case "partially_filled":
+		status = OrderStatusPartiallyFilled
+	case "filled":
+		status = OrderStatusFilled
+	case "canceled", "mmp_canceled":
+		status = OrderStatusCanceled
+	}
+
+	return Order{
+		ID:            o.OrdID,
+		ClientOrderID: o.ClOrdID,
+		Pair:          OKXPair(o.InstID),
+		Type:          orderType,
+		Side:          Side(o.Side),
+		Price:         parseFloat(o.Px),
+		Amount:        parseFloat(o.Sz),
+		FilledAmount:  parseFloat(o.AccFillSz),
+		AvgPrice:      parseFloat(o.AvgPx),
+		Status:        status,
+		CreatedTime:   int64(parseFloat(o.CTime)),
+		UpdatedTime:   int64(parseFloat(o.UTime)),
+	}
+}
+
+// rememberOrder records the pair of an order so it can later be queried or canceled by ID
+func (t *OKXTrader) rememberOrder(orderID, pair string) {
+	if orderID == "" {
+		return
+	}
+	t.mu.Lock()
+	t.orderPairs[orderID] = pair
+	t.mu.Unlock()
+}
+
+// orderPair returns the pair of a known order
+func (t *OKXTrader) orderPair(orderID string) (string, error) {
+	t.mu.RLock()
+	pair, ok := t.orderPairs[orderID]
+	t.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown OKX order %s", orderID)
+	}
+	return pair, nil
+}
+
+// okxCategory returns the rate limit category of an OKX endpoint
+func okxCategory(method, path string) ratelimit.Category {
+	switch {
+	case strings.HasPrefix(path, "/api/v5/market/"), strings.HasPrefix(path, "/api/v5/public/"):
+		return ratelimit.Public
+	case method == "POST" && strings.HasPrefix(path, "/api/v5/trade/"):
+		return ratelimit.Trading
+	}
+	return ratelimit.Account
+}
+
+// request performs a signed OKX REST request and decodes the data field into
+// out, retrying transient failures. Every POST is safe to repeat: orders carry
+// a client order ID the exchange refuses to reuse.
+func (t *OKXTrader) request(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	requestPath := path
+	if len(query) > 0 {
+		requestPath += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	return t.retries.Do(ctx, "OKX "+method+" "+path, func(int) error {
+		if err := t.limiter.Wait(ctx, "okx", okxCategory(method, path), requestWeight(body)); err != nil {
+			return err
+		}
+		return t.send(ctx, method, path, requestPath, payload, out)
+	})
+}
+
+// send performs a single signed request; the signature covers a fresh timestamp
+func (t *OKXTrader) send(ctx context.Context, method, path, requestPath string, payload []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, t.baseURL+requestPath, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	req.Header.Set("OK-ACCESS-KEY", t.apiKey)
+	req.Header.Set("OK-ACCESS-SIGN", t.sign(timestamp+method+requestPath+string(payload)))
+	req.Header.Set("OK-ACCESS-TIMESTAMP", timestamp)
+	req.Header.Set("OK-ACCESS-PASSPHRASE", t.passphrase)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope okxResponse
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		status := &retry.StatusError{Status: resp.StatusCode, Message: string(data)}
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests:
+			return fmt.Errorf("OKX %s %s: %w: %w", method, path, ErrRateLimited, status)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("OKX %s %s: %w: %w", method, path, ErrUnauthorized, status)
+		}
+		return fmt.Errorf("OKX %s %s: %w", method, path, status)
+	}
+	if envelope.Code != "0" {
+		return okxError(method, path, envelope)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// okxTransientCodes are the OKX error codes of temporary conditions: service
+// unavailable, request timeout, rate limited, system busy and system error
+var okxTransientCodes = map[string]bool{"50001": true, "50004": true, "50011": true, "50013": true, "50026": true}
+
+// okxDuplicateClientOrderID is the code of an order reusing a client order ID
+const okxDuplicateClientOrderID = "51016"
+
+// okxErrorKinds maps OKX error codes to the trading errors they represent
+var okxErrorKinds = map[string]error{
+	"50011": ErrRateLimited,
+	"50061": ErrRateLimited,
+	"51008": ErrInsufficientBalance,
+	"51131": ErrInsufficientBalance,
+	"51020": ErrMinNotional,
+	"51023": ErrNoPosition,
+	"51169": ErrNoPosition,
+	"50110": ErrUnauthorized,
+	"50111": ErrUnauthorized,
+	"50113": ErrUnauthorized,
+	"50114": ErrUnauthorized,
+	"50119": ErrUnauthorized,
+	"50120": ErrUnauthorized,
+}
+
+// okxError converts a failed response into an error, reporting the first
+// per-item code of batch and order responses
+func okxError(method, path string, envelope okxResponse) error {
+	code, msg := envelope.Code, envelope.Msg
+	var items []okxOrder
+	if json.Unmarshal(envelope.Data, &items) == nil {
+		for _, item := range items {
+			if item.SCode != "" && item.SCode != "0" {
+				code, msg = item.SCode, item.SMsg
+				break
+			}
+		}
+	}
+
+	err := classify(fmt.Errorf("OKX %s %s: %s (code %s)", method, path, msg, code), okxErrorKinds[code])
+	switch {
+	case code == okxDuplicateClientOrderID:
+		return fmt.Errorf("%w: %v", errDuplicateClientOrderID, err)
+	case okxTransientCodes[code]:
+		return retry.Transient(err)
+	}
+	return err
+}
+
+// sign computes the base64 HMAC-SHA256 signature OKX expects
+func (t *OKXTrader) sign(message string) string {
+	mac := hmac.New(sha256.New, []byte(t.secretKey))
+	mac.Write([]byte(message))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,157 @@
+package trader
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// orderSequence disambiguates client order IDs generated in the same nanosecond
+var orderSequence uint64
+
+// clientOrderSuffixLen is the length of the unique suffix of client order
+// IDs, which follows their prefix and, on venues allowing one, a dash
+const clientOrderSuffixLen = 14
+
+// Longest prefixes the venues with client order ID length limits keep
+const (
+	okxTagLen   = 16
+	bybitTagLen = 20
+	gateTagLen  = 15
+)
+
+// OrderTag builds and recognizes the client order IDs owned by this
+// deployment, so several instances sharing an account can tell their orders apart
+type OrderTag struct {
+	// Prefix identifies this deployment
+	Prefix string
+	// Strategies maps strategy names to their own prefixes
+	Strategies map[string]string
+}
+
+// NewOrderTag creates a new order tag from the instance prefix and per-strategy prefixes
+func NewOrderTag(prefix string, strategies map[string]string) *OrderTag {
+	return &OrderTag{
+		Prefix:     prefix,
+		Strategies: strategies,
+	}
+}
+
+// ForStrategy returns the client order ID prefix for a strategy, falling back
+// to the deployment prefix
+func (t *OrderTag) ForStrategy(strategy string) string {
+	if p, ok := t.Strategies[strategy]; ok && p != "" {
+		return p
+	}
+	return t.Prefix
+}
+
+// Owns reports whether a client order ID was generated by this deployment.
+// Exchanges strip characters differently, so prefixes are compared normalized,
+// but only in full: the tag of "t-nofx2-…" isn't owned by "t-nofx".
+func (t *OrderTag) Owns(clientOrderID string) bool {
+	return t.Strategy(clientOrderID) != "" || hasTag(clientOrderID, t.Prefix)
+}
+
+// Strategy returns the strategy whose prefix matches a client order ID, or
+// an empty string when none does
+func (t *OrderTag) Strategy(clientOrderID string) string {
+	best, bestLen := "", 0
+	for strategy, prefix := range t.Strategies {
+		if len(prefix) > bestLen && hasTag(clientOrderID, prefix) {
+			best, bestLen = strategy, len(prefix)
+		}
+	}
+	return best
+}
+
+// NewClientOrderID generates a unique client order ID carrying prefix
+func NewClientOrderID(prefix string) string {
+	return prefix + "-" + clientOrderSuffix()
+}
+
+// clientOrderSuffix returns a short, unique, alphanumeric suffix of
+// clientOrderSuffixLen characters
+func clientOrderSuffix() string {
+	seq := atomic.AddUint64(&orderSequence, 1)
+	return padTag(strconv.FormatInt(time.Now().UnixNano(), 36), 12) + padTag(strconv.FormatUint(seq%1296, 36), 2)
+}
+
+// padTag left-pads s with zeros to n characters
+func padTag(s string, n int) string {
+	if len(s) >= n {
+		return s
+	}
+	return strings.Repeat("0", n-len(s)) + s
+}
+
+// okxTag returns the tag OKX orders carry for prefix: alphanumeric only
+func okxTag(prefix string) string {
+	return truncateTag(normalizeTag(prefix), okxTagLen)
+}
+
+// bybitTag returns the tag Bybit orders carry for prefix
+func bybitTag(prefix string) string {
+	return truncateTag(prefix, bybitTagLen)
+}
+
+// gateTag returns the tag Gate.io orders carry for prefix, which must
+// start with "t-"
+func gateTag(prefix string) string {
+	if !strings.HasPrefix(prefix, "t-") {
+		prefix = "t-" + prefix
+	}
+	return truncateTag(prefix, gateTagLen)
+}
+
+// truncateTag cuts a tag to at most n characters
+func truncateTag(tag string, n int) string {
+	if len(tag) > n {
+		return tag[:n]
+	}
+	return tag
+}
+
+// tagOf returns the tag a client order ID was generated with: the ID
+// without its suffix and the dash before it
+func tagOf(clientOrderID string) (string, bool) {
+	if len(clientOrderID) <= clientOrderSuffixLen {
+		return "", false
+	}
+	tag, suffix := clientOrderID[:len(clientOrderID)-clientOrderSuffixLen], clientOrderID[len(clientOrderID)-clientOrderSuffixLen:]
+	if normalizeTag(suffix) != strings.ToLower(suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(tag, "-"), true
+}
+
+// hasTag reports whether a client order ID was generated with prefix, as
+// any venue writes it, comparing tags ignoring separators and case
+func hasTag(clientOrderID, prefix string) bool {
+	if prefix == "" {
+		return false
+	}
+	tag, ok := tagOf(clientOrderID)
+	if !ok {
+		return false
+	}
+	tag = normalizeTag(tag)
+	for _, form := range []string{prefix, okxTag(prefix), bybitTag(prefix), gateTag(prefix)} {
+		if tag == normalizeTag(form) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTag lower-cases a tag and strips every non-alphanumeric character
+func normalizeTag(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
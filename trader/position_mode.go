@@ -0,0 +1,37 @@
+package trader
+
+import "context"
+
+// PositionMode represents how an account holds positions on a contract
+type PositionMode string
+
+const (
+	// SingleMode holds one net position per contract
+	SingleMode PositionMode = "single"
+	// DualMode (hedge mode) holds separate long and short positions per contract
+	DualMode PositionMode = "dual"
+)
+
+// PositionModeReader is implemented by traders detecting the account's position mode
+type PositionModeReader interface {
+	// PositionMode returns the position mode of the account
+	PositionMode(ctx context.Context) (PositionMode, error)
+}
+
+// GetPositionMode returns the position mode of the account behind t; traders
+// that can't detect it hold one position per contract
+func GetPositionMode(ctx context.Context, t Trader) (PositionMode, error) {
+	if r, ok := t.(PositionModeReader); ok {
+		return r.PositionMode(ctx)
+	}
+	return SingleMode, nil
+}
+
+// OppositeSide returns the other side: the side of the orders reducing a
+// position of side, or of the position a reducing order of side closes
+func OppositeSide(side Side) Side {
+	if side == SellSide {
+		return BuySide
+	}
+	return SellSide
+}
@@ -0,0 +1,138 @@
+package trader
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/nofx/logger"
+	"github.com/nofx/market"
+)
+
+// ContractSource provides contract metadata such as tick size and quantity step
+type ContractSource interface {
+	Get(pair string) (*market.ContractInfo, error)
+}
+
+// RoundToStep rounds a value to the nearest multiple of step; a non-positive
+// step leaves the value unchanged
+func RoundToStep(value, step float64) float64 {
+	if step <= 0 {
+		return value
+	}
+	rounded := math.Round(value/step) * step
+	return roundDecimals(rounded, stepDecimals(step))
+}
+
+// FormatPrice formats a price with exactly as many decimals as the tick size
+// allows, so venues never receive more precision than they accept
+func FormatPrice(price, tickSize float64) string {
+	if tickSize <= 0 {
+		return strconv.FormatFloat(price, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(RoundToStep(price, tickSize), 'f', stepDecimals(tickSize), 64)
+}
+
+// formatPrice formats a price for a venue with the decimals of the
+// contract's tick size, rounding it to the tick, or as is when metadata is
+// unavailable
+func formatPrice(contracts ContractSource, pair string, price float64) string {
+	var tickSize float64
+	if contracts != nil {
+		if contract, err := contracts.Get(pair); err == nil {
+			tickSize = contract.TickSize
+		}
+	}
+	return FormatPrice(price, tickSize)
+}
+
+// FloorToStep rounds a value down to a multiple of step, so quantities never
+// exceed what was requested; a non-positive step leaves the value unchanged
+func FloorToStep(value, step float64) float64 {
+	if step <= 0 {
+		return value
+	}
+	floored := math.Floor(value/step+1e-9) * step
+	return roundDecimals(floored, stepDecimals(step))
+}
+
+// roundPrice rounds a price to the contract's tick size, leaving it unchanged
+// when metadata is unavailable
+func roundPrice(contracts ContractSource, pair string, price float64) float64 {
+	if contracts == nil || price == 0 {
+		return price
+	}
+	contract, err := contracts.Get(pair)
+	if err != nil {
+		logger.Warning("No contract metadata for %s, sending unrounded price: %v", pair, err)
+		return price
+	}
+	return RoundToStep(price, contract.TickSize)
+}
+
+// roundQuantity rounds a quantity down to the contract's quantity step and
+// rejects quantities below the contract minimum
+func roundQuantity(contracts ContractSource, pair string, quantity float64) (float64, error) {
+	if contracts == nil {
+		return quantity, nil
+	}
+	contract, err := contracts.Get(pair)
+	if err != nil {
+		logger.Warning("No contract metadata for %s, sending unrounded quantity: %v", pair, err)
+		return quantity, nil
+	}
+
+	rounded := FloorToStep(quantity, contract.QuantityStep)
+	if rounded <= 0 || rounded < contract.MinQuantity {
+		return 0, fmt.Errorf("%w: quantity %v for %s is below %v", ErrMinNotional, quantity, pair, contract.MinQuantity)
+	}
+	return rounded, nil
+}
+
+// Notional returns the value of qty contracts of pair at price in the quote
+// currency, with the contract size from contracts: qty × size × price for
+// linear contracts and qty × size for inverse contracts, whose size is in
+// USD. Without metadata contracts count as one unit of the base currency.
+func Notional(contracts ContractSource, pair string, qty, price float64) float64 {
+	if contracts == nil {
+		return qty * price
+	}
+	contract, err := contracts.Get(pair)
+	if err != nil {
+		logger.Debug("No contract metadata for %s, valuing it by unit: %v", pair, err)
+		return qty * price
+	}
+	return QuoteNotional(contract, qty, price)
+}
+
+// QuoteNotional returns the value of qty contracts at price in the quote
+// currency, as Notional does with the contract at hand
+func QuoteNotional(contract *market.ContractInfo, qty, price float64) float64 {
+	if contract.Inverse {
+		return contract.Notional(qty, price) * price
+	}
+	return contract.Notional(qty, price)
+}
+
+// parseFloat parses an exchange numeric string, treating empty values as zero
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// stepDecimals returns the number of decimals needed to represent step
+func stepDecimals(step float64) int {
+	s := strconv.FormatFloat(step, 'f', -1, 64)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '.' {
+			return len(s) - i - 1
+		}
+	}
+	return 0
+}
+
+// roundDecimals removes floating point noise beyond the given decimals
+func roundDecimals(value float64, decimals int) float64 {
+	pow := math.Pow(10, float64(decimals))
+	return math.Round(value*pow) / pow
+}
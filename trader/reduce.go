@@ -0,0 +1,82 @@
+package trader
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nofx/market"
+)
+
+// ErrDustRemainder is returned for reductions that would leave a position
+// below the contract's minimum quantity or notional; close it fully instead
+var ErrDustRemainder = errors.New("reduction would leave a dust position")
+
+// ReductionAmount converts a reduction of a position, given either as a coin
+// quantity or as a percentage of its size, into the contracts to close,
+// rounded down to the contract's quantity step. Reductions of the whole size
+// or more close the position fully. Without contract metadata the amount is
+// not rounded.
+func ReductionAmount(p Position, contract *market.ContractInfo, quantity, percent float64) (float64, error) {
+	if (quantity > 0) == (percent > 0) {
+		return 0, errors.New("exactly one of quantity and percent must be given")
+	}
+	if percent > 100 {
+		return 0, fmt.Errorf("percent must be at most 100, got %v", percent)
+	}
+	if p.Size <= 0 {
+		return 0, noPosition(p.Pair)
+	}
+
+	contractSize := 1.0
+	if contract != nil && contract.ContractSize > 0 {
+		contractSize = contract.ContractSize
+	}
+	amount := p.Size * percent / 100
+	if quantity > 0 {
+		amount = quantity / contractSize
+	}
+	if amount >= p.Size*(1-1e-9) {
+		return p.Size, nil
+	}
+	if contract == nil {
+		return amount, nil
+	}
+
+	amount = FloorToStep(amount, contract.QuantityStep)
+	if amount <= 0 || amount < contract.MinQuantity {
+		return 0, fmt.Errorf("%w: reduction of %v contracts of %s is below %v", ErrMinNotional, amount, p.Pair, contract.MinQuantity)
+	}
+
+	price := p.MarkPrice
+	if price <= 0 {
+		price = p.EntryPrice
+	}
+	remaining := p.Size - amount
+	if contract.QuantityStep > 0 {
+		remaining = roundDecimals(remaining, stepDecimals(contract.QuantityStep))
+	}
+	if remaining < contract.MinQuantity {
+		return 0, fmt.Errorf("%w: %v contracts of %s would remain, below the minimum %v", ErrDustRemainder, remaining, p.Pair, contract.MinQuantity)
+	}
+	if notional := remaining * price * contractSize; notional < contract.MinNotional {
+		return 0, fmt.Errorf("%w: %v of %s would remain, below the minimum notional %v", ErrDustRemainder, notional, p.Pair, contract.MinNotional)
+	}
+	return amount, nil
+}
+
+// IsDust reports whether a position is below the contract's minimum quantity
+// or notional, so it can't be reduced normally and only closes fully
+func IsDust(p Position, contract *market.ContractInfo) bool {
+	if p.Size <= 0 || contract == nil {
+		return false
+	}
+	price := p.MarkPrice
+	if price <= 0 {
+		price = p.EntryPrice
+	}
+	contractSize := contract.ContractSize
+	if contractSize <= 0 {
+		contractSize = 1
+	}
+	return p.Size < contract.MinQuantity || p.Size*price*contractSize < contract.MinNotional
+}
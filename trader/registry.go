@@ -0,0 +1,140 @@
+package trader
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// registryRetention is how long client order IDs are remembered
+const registryRetention = 30 * 24 * time.Hour
+
+// OrderRegistry is a persisted record of the client order IDs placed by this
+// instance, used to tell our live orders apart from orphans of a crashed run
+// and to match exchange orders to what placed them
+type OrderRegistry struct {
+	path   string
+	mu     sync.RWMutex
+	orders map[string]ClientOrder
+	// saveMu orders concurrent saves, so the latest state is written last
+	saveMu sync.Mutex
+}
+
+// LoadOrderRegistry loads the registry from path; a missing file yields an empty registry
+func LoadOrderRegistry(path string) (*OrderRegistry, error) {
+	r := &OrderRegistry{
+		path:   path,
+		orders: make(map[string]ClientOrder),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []ClientOrder
+	if err := json.Unmarshal(data, &orders); err != nil {
+		// Earlier versions stored bare IDs
+		var ids []string
+		if json.Unmarshal(data, &ids) != nil {
+			return nil, err
+		}
+		now := time.Now()
+		orders = orders[:0]
+		for _, id := range ids {
+			orders = append(orders, ClientOrder{ID: id, CreatedAt: now})
+		}
+	}
+	for _, o := range orders {
+		r.orders[o.ID] = o
+	}
+
+	return r, nil
+}
+
+// Has reports whether a client order ID is known
+func (r *OrderRegistry) Has(clientOrderID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.orders[clientOrderID]
+	return ok
+}
+
+// Lookup returns the record of a client order ID
+func (r *OrderRegistry) Lookup(clientOrderID string) (ClientOrder, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	o, ok := r.orders[clientOrderID]
+	return o, ok
+}
+
+// Orders returns the recorded client orders, oldest first
+func (r *OrderRegistry) Orders() []ClientOrder {
+	r.mu.RLock()
+	orders := make([]ClientOrder, 0, len(r.orders))
+	for _, o := range r.orders {
+		orders = append(orders, o)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+		}
+		return orders[i].ID < orders[j].ID
+	})
+	return orders
+}
+
+// Add records a client order ID and persists the registry
+func (r *OrderRegistry) Add(clientOrderID string) error {
+	return r.Track(ClientOrder{ID: clientOrderID, CreatedAt: time.Now()})
+}
+
+// Track records a client order, forgets those past the retention period and
+// persists the registry
+func (r *OrderRegistry) Track(o ClientOrder) error {
+	cutoff := time.Now().Add(-registryRetention)
+	r.mu.Lock()
+	r.orders[o.ID] = o
+	for id, existing := range r.orders {
+		if !existing.CreatedAt.IsZero() && existing.CreatedAt.Before(cutoff) {
+			delete(r.orders, id)
+		}
+	}
+	r.mu.Unlock()
+	return r.Save()
+}
+
+// Remove forgets a client order ID and persists the registry
+func (r *OrderRegistry) Remove(clientOrderID string) error {
+	r.mu.Lock()
+	delete(r.orders, clientOrderID)
+	r.mu.Unlock()
+	return r.Save()
+}
+
+// Save writes the registry to disk atomically
+func (r *OrderRegistry) Save() error {
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+
+	data, err := json.Marshal(r.Orders())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,118 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nofx/market"
+)
+
+// Tranche represents one rung of a scale-out ladder
+type Tranche struct {
+	Amount float64 `json:"amount"`
+	Price  float64 `json:"price"`
+}
+
+// ScaleOutTranches splits a position into take-profit tranches: fractions
+// of its size, summing to at most 1, each taken at the matching price.
+// Prices must lie on the profitable side of the entry and step away from
+// it; amounts are rounded down to the contract's quantity step and each
+// must reach the minimum quantity and notional.
+func ScaleOutTranches(p Position, contract *market.ContractInfo, fractions, prices []float64) ([]Tranche, error) {
+	if len(fractions) == 0 || len(fractions) != len(prices) {
+		return nil, fmt.Errorf("need one price per fraction, got %d fractions and %d prices", len(fractions), len(prices))
+	}
+	if p.Size <= 0 {
+		return nil, noPosition(p.Pair)
+	}
+
+	long := p.Side != SellSide
+	total := 0.0
+	tranches := make([]Tranche, len(fractions))
+	for i, fraction := range fractions {
+		if fraction <= 0 {
+			return nil, fmt.Errorf("fraction %d must be positive, got %v", i, fraction)
+		}
+		total += fraction
+		price := prices[i]
+		if price <= 0 {
+			return nil, fmt.Errorf("price %d must be positive, got %v", i, price)
+		}
+		if p.EntryPrice > 0 && (long && price <= p.EntryPrice || !long && price >= p.EntryPrice) {
+			return nil, fmt.Errorf("price %d (%v) does not take profit on a %s position entered at %v", i, price, p.Side, p.EntryPrice)
+		}
+		if i > 0 && (long && price <= prices[i-1] || !long && price >= prices[i-1]) {
+			return nil, fmt.Errorf("price %d (%v) must be further from the entry than price %d (%v)", i, price, i-1, prices[i-1])
+		}
+		tranches[i] = Tranche{Amount: p.Size * fraction, Price: price}
+	}
+	if total > 1+1e-9 {
+		return nil, fmt.Errorf("fractions sum to %v, more than the whole position", total)
+	}
+	if contract == nil {
+		return tranches, nil
+	}
+
+	contractSize := contract.ContractSize
+	if contractSize <= 0 {
+		contractSize = 1
+	}
+	for i := range tranches {
+		t := &tranches[i]
+		t.Amount = FloorToStep(t.Amount, contract.QuantityStep)
+		if t.Amount <= 0 || t.Amount < contract.MinQuantity {
+			return nil, fmt.Errorf("%w: tranche %d of %v contracts of %s is below %v", ErrMinNotional, i, t.Amount, p.Pair, contract.MinQuantity)
+		}
+		if notional := t.Amount * t.Price * contractSize; notional < contract.MinNotional {
+			return nil, fmt.Errorf("%w: tranche %d notional %v of %s is below %v", ErrMinNotional, i, notional, p.Pair, contract.MinNotional)
+		}
+	}
+	return tranches, nil
+}
+
+// ScaleOut places a ladder of reduce-only limit orders taking profit on a
+// position in tranches (see ScaleOutTranches). On a failure the orders
+// already placed are canceled, so the ladder is placed whole or not at all;
+// the pair stays locked until it is.
+func ScaleOut(ctx context.Context, t Trader, p Position, contract *market.ContractInfo, fractions, prices []float64) ([]Order, error) {
+	tranches, err := ScaleOutTranches(p, contract, fractions, prices)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, unlock, err := LockSymbol(ctx, t, p.Pair)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	side := SellSide
+	if p.Side == SellSide {
+		side = BuySide
+	}
+	orders := make([]Order, 0, len(tranches))
+	for i, tranche := range tranches {
+		order, err := t.CreateOrder(ctx, OrderRequest{
+			Pair:       p.Pair,
+			Side:       side,
+			Type:       LimitOrder,
+			Amount:     tranche.Amount,
+			Price:      tranche.Price,
+			ReduceOnly: true,
+		})
+		if err == nil && order == nil {
+			err = errors.New("exchange returned no order")
+		}
+		if err != nil {
+			for _, placed := range orders {
+				if cancelErr := t.CancelOrder(ctx, placed.ID); cancelErr != nil {
+					err = fmt.Errorf("%w; failed to cancel tranche order %s: %v", err, placed.ID, cancelErr)
+				}
+			}
+			return nil, fmt.Errorf("tranche %d: %w", i, err)
+		}
+		orders = append(orders, *order)
+	}
+	return orders, nil
+}
@@ -0,0 +1,120 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nofx/logger"
+)
+
+// SlippageGuard closes positions with a protective limit order priced at the
+// mark price plus or minus a maximum slippage, falling back to a market close
+// if the limit order doesn't fill within the timeout
+type SlippageGuard struct {
+	MaxSlippageBps float64
+	Timeout        time.Duration
+	PollInterval   time.Duration
+}
+
+// NewSlippageGuard creates a new slippage guard; a zero maxSlippageBps disables protection
+func NewSlippageGuard(maxSlippageBps float64, timeout time.Duration) *SlippageGuard {
+	return &SlippageGuard{
+		MaxSlippageBps: maxSlippageBps,
+		Timeout:        timeout,
+		PollInterval:   500 * time.Millisecond,
+	}
+}
+
+// LimitPrice returns the worst acceptable price for closing a position
+func (g *SlippageGuard) LimitPrice(p Position) float64 {
+	slippage := p.MarkPrice * g.MaxSlippageBps / 10000
+	if p.Side == BuySide {
+		return p.MarkPrice - slippage
+	}
+	return p.MarkPrice + slippage
+}
+
+// Close closes amount of a position with slippage protection; a nil or disabled
+// guard closes at market. When ctx ends while waiting for the limit order, the
+// order is canceled and no market close follows.
+func (g *SlippageGuard) Close(ctx context.Context, t Trader, p Position, amount float64) (*Order, error) {
+	if g == nil || g.MaxSlippageBps <= 0 || p.MarkPrice <= 0 {
+		return t.ClosePosition(ctx, p.Pair, amount)
+	}
+
+	// The limit attempt and its market fallback run as one step on the pair
+	ctx, unlock, err := LockSymbol(ctx, t, p.Pair)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	side := SellSide
+	if p.Side == SellSide {
+		side = BuySide
+	}
+
+	order, err := t.CreateOrder(ctx, OrderRequest{
+		Pair:       p.Pair,
+		Side:       side,
+		Type:       LimitOrder,
+		Amount:     amount,
+		Price:      g.LimitPrice(p),
+		Leverage:   p.Leverage,
+		ReduceOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, fmt.Errorf("protected close of %s: exchange returned no order", p.Pair)
+	}
+
+	deadline := time.Now().Add(g.Timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-time.After(g.PollInterval):
+		case <-ctx.Done():
+			if err := t.CancelOrder(context.WithoutCancel(ctx), order.ID); err != nil {
+				logger.Warning("Failed to cancel protected close order %s: %v", order.ID, err)
+			}
+			return order, ctx.Err()
+		}
+		current, err := t.GetOrder(ctx, order.ID)
+		if err != nil || current == nil {
+			logger.Warning("Failed to poll protected close order %s: %v", order.ID, err)
+			continue
+		}
+		order = current
+		if order.Status == OrderStatusFilled {
+			return order, nil
+		}
+		if order.Status == OrderStatusCanceled || order.Status == OrderStatusRejected || order.Status == OrderStatusExpired {
+			break
+		}
+	}
+
+	if err := t.CancelOrder(ctx, order.ID); err != nil {
+		logger.Warning("Failed to cancel protected close order %s: %v", order.ID, err)
+	}
+	// The order may have filled further until it was canceled; closing the
+	// remainder of a stale poll would reduce more than asked
+	final, err := t.GetOrder(ctx, order.ID)
+	if err != nil {
+		return order, fmt.Errorf("protected close order %s: reading the fill after canceling: %w", order.ID, err)
+	}
+	if final == nil {
+		return order, fmt.Errorf("protected close order %s: exchange returned no order after canceling", order.ID)
+	}
+	order = final
+
+	remaining := amount - order.FilledAmount
+	if remaining <= 0 {
+		return order, nil
+	}
+
+	logger.Warning("Protected close for %s not filled within %s, closing remaining %.8f at market",
+		p.Pair, g.Timeout, remaining)
+	return t.ClosePosition(ctx, p.Pair, remaining)
+}
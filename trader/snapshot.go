@@ -0,0 +1,132 @@
+package trader
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshot represents balances and positions captured together, so values
+// derived from both (equity, exposure) refer to the same moment. Snapshots
+// served by a Cache carry their age in seconds and are Stale when older than
+// its TTL because the exchange couldn't be reached, StaleReason saying why.
+// Equity is the balance of the settlement currency, unrealized PnL included.
+type Snapshot struct {
+	Balances      []Balance  `json:"balances"`
+	Positions     []Position `json:"positions"`
+	UnrealizedPnl float64    `json:"unrealized_pnl"`
+	Funding       float64    `json:"funding"`
+	Currency      string     `json:"currency"`
+	Equity        float64    `json:"equity"`
+	Time          time.Time  `json:"snapshot_time"`
+	Age           float64    `json:"snapshot_age"`
+	Stale         bool       `json:"stale"`
+	StaleReason   string     `json:"stale_reason,omitempty"`
+}
+
+// TakeSnapshot fetches balances and positions from a trader into a snapshot
+// stamped with the time the capture started, with the equity in the
+// settlement currency
+func TakeSnapshot(ctx context.Context, t Trader, currency string) (*Snapshot, error) {
+	at := time.Now()
+
+	var (
+		wg          sync.WaitGroup
+		balances    []Balance
+		positions   []Position
+		balanceErr  error
+		positionErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		balances, balanceErr = t.GetBalance(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		positions, positionErr = t.GetPositions(ctx)
+	}()
+	wg.Wait()
+	if balanceErr != nil {
+		return nil, balanceErr
+	}
+	if positionErr != nil {
+		return nil, positionErr
+	}
+
+	s := &Snapshot{Balances: balances, Positions: positions, Currency: currency, Time: at}
+	// Balances of other currencies aren't worth their quantity in the
+	// settlement currency, and the totals already include unrealized PnL
+	for _, b := range balances {
+		if strings.EqualFold(b.Currency, currency) {
+			s.Equity += b.Total
+		}
+	}
+	for _, p := range positions {
+		s.UnrealizedPnl += p.UnrealizedPnl
+		s.Funding += p.Funding
+	}
+	return s, nil
+}
+
+// Snapshot returns the cached account snapshot, refreshing it when expired.
+// While the background refresher runs, or when the refresh fails, a snapshot
+// up to the maximum staleness is served marked stale.
+func (c *Cache) Snapshot(ctx context.Context) (*Snapshot, error) {
+	c.mu.RLock()
+	cached, background := c.snapshot, c.stop != nil
+	c.mu.RUnlock()
+	if cached != nil {
+		age := time.Since(cached.Time)
+		if age < c.ttl || (background && age < c.maxStale) {
+			return c.served(cached), nil
+		}
+	}
+
+	s, err := c.RefreshSnapshot(ctx)
+	if err != nil {
+		if cached != nil && time.Since(cached.Time) < c.maxStale {
+			return c.served(cached), nil
+		}
+		return nil, err
+	}
+	return c.served(s), nil
+}
+
+// RefreshSnapshot captures a new account snapshot and caches it, also
+// replacing the cached balances and positions so every reader agrees
+func (c *Cache) RefreshSnapshot(ctx context.Context) (*Snapshot, error) {
+	s, err := TakeSnapshot(ctx, c.trader, c.currency)
+	if err != nil {
+		c.mu.Lock()
+		c.refreshErr = err
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.snapshot, c.refreshErr = s, nil
+	c.balances, c.balancesAt = s.Balances, s.Time
+	c.positions, c.positionsAt = s.Positions, s.Time
+	c.mu.Unlock()
+
+	return s, nil
+}
+
+// served returns a copy of a cached snapshot stamped with its age, marked
+// stale with the last refresh error once older than the TTL
+func (c *Cache) served(s *Snapshot) *Snapshot {
+	copied := *s
+	age := time.Since(s.Time)
+	copied.Age = age.Seconds()
+	if age >= c.ttl {
+		copied.Stale = true
+		c.mu.RLock()
+		if c.refreshErr != nil {
+			copied.StaleReason = c.refreshErr.Error()
+		}
+		c.mu.RUnlock()
+	}
+	return &copied
+}
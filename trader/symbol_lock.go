@@ -0,0 +1,173 @@
+package trader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SymbolLocker is implemented by traders serializing the trading operations
+// on each contract
+type SymbolLocker interface {
+	// LockSymbol waits until no other operation on pair is in progress and
+	// holds it until unlock is called. Operations through the returned
+	// context don't wait for the lock it holds, so a read-decide-order
+	// sequence can run as one step.
+	LockSymbol(ctx context.Context, pair string) (locked context.Context, unlock func(), err error)
+}
+
+// LockSymbol holds the trading lock of pair on t; traders that don't
+// serialize operations return ctx and a no-op unlock
+func LockSymbol(ctx context.Context, t Trader, pair string) (context.Context, func(), error) {
+	if l, ok := t.(SymbolLocker); ok {
+		return l.LockSymbol(ctx, pair)
+	}
+	return ctx, func() {}, nil
+}
+
+// heldSymbolsKey is the context key of the symbol locks held by a call chain
+type heldSymbolsKey struct{}
+
+// heldSymbols lists the symbol locks held through a context, by their owner
+type heldSymbols struct {
+	owner *SymbolLocks
+	pair  string
+	next  *heldSymbols
+}
+
+// holds reports whether ctx holds the lock of pair from l
+func (l *SymbolLocks) holds(ctx context.Context, pair string) bool {
+	for h, _ := ctx.Value(heldSymbolsKey{}).(*heldSymbols); h != nil; h = h.next {
+		if h.owner == l && h.pair == pair {
+			return true
+		}
+	}
+	return false
+}
+
+// SymbolLocks wraps a Trader and runs the operations opening, closing or
+// adjusting a position one at a time per contract, so concurrent signals
+// for one symbol can't both pass the risk checks and double-size it.
+// Queries and cancellations run unserialized.
+type SymbolLocks struct {
+	Trader
+
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+// NewSymbolLocks creates a new per-symbol serializing wrapper around t
+func NewSymbolLocks(t Trader) *SymbolLocks {
+	return &SymbolLocks{Trader: t, locks: make(map[string]chan struct{})}
+}
+
+// Unwrap returns the wrapped trader
+func (l *SymbolLocks) Unwrap() Trader {
+	return l.Trader
+}
+
+// LockSymbol implements SymbolLocker
+func (l *SymbolLocks) LockSymbol(ctx context.Context, pair string) (context.Context, func(), error) {
+	if l.holds(ctx, pair) {
+		return ctx, func() {}, nil
+	}
+
+	l.mu.Lock()
+	lock, ok := l.locks[pair]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		l.locks[pair] = lock
+	}
+	l.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx, func() {}, ctx.Err()
+	}
+	var once sync.Once
+	unlock := func() { once.Do(func() { <-lock }) }
+
+	parent, _ := ctx.Value(heldSymbolsKey{}).(*heldSymbols)
+	held := &heldSymbols{owner: l, pair: pair, next: parent}
+	return context.WithValue(ctx, heldSymbolsKey{}, held), unlock, nil
+}
+
+// CreateOrder creates the order while holding the lock of its pair
+func (l *SymbolLocks) CreateOrder(ctx context.Context, req OrderRequest) (*Order, error) {
+	ctx, unlock, err := l.LockSymbol(ctx, req.Pair)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return l.Trader.CreateOrder(ctx, req)
+}
+
+// ClosePosition closes the position while holding the lock of its pair
+func (l *SymbolLocks) ClosePosition(ctx context.Context, pair string, amount float64) (*Order, error) {
+	ctx, unlock, err := l.LockSymbol(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return l.Trader.ClosePosition(ctx, pair, amount)
+}
+
+// SetLeverage sets the leverage while holding the lock of the pair
+func (l *SymbolLocks) SetLeverage(ctx context.Context, pair string, leverage int64) error {
+	ctx, unlock, err := l.LockSymbol(ctx, pair)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return l.Trader.SetLeverage(ctx, pair, leverage)
+}
+
+// SetStopLoss places a stop loss while holding the lock of its pair
+func (l *SymbolLocks) SetStopLoss(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	ctx, unlock, err := l.LockSymbol(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return l.Trader.SetStopLoss(ctx, pair, side, amount, triggerPrice, priceType)
+}
+
+// SetTakeProfit places a take profit while holding the lock of its pair
+func (l *SymbolLocks) SetTakeProfit(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	ctx, unlock, err := l.LockSymbol(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return l.Trader.SetTakeProfit(ctx, pair, side, amount, triggerPrice, priceType)
+}
+
+// SetTrailingStop places a native trailing stop while holding the lock of its pair
+func (l *SymbolLocks) SetTrailingStop(ctx context.Context, pair string, side Side, callbackRate float64) (*Order, error) {
+	ctx, unlock, err := l.LockSymbol(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return SetTrailingStop(ctx, l.Trader, pair, side, callbackRate)
+}
+
+// GetOrderByClientID looks an order up by its client order ID through the
+// wrapped trader
+func (l *SymbolLocks) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*Order, error) {
+	return GetOrderByClientID(ctx, l.Trader, pair, clientOrderID)
+}
+
+// PositionMode returns the position mode of the wrapped trader's account
+func (l *SymbolLocks) PositionMode(ctx context.Context) (PositionMode, error) {
+	return GetPositionMode(ctx, l.Trader)
+}
+
+// GetTransfers lists the account's deposits and withdrawals through the
+// wrapped trader
+func (l *SymbolLocks) GetTransfers(ctx context.Context, since time.Time) ([]Transfer, error) {
+	return GetTransfers(ctx, l.Trader, since)
+}
+
+var _ Trader = (*SymbolLocks)(nil)
@@ -0,0 +1,20 @@
+package trader
+
+import (
+	"errors"
+	"reflect"
+)
+
+// errDuplicateClientOrderID is returned when an exchange rejects an order
+// because its client order ID was already used, typically by an earlier
+// attempt that reached the exchange before the connection failed
+var errDuplicateClientOrderID = errors.New("duplicate client order ID")
+
+// requestWeight returns the rate limit weight of a request body: batch
+// requests count each of their items, anything else counts once
+func requestWeight(body interface{}) float64 {
+	if v := reflect.ValueOf(body); v.Kind() == reflect.Slice && v.Len() > 0 {
+		return float64(v.Len())
+	}
+	return 1
+}
@@ -0,0 +1,25 @@
+package trader
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTrailingNotSupported is returned when an exchange has no native trailing stops
+var ErrTrailingNotSupported = errors.New("native trailing stops not supported")
+
+// TrailingStopper is implemented by traders supporting native trailing stops
+type TrailingStopper interface {
+	// SetTrailingStop places a stop closing the position of the given side
+	// once the price retraces callbackRate (0.01 = 1%) from its best level
+	SetTrailingStop(ctx context.Context, pair string, side Side, callbackRate float64) (*Order, error)
+}
+
+// SetTrailingStop places a native trailing stop through t, returning
+// ErrTrailingNotSupported when t doesn't support one
+func SetTrailingStop(ctx context.Context, t Trader, pair string, side Side, callbackRate float64) (*Order, error) {
+	if ts, ok := t.(TrailingStopper); ok {
+		return ts.SetTrailingStop(ctx, pair, side, callbackRate)
+	}
+	return nil, ErrTrailingNotSupported
+}
@@ -0,0 +1,58 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTransfersNotSupported is returned when a trader can't list the account's
+// deposits and withdrawals
+var ErrTransfersNotSupported = errors.New("deposit and withdrawal history not supported")
+
+// TransferType represents the direction of a transfer
+type TransferType string
+
+const (
+	// Deposit moves funds into the account
+	Deposit TransferType = "deposit"
+	// Withdrawal moves funds out of the account
+	Withdrawal TransferType = "withdrawal"
+)
+
+// Transfer represents a deposit to or a withdrawal from the account; Status
+// is the exchange's own state, Completed whether the funds have moved
+type Transfer struct {
+	ID        string       `json:"id"`
+	Type      TransferType `json:"type"`
+	Currency  string       `json:"currency"`
+	Amount    float64      `json:"amount"`
+	Status    string       `json:"status"`
+	Completed bool         `json:"completed"`
+	Time      time.Time    `json:"time"`
+}
+
+// Net returns the signed amount of the transfer: positive for deposits,
+// negative for withdrawals
+func (t Transfer) Net() float64 {
+	if t.Type == Withdrawal {
+		return -t.Amount
+	}
+	return t.Amount
+}
+
+// TransferReader is implemented by traders listing the account's deposits
+// and withdrawals; reading them needs no withdrawal permission
+type TransferReader interface {
+	// GetTransfers returns the deposits and withdrawals since a time
+	GetTransfers(ctx context.Context, since time.Time) ([]Transfer, error)
+}
+
+// GetTransfers returns the deposits and withdrawals of the account behind t
+// since a time, returning ErrTransfersNotSupported when t can't list them
+func GetTransfers(ctx context.Context, t Trader, since time.Time) ([]Transfer, error) {
+	if r, ok := t.(TransferReader); ok {
+		return r.GetTransfers(ctx, since)
+	}
+	return nil, ErrTransfersNotSupported
+}
@@ -0,0 +1,78 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrWatchOnly is returned for every order placement, cancellation or
+// account change while running watch-only
+var ErrWatchOnly = errors.New("watch-only mode: trading is disabled")
+
+// WatchOnly wraps a Trader connected with read-only keys: balances,
+// positions and orders are read through it, while every call placing,
+// canceling or changing orders or the account fails with ErrWatchOnly
+// without reaching the exchange
+type WatchOnly struct {
+	Trader
+}
+
+// NewWatchOnly creates a new watch-only wrapper around t
+func NewWatchOnly(t Trader) *WatchOnly {
+	return &WatchOnly{Trader: t}
+}
+
+// Unwrap returns the wrapped trader
+func (w *WatchOnly) Unwrap() Trader {
+	return w.Trader
+}
+
+// CreateOrder implements Trader
+func (w *WatchOnly) CreateOrder(ctx context.Context, req OrderRequest) (*Order, error) {
+	return nil, ErrWatchOnly
+}
+
+// CancelOrder implements Trader
+func (w *WatchOnly) CancelOrder(ctx context.Context, orderID string) error {
+	return ErrWatchOnly
+}
+
+// ClosePosition implements Trader
+func (w *WatchOnly) ClosePosition(ctx context.Context, pair string, amount float64) (*Order, error) {
+	return nil, ErrWatchOnly
+}
+
+// SetLeverage implements Trader
+func (w *WatchOnly) SetLeverage(ctx context.Context, pair string, leverage int64) error {
+	return ErrWatchOnly
+}
+
+// SetStopLoss implements Trader
+func (w *WatchOnly) SetStopLoss(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	return nil, ErrWatchOnly
+}
+
+// SetTakeProfit implements Trader
+func (w *WatchOnly) SetTakeProfit(ctx context.Context, pair string, side Side, amount, triggerPrice float64, priceType TriggerPriceType) (*Order, error) {
+	return nil, ErrWatchOnly
+}
+
+// GetOrderByClientID looks an order up by its client order ID through the
+// wrapped trader
+func (w *WatchOnly) GetOrderByClientID(ctx context.Context, pair, clientOrderID string) (*Order, error) {
+	return GetOrderByClientID(ctx, w.Trader, pair, clientOrderID)
+}
+
+// PositionMode returns the position mode of the wrapped trader's account
+func (w *WatchOnly) PositionMode(ctx context.Context) (PositionMode, error) {
+	return GetPositionMode(ctx, w.Trader)
+}
+
+// GetTransfers lists the account's deposits and withdrawals through the
+// wrapped trader
+func (w *WatchOnly) GetTransfers(ctx context.Context, since time.Time) ([]Transfer, error) {
+	return GetTransfers(ctx, w.Trader, since)
+}
+
+var _ Trader = (*WatchOnly)(nil)
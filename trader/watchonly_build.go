@@ -0,0 +1,7 @@
+//go:build watchonly
+
+package trader
+
+// WatchOnlyBuild reports whether the binary was built with the watchonly
+// tag, which forces watch-only mode whatever the configuration
+const WatchOnlyBuild = true